@@ -37,6 +37,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -47,6 +48,16 @@ const (
 	// LetsEncryptURL is the Directory endpoint of Let's Encrypt CA.
 	LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
 
+	// ZeroSSLURL is the Directory endpoint of ZeroSSL CA. It requires an
+	// external account binding, which can be obtained with
+	// ZeroSSLExternalAccountBinding.
+	ZeroSSLURL = "https://acme.zerossl.com/v2/DV90"
+
+	// GoogleTrustServicesURL is the Directory endpoint of Google Trust
+	// Services CA. It requires an external account binding, created with
+	// the Google Cloud Public CA API.
+	GoogleTrustServicesURL = "https://dv.acme-v02.api.pki.goog/directory"
+
 	// ALPNProto is the ALPN protocol name used by a CA server when validating
 	// tls-alpn-01 challenges.
 	//
@@ -95,6 +106,12 @@ type Client struct {
 	// instead of http.DefaultClient.
 	HTTPClient *http.Client
 
+	// Middleware optionally wraps the transport of the HTTP client for
+	// every request sent to the CA, including each retry, so that callers
+	// can log, instrument or alter them. The first element is the
+	// outermost: it sees the requests first and the responses last.
+	Middleware []Middleware
+
 	// DirectoryURL points to the CA directory endpoint.
 	// If empty, LetsEncryptURL is used.
 	// Mutating this value after a successful call of Client's Discover method
@@ -185,11 +202,13 @@ func (c *Client) Discover(ctx context.Context) (Directory, error) {
 		Revoke    string `json:"revokeCert"`
 		Nonce     string `json:"newNonce"`
 		KeyChange string `json:"keyChange"`
+		RenewInfo string `json:"renewalInfo"`
 		Meta      struct {
-			Terms        string   `json:"termsOfService"`
-			Website      string   `json:"website"`
-			CAA          []string `json:"caaIdentities"`
-			ExternalAcct bool     `json:"externalAccountRequired"`
+			Terms        string            `json:"termsOfService"`
+			Website      string            `json:"website"`
+			CAA          []string          `json:"caaIdentities"`
+			ExternalAcct bool              `json:"externalAccountRequired"`
+			Profiles     map[string]string `json:"profiles"`
 		}
 	}
 	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
@@ -209,6 +228,8 @@ func (c *Client) Discover(ctx context.Context) (Directory, error) {
 		Website:                 v.Meta.Website,
 		CAA:                     v.Meta.CAA,
 		ExternalAccountRequired: v.Meta.ExternalAcct,
+		Profiles:                v.Meta.Profiles,
+		RenewalInfoURL:          v.RenewInfo,
 	}
 	return *c.dir, nil
 }
@@ -248,7 +269,9 @@ func (c *Client) FetchCert(ctx context.Context, url string, bundle bool) ([][]by
 //
 // The key argument, used to sign the request, must be authorized
 // to revoke the certificate. It's up to the CA to decide which keys are authorized.
-// For instance, the key pair of the certificate may be authorized.
+// For instance, the key pair of the certificate may be authorized,
+// which allows revoking it when the account key is lost: c.Key is not
+// needed in that case.
 // If the key is nil, c.Key is used instead.
 func (c *Client) RevokeCert(ctx context.Context, key crypto.Signer, cert []byte, reason CRLReasonCode) error {
 	if _, err := c.Discover(ctx); err != nil {
@@ -257,6 +280,55 @@ func (c *Client) RevokeCert(ctx context.Context, key crypto.Signer, cert []byte,
 	return c.revokeCertRFC(ctx, key, cert, reason)
 }
 
+// Revocation is a certificate to revoke with Client.RevokeCerts.
+type Revocation struct {
+	// Cert is the certificate, in DER format.
+	Cert []byte
+	// Key signs the revocation request, as the key argument of RevokeCert.
+	// If nil, Client.Key is used instead.
+	Key    crypto.Signer
+	Reason CRLReasonCode
+}
+
+// RevokeCerts revokes the certificates of revs one after the other, as
+// RevokeCert does, and waits interval between two requests to stay within
+// the rate limits of the CA.
+//
+// Requests that exceed a rate limit anyway are retried according to
+// c.RetryBackoff, and then after the delay requested by the CA, until ctx
+// is done. The returned error joins the errors of the certificates that
+// could not be revoked.
+func (c *Client) RevokeCerts(ctx context.Context, revs []Revocation, interval time.Duration) error {
+	if _, err := c.Discover(ctx); err != nil {
+		return err
+	}
+	var errs []error
+	for i, rev := range revs {
+		if i > 0 && interval > 0 {
+			if err := sleep(ctx, interval); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+		err := c.revokeCertRFC(ctx, rev.Key, rev.Cert, rev.Reason)
+		var e *Error
+		for errors.Is(err, ErrRateLimited) && errors.As(err, &e) && e.RetryAfter() > 0 {
+			if sleep(ctx, e.RetryAfter()) != nil {
+				break
+			}
+			err = c.revokeCertRFC(ctx, rev.Key, rev.Cert, rev.Reason)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("acme: revoking certificate %d: %w", i, err))
+		}
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // AcceptTOS always returns true to indicate the acceptance of a CA's Terms of Service
 // during account registration. See Register method of Client for more details.
 func AcceptTOS(tosURL string) bool { return true }
@@ -273,6 +345,9 @@ func AcceptTOS(tosURL string) bool { return true }
 // and prompt is called if Directory's Terms field is non-zero.
 // Also see Error's Instance field for when a CA requires already registered accounts to agree
 // to an updated Terms of Service.
+//
+// If the CA's directory indicates that an external account binding is required and
+// acct has none, Register returns ErrExternalAccountRequired.
 func (c *Client) Register(ctx context.Context, acct *Account, prompt func(tosURL string) bool) (*Account, error) {
 	if c.Key == nil {
 		return nil, errors.New("acme: client.Key must be set to Register")
@@ -617,6 +692,10 @@ func (c *Client) TLSSNI02ChallengeCert(token string, opt ...CertOption) (cert tl
 // The returned certificate is valid for the next 24 hours and must be presented only when
 // the server name in the TLS ClientHello matches the domain, and the special acme-tls/1 ALPN protocol
 // has been specified.
+//
+// The domain argument may also be the value of an "ip" identifier, as in RFC 8738.
+// The returned certificate then has the address as an IP address SAN, and must be
+// presented when the server name is ReverseName of the address.
 func (c *Client) TLSALPN01ChallengeCert(token, domain string, opt ...CertOption) (cert tls.Certificate, err error) {
 	ka, err := keyAuth(c.Key.Public(), token)
 	if err != nil {
@@ -650,6 +729,27 @@ func (c *Client) TLSALPN01ChallengeCert(token, domain string, opt ...CertOption)
 	return tlsChallengeCert([]string{domain}, newOpt)
 }
 
+// ReverseName returns the reverse mapping domain name of ip, in the in-addr.arpa
+// domain for IPv4 addresses and the ip6.arpa domain for IPv6 addresses, without
+// a trailing dot. CAs send it as the TLS server name when they validate an "ip"
+// identifier with the TLS-ALPN-01 challenge, as described in RFC 8738, Section 6.
+//
+// ReverseName returns the empty string if ip is not a valid IP address.
+func ReverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	if len(ip) != net.IPv6len {
+		return ""
+	}
+	const hexDigits = "0123456789abcdef"
+	b := make([]byte, 0, 4*len(ip)+len("ip6.arpa"))
+	for i := len(ip) - 1; i >= 0; i-- {
+		b = append(b, hexDigits[ip[i]&0xf], '.', hexDigits[ip[i]>>4], '.')
+	}
+	return string(append(b, "ip6.arpa"...))
+}
+
 // popNonce returns a nonce value previously stored with c.addNonce
 // or fetches a fresh one from c.dir.NonceURL.
 // If NonceURL is empty, it first tries c.directoryURL() and, failing that,
@@ -793,9 +893,19 @@ func tlsChallengeCert(san []string, opt []CertOption) (tls.Certificate, error) {
 			return tls.Certificate{}, err
 		}
 	}
-	tmpl.DNSNames = san
-	if len(san) > 0 {
-		tmpl.Subject.CommonName = san[0]
+	// IP address identifiers are not DNS names, nor valid common names.
+	// See RFC 8738, Section 6.
+	tmpl.DNSNames = nil
+	tmpl.IPAddresses = nil
+	for _, name := range san {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+	if len(tmpl.DNSNames) > 0 {
+		tmpl.Subject.CommonName = tmpl.DNSNames[0]
 	}
 
 	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
@@ -816,3 +926,15 @@ func encodePEM(typ string, b []byte) []byte {
 
 // timeNow is time.Now, except in tests which can mess with it.
 var timeNow = time.Now
+
+// sleep pauses the current goroutine for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -756,6 +757,45 @@ func TestTLSALPN01ChallengeCert(t *testing.T) {
 
 }
 
+func TestTLSALPN01ChallengeCertIP(t *testing.T) {
+	const token = "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ-PCt92wr-oA"
+	for _, addr := range []string{"192.0.2.1", "2001:db8::1"} {
+		tlscert, err := newTestClient().TLSALPN01ChallengeCert(token, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(tlscert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.DNSNames) != 0 || cert.Subject.CommonName != "" {
+			t.Errorf("%s: cert.DNSNames = %v, CommonName = %q; want none", addr, cert.DNSNames, cert.Subject.CommonName)
+		}
+		if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP(addr)) {
+			t.Errorf("%s: cert.IPAddresses = %v", addr, cert.IPAddresses)
+		}
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		ip, want string
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa"},
+		{"::ffff:192.0.2.1", "1.2.0.192.in-addr.arpa"},
+		// RFC 8738, Section 6.
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+	}
+	for _, tt := range tests {
+		if got := ReverseName(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("ReverseName(%s) = %q; want %q", tt.ip, got, tt.want)
+		}
+	}
+	if got := ReverseName(nil); got != "" {
+		t.Errorf("ReverseName(nil) = %q; want empty", got)
+	}
+}
+
 func TestTLSChallengeCertOpt(t *testing.T) {
 	key, err := rsa.GenerateKey(rand.Reader, 512)
 	if err != nil {
@@ -66,16 +66,19 @@ func AcceptTOS(tosURL string) bool { return true }
 type HostPolicy func(ctx context.Context, host string) error
 
 // HostWhitelist returns a policy where only the specified host names are allowed.
-// Only exact matches are currently supported. Subdomains, regexp or wildcard
-// will not match.
+// Only exact matches are supported. Subdomains, regexp or wildcard
+// will not match; use HostRules for these.
 //
 // Note that all hosts will be converted to Punycode via idna.Lookup.ToASCII so that
 // Manager.GetCertificate can handle the Unicode IDN and mixedcase hosts correctly.
+// IP addresses are allowed too, and match any textual form of the same address.
 // Invalid hosts will be silently ignored.
 func HostWhitelist(hosts ...string) HostPolicy {
 	whitelist := make(map[string]bool, len(hosts))
 	for _, h := range hosts {
-		if h, err := idna.Lookup.ToASCII(h); err == nil {
+		if ip := net.ParseIP(h); ip != nil {
+			whitelist[ip.String()] = true
+		} else if h, err := idna.Lookup.ToASCII(h); err == nil {
 			whitelist[h] = true
 		}
 	}
@@ -93,9 +96,14 @@ func defaultHostPolicy(context.Context, string) error {
 }
 
 // Manager is a stateful certificate manager built on top of acme.Client.
-// It obtains and refreshes certificates automatically using "tls-alpn-01"
-// or "http-01" challenge types, as well as providing them to a TLS server
-// via tls.Config.
+// It obtains and refreshes certificates automatically using "tls-alpn-01",
+// "http-01" or, if a DNSProvider is set, "dns-01" challenge types, as well as
+// providing them to a TLS server via tls.Config.
+//
+// Certificates can also be obtained for public IP addresses, with "ip"
+// identifiers as specified in RFC 8738, when IPCertificates is set, the CA
+// supports them and HostPolicy allows the address. See GetCertificate for
+// details.
 //
 // You must specify a cache implementation, such as DirCache,
 // to reuse obtained certificates across program restarts.
@@ -112,7 +120,9 @@ type Manager struct {
 
 	// Cache optionally stores and retrieves previously-obtained certificates
 	// and other state. If nil, certs will only be cached for the lifetime of
-	// the Manager. Multiple Managers can share the same Cache.
+	// the Manager. Multiple Managers can share the same Cache; if it
+	// implements Locker, they also coordinate to obtain each certificate
+	// only once.
 	//
 	// Using a persistent Cache, such as DirCache, is strongly recommended.
 	Cache Cache
@@ -135,6 +145,10 @@ type Manager struct {
 	// be renewed before they expire.
 	//
 	// If zero, they're renewed 30 days before expiration.
+	//
+	// If the CA supports ACME Renewal Information (RFC 9773), certificates
+	// are instead renewed within the window suggested by the CA, and
+	// RenewBefore is only used when that information is unavailable.
 	RenewBefore time.Duration
 
 	// Client is used to perform low-level operations, such as account registration
@@ -148,6 +162,15 @@ type Manager struct {
 	// Mutating the field after the first call of GetCertificate method will have no effect.
 	Client *acme.Client
 
+	// FallbackCAs optionally lists other CAs to obtain certificates from,
+	// in order, when obtaining one from the CA of Client fails, for
+	// instance because it is down or rate limits the Manager. Each CA has
+	// its own account, which is registered with Email and Prompt the first
+	// time the CA is used.
+	//
+	// Renewals start again with the CA of Client.
+	FallbackCAs []CA
+
 	// Email optionally specifies a contact email address.
 	// This is used by CAs, such as Let's Encrypt, to notify about problems
 	// with issued certificates.
@@ -173,10 +196,102 @@ type Manager struct {
 	// ExternalAccountBinding optionally represents an arbitrary binding to an
 	// account of the CA to which the ACME server is tied.
 	// See RFC 8555, Section 7.3.4 for more details.
+	//
+	// CAs such as Google Trust Services require one. If Client uses
+	// acme.ZeroSSLURL and Email is set, it may be nil, in which case the
+	// Manager obtains one from ZeroSSL for Email.
 	ExternalAccountBinding *acme.ExternalAccountBinding
 
+	// DNSProvider optionally provisions TXT records for the "dns-01"
+	// challenge type. If nil, the Manager does not attempt "dns-01".
+	//
+	// When set, "dns-01" is tried after the challenge types enabled by
+	// TLSConfig and HTTPHandler. It is the only challenge type a CA accepts
+	// for wildcard certificates, see WildcardDomains.
+	DNSProvider DNSProvider
+
+	// WildcardDomains optionally lists parent domains, such as "example.com",
+	// whose direct subdomains are all served a single "*.example.com"
+	// certificate instead of a certificate per subdomain. The parent domain
+	// itself is not covered by the wildcard certificate.
+	//
+	// WildcardDomains is ignored if DNSProvider is nil. HostPolicy is still
+	// called with the host name from the TLS ClientHello before a new
+	// wildcard certificate is requested.
+	WildcardDomains []string
+
+	// SANGroups optionally groups host names into certificates with
+	// several subject alternative names, so that fewer certificates are
+	// requested from the CA. It is called with the host name from each TLS
+	// ClientHello, and returns the group the host is served with, or nil for
+	// a certificate of its own. Groups must be consistent: every host of a
+	// group must map to the same group, with the same Hosts.
+	//
+	// The certificate of a group is requested, cached under its Name and
+	// renewed for all its Hosts at once. Before it is first requested
+	// HostPolicy is called with each of them. SANGroups is not called for
+	// IP addresses and hosts covered by WildcardDomains. See GroupByDomain.
+	SANGroups func(ctx context.Context, host string) (*SANGroup, error)
+
+	// OCSPStapling makes the Manager staple OCSP responses to the
+	// certificates it serves, in their OCSPStaple field. The responses are
+	// fetched in the background from the OCSP server named in each
+	// certificate, stored in Cache, and refreshed halfway through their
+	// validity period. Only responses reporting a certificate as good are
+	// stapled, and a certificate is served without a staple until its
+	// first response is fetched.
+	OCSPStapling bool
+
+	// IPCertificates makes GetCertificate obtain certificates for IP
+	// addresses, with "ip" identifiers as specified in RFC 8738: for the
+	// local address of connections without a server name, if HostPolicy
+	// is non-nil and allows it, and for server names that are IP
+	// addresses. The CA must support "ip" identifiers. If false, such
+	// connections are rejected.
+	IPCertificates bool
+
+	// OCSPRefreshJitter optionally specifies the maximum random amount of
+	// time by which OCSP responses are refreshed early, so that many
+	// servers don't all query the OCSP server at once.
+	//
+	// If zero, up to an hour is used. If negative, no jitter is added.
+	OCSPRefreshJitter time.Duration
+
+	// Profile optionally names the certificate profile requested for new
+	// certificates, such as "shortlived" or "tlsserver" for Let's Encrypt.
+	// It is only requested from the CAs which offer it in their directory,
+	// see acme.Directory.Profiles, the others issuing their default
+	// certificates.
+	//
+	// Profiles of short-lived certificates need a RenewBefore shorter than
+	// their lifetime, unless the CA provides ACME Renewal Information.
+	Profile string
+
+	// Events optionally receives an Event when a certificate is issued or
+	// renewed, when its renewal fails, when the cache misses, and when the
+	// CA rate limits the Manager. This allows, for instance, alerting on
+	// certificates approaching their expiration without being renewed.
+	//
+	// Events may be called concurrently, and blocks the operation which
+	// triggered it, so it should return quickly.
+	Events func(Event)
+
+	// Preflight optionally makes the Manager check, before requesting a
+	// certificate, that the CA will be able to validate its challenges:
+	// that each host name resolves to an address, and that at each address
+	// the "tls-alpn-01" challenge on port 443 or, if HTTPHandler is used,
+	// the "http-01" challenge on port 80 reaches the Manager. If a check
+	// fails, no order is created with the CA, which would count against its
+	// rate limits, and a *PreflightError explains what to fix.
+	//
+	// The checks connect to the server from itself, so they fail behind a
+	// NAT which doesn't allow that. Preflight is ignored if DNSProvider is
+	// set, since the "dns-01" challenge doesn't need the server to be
+	// reachable.
+	Preflight *Preflight
+
 	clientMu sync.Mutex
-	client   *acme.Client // initialized by acmeClient method
+	clients  map[int]*acme.Client // initialized by caClient method, by CA index
 
 	stateMu sync.Mutex
 	state   map[certKey]*certState
@@ -185,6 +300,10 @@ type Manager struct {
 	renewalMu sync.Mutex
 	renewal   map[certKey]*domainRenewal
 
+	// stapling tracks the OCSP refresh timers, if OCSPStapling is set.
+	staplingMu sync.Mutex
+	stapling   map[certKey]*ocspStapler
+
 	// challengeMu guards tryHTTP01, certTokens and httpTokens.
 	challengeMu sync.RWMutex
 	// tryHTTP01 indicates whether the Manager should try "http-01" challenge type
@@ -205,21 +324,57 @@ type Manager struct {
 	nowFunc func() time.Time
 }
 
+// A CA is an ACME CA which a Manager falls back to. See Manager.FallbackCAs.
+type CA struct {
+	// Client is used to perform the operations with the CA, whose directory
+	// endpoint is Client.DirectoryURL. It must not be nil.
+	//
+	// If the Client.Key is nil, a new ECDSA P-256 key is generated and, if
+	// the Cache of the Manager is not nil, stored in cache under a name
+	// derived from the directory URL.
+	Client *acme.Client
+
+	// ExternalAccountBinding optionally binds the account to an account of
+	// the CA, like Manager.ExternalAccountBinding does for the CA of
+	// Manager.Client.
+	ExternalAccountBinding *acme.ExternalAccountBinding
+}
+
 // certKey is the key by which certificates are tracked in state, renewal and cache.
 type certKey struct {
-	domain  string // without trailing dot
+	domain  string // without trailing dot; "*." prefix for wildcard certs; group name for SAN group certs
+	names   string // space-separated host names of SAN group certs
 	isRSA   bool   // RSA cert for legacy clients (as opposed to default ECDSA)
 	isToken bool   // tls-based challenge token cert; key type is undefined regardless of isRSA
 }
 
+// dnsNames returns the names the certificate of c is for.
+func (c certKey) dnsNames() []string {
+	if c.names == "" {
+		return []string{c.domain}
+	}
+	return strings.Split(c.names, " ")
+}
+
 func (c certKey) String() string {
+	// Cache keys must be safe to use as file names, which rules out "*".
+	domain := c.domain
+	if strings.HasPrefix(domain, "*.") {
+		domain = "_wildcard" + domain[1:]
+	}
+	// Nor ":", which is in IPv6 addresses. Since these have no dots, the
+	// result can't be a valid domain name.
+	domain = strings.ReplaceAll(domain, ":", "_")
+	if c.names != "" {
+		domain += "+san"
+	}
 	if c.isToken {
-		return c.domain + "+token"
+		return domain + "+token"
 	}
 	if c.isRSA {
-		return c.domain + "+rsa"
+		return domain + "+rsa"
 	}
-	return c.domain
+	return domain
 }
 
 // TLSConfig creates a new TLS config suitable for net/http.Server servers,
@@ -246,30 +401,52 @@ func (m *Manager) TLSConfig() *tls.Config {
 //
 // If GetCertificate is used directly, instead of via Manager.TLSConfig, package users will
 // also have to add acme.ALPNProto to NextProtos for tls-alpn-01, or use HTTPHandler for http-01.
+//
+// If m.IPCertificates is set, GetCertificate also provides certificates for IP addresses.
+// Clients connecting to an IP address don't send a server name, so if hello has none,
+// GetCertificate provides a certificate for the local IP address of hello.Conn instead.
+// It only does so if m.HostPolicy is non-nil, and it is called with the address. The
+// tls-alpn-01 challenge is answered for IP addresses too, and the dns-01 challenge is
+// never used for them.
 func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	if m.Prompt == nil {
 		return nil, errors.New("acme/autocert: Manager.Prompt not set")
 	}
 
 	name := hello.ServerName
-	if name == "" {
-		return nil, errors.New("acme/autocert: missing server name")
-	}
-	if !strings.Contains(strings.Trim(name, "."), ".") {
-		return nil, errors.New("acme/autocert: server name component count invalid")
+	isIP := false
+	if ip := net.ParseIP(name); ip != nil {
+		// Some clients send IP address literals, although RFC 6066 forbids it.
+		if !m.IPCertificates {
+			return nil, errors.New("acme/autocert: server name is an IP address")
+		}
+		name, isIP = ip.String(), true
+	} else if name == "" {
+		ip := localIP(hello)
+		if ip == nil || !m.IPCertificates || m.HostPolicy == nil {
+			return nil, errors.New("acme/autocert: missing server name")
+		}
+		name, isIP = ip.String(), true
 	}
 
-	// Note that this conversion is necessary because some server names in the handshakes
-	// started by some clients (such as cURL) are not converted to Punycode, which will
-	// prevent us from obtaining certificates for them. In addition, we should also treat
-	// example.com and EXAMPLE.COM as equivalent and return the same certificate for them.
-	// Fortunately, this conversion also helped us deal with this kind of mixedcase problems.
-	//
-	// Due to the "σςΣ" problem (see https://unicode.org/faq/idn.html#22), we can't use
-	// idna.Punycode.ToASCII (or just idna.ToASCII) here.
-	name, err := idna.Lookup.ToASCII(name)
-	if err != nil {
-		return nil, errors.New("acme/autocert: server name contains invalid character")
+	if !isIP {
+		if !strings.Contains(strings.Trim(name, "."), ".") {
+			return nil, errors.New("acme/autocert: server name component count invalid")
+		}
+
+		// Note that this conversion is necessary because some server names in the handshakes
+		// started by some clients (such as cURL) are not converted to Punycode, which will
+		// prevent us from obtaining certificates for them. In addition, we should also treat
+		// example.com and EXAMPLE.COM as equivalent and return the same certificate for them.
+		// Fortunately, this conversion also helped us deal with this kind of mixedcase problems.
+		//
+		// Due to the "σςΣ" problem (see https://unicode.org/faq/idn.html#22), we can't use
+		// idna.Punycode.ToASCII (or just idna.ToASCII) here.
+		var err error
+		name, err = idna.Lookup.ToASCII(name)
+		if err != nil {
+			return nil, errors.New("acme/autocert: server name contains invalid character")
+		}
 	}
 
 	// In the worst-case scenario, the timeout needs to account for caching, host policy,
@@ -296,6 +473,14 @@ func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate,
 		domain: strings.TrimSuffix(name, "."), // golang.org/issue/18114
 		isRSA:  !supportsECDSA(hello),
 	}
+	if wildcard, ok := m.wildcardName(ck.domain); ok && !isIP {
+		ck.domain = wildcard
+	} else if m.SANGroups != nil && !isIP {
+		var err error
+		if ck, err = m.sanGroupKey(ctx, ck); err != nil {
+			return nil, err
+		}
+	}
 	cert, err := m.cert(ctx, ck)
 	if err == nil {
 		return cert, nil
@@ -305,15 +490,34 @@ func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate,
 	}
 
 	// first-time
-	if err := m.hostPolicy()(ctx, name); err != nil {
+	if ck.names != "" {
+		for _, host := range ck.dnsNames() {
+			if err := m.hostPolicy()(ctx, host); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := m.hostPolicy()(ctx, name); err != nil {
 		return nil, err
 	}
-	cert, err = m.createCert(ctx, ck)
-	if err != nil {
-		return nil, err
+	return m.createCert(ctx, ck)
+}
+
+// localIP returns the IP address on which the connection of hello was
+// accepted, or nil if it is unknown.
+func localIP(hello *tls.ClientHelloInfo) net.IP {
+	if hello.Conn == nil {
+		return nil
 	}
-	m.cachePut(ctx, ck, cert)
-	return cert, nil
+	if addr, ok := hello.Conn.LocalAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// isIPIdentifier reports whether name, which is the domain of a certKey,
+// is an IP address.
+func isIPIdentifier(name string) bool {
+	return net.ParseIP(name) != nil
 }
 
 // wantsTokenCert reports whether a TLS request with SNI is made by a CA server
@@ -386,7 +590,7 @@ func supportsECDSA(hello *tls.ClientHelloInfo) bool {
 // the fallback should not serve TLS-only requests.
 //
 // If HTTPHandler is never called, the Manager will only use the "tls-alpn-01"
-// challenge for domain verification.
+// challenge, and "dns-01" if DNSProvider is set, for domain verification.
 func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
 	m.challengeMu.Lock()
 	defer m.challengeMu.Unlock()
@@ -445,9 +649,18 @@ func (m *Manager) cert(ctx context.Context, ck certKey) (*tls.Certificate, error
 		defer s.RUnlock()
 		return s.tlscert()
 	}
+	var cacheMiss bool
+	defer func() {
+		// Run the Events callback once stateMu is released, so that it
+		// can't stall other handshakes or call back into m.
+		if cacheMiss {
+			m.event(EventCacheMiss, ck, time.Time{}, nil)
+		}
+	}()
 	defer m.stateMu.Unlock()
 	cert, err := m.cacheGet(ctx, ck)
 	if err != nil {
+		cacheMiss = err == ErrCacheMiss && m.Cache != nil
 		return nil, err
 	}
 	signer, ok := cert.PrivateKey.(crypto.Signer)
@@ -464,6 +677,7 @@ func (m *Manager) cert(ctx context.Context, ck certKey) (*tls.Certificate, error
 	}
 	m.state[ck] = s
 	m.startRenew(ck, s.key, s.leaf.NotAfter)
+	m.startStapling(ck)
 	return cert, nil
 }
 
@@ -585,7 +799,11 @@ func (m *Manager) createCert(ctx context.Context, ck certKey) (*tls.Certificate,
 	defer state.Unlock()
 	state.locked = false
 
-	der, leaf, err := m.authorizedCert(ctx, state.key, ck)
+	unlock, err := m.lockCert(ctx, ck)
+	if err == nil {
+		defer unlock()
+		err = m.obtainCert(ctx, state, ck)
+	}
 	if err != nil {
 		// Remove the failed state after some time,
 		// making the manager call createCert again on the following TLS hello.
@@ -607,12 +825,59 @@ func (m *Manager) createCert(ctx context.Context, ck certKey) (*tls.Certificate,
 		})
 		return nil, err
 	}
-	state.cert = der
-	state.leaf = leaf
 	m.startRenew(ck, state.key, state.leaf.NotAfter)
+	m.startStapling(ck)
 	return state.tlscert()
 }
 
+// obtainCert fills state with a new certificate for ck, and stores it in
+// the cache. If the cache is a Locker, whose lock the caller holds, it first
+// checks whether another Manager already stored one.
+func (m *Manager) obtainCert(ctx context.Context, state *certState, ck certKey) error {
+	if _, ok := m.Cache.(Locker); ok {
+		if cert, err := m.cacheGet(ctx, ck); err == nil {
+			if signer, ok := cert.PrivateKey.(crypto.Signer); ok {
+				state.key = signer
+				state.cert = cert.Certificate
+				state.leaf = cert.Leaf
+				return nil
+			}
+		}
+	}
+
+	der, leaf, _, err := m.authorizedCert(ctx, state.key, ck)
+	if err != nil {
+		return err
+	}
+	state.cert = der
+	state.leaf = leaf
+	tlscert, err := state.tlscert()
+	if err != nil {
+		return err
+	}
+	m.cachePut(ctx, ck, tlscert)
+	m.event(EventIssued, ck, leaf.NotAfter, nil)
+	return nil
+}
+
+// lockCert acquires the lock for ck if m.Cache is a Locker, and returns a
+// function releasing it.
+func (m *Manager) lockCert(ctx context.Context, ck certKey) (unlock func(), err error) {
+	l, ok := m.Cache.(Locker)
+	if !ok {
+		return func() {}, nil
+	}
+	if err := l.Lock(ctx, ck.String()); err != nil {
+		return nil, err
+	}
+	return func() {
+		// Release the lock even if ctx is done.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		l.Unlock(ctx, ck.String())
+	}, nil
+}
+
 // certState returns a new or existing certState.
 // If a new certState is returned, state.exist is false and the state is locked.
 // The returned error is non-nil only in the case where a new state could not be created.
@@ -652,13 +917,42 @@ func (m *Manager) certState(ck certKey) (*certState, error) {
 
 // authorizedCert starts the domain ownership verification process and requests a new cert upon success.
 // The key argument is the certificate private key.
-func (m *Manager) authorizedCert(ctx context.Context, key crypto.Signer, ck certKey) (der [][]byte, leaf *x509.Certificate, err error) {
-	csr, err := certRequest(key, ck.domain, m.ExtraExtensions)
+//
+// It tries the CA of m.Client, and then each of m.FallbackCAs in order
+// until one issues the certificate, after the checks of m.Preflight.
+// It returns the index of the issuing CA, as defined by caClient.
+func (m *Manager) authorizedCert(ctx context.Context, key crypto.Signer, ck certKey) (der [][]byte, leaf *x509.Certificate, ca int, err error) {
+	if err := m.preflight(ctx, ck); err != nil {
+		return nil, nil, 0, err
+	}
+	names := ck.dnsNames()
+	csr, err := certRequest(key, names[0], m.ExtraExtensions, names[1:]...)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
+	var errs []error
+	for i := 0; i <= len(m.FallbackCAs); i++ {
+		der, leaf, err = m.authorizedCertFrom(ctx, i, key, ck, csr)
+		if err == nil {
+			return der, leaf, i, nil
+		}
+		m.rateLimitEvent(ck, err)
+		errs = append(errs, err)
+		if ctx.Err() != nil || i == len(m.FallbackCAs) {
+			break
+		}
+		m.failoverEvent(ck, m.caDirectoryURL(i), err)
+	}
+	if len(errs) == 1 {
+		return nil, nil, 0, errs[0]
+	}
+	return nil, nil, 0, errors.Join(errs...)
+}
 
-	client, err := m.acmeClient(ctx)
+// authorizedCertFrom obtains a certificate for the CSR csr from the CA with
+// index i, as defined by caClient.
+func (m *Manager) authorizedCertFrom(ctx context.Context, i int, key crypto.Signer, ck certKey, csr []byte) (der [][]byte, leaf *x509.Certificate, err error) {
+	client, err := m.caClient(ctx, i)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -670,7 +964,7 @@ func (m *Manager) authorizedCert(ctx context.Context, key crypto.Signer, ck cert
 		return nil, nil, errPreRFC
 	}
 
-	o, err := m.verifyRFC(ctx, client, ck.domain)
+	o, err := m.verifyRFC(ctx, client, ck.dnsNames()...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -687,24 +981,41 @@ func (m *Manager) authorizedCert(ctx context.Context, key crypto.Signer, ck cert
 }
 
 // verifyRFC runs the identifier (domain) order-based authorization flow for RFC compliant CAs
-// using each applicable ACME challenge type.
-func (m *Manager) verifyRFC(ctx context.Context, client *acme.Client, domain string) (*acme.Order, error) {
+// using each applicable ACME challenge type. Several domains are only
+// supported for DNS names.
+func (m *Manager) verifyRFC(ctx context.Context, client *acme.Client, domains ...string) (*acme.Order, error) {
 	// Try each supported challenge type starting with a new order each time.
 	// The nextTyp index of the next challenge type to try is shared across
 	// all order authorizations: if we've tried a challenge type once and it didn't work,
 	// it will most likely not work on another order's authorization either.
 	challengeTypes := m.supportedChallengeTypes()
+	ids := acme.DomainIDs(domains...)
+	if domain := domains[0]; isIPIdentifier(domain) {
+		// The DNS challenge can't prove control of an IP address.
+		// See RFC 8738, Section 7.
+		ids = acme.IPIDs(domain)
+		for i, typ := range challengeTypes {
+			if typ == "dns-01" {
+				challengeTypes = append(challengeTypes[:i], challengeTypes[i+1:]...)
+				break
+			}
+		}
+	}
+	opts, err := m.orderOptions(ctx, client)
+	if err != nil {
+		return nil, err
+	}
 	nextTyp := 0 // challengeTypes index
 AuthorizeOrderLoop:
 	for {
-		o, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+		o, err := client.AuthorizeOrder(ctx, ids, opts...)
 		if err != nil {
 			return nil, err
 		}
 		// Remove all hanging authorizations to reduce rate limit quotas
 		// after we're done.
 		defer func(urls []string) {
-			go m.deactivatePendingAuthz(urls)
+			go m.deactivatePendingAuthz(client, urls)
 		}(o.AuthzURLs)
 
 		// Check if there's actually anything we need to do.
@@ -728,25 +1039,35 @@ AuthorizeOrderLoop:
 				// We are interested only in pending authorizations.
 				continue
 			}
-			// Pick the next preferred challenge.
+			domain := z.Identifier.Value
+			if z.Wildcard {
+				domain = "*." + domain
+			}
+			// Pick the preferred challenge which hasn't failed yet.
 			var chal *acme.Challenge
 			for chal == nil && nextTyp < len(challengeTypes) {
 				chal = pickChallenge(challengeTypes[nextTyp], z.Challenges)
-				nextTyp++
+				if chal == nil {
+					nextTyp++
+				}
 			}
 			if chal == nil {
 				return nil, fmt.Errorf("acme/autocert: unable to satisfy %q for domain %q: no viable challenge type found", z.URI, domain)
 			}
 			// Respond to the challenge and wait for validation result.
+			// On failure, the next order tries the next challenge type.
 			cleanup, err := m.fulfill(ctx, client, chal, domain)
 			if err != nil {
+				nextTyp++
 				continue AuthorizeOrderLoop
 			}
 			defer cleanup()
 			if _, err := client.Accept(ctx, chal); err != nil {
+				nextTyp++
 				continue AuthorizeOrderLoop
 			}
 			if _, err := client.WaitAuthorization(ctx, z.URI); err != nil {
+				nextTyp++
 				continue AuthorizeOrderLoop
 			}
 		}
@@ -777,23 +1098,23 @@ func (m *Manager) supportedChallengeTypes() []string {
 	if m.tryHTTP01 {
 		typ = append(typ, "http-01")
 	}
+	if m.DNSProvider != nil {
+		typ = append(typ, "dns-01")
+	}
 	return typ
 }
 
 // deactivatePendingAuthz relinquishes all authorizations identified by the elements
-// of the provided uri slice which are in "pending" state.
+// of the provided uri slice which are in "pending" state, using the client of
+// the CA which created them.
 // It ignores revocation errors.
 //
 // deactivatePendingAuthz takes no context argument and instead runs with its own
 // "detached" context because deactivations are done in a goroutine separate from
 // that of the main issuance or renewal flow.
-func (m *Manager) deactivatePendingAuthz(uri []string) {
+func (m *Manager) deactivatePendingAuthz(client *acme.Client, uri []string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
-	client, err := m.acmeClient(ctx)
-	if err != nil {
-		return
-	}
 	for _, u := range uri {
 		z, err := client.GetAuthorization(ctx, u)
 		if err == nil && z.Status == acme.StatusPending {
@@ -811,8 +1132,14 @@ func (m *Manager) fulfill(ctx context.Context, client *acme.Client, chal *acme.C
 		if err != nil {
 			return nil, err
 		}
-		m.putCertToken(ctx, domain, &cert)
-		return func() { go m.deleteCertToken(domain) }, nil
+		// The CA connects to an IP address with its reverse name as the
+		// server name. See RFC 8738, Section 6.
+		name := domain
+		if ip := net.ParseIP(domain); ip != nil {
+			name = acme.ReverseName(ip)
+		}
+		m.putCertToken(ctx, name, &cert)
+		return func() { go m.deleteCertToken(name) }, nil
 	case "http-01":
 		resp, err := client.HTTP01ChallengeResponse(chal.Token)
 		if err != nil {
@@ -821,6 +1148,19 @@ func (m *Manager) fulfill(ctx context.Context, client *acme.Client, chal *acme.C
 		p := client.HTTP01ChallengePath(chal.Token)
 		m.putHTTPToken(ctx, p, resp)
 		return func() { go m.deleteHTTPToken(p) }, nil
+	case "dns-01":
+		if m.DNSProvider == nil {
+			return nil, errors.New("acme/autocert: dns-01 challenge requires a DNSProvider")
+		}
+		val, err := client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return nil, err
+		}
+		name := dns01RecordName(domain)
+		if err := m.DNSProvider.SetTXT(ctx, name, val); err != nil {
+			return nil, err
+		}
+		return func() { go m.DNSProvider.RemoveTXT(context.Background(), name, val) }, nil
 	}
 	return nil, fmt.Errorf("acme/autocert: unknown challenge type %q", chal.Type)
 }
@@ -922,8 +1262,8 @@ func (m *Manager) startRenew(ck certKey, key crypto.Signer, exp time.Time) {
 	dr.start(exp)
 }
 
-// stopRenew stops all currently running cert renewal timers.
-// The timers are not restarted during the lifetime of the Manager.
+// stopRenew stops all currently running cert renewal and OCSP refresh
+// timers. The timers are not restarted during the lifetime of the Manager.
 func (m *Manager) stopRenew() {
 	m.renewalMu.Lock()
 	defer m.renewalMu.Unlock()
@@ -931,13 +1271,21 @@ func (m *Manager) stopRenew() {
 		delete(m.renewal, name)
 		dr.stop()
 	}
+	m.stopStapling()
 }
 
-func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
-	const keyName = "acme_account+key"
+// accountKey returns the account key of the CA with index i, as defined by
+// caClient.
+func (m *Manager) accountKey(ctx context.Context, i int) (crypto.Signer, error) {
+	keyName := "acme_account+key"
 
 	// Previous versions of autocert stored the value under a different key.
-	const legacyKeyName = "acme_account.key"
+	legacyKeyName := "acme_account.key"
+
+	if i > 0 {
+		keyName += "+" + cacheSafeURL(m.caDirectoryURL(i))
+		legacyKeyName = ""
+	}
 
 	genKey := func() (*ecdsa.PrivateKey, error) {
 		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
@@ -948,7 +1296,7 @@ func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
 	}
 
 	data, err := m.Cache.Get(ctx, keyName)
-	if err == ErrCacheMiss {
+	if err == ErrCacheMiss && legacyKeyName != "" {
 		data, err = m.Cache.Get(ctx, legacyKeyName)
 	}
 	if err == ErrCacheMiss {
@@ -976,20 +1324,33 @@ func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
 	return parsePrivateKey(priv.Bytes)
 }
 
+// acmeClient returns the client of the CA of m.Client.
 func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	return m.caClient(ctx, 0)
+}
+
+// caClient returns the client of the CA with index i, which is the CA of
+// m.Client for 0 and m.FallbackCAs[i-1] otherwise, and registers its
+// account the first time.
+func (m *Manager) caClient(ctx context.Context, i int) (*acme.Client, error) {
 	m.clientMu.Lock()
 	defer m.clientMu.Unlock()
-	if m.client != nil {
-		return m.client, nil
+	if c := m.clients[i]; c != nil {
+		return c, nil
 	}
 
 	client := m.Client
+	eab := m.ExternalAccountBinding
+	if i > 0 {
+		ca := m.FallbackCAs[i-1]
+		client, eab = ca.Client, ca.ExternalAccountBinding
+	}
 	if client == nil {
 		client = &acme.Client{DirectoryURL: DefaultACMEDirectory}
 	}
 	if client.Key == nil {
 		var err error
-		client.Key, err = m.accountKey(ctx)
+		client.Key, err = m.accountKey(ctx, i)
 		if err != nil {
 			return nil, err
 		}
@@ -1001,13 +1362,45 @@ func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
 	if m.Email != "" {
 		contact = []string{"mailto:" + m.Email}
 	}
-	a := &acme.Account{Contact: contact, ExternalAccountBinding: m.ExternalAccountBinding}
+	if eab == nil && client.DirectoryURL == acme.ZeroSSLURL && m.Email != "" {
+		var err error
+		eab, err = acme.ZeroSSLExternalAccountBinding(ctx, client.HTTPClient, m.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a := &acme.Account{Contact: contact, ExternalAccountBinding: eab}
 	_, err := client.Register(ctx, a, m.Prompt)
-	if err == nil || isAccountAlreadyExist(err) {
-		m.client = client
-		err = nil
+	if err != nil && !isAccountAlreadyExist(err) {
+		return nil, err
+	}
+	if m.clients == nil {
+		m.clients = make(map[int]*acme.Client)
+	}
+	m.clients[i] = client
+	return client, nil
+}
+
+// caDirectoryURL returns the directory URL of the CA with index i, as
+// defined by caClient.
+func (m *Manager) caDirectoryURL(i int) string {
+	client := m.Client
+	if i > 0 {
+		client = m.FallbackCAs[i-1].Client
+	}
+	if client == nil || client.DirectoryURL == "" {
+		return DefaultACMEDirectory
 	}
-	return m.client, err
+	return client.DirectoryURL
+}
+
+// cacheSafeURL returns the host and path of u, with the characters which
+// aren't safe in cache keys replaced.
+func cacheSafeURL(u string) string {
+	u = strings.TrimPrefix(u, "https://")
+	u = strings.TrimPrefix(u, "http://")
+	u = strings.TrimSuffix(u, "/")
+	return strings.NewReplacer("/", "_", ":", "_").Replace(u)
 }
 
 // isAccountAlreadyExist reports whether the err, as returned from acme.Client.Register,
@@ -1027,6 +1420,21 @@ func (m *Manager) hostPolicy() HostPolicy {
 	return defaultHostPolicy
 }
 
+// orderOptions returns the options of new orders with the CA of client.
+func (m *Manager) orderOptions(ctx context.Context, client *acme.Client) ([]acme.OrderOption, error) {
+	if m.Profile == "" {
+		return nil, nil
+	}
+	dir, err := client.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dir.Profiles[m.Profile]; !ok {
+		return nil, nil
+	}
+	return []acme.OrderOption{acme.WithOrderProfile(m.Profile)}, nil
+}
+
 func (m *Manager) renewBefore() time.Duration {
 	if m.RenewBefore > renewJitter {
 		return m.RenewBefore
@@ -1048,6 +1456,11 @@ type certState struct {
 	key    crypto.Signer     // private key for cert
 	cert   [][]byte          // DER encoding
 	leaf   *x509.Certificate // parsed cert[0]; always non-nil if cert != nil
+	ocsp   []byte            // stapled OCSP response for cert, if any
+
+	// ocspExpiry is the NextUpdate time of ocsp, after which it is no
+	// longer stapled, or zero if it has none.
+	ocspExpiry time.Time
 }
 
 // tlscert creates a tls.Certificate from s.key and s.cert.
@@ -1059,20 +1472,32 @@ func (s *certState) tlscert() (*tls.Certificate, error) {
 	if len(s.cert) == 0 {
 		return nil, errors.New("acme/autocert: missing certificate")
 	}
+	staple := s.ocsp
+	if !s.ocspExpiry.IsZero() && !time.Now().Before(s.ocspExpiry) {
+		// The response expired without being refreshed.
+		staple = nil
+	}
 	return &tls.Certificate{
 		PrivateKey:  s.key,
 		Certificate: s.cert,
 		Leaf:        s.leaf,
+		OCSPStaple:  staple,
 	}, nil
 }
 
-// certRequest generates a CSR for the given common name.
-func certRequest(key crypto.Signer, name string, ext []pkix.Extension) ([]byte, error) {
+// certRequest generates a CSR for the given common name, or IP address,
+// and the additional DNS names, if any.
+func certRequest(key crypto.Signer, name string, ext []pkix.Extension, names ...string) ([]byte, error) {
 	req := &x509.CertificateRequest{
 		Subject:         pkix.Name{CommonName: name},
-		DNSNames:        []string{name},
+		DNSNames:        append([]string{name}, names...),
 		ExtraExtensions: ext,
 	}
+	if ip := net.ParseIP(name); ip != nil {
+		req.Subject.CommonName = ""
+		req.DNSNames = nil
+		req.IPAddresses = []net.IP{ip}
+	}
 	return x509.CreateCertificateRequest(rand.Reader, req, key)
 }
 
@@ -1130,8 +1555,10 @@ func validCert(ck certKey, der [][]byte, key crypto.Signer, now time.Time) (leaf
 	if now.After(leaf.NotAfter) {
 		return nil, errors.New("acme/autocert: expired certificate")
 	}
-	if err := leaf.VerifyHostname(ck.domain); err != nil {
-		return nil, err
+	for _, name := range ck.dnsNames() {
+		if err := leaf.VerifyHostname(name); err != nil {
+			return nil, err
+		}
 	}
 	// renew certificates revoked by Let's Encrypt in January 2022
 	if isRevokedLetsEncrypt(leaf) {
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -96,6 +97,47 @@ func newMemCache(t *testing.T) *memCache {
 	}
 }
 
+// lockingMemCache is a memCache implementing Locker.
+type lockingMemCache struct {
+	*memCache
+	locks map[string]chan struct{} // guarded by memCache.mu
+}
+
+func newLockingMemCache(t *testing.T) *lockingMemCache {
+	return &lockingMemCache{
+		memCache: newMemCache(t),
+		locks:    make(map[string]chan struct{}),
+	}
+}
+
+func (m *lockingMemCache) Lock(ctx context.Context, key string) error {
+	for {
+		m.mu.Lock()
+		held, ok := m.locks[key]
+		if !ok {
+			m.locks[key] = make(chan struct{})
+			m.mu.Unlock()
+			return nil
+		}
+		m.mu.Unlock()
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *lockingMemCache) Unlock(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if held, ok := m.locks[key]; ok {
+		close(held)
+		delete(m.locks, key)
+	}
+	return nil
+}
+
 func (m *memCache) numCerts() int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -592,11 +634,11 @@ func TestHTTPHandlerDefaultFallback(t *testing.T) {
 func TestAccountKeyCache(t *testing.T) {
 	m := Manager{Cache: newMemCache(t)}
 	ctx := context.Background()
-	k1, err := m.accountKey(ctx)
+	k1, err := m.accountKey(ctx, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
-	k2, err := m.accountKey(ctx)
+	k2, err := m.accountKey(ctx, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -941,6 +983,141 @@ func TestEndToEndALPN(t *testing.T) {
 	}
 }
 
+func TestGetCertificateDNS01Wildcard(t *testing.T) {
+	ca := acmetest.NewCAServer(t).ChallengeTypes("tls-alpn-01", "dns-01").Start()
+	man := testManager(t)
+	man.Client = &acme.Client{DirectoryURL: ca.URL()}
+	man.DNSProvider = ca
+	man.WildcardDomains = []string{"example.org"}
+
+	tlscert, err := man.GetCertificate(clientHelloInfo("www.example.org", algECDSA))
+	if err != nil {
+		t.Fatalf("man.GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(tlscert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "*.example.org" {
+		t.Errorf("got SANs %q, want [*.example.org]", leaf.DNSNames)
+	}
+
+	// Another subdomain is served the same certificate.
+	other, err := man.GetCertificate(clientHelloInfo("api.example.org", algECDSA))
+	if err != nil {
+		t.Fatalf("man.GetCertificate: %v", err)
+	}
+	if !bytes.Equal(other.Certificate[0], tlscert.Certificate[0]) {
+		t.Error("api.example.org was issued a separate certificate")
+	}
+}
+
+// localAddrConn is a net.Conn that only implements LocalAddr.
+type localAddrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c localAddrConn) LocalAddr() net.Addr { return c.addr }
+
+func TestGetCertificateIP(t *testing.T) {
+	const addr = "2001:db8::1"
+	ca := acmetest.NewCAServer(t).ChallengeTypes("tls-alpn-01", "dns-01")
+	man := testManager(t)
+	man.DNSProvider = ca
+	man.HostPolicy = HostWhitelist("2001:0db8:0::1")
+	ca.ResolveGetCertificate(addr, man.GetCertificate)
+
+	// IP certificates must be enabled explicitly.
+	hello := clientHelloInfo("", algECDSA)
+	hello.Conn = localAddrConn{addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 443}}
+	if _, err := man.GetCertificate(hello); err == nil {
+		t.Error("man.GetCertificate succeeded for an address without IPCertificates")
+	}
+	if _, err := man.GetCertificate(clientHelloInfo(addr, algECDSA)); err == nil {
+		t.Error("man.GetCertificate succeeded for an address server name without IPCertificates")
+	}
+	man.IPCertificates = true
+	ca.Start()
+	man.Client = &acme.Client{DirectoryURL: ca.URL()}
+
+	tlscert, err := man.GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("man.GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(tlscert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 0 || len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal(net.ParseIP(addr)) {
+		t.Errorf("got SANs %q and %v, want only %s", leaf.DNSNames, leaf.IPAddresses, addr)
+	}
+
+	// A client sending the address as server name gets the same certificate.
+	other, err := man.GetCertificate(clientHelloInfo("2001:db8:0::1", algECDSA))
+	if err != nil {
+		t.Fatalf("man.GetCertificate: %v", err)
+	}
+	if !bytes.Equal(other.Certificate[0], tlscert.Certificate[0]) {
+		t.Error("the address was issued a separate certificate")
+	}
+
+	// Addresses not allowed by the policy are rejected.
+	hello = clientHelloInfo("", algECDSA)
+	hello.Conn = localAddrConn{addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}}
+	if _, err := man.GetCertificate(hello); err == nil {
+		t.Error("man.GetCertificate succeeded for an address not in HostWhitelist")
+	}
+	// Without a policy, connections without a server name are rejected.
+	man2 := testManager(t)
+	man2.IPCertificates = true
+	hello = clientHelloInfo("", algECDSA)
+	hello.Conn = localAddrConn{addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 443}}
+	if _, err := man2.GetCertificate(hello); err == nil {
+		t.Error("man.GetCertificate succeeded without a server name nor HostPolicy")
+	}
+}
+
+func TestGetCertificateLockingCache(t *testing.T) {
+	const domain = "example.org"
+	cache := newLockingMemCache(t)
+	man1 := testManager(t)
+	man1.Cache = cache
+	man2 := testManager(t)
+	man2.Cache = cache
+
+	ca := acmetest.NewCAServer(t)
+	// Either Manager can answer the challenge, through the cache.
+	ca.ResolveGetCertificate(domain, man1.GetCertificate)
+	ca.Start()
+	man1.Client = &acme.Client{DirectoryURL: ca.URL()}
+	man2.Client = &acme.Client{DirectoryURL: ca.URL()}
+
+	var wg sync.WaitGroup
+	certs := make([]*tls.Certificate, 2)
+	for i, man := range []*Manager{man1, man2} {
+		wg.Add(1)
+		go func(i int, man *Manager) {
+			defer wg.Done()
+			cert, err := man.GetCertificate(clientHelloInfo(domain, algECDSA))
+			if err != nil {
+				t.Errorf("man%d.GetCertificate: %v", i+1, err)
+			}
+			certs[i] = cert
+		}(i, man)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+	if !bytes.Equal(certs[0].Certificate[0], certs[1].Certificate[0]) {
+		t.Error("Managers sharing a Locker cache obtained different certificates")
+	}
+	if len(cache.locks) != 0 {
+		t.Errorf("%d locks still held", len(cache.locks))
+	}
+}
+
 func TestEndToEndHTTP(t *testing.T) {
 	const domain = "example.org"
 
@@ -994,3 +1171,30 @@ func TestEndToEndHTTP(t *testing.T) {
 		t.Errorf("user server response: %q; want 'OK'", v)
 	}
 }
+
+func TestManagerProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles map[string]string
+		want     string
+	}{
+		{"offered", map[string]string{"shortlived": "Short-lived certificates"}, "shortlived"},
+		{"notOffered", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca := acmetest.NewCAServer(t).Profiles(tt.profiles).Start()
+			man := testManager(t)
+			man.Client = &acme.Client{DirectoryURL: ca.URL()}
+			man.Profile = "shortlived"
+			ca.ResolveGetCertificate(exampleDomain, man.GetCertificate)
+
+			if _, err := man.GetCertificate(clientHelloInfo(exampleDomain, algECDSA)); err != nil {
+				t.Fatal(err)
+			}
+			if got := ca.OrderProfiles(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got order profiles %q, want [%q]", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,9 +6,13 @@ package autocert
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
 // ErrCacheMiss is returned when a certificate is not found in cache.
@@ -34,6 +38,36 @@ type Cache interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// Locker is an optional interface implemented by a Cache that is shared by
+// several Managers, for example on a fleet of servers, to coordinate
+// certificate issuance. If the Cache implements Locker, a Manager holds the
+// lock for a certificate's cache key while obtaining or renewing it, and
+// looks the certificate up in the Cache again once it holds the lock, so
+// that a single Manager requests it from the CA.
+//
+// The lock must be exclusive among all the Managers sharing the Cache. It is
+// held for the duration of the ACME authorization flow, which may take
+// minutes, so implementations that expire locks to recover from crashed
+// processes should refresh them while they are held, as SharedDirCache
+// does, or not expire them in less than 15 minutes.
+//
+// With a key-value store such as Redis, Lock can atomically set the key if
+// it does not exist, with an expiration and a random value (SET key value
+// NX PX timeout), retrying until it succeeds, and Unlock can delete the key
+// if it still holds that value. With an object store such as S3 or Google
+// Cloud Storage, Lock can create a lock object with a conditional write that
+// fails if it already exists, and treat objects older than the timeout as
+// abandoned.
+type Locker interface {
+	// Lock blocks until it acquires the lock for the specified key, or ctx
+	// is done, in which case it returns ctx.Err(). The key is the same as
+	// the one used with Get and Put.
+	Lock(ctx context.Context, key string) error
+
+	// Unlock releases the lock for the specified key, acquired by Lock.
+	Unlock(ctx context.Context, key string) error
+}
+
 // DirCache implements Cache using a directory on the local filesystem.
 // If the directory does not exist, it will be created with 0700 permissions.
 type DirCache string
@@ -115,6 +149,224 @@ func (d DirCache) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
+// SharedDirCache is a DirCache that also implements Locker, for a directory
+// shared by several Managers, possibly in different processes or on
+// different hosts using a network filesystem that supports exclusive file
+// creation. Managers using it obtain each certificate only once.
+type SharedDirCache string
+
+// Get reads a certificate data from the specified file name.
+func (d SharedDirCache) Get(ctx context.Context, name string) ([]byte, error) {
+	return DirCache(d).Get(ctx, name)
+}
+
+// Put writes the certificate data to the specified file name.
+// The file will be created with 0600 permissions.
+func (d SharedDirCache) Put(ctx context.Context, name string, data []byte) error {
+	return DirCache(d).Put(ctx, name, data)
+}
+
+// Delete removes the specified file name.
+func (d SharedDirCache) Delete(ctx context.Context, name string) error {
+	return DirCache(d).Delete(ctx, name)
+}
+
+// dirCacheLockTimeout is the age after which SharedDirCache considers a lock
+// file to have been left behind by a crashed process. Lock files are
+// refreshed every dirCacheLockRefresh while held, so the timeout does not
+// bound how long a lock can be held. It is shorter than the deadline of
+// GetCertificate, so that a waiting handshake can still take over the lock
+// of a crashed process.
+var dirCacheLockTimeout = 2 * time.Minute
+
+// dirCacheLockRefresh is how often the lock files of held locks are
+// touched.
+var dirCacheLockRefresh = 30 * time.Second
+
+// dirCacheLockPoll is how often SharedDirCache.Lock checks whether a lock
+// file was removed.
+var dirCacheLockPoll = time.Second
+
+// dirCacheLocks holds the locks held by this process, keyed by lock file.
+var dirCacheLocks struct {
+	sync.Mutex
+	m map[string]*dirCacheLock
+}
+
+type dirCacheLock struct {
+	token string
+	stop  chan struct{}
+}
+
+// Lock implements Locker by creating a lock file next to the specified file
+// name, holding a random token that identifies the owner. The lock file is
+// refreshed while the lock is held, and a lock file that was not refreshed
+// for two minutes is assumed to have been left behind by a crashed process
+// and is taken over.
+func (d SharedDirCache) Lock(ctx context.Context, name string) error {
+	if err := os.MkdirAll(string(d), 0700); err != nil {
+		return err
+	}
+	name = d.lockFile(name)
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b[:])
+	for {
+		ok, err := createLockFile(name, token)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if old, stale := readLockFile(name); stale {
+				ok, err = takeOverLockFile(name, old, token)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if ok {
+			l := &dirCacheLock{token: token, stop: make(chan struct{})}
+			dirCacheLocks.Lock()
+			if dirCacheLocks.m == nil {
+				dirCacheLocks.m = make(map[string]*dirCacheLock)
+			}
+			dirCacheLocks.m[name] = l
+			dirCacheLocks.Unlock()
+			go refreshLockFile(name, l.stop)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(dirCacheLockPoll):
+		}
+	}
+}
+
+// Unlock implements Locker by removing the lock file created by Lock, if
+// it still holds the token of this process.
+func (d SharedDirCache) Unlock(ctx context.Context, name string) error {
+	name = d.lockFile(name)
+	dirCacheLocks.Lock()
+	l, ok := dirCacheLocks.m[name]
+	delete(dirCacheLocks.m, name)
+	dirCacheLocks.Unlock()
+	if !ok {
+		return nil
+	}
+	close(l.stop)
+	if token, _ := readLockFile(name); token != l.token {
+		return nil
+	}
+	err := os.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// lockFile returns the path of the lock file for name. The suffix cannot
+// appear in the names of the files holding certificates.
+func (d SharedDirCache) lockFile(name string) string {
+	return filepath.Join(string(d), filepath.Clean("/"+name)) + "+lock"
+}
+
+// createLockFile creates the lock file name holding token, and reports
+// whether it did not exist.
+func createLockFile(name, token string) (bool, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = f.WriteString(token)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		return false, err
+	}
+	return true, nil
+}
+
+// readLockFile returns the token held by the lock file name, and reports
+// whether it was not refreshed for dirCacheLockTimeout.
+func readLockFile(name string) (token string, stale bool) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return "", false
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", false
+	}
+	return string(b), time.Since(fi.ModTime()) > dirCacheLockTimeout
+}
+
+// takeOverLockFile replaces the stale lock file name, holding token, with
+// one holding newToken, and reports whether it did. Waiters racing to take
+// over the same lock file first create a guard file named after its token,
+// so that exactly one of them replaces it; the others see a new token once
+// the guard is gone. A guard left behind by a crash goes stale and is taken
+// over in the same way.
+func takeOverLockFile(name, token, newToken string) (bool, error) {
+	guard := name + "." + token
+	ok, err := createLockFile(guard, newToken)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		old, stale := readLockFile(guard)
+		if !stale {
+			return false, nil
+		}
+		if ok, err = takeOverLockFile(guard, old, newToken); !ok || err != nil {
+			return false, err
+		}
+	}
+	defer os.Remove(guard)
+
+	if t, _ := readLockFile(name); t != token {
+		return false, nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name))
+	if err != nil {
+		return false, err
+	}
+	_, err = f.WriteString(newToken)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+// refreshLockFile touches the lock file name until stop is closed.
+func refreshLockFile(name string, stop chan struct{}) {
+	t := time.NewTicker(dirCacheLockRefresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			now := time.Now()
+			os.Chtimes(name, now, now)
+		}
+	}
+}
+
 // writeTempFile writes b to a temporary file, closes the file and returns its path.
 func (d DirCache) writeTempFile(prefix string, b []byte) (name string, reterr error) {
 	// TempFile uses 0600 permissions
@@ -10,10 +10,15 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
-// make sure DirCache satisfies Cache interface
-var _ Cache = DirCache("/")
+// make sure DirCache satisfies Cache, and SharedDirCache Cache and Locker
+var (
+	_ Cache  = DirCache("/")
+	_ Cache  = SharedDirCache("/")
+	_ Locker = SharedDirCache("/")
+)
 
 func TestDirCache(t *testing.T) {
 	dir, err := os.MkdirTemp("", "autocert")
@@ -64,3 +69,113 @@ func TestDirCache(t *testing.T) {
 		t.Errorf("get: %v; want ErrCacheMiss", err)
 	}
 }
+
+func TestSharedDirCacheLock(t *testing.T) {
+	defer func(d time.Duration) { dirCacheLockPoll = d }(dirCacheLockPoll)
+	dirCacheLockPoll = 10 * time.Millisecond
+
+	if _, ok := Cache(DirCache("/")).(Locker); ok {
+		t.Error("DirCache implements Locker")
+	}
+
+	dir := filepath.Join(t.TempDir(), "certs") // a nonexistent dir
+	cache := SharedDirCache(dir)
+	ctx := context.Background()
+
+	if err := cache.Lock(ctx, "example.org"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	// A different key can be locked.
+	if err := cache.Lock(ctx, "example.org+rsa"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	// The held lock times out.
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := cache.Lock(tctx, "example.org"); err != context.DeadlineExceeded {
+		t.Errorf("lock of held key: %v; want context.DeadlineExceeded", err)
+	}
+
+	// The lock is acquired once released.
+	done := make(chan error)
+	go func() { done <- cache.Lock(ctx, "example.org") }()
+	time.Sleep(20 * time.Millisecond)
+	if err := cache.Unlock(ctx, "example.org"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("lock: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock was not acquired after unlock")
+	}
+
+	// A stale lock is broken.
+	old := time.Now().Add(-2 * dirCacheLockTimeout)
+	if err := os.Chtimes(filepath.Join(dir, "example.org+lock"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	tctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := cache.Lock(tctx, "example.org"); err != nil {
+		t.Errorf("lock of stale key: %v", err)
+	}
+
+	for _, name := range []string{"example.org", "example.org+rsa", "nonexistent"} {
+		if err := cache.Unlock(ctx, name); err != nil {
+			t.Errorf("unlock(%q): %v", name, err)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*+lock*")); len(files) != 0 {
+		t.Errorf("lock files remain: %v", files)
+	}
+}
+
+func TestSharedDirCacheStaleLockRace(t *testing.T) {
+	defer func(d time.Duration) { dirCacheLockPoll = d }(dirCacheLockPoll)
+	dirCacheLockPoll = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	cache := SharedDirCache(dir)
+	ctx := context.Background()
+	name := filepath.Join(dir, "example.org+lock")
+	old := time.Now().Add(-2 * dirCacheLockTimeout)
+	for _, f := range []string{name, name + ".crashed"} {
+		// The lock file of a crashed process, and the guard of another
+		// one that crashed while taking it over.
+		if err := os.WriteFile(f, []byte("crashed"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only one of the waiters takes over the stale lock.
+	const waiters = 10
+	acquired := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			tctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+			defer cancel()
+			acquired <- cache.Lock(tctx, "example.org")
+		}()
+	}
+	n := 0
+	for i := 0; i < waiters; i++ {
+		if err := <-acquired; err == nil {
+			n++
+		} else if err != context.DeadlineExceeded {
+			t.Errorf("lock: %v", err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d waiters acquired the stale lock, want 1", n)
+	}
+	if err := cache.Unlock(ctx, "example.org"); err != nil {
+		t.Errorf("unlock: %v", err)
+	}
+}
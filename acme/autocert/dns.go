@@ -0,0 +1,61 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// DNSProvider provisions the DNS records used to answer "dns-01" challenges.
+// Implementations typically wrap the API of a DNS hosting service such as
+// Route 53 or Cloudflare.
+//
+// The name argument is the fully qualified record name, including the
+// trailing dot, for example "_acme-challenge.example.com.".
+// The value argument is the record content as returned by
+// acme.Client.DNS01ChallengeRecord.
+type DNSProvider interface {
+	// SetTXT adds a TXT record with the given value. Other TXT records with
+	// the same name must be preserved, because a certificate for both
+	// "example.com" and "*.example.com" is validated through the same name.
+	//
+	// SetTXT should not return until the record is served by the
+	// authoritative name servers of the zone, since the CA is asked to
+	// validate the challenge immediately afterwards.
+	SetTXT(ctx context.Context, name, value string) error
+
+	// RemoveTXT removes a TXT record previously added with SetTXT.
+	RemoveTXT(ctx context.Context, name, value string) error
+}
+
+// dns01RecordName returns the name of the TXT record used to validate
+// the domain, which may be a wildcard name. See RFC 8555, Section 8.4.
+func dns01RecordName(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(domain, "*.") + "."
+}
+
+// wildcardName returns the wildcard name under which the certificate for
+// host should be requested, and reports whether host is a direct
+// subdomain of one of m.WildcardDomains.
+func (m *Manager) wildcardName(host string) (string, bool) {
+	if m.DNSProvider == nil {
+		return "", false
+	}
+	i := strings.IndexByte(host, '.')
+	if i < 0 {
+		return "", false
+	}
+	parent := host[i+1:]
+	for _, d := range m.WildcardDomains {
+		d, err := idna.Lookup.ToASCII(strings.TrimSuffix(d, "."))
+		if err == nil && d == parent {
+			return "*." + parent, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/acme"
+)
+
+// EventType is the type of an Event.
+type EventType int
+
+const (
+	// EventIssued reports that a new certificate was obtained for a domain
+	// which had no valid certificate in the cache.
+	EventIssued EventType = iota + 1
+
+	// EventRenewed reports that a certificate was renewed in the background
+	// before its expiration.
+	EventRenewed
+
+	// EventRenewalFailed reports that an attempt to renew a certificate
+	// failed. The renewal is retried within the hour, and the previous
+	// certificate is served meanwhile.
+	EventRenewalFailed
+
+	// EventCacheMiss reports that the cache holds no valid certificate for
+	// a domain which has none in memory, so that a new certificate has to
+	// be requested if the host policy allows it.
+	EventCacheMiss
+
+	// EventRateLimited reports that the CA refused a request because a
+	// rate limit was exceeded.
+	EventRateLimited
+
+	// EventFailover reports that obtaining a certificate from a CA failed,
+	// and that the next CA of Manager.FallbackCAs is tried.
+	EventFailover
+)
+
+var eventTypeNames = map[EventType]string{
+	EventIssued:        "issued",
+	EventRenewed:       "renewed",
+	EventRenewalFailed: "renewal-failed",
+	EventCacheMiss:     "cache-miss",
+	EventRateLimited:   "rate-limited",
+	EventFailover:      "failover",
+}
+
+func (t EventType) String() string {
+	if s, ok := eventTypeNames[t]; ok {
+		return s
+	}
+	return "EventType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Event describes a change in the certificates of a Manager, and is passed
+// to Manager.Events.
+type Event struct {
+	Type EventType
+
+	// Domain is the name the certificate is for. It has a "*." prefix for
+	// wildcard certificates, and is the group name for the certificates of
+	// Manager.SANGroups.
+	Domain string
+
+	// RSA reports whether the certificate is the RSA certificate served to
+	// clients which don't support ECDSA.
+	RSA bool
+
+	// NotAfter is the expiration time of the new certificate for EventIssued
+	// and EventRenewed, and of the certificate still being served for
+	// EventRenewalFailed. It is zero otherwise.
+	NotAfter time.Time
+
+	// Err is the error which caused an EventRenewalFailed, EventRateLimited
+	// or EventFailover event.
+	Err error
+
+	// CA is the directory URL of the CA which failed, for EventFailover.
+	CA string
+
+	// RetryAfter is the time to wait before retrying, as asked by the CA in
+	// an EventRateLimited event, or zero if the CA didn't say.
+	RetryAfter time.Duration
+}
+
+// event sends an event of type typ about the cert of ck to m.Events, if set.
+func (m *Manager) event(typ EventType, ck certKey, notAfter time.Time, err error) {
+	if m.Events == nil {
+		return
+	}
+	ev := Event{
+		Type:     typ,
+		Domain:   ck.domain,
+		RSA:      ck.isRSA,
+		NotAfter: notAfter,
+		Err:      err,
+	}
+	if typ == EventRateLimited {
+		ev.RetryAfter, _ = acme.RateLimit(err)
+	}
+	m.Events(ev)
+}
+
+// failoverEvent sends an EventFailover event about the failure of the CA
+// with the given directory URL.
+func (m *Manager) failoverEvent(ck certKey, ca string, err error) {
+	if m.Events == nil {
+		return
+	}
+	m.Events(Event{
+		Type:   EventFailover,
+		Domain: ck.domain,
+		RSA:    ck.isRSA,
+		Err:    err,
+		CA:     ca,
+	})
+}
+
+// rateLimitEvent sends an EventRateLimited event if err is a rate limit error
+// of the CA.
+func (m *Manager) rateLimitEvent(ck certKey, err error) {
+	if _, ok := acme.RateLimit(err); ok {
+		m.event(EventRateLimited, ck, time.Time{}, err)
+	}
+}
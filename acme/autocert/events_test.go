@@ -0,0 +1,203 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/acme"
+	"github.com/gitpod-io/golang-crypto/acme/autocert/internal/acmetest"
+)
+
+// eventRecorder collects the events of a Manager.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) record(ev Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+}
+
+// take returns the events recorded so far and forgets them.
+func (r *eventRecorder) take() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func checkEvents(t *testing.T, got []Event, want ...EventType) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %v, want %v", len(got), got, want)
+	}
+	for i, ev := range got {
+		if ev.Type != want[i] {
+			t.Errorf("event %d: got type %v, want %v", i, ev.Type, want[i])
+		}
+		if ev.Domain != exampleDomain || ev.RSA {
+			t.Errorf("event %d: got domain %q and RSA %v, want %q and false", i, ev.Domain, ev.RSA, exampleDomain)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var rec eventRecorder
+	ca := acmetest.NewCAServer(t).Start()
+	man := testManager(t)
+	man.Events = rec.record
+	man.Client = &acme.Client{
+		DirectoryURL: ca.URL(),
+		RetryBackoff: func(int, *http.Request, *http.Response) time.Duration { return 0 },
+	}
+	ca.ResolveGetCertificate(exampleDomain, man.GetCertificate)
+
+	cert, err := man.GetCertificate(clientHelloInfo(exampleDomain, algECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := rec.take()
+	checkEvents(t, events, EventCacheMiss, EventIssued)
+	if !events[1].NotAfter.Equal(cert.Leaf.NotAfter) {
+		t.Errorf("issued: got NotAfter %v, want %v", events[1].NotAfter, cert.Leaf.NotAfter)
+	}
+
+	// Make the new cert due for renewal.
+	man.RenewBefore = 365 * 24 * time.Hour
+	dr := &domainRenewal{m: man, ck: exampleCertKey, key: cert.PrivateKey.(crypto.Signer)}
+	if _, err := dr.do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events = rec.take()
+	checkEvents(t, events, EventRenewed)
+	renewed := dr.currentLeaf()
+	if renewed == nil || !events[0].NotAfter.Equal(renewed.NotAfter) {
+		t.Errorf("renewed: got NotAfter %v, want that of %v", events[0].NotAfter, renewed)
+	}
+
+	ca.RateLimitOrders(time.Hour)
+	dr.renew()
+	dr.stop()
+	events = rec.take()
+	checkEvents(t, events, EventRateLimited, EventRenewalFailed)
+	if events[0].RetryAfter != time.Hour {
+		t.Errorf("rate limited: got RetryAfter %v, want %v", events[0].RetryAfter, time.Hour)
+	}
+	for _, ev := range events {
+		if _, ok := acme.RateLimit(ev.Err); !ok {
+			t.Errorf("%v: got error %v, want a rate limit error", ev.Type, ev.Err)
+		}
+	}
+	if !events[1].NotAfter.Equal(renewed.NotAfter) {
+		t.Errorf("renewal failed: got NotAfter %v, want %v", events[1].NotAfter, renewed.NotAfter)
+	}
+}
+
+func TestCacheMissEventUnlocked(t *testing.T) {
+	man := testManager(t)
+	man.Cache = newMemCache(t)
+	man.Events = func(ev Event) {
+		// A callback calling back into the Manager must not deadlock.
+		man.stateMu.Lock()
+		man.stateMu.Unlock()
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := man.cert(context.Background(), exampleCertKey)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != ErrCacheMiss {
+			t.Errorf("cert: got %v, want ErrCacheMiss", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Events callback ran while stateMu was held")
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	for typ, want := range map[EventType]string{
+		EventIssued:       "issued",
+		EventRateLimited:  "rate-limited",
+		EventFailover:     "failover",
+		EventType(0):      "EventType(0)",
+		EventFailover + 1: "EventType(7)",
+	} {
+		if got := typ.String(); got != want {
+			t.Errorf("%d: got %q, want %q", int(typ), got, want)
+		}
+	}
+}
+
+func TestFallbackCAs(t *testing.T) {
+	var rec eventRecorder
+	primary := acmetest.NewCAServer(t).Start()
+	fallback := acmetest.NewCAServer(t).Start()
+	man := testManager(t)
+	man.Events = rec.record
+	man.Client = &acme.Client{
+		DirectoryURL: primary.URL(),
+		RetryBackoff: func(int, *http.Request, *http.Response) time.Duration { return 0 },
+	}
+	man.FallbackCAs = []CA{{Client: &acme.Client{DirectoryURL: fallback.URL()}}}
+	primary.ResolveGetCertificate(exampleDomain, man.GetCertificate)
+	fallback.ResolveGetCertificate(exampleDomain, man.GetCertificate)
+
+	primary.RateLimitOrders(time.Hour)
+	cert, err := man.GetCertificate(clientHelloInfo(exampleDomain, algECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := rec.take()
+	checkEvents(t, events, EventCacheMiss, EventRateLimited, EventFailover, EventIssued)
+	if events[2].CA != primary.URL() {
+		t.Errorf("failover: got CA %q, want %q", events[2].CA, primary.URL())
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: fallback.Roots()}); err != nil {
+		t.Errorf("certificate not issued by the fallback CA: %v", err)
+	}
+
+	// Each CA has its own account key.
+	pk := man.clients[0].Key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if pk.Equal(man.clients[1].Key.Public()) {
+		t.Error("the CAs share an account key")
+	}
+	if _, err := man.Cache.Get(context.Background(), "acme_account+key+"+cacheSafeURL(fallback.URL())); err != nil {
+		t.Errorf("account key of the fallback CA not cached: %v", err)
+	}
+}
+
+func TestFallbackCAsAllFail(t *testing.T) {
+	var rec eventRecorder
+	primary := acmetest.NewCAServer(t).Start()
+	fallback := acmetest.NewCAServer(t).Start()
+	man := testManager(t)
+	man.Events = rec.record
+	noRetry := func(int, *http.Request, *http.Response) time.Duration { return 0 }
+	man.Client = &acme.Client{DirectoryURL: primary.URL(), RetryBackoff: noRetry}
+	man.FallbackCAs = []CA{{Client: &acme.Client{DirectoryURL: fallback.URL(), RetryBackoff: noRetry}}}
+	primary.RateLimitOrders(time.Hour)
+	fallback.RateLimitOrders(time.Minute)
+
+	_, err := man.GetCertificate(clientHelloInfo(exampleDomain, algECDSA))
+	if err == nil {
+		t.Fatal("GetCertificate succeeded with all the CAs rate limited")
+	}
+	if d, ok := acme.RateLimit(err); !ok || d != time.Hour {
+		t.Errorf("got error %v, want the rate limit error of the primary CA", err)
+	}
+	checkEvents(t, rec.take(), EventCacheMiss, EventRateLimited, EventFailover, EventRateLimited)
+}
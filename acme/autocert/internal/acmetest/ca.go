@@ -35,6 +35,7 @@ import (
 	"time"
 
 	"github.com/gitpod-io/golang-crypto/acme"
+	"github.com/gitpod-io/golang-crypto/ocsp"
 )
 
 // CAServer is a simple test server which implements ACME spec bits needed for testing.
@@ -50,6 +51,7 @@ type CAServer struct {
 	url            string
 	roots          *x509.CertPool
 	eabRequired    bool
+	ocsp           bool // leaf certs point to the OCSP responder
 
 	mu             sync.Mutex
 	certCount      int                           // number of issued certs
@@ -57,10 +59,16 @@ type CAServer struct {
 	domainAddr     map[string]string             // domain name to addr:port resolution
 	domainGetCert  map[string]getCertificateFunc // domain name to GetCertificate function
 	domainHandler  map[string]http.Handler       // domain name to Handle function
-	validAuthz     map[string]*authorization     // valid authz, keyed by domain name
+	txtRecords     map[string][]string           // TXT record name to values
+	validAuthz     map[string]*authorization     // valid authz, keyed by order identifier
 	authorizations []*authorization              // all authz, index is used as ID
 	orders         []*order                      // index is used as order ID
 	errors         []error                       // encountered client errors
+	renewalWindow  [2]time.Time                  // suggested renewal window, if set
+	ocspRequests   int                           // number of OCSP requests served
+	rateLimited    bool                          // new orders fail with a rateLimited error
+	retryAfter     time.Duration                 // Retry-After of rateLimited errors
+	profiles       map[string]string             // certificate profiles offered in the directory
 }
 
 type getCertificateFunc func(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
@@ -73,6 +81,7 @@ func NewCAServer(t *testing.T) *CAServer {
 		domainAddr:     make(map[string]string),
 		domainGetCert:  make(map[string]getCertificateFunc),
 		domainHandler:  make(map[string]http.Handler),
+		txtRecords:     make(map[string][]string),
 		validAuthz:     make(map[string]*authorization),
 	}
 
@@ -112,6 +121,9 @@ func (ca *CAServer) generateRoot() {
 	if err != nil {
 		panic(fmt.Sprintf("x509.ParseCertificate: %v", err))
 	}
+	// Make the generated key ID available for the authority key ID
+	// of the leaf certs.
+	tmpl.SubjectKeyId = cert.SubjectKeyId
 	ca.roots = x509.NewCertPool()
 	ca.roots.AddCert(cert)
 	ca.rootKey = key
@@ -162,6 +174,61 @@ func (ca *CAServer) ExternalAccountRequired() *CAServer {
 	return ca
 }
 
+// OCSPResponder makes the CA run an OCSP responder, which leaf certs point
+// to, and which reports all certs as good for a day.
+func (ca *CAServer) OCSPResponder() *CAServer {
+	if ca.url != "" {
+		panic("OCSPResponder must be called before Start")
+	}
+	ca.ocsp = true
+	return ca
+}
+
+// Profiles makes the CA offer the given certificate profiles, mapped to
+// their descriptions, in its directory.
+func (ca *CAServer) Profiles(profiles map[string]string) *CAServer {
+	if ca.url != "" {
+		panic("Profiles must be called before Start")
+	}
+	ca.profiles = profiles
+	return ca
+}
+
+// OrderProfiles returns the profile requested by each order, in order.
+func (ca *CAServer) OrderProfiles() []string {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	var profiles []string
+	for _, o := range ca.orders {
+		profiles = append(profiles, o.Profile)
+	}
+	return profiles
+}
+
+// OCSPRequests returns the number of OCSP requests served.
+func (ca *CAServer) OCSPRequests() int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.ocspRequests
+}
+
+// SetRenewalWindow makes the CA provide ACME Renewal Information, suggesting
+// the window from start to end for the renewal of all certs.
+func (ca *CAServer) SetRenewalWindow(start, end time.Time) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.renewalWindow = [2]time.Time{start, end}
+}
+
+// RateLimitOrders makes the CA reject all new orders with a rateLimited
+// error and the Retry-After value retryAfter, or none if it is zero.
+func (ca *CAServer) RateLimitOrders(retryAfter time.Duration) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.rateLimited = true
+	ca.retryAfter = retryAfter
+}
+
 // Start starts serving requests. The server address becomes available in the
 // URL field.
 func (ca *CAServer) Start() *CAServer {
@@ -229,17 +296,42 @@ func (ca *CAServer) ResolveHandler(domain string, h http.Handler) {
 	ca.domainHandler[domain] = h
 }
 
+// SetTXT adds a TXT record used to verify dns-01 challenges.
+// Together with RemoveTXT, it implements autocert.DNSProvider.
+func (ca *CAServer) SetTXT(_ context.Context, name, value string) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.txtRecords[name] = append(ca.txtRecords[name], value)
+	return nil
+}
+
+// RemoveTXT removes a TXT record added with SetTXT.
+func (ca *CAServer) RemoveTXT(_ context.Context, name, value string) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	values := ca.txtRecords[name]
+	for i, v := range values {
+		if v == value {
+			ca.txtRecords[name] = append(values[:i], values[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
 type discovery struct {
-	NewNonce   string `json:"newNonce"`
-	NewAccount string `json:"newAccount"`
-	NewOrder   string `json:"newOrder"`
-	NewAuthz   string `json:"newAuthz"`
+	NewNonce    string `json:"newNonce"`
+	NewAccount  string `json:"newAccount"`
+	NewOrder    string `json:"newOrder"`
+	NewAuthz    string `json:"newAuthz"`
+	RenewalInfo string `json:"renewalInfo,omitempty"`
 
 	Meta discoveryMeta `json:"meta,omitempty"`
 }
 
 type discoveryMeta struct {
-	ExternalAccountRequired bool `json:"externalAccountRequired,omitempty"`
+	ExternalAccountRequired bool              `json:"externalAccountRequired,omitempty"`
+	Profiles                map[string]string `json:"profiles,omitempty"`
 }
 
 type challenge struct {
@@ -249,11 +341,17 @@ type challenge struct {
 }
 
 type authorization struct {
+	Identifier struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"identifier"`
 	Status     string      `json:"status"`
 	Challenges []challenge `json:"challenges"`
+	Wildcard   bool        `json:"wildcard,omitempty"`
 
-	domain string
-	id     int
+	domain     string
+	identifier string // order identifier, including any "*." prefix
+	id         int
 }
 
 type order struct {
@@ -261,6 +359,7 @@ type order struct {
 	AuthzURLs   []string `json:"authorizations"`
 	FinalizeURL string   `json:"finalize"`    // CSR submit URL
 	CertURL     string   `json:"certificate"` // already issued cert
+	Profile     string   `json:"profile,omitempty"`
 
 	leaf []byte // issued cert in DER format
 }
@@ -282,12 +381,68 @@ func (ca *CAServer) handle(w http.ResponseWriter, r *http.Request) {
 			NewOrder:   ca.serverURL("/new-order"),
 			Meta: discoveryMeta{
 				ExternalAccountRequired: ca.eabRequired,
+				Profiles:                ca.profiles,
 			},
 		}
+		ca.mu.Lock()
+		if !ca.renewalWindow[0].IsZero() {
+			resp.RenewalInfo = ca.serverURL("/renewal-info")
+		}
+		ca.mu.Unlock()
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
 			panic(fmt.Sprintf("discovery response: %v", err))
 		}
 
+	// OCSP requests.
+	case r.URL.Path == "/ocsp":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			ca.httpErrorf(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			ca.httpErrorf(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ca.mu.Lock()
+		ca.ocspRequests++
+		ca.mu.Unlock()
+		root, err := x509.ParseCertificate(ca.rootCert)
+		if err != nil {
+			panic(fmt.Sprintf("x509.ParseCertificate: %v", err))
+		}
+		now := time.Now()
+		resp, err := ocsp.CreateResponse(root, root, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   now.Add(-time.Minute),
+			NextUpdate:   now.Add(24 * time.Hour),
+		}, ca.rootKey)
+		if err != nil {
+			panic(fmt.Sprintf("ocsp.CreateResponse: %v", err))
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+
+	// ACME Renewal Information requests.
+	case strings.HasPrefix(r.URL.Path, "/renewal-info/"):
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		if ca.renewalWindow[0].IsZero() {
+			ca.httpErrorf(w, http.StatusNotFound, "renewal info is not enabled")
+			return
+		}
+		resp := map[string]interface{}{
+			"suggestedWindow": map[string]time.Time{
+				"start": ca.renewalWindow[0],
+				"end":   ca.renewalWindow[1],
+			},
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			panic(fmt.Sprintf("renewal info response: %v", err))
+		}
+
 	// Nonce requests.
 	case r.URL.Path == "/new-nonce":
 		// Nonce values are always set. Nothing else to do.
@@ -325,16 +480,34 @@ func (ca *CAServer) handle(w http.ResponseWriter, r *http.Request) {
 	// New order request.
 	case r.URL.Path == "/new-order":
 		var req struct {
-			Identifiers []struct{ Value string }
+			Identifiers []struct{ Type, Value string }
+			Profile     string
 		}
 		if err := decodePayload(&req, r.Body); err != nil {
 			ca.httpErrorf(w, http.StatusBadRequest, "%v", err)
 			return
 		}
+		if _, ok := ca.profiles[req.Profile]; req.Profile != "" && !ok {
+			ca.httpErrorf(w, http.StatusBadRequest, "unknown profile %q", req.Profile)
+			return
+		}
 		ca.mu.Lock()
 		defer ca.mu.Unlock()
-		o := &order{Status: acme.StatusPending}
+		if ca.rateLimited {
+			if ca.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(ca.retryAfter/time.Second)))
+			}
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:rateLimited","detail":"too many new orders"}`))
+			return
+		}
+		o := &order{Status: acme.StatusPending, Profile: req.Profile}
 		for _, id := range req.Identifiers {
+			if id.Type == "ip" && net.ParseIP(id.Value) == nil {
+				ca.httpErrorf(w, http.StatusBadRequest, "invalid ip identifier %q", id.Value)
+				return
+			}
 			z := ca.authz(id.Value)
 			o.AuthzURLs = append(o.AuthzURLs, ca.serverURL("/authz/%d", z.id))
 		}
@@ -503,11 +676,21 @@ func (ca *CAServer) authz(identifier string) *authorization {
 	if !ok {
 		authzId := len(ca.authorizations)
 		authz = &authorization{
-			id:     authzId,
-			domain: identifier,
-			Status: acme.StatusPending,
+			id:         authzId,
+			domain:     strings.TrimPrefix(identifier, "*."),
+			identifier: identifier,
+			Wildcard:   strings.HasPrefix(identifier, "*."),
+			Status:     acme.StatusPending,
+		}
+		authz.Identifier.Type, authz.Identifier.Value = "dns", authz.domain
+		if net.ParseIP(authz.domain) != nil {
+			authz.Identifier.Type = "ip"
 		}
 		for _, typ := range ca.challengeTypes {
+			if authz.Wildcard && typ != "dns-01" {
+				// See RFC 8555, Section 8.4.
+				continue
+			}
 			authz.Challenges = append(authz.Challenges, challenge{
 				Type:  typ,
 				URI:   ca.serverURL("/challenge/%s/%d", typ, authzId),
@@ -531,11 +714,15 @@ func (ca *CAServer) leafCert(csr *x509.CertificateRequest) (der []byte, err erro
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
 		BasicConstraintsValid: true,
 	}
-	if len(csr.DNSNames) == 0 {
+	if len(csr.DNSNames) == 0 && len(csr.IPAddresses) == 0 {
 		leaf.DNSNames = []string{csr.Subject.CommonName}
 	}
+	if ca.ocsp {
+		leaf.OCSPServer = []string{ca.serverURL("/ocsp")}
+	}
 	return x509.CreateCertificate(rand.Reader, leaf, ca.rootTemplate, csr.PublicKey, ca.rootKey)
 }
 
@@ -592,6 +779,8 @@ func (ca *CAServer) validateChallenge(authz *authorization, typ string) {
 		err = ca.verifyALPNChallenge(authz)
 	case "http-01":
 		err = ca.verifyHTTPChallenge(authz)
+	case "dns-01":
+		err = ca.verifyDNSChallenge(authz)
 	default:
 		panic(fmt.Sprintf("validation of %q is not implemented", typ))
 	}
@@ -601,7 +790,7 @@ func (ca *CAServer) validateChallenge(authz *authorization, typ string) {
 		authz.Status = "invalid"
 	} else {
 		authz.Status = "valid"
-		ca.validAuthz[authz.domain] = authz
+		ca.validAuthz[authz.identifier] = authz
 	}
 	ca.t.Logf("validated %q for %q, err: %v", typ, authz.domain, err)
 	ca.t.Logf("authz %d is now %s", authz.id, authz.Status)
@@ -662,11 +851,17 @@ func (ca *CAServer) verifyALPNChallenge(a *authorization) error {
 		return fmt.Errorf("overlapping resolution information for %q", a.domain)
 	}
 
+	// IP addresses are validated with their reverse name, see RFC 8738, Section 6.
+	serverName := a.domain
+	if ip := net.ParseIP(a.domain); ip != nil {
+		serverName = acme.ReverseName(ip)
+	}
+
 	var crt *x509.Certificate
 	switch {
 	case haveAddr:
 		conn, err := tls.Dial("tcp", addr, &tls.Config{
-			ServerName:         a.domain,
+			ServerName:         serverName,
 			InsecureSkipVerify: true,
 			NextProtos:         []string{acmeALPNProto},
 			MinVersion:         tls.VersionTLS12,
@@ -683,7 +878,7 @@ func (ca *CAServer) verifyALPNChallenge(a *authorization) error {
 		crt = conn.ConnectionState().PeerCertificates[0]
 	case haveGetCert:
 		hello := &tls.ClientHelloInfo{
-			ServerName: a.domain,
+			ServerName: serverName,
 			// TODO: support selecting ECDSA.
 			CipherSuites:      []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305},
 			SupportedProtos:   []string{acme.ALPNProto},
@@ -767,6 +962,17 @@ func (ca *CAServer) verifyHTTPChallenge(a *authorization) error {
 	return nil
 }
 
+func (ca *CAServer) verifyDNSChallenge(a *authorization) error {
+	name := "_acme-challenge." + a.domain + "."
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	// TODO: check the record value against the key authorization.
+	if len(ca.txtRecords[name]) == 0 {
+		return fmt.Errorf("no TXT record for %q", name)
+	}
+	return nil
+}
+
 func decodePayload(v interface{}, r io.Reader) error {
 	var req struct{ Payload string }
 	if err := json.NewDecoder(r).Decode(&req); err != nil {
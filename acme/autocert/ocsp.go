@@ -0,0 +1,267 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/ocsp"
+)
+
+// ocspJitter is the default maximum of Manager.OCSPRefreshJitter.
+const ocspJitter = time.Hour
+
+// ocspRetry is how long to wait before fetching an OCSP response again
+// after a failure.
+const ocspRetry = 10 * time.Minute
+
+// ocspRefresh is how often OCSP responses without a next update time
+// are refreshed.
+const ocspRefresh = 12 * time.Hour
+
+// errNoOCSPServer is returned for certificates that don't name an OCSP
+// responder, or lack an issuer in their chain.
+var errNoOCSPServer = errors.New("acme/autocert: certificate has no OCSP server")
+
+// ocspStapler tracks the timer refreshing the OCSP staple of a single
+// domain's cert.
+type ocspStapler struct {
+	m  *Manager
+	ck certKey
+
+	timerMu sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+// startStapling starts refreshing the OCSP staple of the cert for ck, if
+// m.OCSPStapling is set. If a refresh timer is already running, it fires
+// immediately, so that a new cert gets stapled.
+func (m *Manager) startStapling(ck certKey) {
+	if !m.OCSPStapling || ck.isToken {
+		return
+	}
+	m.staplingMu.Lock()
+	defer m.staplingMu.Unlock()
+	if m.stapling == nil {
+		m.stapling = make(map[certKey]*ocspStapler)
+	}
+	st := m.stapling[ck]
+	if st == nil {
+		st = &ocspStapler{m: m, ck: ck}
+		m.stapling[ck] = st
+	}
+	st.schedule(0)
+}
+
+// stopStapling stops all OCSP refresh timers.
+func (m *Manager) stopStapling() {
+	m.staplingMu.Lock()
+	defer m.staplingMu.Unlock()
+	for ck, st := range m.stapling {
+		delete(m.stapling, ck)
+		st.stop()
+	}
+}
+
+func (st *ocspStapler) schedule(d time.Duration) {
+	st.timerMu.Lock()
+	defer st.timerMu.Unlock()
+	if st.stopped {
+		return
+	}
+	if st.timer != nil {
+		st.timer.Stop()
+	}
+	st.timer = time.AfterFunc(d, st.refresh)
+}
+
+func (st *ocspStapler) stop() {
+	st.timerMu.Lock()
+	defer st.timerMu.Unlock()
+	st.stopped = true
+	if st.timer != nil {
+		st.timer.Stop()
+	}
+}
+
+// refresh is called by the timer to fetch a new OCSP staple.
+func (st *ocspStapler) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	next, err := st.m.staple(ctx, st.ck)
+	testDidStaple(st.ck, next, err)
+	if err == errNoOCSPServer {
+		return
+	}
+	if err != nil {
+		next = ocspRetry + time.Duration(pseudoRand.int63n(int64(ocspRetry)))
+	}
+	if next < time.Minute {
+		next = time.Minute
+	}
+	st.schedule(next)
+}
+
+// staple attaches a valid OCSP response to the current cert for ck, taking
+// it from the cache if possible, and returns the time after which it should
+// be refreshed. If no valid response can be obtained, the staple is removed.
+func (m *Manager) staple(ctx context.Context, ck certKey) (time.Duration, error) {
+	m.stateMu.Lock()
+	s := m.state[ck]
+	m.stateMu.Unlock()
+	if s == nil {
+		return 0, errNoOCSPServer
+	}
+	s.RLock()
+	chain, leaf, current := s.cert, s.leaf, s.ocsp
+	s.RUnlock()
+	if leaf == nil || len(leaf.OCSPServer) == 0 || len(chain) < 2 {
+		return 0, errNoOCSPServer
+	}
+	issuer, err := x509.ParseCertificate(chain[1])
+	if err != nil {
+		return 0, err
+	}
+
+	key := ocspCacheKey(ck)
+	der, resp := m.cachedOCSP(ctx, key, leaf, issuer)
+	if resp == nil && current != nil {
+		if r, err := m.checkOCSP(current, leaf, issuer); err == nil {
+			der, resp = current, r
+		}
+	}
+	if resp == nil || m.ocspNext(resp) <= 0 {
+		fresh, freshResp, err := m.fetchOCSP(ctx, leaf, issuer)
+		switch {
+		case err == nil:
+			der, resp = fresh, freshResp
+			if m.Cache != nil {
+				m.Cache.Put(ctx, key, der)
+			}
+		case resp == nil:
+			// The staple, if any, expired: stop serving it.
+			s.Lock()
+			if s.leaf == leaf {
+				s.ocsp, s.ocspExpiry = nil, time.Time{}
+			}
+			s.Unlock()
+			return 0, err
+		}
+	}
+
+	s.Lock()
+	if s.leaf == leaf {
+		s.ocsp, s.ocspExpiry = der, resp.NextUpdate
+	}
+	s.Unlock()
+	return m.ocspNext(resp), nil
+}
+
+// cachedOCSP returns the OCSP response for leaf stored under key in m.Cache,
+// if it is still valid.
+func (m *Manager) cachedOCSP(ctx context.Context, key string, leaf, issuer *x509.Certificate) ([]byte, *ocsp.Response) {
+	if m.Cache == nil {
+		return nil, nil
+	}
+	der, err := m.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, nil
+	}
+	resp, err := m.checkOCSP(der, leaf, issuer)
+	if err != nil {
+		return nil, nil
+	}
+	return der, resp
+}
+
+// fetchOCSP requests an OCSP response for leaf from its OCSP server.
+func (m *Manager) fetchOCSP(ctx context.Context, leaf, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, "POST", leaf.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/ocsp-request")
+	hc := http.DefaultClient
+	if m.Client != nil && m.Client.HTTPClient != nil {
+		hc = m.Client.HTTPClient
+	}
+	res, err := hc.Do(hreq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("acme/autocert: OCSP server returned %s", res.Status)
+	}
+	der, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := m.checkOCSP(der, leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return der, resp, nil
+}
+
+// checkOCSP parses an OCSP response for leaf, and checks that it reports
+// leaf as good and has not expired.
+func (m *Manager) checkOCSP(der []byte, leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	resp, err := ocsp.ParseResponseForCert(der, leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != ocsp.Good {
+		return nil, fmt.Errorf("acme/autocert: OCSP status %d for certificate", resp.Status)
+	}
+	if !resp.NextUpdate.IsZero() && !m.now().Before(resp.NextUpdate) {
+		return nil, errors.New("acme/autocert: expired OCSP response")
+	}
+	return resp, nil
+}
+
+// ocspNext returns the time until resp should be refreshed: halfway through
+// its validity period, minus a random jitter.
+func (m *Manager) ocspNext(resp *ocsp.Response) time.Duration {
+	if resp.NextUpdate.IsZero() {
+		return ocspRefresh
+	}
+	refresh := resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+	d := refresh.Sub(m.now())
+	if jitter := m.ocspRefreshJitter(); jitter > 0 {
+		d -= time.Duration(pseudoRand.int63n(int64(jitter)))
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (m *Manager) ocspRefreshJitter() time.Duration {
+	if m.OCSPRefreshJitter != 0 {
+		return m.OCSPRefreshJitter
+	}
+	return ocspJitter
+}
+
+// ocspCacheKey returns the cache key of the OCSP response for the cert of ck.
+func ocspCacheKey(ck certKey) string {
+	return ck.String() + "+ocsp"
+}
+
+var testDidStaple = func(ck certKey, next time.Duration, err error) {}
@@ -0,0 +1,169 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/acme"
+	"github.com/gitpod-io/golang-crypto/acme/autocert/internal/acmetest"
+	"github.com/gitpod-io/golang-crypto/ocsp"
+)
+
+func TestOCSPStapling(t *testing.T) {
+	const domain = "example.org"
+	ca := acmetest.NewCAServer(t).OCSPResponder().Start()
+	cache := newMemCache(t)
+
+	stapled := make(chan error, 10)
+	testDidStaple = func(ck certKey, next time.Duration, err error) {
+		if err == nil && (next < 11*time.Hour || next > 12*time.Hour) {
+			t.Errorf("testDidStaple: next = %v, want between 11h and 12h", next)
+		}
+		stapled <- err
+	}
+	defer func() { testDidStaple = func(certKey, time.Duration, error) {} }()
+
+	for i := 0; i < 2; i++ {
+		man := &Manager{
+			Prompt:       AcceptTOS,
+			Cache:        cache,
+			Client:       &acme.Client{DirectoryURL: ca.URL()},
+			OCSPStapling: true,
+		}
+		if i == 0 {
+			ca.ResolveGetCertificate(domain, man.GetCertificate)
+		}
+
+		cert, err := man.GetCertificate(clientHelloInfo(domain, algECDSA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-stapled:
+			if err != nil {
+				t.Fatalf("#%d: stapling failed: %v", i, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("#%d: certificate was not stapled", i)
+		}
+		man.stopRenew()
+
+		cert, err = man.GetCertificate(clientHelloInfo(domain, algECDSA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.OCSPStaple) == 0 {
+			t.Fatalf("#%d: certificate has no OCSP staple", i)
+		}
+		issuer, err := x509.ParseCertificate(cert.Certificate[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ocsp.ParseResponseForCert(cert.OCSPStaple, cert.Leaf, issuer)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if resp.Status != ocsp.Good {
+			t.Errorf("#%d: OCSP status %d, want Good", i, resp.Status)
+		}
+	}
+
+	// The second Manager took both the cert and the staple from the cache.
+	if n := ca.OCSPRequests(); n != 1 {
+		t.Errorf("got %d OCSP requests, want 1", n)
+	}
+	if _, err := cache.Get(context.Background(), ocspCacheKey(certKey{domain: domain})); err != nil {
+		t.Errorf("OCSP response is not cached: %v", err)
+	}
+}
+
+func TestOCSPStaplingNoServer(t *testing.T) {
+	const domain = "example.org"
+	ca := acmetest.NewCAServer(t).Start()
+	man := testManager(t)
+	man.Client = &acme.Client{DirectoryURL: ca.URL()}
+	man.OCSPStapling = true
+	ca.ResolveGetCertificate(domain, man.GetCertificate)
+
+	stapled := make(chan error, 1)
+	testDidStaple = func(ck certKey, next time.Duration, err error) { stapled <- err }
+	defer func() { testDidStaple = func(certKey, time.Duration, error) {} }()
+
+	if _, err := man.GetCertificate(clientHelloInfo(domain, algECDSA)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-stapled:
+		if err != errNoOCSPServer {
+			t.Errorf("got error %v, want %v", err, errNoOCSPServer)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("stapling was not attempted")
+	}
+	if ca.OCSPRequests() != 0 {
+		t.Error("OCSP request sent for a certificate without OCSP server")
+	}
+}
+
+func TestOCSPStaplingExpired(t *testing.T) {
+	const domain = "example.org"
+	ca := acmetest.NewCAServer(t).OCSPResponder().Start()
+	man := testManager(t)
+	man.Client = &acme.Client{DirectoryURL: ca.URL()}
+	man.OCSPStapling = true
+	ca.ResolveGetCertificate(domain, man.GetCertificate)
+
+	stapled := make(chan error, 1)
+	testDidStaple = func(ck certKey, next time.Duration, err error) { stapled <- err }
+	defer func() { testDidStaple = func(certKey, time.Duration, error) {} }()
+
+	if _, err := man.GetCertificate(clientHelloInfo(domain, algECDSA)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-stapled:
+		if err != nil {
+			t.Fatalf("stapling failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("certificate was not stapled")
+	}
+	man.stopRenew()
+	ck := certKey{domain: domain}
+	s := man.state[ck]
+
+	// A staple past its NextUpdate time is not served, even before the
+	// next refresh.
+	s.Lock()
+	expiry := s.ocspExpiry
+	s.ocspExpiry = time.Now().Add(-time.Minute)
+	s.Unlock()
+	cert, err := man.GetCertificate(clientHelloInfo(domain, algECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.OCSPStaple) != 0 {
+		t.Error("expired OCSP staple served")
+	}
+	s.Lock()
+	s.ocspExpiry = expiry
+	s.Unlock()
+
+	// A refresh that fails after NextUpdate drops the staple. The responder
+	// only gives responses that are expired by then.
+	man.nowFunc = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	if _, err := man.staple(context.Background(), ck); err == nil {
+		t.Fatal("refreshing the staple succeeded with expired responses")
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if s.ocsp != nil {
+		t.Error("OCSP staple kept after a failed refresh past NextUpdate")
+	}
+}
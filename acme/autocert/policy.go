@@ -0,0 +1,200 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/idna"
+)
+
+// HostRules is a set of rules matching host names, from which a HostPolicy
+// is made with its Policy method. The methods adding rules return a
+// modified copy and leave the HostRules unchanged, so a HostRules can be
+// used concurrently. The zero value, like a nil *HostRules, matches no
+// host.
+//
+//	rules := new(autocert.HostRules).
+//		Allow("example.com", "*.example.com").
+//		AllowSuffix("customers.example.net").
+//		AllowRegexp(regexp.MustCompile(`shop-[0-9]+\.example\.org`))
+//
+// Host names are matched in the Punycode form produced by idna.Lookup, like
+// the names GetCertificate passes to the policy.
+type HostRules struct {
+	exact     map[string]bool
+	wildcards map[string]bool // the parent domains of "*." patterns
+	suffixes  []string        // with a leading dot
+	regexps   []*regexp.Regexp
+}
+
+func (r *HostRules) clone() *HostRules {
+	c := &HostRules{
+		exact:     make(map[string]bool),
+		wildcards: make(map[string]bool),
+	}
+	if r == nil {
+		return c
+	}
+	for h := range r.exact {
+		c.exact[h] = true
+	}
+	for h := range r.wildcards {
+		c.wildcards[h] = true
+	}
+	c.suffixes = append(c.suffixes, r.suffixes...)
+	c.regexps = append(c.regexps, r.regexps...)
+	return c
+}
+
+// Allow returns a copy of r that also matches hosts. Each of hosts is an
+// IP address, which matches any textual form of the same address, a host
+// name, or a wildcard such as "*.example.com", which matches the host
+// names with one more label than example.com, as in certificates. Invalid
+// hosts are silently ignored.
+func (r *HostRules) Allow(hosts ...string) *HostRules {
+	c := r.clone()
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			c.exact[ip.String()] = true
+			continue
+		}
+		wildcard := strings.HasPrefix(h, "*.")
+		if wildcard {
+			h = h[len("*."):]
+		}
+		h, err := idna.Lookup.ToASCII(h)
+		switch {
+		case err != nil || h == "":
+		case wildcard:
+			c.wildcards[h] = true
+		default:
+			c.exact[h] = true
+		}
+	}
+	return c
+}
+
+// AllowSuffix returns a copy of r that also matches the subdomains of each
+// of domains, at any depth, but not the domains themselves. Invalid domains
+// are silently ignored.
+func (r *HostRules) AllowSuffix(domains ...string) *HostRules {
+	c := r.clone()
+	for _, d := range domains {
+		if d, err := idna.Lookup.ToASCII(d); err == nil && d != "" {
+			c.suffixes = append(c.suffixes, "."+d)
+		}
+	}
+	return c
+}
+
+// AllowRegexp returns a copy of r that also matches the host names which
+// re matches entirely, as if it was anchored with ^ and $.
+func (r *HostRules) AllowRegexp(re *regexp.Regexp) *HostRules {
+	c := r.clone()
+	c.regexps = append(c.regexps, regexp.MustCompile(`^(?:`+re.String()+`)$`))
+	return c
+}
+
+// Match reports whether r matches host.
+func (r *HostRules) Match(host string) bool {
+	if r == nil {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return r.exact[ip.String()]
+	}
+	host, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return false
+	}
+	if r.exact[host] {
+		return true
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 && r.wildcards[host[i+1:]] {
+		return true
+	}
+	for _, s := range r.suffixes {
+		if len(host) > len(s) && strings.HasSuffix(host, s) {
+			return true
+		}
+	}
+	for _, re := range r.regexps {
+		if re.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy returns a HostPolicy which allows the hosts r matches.
+func (r *HostRules) Policy() HostPolicy {
+	return func(_ context.Context, host string) error {
+		if !r.Match(host) {
+			return fmt.Errorf("acme/autocert: host %q not allowed by HostRules", host)
+		}
+		return nil
+	}
+}
+
+// A DynamicHostPolicy holds HostRules that can be replaced while the
+// Manager uses them, for instance to allow the domains of new tenants
+// without restarting. Its methods may be called concurrently. The zero
+// value allows no host.
+type DynamicHostPolicy struct {
+	rules atomic.Pointer[HostRules]
+}
+
+// NewDynamicHostPolicy returns a DynamicHostPolicy with the given initial
+// rules.
+func NewDynamicHostPolicy(rules *HostRules) *DynamicHostPolicy {
+	p := &DynamicHostPolicy{}
+	p.rules.Store(rules)
+	return p
+}
+
+// Rules returns the current rules of p.
+func (p *DynamicHostPolicy) Rules() *HostRules {
+	return p.rules.Load()
+}
+
+// SetRules replaces the rules of p. Calls of the policy that started
+// before may still use the previous rules.
+func (p *DynamicHostPolicy) SetRules(rules *HostRules) {
+	p.rules.Store(rules)
+}
+
+// Update replaces the rules of p with the result of f applied to the
+// current rules, atomically with respect to other calls of Update and
+// SetRules. The function may be called several times if the rules change
+// concurrently, so it should have no side effects.
+//
+//	policy.Update(func(r *autocert.HostRules) *autocert.HostRules {
+//		return r.Allow("new-tenant.example.com")
+//	})
+func (p *DynamicHostPolicy) Update(f func(*HostRules) *HostRules) {
+	for {
+		old := p.rules.Load()
+		if p.rules.CompareAndSwap(old, f(old)) {
+			return
+		}
+	}
+}
+
+// Policy returns a HostPolicy for Manager.HostPolicy which allows the hosts
+// matched by the rules of p at the time it is called.
+func (p *DynamicHostPolicy) Policy() HostPolicy {
+	return func(_ context.Context, host string) error {
+		if !p.rules.Load().Match(host) {
+			return fmt.Errorf("acme/autocert: host %q not allowed by DynamicHostPolicy", host)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestHostRules(t *testing.T) {
+	rules := new(HostRules).
+		Allow("example.com", "*.example.org", "Bücher.example", "10.0.0.1").
+		AllowSuffix("tenants.example.net").
+		AllowRegexp(regexp.MustCompile(`shop-[0-9]+\.example\.io`))
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.COM", true},
+		{"www.example.com", false},
+		{"www.example.org", true},
+		{"example.org", false},
+		{"a.b.example.org", false},
+		{"xn--bcher-kva.example", true},
+		{"bücher.example", true},
+		{"10.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"10.0.0.2", false},
+		{"tenants.example.net", false},
+		{"a.tenants.example.net", true},
+		{"a.b.tenants.example.net", true},
+		{"atenants.example.net", false},
+		{"shop-42.example.io", true},
+		{"shop-42.example.io.evil.com", false},
+		{"myshop-42.example.io", false},
+	}
+	policy := rules.Policy()
+	for _, test := range tests {
+		if got := rules.Match(test.host); got != test.want {
+			t.Errorf("Match(%q) = %v, want %v", test.host, got, test.want)
+		}
+		if err := policy(context.Background(), test.host); (err == nil) != test.want {
+			t.Errorf("policy(%q) = %v, want allowed %v", test.host, err, test.want)
+		}
+	}
+
+	// Adding rules doesn't modify the original.
+	if more := rules.Allow("example.net"); !more.Match("example.net") || rules.Match("example.net") {
+		t.Error("Allow modified its receiver")
+	}
+	var zero *HostRules
+	if zero.Match("example.com") || !zero.Allow("example.com").Match("example.com") {
+		t.Error("unexpected result for nil HostRules")
+	}
+}
+
+func TestDynamicHostPolicy(t *testing.T) {
+	var zero DynamicHostPolicy
+	if err := zero.Policy()(context.Background(), "example.com"); err == nil {
+		t.Error("zero DynamicHostPolicy allowed a host")
+	}
+
+	p := NewDynamicHostPolicy(new(HostRules).Allow("example.com"))
+	policy := p.Policy()
+	if err := policy(context.Background(), "example.com"); err != nil {
+		t.Error(err)
+	}
+	p.SetRules(new(HostRules).Allow("example.org"))
+	if err := policy(context.Background(), "example.com"); err == nil {
+		t.Error("policy allowed a removed host")
+	}
+
+	var wg sync.WaitGroup
+	hosts := []string{"a.example", "b.example", "c.example", "d.example"}
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h string) {
+			defer wg.Done()
+			p.Update(func(r *HostRules) *HostRules { return r.Allow(h) })
+			policy(context.Background(), h)
+		}(h)
+	}
+	wg.Wait()
+	for _, h := range append(hosts, "example.org") {
+		if err := policy(context.Background(), h); err != nil {
+			t.Error(err)
+		}
+	}
+}
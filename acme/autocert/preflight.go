@@ -0,0 +1,278 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/acme"
+)
+
+// Preflight configures the checks a Manager makes before requesting a
+// certificate from a CA, see Manager.Preflight.
+type Preflight struct {
+	// Resolver optionally looks up the IP addresses of a host name.
+	// If nil, net.DefaultResolver is used.
+	Resolver func(ctx context.Context, host string) ([]net.IP, error)
+
+	// Addrs optionally lists the public IP addresses of the server. If set,
+	// every host name must only resolve to addresses in Addrs, since the CA
+	// may validate the challenges at any of the addresses of a name.
+	Addrs []net.IP
+
+	// Timeout optionally bounds each of the connections made to check that
+	// the challenges are reachable. If zero, 10 seconds is used.
+	Timeout time.Duration
+
+	// dial, if not nil, is used instead of net.Dialer.DialContext.
+	// This may be set for testing purposes.
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// A PreflightError reports that a host name failed the checks of
+// Manager.Preflight, so that no certificate was requested for it.
+type PreflightError struct {
+	Host string // the host name or IP address
+	Err  error  // the problems found, with how to fix them
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("acme/autocert: preflight check of %q failed, no certificate was requested: %v", e.Host, e.Err)
+}
+
+func (e *PreflightError) Unwrap() error { return e.Err }
+
+func (p *Preflight) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if p.Resolver != nil {
+		return p.Resolver(ctx, host)
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return ips, err
+}
+
+func (p *Preflight) dialContext(ctx context.Context, addr string) (net.Conn, error) {
+	if p.dial != nil {
+		return p.dial(ctx, "tcp", addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+func (p *Preflight) timeout() time.Duration {
+	if p.Timeout != 0 {
+		return p.Timeout
+	}
+	return 10 * time.Second
+}
+
+// preflight runs the checks of m.Preflight for the names of ck. It does
+// nothing if m.DNSProvider is set, because the "dns-01" challenge doesn't
+// depend on the reachability of the server.
+func (m *Manager) preflight(ctx context.Context, ck certKey) error {
+	if m.Preflight == nil || m.DNSProvider != nil {
+		return nil
+	}
+	m.challengeMu.RLock()
+	http01 := m.tryHTTP01
+	m.challengeMu.RUnlock()
+	for _, host := range ck.dnsNames() {
+		if err := m.preflightHost(ctx, host, http01); err != nil {
+			return &PreflightError{Host: host, Err: err}
+		}
+	}
+	return nil
+}
+
+// preflightHost checks that host resolves to addresses of the server, and
+// that at each of them "tls-alpn-01" or, if http01 is set, "http-01"
+// challenges reach m.
+func (m *Manager) preflightHost(ctx context.Context, host string, http01 bool) error {
+	p := m.Preflight
+	var addrs []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = []net.IP{ip}
+	} else {
+		var err error
+		addrs, err = p.lookup(ctx, host)
+		if err != nil {
+			return fmt.Errorf("looking up %s: %v; check that the name servers of the domain answer", host, err)
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("%s has no A or AAAA record; point it at this server", host)
+		}
+	}
+
+	var errs []error
+	for _, addr := range addrs {
+		if len(p.Addrs) > 0 && !containsIP(p.Addrs, addr) {
+			errs = append(errs, fmt.Errorf("%s resolves to %s, which is not an address of this server; update its A or AAAA records", host, addr))
+			continue
+		}
+		tlsErr := m.probeTLSALPN01(ctx, addr)
+		if tlsErr == nil {
+			continue
+		}
+		if !http01 {
+			errs = append(errs, tlsErr)
+			continue
+		}
+		if httpErr := m.probeHTTP01(ctx, host, addr); httpErr != nil {
+			errs = append(errs, tlsErr, httpErr)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// probeTLSALPN01 checks that a TLS connection to port 443 of addr with the
+// ALPN protocol of the "tls-alpn-01" challenge is answered by m, by having
+// it serve a temporary token certificate.
+func (m *Manager) probeTLSALPN01(ctx context.Context, addr net.IP) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Preflight.timeout())
+	defer cancel()
+	name, err := preflightToken()
+	if err != nil {
+		return err
+	}
+	name += ".preflight.invalid"
+	cert, err := preflightCert(name)
+	if err != nil {
+		return err
+	}
+	m.putCertToken(ctx, name, cert)
+	defer m.deleteCertToken(name)
+
+	hostport := net.JoinHostPort(addr.String(), "443")
+	conn, err := m.Preflight.dialContext(ctx, hostport)
+	if err != nil {
+		return fmt.Errorf("port 443 of %s is not reachable: %v; check the firewall and port forwarding", addr, err)
+	}
+	defer conn.Close()
+	tc := tls.Client(conn, &tls.Config{
+		ServerName:         name,
+		NextProtos:         []string{acme.ALPNProto},
+		InsecureSkipVerify: true, // the token certificate is self-signed
+	})
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("TLS handshake with port 443 of %s failed: %v; serve Manager.TLSConfig on it, or add acme.ALPNProto to NextProtos", addr, err)
+	}
+	peer := tc.ConnectionState().PeerCertificates
+	if len(peer) == 0 || !bytes.Equal(peer[0].Raw, cert.Certificate[0]) {
+		return fmt.Errorf("port 443 of %s is not served by this Manager; check the port forwarding", addr)
+	}
+	return nil
+}
+
+// probeHTTP01 checks that an HTTP request for host to port 80 of addr is
+// answered by the Manager.HTTPHandler of m, by having it serve a temporary
+// token.
+func (m *Manager) probeHTTP01(ctx context.Context, host string, addr net.IP) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Preflight.timeout())
+	defer cancel()
+	token, err := preflightToken()
+	if err != nil {
+		return err
+	}
+	tokenPath := "/.well-known/acme-challenge/" + token
+	m.putHTTPToken(ctx, tokenPath, token)
+	defer m.deleteHTTPToken(tokenPath)
+
+	hostport := net.JoinHostPort(addr.String(), "80")
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return m.Preflight.dialContext(ctx, hostport)
+			},
+			DisableKeepAlives: true,
+		},
+		// The handler of m answers without redirects.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+hostname(host)+tokenPath, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("port 80 of %s is not reachable: %v; check the firewall and port forwarding", addr, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+	if err != nil {
+		return fmt.Errorf("reading from port 80 of %s: %v", addr, err)
+	}
+	if res.StatusCode != http.StatusOK || string(body) != token {
+		return fmt.Errorf("port 80 of %s answered with status %q and not the challenge response; serve Manager.HTTPHandler on it", addr, res.Status)
+	}
+	return nil
+}
+
+// hostname returns host in the form used in URLs.
+func hostname(host string) string {
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, x := range ips {
+		if x.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// preflightToken returns a random value identifying a preflight check.
+func preflightToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// preflightCert returns a self-signed certificate for name, which m serves
+// as a token certificate for the duration of a check.
+func preflightCert(name string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		DNSNames:     []string{name},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
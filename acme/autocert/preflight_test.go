@@ -0,0 +1,152 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/acme"
+)
+
+// preflightServer serves m.TLSConfig, or tlsConf if it is not nil, as if on
+// port 443 and, if http01 is set, m.HTTPHandler as if on port 80. It
+// returns the Preflight dial function reaching them.
+func preflightServer(t *testing.T, m *Manager, tlsConf *tls.Config, http01 bool) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if tlsConf == nil {
+		tlsConf = m.TLSConfig()
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				c.(*tls.Conn).Handshake()
+				c.Close()
+			}()
+		}
+	}()
+	ports := map[string]string{"443": l.Addr().String()}
+	if http01 {
+		s := httptest.NewServer(m.HTTPHandler(nil))
+		t.Cleanup(s.Close)
+		ports["80"] = s.Listener.Addr().String()
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, _ := net.SplitHostPort(addr)
+		if a, ok := ports[port]; ok {
+			var d net.Dialer
+			return d.DialContext(ctx, network, a)
+		}
+		return nil, errors.New("connection refused")
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	zone := map[string][]net.IP{
+		"example.org": {net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+		"other.org":   {net.ParseIP("198.51.100.1")},
+	}
+	resolve := func(ctx context.Context, host string) ([]net.IP, error) {
+		return zone[host], nil
+	}
+	otherCert, _ := preflightCert("other.example")
+	tests := []struct {
+		name    string
+		host    string
+		addrs   []net.IP
+		other   bool // port 443 is served by another server
+		http01  bool
+		wantErr string
+	}{
+		{name: "tls-alpn-01", host: "example.org"},
+		{name: "IP address", host: "192.0.2.1"},
+		{name: "no record", host: "www.example.org", wantErr: "no A or AAAA record"},
+		{name: "other address", host: "other.org", addrs: zone["example.org"], wantErr: "not an address of this server"},
+		{name: "known addresses", host: "example.org", addrs: zone["example.org"]},
+		{name: "other server", host: "example.org", other: true, wantErr: "not served by this Manager"},
+		{name: "http-01", host: "example.org", other: true, http01: true},
+		{name: "http-01 IP address", host: "2001:db8::1", other: true, http01: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &Manager{Prompt: AcceptTOS}
+			var tlsConf *tls.Config
+			if test.other {
+				tlsConf = &tls.Config{Certificates: []tls.Certificate{*otherCert}, NextProtos: []string{acme.ALPNProto}}
+			}
+			m.Preflight = &Preflight{
+				Resolver: resolve,
+				Addrs:    test.addrs,
+				dial:     preflightServer(t, m, tlsConf, test.http01),
+			}
+			err := m.preflight(context.Background(), certKey{domain: test.host})
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				var pe *PreflightError
+				if !errors.As(err, &pe) || pe.Host != test.host || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want a *PreflightError for %q containing %q", err, test.host, test.wantErr)
+				}
+			}
+			if len(m.certTokens) != 0 || len(m.httpTokens) != 0 {
+				t.Errorf("tokens left after the check: %d certificates, %d HTTP", len(m.certTokens), len(m.httpTokens))
+			}
+		})
+	}
+
+	// Without HTTPHandler, only port 443 is checked.
+	m := &Manager{Prompt: AcceptTOS}
+	m.Preflight = &Preflight{Resolver: resolve}
+	m.Preflight.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasSuffix(addr, ":80") {
+			t.Errorf("dialed %s", addr)
+		}
+		return nil, errors.New("connection refused")
+	}
+	if err := m.preflight(context.Background(), certKey{domain: "example.org"}); err == nil || !strings.Contains(err.Error(), "port 443") {
+		t.Errorf("got error %v, want port 443 not reachable", err)
+	}
+}
+
+func TestPreflightNoOrder(t *testing.T) {
+	var requests atomic.Int32
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+	}))
+	defer ca.Close()
+	m := &Manager{
+		Prompt: AcceptTOS,
+		Client: &acme.Client{DirectoryURL: ca.URL},
+		Preflight: &Preflight{Resolver: func(ctx context.Context, host string) ([]net.IP, error) {
+			return nil, nil
+		}},
+	}
+	hello := clientHelloInfo("example.org", algECDSA)
+	var pe *PreflightError
+	if _, err := m.GetCertificate(hello); !errors.As(err, &pe) {
+		t.Errorf("got error %v, want a *PreflightError", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("got %d requests to the CA, want 0", n)
+	}
+}
@@ -5,15 +5,23 @@
 package autocert
 
 import (
+	"bytes"
 	"context"
 	"crypto"
+	"crypto/x509"
 	"sync"
 	"time"
+
+	"github.com/gitpod-io/golang-crypto/acme"
 )
 
 // renewJitter is the maximum deviation from Manager.RenewBefore.
 const renewJitter = time.Hour
 
+// renewalInfoPoll is how often the ACME Renewal Information of a cert
+// is checked for changes, unless the CA asks for another interval.
+const renewalInfoPoll = 6 * time.Hour
+
 // domainRenewal tracks the state used by the periodic timers
 // renewing a single domain's cert.
 type domainRenewal struct {
@@ -24,10 +32,19 @@ type domainRenewal struct {
 	timerMu    sync.Mutex
 	timer      *time.Timer
 	timerClose chan struct{} // if non-nil, renew closes this channel (and nils out the timer fields) instead of running
+
+	// ACME Renewal Information state, guarded by timerMu.
+	ca            int                // index of the CA that issued the cert, as defined by Manager.caClient
+	noRenewalInfo map[int]bool       // CAs known not to provide renewal info
+	renewalInfo   bool               // the issuing CA provided renewal info last time
+	ariWindow     acme.RenewalWindow // last suggested window
+	ariTime       time.Time          // renewal time picked within ariWindow
 }
 
 // start starts a cert renewal timer at the time
 // defined by the certificate expiration time exp.
+// The timer fires no later than renewalInfoPoll, so that any
+// ACME Renewal Information provided by the CA is taken into account.
 //
 // If the timer is already started, calling start is a noop.
 func (dr *domainRenewal) start(exp time.Time) {
@@ -36,7 +53,11 @@ func (dr *domainRenewal) start(exp time.Time) {
 	if dr.timer != nil {
 		return
 	}
-	dr.timer = time.AfterFunc(dr.next(exp), dr.renew)
+	next := dr.next(exp)
+	if next > renewalInfoPoll {
+		next = renewalInfoPoll
+	}
+	dr.timer = time.AfterFunc(next, dr.renew)
 }
 
 // stop stops the cert renewal timer and waits for any in-flight calls to renew
@@ -79,6 +100,11 @@ func (dr *domainRenewal) renew() {
 	// TODO: rotate dr.key at some point?
 	next, err := dr.do(ctx)
 	if err != nil {
+		var notAfter time.Time
+		if leaf := dr.currentLeaf(); leaf != nil {
+			notAfter = leaf.NotAfter
+		}
+		dr.m.event(EventRenewalFailed, dr.ck, notAfter, err)
 		next = renewJitter / 2
 		next += time.Duration(pseudoRand.int63n(int64(next)))
 	}
@@ -88,11 +114,22 @@ func (dr *domainRenewal) renew() {
 
 // updateState locks and replaces the relevant Manager.state item with the given
 // state. It additionally updates dr.key with the given state's key.
+// If the cert changed, its OCSP staple is refreshed.
 func (dr *domainRenewal) updateState(state *certState) {
 	dr.m.stateMu.Lock()
 	defer dr.m.stateMu.Unlock()
 	dr.key = state.key
+	if old := dr.m.state[dr.ck]; old != nil {
+		old.RLock()
+		if len(old.cert) > 0 && bytes.Equal(old.cert[0], state.cert[0]) {
+			state.ocsp, state.ocspExpiry = old.ocsp, old.ocspExpiry
+		}
+		old.RUnlock()
+	}
 	dr.m.state[dr.ck] = state
+	if state.ocsp == nil {
+		dr.m.startStapling(dr.ck)
+	}
 }
 
 // do is similar to Manager.createCert but it doesn't lock a Manager.state item.
@@ -100,15 +137,36 @@ func (dr *domainRenewal) updateState(state *certState) {
 // replaces dr.m.state item with a new one and updates cache for the given domain.
 //
 // It may lock and update the Manager.state if the expiration date of the currently
-// cached cert is far enough in the future.
+// cached cert is far enough in the future, or if the CA's renewal information
+// does not suggest renewing it yet.
 //
 // The returned value is a time interval after which the renewal should occur again.
 func (dr *domainRenewal) do(ctx context.Context) (time.Duration, error) {
-	// a race is likely unavoidable in a distributed environment
-	// but we try nonetheless
-	if tlscert, err := dr.m.cacheGet(ctx, dr.ck); err == nil {
-		next := dr.next(tlscert.Leaf.NotAfter)
-		if next > dr.m.renewBefore()+renewJitter {
+	// Another Manager sharing the cache may have renewed the cert already.
+	// Unless the cache is a Locker, a race is likely unavoidable in a
+	// distributed environment, but we try nonetheless.
+	unlock, err := dr.m.lockCert(ctx, dr.ck)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	tlscert, cacheErr := dr.m.cacheGet(ctx, dr.ck)
+	leaf := dr.currentLeaf()
+	if cacheErr == nil {
+		leaf = tlscert.Leaf
+	}
+	if leaf != nil {
+		next, ok := dr.renewalInfoNext(ctx, leaf)
+		due := next == 0
+		if !ok {
+			next = dr.next(leaf.NotAfter)
+			due = next <= dr.m.renewBefore()+renewJitter
+		}
+		if !due && cacheErr != nil {
+			// The cert in use is still good.
+			return next, nil
+		}
+		if !due {
 			signer, ok := tlscert.PrivateKey.(crypto.Signer)
 			if ok {
 				state := &certState{
@@ -122,16 +180,20 @@ func (dr *domainRenewal) do(ctx context.Context) (time.Duration, error) {
 		}
 	}
 
-	der, leaf, err := dr.m.authorizedCert(ctx, dr.key, dr.ck)
+	der, leaf, ca, err := dr.m.authorizedCert(ctx, dr.key, dr.ck)
 	if err != nil {
 		return 0, err
 	}
+	if ca != dr.ca {
+		dr.ca = ca
+		dr.renewalInfo = !dr.noRenewalInfo[ca]
+	}
 	state := &certState{
 		key:  dr.key,
 		cert: der,
 		leaf: leaf,
 	}
-	tlscert, err := state.tlscert()
+	tlscert, err = state.tlscert()
 	if err != nil {
 		return 0, err
 	}
@@ -139,7 +201,103 @@ func (dr *domainRenewal) do(ctx context.Context) (time.Duration, error) {
 		return 0, err
 	}
 	dr.updateState(state)
-	return dr.next(leaf.NotAfter), nil
+	dr.m.event(EventRenewed, dr.ck, leaf.NotAfter, nil)
+	next := dr.next(leaf.NotAfter)
+	if dr.renewalInfo && next > renewalInfoPoll {
+		next = renewalInfoPoll
+	}
+	return next, nil
+}
+
+// currentLeaf returns the leaf of the cert currently served for dr.ck, if any.
+func (dr *domainRenewal) currentLeaf() *x509.Certificate {
+	dr.m.stateMu.Lock()
+	s := dr.m.state[dr.ck]
+	dr.m.stateMu.Unlock()
+	if s == nil {
+		return nil
+	}
+	s.RLock()
+	defer s.RUnlock()
+	return s.leaf
+}
+
+// renewalInfoNext returns the time until leaf should be renewed according to
+// the ACME Renewal Information of the CA, or until the information should be
+// fetched again if that is earlier. A zero duration means leaf is due for
+// renewal. It reports false if no renewal information is available.
+//
+// As recommended by RFC 9773, the renewal time is picked at random within
+// the suggested window, and only picked again if the window changes.
+func (dr *domainRenewal) renewalInfoNext(ctx context.Context, leaf *x509.Certificate) (time.Duration, bool) {
+	ri, ok := dr.fetchRenewalInfo(ctx, leaf)
+	if !ok {
+		if dr.noRenewalInfo[dr.ca] {
+			dr.renewalInfo = false
+		}
+		return 0, false
+	}
+	dr.renewalInfo = true
+
+	w := ri.SuggestedWindow
+	if !w.Start.Equal(dr.ariWindow.Start) || !w.End.Equal(dr.ariWindow.End) {
+		dr.ariWindow = w
+		dr.ariTime = w.Start.Add(time.Duration(pseudoRand.int63n(int64(w.End.Sub(w.Start)))))
+	}
+	now := dr.m.now()
+	d := dr.ariTime.Sub(now)
+	if d <= 0 {
+		return 0, true
+	}
+	poll := renewalInfoPoll
+	if !ri.RetryAfter.IsZero() {
+		poll = ri.RetryAfter.Sub(now)
+		if poll < time.Minute {
+			poll = time.Minute
+		}
+	}
+	if d > poll {
+		d = poll
+	}
+	return d, true
+}
+
+// fetchRenewalInfo fetches the renewal information of leaf from the CA that
+// issued it. A cached cert doesn't record its CA, so unless dr.ca provides
+// the information, the other CAs of dr.m are asked in order: those that did
+// not issue leaf don't know it.
+func (dr *domainRenewal) fetchRenewalInfo(ctx context.Context, leaf *x509.Certificate) (*acme.RenewalInfo, bool) {
+	for n := 0; n <= len(dr.m.FallbackCAs); n++ {
+		i := n
+		if n == 0 {
+			i = dr.ca
+		} else if n <= dr.ca {
+			i = n - 1
+		}
+		if dr.noRenewalInfo[i] {
+			continue
+		}
+		client, err := dr.m.caClient(ctx, i)
+		if err != nil {
+			continue
+		}
+		ri, err := client.FetchRenewalInfo(ctx, leaf.Raw)
+		if err == acme.ErrNoRenewalInfo {
+			if dr.noRenewalInfo == nil {
+				dr.noRenewalInfo = make(map[int]bool)
+			}
+			dr.noRenewalInfo[i] = true
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, false
+			}
+			continue
+		}
+		dr.ca = i
+		return ri, true
+	}
+	return nil, false
 }
 
 func (dr *domainRenewal) next(expiry time.Time) time.Duration {
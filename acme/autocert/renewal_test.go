@@ -5,6 +5,7 @@
 package autocert
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
@@ -267,3 +268,115 @@ func TestRenewFromCacheAlreadyRenewed(t *testing.T) {
 		t.Errorf("state leaf.NotAfter = %v; want == %v", tlscert.Leaf.NotAfter, newLeaf.NotAfter)
 	}
 }
+
+func TestRenewalInfo(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		start, end time.Time
+		renew      bool
+	}{
+		{"window passed", now.Add(-2 * time.Hour), now.Add(-time.Hour), true},
+		{"window ahead", now.Add(10 * 24 * time.Hour), now.Add(11 * 24 * time.Hour), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ca := acmetest.NewCAServer(t).Start()
+			ca.SetRenewalWindow(test.start, test.end)
+			man := testManager(t)
+			ca.ResolveGetCertificate(exampleDomain, man.GetCertificate)
+			man.Client = &acme.Client{
+				DirectoryURL: ca.URL(),
+			}
+
+			// cache a cert that isn't due for renewal based on its expiry
+			c := ca.LeafCert(exampleDomain, "ECDSA", now.Add(-2*time.Hour), now.Add(90*24*time.Hour))
+			if err := man.cachePut(context.Background(), exampleCertKey, c); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := man.GetCertificate(clientHelloInfo(exampleDomain, algECDSA)); err != nil {
+				t.Fatal(err)
+			}
+			dr := &domainRenewal{m: man, ck: exampleCertKey, key: c.PrivateKey.(crypto.Signer)}
+			next, err := dr.do(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next <= 0 || next > renewalInfoPoll {
+				t.Errorf("next = %v; want between 0 and %v", next, renewalInfoPoll)
+			}
+
+			tlscert, err := man.cacheGet(context.Background(), exampleCertKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			renewed := !bytes.Equal(tlscert.Certificate[0], c.Certificate[0])
+			if renewed != test.renew {
+				t.Errorf("renewed = %v; want %v", renewed, test.renew)
+			}
+		})
+	}
+}
+
+func TestRenewalInfoFallbackCA(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		start, end time.Time
+		renew      bool
+	}{
+		{"window passed", now.Add(-2 * time.Hour), now.Add(-time.Hour), true},
+		{"window ahead", now.Add(10 * 24 * time.Hour), now.Add(11 * 24 * time.Hour), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The primary CA doesn't provide renewal info, which must not
+			// hide that of the fallback CA that issued the cert.
+			ca := acmetest.NewCAServer(t).Start()
+			fallback := acmetest.NewCAServer(t).Start()
+			fallback.SetRenewalWindow(test.start, test.end)
+			man := testManager(t)
+			ca.ResolveGetCertificate(exampleDomain, man.GetCertificate)
+			man.Client = &acme.Client{DirectoryURL: ca.URL()}
+			man.FallbackCAs = []CA{{Client: &acme.Client{DirectoryURL: fallback.URL()}}}
+
+			c := fallback.LeafCert(exampleDomain, "ECDSA", now.Add(-2*time.Hour), now.Add(90*24*time.Hour))
+			if err := man.cachePut(context.Background(), exampleCertKey, c); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := man.GetCertificate(clientHelloInfo(exampleDomain, algECDSA)); err != nil {
+				t.Fatal(err)
+			}
+			dr := &domainRenewal{m: man, ck: exampleCertKey, key: c.PrivateKey.(crypto.Signer)}
+			next, err := dr.do(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !dr.noRenewalInfo[0] {
+				t.Error("primary CA not recorded as lacking renewal info")
+			}
+
+			tlscert, err := man.cacheGet(context.Background(), exampleCertKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			renewed := !bytes.Equal(tlscert.Certificate[0], c.Certificate[0])
+			if renewed != test.renew {
+				t.Errorf("renewed = %v; want %v", renewed, test.renew)
+			}
+			if renewed {
+				// The primary CA issued the new cert.
+				if dr.ca != 0 || dr.renewalInfo {
+					t.Errorf("ca = %d, renewalInfo = %v; want 0, false", dr.ca, dr.renewalInfo)
+				}
+				return
+			}
+			if dr.ca != 1 {
+				t.Errorf("ca = %d; want 1", dr.ca)
+			}
+			if next <= 0 || next > renewalInfoPoll {
+				t.Errorf("next = %v; want between 0 and %v", next, renewalInfoPoll)
+			}
+		})
+	}
+}
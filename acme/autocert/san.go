@@ -0,0 +1,127 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// maxSANs is the largest number of names in a certificate issued by Let's
+// Encrypt.
+const maxSANs = 100
+
+// A SANGroup is a set of host names which are served a single certificate.
+// See Manager.SANGroups.
+type SANGroup struct {
+	// Name identifies the certificate of the group in Manager.Cache and in
+	// Event.Domain. It must not be empty.
+	Name string
+
+	// Hosts are the names of the certificate. They must include the host
+	// for which the group is returned, and there can be at most 100 of
+	// them, the limit of Let's Encrypt. IP addresses are not supported.
+	Hosts []string
+}
+
+// GroupByDomain returns a function for Manager.SANGroups which groups the
+// specified host names by registered domain, such as "example.com" for
+// "www.example.com" and "api.example.com", as determined by the public
+// suffix list. The group of a domain is named after it, and domains with more
+// than 100 hosts are split into several groups.
+//
+// Like with HostWhitelist, hosts are converted to Punycode, and invalid hosts
+// are silently ignored. Other hosts are served certificates of their own.
+func GroupByDomain(hosts ...string) func(ctx context.Context, host string) (*SANGroup, error) {
+	byDomain := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		h, err := idna.Lookup.ToASCII(strings.TrimSuffix(h, "."))
+		if err != nil || seen[h] || net.ParseIP(h) != nil {
+			continue
+		}
+		domain, err := publicsuffix.EffectiveTLDPlusOne(h)
+		if err != nil {
+			continue
+		}
+		seen[h] = true
+		byDomain[domain] = append(byDomain[domain], h)
+	}
+
+	groups := make(map[string]*SANGroup)
+	for domain, hosts := range byDomain {
+		sort.Strings(hosts)
+		for i := 0; i < len(hosts); i += maxSANs {
+			end := i + maxSANs
+			if end > len(hosts) {
+				end = len(hosts)
+			}
+			g := &SANGroup{Name: domain, Hosts: hosts[i:end]}
+			if i > 0 {
+				g.Name += "-" + strconv.Itoa(i/maxSANs+1)
+			}
+			for _, h := range g.Hosts {
+				groups[h] = g
+			}
+		}
+	}
+	return func(_ context.Context, host string) (*SANGroup, error) {
+		return groups[host], nil
+	}
+}
+
+// sanGroupKey returns the key of the certificate of the SAN group of the
+// host of ck, if any, and ck otherwise.
+func (m *Manager) sanGroupKey(ctx context.Context, ck certKey) (certKey, error) {
+	g, err := m.SANGroups(ctx, ck.domain)
+	if err != nil || g == nil {
+		return ck, err
+	}
+	if g.Name == "" {
+		return ck, errors.New("acme/autocert: SAN group without a name")
+	}
+	if len(g.Hosts) > maxSANs {
+		return ck, fmt.Errorf("acme/autocert: SAN group %q has more than %d hosts", g.Name, maxSANs)
+	}
+
+	names := make([]string, 0, len(g.Hosts))
+	found := false
+	for _, host := range g.Hosts {
+		if net.ParseIP(host) != nil {
+			return ck, fmt.Errorf("acme/autocert: SAN group %q has IP address %q", g.Name, host)
+		}
+		h, err := idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+		if err != nil {
+			return ck, fmt.Errorf("acme/autocert: SAN group %q has invalid host %q", g.Name, host)
+		}
+		found = found || h == ck.domain
+		names = append(names, h)
+	}
+	if !found {
+		return ck, fmt.Errorf("acme/autocert: SAN group %q does not include host %q", g.Name, ck.domain)
+	}
+	// Sort the names, so that the key doesn't depend on their order, and
+	// drop duplicates.
+	sort.Strings(names)
+	n := 1
+	for _, h := range names[1:] {
+		if h != names[n-1] {
+			names[n] = h
+			n++
+		}
+	}
+	names = names[:n]
+	ck.domain = g.Name
+	ck.names = strings.Join(names, " ")
+	return ck, nil
+}
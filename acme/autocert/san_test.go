@@ -0,0 +1,134 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/acme"
+	"github.com/gitpod-io/golang-crypto/acme/autocert/internal/acmetest"
+)
+
+func TestGroupByDomain(t *testing.T) {
+	hosts := []string{"www.example.org", "example.org", "api.example.org", "www.example.co.uk", "bad..host", "192.0.2.1"}
+	for i := 0; i < 150; i++ {
+		hosts = append(hosts, fmt.Sprintf("h%03d.example.net", i))
+	}
+	groups := GroupByDomain(hosts...)
+
+	g, _ := groups(context.Background(), "api.example.org")
+	want := &SANGroup{Name: "example.org", Hosts: []string{"api.example.org", "example.org", "www.example.org"}}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("got group %+v, want %+v", g, want)
+	}
+	if g, _ := groups(context.Background(), "www.example.co.uk"); g == nil || g.Name != "example.co.uk" {
+		t.Errorf("got group %+v for www.example.co.uk, want example.co.uk", g)
+	}
+	for _, host := range []string{"other.example.org", "192.0.2.1"} {
+		if g, _ := groups(context.Background(), host); g != nil {
+			t.Errorf("got group %+v for %s, want none", g, host)
+		}
+	}
+
+	first, _ := groups(context.Background(), "h000.example.net")
+	last, _ := groups(context.Background(), "h149.example.net")
+	if first == nil || len(first.Hosts) != maxSANs || first.Name != "example.net" {
+		t.Errorf("got first example.net group %+v", first)
+	}
+	if last == nil || len(last.Hosts) != 50 || last.Name != "example.net-2" {
+		t.Errorf("got second example.net group %+v", last)
+	}
+}
+
+func TestGetCertificateSANGroup(t *testing.T) {
+	ca := acmetest.NewCAServer(t).ChallengeTypes("dns-01").Start()
+	man := testManager(t)
+	man.Client = &acme.Client{DirectoryURL: ca.URL()}
+	man.DNSProvider = ca
+	man.SANGroups = GroupByDomain("www.example.org", "example.org", "api.example.org")
+
+	tlscert, err := man.GetCertificate(clientHelloInfo("www.example.org", algECDSA))
+	if err != nil {
+		t.Fatalf("man.GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(tlscert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"api.example.org", "example.org", "www.example.org"}; !reflect.DeepEqual(leaf.DNSNames, want) {
+		t.Errorf("got SANs %q, want %q", leaf.DNSNames, want)
+	}
+	if _, err := man.Cache.Get(context.Background(), "example.org+san"); err != nil {
+		t.Errorf("certificate not cached under the group name: %v", err)
+	}
+
+	// Other hosts of the group are served the same certificate.
+	other, err := man.GetCertificate(clientHelloInfo("api.example.org", algECDSA))
+	if err != nil {
+		t.Fatalf("man.GetCertificate: %v", err)
+	}
+	if !bytes.Equal(other.Certificate[0], tlscert.Certificate[0]) {
+		t.Error("api.example.org was issued a separate certificate")
+	}
+
+	// Hosts outside of groups get their own certificate.
+	single, err := man.GetCertificate(clientHelloInfo("example.com", algECDSA))
+	if err != nil {
+		t.Fatalf("man.GetCertificate: %v", err)
+	}
+	leaf, err = x509.ParseCertificate(single.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "example.com" {
+		t.Errorf("got SANs %q, want [example.com]", leaf.DNSNames)
+	}
+
+	// The host policy applies to every host of a group.
+	man2 := testManager(t)
+	man2.Client = &acme.Client{DirectoryURL: ca.URL()}
+	man2.DNSProvider = ca
+	man2.HostPolicy = HostWhitelist("www.example.org", "example.org")
+	man2.SANGroups = man.SANGroups
+	if _, err := man2.GetCertificate(clientHelloInfo("www.example.org", algECDSA)); err == nil {
+		t.Error("man.GetCertificate succeeded with a group host rejected by HostPolicy")
+	}
+}
+
+func TestSANGroupKey(t *testing.T) {
+	man := &Manager{}
+	tests := []struct {
+		group *SANGroup
+		want  certKey
+		err   bool
+	}{
+		{nil, certKey{domain: "b.example.org"}, false},
+		{&SANGroup{Name: "g", Hosts: []string{"B.example.org", "a.example.org", "a.example.org."}}, certKey{domain: "g", names: "a.example.org b.example.org"}, false},
+		{&SANGroup{Hosts: []string{"b.example.org"}}, certKey{}, true},
+		{&SANGroup{Name: "g", Hosts: []string{"a.example.org"}}, certKey{}, true},
+		{&SANGroup{Name: "g", Hosts: []string{"b.example.org", "192.0.2.1"}}, certKey{}, true},
+	}
+	for i, test := range tests {
+		man.SANGroups = func(context.Context, string) (*SANGroup, error) { return test.group, nil }
+		ck, err := man.sanGroupKey(context.Background(), certKey{domain: "b.example.org"})
+		if test.err {
+			if err == nil {
+				t.Errorf("%d: sanGroupKey succeeded", i)
+			}
+			continue
+		}
+		if err != nil || ck != test.want {
+			t.Errorf("%d: got key %+v and error %v, want %+v", i, ck, err, test.want)
+		}
+	}
+	if s := (certKey{domain: "g", names: "a b", isRSA: true}).String(); s != "g+san+rsa" {
+		t.Errorf("got cache key %q, want g+san+rsa", s)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// typeCAA is the DNS resource record type of CAA records.
+const typeCAA dnsmessage.Type = 257
+
+// caaFlagCritical is the Issuer Critical flag of a CAA record.
+const caaFlagCritical = 128
+
+// A CAARecord is a DNS Certification Authority Authorization record, as
+// defined in RFC 8659.
+type CAARecord struct {
+	Flags uint8
+	Tag   string // such as "issue", "issuewild" or "iodef"
+	Value string
+}
+
+// A CAAChecker evaluates the CAA records of domains against a CA before
+// ordering certificates for them, so that orders the CA would reject
+// because of CAA fail early with a clear error. See Client.CheckCAA for
+// a CAAChecker configured for the CA of a Client.
+//
+// The records are evaluated as by the CA, following RFC 8659 and the
+// accounturi and validationmethods parameters of RFC 8657. However, the
+// records seen by the CA may differ, for instance while DNS changes
+// propagate, so a successful check doesn't guarantee issuance.
+type CAAChecker struct {
+	// IssuerDomains are the issuer domain names of the CA, such as
+	// "letsencrypt.org", as listed in the caaIdentities of its directory.
+	IssuerDomains []string
+
+	// AccountURI is the URI of the ACME account that will order the
+	// certificates. If empty, the accounturi parameters are not checked.
+	AccountURI string
+
+	// ValidationMethod is the challenge type that will be used to
+	// validate the domains, such as "dns-01". If empty, the
+	// validationmethods parameters are not checked.
+	ValidationMethod string
+
+	// Resolver looks up the CAA records of a domain name, and returns no
+	// records and no error if it has none. If nil, LookupCAA is used.
+	Resolver func(ctx context.Context, name string) ([]CAARecord, error)
+}
+
+// A CAAError reports that the CAA records of a domain don't allow a CA to
+// issue certificates for it.
+type CAAError struct {
+	// Domain is the domain whose certificate was checked.
+	Domain string
+	// Name is the domain name at which the relevant CAA records were
+	// found, such as a parent of Domain.
+	Name string
+	// Records are the CAA records found at Name.
+	Records []CAARecord
+	// Reason explains why the records don't allow issuance.
+	Reason string
+}
+
+func (e *CAAError) Error() string {
+	return fmt.Sprintf("acme: CAA records of %s at %s prevent issuance: %s", e.Domain, e.Name, e.Reason)
+}
+
+// Check returns an error if the CAA records of domain, which may be a
+// wildcard such as "*.example.com", don't allow the CA to issue a
+// certificate for it. The error is a *CAAError if the records were found
+// and forbid issuance.
+func (c *CAAChecker) Check(ctx context.Context, domain string) error {
+	if len(c.IssuerDomains) == 0 {
+		return errors.New("acme: CAAChecker has no issuer domains")
+	}
+	resolve := c.Resolver
+	if resolve == nil {
+		resolve = LookupCAA
+	}
+	wildcard := strings.HasPrefix(domain, "*.")
+	name := strings.TrimSuffix(strings.TrimPrefix(domain, "*."), ".")
+
+	// The relevant records are those of the closest name having any, up
+	// to the top-level domain. See RFC 8659, Section 3.
+	for name != "" {
+		records, err := resolve(ctx, name)
+		if err != nil {
+			return fmt.Errorf("acme: CAA lookup for %s: %w", name, err)
+		}
+		if len(records) > 0 {
+			if reason := c.evaluate(records, wildcard); reason != "" {
+				return &CAAError{Domain: domain, Name: name, Records: records, Reason: reason}
+			}
+			return nil
+		}
+		_, name, _ = strings.Cut(name, ".")
+	}
+	return nil
+}
+
+// evaluate returns why records don't allow issuance, or the empty string
+// if they do.
+func (c *CAAChecker) evaluate(records []CAARecord, wildcard bool) string {
+	var issue, issueWild []CAARecord
+	for _, r := range records {
+		switch strings.ToLower(r.Tag) {
+		case "issue":
+			issue = append(issue, r)
+		case "issuewild":
+			issueWild = append(issueWild, r)
+		case "iodef", "contactemail", "contactphone", "issuemail", "issuevmc":
+		default:
+			if r.Flags&caaFlagCritical != 0 {
+				return fmt.Sprintf("unknown critical property %q", r.Tag)
+			}
+		}
+	}
+	relevant := issue
+	if wildcard && len(issueWild) > 0 {
+		relevant = issueWild
+	}
+	if len(relevant) == 0 {
+		// Only the issue and issuewild properties restrict issuance.
+		return ""
+	}
+
+	reason := fmt.Sprintf("no %s property authorizes %s", relevant[0].Tag, strings.Join(c.IssuerDomains, ", "))
+	for _, r := range relevant {
+		issuer, params, ok := parseCAAIssueValue(r.Value)
+		if !ok || !c.isIssuer(issuer) {
+			continue
+		}
+		if uri, ok := params["accounturi"]; ok && c.AccountURI != "" && uri != c.AccountURI {
+			reason = fmt.Sprintf("%s is only authorized for account %s", issuer, uri)
+			continue
+		}
+		if methods, ok := params["validationmethods"]; ok && c.ValidationMethod != "" && !containsMethod(methods, c.ValidationMethod) {
+			reason = fmt.Sprintf("%s is only authorized with validation methods %s", issuer, methods)
+			continue
+		}
+		return ""
+	}
+	return reason
+}
+
+func (c *CAAChecker) isIssuer(domain string) bool {
+	for _, d := range c.IssuerDomains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMethod(methods, method string) bool {
+	for _, m := range strings.Split(methods, ",") {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCAAIssueValue parses the value of an issue or issuewild property,
+// an issuer domain name followed by parameters, as in
+// "ca.example; accounturi=https://ca.example/acct/1". The issuer domain
+// name is empty for values such as ";", which authorize no CA.
+func parseCAAIssueValue(v string) (issuer string, params map[string]string, ok bool) {
+	issuer, rest, _ := strings.Cut(v, ";")
+	issuer = strings.TrimSpace(issuer)
+	params = make(map[string]string)
+	for _, p := range strings.Split(rest, ";") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		k, v, found := strings.Cut(p, "=")
+		if !found {
+			return "", nil, false
+		}
+		params[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return issuer, params, true
+}
+
+// CheckCAA returns an error if the CAA records of domain don't allow the CA
+// of c to issue a certificate for it, as described for CAAChecker. The
+// issuer domain names of the CA are those of its directory, and the
+// accounturi parameters are checked against the account of c.Key, if it
+// is registered. It returns nil without any lookup if the CA doesn't
+// publish its issuer domain names.
+//
+// CheckCAA is meant to be called before creating an order, with the
+// challenge type that will be used, or the empty string if undecided.
+func (c *Client) CheckCAA(ctx context.Context, domain, challengeType string) error {
+	checker, err := c.caaChecker(ctx, challengeType)
+	if err != nil || checker == nil {
+		return err
+	}
+	return checker.Check(ctx, domain)
+}
+
+// caaChecker returns the CAAChecker of CheckCAA, or nil if the CA doesn't
+// publish its issuer domain names.
+func (c *Client) caaChecker(ctx context.Context, challengeType string) (*CAAChecker, error) {
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(dir.CAA) == 0 {
+		return nil, nil
+	}
+	checker := &CAAChecker{
+		IssuerDomains:    dir.CAA,
+		ValidationMethod: challengeType,
+	}
+	if c.Key != nil {
+		checker.AccountURI = string(c.accountKID(ctx))
+	}
+	return checker, nil
+}
+
+// LookupCAA returns the CAA records of name, including those of the target
+// of a CNAME record, from the first nameserver of /etc/resolv.conf.
+func LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	server, err := systemNameserver()
+	if err != nil {
+		return nil, err
+	}
+	return lookupCAA(ctx, server, name)
+}
+
+// systemNameserver returns the address of the first nameserver of
+// /etc/resolv.conf.
+func systemNameserver() (string, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("acme: no nameserver to look up CAA records: %w", err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", errors.New("acme: no nameserver in /etc/resolv.conf to look up CAA records")
+}
+
+// lookupCAA queries server for the CAA records of name, over UDP and over
+// TCP if the response is truncated.
+func lookupCAA(ctx context.Context, server, name string) ([]CAARecord, error) {
+	n, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: n, Type: typeCAA, Class: dnsmessage.ClassINET}},
+	}
+	q, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+	resp, err := exchangeDNS(ctx, "udp", server, q)
+	if err == nil && resp.Header.Truncated {
+		resp, err = exchangeDNS(ctx, "tcp", server, q)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.ID != id || !resp.Header.Response {
+		return nil, errors.New("acme: invalid DNS response")
+	}
+	switch resp.Header.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, fmt.Errorf("acme: DNS lookup failed: %v", resp.Header.RCode)
+	}
+
+	var records []CAARecord
+	for _, a := range resp.Answers {
+		if a.Header.Type != typeCAA {
+			continue
+		}
+		u, ok := a.Body.(*dnsmessage.UnknownResource)
+		if !ok {
+			continue
+		}
+		r, err := parseCAARecord(u.Data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// exchangeDNS sends the DNS query q to server over network, and returns
+// the response.
+func exchangeDNS(ctx context.Context, network, server string, q []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	buf := make([]byte, 65535)
+	var resp []byte
+	if network == "tcp" {
+		msg := binary.BigEndian.AppendUint16(nil, uint16(len(q)))
+		if _, err := conn.Write(append(msg, q...)); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return nil, err
+		}
+		resp = buf[:binary.BigEndian.Uint16(buf)]
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(q); err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp = buf[:n]
+	}
+
+	m := new(dnsmessage.Message)
+	if err := m.Unpack(resp); err != nil {
+		return nil, fmt.Errorf("acme: invalid DNS response: %v", err)
+	}
+	return m, nil
+}
+
+// parseCAARecord parses the RDATA of a CAA record: flags, a tag prefixed
+// by its length and a value.
+func parseCAARecord(data []byte) (CAARecord, error) {
+	if len(data) < 2 || len(data) < 2+int(data[1]) || data[1] == 0 {
+		return CAARecord{}, errors.New("acme: invalid CAA record")
+	}
+	return CAARecord{
+		Flags: data[0],
+		Tag:   string(data[2 : 2+data[1]]),
+		Value: string(data[2+data[1]:]),
+	}, nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestCAACheck(t *testing.T) {
+	zone := map[string][]CAARecord{
+		"example.com": {
+			{0, "issue", "ca.example"},
+			{0, "issuewild", ";"},
+			{0, "iodef", "mailto:security@example.com"},
+		},
+		"other.example.com": {{0, "issue", "other-ca.example; foo=bar"}},
+		"iodef.example.com": {{0, "iodef", "mailto:security@example.com"}},
+		"critical.example.com": {
+			{0, "issue", "ca.example"},
+			{caaFlagCritical, "future", "x"},
+		},
+		"noncritical.example.com": {
+			{0, "issue", "CA.example"},
+			{0, "future", "x"},
+		},
+		"account.example.com": {
+			{0, "issue", "ca.example; accounturi=https://ca.example/acct/1"},
+			{0, "issue", "ca.example; accounturi = https://ca.example/acct/2 ; validationmethods=dns-01,http-01"},
+		},
+		"malformed.example.com": {{0, "issue", "ca.example; accounturi"}},
+		"wild.example.net":      {{0, "issue", "ca.example"}},
+	}
+	var lookups []string
+	resolve := func(ctx context.Context, name string) ([]CAARecord, error) {
+		lookups = append(lookups, name)
+		if name == "fail.example.org" {
+			return nil, errors.New("SERVFAIL")
+		}
+		return zone[name], nil
+	}
+
+	tests := []struct {
+		domain  string
+		account string
+		method  string
+		ok      bool
+		lookups []string
+	}{
+		{"example.com", "", "", true, []string{"example.com"}},
+		{"www.example.com", "", "", true, []string{"www.example.com", "example.com"}},
+		{"a.b.example.com.", "", "", true, []string{"a.b.example.com", "b.example.com", "example.com"}},
+		{"*.example.com", "", "", false, []string{"example.com"}},
+		{"other.example.com", "", "", false, []string{"other.example.com"}},
+		{"iodef.example.com", "", "", true, []string{"iodef.example.com"}},
+		{"critical.example.com", "", "", false, nil},
+		{"noncritical.example.com", "", "", true, nil},
+		{"account.example.com", "", "", true, nil},
+		{"account.example.com", "https://ca.example/acct/1", "tls-alpn-01", true, nil},
+		{"account.example.com", "https://ca.example/acct/2", "http-01", true, nil},
+		{"account.example.com", "https://ca.example/acct/2", "tls-alpn-01", false, nil},
+		{"account.example.com", "https://ca.example/acct/3", "", false, nil},
+		{"malformed.example.com", "", "", false, nil},
+		{"*.wild.example.net", "", "", true, []string{"wild.example.net"}},
+		{"example.org", "", "", true, []string{"example.org", "org"}},
+		{"fail.example.org", "", "", false, []string{"fail.example.org"}},
+	}
+	for _, test := range tests {
+		lookups = nil
+		c := &CAAChecker{
+			IssuerDomains:    []string{"ca.example"},
+			AccountURI:       test.account,
+			ValidationMethod: test.method,
+			Resolver:         resolve,
+		}
+		err := c.Check(context.Background(), test.domain)
+		if (err == nil) != test.ok {
+			t.Errorf("Check(%q) with account %q and method %q: got error %v, want success %v", test.domain, test.account, test.method, err, test.ok)
+		}
+		if test.lookups != nil && !reflect.DeepEqual(lookups, test.lookups) {
+			t.Errorf("Check(%q): got lookups %q, want %q", test.domain, lookups, test.lookups)
+		}
+		var caaErr *CAAError
+		if err != nil && test.domain != "fail.example.org" && !errors.As(err, &caaErr) {
+			t.Errorf("Check(%q): got error %T, want a *CAAError", test.domain, err)
+		}
+	}
+
+	if err := (&CAAChecker{Resolver: resolve}).Check(context.Background(), "example.com"); err == nil {
+		t.Error("Check succeeded without issuer domains")
+	}
+}
+
+func TestClientCAAChecker(t *testing.T) {
+	c := &Client{
+		Key: testKeyEC,
+		KID: "https://ca.example/acct/1",
+		dir: &Directory{CAA: []string{"ca.example"}},
+	}
+	checker, err := c.caaChecker(context.Background(), "dns-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CAAChecker{
+		IssuerDomains:    []string{"ca.example"},
+		AccountURI:       "https://ca.example/acct/1",
+		ValidationMethod: "dns-01",
+	}
+	if !reflect.DeepEqual(checker, want) {
+		t.Errorf("got %+v, want %+v", checker, want)
+	}
+
+	c = &Client{dir: &Directory{}}
+	if err := c.CheckCAA(context.Background(), "example.com", ""); err != nil {
+		t.Errorf("CheckCAA with a CA without issuer domains: %v", err)
+	}
+}
+
+// serveDNS answers the CAA queries it receives on conn with records, or
+// with a truncated response if truncate is set.
+func serveDNS(t *testing.T, conn net.PacketConn, l net.Listener, records []CAARecord, truncate bool) {
+	respond := func(q []byte, truncated bool) []byte {
+		var m dnsmessage.Message
+		if err := m.Unpack(q); err != nil {
+			t.Error(err)
+			return nil
+		}
+		m.Header.Response = true
+		m.Header.Truncated = truncated
+		if !truncated {
+			for _, r := range records {
+				data := append([]byte{r.Flags, byte(len(r.Tag))}, r.Tag+r.Value...)
+				m.Answers = append(m.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: m.Questions[0].Name, Type: typeCAA, Class: dnsmessage.ClassINET},
+					Body:   &dnsmessage.UnknownResource{Type: typeCAA, Data: data},
+				})
+			}
+		}
+		resp, err := m.Pack()
+		if err != nil {
+			t.Error(err)
+		}
+		return resp
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(respond(buf[:n], truncate), addr)
+		}
+	}()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var n [2]byte
+			if _, err := io.ReadFull(c, n[:]); err != nil {
+				c.Close()
+				continue
+			}
+			q := make([]byte, binary.BigEndian.Uint16(n[:]))
+			io.ReadFull(c, q)
+			resp := respond(q, false)
+			c.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			c.Close()
+		}
+	}()
+}
+
+func TestLookupCAA(t *testing.T) {
+	records := []CAARecord{
+		{0, "issue", "ca.example; accounturi=https://ca.example/acct/1"},
+		{caaFlagCritical, "iodef", "mailto:" + strings.Repeat("a", 600) + "@example.com"},
+	}
+	for _, truncate := range []bool{false, true} {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		l, err := net.Listen("tcp", conn.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		serveDNS(t, conn, l, records, truncate)
+
+		got, err := lookupCAA(context.Background(), conn.LocalAddr().String(), "example.com")
+		if err != nil {
+			t.Fatalf("truncate %v: %v", truncate, err)
+		}
+		if !reflect.DeepEqual(got, records) {
+			t.Errorf("truncate %v: got %+v, want %+v", truncate, got, records)
+		}
+	}
+}
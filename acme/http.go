@@ -17,7 +17,6 @@ import (
 	"net/http"
 	"runtime/debug"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -264,11 +263,28 @@ func (c *Client) doNoRetry(ctx context.Context, req *http.Request) (*http.Respon
 	return res, nil
 }
 
+// Middleware wraps the http.RoundTripper next, which sends a request to the
+// CA, with additional behavior. See Client.Middleware.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
 func (c *Client) httpClient() *http.Client {
+	hc := http.DefaultClient
 	if c.HTTPClient != nil {
-		return c.HTTPClient
+		hc = c.HTTPClient
+	}
+	if len(c.Middleware) == 0 {
+		return hc
+	}
+	rt := hc.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		rt = c.Middleware[i](rt)
 	}
-	return http.DefaultClient
+	wrapped := *hc
+	wrapped.Transport = rt
+	return &wrapped
 }
 
 // packageVersion is the version of the module that contains this package, for
@@ -308,12 +324,7 @@ func (c *Client) userAgent() string {
 
 // isBadNonce reports whether err is an ACME "badnonce" error.
 func isBadNonce(err error) bool {
-	// According to the spec badNonce is urn:ietf:params:acme:error:badNonce.
-	// However, ACME servers in the wild return their versions of the error.
-	// See https://tools.ietf.org/html/draft-ietf-acme-acme-02#section-5.4
-	// and https://github.com/letsencrypt/boulder/blob/0e07eacb/docs/acme-divergences.md#section-66.
-	ae, ok := err.(*Error)
-	return ok && strings.HasSuffix(strings.ToLower(ae.ProblemType), ":badnonce")
+	return errors.Is(err, ErrBadNonce)
 }
 
 // isRetriable reports whether a request can be retried
@@ -120,6 +120,65 @@ func TestPostWithRetries(t *testing.T) {
 	}
 }
 
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestMiddleware(t *testing.T) {
+	var count int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce%d", count))
+		if r.Method == "HEAD" {
+			return
+		}
+		if count == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:badNonce"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+	}))
+	defer ts.Close()
+
+	var log []string
+	logger := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				log = append(log, name+" "+r.Method)
+				res, err := next.RoundTrip(r)
+				if err == nil {
+					log = append(log, fmt.Sprintf("%s %d", name, res.StatusCode))
+				}
+				return res, err
+			})
+		}
+	}
+	client := &Client{
+		Key:          testKey,
+		KID:          "kid",
+		DirectoryURL: ts.URL,
+		RetryBackoff: func(int, *http.Request, *http.Response) time.Duration { return time.Millisecond },
+		Middleware:   []Middleware{logger("outer"), logger("inner")},
+		dir:          &Directory{AuthzURL: ts.URL},
+	}
+	if _, err := client.Authorize(context.Background(), "example.com"); err != nil {
+		t.Fatalf("client.Authorize: %v", err)
+	}
+	want := []string{
+		"outer HEAD", "inner HEAD", "inner 200", "outer 200",
+		"outer POST", "inner POST", "inner 400", "outer 400",
+		"outer HEAD", "inner HEAD", "inner 200", "outer 200",
+		"outer POST", "inner POST", "inner 201", "outer 201",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("middleware saw %q, want %q", log, want)
+	}
+}
+
 func TestRetryErrorType(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Replay-Nonce", "nonce")
@@ -42,6 +42,10 @@ func (c *Client) DeactivateReg(ctx context.Context) error {
 // registerRFC is equivalent to c.Register but for CAs implementing RFC 8555.
 // It expects c.Discover to have already been called.
 func (c *Client) registerRFC(ctx context.Context, acct *Account, prompt func(tosURL string) bool) (*Account, error) {
+	if acct.ExternalAccountBinding == nil && c.dir.ExternalAccountRequired {
+		return nil, ErrExternalAccountRequired
+	}
+
 	c.cacheMu.Lock() // guard c.kid access
 	defer c.cacheMu.Unlock()
 
@@ -205,6 +209,7 @@ func (c *Client) AuthorizeOrder(ctx context.Context, id []AuthzID, opt ...OrderO
 		Identifiers []wireAuthzID `json:"identifiers"`
 		NotBefore   string        `json:"notBefore,omitempty"`
 		NotAfter    string        `json:"notAfter,omitempty"`
+		Profile     string        `json:"profile,omitempty"`
 	}{}
 	for _, v := range id {
 		req.Identifiers = append(req.Identifiers, wireAuthzID{
@@ -218,6 +223,11 @@ func (c *Client) AuthorizeOrder(ctx context.Context, id []AuthzID, opt ...OrderO
 			req.NotBefore = time.Time(o).Format(time.RFC3339)
 		case orderNotAfterOpt:
 			req.NotAfter = time.Time(o).Format(time.RFC3339)
+		case orderProfileOpt:
+			if _, ok := dir.Profiles[string(o)]; !ok {
+				return nil, fmt.Errorf("acme: CA does not offer profile %q", string(o))
+			}
+			req.Profile = string(o)
 		default:
 			// Package's fault if we let this happen.
 			panic(fmt.Sprintf("unsupported order option type %T", o))
@@ -301,6 +311,7 @@ func responseOrder(res *http.Response) (*Order, error) {
 		Identifiers    []wireAuthzID
 		NotBefore      time.Time
 		NotAfter       time.Time
+		Profile        string
 		Error          *wireError
 		Authorizations []string
 		Finalize       string
@@ -315,6 +326,7 @@ func responseOrder(res *http.Response) (*Order, error) {
 		Expires:     v.Expires,
 		NotBefore:   v.NotBefore,
 		NotAfter:    v.NotAfter,
+		Profile:     v.Profile,
 		AuthzURLs:   v.Authorizations,
 		FinalizeURL: v.Finalize,
 		CertURL:     v.Certificate,
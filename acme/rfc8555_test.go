@@ -42,6 +42,7 @@ func TestRFC_Discover(t *testing.T) {
 		authz       = "https://example.com/acme/new-authz"
 		revoke      = "https://example.com/acme/revoke-cert"
 		keychange   = "https://example.com/acme/key-change"
+		renewalInfo = "https://example.com/acme/renewal-info"
 		metaTerms   = "https://example.com/acme/terms/2017-5-30"
 		metaWebsite = "https://www.example.com/"
 		metaCAA     = "example.com"
@@ -55,13 +56,15 @@ func TestRFC_Discover(t *testing.T) {
 			"newAuthz": %q,
 			"revokeCert": %q,
 			"keyChange": %q,
+			"renewalInfo": %q,
 			"meta": {
 				"termsOfService": %q,
 				"website": %q,
 				"caaIdentities": [%q],
-				"externalAccountRequired": true
+				"externalAccountRequired": true,
+				"profiles": {"classic": "https://example.com/docs/classic"}
 			}
-		}`, nonce, reg, order, authz, revoke, keychange, metaTerms, metaWebsite, metaCAA)
+		}`, nonce, reg, order, authz, revoke, keychange, renewalInfo, metaTerms, metaWebsite, metaCAA)
 	}))
 	defer ts.Close()
 	c := &Client{DirectoryURL: ts.URL}
@@ -87,6 +90,9 @@ func TestRFC_Discover(t *testing.T) {
 	if dir.KeyChangeURL != keychange {
 		t.Errorf("dir.KeyChangeURL = %q; want %q", dir.KeyChangeURL, keychange)
 	}
+	if dir.RenewalInfoURL != renewalInfo {
+		t.Errorf("dir.RenewalInfoURL = %q; want %q", dir.RenewalInfoURL, renewalInfo)
+	}
 	if dir.Terms != metaTerms {
 		t.Errorf("dir.Terms = %q; want %q", dir.Terms, metaTerms)
 	}
@@ -99,6 +105,9 @@ func TestRFC_Discover(t *testing.T) {
 	if !dir.ExternalAccountRequired {
 		t.Error("dir.Meta.ExternalAccountRequired is false")
 	}
+	if want := map[string]string{"classic": "https://example.com/docs/classic"}; !reflect.DeepEqual(dir.Profiles, want) {
+		t.Errorf("dir.Profiles = %q; want %q", dir.Profiles, want)
+	}
 }
 
 func TestRFC_popNonce(t *testing.T) {
@@ -211,6 +220,11 @@ type acmeServer struct {
 
 	mu     sync.Mutex
 	nnonce int
+
+	// eabRequired is reported as externalAccountRequired in the directory.
+	eabRequired bool
+	// profiles are reported as the profiles of the directory.
+	profiles map[string]string
 }
 
 func newACMEServer() *acmeServer {
@@ -227,6 +241,10 @@ func (s *acmeServer) start() {
 
 		// Directory request.
 		if r.URL.Path == "/" {
+			profiles, err := json.Marshal(s.profiles)
+			if err != nil {
+				panic(err)
+			}
 			fmt.Fprintf(w, `{
 				"newNonce": %q,
 				"newAccount": %q,
@@ -234,7 +252,7 @@ func (s *acmeServer) start() {
 				"newAuthz": %q,
 				"revokeCert": %q,
 				"keyChange": %q,
-				"meta": {"termsOfService": %q}
+				"meta": {"termsOfService": %q, "externalAccountRequired": %v, "profiles": %s}
 				}`,
 				s.url("/acme/new-nonce"),
 				s.url("/acme/new-account"),
@@ -243,6 +261,8 @@ func (s *acmeServer) start() {
 				s.url("/acme/revoke-cert"),
 				s.url("/acme/key-change"),
 				s.url("/terms"),
+				s.eabRequired,
+				profiles,
 			)
 			return
 		}
@@ -351,6 +371,33 @@ func TestRFC_Register(t *testing.T) {
 	}
 }
 
+func TestRFC_RegisterExternalAccountRequired(t *testing.T) {
+	s := newACMEServer()
+	s.eabRequired = true
+	s.handle("/acme/new-account", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("account registration without external account binding reached the CA")
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	s.start()
+	defer s.close()
+
+	cl := &Client{Key: testKeyEC, DirectoryURL: s.url("/")}
+	prompt := func(string) bool {
+		t.Error("prompt called for registration that cannot succeed")
+		return true
+	}
+	if _, err := cl.Register(context.Background(), &Account{}, prompt); err != ErrExternalAccountRequired {
+		t.Errorf("Register: %v; want ErrExternalAccountRequired", err)
+	}
+	d, err := cl.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.ExternalAccountRequired {
+		t.Error("Directory.ExternalAccountRequired is false")
+	}
+}
+
 func TestRFC_RegisterExternalAccountBinding(t *testing.T) {
 	eab := &ExternalAccountBinding{
 		KID: "kid-1",
@@ -788,6 +835,47 @@ func TestRFC_AuthorizeOrder(t *testing.T) {
 	}
 }
 
+func TestRFC_AuthorizeOrderProfile(t *testing.T) {
+	s := newACMEServer()
+	s.profiles = map[string]string{"shortlived": "Short-lived certificates"}
+	s.handle("/acme/new-account", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", s.url("/accounts/1"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "valid"}`))
+	})
+	s.handle("/acme/new-order", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Profile string `json:"profile"`
+		}
+		decodeJWSRequest(t, &req, r.Body)
+		if req.Profile != "shortlived" {
+			t.Errorf("req.Profile = %q; want shortlived", req.Profile)
+		}
+		w.Header().Set("Location", s.url("/orders/1"))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{
+			"status": "pending",
+			"profile": %q,
+			"identifiers": [{"type":"dns", "value":"example.org"}],
+			"authorizations": [%q]
+		}`, req.Profile, s.url("/authz/1"))
+	})
+	s.start()
+	defer s.close()
+
+	cl := &Client{Key: testKeyEC, DirectoryURL: s.url("/")}
+	o, err := cl.AuthorizeOrder(context.Background(), DomainIDs("example.org"), WithOrderProfile("shortlived"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Profile != "shortlived" {
+		t.Errorf("o.Profile = %q; want shortlived", o.Profile)
+	}
+	if _, err := cl.AuthorizeOrder(context.Background(), DomainIDs("example.org"), WithOrderProfile("classic")); err == nil {
+		t.Error("AuthorizeOrder succeeded with a profile the CA does not offer")
+	}
+}
+
 func TestRFC_GetOrder(t *testing.T) {
 	s := newACMEServer()
 	s.handle("/acme/new-account", func(w http.ResponseWriter, r *http.Request) {
@@ -984,6 +1072,68 @@ func TestRFC_AlreadyRevokedCert(t *testing.T) {
 	}
 }
 
+func TestRFC_RevokeCerts(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		revoked     []string
+		rateLimited bool
+	)
+	s := newACMEServer()
+	s.handle("/acme/revoke-cert", func(w http.ResponseWriter, r *http.Request) {
+		var j struct{ Protected, Payload string }
+		json.NewDecoder(r.Body).Decode(&j)
+		prot, _ := base64.RawURLEncoding.DecodeString(j.Protected)
+		payload, _ := base64.RawURLEncoding.DecodeString(j.Payload)
+		var h struct {
+			JWK json.RawMessage `json:"jwk"`
+		}
+		json.Unmarshal(prot, &h)
+		var req struct {
+			Cert   string `json:"certificate"`
+			Reason int    `json:"reason"`
+		}
+		json.Unmarshal(payload, &req)
+		if h.JWK == nil {
+			t.Errorf("revocation of %q is not signed in JWK form", req.Cert)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Cert == "Ag" && !rateLimited {
+			rateLimited = true
+			w.Header().Set("Retry-After", "1")
+			s.error(w, &wireError{Status: http.StatusTooManyRequests, Type: "urn:ietf:params:acme:error:rateLimited"})
+			return
+		}
+		if req.Cert == "Aw" {
+			s.error(w, &wireError{Status: http.StatusForbidden, Type: "urn:ietf:params:acme:error:unauthorized"})
+			return
+		}
+		revoked = append(revoked, fmt.Sprintf("%s/%d", req.Cert, req.Reason))
+	})
+	s.start()
+	defer s.close()
+
+	// Without an account key, the certificates are revoked with their keys,
+	// and c.RetryBackoff gives up on rate limits immediately.
+	cl := &Client{
+		DirectoryURL: s.url("/"),
+		RetryBackoff: func(n int, r *http.Request, res *http.Response) time.Duration { return 0 },
+	}
+	err := cl.RevokeCerts(context.Background(), []Revocation{
+		{Cert: []byte{1}, Key: testKeyEC, Reason: CRLReasonKeyCompromise},
+		{Cert: []byte{2}, Key: testKeyEC, Reason: CRLReasonSuperseded},
+		{Cert: []byte{3}, Key: testKeyEC},
+		{Cert: []byte{4}, Key: testKeyEC},
+	}, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "revoking certificate 2") || strings.Contains(err.Error(), "certificate 1") {
+		t.Errorf("got error %v, want an error for certificate 2 only", err)
+	}
+	if want := []string{"AQ/1", "Ag/4", "BA/0"}; !reflect.DeepEqual(revoked, want) {
+		t.Errorf("revoked %q, want %q", revoked, want)
+	}
+}
+
 func TestRFC_ListCertAlternates(t *testing.T) {
 	s := newACMEServer()
 	s.handle("/crt", func(w http.ResponseWriter, r *http.Request) {
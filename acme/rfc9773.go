@@ -0,0 +1,96 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FetchRenewalInfo retrieves the ACME Renewal Information of the given
+// DER-encoded leaf certificate, as described in RFC 9773.
+//
+// The CA may move the suggested window, for example to request early
+// renewal after an incident, so callers should fetch the renewal
+// information again periodically, or once RetryAfter has passed.
+//
+// If the CA does not support ACME Renewal Information, FetchRenewalInfo
+// returns ErrNoRenewalInfo.
+func (c *Client) FetchRenewalInfo(ctx context.Context, leaf []byte) (*RenewalInfo, error) {
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dir.RenewalInfoURL == "" {
+		return nil, ErrNoRenewalInfo
+	}
+	id, err := renewalCertID(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(dir.RenewalInfoURL, "/") + "/" + id
+	res, err := c.get(ctx, url, wantStatus(http.StatusOK))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var v struct {
+		Window struct {
+			Start time.Time `json:"start"`
+			End   time.Time `json:"end"`
+		} `json:"suggestedWindow"`
+		ExplanationURL string `json:"explanationURL"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("acme: invalid renewal info response: %v", err)
+	}
+	if v.Window.Start.IsZero() || !v.Window.End.After(v.Window.Start) {
+		return nil, errors.New("acme: invalid suggested renewal window")
+	}
+	ri := &RenewalInfo{
+		SuggestedWindow: RenewalWindow{Start: v.Window.Start, End: v.Window.End},
+		ExplanationURL:  v.ExplanationURL,
+	}
+	if ra := res.Header.Get("Retry-After"); ra != "" {
+		if d := retryAfter(ra); d > 0 {
+			ri.RetryAfter = timeNow().Add(d)
+		}
+	}
+	return ri, nil
+}
+
+// renewalCertID returns the unique identifier of a certificate used by ACME
+// Renewal Information, as described in RFC 9773, Section 4.1.
+func renewalCertID(leaf []byte) (string, error) {
+	cert, err := x509.ParseCertificate(leaf)
+	if err != nil {
+		return "", err
+	}
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", errors.New("acme: certificate has no authority key identifier")
+	}
+	// The serial number is identified by the content octets of its
+	// DER encoding, including any leading zero.
+	der, err := asn1.Marshal(cert.SerialNumber)
+	if err != nil {
+		return "", err
+	}
+	var serial asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &serial); err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(cert.AuthorityKeyId) + "." + enc.EncodeToString(serial.Bytes), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ariTestCert returns a certificate with the authority key identifier and
+// serial number of the example in RFC 9773, Section 4.1.
+func ariTestCert(t *testing.T) []byte {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(0x87654321),
+		Subject:        pkix.Name{CommonName: "example.com"},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(time.Hour),
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5b, 0x6b, 0x87, 0x46, 0x40, 0x41, 0xe1, 0xb3, 0x7b, 0x84, 0x7b, 0xa0, 0xae, 0x2c, 0xde, 0x01, 0xc8, 0xd4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, testKeyEC.Public(), testKeyEC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestRenewalCertID(t *testing.T) {
+	id, err := renewalCertID(ariTestCert(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"; id != want {
+		t.Errorf("renewalCertID = %q; want %q", id, want)
+	}
+}
+
+func TestRFC_FetchRenewalInfo(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `{"newOrder": %q, "renewalInfo": %q}`, ts.URL+"/new-order", ts.URL+"/renewal-info")
+		case "/renewal-info/aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE":
+			w.Header().Set("Retry-After", "21600")
+			fmt.Fprint(w, `{
+				"suggestedWindow": {
+					"start": "2025-01-02T04:00:00Z",
+					"end": "2025-01-03T04:00:00Z"
+				},
+				"explanationURL": "https://acme.example.com/docs/ari"
+			}`)
+		default:
+			t.Errorf("unexpected request path %q", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := &Client{DirectoryURL: ts.URL}
+	ri, err := c.FetchRenewalInfo(context.Background(), ariTestCert(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC)
+	if !ri.SuggestedWindow.Start.Equal(start) || !ri.SuggestedWindow.End.Equal(start.Add(24*time.Hour)) {
+		t.Errorf("SuggestedWindow = %+v", ri.SuggestedWindow)
+	}
+	if ri.ExplanationURL != "https://acme.example.com/docs/ari" {
+		t.Errorf("ExplanationURL = %q", ri.ExplanationURL)
+	}
+	if d := time.Until(ri.RetryAfter); d < 5*time.Hour || d > 6*time.Hour {
+		t.Errorf("RetryAfter = %v; want about 6 hours from now", ri.RetryAfter)
+	}
+}
+
+func TestRFC_FetchRenewalInfoUnsupported(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"newOrder": %q}`, ts.URL+"/new-order")
+	}))
+	defer ts.Close()
+
+	c := &Client{DirectoryURL: ts.URL}
+	if _, err := c.FetchRenewalInfo(context.Background(), ariTestCert(t)); err != ErrNoRenewalInfo {
+		t.Errorf("FetchRenewalInfo: %v; want ErrNoRenewalInfo", err)
+	}
+}
+
+func TestRFC_FetchRenewalInfoInvalidWindow(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `{"newOrder": %q, "renewalInfo": %q}`, ts.URL+"/new-order", ts.URL+"/renewal-info/")
+			return
+		}
+		fmt.Fprint(w, `{"suggestedWindow": {"start": "2025-01-03T04:00:00Z", "end": "2025-01-02T04:00:00Z"}}`)
+	}))
+	defer ts.Close()
+
+	c := &Client{DirectoryURL: ts.URL}
+	if _, err := c.FetchRenewalInfo(context.Background(), ariTestCert(t)); err == nil {
+		t.Error("FetchRenewalInfo succeeded with an end before the start")
+	}
+}
@@ -7,6 +7,7 @@ package acme
 import (
 	"crypto"
 	"crypto/x509"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
@@ -45,6 +46,27 @@ const (
 	CRLReasonAACompromise         CRLReasonCode = 10
 )
 
+var crlReasonNames = map[CRLReasonCode]string{
+	CRLReasonUnspecified:          "unspecified",
+	CRLReasonKeyCompromise:        "keyCompromise",
+	CRLReasonCACompromise:         "cACompromise",
+	CRLReasonAffiliationChanged:   "affiliationChanged",
+	CRLReasonSuperseded:           "superseded",
+	CRLReasonCessationOfOperation: "cessationOfOperation",
+	CRLReasonCertificateHold:      "certificateHold",
+	CRLReasonRemoveFromCRL:        "removeFromCRL",
+	CRLReasonPrivilegeWithdrawn:   "privilegeWithdrawn",
+	CRLReasonAACompromise:         "aACompromise",
+}
+
+// String returns the name of r in RFC 5280, such as "keyCompromise".
+func (r CRLReasonCode) String() string {
+	if name, ok := crlReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("CRLReasonCode(%d)", int(r))
+}
+
 var (
 	// ErrUnsupportedKey is returned when an unsupported key type is encountered.
 	ErrUnsupportedKey = errors.New("acme: unknown key type; only RSA and ECDSA are supported")
@@ -55,8 +77,40 @@ var (
 
 	// ErrNoAccount indicates that the Client's key has not been registered with the CA.
 	ErrNoAccount = errors.New("acme: account does not exist")
+
+	// ErrExternalAccountRequired is returned by Register when the CA
+	// requires an external account binding and the account has none.
+	ErrExternalAccountRequired = errors.New("acme: CA requires an external account binding")
+
+	// ErrNoRenewalInfo indicates that the CA does not provide ACME Renewal
+	// Information. It is returned by FetchRenewalInfo.
+	ErrNoRenewalInfo = errors.New("acme: CA does not support renewal information")
 )
 
+// These errors match, with errors.Is, the *Error returned by the CA for
+// the corresponding problem types of RFC 8555, Section 6.7.
+var (
+	// ErrBadNonce matches errors for requests with an unacceptable
+	// anti-replay nonce. Client retries them with a new nonce.
+	ErrBadNonce error = problemError("badNonce")
+
+	// ErrRateLimited matches errors for requests exceeding a rate limit
+	// of the CA. Error.RetryAfter returns when to try again.
+	ErrRateLimited error = problemError("rateLimited")
+
+	// ErrOrderNotReady matches errors for finalization requests of orders
+	// that aren't in the "ready" state.
+	ErrOrderNotReady error = problemError("orderNotReady")
+)
+
+// problemError is the name of an ACME problem type, such as "badNonce" for
+// "urn:ietf:params:acme:error:badNonce".
+type problemError string
+
+func (p problemError) Error() string {
+	return "acme: " + string(p) + " error"
+}
+
 // A Subproblem describes an ACME subproblem as reported in an Error.
 type Subproblem struct {
 	// Type is a URI reference that identifies the problem type,
@@ -119,6 +173,32 @@ func (e *Error) Error() string {
 	return str
 }
 
+// Is reports whether e has the problem type matched by target, one of
+// ErrBadNonce, ErrRateLimited and ErrOrderNotReady.
+//
+// ACME servers in the wild return their own versions of the problem types
+// of RFC 8555, so only the last part of the problem type is compared, and
+// case-insensitively. See also
+// https://github.com/letsencrypt/boulder/blob/0e07eacb/docs/acme-divergences.md#section-66.
+func (e *Error) Is(target error) bool {
+	p, ok := target.(problemError)
+	if !ok {
+		return false
+	}
+	i := strings.LastIndex(e.ProblemType, ":")
+	return i >= 0 && strings.EqualFold(e.ProblemType[i+1:], string(p))
+}
+
+// RetryAfter returns the duration after which the request can be retried,
+// as told by the Retry-After header of the response, or zero if there is
+// none. It is typically set with errors of the ErrRateLimited type.
+func (e *Error) RetryAfter() time.Duration {
+	if e.Header == nil {
+		return 0
+	}
+	return retryAfter(e.Header.Get("Retry-After"))
+}
+
 // AuthorizationError indicates that an authorization for an identifier
 // did not succeed.
 // It contains all errors from Challenge items of the failed Authorization.
@@ -168,19 +248,11 @@ func (oe *OrderError) Error() string {
 // See the following for more details on rate limiting:
 // https://tools.ietf.org/html/draft-ietf-acme-acme-05#section-5.6
 func RateLimit(err error) (time.Duration, bool) {
-	e, ok := err.(*Error)
-	if !ok {
-		return 0, false
-	}
-	// Some CA implementations may return incorrect values.
-	// Use case-insensitive comparison.
-	if !strings.HasSuffix(strings.ToLower(e.ProblemType), ":ratelimited") {
+	var e *Error
+	if !errors.As(err, &e) || !errors.Is(e, ErrRateLimited) {
 		return 0, false
 	}
-	if e.Header == nil {
-		return 0, true
-	}
-	return retryAfter(e.Header.Get("Retry-After")), true
+	return e.RetryAfter(), true
 }
 
 // Account is a user account. It is associated with a private key.
@@ -256,6 +328,20 @@ type ExternalAccountBinding struct {
 	Key []byte
 }
 
+// NewExternalAccountBinding returns an ExternalAccountBinding for the key ID
+// and MAC key provided by a CA. CAs provide the MAC key encoded in base64url,
+// which is decoded with or without padding.
+func NewExternalAccountBinding(kid, hmacKey string) (*ExternalAccountBinding, error) {
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(hmacKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("acme: invalid external account binding MAC key: %v", err)
+	}
+	if kid == "" || len(key) == 0 {
+		return nil, errors.New("acme: empty external account binding key ID or MAC key")
+	}
+	return &ExternalAccountBinding{KID: kid, Key: key}, nil
+}
+
 func (e *ExternalAccountBinding) String() string {
 	return fmt.Sprintf("&{KID: %q, Key: redacted}", e.KID)
 }
@@ -303,6 +389,41 @@ type Directory struct {
 	// ExternalAccountRequired indicates that the CA requires for all account-related
 	// requests to include external account binding information.
 	ExternalAccountRequired bool
+
+	// Profiles maps the names of the certificate profiles offered by the
+	// CA, such as "tlsserver" or "shortlived" for Let's Encrypt, to their
+	// descriptions, which are human-readable text or URLs. It is nil if
+	// the CA doesn't offer profiles. See WithOrderProfile.
+	Profiles map[string]string
+
+	// RenewalInfoURL is the base URL of the ACME Renewal Information
+	// endpoint, as described in RFC 9773. Empty string indicates the
+	// CA does not provide renewal information.
+	RenewalInfoURL string
+}
+
+// RenewalInfo is the ACME Renewal Information of a certificate,
+// as described in RFC 9773.
+type RenewalInfo struct {
+	// SuggestedWindow is the time window within which the CA
+	// recommends renewing the certificate.
+	SuggestedWindow RenewalWindow
+
+	// ExplanationURL optionally locates a page explaining why the
+	// suggested window is what it is, for example after an incident
+	// requiring early renewal.
+	ExplanationURL string
+
+	// RetryAfter is the time after which the renewal information
+	// should be fetched again, as indicated by the CA's Retry-After
+	// header. It is zero if the CA did not provide one.
+	RetryAfter time.Time
+}
+
+// RenewalWindow is a time window suggested for certificate renewal.
+type RenewalWindow struct {
+	Start time.Time
+	End   time.Time
 }
 
 // Order represents a client's request for a certificate.
@@ -337,6 +458,10 @@ type Order struct {
 	// NotAfter is the requested value of the notAfter field in the certificate.
 	NotAfter time.Time
 
+	// Profile is the name of the certificate profile of the order, if the
+	// CA offers profiles. See WithOrderProfile.
+	Profile string
+
 	// AuthzURLs represents authorizations to complete before a certificate
 	// for identifiers specified in the order can be issued.
 	// It also contains unexpired authorizations that the client has completed
@@ -378,6 +503,13 @@ func WithOrderNotAfter(t time.Time) OrderOption {
 	return orderNotAfterOpt(t)
 }
 
+// WithOrderProfile requests a certificate of the named profile, which must
+// be one of the Directory.Profiles of the CA. Profiles select the validity
+// period and extensions of the certificate, among others.
+func WithOrderProfile(name string) OrderOption {
+	return orderProfileOpt(name)
+}
+
 type orderNotBeforeOpt time.Time
 
 func (orderNotBeforeOpt) privateOrderOpt() {}
@@ -386,6 +518,10 @@ type orderNotAfterOpt time.Time
 
 func (orderNotAfterOpt) privateOrderOpt() {}
 
+type orderProfileOpt string
+
+func (orderProfileOpt) privateOrderOpt() {}
+
 // Authorization encodes an authorization response.
 type Authorization struct {
 	// URI uniquely identifies a authorization.
@@ -5,13 +5,37 @@
 package acme
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"testing"
 	"time"
 )
 
+func TestNewExternalAccountBinding(t *testing.T) {
+	for _, key := range []string{"c2VjcmV0LWtleS0x", "c2VjcmV0LWtleQ", "c2VjcmV0LWtleQ=="} {
+		eab, err := NewExternalAccountBinding("kid-1", key)
+		if err != nil {
+			t.Errorf("NewExternalAccountBinding(%q): %v", key, err)
+			continue
+		}
+		if eab.KID != "kid-1" || !bytes.HasPrefix(eab.Key, []byte("secret-key")) {
+			t.Errorf("NewExternalAccountBinding(%q) = %v with key %q", key, eab, eab.Key)
+		}
+	}
+	for _, tt := range []struct{ kid, key string }{
+		{"kid-1", "not+base64url"},
+		{"kid-1", ""},
+		{"", "c2VjcmV0"},
+	} {
+		if _, err := NewExternalAccountBinding(tt.kid, tt.key); err == nil {
+			t.Errorf("NewExternalAccountBinding(%q, %q) succeeded", tt.kid, tt.key)
+		}
+	}
+}
+
 func TestExternalAccountBindingString(t *testing.T) {
 	eab := ExternalAccountBinding{
 		KID: "kid",
@@ -75,6 +99,36 @@ func TestRateLimit(t *testing.T) {
 	}
 }
 
+func TestErrorIs(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "30")
+	for _, tt := range []struct {
+		err    error
+		target error
+		want   bool
+	}{
+		{&Error{ProblemType: "urn:ietf:params:acme:error:badNonce"}, ErrBadNonce, true},
+		{&Error{ProblemType: "urn:acme:error:badnonce"}, ErrBadNonce, true},
+		{&Error{ProblemType: "urn:ietf:params:acme:error:badNonce"}, ErrRateLimited, false},
+		{&Error{ProblemType: "urn:ietf:params:acme:error:rateLimited", Header: h}, ErrRateLimited, true},
+		{fmt.Errorf("wrapped: %w", &Error{ProblemType: "urn:ietf:params:acme:error:orderNotReady"}), ErrOrderNotReady, true},
+		{&Error{ProblemType: "orderNotReady"}, ErrOrderNotReady, false},
+		{errors.New("badNonce"), ErrBadNonce, false},
+	} {
+		if got := errors.Is(tt.err, tt.target); got != tt.want {
+			t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+		}
+	}
+
+	e := &Error{ProblemType: "urn:ietf:params:acme:error:rateLimited", Header: h}
+	if d := e.RetryAfter(); d != 30*time.Second {
+		t.Errorf("RetryAfter() = %v, want 30s", d)
+	}
+	if d, ok := RateLimit(fmt.Errorf("wrapped: %w", e)); !ok || d != 30*time.Second {
+		t.Errorf("RateLimit of a wrapped error = %v, %v, want 30s, true", d, ok)
+	}
+}
+
 func TestAuthorizationError(t *testing.T) {
 	tests := []struct {
 		desc string
@@ -217,3 +271,12 @@ func TestErrorStringerWithSubproblems(t *testing.T) {
 		t.Errorf("Unexpected error string: wanted %q, got %q", expectedStr, err.Error())
 	}
 }
+
+func TestCRLReasonCodeString(t *testing.T) {
+	if s := CRLReasonKeyCompromise.String(); s != "keyCompromise" {
+		t.Errorf("CRLReasonKeyCompromise.String() = %q", s)
+	}
+	if s := CRLReasonCode(7).String(); s != "CRLReasonCode(7)" {
+		t.Errorf("CRLReasonCode(7).String() = %q", s)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// zeroSSLEABURL is the ZeroSSL API endpoint returning new external account
+// binding credentials for an email address. It is a variable for testing.
+var zeroSSLEABURL = "https://api.zerossl.com/acme/eab-credentials-email"
+
+// ZeroSSLExternalAccountBinding requests new external account binding
+// credentials from ZeroSSL for the given email address, creating a ZeroSSL
+// account for it if needed. The credentials can be used to register an
+// account with the ZeroSSLURL directory.
+//
+// If hc is nil, http.DefaultClient is used.
+func ZeroSSLExternalAccountBinding(ctx context.Context, hc *http.Client, email string) (*ExternalAccountBinding, error) {
+	if email == "" {
+		return nil, errors.New("acme: ZeroSSL external account binding requires an email address")
+	}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	form := url.Values{"email": {email}}
+	req, err := http.NewRequestWithContext(ctx, "POST", zeroSSLEABURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var v struct {
+		Success bool   `json:"success"`
+		KID     string `json:"eab_kid"`
+		HMACKey string `json:"eab_hmac_key"`
+		Error   struct {
+			Code int    `json:"code"`
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&v); err != nil {
+		return nil, fmt.Errorf("acme: invalid ZeroSSL response (HTTP status %s): %v", res.Status, err)
+	}
+	if res.StatusCode != http.StatusOK || !v.Success {
+		return nil, fmt.Errorf("acme: ZeroSSL external account binding request failed (HTTP status %s): %d %s", res.Status, v.Error.Code, v.Error.Type)
+	}
+	return NewExternalAccountBinding(v.KID, v.HMACKey)
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestZeroSSLExternalAccountBinding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("r.Method = %q; want POST", r.Method)
+		}
+		switch email := r.PostFormValue("email"); email {
+		case "user@example.org":
+			fmt.Fprint(w, `{"success": true, "eab_kid": "kid-1", "eab_hmac_key": "c2VjcmV0"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success": false, "error": {"code": 2901, "type": "invalid_email"}}`)
+		}
+	}))
+	defer ts.Close()
+	defer func(u string) { zeroSSLEABURL = u }(zeroSSLEABURL)
+	zeroSSLEABURL = ts.URL
+
+	eab, err := ZeroSSLExternalAccountBinding(context.Background(), ts.Client(), "user@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eab.KID != "kid-1" || string(eab.Key) != "secret" {
+		t.Errorf("got KID %q and key %q", eab.KID, eab.Key)
+	}
+
+	if _, err := ZeroSSLExternalAccountBinding(context.Background(), nil, "invalid"); err == nil {
+		t.Error("ZeroSSLExternalAccountBinding succeeded for an invalid email")
+	}
+	if _, err := ZeroSSLExternalAccountBinding(context.Background(), nil, ""); err == nil {
+		t.Error("ZeroSSLExternalAccountBinding succeeded without an email")
+	}
+}
@@ -35,8 +35,10 @@
 package argon2
 
 import (
+	"context"
 	"encoding/binary"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gitpod-io/golang-crypto/blake2b"
 )
@@ -97,7 +99,28 @@ func IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uin
 	return deriveKey(argon2id, password, salt, nil, nil, time, memory, threads, keyLen)
 }
 
+// KeyContext is like Key, but it returns ctx.Err() if ctx is done before
+// the key is derived. Cancellation is checked periodically while memory is
+// filled, so it takes effect well before the whole computation would end.
+func KeyContext(ctx context.Context, password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	return deriveKeyContext(ctx, argon2i, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// IDKeyContext is like IDKey, but it returns ctx.Err() if ctx is done before
+// the key is derived. Cancellation is checked periodically while memory is
+// filled, so it takes effect well before the whole computation would end.
+func IDKeyContext(ctx context.Context, password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	return deriveKeyContext(ctx, argon2id, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
 func deriveKey(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	key, _ := deriveKeyContext(context.Background(), mode, password, salt, secret, data, time, memory, threads, keyLen)
+	return key
+}
+
+// deriveKeyContext is like deriveKey, but stops and returns ctx.Err() if
+// ctx is done before the key is derived.
+func deriveKeyContext(ctx context.Context, mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
 	if time < 1 {
 		panic("argon2: number of rounds too small")
 	}
@@ -110,14 +133,23 @@ func deriveKey(mode int, password, salt, secret, data []byte, time, memory uint3
 	if memory < 2*syncPoints*uint32(threads) {
 		memory = 2 * syncPoints * uint32(threads)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	B := initBlocks(&h0, memory, uint32(threads))
-	processBlocks(B, time, memory, uint32(threads), mode)
-	return extractKey(B, memory, uint32(threads), keyLen)
+	if !processBlocks(ctx.Done(), B, time, memory, uint32(threads), mode) {
+		return nil, ctx.Err()
+	}
+	return extractKey(B, memory, uint32(threads), keyLen), nil
 }
 
 const (
 	blockLength = 128
 	syncPoints  = 4
+
+	// cancelCheckInterval is the number of blocks, 1 MiB of memory, processed
+	// between checks for cancellation.
+	cancelCheckInterval = 1024
 )
 
 type block [blockLength]uint64
@@ -175,11 +207,16 @@ func initBlocks(h0 *[blake2b.Size + 8]byte, memory, threads uint32) []block {
 	return B
 }
 
-func processBlocks(B []block, time, memory, threads uint32, mode int) {
+// processBlocks fills B, and reports whether it completed before done was
+// closed. It is checked at each synchronization point, and every
+// cancelCheckInterval blocks within a segment.
+func processBlocks(done <-chan struct{}, B []block, time, memory, threads uint32, mode int) bool {
 	lanes := memory / threads
 	segments := lanes / syncPoints
 
+	var canceled atomic.Bool
 	processSegment := func(n, slice, lane uint32, wg *sync.WaitGroup) {
+		defer wg.Done()
 		var addresses, in, zero block
 		if mode == argon2i || (mode == argon2id && n == 0 && slice < syncPoints/2) {
 			in[0] = uint64(n)
@@ -203,6 +240,14 @@ func processBlocks(B []block, time, memory, threads uint32, mode int) {
 		offset := lane*lanes + slice*segments + index
 		var random uint64
 		for index < segments {
+			if index%cancelCheckInterval == 0 && done != nil {
+				select {
+				case <-done:
+					canceled.Store(true)
+					return
+				default:
+				}
+			}
 			prev := offset - 1
 			if index == 0 && slice == 0 {
 				prev += lanes // last block in lane
@@ -221,7 +266,6 @@ func processBlocks(B []block, time, memory, threads uint32, mode int) {
 			processBlockXOR(&B[offset], &B[prev], &B[newOffset])
 			index, offset = index+1, offset+1
 		}
-		wg.Done()
 	}
 
 	for n := uint32(0); n < time; n++ {
@@ -232,9 +276,12 @@ func processBlocks(B []block, time, memory, threads uint32, mode int) {
 				go processSegment(n, slice, lane, &wg)
 			}
 			wg.Wait()
+			if canceled.Load() {
+				return false
+			}
 		}
 	}
-
+	return true
 }
 
 func extractKey(B []block, memory, threads, keyLen uint32) []byte {
@@ -6,8 +6,10 @@ package argon2
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"testing"
+	"time"
 )
 
 var (
@@ -91,6 +93,80 @@ func TestVectors(t *testing.T) {
 	}
 }
 
+func TestKeyContext(t *testing.T) {
+	password, salt := []byte("password"), []byte("somesalt")
+	key, err := IDKeyContext(context.Background(), password, salt, 2, 64, 2, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := IDKey(password, salt, 2, 64, 2, 32); !bytes.Equal(key, want) {
+		t.Errorf("IDKeyContext = %x, want %x", key, want)
+	}
+	key, err = KeyContext(context.Background(), password, salt, 2, 64, 2, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := Key(password, salt, 2, 64, 2, 32); !bytes.Equal(key, want) {
+		t.Errorf("KeyContext = %x, want %x", key, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := IDKeyContext(ctx, password, salt, 1, 64, 1, 32); err != context.Canceled {
+		t.Errorf("IDKeyContext with a canceled context: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestKeyContextCancelMidway(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// This takes many seconds to complete.
+	_, err := IDKeyContext(ctx, []byte("password"), []byte("somesalt"), 1000, 64*1024, 1, 32)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("cancellation took %v", d)
+	}
+}
+
+func TestPool(t *testing.T) {
+	p := NewPool(1)
+	password, salt := []byte("password"), []byte("somesalt")
+	key, err := p.IDKey(context.Background(), password, salt, 1, 64, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := IDKey(password, salt, 1, 64, 1, 32); !bytes.Equal(key, want) {
+		t.Errorf("Pool.IDKey = %x, want %x", key, want)
+	}
+
+	// Occupy the only slot, and check that another derivation gives up
+	// waiting for it.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := p.Key(ctx, password, salt, 1000, 64*1024, 1, 32)
+		done <- err
+	}()
+	for len(p.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	if _, err := p.IDKey(waitCtx, password, salt, 1, 64, 1, 32); err != context.DeadlineExceeded {
+		t.Errorf("got %v while the pool was full, want %v", err, context.DeadlineExceeded)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if _, err := p.IDKey(context.Background(), password, salt, 1, 64, 1, 32); err != nil {
+		t.Errorf("slot was not released: %v", err)
+	}
+}
+
 func benchmarkArgon2(mode int, time, memory uint32, threads uint8, keyLen uint32, b *testing.B) {
 	password := []byte("password")
 	salt := []byte("choosing random salts is hard")
@@ -0,0 +1,49 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import "context"
+
+// A Pool limits the number of key derivations that run at the same time, so
+// that a burst of requests, such as many concurrent logins, queues up
+// instead of exhausting memory and CPU. Each derivation holds its full
+// memory cost until it completes, so the peak memory use of a Pool is about
+// its size times the memory parameter.
+//
+// A Pool is safe for concurrent use by multiple goroutines.
+type Pool struct {
+	slots chan struct{}
+}
+
+// NewPool returns a Pool that runs at most size key derivations at a time.
+// It panics if size is less than one.
+func NewPool(size int) *Pool {
+	if size < 1 {
+		panic("argon2: pool size too small")
+	}
+	return &Pool{slots: make(chan struct{}, size)}
+}
+
+// Key is like KeyContext, but first waits for the Pool to have room. If ctx
+// is done while waiting, it returns ctx.Err() without deriving the key.
+func (p *Pool) Key(ctx context.Context, password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	return p.derive(ctx, argon2i, password, salt, time, memory, threads, keyLen)
+}
+
+// IDKey is like IDKeyContext, but first waits for the Pool to have room. If
+// ctx is done while waiting, it returns ctx.Err() without deriving the key.
+func (p *Pool) IDKey(ctx context.Context, password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	return p.derive(ctx, argon2id, password, salt, time, memory, threads, keyLen)
+}
+
+func (p *Pool) derive(ctx context.Context, mode int, password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.slots }()
+	return deriveKeyContext(ctx, mode, password, salt, nil, nil, time, memory, threads, keyLen)
+}
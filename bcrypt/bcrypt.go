@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/gitpod-io/golang-crypto/blowfish"
 )
@@ -110,20 +111,111 @@ func CompareHashAndPassword(hashedPassword, password []byte) error {
 	if err != nil {
 		return err
 	}
+	return p.compare(password)
+}
 
-	otherHash, err := bcrypt(password, p.cost, p.salt)
+// CompareAndUpgrade compares a bcrypt hashed password with its possible
+// plaintext equivalent, like CompareHashAndPassword. If they match and
+// hashedPassword was created with a cost lower than the given cost, it also
+// returns the hash of the password at that cost, which should replace
+// hashedPassword in storage. Otherwise the returned hash is nil. This allows
+// migrating users to a higher cost as they log in.
+//
+// If the cost given is less than MinCost, the cost will be set to
+// DefaultCost, instead. Passwords longer than 72 bytes, which
+// GenerateFromPassword does not accept, are never upgraded.
+func CompareAndUpgrade(hashedPassword, password []byte, cost int) ([]byte, error) {
+	if cost < MinCost {
+		cost = DefaultCost
+	}
+	if err := checkCost(cost); err != nil {
+		return nil, err
+	}
+	p, err := newFromHash(hashedPassword)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	if err := p.compare(password); err != nil {
+		return nil, err
+	}
+	if p.cost >= cost || len(password) > 72 {
+		return nil, nil
+	}
+	return GenerateFromPassword(password, cost)
+}
 
-	otherP := &hashed{otherHash, p.salt, p.cost, p.major, p.minor}
-	if subtle.ConstantTimeCompare(p.Hash(), otherP.Hash()) == 1 {
-		return nil
+// CompareHashesAndPassword compares password with each of the bcrypt hashed
+// passwords, and returns the index of the first one that it matches, or
+// ErrMismatchedHashAndPassword if it matches none. All hashes are computed
+// and compared, so the time it takes doesn't reveal which hash matched.
+func CompareHashesAndPassword(hashedPasswords [][]byte, password []byte) (int, error) {
+	ps := make([]*hashed, len(hashedPasswords))
+	for i, hashedPassword := range hashedPasswords {
+		p, err := newFromHash(hashedPassword)
+		if err != nil {
+			return -1, err
+		}
+		ps[i] = p
+	}
+
+	match := -1
+	for i, p := range ps {
+		ok, err := p.equal(password)
+		if err != nil {
+			return -1, err
+		}
+		// Select the first match without branching on the comparisons.
+		first := subtle.ConstantTimeEq(int32(match), -1) & ok
+		match = subtle.ConstantTimeSelect(first, i, match)
 	}
+	if match < 0 {
+		return -1, ErrMismatchedHashAndPassword
+	}
+	return match, nil
+}
 
+// compare returns nil if password hashes to p, and
+// ErrMismatchedHashAndPassword otherwise.
+func (p *hashed) compare(password []byte) error {
+	ok, err := p.equal(password)
+	if err != nil {
+		return err
+	}
+	if ok == 1 {
+		return nil
+	}
 	return ErrMismatchedHashAndPassword
 }
 
+// equal returns 1 if password hashes to p and 0 otherwise, in constant time.
+func (p *hashed) equal(password []byte) (int, error) {
+	otherHash, err := bcrypt(password, p.cost, p.salt)
+	if err != nil {
+		return 0, err
+	}
+
+	otherP := &hashed{otherHash, p.salt, p.cost, p.major, p.minor}
+	return subtle.ConstantTimeCompare(p.Hash(), otherP.Hash()), nil
+}
+
+// limiter, if not nil, points to a semaphore that caps the number of bcrypt
+// computations running at once.
+var limiter atomic.Pointer[chan struct{}]
+
+// SetConcurrencyLimit caps the number of bcrypt computations that the
+// functions of this package run at once to n, across all goroutines. Calls
+// over the limit wait for a running computation to finish. This bounds the
+// CPU time that concurrent logins can make a service spend on hashing. A
+// limit of zero or less, the default, removes the cap.
+func SetConcurrencyLimit(n int) {
+	if n <= 0 {
+		limiter.Store(nil)
+		return
+	}
+	sem := make(chan struct{}, n)
+	limiter.Store(&sem)
+}
+
 // Cost returns the hashing cost used to create the given hashed
 // password. When, in the future, the hashing cost of a password system needs
 // to be increased in order to adjust for greater computational power, this
@@ -194,6 +286,12 @@ func newFromHash(hashedSecret []byte) (*hashed, error) {
 }
 
 func bcrypt(password []byte, cost int, salt []byte) ([]byte, error) {
+	if sem := limiter.Load(); sem != nil {
+		s := *sem
+		s <- struct{}{}
+		defer func() { <-s }()
+	}
+
 	cipherData := make([]byte, len(magicCipherData))
 	copy(cipherData, magicCipherData)
 
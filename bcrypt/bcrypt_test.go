@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestBcryptingIsEasy(t *testing.T) {
@@ -248,3 +249,76 @@ func TestPasswordTooLong(t *testing.T) {
 		t.Errorf("unexpected error: got %q, want %q", err, ErrPasswordTooLong)
 	}
 }
+
+func TestCompareAndUpgrade(t *testing.T) {
+	pass := []byte("mypassword")
+	hp, err := GenerateFromPassword(pass, MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword error: %s", err)
+	}
+
+	upgraded, err := CompareAndUpgrade(hp, pass, MinCost+1)
+	if err != nil {
+		t.Fatalf("CompareAndUpgrade error: %s", err)
+	}
+	if cost, err := Cost(upgraded); err != nil || cost != MinCost+1 {
+		t.Fatalf("upgraded hash has cost %d, %v; want %d", cost, err, MinCost+1)
+	}
+	if err := CompareHashAndPassword(upgraded, pass); err != nil {
+		t.Errorf("upgraded hash doesn't match the password: %s", err)
+	}
+
+	if h, err := CompareAndUpgrade(upgraded, pass, MinCost); err != nil || h != nil {
+		t.Errorf("CompareAndUpgrade at a lower cost = %q, %v; want nil, nil", h, err)
+	}
+	if h, err := CompareAndUpgrade(hp, []byte("notmypassword"), MinCost+1); err != ErrMismatchedHashAndPassword || h != nil {
+		t.Errorf("CompareAndUpgrade with the wrong password = %q, %v; want nil, %v", h, err, ErrMismatchedHashAndPassword)
+	}
+	if _, err := CompareAndUpgrade(hp, pass, MaxCost+1); err == nil {
+		t.Error("CompareAndUpgrade accepted an invalid cost")
+	}
+}
+
+func TestCompareHashesAndPassword(t *testing.T) {
+	pass := []byte("mypassword")
+	var hashes [][]byte
+	for _, p := range []string{"other", "mypassword", "mypassword"} {
+		hp, err := GenerateFromPassword([]byte(p), MinCost)
+		if err != nil {
+			t.Fatalf("GenerateFromPassword error: %s", err)
+		}
+		hashes = append(hashes, hp)
+	}
+
+	if i, err := CompareHashesAndPassword(hashes, pass); err != nil || i != 1 {
+		t.Errorf("CompareHashesAndPassword = %d, %v; want 1, nil", i, err)
+	}
+	if i, err := CompareHashesAndPassword(hashes[:1], pass); err != ErrMismatchedHashAndPassword || i != -1 {
+		t.Errorf("CompareHashesAndPassword without a match = %d, %v; want -1, %v", i, err, ErrMismatchedHashAndPassword)
+	}
+	if _, err := CompareHashesAndPassword(append(hashes, []byte("$2a$10$fooo")), pass); err != ErrHashTooShort {
+		t.Errorf("CompareHashesAndPassword with a short hash: got %v, want %v", err, ErrHashTooShort)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	SetConcurrencyLimit(1)
+	defer SetConcurrencyLimit(0)
+
+	sem := *limiter.Load()
+	sem <- struct{}{}
+	done := make(chan error)
+	go func() {
+		_, err := GenerateFromPassword([]byte("mypassword"), MinCost)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("GenerateFromPassword ran over the concurrency limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-sem
+	if err := <-done; err != nil {
+		t.Fatalf("GenerateFromPassword error: %s", err)
+	}
+}
@@ -16,6 +16,10 @@
 //
 // BLAKE2X is a construction to compute hash values larger than 64 bytes. It
 // can produce hash values between 0 and 4 GiB.
+//
+// NewTree computes a node of a BLAKE2b hash tree with arbitrary tree
+// parameters, and NewBP and SumBP512 implement BLAKE2bp, which hashes large
+// inputs across four parallel leaves.
 package blake2b
 
 import (
@@ -152,6 +156,11 @@ type digest struct {
 
 	key    [BlockSize]byte
 	keyLen int
+
+	// param holds the first three words of the parameter block of tree
+	// nodes, and is all zero for sequential hashing.
+	param    [3]uint64
+	lastNode bool
 }
 
 const (
@@ -163,6 +172,9 @@ func (d *digest) MarshalBinary() ([]byte, error) {
 	if d.keyLen != 0 {
 		return nil, errors.New("crypto/blake2b: cannot marshal MACs")
 	}
+	if d.param[0] != 0 {
+		return nil, errors.New("crypto/blake2b: cannot marshal tree hashes")
+	}
 	b := make([]byte, 0, marshaledSize)
 	b = append(b, magic...)
 	for i := 0; i < 8; i++ {
@@ -204,7 +216,13 @@ func (d *digest) Size() int { return d.size }
 
 func (d *digest) Reset() {
 	d.h = iv
-	d.h[0] ^= uint64(d.size) | (uint64(d.keyLen) << 8) | (1 << 16) | (1 << 24)
+	if d.param[0] != 0 {
+		for i, p := range d.param {
+			d.h[i] ^= p
+		}
+	} else {
+		d.h[0] ^= uint64(d.size) | (uint64(d.keyLen) << 8) | (1 << 16) | (1 << 24)
+	}
 	d.offset, d.c[0], d.c[1] = 0, 0, 0
 	if d.keyLen > 0 {
 		d.block = d.key
@@ -261,7 +279,11 @@ func (d *digest) finalize(hash *[Size]byte) {
 	c[0] -= remaining
 
 	h := d.h
-	hashBlocks(&h, &c, 0xFFFFFFFFFFFFFFFF, block[:])
+	if d.lastNode {
+		hashBlocksGenericLastNode(&h, &c, 0xFFFFFFFFFFFFFFFF, 0xFFFFFFFFFFFFFFFF, block[:])
+	} else {
+		hashBlocks(&h, &c, 0xFFFFFFFFFFFFFFFF, block[:])
+	}
 
 	for i, v := range h {
 		binary.LittleEndian.PutUint64(hash[8*i:], v)
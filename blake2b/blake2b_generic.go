@@ -28,6 +28,12 @@ var precomputed = [12][16]byte{
 }
 
 func hashBlocksGeneric(h *[8]uint64, c *[2]uint64, flag uint64, blocks []byte) {
+	hashBlocksGenericLastNode(h, c, flag, 0, blocks)
+}
+
+// hashBlocksGenericLastNode is hashBlocksGeneric with a second finalization
+// flag, which is set for the last node of a hash tree level.
+func hashBlocksGenericLastNode(h *[8]uint64, c *[2]uint64, flag, lastNode uint64, blocks []byte) {
 	var m [16]uint64
 	c0, c1 := c[0], c[1]
 
@@ -42,6 +48,7 @@ func hashBlocksGeneric(h *[8]uint64, c *[2]uint64, flag uint64, blocks []byte) {
 		v12 ^= c0
 		v13 ^= c1
 		v14 ^= flag
+		v15 ^= lastNode
 
 		for j := range m {
 			m[j] = binary.LittleEndian.Uint64(blocks[i:])
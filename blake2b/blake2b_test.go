@@ -302,6 +302,99 @@ func TestSelfTest(t *testing.T) {
 
 // Benchmarks
 
+func TestTree(t *testing.T) {
+	msg := make([]byte, 300)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	tests := []struct {
+		size int
+		key  string
+		p    TreeParams
+		want string
+	}{
+		{32, "key", TreeParams{Fanout: 2, Depth: 3, LeafSize: 4096, NodeOffset: 5, NodeDepth: 1, InnerSize: 32, LastNode: true},
+			"a4033836c53167e05e3993d8bbd10b4270c99b2b2ae42a11a62e6fc548be421c"},
+		{64, "", TreeParams{Depth: 255, NodeOffset: 1 << 40},
+			"42805b6cf3d7441de1b16ad9641e391cb2329269e29cfa022bc8a5e15effbfc15425b6aea6a8d4d97c40508251fb8acdcdabc2b4945c9a1fbce5443455be5b59"},
+	}
+	for i, tt := range tests {
+		h, err := NewTree(tt.size, []byte(tt.key), &tt.p)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		h.Write(msg[:100])
+		h.Write(msg[100:])
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: got %s, want %s", i, sum, tt.want)
+		}
+		h.Reset()
+		h.Write(msg)
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: after Reset got %s, want %s", i, sum, tt.want)
+		}
+	}
+
+	if _, err := NewTree(64, nil, &TreeParams{}); err == nil {
+		t.Error("NewTree accepted a zero depth")
+	}
+	if _, err := NewTree(64, nil, &TreeParams{Depth: 1, InnerSize: Size + 1}); err == nil {
+		t.Error("NewTree accepted an oversized inner hash size")
+	}
+}
+
+func TestBP(t *testing.T) {
+	msg := make([]byte, 40000)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	key := msg[:Size]
+	tests := []struct {
+		size, length int
+		key          []byte
+		want         string
+	}{
+		// From blake2bp-kat.txt in the BLAKE2 reference implementation.
+		{64, 0, key, "9d9461073e4eb640a255357b839f394b838c6ff57c9b686a3f76107c1066728f3c9956bd785cbc3bf79dc2ab578c5a0c063b9d9c405848de1dbe821cd05c940a"},
+		{64, 1, key, "ff8e90a37b94623932c59f7559f26035029c376732cb14d41602001cbb73adb79293a2dbda5f60703025144d158e2735529596251c73c0345ca6fccb1fb1e97e"},
+		{64, 255, key, "96fbcbb60bd313b8845033e5bc058a38027438572d7e7957f3684f6268aadd3ad08d21767ed6878685331ba98571487e12470aad669326716e46667f69f8d7e8"},
+
+		{64, 0, nil, "b5ef811a8038f70b628fa8b294daae7492b1ebe343a80eaabbf1f6ae664dd67b9d90b0120791eab81dc96985f28849f6a305186a85501b405114bfa678df9380"},
+		{64, 1000, nil, "1ce5b8d6f6fcc89fcb6ed29f12796cc210a03f4763e528cb2c0e1b4b1255d6ae86c79332529f6368d0bcfe9d316a5f999a53af47a8f0ec4412ce19156bbafd04"},
+		{64, 40000, nil, "96677ff8f53b80a3fc1920e31b4fa2bb798fbcad1d64d8e303805a70caac4bb3eeb42845dd8cb400a92533e08ab7416096772daa634929f6e97c8ed68928a6a9"},
+		{32, 40000, nil, "e31675ec8e1a593be8420aac06dc3777e037d259452b6e0d376617fe1b2a5860"},
+	}
+	for i, tt := range tests {
+		h, err := NewBP(tt.size, tt.key)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		h.Write(msg[:tt.length])
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: got %s, want %s", i, sum, tt.want)
+		}
+
+		// Write the same message in uneven pieces.
+		h.Reset()
+		for p := msg[:tt.length]; len(p) > 0; {
+			n := 1 + len(p)%700
+			if n > len(p) {
+				n = len(p)
+			}
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: got %s with uneven writes, want %s", i, sum, tt.want)
+		}
+	}
+
+	sum := SumBP512(msg)
+	if got, want := fmt.Sprintf("%x", sum), tests[5].want; got != want {
+		t.Errorf("SumBP512 = %s, want %s", got, want)
+	}
+}
+
 func benchmarkSum(b *testing.B, size int) {
 	data := make([]byte, size)
 	b.SetBytes(int64(size))
@@ -327,6 +420,14 @@ func BenchmarkWrite1K(b *testing.B)  { benchmarkWrite(b, 1024) }
 func BenchmarkSum128(b *testing.B) { benchmarkSum(b, 128) }
 func BenchmarkSum1K(b *testing.B)  { benchmarkSum(b, 1024) }
 
+func BenchmarkBP1M(b *testing.B) {
+	data := make([]byte, 1<<20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		SumBP512(data)
+	}
+}
+
 // These values were taken from https://blake2.net/blake2b-test.txt.
 var hashes = []string{
 	"10ebb67700b1868efb4417987acf4690ae9d972fb7a590c2f02871799aaa4786b5e996e8f0f4eb981fc214b005f42d2ff4233499391653df7aefcbc13fc51568",
@@ -0,0 +1,70 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blake2b
+
+import (
+	"errors"
+	"hash"
+)
+
+// TreeParams holds the tree hashing fields of the BLAKE2b parameter block,
+// as described in section 2.10 of the BLAKE2 specification. They let a hash
+// compute one node of a hash tree, which interoperates with other BLAKE2
+// tree hashing implementations using the same parameters.
+type TreeParams struct {
+	// Fanout is the maximal number of children of a node, or zero for
+	// unlimited.
+	Fanout uint8
+
+	// Depth is the maximal depth of the tree, between 1 and 255, or 255 for
+	// unlimited.
+	Depth uint8
+
+	// LeafSize is the maximal byte length of a leaf, or zero for unlimited.
+	LeafSize uint32
+
+	// NodeOffset is the offset of the node within its level, starting at
+	// zero for the leftmost node.
+	NodeOffset uint64
+
+	// NodeDepth is the depth of the node, zero for leaves.
+	NodeDepth uint8
+
+	// InnerSize is the digest size of the inner nodes, between 0 and 64.
+	InnerSize uint8
+
+	// LastNode marks the last, rightmost, node of a level.
+	LastNode bool
+}
+
+// words returns the first three words of the parameter block.
+func (p *TreeParams) words(size, keyLen int) [3]uint64 {
+	return [3]uint64{
+		uint64(size) | uint64(keyLen)<<8 | uint64(p.Fanout)<<16 | uint64(p.Depth)<<24 | uint64(p.LeafSize)<<32,
+		p.NodeOffset,
+		uint64(p.NodeDepth) | uint64(p.InnerSize)<<8,
+	}
+}
+
+// NewTree returns a new hash.Hash computing the BLAKE2b checksum of a node
+// of a hash tree described by p. The hash size and the key are as for New.
+//
+// The returned hash.Hash does not implement BinaryMarshaler.
+func NewTree(size int, key []byte, p *TreeParams) (hash.Hash, error) {
+	if p.Depth == 0 {
+		return nil, errors.New("blake2b: invalid tree depth")
+	}
+	if p.InnerSize > Size {
+		return nil, errors.New("blake2b: invalid inner hash size")
+	}
+	d, err := newDigest(size, key)
+	if err != nil {
+		return nil, err
+	}
+	d.param = p.words(size, len(key))
+	d.lastNode = p.LastNode
+	d.Reset()
+	return d, nil
+}
@@ -16,6 +16,10 @@
 //
 // BLAKE2X is a construction to compute hash values larger than 32 bytes. It
 // can produce hash values between 0 and 65535 bytes.
+//
+// NewTree computes a node of a BLAKE2s hash tree with arbitrary tree
+// parameters, and NewSP and SumSP256 implement BLAKE2sp, which hashes large
+// inputs across eight parallel leaves.
 package blake2s
 
 import (
@@ -36,7 +40,10 @@ const (
 	Size128 = 16
 )
 
-var errKeySize = errors.New("blake2s: invalid key size")
+var (
+	errKeySize  = errors.New("blake2s: invalid key size")
+	errHashSize = errors.New("blake2s: invalid hash size")
+)
 
 var iv = [8]uint32{
 	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
@@ -74,7 +81,20 @@ func New128(key []byte) (hash.Hash, error) {
 	return newDigest(Size128, key)
 }
 
+// New returns a new hash.Hash computing the BLAKE2s checksum with a custom
+// length. A non-nil key turns the hash into a MAC. The key must be between
+// zero and 32 bytes long. The hash size can be a value between 1 and 32 but
+// it is highly recommended to use values equal or greater than:
+// - 32 if BLAKE2s is used as a hash function (The key is zero bytes long).
+// - 16 if BLAKE2s is used as a MAC function (The key is at least 16 bytes long).
+// When the key is nil, the returned hash.Hash implements BinaryMarshaler
+// and BinaryUnmarshaler for state (de)serialization as documented by hash.Hash.
+func New(size int, key []byte) (hash.Hash, error) { return newDigest(size, key) }
+
 func newDigest(hashSize int, key []byte) (*digest, error) {
+	if hashSize < 1 || hashSize > Size {
+		return nil, errHashSize
+	}
 	if len(key) > Size {
 		return nil, errKeySize
 	}
@@ -130,6 +150,11 @@ type digest struct {
 
 	key    [BlockSize]byte
 	keyLen int
+
+	// param holds the first four words of the parameter block of tree
+	// nodes, and is all zero for sequential hashing.
+	param    [4]uint32
+	lastNode bool
 }
 
 const (
@@ -141,6 +166,9 @@ func (d *digest) MarshalBinary() ([]byte, error) {
 	if d.keyLen != 0 {
 		return nil, errors.New("crypto/blake2s: cannot marshal MACs")
 	}
+	if d.param[0] != 0 {
+		return nil, errors.New("crypto/blake2s: cannot marshal tree hashes")
+	}
 	b := make([]byte, 0, marshaledSize)
 	b = append(b, magic...)
 	for i := 0; i < 8; i++ {
@@ -182,7 +210,13 @@ func (d *digest) Size() int { return d.size }
 
 func (d *digest) Reset() {
 	d.h = iv
-	d.h[0] ^= uint32(d.size) | (uint32(d.keyLen) << 8) | (1 << 16) | (1 << 24)
+	if d.param[0] != 0 {
+		for i, p := range d.param {
+			d.h[i] ^= p
+		}
+	} else {
+		d.h[0] ^= uint32(d.size) | (uint32(d.keyLen) << 8) | (1 << 16) | (1 << 24)
+	}
 	d.offset, d.c[0], d.c[1] = 0, 0, 0
 	if d.keyLen > 0 {
 		d.block = d.key
@@ -236,7 +270,11 @@ func (d *digest) finalize(hash *[Size]byte) {
 	}
 	c[0] -= remaining
 
-	hashBlocks(&h, &c, 0xFFFFFFFF, block[:])
+	if d.lastNode {
+		hashBlocksGenericLastNode(&h, &c, 0xFFFFFFFF, 0xFFFFFFFF, block[:])
+	} else {
+		hashBlocks(&h, &c, 0xFFFFFFFF, block[:])
+	}
 	for i, v := range h {
 		binary.LittleEndian.PutUint32(hash[4*i:], v)
 	}
@@ -25,6 +25,12 @@ var precomputed = [10][16]byte{
 }
 
 func hashBlocksGeneric(h *[8]uint32, c *[2]uint32, flag uint32, blocks []byte) {
+	hashBlocksGenericLastNode(h, c, flag, 0, blocks)
+}
+
+// hashBlocksGenericLastNode is hashBlocksGeneric with a second finalization
+// flag, which is set for the last node of a hash tree level.
+func hashBlocksGenericLastNode(h *[8]uint32, c *[2]uint32, flag, lastNode uint32, blocks []byte) {
 	var m [16]uint32
 	c0, c1 := c[0], c[1]
 
@@ -39,6 +45,7 @@ func hashBlocksGeneric(h *[8]uint32, c *[2]uint32, flag uint32, blocks []byte) {
 		v12 ^= c0
 		v13 ^= c1
 		v14 ^= flag
+		v15 ^= lastNode
 
 		for j := range m {
 			m[j] = uint32(blocks[i]) | uint32(blocks[i+1])<<8 | uint32(blocks[i+2])<<16 | uint32(blocks[i+3])<<24
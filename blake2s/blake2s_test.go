@@ -242,8 +242,147 @@ func testHashes2X(t *testing.T) {
 	}
 }
 
+func TestNew(t *testing.T) {
+	tests := []struct {
+		size      int
+		key       string
+		unkeyed   string
+		keyedWith string
+	}{
+		{1, "key", "0d", "87"},
+		{16, "key", "aa4938119b1dc7b87cbad0ffd200d0ae", "94fdf6f35b9999920dcdcaee361ad435"},
+		{20, "key", "5ae3b99be29b01834c3b508521ede60438f8de17", "4ed699f7e71ce74340ba202a9c37c4cf9772aa3a"},
+	}
+	for _, test := range tests {
+		for key, want := range map[string]string{"": test.unkeyed, test.key: test.keyedWith} {
+			var k []byte
+			if key != "" {
+				k = []byte(key)
+			}
+			h, err := New(test.size, k)
+			if err != nil {
+				t.Fatalf("New(%d, %q): %v", test.size, key, err)
+			}
+			if h.Size() != test.size {
+				t.Errorf("New(%d, %q): got size %d", test.size, key, h.Size())
+			}
+			h.Write([]byte("abc"))
+			if got := fmt.Sprintf("%x", h.Sum(nil)); got != want {
+				t.Errorf("New(%d, %q): got %s, want %s", test.size, key, got, want)
+			}
+		}
+	}
+
+	h, _ := New(Size, nil)
+	h.Write([]byte("abc"))
+	if sum := Sum256([]byte("abc")); !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Error("New(Size, nil) doesn't match Sum256")
+	}
+	for _, size := range []int{0, -1, Size + 1} {
+		if _, err := New(size, nil); err == nil {
+			t.Errorf("New(%d, nil) succeeded", size)
+		}
+	}
+}
+
 // Benchmarks
 
+func TestTree(t *testing.T) {
+	msg := make([]byte, 300)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	tests := []struct {
+		size int
+		key  string
+		p    TreeParams
+		want string
+	}{
+		{16, "key", TreeParams{Fanout: 2, Depth: 3, LeafSize: 4096, NodeOffset: 5, NodeDepth: 1, InnerSize: 16, LastNode: true},
+			"a682b4a5e1ffb863e3756da910a52cab"},
+		{32, "", TreeParams{Depth: 255, NodeOffset: 1 << 40},
+			"9bdbfa12b766672c31e7c86e526f6cb5dcc27a854d2a1a0c3b2b46ac130217e2"},
+	}
+	for i, tt := range tests {
+		h, err := NewTree(tt.size, []byte(tt.key), &tt.p)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		h.Write(msg[:100])
+		h.Write(msg[100:])
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: got %s, want %s", i, sum, tt.want)
+		}
+		h.Reset()
+		h.Write(msg)
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: after Reset got %s, want %s", i, sum, tt.want)
+		}
+	}
+
+	if _, err := NewTree(32, nil, &TreeParams{}); err == nil {
+		t.Error("NewTree accepted a zero depth")
+	}
+	if _, err := NewTree(32, nil, &TreeParams{Depth: 1, NodeOffset: 1 << 48}); err == nil {
+		t.Error("NewTree accepted an oversized node offset")
+	}
+	if _, err := NewTree(Size+1, nil, &TreeParams{Depth: 1}); err == nil {
+		t.Error("NewTree accepted an oversized hash size")
+	}
+}
+
+func TestSP(t *testing.T) {
+	msg := make([]byte, 40000)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	key := msg[:Size]
+	tests := []struct {
+		size, length int
+		key          []byte
+		want         string
+	}{
+		// From blake2sp-kat.txt in the BLAKE2 reference implementation.
+		{32, 0, key, "715cb13895aeb678f6124160bff21465b30f4f6874193fc851b4621043f09cc6"},
+		{32, 1, key, "40578ffa52bf51ae1866f4284d3a157fc1bcd36ac13cbdcb0377e4d0cd0b6603"},
+		{32, 255, key, "0c8a36597d7461c63a94732821c941856c668376606c86a52de0ee4104c615db"},
+
+		{32, 0, nil, "dd0e891776933f43c7d032b08a917e25741f8aa9a12c12e1cac8801500f2ca4f"},
+		{32, 1000, nil, "7e2830f74fc7c4d224a201b46f95e37ebbfb56dddc492f8227e4d905201734b8"},
+		{32, 40000, nil, "6ca6ded49ee0dded8a2fc8f733ec577931f4445f9c2429637e6c1031077c89c5"},
+		{16, 40000, nil, "9ac0ab523ec745d569a008f907abbd00"},
+	}
+	for i, tt := range tests {
+		h, err := NewSP(tt.size, tt.key)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		h.Write(msg[:tt.length])
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: got %s, want %s", i, sum, tt.want)
+		}
+
+		// Write the same message in uneven pieces.
+		h.Reset()
+		for p := msg[:tt.length]; len(p) > 0; {
+			n := 1 + len(p)%700
+			if n > len(p) {
+				n = len(p)
+			}
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tt.want {
+			t.Errorf("#%d: got %s with uneven writes, want %s", i, sum, tt.want)
+		}
+	}
+
+	sum := SumSP256(msg)
+	if got, want := fmt.Sprintf("%x", sum), tests[5].want; got != want {
+		t.Errorf("SumSP256 = %s, want %s", got, want)
+	}
+}
+
 func benchmarkSum(b *testing.B, size int) {
 	data := make([]byte, size)
 	b.SetBytes(int64(size))
@@ -269,6 +408,14 @@ func BenchmarkWrite1K(b *testing.B) { benchmarkWrite(b, 1024) }
 func BenchmarkSum64(b *testing.B) { benchmarkSum(b, 64) }
 func BenchmarkSum1K(b *testing.B) { benchmarkSum(b, 1024) }
 
+func BenchmarkSP1M(b *testing.B) {
+	data := make([]byte, 1<<20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		SumSP256(data)
+	}
+}
+
 // hashes is taken from https://blake2.net/blake2s-test.txt
 var hashes = []string{
 	"48a8997da407876b3d79c0d92325ad3b89cbb754d86ab71aee047ad345fd2c49",
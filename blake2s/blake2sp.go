@@ -0,0 +1,153 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blake2s
+
+import (
+	"hash"
+	"sync"
+)
+
+// spLeaves is the number of leaves, and the degree of parallelism, of
+// BLAKE2sp.
+const spLeaves = 8
+
+// spParallelSize is the amount of input below which the BLAKE2sp leaves are
+// hashed sequentially, because starting goroutines would cost more than it
+// saves.
+const spParallelSize = 16 * spLeaves * BlockSize
+
+// SumSP256 returns the BLAKE2sp-256 checksum of the data.
+func SumSP256(data []byte) [Size]byte {
+	var sum [Size]byte
+	d, _ := newSP(Size, nil)
+	d.Write(data)
+	d.Sum(sum[:0])
+	return sum
+}
+
+// NewSP returns a new hash.Hash computing the BLAKE2sp checksum with the
+// given size, between 1 and 32. A non-nil key turns the hash into a MAC. The
+// key must be between zero and 32 bytes long.
+//
+// BLAKE2sp is a tree hash of depth 2 that spreads the input over eight
+// BLAKE2s leaves, which are hashed in parallel for large inputs. It produces
+// different digests than BLAKE2s.
+func NewSP(size int, key []byte) (hash.Hash, error) { return newSP(size, key) }
+
+type spDigest struct {
+	leaves [spLeaves]digest
+	root   digest
+	size   int
+	buf    [spLeaves * BlockSize]byte
+	offset int
+}
+
+func newSP(size int, key []byte) (*spDigest, error) {
+	if size < 1 || size > Size {
+		return nil, errHashSize
+	}
+	if len(key) > Size {
+		return nil, errKeySize
+	}
+	d := &spDigest{size: size}
+	p := TreeParams{Fanout: spLeaves, Depth: 2, InnerSize: Size}
+	for i := range d.leaves {
+		p.NodeOffset = uint64(i)
+		leaf := &d.leaves[i]
+		leaf.size = Size
+		leaf.keyLen = len(key)
+		copy(leaf.key[:], key)
+		leaf.param = p.words(size, len(key))
+	}
+	d.leaves[spLeaves-1].lastNode = true
+	// The root has the key length in its parameter block, but does not
+	// process the key.
+	p.NodeOffset, p.NodeDepth = 0, 1
+	d.root.size = size
+	d.root.param = p.words(size, len(key))
+	d.root.lastNode = true
+	d.Reset()
+	return d, nil
+}
+
+func (d *spDigest) BlockSize() int { return BlockSize }
+
+func (d *spDigest) Size() int { return d.size }
+
+func (d *spDigest) Reset() {
+	for i := range d.leaves {
+		d.leaves[i].Reset()
+	}
+	d.root.Reset()
+	d.offset = 0
+}
+
+func (d *spDigest) Write(p []byte) (n int, err error) {
+	n = len(p)
+
+	if d.offset > 0 {
+		c := copy(d.buf[d.offset:], p)
+		d.offset += c
+		p = p[c:]
+		if d.offset < len(d.buf) {
+			return
+		}
+		d.writeStripes(d.buf[:])
+		d.offset = 0
+	}
+
+	if nn := len(p) &^ (len(d.buf) - 1); nn > 0 {
+		d.writeStripes(p[:nn])
+		p = p[nn:]
+	}
+
+	d.offset = copy(d.buf[:], p)
+	return
+}
+
+// writeStripes hashes p, whose length is a multiple of spLeaves*BlockSize,
+// spreading its blocks round-robin over the leaves.
+func (d *spDigest) writeStripes(p []byte) {
+	if len(p) < spParallelSize {
+		for i := range d.leaves {
+			writeLeaf(&d.leaves[i], p, i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(spLeaves)
+	for i := range d.leaves {
+		go func(i int) {
+			defer wg.Done()
+			writeLeaf(&d.leaves[i], p, i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func writeLeaf(leaf *digest, p []byte, i int) {
+	for off := i * BlockSize; off < len(p); off += spLeaves * BlockSize {
+		leaf.Write(p[off : off+BlockSize])
+	}
+}
+
+func (d *spDigest) Sum(sum []byte) []byte {
+	var hash [Size]byte
+	root := d.root
+	for i := range d.leaves {
+		leaf := d.leaves[i]
+		if start := i * BlockSize; d.offset > start {
+			end := start + BlockSize
+			if end > d.offset {
+				end = d.offset
+			}
+			leaf.Write(d.buf[start:end])
+		}
+		leaf.finalize(&hash)
+		root.Write(hash[:])
+	}
+	root.finalize(&hash)
+	return append(sum, hash[:d.size]...)
+}
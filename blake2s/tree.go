@@ -0,0 +1,79 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blake2s
+
+import (
+	"errors"
+	"hash"
+)
+
+// TreeParams holds the tree hashing fields of the BLAKE2s parameter block,
+// as described in section 2.10 of the BLAKE2 specification. They let a hash
+// compute one node of a hash tree, which interoperates with other BLAKE2
+// tree hashing implementations using the same parameters.
+type TreeParams struct {
+	// Fanout is the maximal number of children of a node, or zero for
+	// unlimited.
+	Fanout uint8
+
+	// Depth is the maximal depth of the tree, between 1 and 255, or 255 for
+	// unlimited.
+	Depth uint8
+
+	// LeafSize is the maximal byte length of a leaf, or zero for unlimited.
+	LeafSize uint32
+
+	// NodeOffset is the offset of the node within its level, starting at
+	// zero for the leftmost node. It must be less than 2^48.
+	NodeOffset uint64
+
+	// NodeDepth is the depth of the node, zero for leaves.
+	NodeDepth uint8
+
+	// InnerSize is the digest size of the inner nodes, between 0 and 32.
+	InnerSize uint8
+
+	// LastNode marks the last, rightmost, node of a level.
+	LastNode bool
+}
+
+// words returns the first four words of the parameter block.
+func (p *TreeParams) words(size, keyLen int) [4]uint32 {
+	return [4]uint32{
+		uint32(size) | uint32(keyLen)<<8 | uint32(p.Fanout)<<16 | uint32(p.Depth)<<24,
+		p.LeafSize,
+		uint32(p.NodeOffset),
+		uint32(p.NodeOffset>>32) | uint32(p.NodeDepth)<<16 | uint32(p.InnerSize)<<24,
+	}
+}
+
+// NewTree returns a new hash.Hash computing the BLAKE2s checksum of a node
+// of a hash tree described by p. The hash size must be between 1 and 32. A
+// non-nil key turns the hash into a MAC. The key must be between zero and
+// 32 bytes long.
+//
+// The returned hash.Hash does not implement BinaryMarshaler.
+func NewTree(size int, key []byte, p *TreeParams) (hash.Hash, error) {
+	if size < 1 || size > Size {
+		return nil, errHashSize
+	}
+	if p.Depth == 0 {
+		return nil, errors.New("blake2s: invalid tree depth")
+	}
+	if p.NodeOffset >= 1<<48 {
+		return nil, errors.New("blake2s: invalid node offset")
+	}
+	if p.InnerSize > Size {
+		return nil, errors.New("blake2s: invalid inner hash size")
+	}
+	d, err := newDigest(size, key)
+	if err != nil {
+		return nil, err
+	}
+	d.param = p.words(size, len(key))
+	d.lastNode = p.LastNode
+	d.Reset()
+	return d, nil
+}
@@ -113,6 +113,9 @@ func expandKeyWithSalt(key []byte, salt []byte, c *Cipher) {
 }
 
 func encryptBlock(l, r uint32, c *Cipher) (uint32, uint32) {
+	if c.constantTime {
+		return encryptBlockConstantTime(l, r, c)
+	}
 	xl, xr := l, r
 	xl ^= c.p[0]
 	xr ^= ((c.s0[byte(xl>>24)] + c.s1[byte(xl>>16)]) ^ c.s2[byte(xl>>8)]) + c.s3[byte(xl)] ^ c.p[1]
@@ -136,6 +139,9 @@ func encryptBlock(l, r uint32, c *Cipher) (uint32, uint32) {
 }
 
 func decryptBlock(l, r uint32, c *Cipher) (uint32, uint32) {
+	if c.constantTime {
+		return decryptBlockConstantTime(l, r, c)
+	}
 	xl, xr := l, r
 	xl ^= c.p[17]
 	xr ^= ((c.s0[byte(xl>>24)] + c.s1[byte(xl>>16)]) ^ c.s2[byte(xl>>8)]) + c.s3[byte(xl)] ^ c.p[16]
@@ -4,7 +4,10 @@
 
 package blowfish
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 type CryptTest struct {
 	key []byte
@@ -189,6 +192,29 @@ func TestCipherDecrypt(t *testing.T) {
 	}
 }
 
+func TestConstantTimeCipher(t *testing.T) {
+	for i, tt := range encryptTests {
+		c, err := NewConstantTimeCipher(tt.key)
+		if err != nil {
+			t.Errorf("NewConstantTimeCipher(%d bytes) = %s", len(tt.key), err)
+			continue
+		}
+		ct := make([]byte, len(tt.out))
+		c.Encrypt(ct, tt.in)
+		if !bytes.Equal(ct, tt.out) {
+			t.Errorf("Cipher.Encrypt, test vector #%d: got %x, expected %x", i, ct, tt.out)
+		}
+		pt := make([]byte, len(tt.in))
+		c.Decrypt(pt, tt.out)
+		if !bytes.Equal(pt, tt.in) {
+			t.Errorf("Cipher.Decrypt, test vector #%d: got %x, expected %x", i, pt, tt.in)
+		}
+	}
+	if _, err := NewConstantTimeCipher(make([]byte, 57)); err == nil {
+		t.Error("NewConstantTimeCipher accepted a 57-byte key")
+	}
+}
+
 func TestSaltedCipherKeyLength(t *testing.T) {
 	if _, err := NewSaltedCipher(nil, []byte{'a'}); err != KeySizeError(0) {
 		t.Errorf("NewSaltedCipher with short key, gave error %#v, expected %#v", err, KeySizeError(0))
@@ -272,3 +298,16 @@ func BenchmarkExpandKey(b *testing.B) {
 		ExpandKey(key, c)
 	}
 }
+
+func BenchmarkConstantTimeEncrypt(b *testing.B) {
+	c, err := NewConstantTimeCipher(encryptTests[0].key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, BlockSize)
+	b.SetBytes(BlockSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Encrypt(buf, buf)
+	}
+}
@@ -25,6 +25,7 @@ const BlockSize = 8
 type Cipher struct {
 	p              [18]uint32
 	s0, s1, s2, s3 [256]uint32
+	constantTime   bool
 }
 
 type KeySizeError int
@@ -0,0 +1,54 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blowfish
+
+import "github.com/gitpod-io/golang-crypto/internal/ctlookup"
+
+// NewConstantTimeCipher is like NewCipher, but the round function reads all
+// 256 entries of an S-box for each of its four lookups, so that the cache
+// lines touched don't reveal the key or the data to other processes sharing
+// the CPU. The S-boxes of Blowfish depend on the key, which makes them
+// secret even in the key schedule.
+//
+// Encryption is about 125 times slower than with NewCipher. The key schedule
+// runs 521 encryptions, so NewConstantTimeCipher takes milliseconds and its
+// Cipher should be reused.
+func NewConstantTimeCipher(key []byte) (*Cipher, error) {
+	var result Cipher
+	if k := len(key); k < 1 || k > 56 {
+		return nil, KeySizeError(k)
+	}
+	result.constantTime = true
+	initCipher(&result)
+	ExpandKey(key, &result)
+	return &result, nil
+}
+
+// f is the Blowfish round function, with constant-time lookups.
+func f(x uint32, c *Cipher) uint32 {
+	return ((ctlookup.Uint32(&c.s0, byte(x>>24)) + ctlookup.Uint32(&c.s1, byte(x>>16))) ^ ctlookup.Uint32(&c.s2, byte(x>>8))) + ctlookup.Uint32(&c.s3, byte(x))
+}
+
+func encryptBlockConstantTime(l, r uint32, c *Cipher) (uint32, uint32) {
+	xl, xr := l, r
+	xl ^= c.p[0]
+	for i := 1; i < 17; i += 2 {
+		xr ^= f(xl, c) ^ c.p[i]
+		xl ^= f(xr, c) ^ c.p[i+1]
+	}
+	xr ^= c.p[17]
+	return xr, xl
+}
+
+func decryptBlockConstantTime(l, r uint32, c *Cipher) (uint32, uint32) {
+	xl, xr := l, r
+	xl ^= c.p[17]
+	for i := 16; i > 0; i -= 2 {
+		xr ^= f(xl, c) ^ c.p[i]
+		xl ^= f(xr, c) ^ c.p[i-1]
+	}
+	xr ^= c.p[0]
+	return xr, xl
+}
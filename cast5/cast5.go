@@ -22,8 +22,9 @@ const BlockSize = 8
 const KeySize = 16
 
 type Cipher struct {
-	masking [16]uint32
-	rotate  [16]uint8
+	masking      [16]uint32
+	rotate       [16]uint8
+	constantTime bool
 }
 
 func NewCipher(key []byte) (c *Cipher, err error) {
@@ -41,6 +42,10 @@ func (c *Cipher) BlockSize() int {
 }
 
 func (c *Cipher) Encrypt(dst, src []byte) {
+	if c.constantTime {
+		c.encryptConstantTime(dst, src)
+		return
+	}
 	l := uint32(src[0])<<24 | uint32(src[1])<<16 | uint32(src[2])<<8 | uint32(src[3])
 	r := uint32(src[4])<<24 | uint32(src[5])<<16 | uint32(src[6])<<8 | uint32(src[7])
 
@@ -75,6 +80,10 @@ func (c *Cipher) Encrypt(dst, src []byte) {
 }
 
 func (c *Cipher) Decrypt(dst, src []byte) {
+	if c.constantTime {
+		c.decryptConstantTime(dst, src)
+		return
+	}
 	l := uint32(src[0])<<24 | uint32(src[1])<<16 | uint32(src[2])<<8 | uint32(src[3])
 	r := uint32(src[4])<<24 | uint32(src[5])<<16 | uint32(src[6])<<8 | uint32(src[7])
 
@@ -204,7 +213,7 @@ func (c *Cipher) keySchedule(in []byte) {
 		t[i] = uint32(in[j])<<24 | uint32(in[j+1])<<16 | uint32(in[j+2])<<8 | uint32(in[j+3])
 	}
 
-	x := []byte{6, 7, 4, 5}
+	x := []int{6, 7, 4, 5}
 	ki := 0
 
 	for half := 0; half < 2; half++ {
@@ -213,22 +222,22 @@ func (c *Cipher) keySchedule(in []byte) {
 				var a [7]uint8
 				copy(a[:], round.a[j][:])
 				w := t[a[1]]
-				w ^= sBox[4][(t[a[2]>>2]>>(24-8*(a[2]&3)))&0xff]
-				w ^= sBox[5][(t[a[3]>>2]>>(24-8*(a[3]&3)))&0xff]
-				w ^= sBox[6][(t[a[4]>>2]>>(24-8*(a[4]&3)))&0xff]
-				w ^= sBox[7][(t[a[5]>>2]>>(24-8*(a[5]&3)))&0xff]
-				w ^= sBox[x[j]][(t[a[6]>>2]>>(24-8*(a[6]&3)))&0xff]
+				w ^= c.sBox(4, (t[a[2]>>2]>>(24-8*(a[2]&3)))&0xff)
+				w ^= c.sBox(5, (t[a[3]>>2]>>(24-8*(a[3]&3)))&0xff)
+				w ^= c.sBox(6, (t[a[4]>>2]>>(24-8*(a[4]&3)))&0xff)
+				w ^= c.sBox(7, (t[a[5]>>2]>>(24-8*(a[5]&3)))&0xff)
+				w ^= c.sBox(x[j], (t[a[6]>>2]>>(24-8*(a[6]&3)))&0xff)
 				t[a[0]] = w
 			}
 
 			for j := 0; j < 4; j++ {
 				var b [5]uint8
 				copy(b[:], round.b[j][:])
-				w := sBox[4][(t[b[0]>>2]>>(24-8*(b[0]&3)))&0xff]
-				w ^= sBox[5][(t[b[1]>>2]>>(24-8*(b[1]&3)))&0xff]
-				w ^= sBox[6][(t[b[2]>>2]>>(24-8*(b[2]&3)))&0xff]
-				w ^= sBox[7][(t[b[3]>>2]>>(24-8*(b[3]&3)))&0xff]
-				w ^= sBox[4+j][(t[b[4]>>2]>>(24-8*(b[4]&3)))&0xff]
+				w := c.sBox(4, (t[b[0]>>2]>>(24-8*(b[0]&3)))&0xff)
+				w ^= c.sBox(5, (t[b[1]>>2]>>(24-8*(b[1]&3)))&0xff)
+				w ^= c.sBox(6, (t[b[2]>>2]>>(24-8*(b[2]&3)))&0xff)
+				w ^= c.sBox(7, (t[b[3]>>2]>>(24-8*(b[3]&3)))&0xff)
+				w ^= c.sBox(4+j, (t[b[4]>>2]>>(24-8*(b[4]&3)))&0xff)
 				k[ki] = w
 				ki++
 			}
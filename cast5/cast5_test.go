@@ -24,12 +24,20 @@ var basicTests = []struct {
 }
 
 func TestBasic(t *testing.T) {
+	testBasic(t, NewCipher)
+}
+
+func TestBasicConstantTime(t *testing.T) {
+	testBasic(t, NewConstantTimeCipher)
+}
+
+func testBasic(t *testing.T, newCipher func([]byte) (*Cipher, error)) {
 	for i, test := range basicTests {
 		key, _ := hex.DecodeString(test.key)
 		plainText, _ := hex.DecodeString(test.plainText)
 		expected, _ := hex.DecodeString(test.cipherText)
 
-		c, err := NewCipher(key)
+		c, err := newCipher(key)
 		if err != nil {
 			t.Errorf("#%d: failed to create Cipher: %s", i, err)
 			continue
@@ -57,7 +65,7 @@ func TestFull(t *testing.T) {
 		return
 	}
 
-	a, b := iterate(1000000)
+	a, b := iterate(NewCipher, 1000000)
 
 	const expectedA = "eea9d0a249fd3ba6b3436fb89d6dca92"
 	const expectedB = "b2c95eb00c31ad7180ac05b8e83d696e"
@@ -70,7 +78,7 @@ func TestFull(t *testing.T) {
 	}
 }
 
-func iterate(iterations int) ([]byte, []byte) {
+func iterate(newCipher func([]byte) (*Cipher, error), iterations int) ([]byte, []byte) {
 	const initValueHex = "0123456712345678234567893456789a"
 
 	initValue, _ := hex.DecodeString(initValueHex)
@@ -80,10 +88,10 @@ func iterate(iterations int) ([]byte, []byte) {
 	copy(b[:], initValue)
 
 	for i := 0; i < iterations; i++ {
-		c, _ := NewCipher(b[:])
+		c, _ := newCipher(b[:])
 		c.Encrypt(a[:8], a[:8])
 		c.Encrypt(a[8:], a[8:])
-		c, _ = NewCipher(a[:])
+		c, _ = newCipher(a[:])
 		c.Encrypt(b[:8], b[:8])
 		c.Encrypt(b[8:], b[8:])
 	}
@@ -92,7 +100,15 @@ func iterate(iterations int) ([]byte, []byte) {
 }
 
 func TestLimited(t *testing.T) {
-	a, b := iterate(1000)
+	testLimited(t, NewCipher)
+}
+
+func TestLimitedConstantTime(t *testing.T) {
+	testLimited(t, NewConstantTimeCipher)
+}
+
+func testLimited(t *testing.T, newCipher func([]byte) (*Cipher, error)) {
+	a, b := iterate(newCipher, 1000)
 
 	const expectedA = "23f73b14b02a2ad7dfb9f2c35644798d"
 	const expectedB = "e5bf37eff14c456a40b21ce369370a9f"
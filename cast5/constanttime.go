@@ -0,0 +1,91 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cast5
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/gitpod-io/golang-crypto/internal/ctlookup"
+)
+
+// NewConstantTimeCipher is like NewCipher, but every lookup in the eight
+// fixed S-boxes of RFC 2144, in the key schedule as well as in the round
+// functions, reads all 256 of their entries. The S-boxes are public, but
+// the indexes derive from the key and the data, which the cache lines
+// touched would otherwise reveal to other processes sharing the CPU.
+//
+// Encryption is about 150 times slower than with NewCipher.
+func NewConstantTimeCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("CAST5: keys must be 16 bytes")
+	}
+
+	c := &Cipher{constantTime: true}
+	c.keySchedule(key)
+	return c, nil
+}
+
+// sBox returns sBox[n][i], in constant time if c.constantTime is set.
+func (c *Cipher) sBox(n int, i uint32) uint32 {
+	if c.constantTime {
+		return ctlookup.Uint32(&sBox[n], byte(i))
+	}
+	return sBox[n][i]
+}
+
+// fConstantTime is f1, f2 or f3 for round i, with constant-time lookups.
+func (c *Cipher) fConstantTime(i int, d uint32) uint32 {
+	m := c.masking[i]
+	var t uint32
+	switch i % 3 {
+	case 0:
+		t = m + d
+	case 1:
+		t = m ^ d
+	case 2:
+		t = m - d
+	}
+	I := bits.RotateLeft32(t, int(c.rotate[i]))
+	s0, s1 := ctlookup.Uint32(&sBox[0], byte(I>>24)), ctlookup.Uint32(&sBox[1], byte(I>>16))
+	s2, s3 := ctlookup.Uint32(&sBox[2], byte(I>>8)), ctlookup.Uint32(&sBox[3], byte(I))
+	switch i % 3 {
+	case 0:
+		return ((s0 ^ s1) - s2) + s3
+	case 1:
+		return ((s0 - s1) + s2) ^ s3
+	default:
+		return ((s0 + s1) ^ s2) - s3
+	}
+}
+
+func (c *Cipher) encryptConstantTime(dst, src []byte) {
+	l := uint32(src[0])<<24 | uint32(src[1])<<16 | uint32(src[2])<<8 | uint32(src[3])
+	r := uint32(src[4])<<24 | uint32(src[5])<<16 | uint32(src[6])<<8 | uint32(src[7])
+	for i := 0; i < 16; i++ {
+		l, r = r, l^c.fConstantTime(i, r)
+	}
+	putBlock(dst, r, l)
+}
+
+func (c *Cipher) decryptConstantTime(dst, src []byte) {
+	l := uint32(src[0])<<24 | uint32(src[1])<<16 | uint32(src[2])<<8 | uint32(src[3])
+	r := uint32(src[4])<<24 | uint32(src[5])<<16 | uint32(src[6])<<8 | uint32(src[7])
+	for i := 15; i >= 0; i-- {
+		l, r = r, l^c.fConstantTime(i, r)
+	}
+	putBlock(dst, r, l)
+}
+
+func putBlock(dst []byte, l, r uint32) {
+	dst[0] = uint8(l >> 24)
+	dst[1] = uint8(l >> 16)
+	dst[2] = uint8(l >> 8)
+	dst[3] = uint8(l)
+	dst[4] = uint8(r >> 24)
+	dst[5] = uint8(r >> 16)
+	dst[6] = uint8(r >> 8)
+	dst[7] = uint8(r)
+}
@@ -0,0 +1,32 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build gc && !purego
+
+package chacha20
+
+import "golang.org/x/sys/cpu"
+
+// bufSize is a single block, since xorKeyStreamAVX512 only handles the
+// multiples of 16 blocks, and the rest uses the generic implementation.
+const bufSize = blockSize
+
+// useAVX512 reports whether the AVX-512 implementation can be used.
+var useAVX512 = cpu.X86.HasAVX512F
+
+// avx512Size is the number of bytes processed by each iteration of
+// xorKeyStreamAVX512.
+const avx512Size = 16 * blockSize
+
+//go:noescape
+func xorKeyStreamAVX512(dst, src []byte, key *[8]uint32, nonce *[3]uint32, counter *uint32)
+
+func (s *Cipher) xorKeyStreamBlocks(dst, src []byte) {
+	if useAVX512 && len(src) >= avx512Size {
+		n := len(src) - len(src)%avx512Size
+		xorKeyStreamAVX512(dst[:n], src[:n], &s.key, &s.nonce, &s.counter)
+		dst, src = dst[n:], src[n:]
+	}
+	s.xorKeyStreamBlocksGeneric(dst, src)
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build gc && !purego
+
+#include "textflag.h"
+
+// The state of 16 blocks is held in Z0-Z15, one word of the state of every
+// block per register, and Z16-Z31 hold the initial state, then serve as
+// temporaries for the transposition of the state into blocks.
+
+#define QR(a, b, c, d) \
+	VPADDD b, a, a; VPXORD a, d, d; VPROLD $16, d, d; \
+	VPADDD d, c, c; VPXORD c, b, b; VPROLD $12, b, b; \
+	VPADDD b, a, a; VPXORD a, d, d; VPROLD $8, d, d; \
+	VPADDD d, c, c; VPXORD c, b, b; VPROLD $7, b, b
+
+// TRANSPOSE4 turns the words i to i+3 of four blocks per 128-bit lane, in
+// a, b, c and d, into those four blocks, in a, b, c and d.
+#define TRANSPOSE4(a, b, c, d) \
+	VPUNPCKLDQ b, a, Z16; VPUNPCKHDQ b, a, Z17; \
+	VPUNPCKLDQ d, c, Z18; VPUNPCKHDQ d, c, Z19; \
+	VPUNPCKLQDQ Z18, Z16, a; VPUNPCKHQDQ Z18, Z16, b; \
+	VPUNPCKLQDQ Z19, Z17, c; VPUNPCKHQDQ Z19, Z17, d
+
+// XORBLOCKS gathers the 128-bit lanes of the blocks m, 4+m, 8+m and 12+m,
+// found in a, b, c and d after TRANSPOSE4, XORs them with src and writes
+// them to dst.
+#define XORBLOCKS(m, a, b, c, d) \
+	VSHUFI32X4 $0x44, b, a, Z16; VSHUFI32X4 $0xee, b, a, Z17; \
+	VSHUFI32X4 $0x44, d, c, Z18; VSHUFI32X4 $0xee, d, c, Z19; \
+	VSHUFI32X4 $0x88, Z18, Z16, Z20; VSHUFI32X4 $0xdd, Z18, Z16, Z21; \
+	VSHUFI32X4 $0x88, Z19, Z17, Z22; VSHUFI32X4 $0xdd, Z19, Z17, Z23; \
+	VPXORD (m*64)(SI), Z20, Z20; VMOVDQU32 Z20, (m*64)(DI); \
+	VPXORD (m*64+256)(SI), Z21, Z21; VMOVDQU32 Z21, (m*64+256)(DI); \
+	VPXORD (m*64+512)(SI), Z22, Z22; VMOVDQU32 Z22, (m*64+512)(DI); \
+	VPXORD (m*64+768)(SI), Z23, Z23; VMOVDQU32 Z23, (m*64+768)(DI)
+
+// func xorKeyStreamAVX512(dst, src []byte, key *[8]uint32, nonce *[3]uint32, counter *uint32)
+TEXT ·xorKeyStreamAVX512(SB), NOSPLIT, $0
+	MOVQ	dst_base+0(FP), DI
+	MOVQ	src_base+24(FP), SI
+	MOVQ	src_len+32(FP), CX
+	MOVQ	key+48(FP), AX
+	MOVQ	nonce+56(FP), BX
+	MOVQ	counter+64(FP), DX
+	MOVL	(DX), R8
+
+loop:
+	CMPQ	CX, $1024
+	JB	done
+
+	VPBROADCASTD	·sigma<>+0(SB), Z16
+	VPBROADCASTD	·sigma<>+4(SB), Z17
+	VPBROADCASTD	·sigma<>+8(SB), Z18
+	VPBROADCASTD	·sigma<>+12(SB), Z19
+	VPBROADCASTD	0(AX), Z20
+	VPBROADCASTD	4(AX), Z21
+	VPBROADCASTD	8(AX), Z22
+	VPBROADCASTD	12(AX), Z23
+	VPBROADCASTD	16(AX), Z24
+	VPBROADCASTD	20(AX), Z25
+	VPBROADCASTD	24(AX), Z26
+	VPBROADCASTD	28(AX), Z27
+	VPBROADCASTD	R8, Z28
+	VPADDD	·iota<>(SB), Z28, Z28
+	VPBROADCASTD	0(BX), Z29
+	VPBROADCASTD	4(BX), Z30
+	VPBROADCASTD	8(BX), Z31
+	VMOVDQA32	Z16, Z0
+	VMOVDQA32	Z17, Z1
+	VMOVDQA32	Z18, Z2
+	VMOVDQA32	Z19, Z3
+	VMOVDQA32	Z20, Z4
+	VMOVDQA32	Z21, Z5
+	VMOVDQA32	Z22, Z6
+	VMOVDQA32	Z23, Z7
+	VMOVDQA32	Z24, Z8
+	VMOVDQA32	Z25, Z9
+	VMOVDQA32	Z26, Z10
+	VMOVDQA32	Z27, Z11
+	VMOVDQA32	Z28, Z12
+	VMOVDQA32	Z29, Z13
+	VMOVDQA32	Z30, Z14
+	VMOVDQA32	Z31, Z15
+
+	MOVQ	$10, R9
+
+rounds:
+	QR(Z0, Z4, Z8, Z12)
+	QR(Z1, Z5, Z9, Z13)
+	QR(Z2, Z6, Z10, Z14)
+	QR(Z3, Z7, Z11, Z15)
+	QR(Z0, Z5, Z10, Z15)
+	QR(Z1, Z6, Z11, Z12)
+	QR(Z2, Z7, Z8, Z13)
+	QR(Z3, Z4, Z9, Z14)
+	DECQ	R9
+	JNZ	rounds
+
+	VPADDD	Z16, Z0, Z0
+	VPADDD	Z17, Z1, Z1
+	VPADDD	Z18, Z2, Z2
+	VPADDD	Z19, Z3, Z3
+	VPADDD	Z20, Z4, Z4
+	VPADDD	Z21, Z5, Z5
+	VPADDD	Z22, Z6, Z6
+	VPADDD	Z23, Z7, Z7
+	VPADDD	Z24, Z8, Z8
+	VPADDD	Z25, Z9, Z9
+	VPADDD	Z26, Z10, Z10
+	VPADDD	Z27, Z11, Z11
+	VPADDD	Z28, Z12, Z12
+	VPADDD	Z29, Z13, Z13
+	VPADDD	Z30, Z14, Z14
+	VPADDD	Z31, Z15, Z15
+
+	TRANSPOSE4(Z0, Z1, Z2, Z3)
+	TRANSPOSE4(Z4, Z5, Z6, Z7)
+	TRANSPOSE4(Z8, Z9, Z10, Z11)
+	TRANSPOSE4(Z12, Z13, Z14, Z15)
+
+	XORBLOCKS(0, Z0, Z4, Z8, Z12)
+	XORBLOCKS(1, Z1, Z5, Z9, Z13)
+	XORBLOCKS(2, Z2, Z6, Z10, Z14)
+	XORBLOCKS(3, Z3, Z7, Z11, Z15)
+
+	ADDL	$16, R8
+	ADDQ	$1024, SI
+	ADDQ	$1024, DI
+	SUBQ	$1024, CX
+	JMP	loop
+
+done:
+	MOVL	R8, (DX)
+	VZEROUPPER
+	RET
+
+// sigma is "expand 32-byte k".
+DATA	·sigma<>+0(SB)/4, $0x61707865
+DATA	·sigma<>+4(SB)/4, $0x3320646e
+DATA	·sigma<>+8(SB)/4, $0x79622d32
+DATA	·sigma<>+12(SB)/4, $0x6b206574
+GLOBL	·sigma<>(SB), RODATA|NOPTR, $16
+
+// iota holds the offsets of the counters of 16 blocks.
+DATA	·iota<>+0(SB)/4, $0
+DATA	·iota<>+4(SB)/4, $1
+DATA	·iota<>+8(SB)/4, $2
+DATA	·iota<>+12(SB)/4, $3
+DATA	·iota<>+16(SB)/4, $4
+DATA	·iota<>+20(SB)/4, $5
+DATA	·iota<>+24(SB)/4, $6
+DATA	·iota<>+28(SB)/4, $7
+DATA	·iota<>+32(SB)/4, $8
+DATA	·iota<>+36(SB)/4, $9
+DATA	·iota<>+40(SB)/4, $10
+DATA	·iota<>+44(SB)/4, $11
+DATA	·iota<>+48(SB)/4, $12
+DATA	·iota<>+52(SB)/4, $13
+DATA	·iota<>+56(SB)/4, $14
+DATA	·iota<>+60(SB)/4, $15
+GLOBL	·iota<>(SB), RODATA|NOPTR, $64
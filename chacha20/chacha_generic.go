@@ -10,6 +10,7 @@ import (
 	"crypto/cipher"
 	"encoding/binary"
 	"errors"
+	"io"
 	"math/bits"
 
 	"github.com/gitpod-io/golang-crypto/internal/alias"
@@ -59,6 +60,7 @@ type Cipher struct {
 }
 
 var _ cipher.Stream = (*Cipher)(nil)
+var _ io.Seeker = (*Cipher)(nil)
 
 // NewUnauthenticatedCipher creates a new ChaCha20 stream cipher with the given
 // 32 bytes key and a 12 or 24 bytes nonce. If a nonce of 24 bytes is provided,
@@ -171,6 +173,60 @@ func (s *Cipher) SetCounter(counter uint32) {
 	}
 }
 
+// keyStreamLen is the length of the key stream of a Cipher: 2³² blocks.
+const keyStreamLen = 1 << 32 * blockSize
+
+// Seek sets the position in the key stream for the next invocation of
+// XORKeyStream, which then behaves as if offset bytes had been encrypted so
+// far, or as defined by whence for io.SeekCurrent and io.SeekEnd. It returns
+// the new position, and implements io.Seeker.
+//
+// Unlike SetCounter, Seek allows moving backwards and to arbitrary byte
+// offsets, for random access to data encrypted with a single key and nonce,
+// such as a disk image. Encrypting different data at the same position
+// reuses the key stream, which breaks the confidentiality of both.
+//
+// Note that the execution time of XORKeyStream is not independent of the
+// position.
+func (s *Cipher) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.position()
+	case io.SeekEnd:
+		offset += keyStreamLen
+	default:
+		return 0, errors.New("chacha20: invalid whence")
+	}
+	if offset < 0 || offset > keyStreamLen {
+		return 0, errors.New("chacha20: seek position out of range")
+	}
+
+	s.counter = uint32(offset / blockSize)
+	s.overflow = offset == keyStreamLen
+	s.len = 0
+	if rem := int(offset % blockSize); rem != 0 {
+		// Generate the block that offset is in, and keep the rest of it for
+		// the next XORKeyStream invocation.
+		s.buf = [bufSize]byte{}
+		block := s.buf[bufSize-blockSize:]
+		s.xorKeyStreamBlocksGeneric(block, block)
+		s.len = blockSize - rem
+		s.overflow = s.counter == 0
+	}
+	return offset, nil
+}
+
+// position returns the number of key stream bytes used so far.
+func (s *Cipher) position() int64 {
+	blocks := int64(s.counter)
+	if s.overflow {
+		// The counter wrapped around after the last block.
+		blocks = 1 << 32
+	}
+	return blocks*blockSize - int64(s.len)
+}
+
 // XORKeyStream XORs each byte in the given slice with a byte from the
 // cipher's key stream. Dst and src must overlap entirely or not at all.
 //
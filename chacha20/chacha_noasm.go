@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-//go:build (!arm64 && !s390x && !ppc64 && !ppc64le) || !gc || purego
+//go:build (!amd64 && !arm64 && !s390x && !ppc64 && !ppc64le) || !gc || purego
 
 package chacha20
 
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math/rand"
 	"testing"
 )
@@ -150,6 +151,67 @@ func TestSetCounter(t *testing.T) {
 	}
 }
 
+func TestSeek(t *testing.T) {
+	newCipher := func() *Cipher {
+		s, _ := NewUnauthenticatedCipher(make([]byte, KeySize), make([]byte, NonceSize))
+		return s
+	}
+	src := make([]byte, 3000)
+	want := make([]byte, len(src))
+	newCipher().XORKeyStream(want, src)
+
+	s := newCipher()
+	for _, r := range [][2]int{{0, 10}, {1000, 1500}, {5, 70}, {64, 128}, {2999, 3000}, {100, 2100}, {63, 65}} {
+		if pos, err := s.Seek(int64(r[0]), io.SeekStart); err != nil || pos != int64(r[0]) {
+			t.Fatalf("Seek(%d) = %d, %v", r[0], pos, err)
+		}
+		got := make([]byte, r[1]-r[0])
+		s.XORKeyStream(got, src[r[0]:r[1]])
+		if !bytes.Equal(got, want[r[0]:r[1]]) {
+			t.Errorf("wrong key stream at [%d:%d] after Seek", r[0], r[1])
+		}
+		if pos, _ := s.Seek(0, io.SeekCurrent); pos != int64(r[1]) {
+			t.Errorf("position %d after reading [%d:%d]", pos, r[0], r[1])
+		}
+	}
+
+	// The end of the key stream matches the last block of TestLastBlock.
+	last := newCipher()
+	last.SetCounter(^uint32(0))
+	wantLast := make([]byte, blockSize)
+	last.XORKeyStream(wantLast, wantLast)
+	s = newCipher()
+	if _, err := s.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 10)
+	s.XORKeyStream(got, got)
+	if !bytes.Equal(got, wantLast[blockSize-10:]) {
+		t.Error("wrong key stream at the end after Seek")
+	}
+	panics := func(fn func()) (p bool) {
+		defer func() { p = recover() != nil }()
+		fn()
+		return
+	}
+	if !panics(func() { s.XORKeyStream(got[:1], got[:1]) }) {
+		t.Error("XORKeyStream past the end of the key stream should panic")
+	}
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	s.XORKeyStream(got, make([]byte, 10))
+	if !bytes.Equal(got, want[:10]) {
+		t.Error("wrong key stream after seeking back from the end")
+	}
+
+	for _, offset := range []int64{-1, keyStreamLen + 1} {
+		if _, err := s.Seek(offset, io.SeekStart); err == nil {
+			t.Errorf("Seek(%d) succeeded", offset)
+		}
+	}
+}
+
 func TestLastBlock(t *testing.T) {
 	panics := func(fn func()) (p bool) {
 		defer func() { p = recover() != nil }()
@@ -211,6 +273,53 @@ func TestLastBlock(t *testing.T) {
 	}
 }
 
+// checkGeneric checks that xorKeyStreamBlocks, which may use an assembly
+// implementation, produces the same output and counter as
+// xorKeyStreamBlocksGeneric, for whole blocks of src.
+func checkGeneric(t *testing.T, key, nonce []byte, counter uint32, src []byte) {
+	t.Helper()
+	src = src[:len(src)-len(src)%blockSize]
+	s, _ := NewUnauthenticatedCipher(key, nonce)
+	s.counter = counter
+	g, _ := NewUnauthenticatedCipher(key, nonce)
+	g.counter = counter
+	got := make([]byte, len(src))
+	want := make([]byte, len(src))
+	s.xorKeyStreamBlocks(got, src)
+	g.xorKeyStreamBlocksGeneric(want, src)
+	if !bytes.Equal(got, want) {
+		t.Errorf("length=%v, counter=%#x: output differs from the generic implementation", len(src), counter)
+	}
+	if s.counter != g.counter {
+		t.Errorf("length=%v, counter=%#x: got counter %#x, want %#x", len(src), counter, s.counter, g.counter)
+	}
+}
+
+func TestGeneric(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	key := make([]byte, KeySize)
+	nonce := make([]byte, NonceSize)
+	src := make([]byte, 64*blockSize)
+	rnd.Read(key)
+	rnd.Read(nonce)
+	rnd.Read(src)
+	for _, blocks := range []int{1, 15, 16, 17, 31, 32, 33, 48, 64} {
+		checkGeneric(t, key, nonce, 0, src[:blocks*blockSize])
+		checkGeneric(t, key, nonce, 0xffffffff-uint32(blocks)+1, src[:blocks*blockSize])
+	}
+}
+
+func FuzzGeneric(f *testing.F) {
+	f.Add(make([]byte, KeySize+NonceSize), uint32(0), make([]byte, 16*blockSize))
+	f.Add(make([]byte, KeySize+NonceSize), uint32(0xfffffff0), make([]byte, 16*blockSize))
+	f.Fuzz(func(t *testing.T, keyNonce []byte, counter uint32, src []byte) {
+		if len(keyNonce) != KeySize+NonceSize {
+			return
+		}
+		checkGeneric(t, keyNonce[:KeySize], keyNonce[KeySize:], counter, src)
+	})
+}
+
 func benchmarkChaCha20(b *testing.B, step, count int) {
 	tot := step * count
 	src := make([]byte, tot)
@@ -23,6 +23,12 @@ var (
 	useAVX2 = cpu.X86.HasAVX2 && cpu.X86.HasBMI2
 )
 
+// The AVX-512 ChaCha20 of the chacha20 package is not used here: running it
+// and Poly1305 one after the other, as sealGeneric does, is slower than the
+// fused AVX2 assembly, which overlaps the two, at every message size
+// measured (1350 bytes: 1685ns against 976ns; 64KiB: 38.1µs against
+// 35.5µs). Only a fused AVX-512 implementation could do better.
+
 // setupState writes a ChaCha20 input matrix to state. See
 // https://tools.ietf.org/html/rfc7539#section-2.3.
 func setupState(state *[16]uint32, key *[32]byte, nonce []byte) {
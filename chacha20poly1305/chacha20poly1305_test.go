@@ -153,6 +153,38 @@ func TestRandom(t *testing.T) {
 	t.Run("X", func(t *testing.T) { f(t, NonceSizeX) })
 }
 
+func FuzzGeneric(f *testing.F) {
+	f.Add(make([]byte, KeySize+NonceSize), []byte("ad"), make([]byte, 1024))
+	f.Fuzz(func(t *testing.T, keyNonce, ad, plaintext []byte) {
+		if len(keyNonce) != KeySize+NonceSize {
+			return
+		}
+		aead, _ := New(keyNonce[:KeySize])
+		c := aead.(*chacha20poly1305)
+		nonce := keyNonce[KeySize:]
+
+		ct := c.seal(nil, nonce, plaintext, ad)
+		if want := c.sealGeneric(nil, nonce, plaintext, ad); !bytes.Equal(ct, want) {
+			t.Fatalf("seal: got %x, want %x", ct, want)
+		}
+		pt, err := c.open(nil, nonce, ct, ad)
+		if err != nil || !bytes.Equal(pt, plaintext) {
+			t.Fatalf("open: got %x and error %v, want %x", pt, err, plaintext)
+		}
+		if _, err := c.openGeneric(nil, nonce, ct, ad); err != nil {
+			t.Fatalf("openGeneric: %v", err)
+		}
+
+		ct[len(ct)/2] ^= 1
+		if _, err := c.open(nil, nonce, ct, ad); err == nil {
+			t.Fatal("open succeeded with a modified ciphertext")
+		}
+		if _, err := c.openGeneric(nil, nonce, ct, ad); err == nil {
+			t.Fatal("openGeneric succeeded with a modified ciphertext")
+		}
+	})
+}
+
 func benchamarkChaCha20Poly1305Seal(b *testing.B, buf []byte, nonceSize int) {
 	b.ReportAllocs()
 	b.SetBytes(int64(len(buf)))
@@ -0,0 +1,251 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// StreamNonceSize is the size of the nonce used by NewWriter and
+	// NewReader, in bytes. It is long enough to be generated at random.
+	StreamNonceSize = NonceSizeX - 5
+
+	// StreamChunkSize is the maximum size of the plaintext of each chunk
+	// of a stream, in bytes. Each chunk adds Overhead bytes.
+	StreamChunkSize = 64 * 1024
+)
+
+// The streaming construction is the STREAM construction from "Online
+// Authenticated-Encryption and its Nonce-Reuse Misuse-Resistance" by Hoang,
+// Reyhanitabar, Rogaway and Vizár, instantiated with XChaCha20-Poly1305.
+//
+// The plaintext is split into chunks of StreamChunkSize bytes, the last of
+// which may be shorter, and each chunk is sealed with the nonce
+//
+//	nonce || uint32(counter) || lastFlag
+//
+// where counter is the big-endian index of the chunk and lastFlag is 1 for
+// the final chunk and 0 otherwise. The final chunk is empty only if the
+// whole plaintext is. This prevents reordering, dropping and truncating
+// chunks without the reader noticing.
+
+const encChunkSize = StreamChunkSize + Overhead
+
+var (
+	errStreamNonce    = errors.New("chacha20poly1305: bad stream nonce length")
+	errStreamTooLarge = errors.New("chacha20poly1305: stream too large")
+	errStreamClosed   = errors.New("chacha20poly1305: write to closed stream")
+)
+
+type streamState struct {
+	aead    cipher.AEAD
+	nonce   [NonceSizeX]byte
+	counter uint32
+	done    bool // the final chunk was processed
+}
+
+func newStreamState(key, nonce []byte) (*streamState, error) {
+	if len(nonce) != StreamNonceSize {
+		return nil, errStreamNonce
+	}
+	aead, err := NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	s := &streamState{aead: aead}
+	copy(s.nonce[:], nonce)
+	return s, nil
+}
+
+// chunkNonce returns the nonce of the current chunk, and advances the
+// counter.
+func (s *streamState) chunkNonce(last bool) ([]byte, error) {
+	if s.done {
+		return nil, errors.New("chacha20poly1305: chunk after the end of stream")
+	}
+	binary.BigEndian.PutUint32(s.nonce[StreamNonceSize:], s.counter)
+	if last {
+		s.nonce[NonceSizeX-1] = 1
+		s.done = true
+	} else {
+		if s.counter == ^uint32(0) {
+			return nil, errStreamTooLarge
+		}
+		s.counter++
+	}
+	return s.nonce[:], nil
+}
+
+type streamWriter struct {
+	s   *streamState
+	dst io.Writer
+	buf []byte // plaintext of the pending chunk, then its ciphertext
+	err error
+}
+
+// NewWriter returns a WriteCloser that encrypts the data written to it with
+// the given 256-bit key and StreamNonceSize-byte nonce, and writes the
+// ciphertext to dst in chunks of at most StreamChunkSize+Overhead bytes.
+// At most StreamChunkSize bytes of plaintext are buffered.
+//
+// Close must be called to write the final chunk, and it does not close dst.
+// A key and nonce pair must never be used for more than one stream; a nonce
+// read from crypto/rand is suitable.
+func NewWriter(key, nonce []byte, dst io.Writer) (io.WriteCloser, error) {
+	s, err := newStreamState(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{s: s, dst: dst, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only flushed once more data arrives, since the
+		// final chunk must be sealed differently.
+		if len(w.buf) == StreamChunkSize {
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := StreamChunkSize - len(w.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (w *streamWriter) flush(last bool) error {
+	nonce, err := w.s.chunkNonce(last)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	ct := w.s.aead.Seal(w.buf[:0], nonce, w.buf, nil)
+	if _, err := w.dst.Write(ct); err != nil {
+		w.err = err
+		return err
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (w *streamWriter) Close() error {
+	if w.err != nil {
+		if w.err == errStreamClosed {
+			return nil
+		}
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	w.err = errStreamClosed
+	return nil
+}
+
+type streamReader struct {
+	s   *streamState
+	src io.Reader
+	buf []byte // encChunkSize+1 bytes, to detect the final chunk
+	n   int    // number of bytes read into buf
+	dec []byte // StreamChunkSize bytes, to decrypt chunks into
+	pt  []byte // decrypted plaintext not yet returned
+	err error
+}
+
+// NewReader returns a Reader that decrypts a stream produced by NewWriter
+// with the same key and nonce.
+//
+// Each chunk is authenticated before any of its plaintext is returned. If
+// the stream was modified or truncated, Read returns an error; the
+// plaintext returned up to that point is authentic, but callers must not
+// consider it complete until Read returns io.EOF.
+func NewReader(key, nonce []byte, src io.Reader) (io.Reader, error) {
+	s, err := newStreamState(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		s:   s,
+		src: src,
+		buf: make([]byte, encChunkSize+1),
+		dec: make([]byte, 0, StreamChunkSize),
+	}, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.pt) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.s.done {
+			r.err = io.EOF
+			return 0, r.err
+		}
+		if err := r.readChunk(); err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+	n := copy(p, r.pt)
+	r.pt = r.pt[n:]
+	return n, nil
+}
+
+// readChunk reads and decrypts the next chunk into r.pt. A chunk is the
+// final one if it is not followed by any more data.
+func (r *streamReader) readChunk() error {
+	n, err := io.ReadFull(r.src, r.buf[r.n:])
+	r.n += n
+	last := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+	ct := r.buf[:r.n]
+	if !last {
+		ct = ct[:encChunkSize]
+	}
+	if len(ct) < Overhead {
+		return io.ErrUnexpectedEOF
+	}
+	if len(ct) == Overhead && r.s.counter > 0 {
+		// Only the final chunk of an empty stream may be empty.
+		return errOpen
+	}
+	nonce, err := r.s.chunkNonce(last)
+	if err != nil {
+		return err
+	}
+	// Decrypt into a separate buffer, so that the byte past the chunk is
+	// not overwritten.
+	pt, err := r.s.aead.Open(r.dec[:0], nonce, ct, nil)
+	if err != nil {
+		return err
+	}
+	r.pt = pt
+	if !last {
+		r.buf[0] = r.buf[encChunkSize]
+		r.n = 1
+	}
+	return nil
+}
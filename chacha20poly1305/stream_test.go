@@ -0,0 +1,149 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func sealStream(t *testing.T, key, nonce, plaintext []byte, writeSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(key, nonce, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := plaintext; len(p) > 0; {
+		n := writeSize
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openStream(key, nonce, ciphertext []byte) ([]byte, error) {
+	r, err := NewReader(key, nonce, bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := make([]byte, KeySize)
+	nonce := make([]byte, StreamNonceSize)
+	cryptorand.Read(key)
+	cryptorand.Read(nonce)
+
+	for _, size := range []int{0, 1, 1000, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 17} {
+		plaintext := make([]byte, size)
+		cryptorand.Read(plaintext)
+		for _, writeSize := range []int{1000, StreamChunkSize, 5 * StreamChunkSize} {
+			ct := sealStream(t, key, nonce, plaintext, writeSize)
+			chunks := (size + StreamChunkSize - 1) / StreamChunkSize
+			if chunks == 0 {
+				chunks = 1
+			}
+			if want := size + chunks*Overhead; len(ct) != want {
+				t.Errorf("size %d: got %d bytes of ciphertext, want %d", size, len(ct), want)
+			}
+
+			r, err := NewReader(key, nonce, iotest.HalfReader(bytes.NewReader(ct)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(iotest.OneByteReader(r))
+			if err != nil {
+				t.Fatalf("size %d, writes of %d: %v", size, writeSize, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("size %d, writes of %d: plaintext mismatch", size, writeSize)
+			}
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	key := make([]byte, KeySize)
+	nonce := make([]byte, StreamNonceSize)
+	plaintext := make([]byte, 2*StreamChunkSize+100)
+	ct := sealStream(t, key, nonce, plaintext, len(plaintext))
+
+	chunk := func(i int) []byte {
+		start := i * encChunkSize
+		end := start + encChunkSize
+		if end > len(ct) {
+			end = len(ct)
+		}
+		return ct[start:end]
+	}
+	concat := func(bs ...[]byte) []byte {
+		return bytes.Join(bs, nil)
+	}
+	flipped := append([]byte(nil), ct...)
+	flipped[StreamChunkSize+5] ^= 1
+
+	otherNonce := make([]byte, StreamNonceSize)
+	otherNonce[0] = 1
+	if _, err := openStream(key, otherNonce, ct); err == nil {
+		t.Error("opened a stream with the wrong nonce")
+	}
+
+	tests := []struct {
+		name string
+		ct   []byte
+	}{
+		{"empty", nil},
+		{"modified", flipped},
+		{"last chunk dropped", concat(chunk(0), chunk(1))},
+		{"last chunk truncated", ct[:len(ct)-1]},
+		{"chunks reordered", concat(chunk(1), chunk(0), chunk(2))},
+		{"chunk dropped", concat(chunk(0), chunk(2))},
+		{"trailing data", concat(ct, []byte{0})},
+		{"empty final chunk appended", concat(chunk(0), chunk(1), sealStream(t, key, nonce, nil, 1))},
+	}
+	for _, tt := range tests {
+		got, err := openStream(key, nonce, tt.ct)
+		if err == nil {
+			t.Errorf("%s: stream opened successfully", tt.name)
+		}
+		// Only authenticated prefix chunks may be returned.
+		if !bytes.Equal(got, plaintext[:len(got)]) || len(got)%StreamChunkSize != 0 {
+			t.Errorf("%s: got %d bytes of unexpected plaintext", tt.name, len(got))
+		}
+	}
+}
+
+func TestStreamBadParameters(t *testing.T) {
+	if _, err := NewWriter(make([]byte, KeySize), make([]byte, NonceSizeX), io.Discard); err == nil {
+		t.Error("NewWriter accepted a bad nonce length")
+	}
+	if _, err := NewReader(make([]byte, KeySize-1), make([]byte, StreamNonceSize), bytes.NewReader(nil)); err == nil {
+		t.Error("NewReader accepted a bad key length")
+	}
+
+	w, err := NewWriter(make([]byte, KeySize), make([]byte, StreamNonceSize), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
@@ -5,11 +5,18 @@
 package cryptobyte
 
 import (
+	"bytes"
 	encoding_asn1 "encoding/asn1"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
+	"math/bits"
 	"reflect"
+	"sort"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/gitpod-io/golang-crypto/cryptobyte/asn1"
 )
@@ -106,8 +113,10 @@ func (b *Builder) AddASN1OctetString(bytes []byte) {
 
 const generalizedTimeFormatStr = "20060102150405Z0700"
 
-// AddASN1GeneralizedTime appends a DER-encoded ASN.1 GENERALIZEDTIME.
+// AddASN1GeneralizedTime appends a DER-encoded ASN.1 GENERALIZEDTIME. The
+// time is converted to UTC, as required by DER.
 func (b *Builder) AddASN1GeneralizedTime(t time.Time) {
+	t = t.UTC()
 	if t.Year() < 0 || t.Year() > 9999 {
 		b.err = fmt.Errorf("cryptobyte: cannot represent %v as a GeneralizedTime", t)
 		return
@@ -117,8 +126,10 @@ func (b *Builder) AddASN1GeneralizedTime(t time.Time) {
 	})
 }
 
-// AddASN1UTCTime appends a DER-encoded ASN.1 UTCTime.
+// AddASN1UTCTime appends a DER-encoded ASN.1 UTCTime. The time is converted
+// to UTC, as required by DER.
 func (b *Builder) AddASN1UTCTime(t time.Time) {
+	t = t.UTC()
 	b.AddASN1(asn1.UTCTime, func(c *Builder) {
 		// As utilized by the X.509 profile, UTCTime can only
 		// represent the years 1950 through 2049.
@@ -130,6 +141,82 @@ func (b *Builder) AddASN1UTCTime(t time.Time) {
 	})
 }
 
+// AddASN1BMPString appends a DER-encoded ASN.1 BMPString, which holds the
+// UCS-2 big-endian encoding of s. It records an error if s is not valid
+// UTF-8 or contains characters outside the Basic Multilingual Plane.
+func (b *Builder) AddASN1BMPString(s string) {
+	if !utf8.ValidString(s) {
+		b.err = fmt.Errorf("cryptobyte: invalid UTF-8 in BMPString %q", s)
+		return
+	}
+	b.AddASN1(asn1.BMPString, func(c *Builder) {
+		for _, r := range s {
+			if r > 0xffff || utf16.IsSurrogate(r) {
+				b.err = fmt.Errorf("cryptobyte: cannot represent %q in a BMPString", r)
+				return
+			}
+			c.AddUint16(uint16(r))
+		}
+	})
+}
+
+// The special values of REAL, see X.690, Section 8.5.9.
+const (
+	realPlusInfinity  = 0x40
+	realMinusInfinity = 0x41
+	realNaN           = 0x42
+	realMinusZero     = 0x43
+)
+
+// AddASN1Real appends a DER-encoded ASN.1 REAL. Finite non-zero values are
+// encoded in base 2 with an odd mantissa, as required by X.690, Section
+// 11.3.1.
+func (b *Builder) AddASN1Real(v float64) {
+	b.AddASN1(asn1.REAL, func(c *Builder) {
+		c.AddBytes(appendASN1Real(nil, v))
+	})
+}
+
+func appendASN1Real(dst []byte, v float64) []byte {
+	switch {
+	case v == 0 && !math.Signbit(v):
+		return dst
+	case v == 0:
+		return append(dst, realMinusZero)
+	case math.IsInf(v, 1):
+		return append(dst, realPlusInfinity)
+	case math.IsInf(v, -1):
+		return append(dst, realMinusInfinity)
+	case math.IsNaN(v):
+		return append(dst, realNaN)
+	}
+
+	first := byte(0x80) // binary encoding, base 2, scaling factor 0
+	if v < 0 {
+		first |= 0x40
+		v = -v
+	}
+	// v = frac × 2^exp with frac in [0.5, 1), so frac × 2^53 is an integer.
+	frac, exp := math.Frexp(v)
+	mantissa := uint64(frac * (1 << 53))
+	exp -= 53
+	tz := bits.TrailingZeros64(mantissa)
+	mantissa >>= uint(tz)
+	exp += tz
+
+	if exp >= -128 && exp <= 127 {
+		dst = append(dst, first, byte(exp))
+	} else {
+		// The exponent of a float64 always fits in two octets.
+		dst = append(dst, first|0x01, byte(exp>>8), byte(exp))
+	}
+	n := (bits.Len64(mantissa) + 7) / 8
+	for i := n - 1; i >= 0; i-- {
+		dst = append(dst, byte(mantissa>>(8*uint(i))))
+	}
+	return dst
+}
+
 // AddASN1BitString appends a DER-encoded ASN.1 BIT STRING. This does not
 // support BIT STRINGs that are not a whole number of bytes.
 func (b *Builder) AddASN1BitString(data []byte) {
@@ -241,6 +328,33 @@ func (b *Builder) AddASN1(tag asn1.Tag, f BuilderContinuation) {
 	b.addLengthPrefixed(1, true, f)
 }
 
+// AddASN1SetOf appends a DER-encoded ASN.1 SET OF. The child builder passed
+// to the BuilderContinuation is used to build the elements of the set, which
+// must each be a complete ASN.1 element. They are sorted in ascending order
+// of their encodings, as required by DER (X.690, section 11.6), so they may
+// be added in any order.
+func (b *Builder) AddASN1SetOf(f BuilderContinuation) {
+	b.AddASN1(asn1.SET, func(b *Builder) {
+		child := &Builder{inContinuation: b.inContinuation}
+		f(child)
+		if child.err != nil {
+			b.err = child.err
+			return
+		}
+		elements, ok := splitASN1Elements(String(child.result))
+		if !ok {
+			b.err = errors.New("cryptobyte: invalid ASN.1 element in SET OF")
+			return
+		}
+		sort.SliceStable(elements, func(i, j int) bool {
+			return bytes.Compare(elements[i], elements[j]) < 0
+		})
+		for _, e := range elements {
+			b.AddBytes(e)
+		}
+	})
+}
+
 // String
 
 // ReadASN1Boolean decodes an ASN.1 BOOLEAN and converts it to a boolean
@@ -545,6 +659,93 @@ func (s *String) ReadASN1UTCTime(out *time.Time) bool {
 	return true
 }
 
+// ReadASN1BMPString decodes an ASN.1 BMPString into out and advances. It
+// reports whether the read was successful. Surrogate code points, which
+// UCS-2 cannot represent, are rejected.
+func (s *String) ReadASN1BMPString(out *string) bool {
+	var bytes String
+	if !s.ReadASN1(&bytes, asn1.BMPString) || len(bytes)%2 != 0 {
+		return false
+	}
+	runes := make([]rune, 0, len(bytes)/2)
+	for len(bytes) > 0 {
+		var c uint16
+		bytes.ReadUint16(&c)
+		if utf16.IsSurrogate(rune(c)) {
+			return false
+		}
+		runes = append(runes, rune(c))
+	}
+	*out = string(runes)
+	return true
+}
+
+// ReadASN1Real decodes an ASN.1 REAL into out and advances. It reports
+// whether the read was successful. Only the DER encodings produced by
+// AddASN1Real are accepted, so values that are not exactly representable
+// as a float64, and decimal encodings, are rejected.
+func (s *String) ReadASN1Real(out *float64) bool {
+	var bytes String
+	if !s.ReadASN1(&bytes, asn1.REAL) {
+		return false
+	}
+	var v float64
+	switch {
+	case len(bytes) == 0:
+		v = 0
+	case len(bytes) == 1:
+		switch bytes[0] {
+		case realPlusInfinity:
+			v = math.Inf(1)
+		case realMinusInfinity:
+			v = math.Inf(-1)
+		case realNaN:
+			v = math.NaN()
+		case realMinusZero:
+			v = math.Copysign(0, -1)
+		default:
+			return false
+		}
+	default:
+		first := bytes[0]
+		// Binary encoding, base 2, scaling factor 0, and a one or two
+		// octet exponent.
+		if first&0xbc != 0x80 || first&0x03 > 1 {
+			return false
+		}
+		expLen := int(first&0x03) + 1
+		if len(bytes) <= 1+expLen {
+			return false
+		}
+		exp := int(int8(bytes[1]))
+		if expLen == 2 {
+			exp = exp<<8 | int(bytes[2])
+		}
+		mantissa := bytes[1+expLen:]
+		if len(mantissa) > 7 {
+			return false
+		}
+		var n uint64
+		for _, c := range mantissa {
+			n = n<<8 | uint64(c)
+		}
+		if n >= 1<<53 {
+			return false
+		}
+		v = math.Ldexp(float64(n), exp)
+		if first&0x40 != 0 {
+			v = -v
+		}
+	}
+	// Only accept the canonical encoding, which also rejects values that
+	// were rounded, and non-minimal exponents and mantissas.
+	if string(appendASN1Real(nil, v)) != string(bytes) {
+		return false
+	}
+	*out = v
+	return true
+}
+
 // ReadASN1BitString decodes an ASN.1 BIT STRING into out and advances.
 // It reports whether the read was successful.
 func (s *String) ReadASN1BitString(out *encoding_asn1.BitString) bool {
@@ -604,6 +805,46 @@ func (s *String) ReadASN1(out *String, tag asn1.Tag) bool {
 	return true
 }
 
+// ReadASN1SetOf reads the contents of a DER-encoded ASN.1 SET OF (not
+// including tag and length bytes) into out, and advances. The contents must
+// be a sequence of ASN.1 elements in ascending order of their encodings, as
+// required by DER. It reports whether the read was successful.
+//
+// To accept the elements in any order, as in BER, use ReadASN1 with
+// asn1.SET instead.
+func (s *String) ReadASN1SetOf(out *String) bool {
+	var contents String
+	if !s.ReadASN1(&contents, asn1.SET) {
+		return false
+	}
+	elements, ok := splitASN1Elements(contents)
+	if !ok {
+		return false
+	}
+	for i := 1; i < len(elements); i++ {
+		if bytes.Compare(elements[i-1], elements[i]) > 0 {
+			return false
+		}
+	}
+	*out = contents
+	return true
+}
+
+// splitASN1Elements returns the ASN.1 elements of s, including their tag and
+// length bytes.
+func splitASN1Elements(s String) ([][]byte, bool) {
+	var elements [][]byte
+	for !s.Empty() {
+		var e String
+		var tag asn1.Tag
+		if !s.ReadAnyASN1Element(&e, &tag) {
+			return nil, false
+		}
+		elements = append(elements, e)
+	}
+	return elements, true
+}
+
 // ReadASN1Element reads the contents of a DER-encoded ASN.1 element (including
 // tag and length bytes) into out, and advances. The element must match the
 // given tag. It reports whether the read was successful.
@@ -33,6 +33,7 @@ const (
 	OCTET_STRING      = Tag(4)
 	NULL              = Tag(5)
 	OBJECT_IDENTIFIER = Tag(6)
+	REAL              = Tag(9)
 	ENUM              = Tag(10)
 	UTF8String        = Tag(12)
 	SEQUENCE          = Tag(16 | classConstructed)
@@ -43,4 +44,5 @@ const (
 	UTCTime           = Tag(23)
 	GeneralizedTime   = Tag(24)
 	GeneralString     = Tag(27)
+	BMPString         = Tag(30)
 )
@@ -7,6 +7,7 @@ package cryptobyte
 import (
 	"bytes"
 	encoding_asn1 "encoding/asn1"
+	"math"
 	"math/big"
 	"reflect"
 	"testing"
@@ -394,6 +395,129 @@ func TestReadASN1UTCTime(t *testing.T) {
 	}
 }
 
+func TestAddASN1TimeUTC(t *testing.T) {
+	in := time.Date(2010, 01, 02, 03, 04, 05, 0, time.FixedZone("", -2*60*60))
+	var b Builder
+	b.AddASN1GeneralizedTime(in)
+	b.AddASN1UTCTime(in)
+	got, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{byte(asn1.GeneralizedTime), 15}
+	want = append(want, "20100102050405Z"...)
+	want = append(want, byte(asn1.UTCTime), 13)
+	want = append(want, "100102050405Z"...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestASN1BMPString(t *testing.T) {
+	testData := []struct {
+		in  string
+		der []byte
+	}{
+		{"", []byte{0x1e, 0x00}},
+		{"abc", []byte{0x1e, 0x06, 0x00, 'a', 0x00, 'b', 0x00, 'c'}},
+		{"é€", []byte{0x1e, 0x04, 0x00, 0xe9, 0x20, 0xac}},
+	}
+	for i, test := range testData {
+		var b Builder
+		b.AddASN1BMPString(test.in)
+		got, err := b.Bytes()
+		if err != nil || !bytes.Equal(got, test.der) {
+			t.Errorf("#%d: AddASN1BMPString(%q) = %x, %v; want %x", i, test.in, got, err, test.der)
+		}
+		var out string
+		in := String(test.der)
+		if !in.ReadASN1BMPString(&out) || out != test.in {
+			t.Errorf("#%d: ReadASN1BMPString(%x) = %q; want %q", i, test.der, out, test.in)
+		}
+	}
+
+	for _, in := range []string{"\U0001F600", "\xff"} {
+		var b Builder
+		b.AddASN1BMPString(in)
+		if _, err := b.Bytes(); err == nil {
+			t.Errorf("AddASN1BMPString(%q) succeeded", in)
+		}
+	}
+	for _, der := range [][]byte{
+		{0x1e, 0x01, 0x00},
+		{0x1e, 0x02, 0xd8, 0x3d},
+		{0x0c, 0x02, 0x00, 'a'},
+	} {
+		var out string
+		in := String(der)
+		if in.ReadASN1BMPString(&out) {
+			t.Errorf("ReadASN1BMPString(%x) succeeded", der)
+		}
+	}
+}
+
+func TestASN1Real(t *testing.T) {
+	testData := []struct {
+		in  float64
+		der []byte
+	}{
+		{0, []byte{0x09, 0x00}},
+		{math.Copysign(0, -1), []byte{0x09, 0x01, 0x43}},
+		{math.Inf(1), []byte{0x09, 0x01, 0x40}},
+		{math.Inf(-1), []byte{0x09, 0x01, 0x41}},
+		{1, []byte{0x09, 0x03, 0x80, 0x00, 0x01}},
+		{0.5, []byte{0x09, 0x03, 0x80, 0xff, 0x01}},
+		{-2.5, []byte{0x09, 0x03, 0xc0, 0xff, 0x05}},
+		{1024, []byte{0x09, 0x03, 0x80, 0x0a, 0x01}},
+		{3 << 20, []byte{0x09, 0x03, 0x80, 0x14, 0x03}},
+		{300, []byte{0x09, 0x03, 0x80, 0x02, 0x4b}},
+		{math.SmallestNonzeroFloat64, []byte{0x09, 0x04, 0x81, 0xfb, 0xce, 0x01}},
+		{math.MaxFloat64, []byte{0x09, 0x0a, 0x81, 0x03, 0xcb, 0x1f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for i, test := range testData {
+		var b Builder
+		b.AddASN1Real(test.in)
+		got, err := b.Bytes()
+		if err != nil || !bytes.Equal(got, test.der) {
+			t.Errorf("#%d: AddASN1Real(%v) = %x, %v; want %x", i, test.in, got, err, test.der)
+		}
+		var out float64
+		in := String(test.der)
+		if !in.ReadASN1Real(&out) || out != test.in || math.Signbit(out) != math.Signbit(test.in) {
+			t.Errorf("#%d: ReadASN1Real(%x) = %v; want %v", i, test.der, out, test.in)
+		}
+	}
+
+	var b Builder
+	b.AddASN1Real(math.NaN())
+	der, _ := b.Bytes()
+	var out float64
+	if in := String(der); !in.ReadASN1Real(&out) || !math.IsNaN(out) {
+		t.Errorf("NaN encoded as %x, read back as %v", der, out)
+	}
+
+	for _, der := range [][]byte{
+		{0x09, 0x01, 0x44},                                                       // unknown special value
+		{0x09, 0x03, 0x80, 0x00, 0x02},                                           // even mantissa
+		{0x09, 0x04, 0x80, 0x00, 0x00, 0x01},                                     // mantissa with a leading zero
+		{0x09, 0x04, 0x81, 0x00, 0x00, 0x01},                                     // non-minimal exponent
+		{0x09, 0x03, 0x90, 0x00, 0x01},                                           // base 8
+		{0x09, 0x03, 0x84, 0x00, 0x01},                                           // scaling factor
+		{0x09, 0x02, 0x80, 0x00},                                                 // missing mantissa
+		{0x09, 0x04, 0x03, '1', '.', 'E'},                                        // decimal encoding
+		{0x09, 0x05, 0x82, 0x01, 0x00, 0x00, 0x01},                               // three octet exponent
+		{0x09, 0x0a, 0x80, 0x00, 0x3f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // inexact mantissa
+		{0x09, 0x04, 0x81, 0x04, 0x00, 0x01},                                     // overflow
+		{0x04, 0x00},                                                             // wrong tag
+	} {
+		var out float64
+		in := String(der)
+		if in.ReadASN1Real(&out) {
+			t.Errorf("ReadASN1Real(%x) succeeded with %v", der, out)
+		}
+	}
+}
+
 func TestReadASN1BitString(t *testing.T) {
 	testData := []struct {
 		in  []byte
@@ -455,3 +579,94 @@ func TestReadASN1Boolean(t *testing.T) {
 		}
 	}
 }
+
+func TestAddASN1SetOf(t *testing.T) {
+	var b Builder
+	b.AddASN1SetOf(func(b *Builder) {
+		b.AddASN1Int64(256)
+		b.AddASN1OctetString([]byte{1})
+		b.AddASN1Int64(2)
+		b.AddASN1Int64(-1)
+		b.AddASN1Int64(2)
+	})
+	got, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x31, 16,
+		0x02, 0x01, 0x02,
+		0x02, 0x01, 0x02,
+		0x02, 0x01, 0xff,
+		0x02, 0x02, 0x01, 0x00,
+		0x04, 0x01, 0x01,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	// The result matches encoding/asn1.
+	set := struct {
+		Set []int `asn1:"set"`
+	}{[]int{300, 1, 70000, -5}}
+	stdlib, err := encoding_asn1.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = Builder{}
+	b.AddASN1(asn1.SEQUENCE, func(b *Builder) {
+		b.AddASN1SetOf(func(b *Builder) {
+			for _, v := range set.Set {
+				b.AddASN1Int64(int64(v))
+			}
+		})
+	})
+	if got, err := b.Bytes(); err != nil || !bytes.Equal(got, stdlib) {
+		t.Errorf("got %x, %v, want %x", got, err, stdlib)
+	}
+}
+
+func TestAddASN1SetOfInvalid(t *testing.T) {
+	var b Builder
+	b.AddASN1SetOf(func(b *Builder) {
+		b.AddASN1Int64(1)
+		b.AddUint8(0x02)
+	})
+	if _, err := b.Bytes(); err == nil {
+		t.Error("AddASN1SetOf accepted a truncated element")
+	}
+
+	b = Builder{}
+	b.AddASN1SetOf(func(b *Builder) {
+		b.AddASN1(asn1.Tag(0x1f), func(b *Builder) {})
+	})
+	if _, err := b.Bytes(); err == nil {
+		t.Error("AddASN1SetOf ignored an error of its child builder")
+	}
+}
+
+func TestReadASN1SetOf(t *testing.T) {
+	testData := []struct {
+		in []byte
+		ok bool
+	}{
+		{[]byte{0x31, 0}, true},
+		{[]byte{0x31, 6, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}, true},
+		{[]byte{0x31, 6, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01}, true},
+		{[]byte{0x31, 6, 0x02, 0x01, 0x02, 0x02, 0x01, 0x01}, false},
+		{[]byte{0x31, 7, 0x02, 0x02, 0x01, 0x00, 0x02, 0x01, 0x7f}, false},
+		{[]byte{0x31, 4, 0x02, 0x01, 0x01, 0x02}, false},
+		{[]byte{0x30, 3, 0x02, 0x01, 0x01}, false},
+	}
+	for i, test := range testData {
+		in := String(test.in)
+		var out String
+		ok := in.ReadASN1SetOf(&out)
+		if ok != test.ok {
+			t.Errorf("#%d: in.ReadASN1SetOf() = %v, want %v", i, ok, test.ok)
+			continue
+		}
+		if ok && (!bytes.Equal(out, test.in[2:]) || !in.Empty()) {
+			t.Errorf("#%d: got contents %x and %d trailing bytes", i, out, len(in))
+		}
+	}
+}
@@ -29,6 +29,9 @@ type Builder struct {
 	pendingLenLen  int
 	pendingIsASN1  bool
 	inContinuation *bool
+
+	pendingIsCBOR   bool
+	pendingCBORType CBORType
 }
 
 // NewBuilder creates a Builder that appends its output to the given buffer.
@@ -274,6 +277,17 @@ func (b *Builder) flushChild() {
 		child.pendingLenLen = extraBytes
 	}
 
+	if child.pendingIsCBOR {
+		// For CBOR, we reserved a single byte for the head, which is replaced
+		// by the head once the number of items is known. See
+		// finishCBORChild.
+		if err := child.finishCBORChild(child.pendingCBORType); err != nil {
+			b.err = err
+			return
+		}
+		length = 0
+	}
+
 	l := length
 	for i := child.pendingLenLen - 1; i >= 0; i-- {
 		child.result[child.offset+i] = uint8(l)
@@ -0,0 +1,533 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cryptobyte
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// This file implements the deterministic encoding of CBOR, as specified in
+// RFC 8949, Section 4.2.1: all lengths are definite and encoded in the
+// shortest form, and map keys are sorted by the bytewise lexicographic order
+// of their encodings, without duplicates. Floating-point numbers and simple
+// values other than false, true and null are not supported.
+
+// CBORType is the major type of a CBOR data item.
+type CBORType uint8
+
+// The CBOR major types of RFC 8949, Section 3.1.
+const (
+	CBORTypeUnsigned CBORType = 0
+	CBORTypeNegative CBORType = 1
+	CBORTypeBytes    CBORType = 2
+	CBORTypeText     CBORType = 3
+	CBORTypeArray    CBORType = 4
+	CBORTypeMap      CBORType = 5
+	CBORTypeTag      CBORType = 6
+	CBORTypeSimple   CBORType = 7
+)
+
+const (
+	cborFalse = 0xf4
+	cborTrue  = 0xf5
+	cborNull  = 0xf6
+)
+
+// maxCBORDepth limits the nesting of arrays, maps and tags accepted by the
+// String methods.
+const maxCBORDepth = 64
+
+// appendCBORHead appends the initial bytes of a data item of type t, with
+// argument n, to dst.
+func appendCBORHead(dst []byte, t CBORType, n uint64) []byte {
+	m := byte(t) << 5
+	switch {
+	case n < 24:
+		return append(dst, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(dst, m|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(dst, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		return append(dst, m|27, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+			byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func (b *Builder) addCBORHead(t CBORType, n uint64) {
+	var buf [9]byte
+	b.add(appendCBORHead(buf[:0], t, n)...)
+}
+
+// AddCBORUint64 appends a CBOR unsigned integer.
+func (b *Builder) AddCBORUint64(v uint64) {
+	b.addCBORHead(CBORTypeUnsigned, v)
+}
+
+// AddCBORInt64 appends a CBOR integer, which is unsigned if v is not
+// negative.
+func (b *Builder) AddCBORInt64(v int64) {
+	if v < 0 {
+		b.addCBORHead(CBORTypeNegative, uint64(-1-v))
+		return
+	}
+	b.addCBORHead(CBORTypeUnsigned, uint64(v))
+}
+
+// AddCBORBytes appends a CBOR byte string.
+func (b *Builder) AddCBORBytes(v []byte) {
+	b.addCBORHead(CBORTypeBytes, uint64(len(v)))
+	b.add(v...)
+}
+
+// AddCBORText appends a CBOR text string. It is an error if v is not valid
+// UTF-8.
+func (b *Builder) AddCBORText(v string) {
+	if b.err != nil {
+		return
+	}
+	if !utf8.ValidString(v) {
+		b.err = errors.New("cryptobyte: CBOR text string is not valid UTF-8")
+		return
+	}
+	b.addCBORHead(CBORTypeText, uint64(len(v)))
+	b.add([]byte(v)...)
+}
+
+// AddCBORBool appends a CBOR false or true.
+func (b *Builder) AddCBORBool(v bool) {
+	if v {
+		b.add(cborTrue)
+	} else {
+		b.add(cborFalse)
+	}
+}
+
+// AddCBORNull appends a CBOR null.
+func (b *Builder) AddCBORNull() {
+	b.add(cborNull)
+}
+
+// AddCBORByteString appends a CBOR byte string, whose contents are built by
+// the BuilderContinuation. This is useful for byte strings that wrap CBOR
+// data items, such as the protected headers of COSE.
+func (b *Builder) AddCBORByteString(f BuilderContinuation) {
+	b.addCBORPrefixed(CBORTypeBytes, f)
+}
+
+// AddCBORArray appends a CBOR array. The elements of the array are the data
+// items appended by the BuilderContinuation, and the number of elements is
+// computed when it returns.
+func (b *Builder) AddCBORArray(f BuilderContinuation) {
+	b.addCBORPrefixed(CBORTypeArray, f)
+}
+
+// AddCBORMap appends a CBOR map. The BuilderContinuation must append each key
+// followed by its value. The entries are sorted in the deterministic order
+// when it returns, so they can be appended in any order, but it is an error
+// to append the same key twice.
+func (b *Builder) AddCBORMap(f BuilderContinuation) {
+	b.addCBORPrefixed(CBORTypeMap, f)
+}
+
+// AddCBORTag appends a CBOR tag. The BuilderContinuation must append exactly
+// one data item, which is the tag content.
+func (b *Builder) AddCBORTag(tag uint64, f BuilderContinuation) {
+	if b.err != nil {
+		return
+	}
+	b.addCBORHead(CBORTypeTag, tag)
+	b.addCBORPrefixed(cborTagContent, f)
+}
+
+// cborTagContent is used for the pending child of AddCBORTag, which doesn't
+// have its own head.
+const cborTagContent CBORType = 0xff
+
+func (b *Builder) addCBORPrefixed(t CBORType, f BuilderContinuation) {
+	// Subsequent writes can be ignored if the builder has encountered an error.
+	if b.err != nil {
+		return
+	}
+
+	// Reserve a byte for the head, which is fixed up by flushChild.
+	offset := len(b.result)
+	b.add(0)
+
+	if b.inContinuation == nil {
+		b.inContinuation = new(bool)
+	}
+
+	b.child = &Builder{
+		result:          b.result,
+		fixedSize:       b.fixedSize,
+		offset:          offset,
+		pendingLenLen:   1,
+		pendingIsCBOR:   true,
+		pendingCBORType: t,
+		inContinuation:  b.inContinuation,
+	}
+
+	b.callContinuation(f, b.child)
+	b.flushChild()
+	if b.child != nil {
+		panic("cryptobyte: internal error")
+	}
+}
+
+// finishCBORChild replaces the byte reserved at the start of child with the
+// head of the data item of type t that holds the contents of child.
+func (child *Builder) finishCBORChild(t CBORType) error {
+	start := child.offset + child.pendingLenLen
+	contents := child.result[start:]
+
+	var n uint64
+	switch t {
+	case CBORTypeBytes:
+		n = uint64(len(contents))
+	case CBORTypeArray, CBORTypeMap, cborTagContent:
+		s := String(contents)
+		for !s.Empty() {
+			if !s.skipCBOR(0) {
+				return errors.New("cryptobyte: invalid CBOR data item in pending child")
+			}
+			n++
+		}
+		if t == cborTagContent && n != 1 {
+			return errors.New("cryptobyte: CBOR tag must contain exactly one data item")
+		}
+		if t == CBORTypeMap {
+			if n%2 != 0 {
+				return errors.New("cryptobyte: CBOR map has a key without a value")
+			}
+			n /= 2
+			if err := sortCBORMap(contents); err != nil {
+				return err
+			}
+		}
+	default:
+		panic("cryptobyte: internal error")
+	}
+
+	if t == cborTagContent {
+		// No head: remove the reserved byte.
+		copy(child.result[child.offset:], contents)
+		child.result = child.result[:len(child.result)-1]
+		child.pendingLenLen = 0
+		return nil
+	}
+
+	var buf [9]byte
+	head := appendCBORHead(buf[:0], t, n)
+	if extraBytes := len(head) - 1; extraBytes != 0 {
+		child.add(make([]byte, extraBytes)...)
+		if child.err != nil {
+			return child.err
+		}
+		copy(child.result[start+extraBytes:], child.result[start:])
+	}
+	copy(child.result[child.offset:], head)
+	child.pendingLenLen = 0
+	return nil
+}
+
+// sortCBORMap sorts the entries of the encoded map contents in place, and
+// checks that the keys are unique.
+func sortCBORMap(contents []byte) error {
+	type entry struct{ key, item []byte }
+	var entries []entry
+	sorted := true
+	s := String(contents)
+	for !s.Empty() {
+		rest := s
+		if !s.skipCBOR(0) {
+			panic("cryptobyte: internal error")
+		}
+		key := rest[:len(rest)-len(s)]
+		if !s.skipCBOR(0) {
+			panic("cryptobyte: internal error")
+		}
+		e := entry{key: key, item: rest[:len(rest)-len(s)]}
+		if len(entries) > 0 {
+			switch bytes.Compare(entries[len(entries)-1].key, key) {
+			case 0:
+				return errors.New("cryptobyte: duplicate CBOR map key")
+			case 1:
+				sorted = false
+			}
+		}
+		entries = append(entries, e)
+	}
+	if sorted {
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	buf := make([]byte, 0, len(contents))
+	for i, e := range entries {
+		if i > 0 && bytes.Equal(entries[i-1].key, e.key) {
+			return errors.New("cryptobyte: duplicate CBOR map key")
+		}
+		buf = append(buf, e.item...)
+	}
+	copy(contents, buf)
+	return nil
+}
+
+// String
+
+// readCBORHead decodes the initial bytes of a data item into t and n, and
+// advances over them. It rejects indefinite lengths, reserved values,
+// unsupported simple values, and arguments that are not encoded in the
+// shortest form.
+func (s *String) readCBORHead(t *CBORType, n *uint64) bool {
+	if len(*s) < 1 {
+		return false
+	}
+	typ, info := CBORType((*s)[0]>>5), (*s)[0]&0x1f
+
+	var v uint64
+	var argLen int
+	switch {
+	case info < 24:
+		v = uint64(info)
+	case info <= 27:
+		argLen = 1 << (info - 24)
+		if len(*s) < 1+argLen {
+			return false
+		}
+		for _, c := range (*s)[1 : 1+argLen] {
+			v = v<<8 | uint64(c)
+		}
+		// The argument must not fit in a shorter encoding.
+		if (argLen == 1 && v < 24) || (argLen > 1 && v>>(4*argLen) == 0) {
+			return false
+		}
+	default:
+		return false
+	}
+	if typ == CBORTypeSimple && (argLen != 0 || v < cborFalse&0x1f || v > cborNull&0x1f) {
+		return false
+	}
+
+	*s = (*s)[1+argLen:]
+	*t, *n = typ, v
+	return true
+}
+
+// skipCBOR advances over a data item, and reports whether it is valid and
+// deterministically encoded, including any nested data items.
+func (s *String) skipCBOR(depth int) bool {
+	rest := *s
+	var t CBORType
+	var n uint64
+	if !rest.readCBORHead(&t, &n) {
+		return false
+	}
+	switch t {
+	case CBORTypeBytes, CBORTypeText:
+		if n > uint64(len(rest)) {
+			return false
+		}
+		if t == CBORTypeText && !utf8.Valid(rest[:n]) {
+			return false
+		}
+		rest = rest[n:]
+	case CBORTypeArray, CBORTypeTag:
+		if depth >= maxCBORDepth {
+			return false
+		}
+		if t == CBORTypeTag {
+			n = 1
+		}
+		for ; n > 0; n-- {
+			if !rest.skipCBOR(depth + 1) {
+				return false
+			}
+		}
+	case CBORTypeMap:
+		if depth >= maxCBORDepth {
+			return false
+		}
+		var prevKey []byte
+		for ; n > 0; n-- {
+			key := rest
+			if !rest.skipCBOR(depth + 1) {
+				return false
+			}
+			key = key[:len(key)-len(rest)]
+			if prevKey != nil && bytes.Compare(prevKey, key) >= 0 {
+				return false
+			}
+			prevKey = key
+			if !rest.skipCBOR(depth + 1) {
+				return false
+			}
+		}
+	}
+	*s = rest
+	return true
+}
+
+// SkipCBOR advances over a CBOR data item and reports whether it was
+// successful. The data item, including any nested data items, must be
+// deterministically encoded.
+func (s *String) SkipCBOR() bool {
+	return s.skipCBOR(0)
+}
+
+// PeekCBORType reports whether the next data item is of type t.
+func (s String) PeekCBORType(t CBORType) bool {
+	return len(s) > 0 && CBORType(s[0]>>5) == t
+}
+
+// readCBORHeadOf decodes the head of a data item of type t into n, and
+// advances over it.
+func (s *String) readCBORHeadOf(t CBORType, n *uint64) bool {
+	rest := *s
+	var typ CBORType
+	if !rest.readCBORHead(&typ, n) || typ != t {
+		return false
+	}
+	*s = rest
+	return true
+}
+
+// ReadCBORUint64 decodes a CBOR unsigned integer into out and advances over
+// it. It reports whether the read was successful.
+func (s *String) ReadCBORUint64(out *uint64) bool {
+	return s.readCBORHeadOf(CBORTypeUnsigned, out)
+}
+
+// ReadCBORInt64 decodes a CBOR unsigned or negative integer into out and
+// advances over it. It reports whether the read was successful, which it
+// isn't if the integer doesn't fit in an int64.
+func (s *String) ReadCBORInt64(out *int64) bool {
+	rest := *s
+	var t CBORType
+	var n uint64
+	if !rest.readCBORHead(&t, &n) || n > math.MaxInt64 {
+		return false
+	}
+	switch t {
+	case CBORTypeUnsigned:
+		*out = int64(n)
+	case CBORTypeNegative:
+		*out = -1 - int64(n)
+	default:
+		return false
+	}
+	*s = rest
+	return true
+}
+
+// ReadCBORBytes reads a CBOR byte string into out and advances over it. It
+// reports whether the read was successful. out aliases s.
+func (s *String) ReadCBORBytes(out *[]byte) bool {
+	rest := *s
+	var n uint64
+	if !rest.readCBORHeadOf(CBORTypeBytes, &n) || n > uint64(len(rest)) {
+		return false
+	}
+	*out = rest[:n]
+	*s = rest[n:]
+	return true
+}
+
+// ReadCBORText reads a CBOR text string into out and advances over it. It
+// reports whether the read was successful.
+func (s *String) ReadCBORText(out *string) bool {
+	rest := *s
+	var n uint64
+	if !rest.readCBORHeadOf(CBORTypeText, &n) || n > uint64(len(rest)) || !utf8.Valid(rest[:n]) {
+		return false
+	}
+	*out = string(rest[:n])
+	*s = rest[n:]
+	return true
+}
+
+// ReadCBORBool decodes a CBOR false or true into out and advances over it.
+// It reports whether the read was successful.
+func (s *String) ReadCBORBool(out *bool) bool {
+	if len(*s) < 1 || ((*s)[0] != cborFalse && (*s)[0] != cborTrue) {
+		return false
+	}
+	*out = (*s)[0] == cborTrue
+	*s = (*s)[1:]
+	return true
+}
+
+// ReadCBORNull advances over a CBOR null and reports whether it was
+// successful.
+func (s *String) ReadCBORNull() bool {
+	if len(*s) < 1 || (*s)[0] != cborNull {
+		return false
+	}
+	*s = (*s)[1:]
+	return true
+}
+
+// readCBORContainer reads a data item of type t, and sets out to the data
+// items it contains.
+func (s *String) readCBORContainer(t CBORType, out *String) bool {
+	if !s.PeekCBORType(t) {
+		return false
+	}
+	rest := *s
+	if !rest.skipCBOR(0) {
+		return false
+	}
+	contents := *s
+	var n uint64
+	if !contents.readCBORHeadOf(t, &n) {
+		panic("cryptobyte: internal error")
+	}
+	*out = contents[:len(contents)-len(rest)]
+	*s = rest
+	return true
+}
+
+// ReadCBORArray reads a CBOR array into out and advances over it. out
+// receives the encoded elements of the array, which can be read until out
+// is empty. It reports whether the read was successful.
+func (s *String) ReadCBORArray(out *String) bool {
+	return s.readCBORContainer(CBORTypeArray, out)
+}
+
+// ReadCBORMap reads a CBOR map into out and advances over it. out receives
+// the encoded entries of the map, each key followed by its value, in the
+// deterministic order. It reports whether the read was successful.
+func (s *String) ReadCBORMap(out *String) bool {
+	return s.readCBORContainer(CBORTypeMap, out)
+}
+
+// ReadCBORTag reads a CBOR tag into tag, and its content, which is a single
+// data item, into out, and advances over them. It reports whether the read
+// was successful.
+func (s *String) ReadCBORTag(tag *uint64, out *String) bool {
+	if !s.PeekCBORType(CBORTypeTag) {
+		return false
+	}
+	rest := *s
+	if !rest.skipCBOR(0) {
+		return false
+	}
+	contents := *s
+	if !contents.readCBORHeadOf(CBORTypeTag, tag) {
+		panic("cryptobyte: internal error")
+	}
+	*out = contents[:len(contents)-len(rest)]
+	*s = rest
+	return true
+}
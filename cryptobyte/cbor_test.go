@@ -0,0 +1,245 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cryptobyte
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 8949, Appendix A.
+func TestCBORBuilder(t *testing.T) {
+	tests := []struct {
+		name string
+		f    BuilderContinuation
+		want string
+	}{
+		{"0", func(b *Builder) { b.AddCBORUint64(0) }, "00"},
+		{"23", func(b *Builder) { b.AddCBORUint64(23) }, "17"},
+		{"24", func(b *Builder) { b.AddCBORUint64(24) }, "1818"},
+		{"1000", func(b *Builder) { b.AddCBORUint64(1000) }, "1903e8"},
+		{"1000000", func(b *Builder) { b.AddCBORUint64(1000000) }, "1a000f4240"},
+		{"1000000000000", func(b *Builder) { b.AddCBORUint64(1000000000000) }, "1b000000e8d4a51000"},
+		{"MaxUint64", func(b *Builder) { b.AddCBORUint64(math.MaxUint64) }, "1bffffffffffffffff"},
+		{"-1", func(b *Builder) { b.AddCBORInt64(-1) }, "20"},
+		{"-100", func(b *Builder) { b.AddCBORInt64(-100) }, "3863"},
+		{"-1000", func(b *Builder) { b.AddCBORInt64(-1000) }, "3903e7"},
+		{"MinInt64", func(b *Builder) { b.AddCBORInt64(math.MinInt64) }, "3b7fffffffffffffff"},
+		{"h''", func(b *Builder) { b.AddCBORBytes(nil) }, "40"},
+		{"h'01020304'", func(b *Builder) { b.AddCBORBytes([]byte{1, 2, 3, 4}) }, "4401020304"},
+		{`""`, func(b *Builder) { b.AddCBORText("") }, "60"},
+		{`"IETF"`, func(b *Builder) { b.AddCBORText("IETF") }, "6449455446"},
+		{`"ü"`, func(b *Builder) { b.AddCBORText("ü") }, "62c3bc"},
+		{"false", func(b *Builder) { b.AddCBORBool(false) }, "f4"},
+		{"true", func(b *Builder) { b.AddCBORBool(true) }, "f5"},
+		{"null", func(b *Builder) { b.AddCBORNull() }, "f6"},
+		{"[]", func(b *Builder) { b.AddCBORArray(func(b *Builder) {}) }, "80"},
+		{"[1, [2, 3], [4, 5]]", func(b *Builder) {
+			b.AddCBORArray(func(b *Builder) {
+				b.AddCBORUint64(1)
+				b.AddCBORArray(func(b *Builder) {
+					b.AddCBORUint64(2)
+					b.AddCBORUint64(3)
+				})
+				b.AddCBORArray(func(b *Builder) {
+					b.AddCBORUint64(4)
+					b.AddCBORUint64(5)
+				})
+			})
+		}, "8301820203820405"},
+		{"[1, ..., 25]", func(b *Builder) {
+			b.AddCBORArray(func(b *Builder) {
+				for i := uint64(1); i <= 25; i++ {
+					b.AddCBORUint64(i)
+				}
+			})
+		}, "98190102030405060708090a0b0c0d0e0f101112131415161718181819"},
+		{"{}", func(b *Builder) { b.AddCBORMap(func(b *Builder) {}) }, "a0"},
+		{`{"a": 1, "b": [2, 3]}`, func(b *Builder) {
+			b.AddCBORMap(func(b *Builder) {
+				b.AddCBORText("b")
+				b.AddCBORArray(func(b *Builder) {
+					b.AddCBORUint64(2)
+					b.AddCBORUint64(3)
+				})
+				b.AddCBORText("a")
+				b.AddCBORUint64(1)
+			})
+		}, "a26161016162820203"},
+		{"{1: 2, -1: 3, 10: 4}", func(b *Builder) {
+			// Deterministic order sorts by the encoded keys, so all
+			// unsigned integers come before the negative ones.
+			b.AddCBORMap(func(b *Builder) {
+				b.AddCBORInt64(-1)
+				b.AddCBORUint64(3)
+				b.AddCBORUint64(10)
+				b.AddCBORUint64(4)
+				b.AddCBORUint64(1)
+				b.AddCBORUint64(2)
+			})
+		}, "a301020a042003"},
+		{"1(1363896240)", func(b *Builder) {
+			b.AddCBORTag(1, func(b *Builder) { b.AddCBORUint64(1363896240) })
+		}, "c11a514b67b0"},
+		{"24(h'6449455446')", func(b *Builder) {
+			b.AddCBORTag(24, func(b *Builder) {
+				b.AddCBORByteString(func(b *Builder) { b.AddCBORText("IETF") })
+			})
+		}, "d818456449455446"},
+	}
+	for _, tt := range tests {
+		var b Builder
+		tt.f(&b)
+		got, err := b.Bytes()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if want := mustHex(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x, want %x", tt.name, got, want)
+		}
+		s := String(got)
+		if !s.SkipCBOR() || !s.Empty() {
+			t.Errorf("%s: SkipCBOR failed on %x", tt.name, got)
+		}
+	}
+}
+
+func TestCBORBuilderLongByteString(t *testing.T) {
+	content := bytes.Repeat([]byte{0xaa}, 300)
+	for _, b := range []*Builder{NewBuilder(nil), NewFixedBuilder(make([]byte, 0, 303))} {
+		b.AddCBORByteString(func(b *Builder) { b.AddBytes(content) })
+		got, err := b.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := append([]byte{0x59, 0x01, 0x2c}, content...); !bytes.Equal(got, want) {
+			t.Errorf("got %x, want %x", got, want)
+		}
+	}
+
+	b := NewFixedBuilder(make([]byte, 0, 302))
+	b.AddCBORByteString(func(b *Builder) { b.AddBytes(content) })
+	if _, err := b.Bytes(); err == nil {
+		t.Error("fixed builder accepted a head that doesn't fit")
+	}
+}
+
+func TestCBORBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		f    BuilderContinuation
+	}{
+		{"invalid UTF-8", func(b *Builder) { b.AddCBORText("\xff") }},
+		{"duplicate key", func(b *Builder) {
+			b.AddCBORMap(func(b *Builder) {
+				b.AddCBORUint64(1)
+				b.AddCBORNull()
+				b.AddCBORUint64(2)
+				b.AddCBORNull()
+				b.AddCBORUint64(1)
+				b.AddCBORNull()
+			})
+		}},
+		{"key without value", func(b *Builder) {
+			b.AddCBORMap(func(b *Builder) { b.AddCBORUint64(1) })
+		}},
+		{"empty tag", func(b *Builder) {
+			b.AddCBORTag(1, func(b *Builder) {})
+		}},
+		{"invalid array element", func(b *Builder) {
+			b.AddCBORArray(func(b *Builder) { b.AddUint8(0x1f) })
+		}},
+	}
+	for _, tt := range tests {
+		var b Builder
+		tt.f(&b)
+		if got, err := b.Bytes(); err == nil {
+			t.Errorf("%s: got %x, want an error", tt.name, got)
+		}
+	}
+}
+
+func TestCBORString(t *testing.T) {
+	// {"a": 1, "b": [2, -3, h'00', "x", true, null], 1(2)}
+	in := String(mustHex(t, "a2616101616286022241006178f5f6c102"))
+
+	var m, arr, tagged String
+	var key, text string
+	var u uint64
+	var i int64
+	var bs []byte
+	var bl bool
+	if !in.ReadCBORMap(&m) || !in.PeekCBORType(CBORTypeTag) {
+		t.Fatal("ReadCBORMap failed")
+	}
+	if !m.ReadCBORText(&key) || key != "a" || !m.ReadCBORUint64(&u) || u != 1 {
+		t.Fatalf("first entry: %q, %d", key, u)
+	}
+	if !m.ReadCBORText(&key) || key != "b" || !m.ReadCBORArray(&arr) || !m.Empty() {
+		t.Fatalf("second entry: %q", key)
+	}
+	if !arr.ReadCBORInt64(&i) || i != 2 || !arr.ReadCBORInt64(&i) || i != -3 {
+		t.Errorf("integers: got %d", i)
+	}
+	if !arr.ReadCBORBytes(&bs) || !bytes.Equal(bs, []byte{0}) || !arr.ReadCBORText(&text) || text != "x" {
+		t.Errorf("strings: got %x, %q", bs, text)
+	}
+	if !arr.ReadCBORBool(&bl) || !bl || !arr.ReadCBORNull() || !arr.Empty() {
+		t.Error("simple values")
+	}
+	if !in.ReadCBORTag(&u, &tagged) || u != 1 || !tagged.ReadCBORUint64(&u) || u != 2 || !in.Empty() {
+		t.Error("tag")
+	}
+}
+
+func TestCBORStringRejectsNonDeterministic(t *testing.T) {
+	for _, in := range []string{
+		"1817",               // 23 in two bytes
+		"190017",             // 23 in three bytes
+		"1a0000ffff",         // 0xffff in five bytes
+		"1b00000000ffffffff", // 0xffffffff in nine bytes
+		"5f4101ff",           // indefinite length byte string
+		"9f01ff",             // indefinite length array
+		"1c",                 // reserved additional information
+		"a2020101f4",         // unsorted map keys
+		"a201f401f5",         // duplicate map keys
+		"62c328",             // invalid UTF-8
+		"f93c00",             // half-precision float
+		"f0",                 // unassigned simple value
+		"8201",               // truncated array
+		"4401",               // truncated byte string
+	} {
+		s := String(mustHex(t, in))
+		orig := s
+		if s.SkipCBOR() {
+			t.Errorf("SkipCBOR accepted %s", in)
+		}
+		if !bytes.Equal(s, orig) {
+			t.Errorf("SkipCBOR advanced over invalid %s", in)
+		}
+	}
+
+	var i int64
+	s := String(mustHex(t, "1b8000000000000000"))
+	if s.ReadCBORInt64(&i) {
+		t.Error("ReadCBORInt64 accepted 2^63")
+	}
+	s = String(mustHex(t, "3b8000000000000000"))
+	if s.ReadCBORInt64(&i) {
+		t.Error("ReadCBORInt64 accepted -2^63-1")
+	}
+}
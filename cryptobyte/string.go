@@ -3,8 +3,8 @@
 // license that can be found in the LICENSE file.
 
 // Package cryptobyte contains types that help with parsing and constructing
-// length-prefixed, binary messages, including ASN.1 DER. (The asn1 subpackage
-// contains useful ASN.1 constants.)
+// length-prefixed, binary messages, including ASN.1 DER and deterministically
+// encoded CBOR. (The asn1 subpackage contains useful ASN.1 constants.)
 //
 // The String type is for parsing. It wraps a []byte slice and provides helper
 // functions for consuming structures, value by value.
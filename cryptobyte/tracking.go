@@ -0,0 +1,247 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cryptobyte
+
+import (
+	encoding_asn1 "encoding/asn1"
+	"fmt"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/cryptobyte/asn1"
+)
+
+// A ParseError describes the first failed read of a TrackingString.
+type ParseError struct {
+	// Offset is the position, from the start of the String on which
+	// WithErrorTracking was called, at which the failed read started.
+	Offset int
+	// Op is the name of the method that failed, such as "ReadASN1".
+	Op string
+	// Tag is the ASN.1 tag that was expected, or zero if the method does
+	// not expect a specific tag.
+	Tag asn1.Tag
+}
+
+func (e *ParseError) Error() string {
+	if e.Tag == 0 {
+		return fmt.Sprintf("cryptobyte: %s failed at offset %d", e.Op, e.Offset)
+	}
+	return fmt.Sprintf("cryptobyte: %s failed at offset %d, expected tag 0x%02x", e.Op, e.Offset, uint8(e.Tag))
+}
+
+// A TrackingString is a String that records where parsing first failed.
+// It is meant for debugging malformed inputs: the methods still report
+// failures with a bare false, and Err returns the details of the first one.
+//
+// The methods of TrackingString that read nested values write them into
+// a *TrackingString, which shares the record of its parent. The other
+// methods of String are available, but their failures are not recorded.
+type TrackingString struct {
+	String
+	t *tracker
+}
+
+type tracker struct {
+	// end is the capacity of the root String. Reads only ever slice the
+	// front of a String, so all the strings derived from it share the end
+	// of its backing array, and their offset is end minus their capacity.
+	end int
+	err *ParseError
+}
+
+// WithErrorTracking returns a TrackingString parsing s.
+func (s String) WithErrorTracking() TrackingString {
+	return TrackingString{String: s, t: &tracker{end: cap(s)}}
+}
+
+// Err returns a *ParseError describing the first failed read of s or of
+// the strings read from it, or nil if none failed.
+func (s *TrackingString) Err() error {
+	if s.t == nil || s.t.err == nil {
+		return nil
+	}
+	return s.t.err
+}
+
+// Offset returns the position of s from the start of the String on which
+// WithErrorTracking was called.
+func (s *TrackingString) Offset() int {
+	return s.tracker().end - cap(s.String)
+}
+
+func (s *TrackingString) tracker() *tracker {
+	if s.t == nil {
+		s.t = &tracker{end: cap(s.String)}
+	}
+	return s.t
+}
+
+// track runs read, and records op and tag if it is the first read to fail.
+func (s *TrackingString) track(op string, tag asn1.Tag, read func() bool) bool {
+	offset := s.Offset()
+	if read() {
+		return true
+	}
+	if s.t.err == nil {
+		s.t.err = &ParseError{Offset: offset, Op: op, Tag: tag}
+	}
+	return false
+}
+
+// child prepares out to receive a value read from s.
+func (s *TrackingString) child(out *TrackingString) *String {
+	out.t = s.tracker()
+	return &out.String
+}
+
+// Skip behaves like String.Skip.
+func (s *TrackingString) Skip(n int) bool {
+	return s.track("Skip", 0, func() bool { return s.String.Skip(n) })
+}
+
+// ReadUint8 behaves like String.ReadUint8.
+func (s *TrackingString) ReadUint8(out *uint8) bool {
+	return s.track("ReadUint8", 0, func() bool { return s.String.ReadUint8(out) })
+}
+
+// ReadUint16 behaves like String.ReadUint16.
+func (s *TrackingString) ReadUint16(out *uint16) bool {
+	return s.track("ReadUint16", 0, func() bool { return s.String.ReadUint16(out) })
+}
+
+// ReadUint24 behaves like String.ReadUint24.
+func (s *TrackingString) ReadUint24(out *uint32) bool {
+	return s.track("ReadUint24", 0, func() bool { return s.String.ReadUint24(out) })
+}
+
+// ReadUint32 behaves like String.ReadUint32.
+func (s *TrackingString) ReadUint32(out *uint32) bool {
+	return s.track("ReadUint32", 0, func() bool { return s.String.ReadUint32(out) })
+}
+
+// ReadUint8LengthPrefixed behaves like String.ReadUint8LengthPrefixed.
+func (s *TrackingString) ReadUint8LengthPrefixed(out *TrackingString) bool {
+	return s.track("ReadUint8LengthPrefixed", 0, func() bool { return s.String.ReadUint8LengthPrefixed(s.child(out)) })
+}
+
+// ReadUint16LengthPrefixed behaves like String.ReadUint16LengthPrefixed.
+func (s *TrackingString) ReadUint16LengthPrefixed(out *TrackingString) bool {
+	return s.track("ReadUint16LengthPrefixed", 0, func() bool { return s.String.ReadUint16LengthPrefixed(s.child(out)) })
+}
+
+// ReadUint24LengthPrefixed behaves like String.ReadUint24LengthPrefixed.
+func (s *TrackingString) ReadUint24LengthPrefixed(out *TrackingString) bool {
+	return s.track("ReadUint24LengthPrefixed", 0, func() bool { return s.String.ReadUint24LengthPrefixed(s.child(out)) })
+}
+
+// ReadBytes behaves like String.ReadBytes.
+func (s *TrackingString) ReadBytes(out *[]byte, n int) bool {
+	return s.track("ReadBytes", 0, func() bool { return s.String.ReadBytes(out, n) })
+}
+
+// CopyBytes behaves like String.CopyBytes.
+func (s *TrackingString) CopyBytes(out []byte) bool {
+	return s.track("CopyBytes", 0, func() bool { return s.String.CopyBytes(out) })
+}
+
+// ReadASN1 behaves like String.ReadASN1.
+func (s *TrackingString) ReadASN1(out *TrackingString, tag asn1.Tag) bool {
+	return s.track("ReadASN1", tag, func() bool { return s.String.ReadASN1(s.child(out), tag) })
+}
+
+// ReadASN1Element behaves like String.ReadASN1Element.
+func (s *TrackingString) ReadASN1Element(out *TrackingString, tag asn1.Tag) bool {
+	return s.track("ReadASN1Element", tag, func() bool { return s.String.ReadASN1Element(s.child(out), tag) })
+}
+
+// ReadAnyASN1 behaves like String.ReadAnyASN1.
+func (s *TrackingString) ReadAnyASN1(out *TrackingString, outTag *asn1.Tag) bool {
+	return s.track("ReadAnyASN1", 0, func() bool { return s.String.ReadAnyASN1(s.child(out), outTag) })
+}
+
+// ReadAnyASN1Element behaves like String.ReadAnyASN1Element.
+func (s *TrackingString) ReadAnyASN1Element(out *TrackingString, outTag *asn1.Tag) bool {
+	return s.track("ReadAnyASN1Element", 0, func() bool { return s.String.ReadAnyASN1Element(s.child(out), outTag) })
+}
+
+// ReadOptionalASN1 behaves like String.ReadOptionalASN1.
+func (s *TrackingString) ReadOptionalASN1(out *TrackingString, outPresent *bool, tag asn1.Tag) bool {
+	return s.track("ReadOptionalASN1", tag, func() bool { return s.String.ReadOptionalASN1(s.child(out), outPresent, tag) })
+}
+
+// SkipASN1 behaves like String.SkipASN1.
+func (s *TrackingString) SkipASN1(tag asn1.Tag) bool {
+	return s.track("SkipASN1", tag, func() bool { return s.String.SkipASN1(tag) })
+}
+
+// SkipOptionalASN1 behaves like String.SkipOptionalASN1.
+func (s *TrackingString) SkipOptionalASN1(tag asn1.Tag) bool {
+	return s.track("SkipOptionalASN1", tag, func() bool { return s.String.SkipOptionalASN1(tag) })
+}
+
+// ReadASN1Boolean behaves like String.ReadASN1Boolean.
+func (s *TrackingString) ReadASN1Boolean(out *bool) bool {
+	return s.track("ReadASN1Boolean", asn1.BOOLEAN, func() bool { return s.String.ReadASN1Boolean(out) })
+}
+
+// ReadASN1Integer behaves like String.ReadASN1Integer.
+func (s *TrackingString) ReadASN1Integer(out interface{}) bool {
+	return s.track("ReadASN1Integer", asn1.INTEGER, func() bool { return s.String.ReadASN1Integer(out) })
+}
+
+// ReadASN1Int64WithTag behaves like String.ReadASN1Int64WithTag.
+func (s *TrackingString) ReadASN1Int64WithTag(out *int64, tag asn1.Tag) bool {
+	return s.track("ReadASN1Int64WithTag", tag, func() bool { return s.String.ReadASN1Int64WithTag(out, tag) })
+}
+
+// ReadASN1Enum behaves like String.ReadASN1Enum.
+func (s *TrackingString) ReadASN1Enum(out *int) bool {
+	return s.track("ReadASN1Enum", asn1.ENUM, func() bool { return s.String.ReadASN1Enum(out) })
+}
+
+// ReadASN1ObjectIdentifier behaves like String.ReadASN1ObjectIdentifier.
+func (s *TrackingString) ReadASN1ObjectIdentifier(out *encoding_asn1.ObjectIdentifier) bool {
+	return s.track("ReadASN1ObjectIdentifier", asn1.OBJECT_IDENTIFIER, func() bool { return s.String.ReadASN1ObjectIdentifier(out) })
+}
+
+// ReadASN1GeneralizedTime behaves like String.ReadASN1GeneralizedTime.
+func (s *TrackingString) ReadASN1GeneralizedTime(out *time.Time) bool {
+	return s.track("ReadASN1GeneralizedTime", asn1.GeneralizedTime, func() bool { return s.String.ReadASN1GeneralizedTime(out) })
+}
+
+// ReadASN1UTCTime behaves like String.ReadASN1UTCTime.
+func (s *TrackingString) ReadASN1UTCTime(out *time.Time) bool {
+	return s.track("ReadASN1UTCTime", asn1.UTCTime, func() bool { return s.String.ReadASN1UTCTime(out) })
+}
+
+// ReadASN1BitString behaves like String.ReadASN1BitString.
+func (s *TrackingString) ReadASN1BitString(out *encoding_asn1.BitString) bool {
+	return s.track("ReadASN1BitString", asn1.BIT_STRING, func() bool { return s.String.ReadASN1BitString(out) })
+}
+
+// ReadASN1BitStringAsBytes behaves like String.ReadASN1BitStringAsBytes.
+func (s *TrackingString) ReadASN1BitStringAsBytes(out *[]byte) bool {
+	return s.track("ReadASN1BitStringAsBytes", asn1.BIT_STRING, func() bool { return s.String.ReadASN1BitStringAsBytes(out) })
+}
+
+// ReadASN1Bytes behaves like String.ReadASN1Bytes.
+func (s *TrackingString) ReadASN1Bytes(out *[]byte, tag asn1.Tag) bool {
+	return s.track("ReadASN1Bytes", tag, func() bool { return s.String.ReadASN1Bytes(out, tag) })
+}
+
+// ReadOptionalASN1Integer behaves like String.ReadOptionalASN1Integer.
+func (s *TrackingString) ReadOptionalASN1Integer(out interface{}, tag asn1.Tag, defaultValue interface{}) bool {
+	return s.track("ReadOptionalASN1Integer", tag, func() bool { return s.String.ReadOptionalASN1Integer(out, tag, defaultValue) })
+}
+
+// ReadOptionalASN1OctetString behaves like String.ReadOptionalASN1OctetString.
+func (s *TrackingString) ReadOptionalASN1OctetString(out *[]byte, outPresent *bool, tag asn1.Tag) bool {
+	return s.track("ReadOptionalASN1OctetString", tag, func() bool { return s.String.ReadOptionalASN1OctetString(out, outPresent, tag) })
+}
+
+// ReadOptionalASN1Boolean behaves like String.ReadOptionalASN1Boolean.
+func (s *TrackingString) ReadOptionalASN1Boolean(out *bool, tag asn1.Tag, defaultValue bool) bool {
+	return s.track("ReadOptionalASN1Boolean", tag, func() bool { return s.String.ReadOptionalASN1Boolean(out, tag, defaultValue) })
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cryptobyte
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/cryptobyte/asn1"
+)
+
+func TestErrorTracking(t *testing.T) {
+	// SEQUENCE { INTEGER 1, SEQUENCE { OCTET STRING "ab" } }
+	der := []byte{0x30, 0x09, 0x02, 0x01, 0x01, 0x30, 0x04, 0x04, 0x02, 'a', 'b'}
+
+	input := String(der).WithErrorTracking()
+	var seq, inner TrackingString
+	var n int
+	var b []byte
+	if !input.ReadASN1(&seq, asn1.SEQUENCE) || !seq.ReadASN1Integer(&n) || !seq.ReadASN1(&inner, asn1.SEQUENCE) {
+		t.Fatalf("failed to parse valid input: %v", input.Err())
+	}
+	if inner.Offset() != 7 {
+		t.Errorf("got inner offset %d, want 7", inner.Offset())
+	}
+	if inner.ReadASN1Bytes(&b, asn1.UTF8String) {
+		t.Fatal("ReadASN1Bytes succeeded with the wrong tag")
+	}
+	// A later failure does not replace the first one.
+	var u uint32
+	if seq.ReadUint32(&u) {
+		t.Fatal("ReadUint32 succeeded on an empty string")
+	}
+
+	var perr *ParseError
+	if !errors.As(input.Err(), &perr) {
+		t.Fatalf("got error %v, want a *ParseError", input.Err())
+	}
+	if *perr != (ParseError{Offset: 7, Op: "ReadASN1Bytes", Tag: asn1.UTF8String}) {
+		t.Errorf("got %+v", *perr)
+	}
+	if got, want := perr.Error(), "cryptobyte: ReadASN1Bytes failed at offset 7, expected tag 0x0c"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+	if inner.Err() != input.Err() || seq.Err() != input.Err() {
+		t.Error("nested strings don't share the error of their parent")
+	}
+
+	// The offset is relative to the string WithErrorTracking was called on,
+	// even if it is a subslice.
+	tail := String(der[2:]).WithErrorTracking()
+	if !tail.SkipASN1(asn1.INTEGER) || tail.ReadUint8LengthPrefixed(new(TrackingString)) {
+		t.Fatal("unexpected parse result")
+	}
+	if got, want := tail.Err().Error(), "cryptobyte: ReadUint8LengthPrefixed failed at offset 3"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+
+	ok := String(der).WithErrorTracking()
+	if !ok.SkipASN1(asn1.SEQUENCE) || !ok.Empty() || ok.Err() != nil {
+		t.Errorf("got error %v after a successful parse", ok.Err())
+	}
+}
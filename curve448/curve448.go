@@ -0,0 +1,115 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package curve448 provides an implementation of the X448 function, which
+// performs scalar multiplication on the elliptic curve known as Curve448.
+// See RFC 7748.
+//
+// Its API mirrors the X25519 function of package curve25519. X448 offers a
+// security level of about 224 bits, against about 128 bits for X25519.
+package curve448
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strconv"
+)
+
+const (
+	// ScalarSize is the size of the scalar input to X448.
+	ScalarSize = 56
+	// PointSize is the size of the point input to X448.
+	PointSize = 56
+)
+
+// Basepoint is the canonical Curve448 generator.
+var Basepoint []byte
+
+var basePoint = [56]byte{5}
+
+func init() { Basepoint = basePoint[:] }
+
+// X448 returns the result of the scalar multiplication (scalar * point),
+// according to RFC 7748, Section 5. scalar, point and the return value are
+// slices of 56 bytes.
+//
+// scalar can be generated at random, for example with crypto/rand. point should
+// be either Basepoint or the output of another X448 call.
+//
+// If the result is the all-zero value, which happens when point is of low
+// order, X448 returns an error.
+func X448(scalar, point []byte) ([]byte, error) {
+	// Outline the body of function, to let the allocation be inlined in the
+	// caller, and possibly avoid escaping to the heap.
+	var dst [56]byte
+	return x448(&dst, scalar, point)
+}
+
+func x448(dst *[56]byte, scalar, point []byte) ([]byte, error) {
+	if len(scalar) != ScalarSize {
+		return nil, errors.New("curve448: bad scalar length: " + strconv.Itoa(len(scalar)) + ", expected 56")
+	}
+	if len(point) != PointSize {
+		return nil, errors.New("curve448: bad point length: " + strconv.Itoa(len(point)) + ", expected 56")
+	}
+	scalarMult(dst, scalar, point)
+	var zero [56]byte
+	if subtle.ConstantTimeCompare(dst[:], zero[:]) == 1 {
+		return nil, errors.New("curve448: bad input point: low order point")
+	}
+	return dst[:], nil
+}
+
+// a24 is (A - 2) / 4 for the Curve448 coefficient A = 156326.
+const a24 = 39081
+
+// scalarMult sets dst to the u-coordinate of scalar * point, with the
+// Montgomery ladder of RFC 7748, Section 5.
+func scalarMult(dst *[56]byte, scalar, point []byte) {
+	var k [56]byte
+	copy(k[:], scalar)
+	k[0] &= 252
+	k[55] |= 128
+
+	var x1, x2, z2, x3, z3 fieldElement
+	x1.setBytes(point)
+	x2.one()
+	x3 = x1
+	z3.one()
+
+	var a, aa, b, bb, e, c, d, da, cb fieldElement
+	swap := 0
+	for t := 447; t >= 0; t-- {
+		kt := int(k[t/8]>>(t%8)) & 1
+		swap ^= kt
+		x2.swap(&x3, swap)
+		z2.swap(&z3, swap)
+		swap = kt
+
+		a.add(&x2, &z2)
+		aa.square(&a)
+		b.sub(&x2, &z2)
+		bb.square(&b)
+		e.sub(&aa, &bb)
+		c.add(&x3, &z3)
+		d.sub(&x3, &z3)
+		da.mul(&d, &a)
+		cb.mul(&c, &b)
+		x3.add(&da, &cb)
+		x3.square(&x3)
+		z3.sub(&da, &cb)
+		z3.square(&z3)
+		z3.mul(&z3, &x1)
+		x2.mul(&aa, &bb)
+		z2.mul32(&e, a24)
+		z2.add(&z2, &aa)
+		z2.mul(&z2, &e)
+	}
+	x2.swap(&x3, swap)
+	z2.swap(&z3, swap)
+
+	z2.invert(&z2)
+	x2.mul(&x2, &z2)
+	x2.bytes(dst)
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curve448
+
+// fieldElement is an element of GF(p), with p = 2^448 - 2^224 - 1, in
+// sixteen limbs of 28 bits, least significant first. Limbs are allowed to
+// exceed 28 bits slightly between operations, and the value is not
+// necessarily reduced modulo p.
+//
+// All operations are constant time.
+type fieldElement [16]uint64
+
+const (
+	limbBits = 28
+	limbMask = 1<<limbBits - 1
+)
+
+func (v *fieldElement) one() {
+	*v = fieldElement{1}
+}
+
+// setBytes sets v to the little-endian value of b, which is 56 bytes long.
+// Values of p and above are accepted, as required by RFC 7748.
+func (v *fieldElement) setBytes(b []byte) {
+	for i := 0; i < 8; i++ {
+		var x uint64
+		for j := 6; j >= 0; j-- {
+			x = x<<8 | uint64(b[7*i+j])
+		}
+		v[2*i] = x & limbMask
+		v[2*i+1] = x >> limbBits
+	}
+}
+
+// bytes sets b to the canonical little-endian encoding of v.
+func (v *fieldElement) bytes(b *[56]byte) {
+	t := *v
+	t.carry()
+	t.carryStrict()
+
+	// t is now below 2^448, so at most p has to be subtracted. Adding
+	// 2^448 - p = 2^224 + 1 overflows 2^448 if and only if t >= p.
+	s := t
+	s[0]++
+	s[8]++
+	var c uint64
+	for i := range s {
+		s[i] += c
+		c = s[i] >> limbBits
+		s[i] &= limbMask
+	}
+	mask := -c
+	for i := range t {
+		t[i] = t[i]&^mask | s[i]&mask
+	}
+
+	for i := 0; i < 8; i++ {
+		x := t[2*i] | t[2*i+1]<<limbBits
+		for j := 0; j < 7; j++ {
+			b[7*i+j] = byte(x)
+			x >>= 8
+		}
+	}
+}
+
+// carry propagates the carries of v, folding the carry out of the top limb
+// back in with 2^448 = 2^224 + 1 (mod p). Afterwards, all limbs but the
+// first and the ninth are below 2^28, and those are at most 2^28.
+func (v *fieldElement) carry() {
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < 15; i++ {
+			v[i+1] += v[i] >> limbBits
+			v[i] &= limbMask
+		}
+		c := v[15] >> limbBits
+		v[15] &= limbMask
+		v[0] += c
+		v[8] += c
+	}
+}
+
+// carryStrict brings the limbs of a carried v below 2^28.
+func (v *fieldElement) carryStrict() {
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < 15; i++ {
+			v[i+1] += v[i] >> limbBits
+			v[i] &= limbMask
+		}
+		c := v[15] >> limbBits
+		v[15] &= limbMask
+		v[0] += c
+		v[8] += c
+	}
+	// After a carry out of the top limb, the low limbs are small, so the
+	// second pass above didn't produce another one and only has to be
+	// propagated from the first limb.
+	for i := 0; i < 15; i++ {
+		v[i+1] += v[i] >> limbBits
+		v[i] &= limbMask
+	}
+}
+
+// add sets v = a + b.
+func (v *fieldElement) add(a, b *fieldElement) {
+	for i := range v {
+		v[i] = a[i] + b[i]
+	}
+	v.carry()
+}
+
+// twoP is 2p, in limbs that are larger than those of any carried element.
+var twoP = fieldElement{
+	0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe,
+	0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe,
+	0x1ffffffc, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe,
+	0x1ffffffe, 0x1ffffffe, 0x1ffffffe, 0x1ffffffe,
+}
+
+// sub sets v = a - b.
+func (v *fieldElement) sub(a, b *fieldElement) {
+	for i := range v {
+		v[i] = a[i] + twoP[i] - b[i]
+	}
+	v.carry()
+}
+
+// mul sets v = a * b.
+func (v *fieldElement) mul(a, b *fieldElement) {
+	// Each product is below 2^57 and each column sums at most sixteen of
+	// them, so the schoolbook multiplication can't overflow.
+	var t [32]uint64
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			t[i+j] += a[i] * b[j]
+		}
+	}
+	for i := 0; i < 31; i++ {
+		t[i+1] += t[i] >> limbBits
+		t[i] &= limbMask
+	}
+	// Fold the upper half with 2^448 = 2^224 + 1 (mod p), from the top so
+	// that the limbs folded into the upper half are folded again.
+	for i := 31; i >= 16; i-- {
+		t[i-16] += t[i]
+		t[i-8] += t[i]
+	}
+	copy(v[:], t[:16])
+	v.carry()
+}
+
+// square sets v = a * a.
+func (v *fieldElement) square(a *fieldElement) {
+	v.mul(a, a)
+}
+
+// mul32 sets v = a * b.
+func (v *fieldElement) mul32(a *fieldElement, b uint32) {
+	for i := range v {
+		v[i] = a[i] * uint64(b)
+	}
+	v.carry()
+}
+
+// swap swaps v and u if cond is 1, and leaves them unchanged if cond is 0.
+func (v *fieldElement) swap(u *fieldElement, cond int) {
+	mask := -uint64(cond)
+	for i := range v {
+		t := mask & (v[i] ^ u[i])
+		v[i] ^= t
+		u[i] ^= t
+	}
+}
+
+// invert sets v = 1 / a, computed as a^(p-2), or zero if a is zero.
+func (v *fieldElement) invert(a *fieldElement) {
+	// The bits of p - 2 = 2^448 - 2^224 - 3 are all set, except for bits
+	// 224 and 1. The exponent is public, so branching on it is fine.
+	var r fieldElement
+	r.one()
+	x := *a
+	for i := 447; i >= 0; i-- {
+		r.square(&r)
+		if i != 224 && i != 1 {
+			r.mul(&r, &x)
+		}
+	}
+	*v = r
+}
@@ -15,7 +15,9 @@
 package ed25519
 
 import (
+	"crypto"
 	"crypto/ed25519"
+	"errors"
 	"io"
 )
 
@@ -67,3 +69,53 @@ func Sign(privateKey PrivateKey, message []byte) []byte {
 func Verify(publicKey PublicKey, message, sig []byte) bool {
 	return ed25519.Verify(publicKey, message, sig)
 }
+
+// Options can be used with PrivateKey.Sign or VerifyWithOptions to select
+// Ed25519 variants.
+//
+// This type is an alias for crypto/ed25519's Options type.
+type Options = ed25519.Options
+
+// VerifyWithOptions reports whether sig is a valid signature of message by
+// publicKey, using the Ed25519 variant selected by opts. A valid signature
+// is indicated by returning a nil error. It will panic if len(publicKey) is
+// not PublicKeySize.
+func VerifyWithOptions(publicKey PublicKey, message, sig []byte, opts *Options) error {
+	return ed25519.VerifyWithOptions(publicKey, message, sig, opts)
+}
+
+// SignPh signs digest, the SHA-512 hash of a message, with privateKey using
+// Ed25519ph as specified in RFC 8032, Section 5.1, with the given context
+// string, which may be empty and can be at most 255 bytes long. It will
+// panic if len(privateKey) is not PrivateKeySize.
+func SignPh(privateKey PrivateKey, digest []byte, context string) ([]byte, error) {
+	return privateKey.Sign(nil, digest, &Options{Hash: crypto.SHA512, Context: context})
+}
+
+// VerifyPh reports whether sig is a valid Ed25519ph signature by publicKey
+// of digest, the SHA-512 hash of a message, with the given context string.
+// It will panic if len(publicKey) is not PublicKeySize.
+func VerifyPh(publicKey PublicKey, digest, sig []byte, context string) bool {
+	return ed25519.VerifyWithOptions(publicKey, digest, sig, &Options{Hash: crypto.SHA512, Context: context}) == nil
+}
+
+// SignCtx signs message with privateKey using Ed25519ctx as specified in
+// RFC 8032, Section 5.1, with the given context string, which must be
+// between 1 and 255 bytes long. It will panic if len(privateKey) is not
+// PrivateKeySize.
+func SignCtx(privateKey PrivateKey, message []byte, context string) ([]byte, error) {
+	if context == "" {
+		return nil, errors.New("ed25519: Ed25519ctx requires a non-empty context")
+	}
+	return privateKey.Sign(nil, message, &Options{Context: context})
+}
+
+// VerifyCtx reports whether sig is a valid Ed25519ctx signature of message
+// by publicKey with the given context string. It will panic if
+// len(publicKey) is not PublicKeySize.
+func VerifyCtx(publicKey PublicKey, message, sig []byte, context string) bool {
+	if context == "" {
+		return false
+	}
+	return ed25519.VerifyWithOptions(publicKey, message, sig, &Options{Context: context}) == nil
+}
@@ -5,7 +5,10 @@
 package ed25519_test
 
 import (
+	"bytes"
 	ed25519std "crypto/ed25519"
+	"crypto/sha512"
+	"encoding/hex"
 	"testing"
 
 	"github.com/gitpod-io/golang-crypto/ed25519"
@@ -20,3 +23,69 @@ func TestTypeAlias(t *testing.T) {
 		t.Errorf("valid signature rejected")
 	}
 }
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestEd25519ph uses the test vector of RFC 8032, Section 7.3.
+func TestEd25519ph(t *testing.T) {
+	private := ed25519.NewKeyFromSeed(mustDecodeHex(t, "833fe62409237b9d62ec77587520911e9a759cec1d19755b7da901b96dca3d42"))
+	public := private.Public().(ed25519.PublicKey)
+	if want := mustDecodeHex(t, "ec172b93ad5e563bf4932c70e1245034c35467ef2efd4d64ebf819683467e2bf"); !bytes.Equal(public, want) {
+		t.Fatalf("got public key %x, want %x", public, want)
+	}
+	digest := sha512.Sum512([]byte("abc"))
+	sig, err := ed25519.SignPh(private, digest[:], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustDecodeHex(t, "98a70222f0b8121aa9d30f813d683f809e462b469c7ff87639499bb94e6dae4131f85042463c2a355a2003d062adf5aaa10b8c61e636062aaad11c2a26083406")
+	if !bytes.Equal(sig, want) {
+		t.Errorf("got signature %x, want %x", sig, want)
+	}
+	if !ed25519.VerifyPh(public, digest[:], sig, "") {
+		t.Error("valid signature rejected")
+	}
+	if ed25519.VerifyPh(public, digest[:], sig, "context") {
+		t.Error("signature accepted with another context")
+	}
+	if ed25519.Verify(public, digest[:], sig) {
+		t.Error("Ed25519ph signature accepted as an Ed25519 signature")
+	}
+}
+
+// TestEd25519ctx uses the first test vector of RFC 8032, Section 7.2.
+func TestEd25519ctx(t *testing.T) {
+	private := ed25519.NewKeyFromSeed(mustDecodeHex(t, "0305334e381af78f141cb666f6199f57bc3495335a256a95bd2a55bf546663f6"))
+	public := private.Public().(ed25519.PublicKey)
+	message := mustDecodeHex(t, "f726936d19c800494e3fdaff20b276a8")
+	sig, err := ed25519.SignCtx(private, message, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustDecodeHex(t, "55a4cc2f70a54e04288c5f4cd1e45a7bb520b36292911876cada7323198dd87a8b36950b95130022907a7fb7c4e9b2d5f6cca685a587b4b21f4b888e4e7edb0d")
+	if !bytes.Equal(sig, want) {
+		t.Errorf("got signature %x, want %x", sig, want)
+	}
+	if !ed25519.VerifyCtx(public, message, sig, "foo") {
+		t.Error("valid signature rejected")
+	}
+	if ed25519.VerifyCtx(public, message, sig, "bar") {
+		t.Error("signature accepted with another context")
+	}
+	if err := ed25519.VerifyWithOptions(public, message, sig, &ed25519.Options{Context: "foo"}); err != nil {
+		t.Errorf("VerifyWithOptions: %v", err)
+	}
+	if _, err := ed25519.SignCtx(private, message, ""); err == nil {
+		t.Error("SignCtx accepted an empty context")
+	}
+	if _, err := ed25519.SignCtx(private, message, string(make([]byte, 256))); err == nil {
+		t.Error("SignCtx accepted a context longer than 255 bytes")
+	}
+}
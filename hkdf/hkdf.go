@@ -8,6 +8,9 @@
 // HKDF is a cryptographic key derivation function (KDF) with the goal of
 // expanding limited input keying material into one or more cryptographically
 // strong secret keys.
+//
+// Key and ExpandKey return derived keys as byte slices, and ExpandLabel
+// implements the HKDF-Expand-Label function of TLS 1.3.
 package hkdf
 
 import (
@@ -93,3 +96,49 @@ func New(hash func() hash.Hash, secret, salt, info []byte) io.Reader {
 	prk := Extract(hash, secret, salt)
 	return Expand(hash, prk, info)
 }
+
+// Key derives a key of the given length from secret, salt and info, using
+// both the extraction and the expansion steps. Salt and info can be nil.
+func Key(hash func() hash.Hash, secret, salt, info []byte, length int) ([]byte, error) {
+	return ExpandKey(hash, Extract(hash, secret, salt), info, length)
+}
+
+// ExpandKey derives a key of the given length from pseudorandomKey and
+// optional context info, skipping the extraction step. It returns an error
+// if length is larger than 255 times the size of hash.
+//
+// The pseudorandomKey should be as for Expand.
+func ExpandKey(hash func() hash.Hash, pseudorandomKey, info []byte, length int) ([]byte, error) {
+	if length < 0 {
+		return nil, errors.New("hkdf: negative key length")
+	}
+	key := make([]byte, length)
+	if _, err := io.ReadFull(Expand(hash, pseudorandomKey, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ExpandLabel implements HKDF-Expand-Label from RFC 8446, Section 7.1,
+// which derives a key of the given length from secret with an info made
+// of length, the label prefixed with "tls13 ", and context.
+func ExpandLabel(hash func() hash.Hash, secret []byte, label string, context []byte, length int) ([]byte, error) {
+	const prefix = "tls13 "
+	if len(prefix)+len(label) > 255 {
+		return nil, errors.New("hkdf: label too long")
+	}
+	if len(context) > 255 {
+		return nil, errors.New("hkdf: context too long")
+	}
+	if length < 0 || length > 0xffff {
+		return nil, errors.New("hkdf: invalid key length")
+	}
+	info := make([]byte, 0, 2+1+len(prefix)+len(label)+1+len(context))
+	info = append(info, byte(length>>8), byte(length))
+	info = append(info, byte(len(prefix)+len(label)))
+	info = append(info, prefix...)
+	info = append(info, label...)
+	info = append(info, byte(len(context)))
+	info = append(info, context...)
+	return ExpandKey(hash, secret, info, length)
+}
@@ -9,8 +9,10 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/hex"
 	"hash"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -366,6 +368,72 @@ func TestHKDFLimit(t *testing.T) {
 	}
 }
 
+func TestKey(t *testing.T) {
+	for i, tt := range hkdfTests {
+		out, err := Key(tt.hash, tt.master, tt.salt, tt.info, len(tt.out))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if !bytes.Equal(out, tt.out) {
+			t.Errorf("test %d: incorrect output from Key: have %v, need %v.", i, out, tt.out)
+		}
+
+		out, err = ExpandKey(tt.hash, tt.prk, tt.info, len(tt.out))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if !bytes.Equal(out, tt.out) {
+			t.Errorf("test %d: incorrect output from ExpandKey: have %v, need %v.", i, out, tt.out)
+		}
+	}
+
+	if _, err := ExpandKey(sha1.New, make([]byte, 20), nil, sha1.Size*255+1); err == nil {
+		t.Error("ExpandKey returned a key over the entropy limit")
+	}
+}
+
+func TestExpandLabel(t *testing.T) {
+	// From the simple 1-RTT handshake trace of RFC 8448, Section 3.
+	earlySecret := Extract(sha256.New, make([]byte, 32), nil)
+	emptyHash := sha256.Sum256(nil)
+	handshakeSecret := fromHex("b67b7d690cc16c4e75e54213cb2d37b4e9c912bcded9105d42befd59d391ad38")
+	tests := []struct {
+		secret  []byte
+		label   string
+		context []byte
+		length  int
+		want    string
+	}{
+		{earlySecret, "derived", emptyHash[:], 32, "6f2615a108c702c5678f54fc9dbab69716c076189c48250cebeac3576c3611ba"},
+		{handshakeSecret, "key", nil, 16, "3fce516009c21727d0f2e4e86ee403bc"},
+		{handshakeSecret, "iv", nil, 12, "5d313eb2671276ee13000b30"},
+	}
+	for i, tt := range tests {
+		out, err := ExpandLabel(sha256.New, tt.secret, tt.label, tt.context, tt.length)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if !bytes.Equal(out, fromHex(tt.want)) {
+			t.Errorf("test %d: have %x, need %s.", i, out, tt.want)
+		}
+	}
+
+	if _, err := ExpandLabel(sha256.New, earlySecret, strings.Repeat("a", 250), nil, 32); err == nil {
+		t.Error("ExpandLabel accepted a label over 255 bytes")
+	}
+	if _, err := ExpandLabel(sha256.New, earlySecret, "derived", make([]byte, 256), 32); err == nil {
+		t.Error("ExpandLabel accepted a context over 255 bytes")
+	}
+}
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 func Benchmark16ByteMD5Single(b *testing.B) {
 	benchmarkHKDFSingle(md5.New, 16, b)
 }
@@ -0,0 +1,29 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ctlookup implements table lookups whose memory access pattern does
+// not depend on the index, for the S-boxes of the constant-time block
+// ciphers.
+package ctlookup
+
+// Uint32 returns s[i], reading every entry of s.
+func Uint32(s *[256]uint32, i byte) uint32 {
+	var v uint32
+	for j := range s {
+		// mask is all ones if j == i, and zero otherwise.
+		mask := uint32(int32(uint32(j)^uint32(i)-1) >> 31)
+		v |= s[j] & mask
+	}
+	return v
+}
+
+// Byte returns s[i], reading every entry of s.
+func Byte(s *[256]byte, i byte) byte {
+	var v byte
+	for j := range s {
+		mask := byte(int32(uint32(j)^uint32(i)-1) >> 31)
+		v |= s[j] & mask
+	}
+	return v
+}
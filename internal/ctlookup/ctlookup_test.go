@@ -0,0 +1,24 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ctlookup
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	var s32 [256]uint32
+	var s8 [256]byte
+	for i := range s32 {
+		s32[i] = uint32(i)*0x01010101 ^ 0xdeadbeef
+		s8[i] = byte(i) ^ 0xa5
+	}
+	for i := 0; i < 256; i++ {
+		if got := Uint32(&s32, byte(i)); got != s32[i] {
+			t.Errorf("Uint32(%d) = %#x, want %#x", i, got, s32[i])
+		}
+		if got := Byte(&s8, byte(i)); got != s8[i] {
+			t.Errorf("Byte(%d) = %#x, want %#x", i, got, s8[i])
+		}
+	}
+}
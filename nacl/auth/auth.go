@@ -56,3 +56,25 @@ func Verify(digest []byte, m []byte, key *[KeySize]byte) bool {
 	expectedMAC := mac.Sum(nil) // first 256 bits of 512-bit sum
 	return hmac.Equal(digest, expectedMAC[:Size])
 }
+
+// VerifyBatch checks that digests[i] is a valid authenticator of
+// messages[i] under the given secret key, for each i, and returns the
+// results. The HMAC key schedule is computed once for the whole batch.
+// VerifyBatch does not leak timing information about the digests.
+//
+// VerifyBatch panics if digests and messages don't have the same length.
+func VerifyBatch(digests, messages [][]byte, key *[KeySize]byte) []bool {
+	if len(digests) != len(messages) {
+		panic("auth: mismatched number of digests and messages")
+	}
+	valid := make([]bool, len(messages))
+	mac := hmac.New(sha512.New, key[:])
+	var sum []byte
+	for i, m := range messages {
+		mac.Reset()
+		mac.Write(m)
+		sum = mac.Sum(sum[:0])
+		valid[i] = len(digests[i]) == Size && hmac.Equal(digests[i], sum[:Size])
+	}
+	return valid
+}
@@ -111,6 +111,35 @@ func TestVerify(t *testing.T) {
 	}
 }
 
+func TestVerifyBatch(t *testing.T) {
+	key := &testCases[0].key
+	var digests, messages [][]byte
+	var want []bool
+	for i := 0; i < 10; i++ {
+		msg := []byte{byte(i)}
+		tag := Sum(msg, key)
+		switch i % 3 {
+		case 1:
+			tag[0] ^= 1
+		case 2:
+			msg = []byte("other message")
+		}
+		digests = append(digests, tag[:])
+		messages = append(messages, msg)
+		want = append(want, i%3 == 0)
+	}
+	digests = append(digests, []byte("short"))
+	messages = append(messages, nil)
+	want = append(want, false)
+
+	got := VerifyBatch(digests, messages, key)
+	for i := range want {
+		if got[i] != want[i] || got[i] != Verify(digests[i], messages[i], key) {
+			t.Errorf("#%d: VerifyBatch = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
 func TestStress(t *testing.T) {
 	if testing.Short() {
 		t.Skip("exhaustiveness test")
@@ -170,3 +199,27 @@ func BenchmarkAuth(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		b.Fatal(err)
+	}
+	digests, messages := make([][]byte, 64), make([][]byte, 64)
+	for i := range messages {
+		messages[i] = make([]byte, 64)
+		rand.Read(messages[i])
+		digests[i] = Sum(messages[i], &key)[:]
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, ok := range VerifyBatch(digests, messages, &key) {
+			if !ok {
+				b.Fatal("unexpected failure from VerifyBatch")
+			}
+		}
+	}
+}
@@ -93,3 +93,29 @@ func Example_precompute() {
 	fmt.Println(string(decrypted))
 	// Output: A fellow of infinite jest, of most excellent fancy
 }
+
+func Example_anonymous() {
+	recipientPublicKey, recipientPrivateKey, err := box.GenerateKey(crypto_rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	msg := []byte("Where be your gibes now? your gambols? your songs?")
+	// The sender needs only the public key of the recipient. A fresh
+	// ephemeral key pair is generated for every message and its public half
+	// is prepended to the result, so no nonce has to be managed. The result
+	// interoperates with libsodium's crypto_box_seal.
+	encrypted, err := box.SealAnonymous(nil, msg, recipientPublicKey, crypto_rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	// The recipient decrypts the message using their key pair. The identity
+	// of the sender is not authenticated.
+	decrypted, ok := box.OpenAnonymous(nil, encrypted, recipientPublicKey, recipientPrivateKey)
+	if !ok {
+		panic("decryption error")
+	}
+	fmt.Println(string(decrypted))
+	// Output: Where be your gibes now? your gambols? your songs?
+}
@@ -31,6 +31,10 @@ Thus large amounts of data should be chunked so that each message is small.
 chunk size.
 
 This package is interoperable with NaCl: https://nacl.cr.yp.to/secretbox.html.
+
+SealXChaCha20Poly1305 and OpenXChaCha20Poly1305 provide the same interface
+using XChaCha20-Poly1305 instead, which can also authenticate additional data
+that is not encrypted, such as a header or a record identifier.
 */
 package secretbox
 
@@ -9,6 +9,8 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"testing"
+
+	"github.com/gitpod-io/golang-crypto/chacha20poly1305"
 )
 
 func TestSealOpen(t *testing.T) {
@@ -90,6 +92,59 @@ func TestAppend(t *testing.T) {
 	}
 }
 
+func TestXChaCha20Poly1305(t *testing.T) {
+	var key [32]byte
+	var nonce [24]byte
+
+	rand.Reader.Read(key[:])
+	rand.Reader.Read(nonce[:])
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var box, opened []byte
+	for msgLen := 0; msgLen < 128; msgLen += 17 {
+		message := make([]byte, msgLen)
+		rand.Reader.Read(message)
+		ad := message[:msgLen/2]
+
+		box = SealXChaCha20Poly1305(box[:0], message, ad, &nonce, &key)
+		if want := aead.Seal(nil, nonce[:], message, ad); !bytes.Equal(box, want) {
+			t.Errorf("%d: got %x, expected %x", msgLen, box, want)
+		}
+		var ok bool
+		opened, ok = OpenXChaCha20Poly1305(opened[:0], box, ad, &nonce, &key)
+		if !ok {
+			t.Errorf("%d: failed to open box", msgLen)
+			continue
+		}
+		if !bytes.Equal(opened, message) {
+			t.Errorf("%d: got %x, expected %x", msgLen, opened, message)
+		}
+
+		if _, ok := OpenXChaCha20Poly1305(nil, box, []byte("other"), &nonce, &key); ok {
+			t.Errorf("%d: box was opened with different additional data", msgLen)
+		}
+	}
+
+	box = SealXChaCha20Poly1305(box[:0], opened, nil, &nonce, &key)
+	for i := range box {
+		box[i] ^= 0x20
+		_, ok := OpenXChaCha20Poly1305(opened[:0], box, nil, &nonce, &key)
+		if ok {
+			t.Errorf("box was opened after corrupting byte %d", i)
+		}
+		box[i] ^= 0x20
+	}
+
+	out := make([]byte, 4, 100)
+	box = SealXChaCha20Poly1305(out, box, nil, &nonce, &key)
+	if !bytes.Equal(box[:4], out[:4]) {
+		t.Fatalf("SealXChaCha20Poly1305 didn't correctly append with sufficient capacity.")
+	}
+}
+
 func benchmarkSealSize(b *testing.B, size int) {
 	message := make([]byte, size)
 	out := make([]byte, size+Overhead)
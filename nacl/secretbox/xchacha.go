@@ -0,0 +1,54 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secretbox
+
+import (
+	"github.com/gitpod-io/golang-crypto/chacha20poly1305"
+	"github.com/gitpod-io/golang-crypto/internal/alias"
+)
+
+// SealXChaCha20Poly1305 is like Seal, but uses XChaCha20-Poly1305 and also
+// authenticates additionalData, which is not included in the output. The key
+// and nonce pair must be unique for each distinct message and the output
+// will be Overhead bytes longer than message.
+//
+// Boxes produced by SealXChaCha20Poly1305 are not interoperable with NaCl
+// secretbox; they are compatible with libsodium's
+// crypto_aead_xchacha20poly1305_ietf_encrypt, and with the AEAD returned
+// by chacha20poly1305.NewX.
+func SealXChaCha20Poly1305(out, message, additionalData []byte, nonce *[24]byte, key *[32]byte) []byte {
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		panic("nacl: " + err.Error())
+	}
+	ret, box := sliceForAppend(out, len(message)+Overhead)
+	if alias.AnyOverlap(box, message) {
+		panic("nacl: invalid buffer overlap")
+	}
+	aead.Seal(box[:0], nonce[:], message, additionalData)
+	return ret
+}
+
+// OpenXChaCha20Poly1305 authenticates and decrypts a box produced by
+// SealXChaCha20Poly1305 with the same additionalData and appends the message
+// to out, which must not overlap box. The output will be Overhead bytes
+// smaller than box.
+func OpenXChaCha20Poly1305(out, box, additionalData []byte, nonce *[24]byte, key *[32]byte) ([]byte, bool) {
+	if len(box) < Overhead {
+		return nil, false
+	}
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		panic("nacl: " + err.Error())
+	}
+	ret, message := sliceForAppend(out, len(box)-Overhead)
+	if alias.AnyOverlap(message, box) {
+		panic("nacl: invalid buffer overlap")
+	}
+	if _, err := aead.Open(message[:0], nonce[:], box, additionalData); err != nil {
+		return nil, false
+	}
+	return ret, true
+}
@@ -23,6 +23,9 @@ package sign
 import (
 	"crypto/ed25519"
 	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gitpod-io/golang-crypto/internal/alias"
 )
@@ -74,6 +77,48 @@ func Open(out, signedMessage []byte, publicKey *[32]byte) ([]byte, bool) {
 	return ret, true
 }
 
+// VerifyBatch checks the signed messages produced by Sign, each against the
+// public key with the same index, and returns the results. The messages
+// are verified concurrently, on up to GOMAXPROCS goroutines.
+//
+// VerifyBatch panics if signedMessages and publicKeys don't have the same
+// length.
+func VerifyBatch(signedMessages [][]byte, publicKeys []*[32]byte) []bool {
+	if len(signedMessages) != len(publicKeys) {
+		panic("sign: mismatched number of signed messages and public keys")
+	}
+	valid := make([]bool, len(signedMessages))
+	verify := func(i int) {
+		sm := signedMessages[i]
+		valid[i] = len(sm) >= Overhead &&
+			ed25519.Verify(ed25519.PublicKey((*publicKeys[i])[:]), sm[Overhead:], sm[:Overhead])
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(valid) {
+		workers = len(valid)
+	}
+	if workers <= 1 {
+		for i := range valid {
+			verify(i)
+		}
+		return valid
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < len(valid); i = int(next.Add(1) - 1) {
+				verify(i)
+			}
+		}()
+	}
+	wg.Wait()
+	return valid
+}
+
 // sliceForAppend takes a slice and a requested number of bytes. It returns a
 // slice with the contents of the given slice followed by that many bytes and a
 // second slice that aliases into it and contains only the extra bytes. If the
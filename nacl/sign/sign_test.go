@@ -72,3 +72,32 @@ func TestGenerateSignOpen(t *testing.T) {
 		t.Fatalf("verified message does not match signed messge, got\n%x\n, expected\n%x", message, testMessage)
 	}
 }
+
+func TestVerifyBatch(t *testing.T) {
+	var signedMessages [][]byte
+	var publicKeys []*[32]byte
+	var want []bool
+	otherKey, _, _ := GenerateKey(rand.Reader)
+	for i := 0; i < 20; i++ {
+		publicKey, privateKey, _ := GenerateKey(rand.Reader)
+		signedMessage := Sign(nil, []byte{byte(i)}, privateKey)
+		switch i % 4 {
+		case 1:
+			signedMessage[Overhead] ^= 1
+		case 2:
+			publicKey = otherKey
+		case 3:
+			signedMessage = signedMessage[:Overhead-1]
+		}
+		signedMessages = append(signedMessages, signedMessage)
+		publicKeys = append(publicKeys, publicKey)
+		want = append(want, i%4 == 0)
+	}
+
+	got := VerifyBatch(signedMessages, publicKeys)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("#%d: VerifyBatch = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
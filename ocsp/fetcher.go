@@ -0,0 +1,267 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoOCSPServer is returned by Fetcher.Fetch for certificates without an
+// OCSP server.
+var ErrNoOCSPServer = errors.New("ocsp: certificate has no OCSP server")
+
+const (
+	// maxGETRequestSize is the largest base64-encoded request sent by GET,
+	// see RFC 5019, Section 5.
+	maxGETRequestSize = 255
+
+	// maxResponseSize limits the size of OCSP responses read by a Fetcher.
+	maxResponseSize = 1 << 20
+)
+
+// A Fetcher requests the status of certificates from the OCSP servers listed
+// in them, and caches the responses. Its methods may be called concurrently.
+//
+// Requests are sent by GET, as described in RFC 5019, Section 5, when their
+// base64 encoding is small enough, and by POST otherwise. Concurrent
+// requests for the same certificate are sent only once.
+type Fetcher struct {
+	// Client is the HTTP client used to send requests. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// Hash is the hash function used to identify the issuer in requests.
+	// If zero, SHA-1 is used, as required by RFC 5019.
+	Hash crypto.Hash
+
+	// CacheDuration is the maximum time a response is reused. Responses
+	// are never reused after their NextUpdate time, nor after the max-age
+	// of their HTTP Cache-Control header. If zero, one hour is used. If
+	// negative, responses are not cached.
+	CacheDuration time.Duration
+
+	mu    sync.Mutex
+	cache map[fetchKey]cachedFetch
+	calls map[fetchKey]*fetchCall
+}
+
+// fetchKey identifies a request to an OCSP server.
+type fetchKey struct {
+	server  string
+	request string
+}
+
+type cachedFetch struct {
+	resp    *Response
+	expires time.Time
+}
+
+// fetchCall is a request in progress, whose result is shared by all the
+// callers of Fetch for the same certificate. It is canceled when all of
+// them have given up waiting. waiters is guarded by Fetcher.mu.
+type fetchCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	resp    *Response
+	err     error
+}
+
+// detachedContext carries the values of a Context, but not its deadline
+// or cancellation, so that a request shared by several callers of Fetch
+// is not canceled with the context of the first one.
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// Fetch returns the status of cert, issued by issuer, from the first OCSP
+// server of cert, or from the cache. The response is verified with
+// Response.Verify against issuer, so the returned error may be
+// ErrResponseNotYetValid or ErrResponseExpired. Responses with an error
+// status are returned as a ResponseError.
+//
+// The returned Response may be shared with other callers, and must not be
+// modified.
+func (f *Fetcher) Fetch(ctx context.Context, cert, issuer *x509.Certificate) (*Response, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, ErrNoOCSPServer
+	}
+	server := cert.OCSPServer[0]
+	req, err := CreateRequest(cert, issuer, &RequestOptions{Hash: f.Hash})
+	if err != nil {
+		return nil, err
+	}
+	key := fetchKey{server: server, request: string(req)}
+
+	f.mu.Lock()
+	if c, ok := f.cache[key]; ok && time.Now().Before(c.expires) {
+		f.mu.Unlock()
+		return c.resp, nil
+	}
+	call, ok := f.calls[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(detachedContext{ctx})
+		call = &fetchCall{done: make(chan struct{}), cancel: cancel}
+		if f.calls == nil {
+			f.calls = make(map[fetchKey]*fetchCall)
+		}
+		f.calls[key] = call
+		go f.run(fctx, key, call, cert, issuer)
+	}
+	call.waiters++
+	f.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.resp, call.err
+	case <-ctx.Done():
+		f.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			// Later callers start a new request rather than getting the
+			// error of this one.
+			if f.calls[key] == call {
+				delete(f.calls, key)
+			}
+		}
+		f.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run sends the request of call, and caches and publishes its result.
+func (f *Fetcher) run(ctx context.Context, key fetchKey, call *fetchCall, cert, issuer *x509.Certificate) {
+	resp, expires, err := f.fetch(ctx, key.server, []byte(key.request), cert, issuer)
+	call.cancel()
+	f.mu.Lock()
+	if f.calls[key] == call {
+		delete(f.calls, key)
+	}
+	if err == nil {
+		f.store(key, cachedFetch{resp: resp, expires: expires})
+	}
+	f.mu.Unlock()
+	call.resp, call.err = resp, err
+	close(call.done)
+}
+
+// fetch sends req to server, and returns the verified response and the time
+// until which it may be cached.
+func (f *Fetcher) fetch(ctx context.Context, server string, req []byte, cert, issuer *x509.Certificate) (*Response, time.Time, error) {
+	var hreq *http.Request
+	var err error
+	if b64 := base64.StdEncoding.EncodeToString(req); len(b64) <= maxGETRequestSize {
+		// PathEscape leaves '+' as is, which some servers decode as a
+		// space, so all of '+', '/' and '=' are escaped.
+		hreq, err = http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(server, "/")+"/"+url.QueryEscape(b64), nil)
+	} else {
+		hreq, err = http.NewRequestWithContext(ctx, "POST", server, bytes.NewReader(req))
+		if err == nil {
+			hreq.Header.Set("Content-Type", "application/ocsp-request")
+		}
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	hc := f.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(hreq)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("ocsp: server returned %s", res.Status)
+	}
+	der, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	resp, err := ParseResponseForCert(der, cert, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	now := time.Now()
+	if err := resp.Verify(VerifyOptions{Issuer: issuer, CurrentTime: now}); err != nil {
+		return nil, time.Time{}, err
+	}
+	return resp, f.expires(now, resp, res.Header.Get("Cache-Control")), nil
+}
+
+// expires returns the time until which resp, received at now with the
+// Cache-Control header cacheControl, may be cached. It is not after now if
+// resp must not be cached.
+func (f *Fetcher) expires(now time.Time, resp *Response, cacheControl string) time.Time {
+	d := f.CacheDuration
+	if d == 0 {
+		d = time.Hour
+	}
+	if d < 0 {
+		return now
+	}
+	expires := now.Add(d)
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(expires) {
+		expires = resp.NextUpdate
+	}
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store" || directive == "no-cache":
+			return now
+		case strings.HasPrefix(directive, "max-age="):
+			maxAge, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+			// Larger values than d don't shorten the cache duration, and
+			// could overflow.
+			if err != nil || maxAge < 0 || maxAge >= int64(d/time.Second) {
+				continue
+			}
+			if t := now.Add(time.Duration(maxAge) * time.Second); t.Before(expires) {
+				expires = t
+			}
+		}
+	}
+	return expires
+}
+
+// store adds c to the cache. f.mu must be held.
+func (f *Fetcher) store(key fetchKey, c cachedFetch) {
+	now := time.Now()
+	if !now.Before(c.expires) {
+		return
+	}
+	if f.cache == nil {
+		f.cache = make(map[fetchKey]cachedFetch)
+	}
+	if len(f.cache) >= maxCachedResponses {
+		for k, v := range f.cache {
+			if !now.Before(v.expires) {
+				delete(f.cache, k)
+			}
+		}
+		if len(f.cache) >= maxCachedResponses {
+			f.cache = make(map[fetchKey]cachedFetch)
+		}
+	}
+	f.cache[key] = c
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingHandler records the methods and escaped paths of the requests it
+// passes to h.
+type countingHandler struct {
+	h       http.Handler
+	mu      sync.Mutex
+	methods []string
+	paths   []string
+	block   chan struct{}
+}
+
+func (c *countingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c.mu.Lock()
+	c.methods = append(c.methods, req.Method)
+	c.paths = append(c.paths, req.URL.EscapedPath())
+	c.mu.Unlock()
+	if c.block != nil {
+		<-c.block
+	}
+	c.h.ServeHTTP(w, req)
+}
+
+func (c *countingHandler) requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.methods...)
+}
+
+func TestFetcher(t *testing.T) {
+	r, _ := newTestResponder(t)
+	h := &countingHandler{h: r}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	f := &Fetcher{}
+	cert := &x509.Certificate{SerialNumber: big.NewInt(1), OCSPServer: []string{ts.URL + "/ocsp/"}}
+	resp, err := f.Fetch(context.Background(), cert, r.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != Good || resp.SerialNumber.Int64() != 1 {
+		t.Errorf("got status %d for serial %v, want Good for 1", resp.Status, resp.SerialNumber)
+	}
+	if _, err := f.Fetch(context.Background(), cert, r.Issuer); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.requests(); len(got) != 1 || got[0] != "GET" {
+		t.Errorf("got requests %q, want a single GET", got)
+	}
+	h.mu.Lock()
+	path := h.paths[0]
+	h.mu.Unlock()
+	if b64 := strings.TrimPrefix(path, "/ocsp/"); strings.ContainsAny(b64, "+/=") {
+		t.Errorf("GET request path %q isn't fully escaped", path)
+	}
+
+	// Serial 2 has no NextUpdate, and is cached for CacheDuration.
+	revoked := &x509.Certificate{SerialNumber: big.NewInt(2), OCSPServer: cert.OCSPServer}
+	for i := 0; i < 2; i++ {
+		resp, err := f.Fetch(context.Background(), revoked, r.Issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != Revoked {
+			t.Errorf("got status %d, want Revoked", resp.Status)
+		}
+	}
+	if got := h.requests(); len(got) != 2 {
+		t.Errorf("got %d requests, want 2", len(got))
+	}
+
+	// Requests too large for GET are sent by POST.
+	serial := new(big.Int).Lsh(big.NewInt(1), 1600)
+	large := &x509.Certificate{SerialNumber: serial, OCSPServer: cert.OCSPServer}
+	if _, err := f.Fetch(context.Background(), large, r.Issuer); err == nil {
+		t.Error("Fetch succeeded for an unknown certificate")
+	}
+	if got := h.requests(); len(got) != 3 || got[2] != "POST" {
+		t.Errorf("got requests %q, want a final POST", got)
+	}
+
+	if _, err := f.Fetch(context.Background(), &x509.Certificate{SerialNumber: large.SerialNumber}, r.Issuer); err != ErrNoOCSPServer {
+		t.Errorf("got error %v, want ErrNoOCSPServer", err)
+	}
+
+	// Responses signed by another CA are rejected.
+	other, _ := newTestCA(t, "Other CA")
+	if _, err := (&Fetcher{}).Fetch(context.Background(), cert, other); err == nil {
+		t.Error("Fetch succeeded with the wrong issuer")
+	}
+}
+
+func TestFetcherDeduplication(t *testing.T) {
+	r, source := newTestResponder(t)
+	h := &countingHandler{h: r, block: make(chan struct{})}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	f := &Fetcher{}
+	cert := &x509.Certificate{SerialNumber: big.NewInt(1), OCSPServer: []string{ts.URL}}
+	const n = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := f.Fetch(context.Background(), cert, r.Issuer)
+			errs <- err
+		}()
+	}
+	// Wait for the first request, and give the other callers time to join
+	// it before answering.
+	for len(h.requests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(h.block)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := len(h.requests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+	if source.calls != 1 {
+		t.Errorf("Source was called %d times, want 1", source.calls)
+	}
+}
+
+func TestFetcherCancel(t *testing.T) {
+	r, _ := newTestResponder(t)
+	h := &countingHandler{h: r, block: make(chan struct{})}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	f := &Fetcher{}
+	cert := &x509.Certificate{SerialNumber: big.NewInt(1), OCSPServer: []string{ts.URL}}
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := f.Fetch(ctx, cert, r.Issuer)
+		first <- err
+	}()
+	for len(h.requests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error, 1)
+	go func() {
+		_, err := f.Fetch(context.Background(), cert, r.Issuer)
+		second <- err
+	}()
+	// Give the second caller time to join the request.
+	time.Sleep(50 * time.Millisecond)
+
+	// The first caller giving up doesn't cancel the request of the second.
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("got error %v for the canceled caller, want context.Canceled", err)
+	}
+	close(h.block)
+	if err := <-second; err != nil {
+		t.Errorf("Fetch failed after another caller gave up: %v", err)
+	}
+	if got := len(h.requests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestFetcherExpires(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		cacheDuration time.Duration
+		nextUpdate    time.Duration
+		cacheControl  string
+		want          time.Duration
+	}{
+		{0, 0, "", time.Hour},
+		{0, 10 * time.Minute, "", 10 * time.Minute},
+		{0, 10 * time.Minute, "max-age=60, public", time.Minute},
+		{0, 10 * time.Minute, "Max-Age=7200", 10 * time.Minute},
+		{0, 0, "max-age=99999999999999999999", time.Hour},
+		{0, 10 * time.Minute, "no-cache", 0},
+		{time.Minute, 10 * time.Minute, "max-age=120", time.Minute},
+		{-1, 10 * time.Minute, "max-age=120", 0},
+		{0, -time.Minute, "", -time.Minute},
+	}
+	for i, test := range tests {
+		f := &Fetcher{CacheDuration: test.cacheDuration}
+		resp := &Response{}
+		if test.nextUpdate != 0 {
+			resp.NextUpdate = now.Add(test.nextUpdate)
+		}
+		if got := f.expires(now, resp, test.cacheControl).Sub(now); got != test.want {
+			t.Errorf("%d: got %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestFetcherServerError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	issuer, _ := newTestCA(t, "Test CA")
+	cert := &x509.Certificate{SerialNumber: big.NewInt(1), OCSPServer: []string{ts.URL}}
+	_, err := (&Fetcher{}).Fetch(context.Background(), cert, issuer)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("got error %v, want an HTTP status error", err)
+	}
+}
@@ -5,6 +5,7 @@
 // Package ocsp parses OCSP responses as specified in RFC 2560. OCSP responses
 // are signed messages attesting to the validity of a certificate for a small
 // period of time. This is used to manage revocation for X.509 certificates.
+// Responder serves OCSP responses over HTTP.
 package ocsp
 
 import (
@@ -16,6 +17,7 @@ import (
 	_ "crypto/sha1"
 	_ "crypto/sha256"
 	_ "crypto/sha512"
+	"crypto/subtle"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
@@ -89,9 +91,10 @@ type ocspRequest struct {
 }
 
 type tbsRequest struct {
-	Version       int              `asn1:"explicit,tag:0,default:0,optional"`
-	RequestorName pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
-	RequestList   []request
+	Version           int              `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName     pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
+	RequestList       []request
+	RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
 }
 
 type request struct {
@@ -116,11 +119,12 @@ type basicResponse struct {
 }
 
 type responseData struct {
-	Raw            asn1.RawContent
-	Version        int `asn1:"optional,default:0,explicit,tag:0"`
-	RawResponderID asn1.RawValue
-	ProducedAt     time.Time `asn1:"generalized"`
-	Responses      []singleResponse
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []singleResponse
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
 }
 
 type singleResponse struct {
@@ -315,6 +319,10 @@ type Request struct {
 	IssuerNameHash []byte
 	IssuerKeyHash  []byte
 	SerialNumber   *big.Int
+
+	// Extensions contains the requestExtensions field of the request, such
+	// as a nonce. It is populated by ParseRequest and included by Marshal.
+	Extensions []pkix.Extension
 }
 
 // Marshal marshals the OCSP request to ASN.1 DER encoded form.
@@ -339,6 +347,7 @@ func (req *Request) Marshal() ([]byte, error) {
 					},
 				},
 			},
+			RequestExtensions: req.Extensions,
 		},
 	})
 }
@@ -387,6 +396,20 @@ type Response struct {
 	// ExtraExtensions field is not populated when parsing certificates, see
 	// Extensions.
 	ExtraExtensions []pkix.Extension
+
+	// ResponseExtensions contains raw X.509 extensions from the
+	// responseExtensions field of the OCSP response, such as a nonce. It is
+	// populated when parsing, and ignored when marshaling, see
+	// ExtraResponseExtensions.
+	ResponseExtensions []pkix.Extension
+
+	// ExtraResponseExtensions contains extensions to be copied, raw, into
+	// the responseExtensions field of any marshaled OCSP response.
+	ExtraResponseExtensions []pkix.Extension
+
+	// issuerNameHash and issuerKeyHash identify the issuer in a parsed
+	// response, see Verify.
+	issuerNameHash, issuerKeyHash []byte
 }
 
 // These are pre-serialized error responses for the various non-success codes
@@ -418,9 +441,38 @@ func (p ParseError) Error() string {
 }
 
 // ParseRequest parses an OCSP request in DER form. It only supports
-// requests for a single certificate. Signed requests are not supported.
-// If a request includes a signature, it will result in a ParseError.
+// requests for a single certificate: if the request is for multiple
+// certificates, only the first one is returned, see ParseRequests.
+// Signed requests are not supported. If a request includes a signature, it
+// will result in a ParseError.
 func ParseRequest(bytes []byte) (*Request, error) {
+	req, err := parseRequest(bytes)
+	if err != nil {
+		return nil, err
+	}
+	return newRequest(req.TBSRequest.RequestList[0], req.TBSRequest.RequestExtensions)
+}
+
+// ParseRequests parses an OCSP request in DER form, which may be for
+// multiple certificates. It returns a Request for each of them, in order,
+// all with the same Extensions. Signed requests are not supported.
+func ParseRequests(bytes []byte) ([]*Request, error) {
+	req, err := parseRequest(bytes)
+	if err != nil {
+		return nil, err
+	}
+	reqs := make([]*Request, 0, len(req.TBSRequest.RequestList))
+	for _, r := range req.TBSRequest.RequestList {
+		parsed, err := newRequest(r, req.TBSRequest.RequestExtensions)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, parsed)
+	}
+	return reqs, nil
+}
+
+func parseRequest(bytes []byte) (*ocspRequest, error) {
 	var req ocspRequest
 	rest, err := asn1.Unmarshal(bytes, &req)
 	if err != nil {
@@ -433,8 +485,10 @@ func ParseRequest(bytes []byte) (*Request, error) {
 	if len(req.TBSRequest.RequestList) == 0 {
 		return nil, ParseError("OCSP request contains no request body")
 	}
-	innerRequest := req.TBSRequest.RequestList[0]
+	return &req, nil
+}
 
+func newRequest(innerRequest request, extensions []pkix.Extension) (*Request, error) {
 	hashFunc := getHashAlgorithmFromOID(innerRequest.Cert.HashAlgorithm.Algorithm)
 	if hashFunc == crypto.Hash(0) {
 		return nil, ParseError("OCSP request uses unknown hash function")
@@ -445,6 +499,7 @@ func ParseRequest(bytes []byte) (*Request, error) {
 		IssuerNameHash: innerRequest.Cert.NameHash,
 		IssuerKeyHash:  innerRequest.Cert.IssuerKeyHash,
 		SerialNumber:   innerRequest.Cert.SerialNumber,
+		Extensions:     extensions,
 	}, nil
 }
 
@@ -473,6 +528,74 @@ func ParseResponse(bytes []byte, issuer *x509.Certificate) (*Response, error) {
 // the first status which contains a matching serial, otherwise it will return an
 // error. If cert is nil, then the first status in the response will be returned.
 func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Response, error) {
+	basicResp, err := parseBasicResponse(bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := len(basicResp.TBSResponseData.Responses); n == 0 || cert == nil && n > 1 {
+		return nil, ParseError("OCSP response contains bad number of responses")
+	}
+
+	var singleResp singleResponse
+	if cert == nil {
+		singleResp = basicResp.TBSResponseData.Responses[0]
+	} else {
+		match := false
+		for _, resp := range basicResp.TBSResponseData.Responses {
+			if cert.SerialNumber.Cmp(resp.CertID.SerialNumber) == 0 {
+				singleResp = resp
+				match = true
+				break
+			}
+		}
+		if !match {
+			return nil, ParseError("no response matching the supplied certificate")
+		}
+	}
+
+	ret, err := newResponse(bytes, basicResp, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if err := ret.setSingleResponse(singleResp); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ParseResponses parses an OCSP response in DER form, which may contain the
+// statuses of multiple certificates, such as a response to a request created
+// by CreateMultiRequest. It returns a Response for each status, in order,
+// which share the fields of the response that aren't specific to a status.
+// The signature is checked as by ParseResponse.
+func ParseResponses(bytes []byte, issuer *x509.Certificate) ([]*Response, error) {
+	basicResp, err := parseBasicResponse(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(basicResp.TBSResponseData.Responses) == 0 {
+		return nil, ParseError("OCSP response contains bad number of responses")
+	}
+
+	template, err := newResponse(bytes, basicResp, issuer)
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]*Response, 0, len(basicResp.TBSResponseData.Responses))
+	for _, singleResp := range basicResp.TBSResponseData.Responses {
+		ret := *template
+		if err := ret.setSingleResponse(singleResp); err != nil {
+			return nil, err
+		}
+		resps = append(resps, &ret)
+	}
+	return resps, nil
+}
+
+// parseBasicResponse parses the ASN.1 structure of a successful OCSP
+// response, without checking it.
+func parseBasicResponse(bytes []byte) (*basicResponse, error) {
 	var resp responseASN1
 	rest, err := asn1.Unmarshal(bytes, &resp)
 	if err != nil {
@@ -498,38 +621,19 @@ func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Respon
 	if len(rest) > 0 {
 		return nil, ParseError("trailing data in OCSP response")
 	}
+	return &basicResp, nil
+}
 
-	if n := len(basicResp.TBSResponseData.Responses); n == 0 || cert == nil && n > 1 {
-		return nil, ParseError("OCSP response contains bad number of responses")
-	}
-
-	var singleResp singleResponse
-	if cert == nil {
-		singleResp = basicResp.TBSResponseData.Responses[0]
-	} else {
-		match := false
-		for _, resp := range basicResp.TBSResponseData.Responses {
-			if cert.SerialNumber.Cmp(resp.CertID.SerialNumber) == 0 {
-				singleResp = resp
-				match = true
-				break
-			}
-		}
-		if !match {
-			return nil, ParseError("no response matching the supplied certificate")
-		}
-	}
-
+// newResponse returns a Response with the fields of basicResp that are
+// shared by all of its statuses, after checking its signature.
+func newResponse(bytes []byte, basicResp *basicResponse, issuer *x509.Certificate) (*Response, error) {
 	ret := &Response{
 		Raw:                bytes,
 		TBSResponseData:    basicResp.TBSResponseData.Raw,
 		Signature:          basicResp.Signature.RightAlign(),
 		SignatureAlgorithm: getSignatureAlgorithmFromOID(basicResp.SignatureAlgorithm.Algorithm),
-		Extensions:         singleResp.SingleExtensions,
-		SerialNumber:       singleResp.CertID.SerialNumber,
+		ResponseExtensions: basicResp.TBSResponseData.ResponseExtensions,
 		ProducedAt:         basicResp.TBSResponseData.ProducedAt,
-		ThisUpdate:         singleResp.ThisUpdate,
-		NextUpdate:         singleResp.NextUpdate,
 	}
 
 	// Handle the ResponderID CHOICE tag. ResponderID can be flattened into
@@ -559,6 +663,7 @@ func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Respon
 		// ignore all but the first.
 		//
 		// [1] https://github.com/golang/go/issues/21527
+		var err error
 		ret.Certificate, err = x509.ParseCertificate(basicResp.Certificates[0].FullBytes)
 		if err != nil {
 			return nil, err
@@ -578,10 +683,22 @@ func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Respon
 			return nil, ParseError("bad OCSP signature: " + err.Error())
 		}
 	}
+	return ret, nil
+}
+
+// setSingleResponse sets the fields of ret that are specific to the status
+// of a certificate.
+func (ret *Response) setSingleResponse(singleResp singleResponse) error {
+	ret.Extensions = singleResp.SingleExtensions
+	ret.SerialNumber = singleResp.CertID.SerialNumber
+	ret.ThisUpdate = singleResp.ThisUpdate
+	ret.NextUpdate = singleResp.NextUpdate
+	ret.issuerNameHash = singleResp.CertID.NameHash
+	ret.issuerKeyHash = singleResp.CertID.IssuerKeyHash
 
 	for _, ext := range singleResp.SingleExtensions {
 		if ext.Critical {
-			return nil, ParseError("unsupported critical extension")
+			return ParseError("unsupported critical extension")
 		}
 	}
 
@@ -592,7 +709,7 @@ func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Respon
 		}
 	}
 	if ret.IssuerHash == 0 {
-		return nil, ParseError("unsupported issuer hash algorithm")
+		return ParseError("unsupported issuer hash algorithm")
 	}
 
 	switch {
@@ -605,8 +722,7 @@ func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Respon
 		ret.RevokedAt = singleResp.Revoked.RevocationTime
 		ret.RevocationReason = int(singleResp.Revoked.Reason)
 	}
-
-	return ret, nil
+	return nil
 }
 
 // RequestOptions contains options for constructing OCSP requests.
@@ -614,6 +730,12 @@ type RequestOptions struct {
 	// Hash contains the hash function that should be used when
 	// constructing the OCSP request. If zero, SHA-1 will be used.
 	Hash crypto.Hash
+
+	// Nonce, if not empty, is included in the request as a nonce
+	// extension, see RFC 8954. A responder that supports nonces includes
+	// it in its response, which can be checked with Response.CheckNonce.
+	// GenerateNonce returns a suitable nonce.
+	Nonce []byte
 }
 
 func (opts *RequestOptions) hash() crypto.Hash {
@@ -624,15 +746,64 @@ func (opts *RequestOptions) hash() crypto.Hash {
 	return opts.Hash
 }
 
+// GenerateNonce returns a random nonce for RequestOptions.Nonce, of the
+// maximum size allowed by RFC 8954.
+func GenerateNonce() ([]byte, error) {
+	nonce := make([]byte, maxNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// ErrNoNonce is returned by Response.CheckNonce for responses without a
+// nonce, for example from a responder that doesn't support nonces.
+var ErrNoNonce = errors.New("ocsp: response has no nonce")
+
+// ErrNonceMismatch is returned by Response.CheckNonce for responses with a
+// nonce that is different from the one of the request.
+var ErrNonceMismatch = errors.New("ocsp: response nonce does not match the request")
+
+// CheckNonce checks that resp includes nonce, the nonce of the request it
+// answers, in its response extensions. It returns ErrNoNonce if resp has no
+// nonce, and ErrNonceMismatch if it has another one.
+func (resp *Response) CheckNonce(nonce []byte) error {
+	for _, ext := range resp.ResponseExtensions {
+		if !ext.Id.Equal(idPKIXOCSPNonce) {
+			continue
+		}
+		var got []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &got); err != nil || len(rest) != 0 {
+			return ParseError("invalid OCSP nonce")
+		}
+		if subtle.ConstantTimeCompare(got, nonce) != 1 {
+			return ErrNonceMismatch
+		}
+		return nil
+	}
+	return ErrNoNonce
+}
+
 // CreateRequest returns a DER-encoded, OCSP request for the status of cert. If
 // opts is nil then sensible defaults are used.
 func CreateRequest(cert, issuer *x509.Certificate, opts *RequestOptions) ([]byte, error) {
+	return CreateMultiRequest([]*x509.Certificate{cert}, issuer, opts)
+}
+
+// CreateMultiRequest returns a DER-encoded, OCSP request for the status of
+// all of certs, which must have been issued by issuer. The response can be
+// parsed with ParseResponses, or with ParseResponseForCert for each of
+// certs. If opts is nil then sensible defaults are used.
+func CreateMultiRequest(certs []*x509.Certificate, issuer *x509.Certificate, opts *RequestOptions) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("ocsp: no certificates to request the status of")
+	}
 	hashFunc := opts.hash()
 
 	// OCSP seems to be the only place where these raw hash identifiers are
 	// used. I took the following from
 	// http://msdn.microsoft.com/en-us/library/ff635603.aspx
-	_, ok := hashOIDs[hashFunc]
+	hashAlg, ok := hashOIDs[hashFunc]
 	if !ok {
 		return nil, x509.ErrUnsupportedAlgorithm
 	}
@@ -657,13 +828,39 @@ func CreateRequest(cert, issuer *x509.Certificate, opts *RequestOptions) ([]byte
 	h.Write(issuer.RawSubject)
 	issuerNameHash := h.Sum(nil)
 
-	req := &Request{
-		HashAlgorithm:  hashFunc,
-		IssuerNameHash: issuerNameHash,
-		IssuerKeyHash:  issuerKeyHash,
-		SerialNumber:   cert.SerialNumber,
+	var extensions []pkix.Extension
+	if opts != nil && len(opts.Nonce) > 0 {
+		if len(opts.Nonce) > maxNonceSize {
+			return nil, errors.New("ocsp: nonce is longer than 32 bytes")
+		}
+		value, err := asn1.Marshal(opts.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		extensions = []pkix.Extension{{Id: idPKIXOCSPNonce, Value: value}}
 	}
-	return req.Marshal()
+
+	requestList := make([]request, 0, len(certs))
+	for _, cert := range certs {
+		requestList = append(requestList, request{
+			Cert: certID{
+				pkix.AlgorithmIdentifier{
+					Algorithm:  hashAlg,
+					Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
+				},
+				issuerNameHash,
+				issuerKeyHash,
+				cert.SerialNumber,
+			},
+		})
+	}
+	return asn1.Marshal(ocspRequest{
+		tbsRequest{
+			Version:           0,
+			RequestList:       requestList,
+			RequestExtensions: extensions,
+		},
+	})
 }
 
 // CreateResponse returns a DER-encoded OCSP response with the specified contents.
@@ -676,11 +873,26 @@ func CreateRequest(cert, issuer *x509.Certificate, opts *RequestOptions) ([]byte
 //
 // The template is used to populate the SerialNumber, Status, RevokedAt,
 // RevocationReason, ThisUpdate, and NextUpdate fields.
+// Its ExtraExtensions and ExtraResponseExtensions are copied into the
+// singleExtensions and responseExtensions fields.
 //
 // If template.IssuerHash is not set, SHA1 will be used.
 //
 // The ProducedAt date is automatically set to the current date, to the nearest minute.
 func CreateResponse(issuer, responderCert *x509.Certificate, template Response, priv crypto.Signer) ([]byte, error) {
+	return CreateMultiResponse(issuer, responderCert, []Response{template}, priv)
+}
+
+// CreateMultiResponse returns a DER-encoded OCSP response with the statuses
+// of multiple certificates, in the same way as CreateResponse. Each of
+// templates populates one status, and the fields of the response that aren't
+// specific to a status, such as ExtraResponseExtensions, Certificate and
+// SignatureAlgorithm, are taken from templates[0].
+func CreateMultiResponse(issuer, responderCert *x509.Certificate, templates []Response, priv crypto.Signer) ([]byte, error) {
+	if len(templates) == 0 {
+		return nil, errors.New("ocsp: no certificate statuses to respond with")
+	}
+
 	var publicKeyInfo struct {
 		Algorithm pkix.AlgorithmIdentifier
 		PublicKey asn1.BitString
@@ -689,51 +901,15 @@ func CreateResponse(issuer, responderCert *x509.Certificate, template Response,
 		return nil, err
 	}
 
-	if template.IssuerHash == 0 {
-		template.IssuerHash = crypto.SHA1
-	}
-	hashOID := getOIDFromHashAlgorithm(template.IssuerHash)
-	if hashOID == nil {
-		return nil, errors.New("unsupported issuer hash algorithm")
-	}
-
-	if !template.IssuerHash.Available() {
-		return nil, fmt.Errorf("issuer hash algorithm %v not linked into binary", template.IssuerHash)
-	}
-	h := template.IssuerHash.New()
-	h.Write(publicKeyInfo.PublicKey.RightAlign())
-	issuerKeyHash := h.Sum(nil)
-
-	h.Reset()
-	h.Write(issuer.RawSubject)
-	issuerNameHash := h.Sum(nil)
-
-	innerResponse := singleResponse{
-		CertID: certID{
-			HashAlgorithm: pkix.AlgorithmIdentifier{
-				Algorithm:  hashOID,
-				Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
-			},
-			NameHash:      issuerNameHash,
-			IssuerKeyHash: issuerKeyHash,
-			SerialNumber:  template.SerialNumber,
-		},
-		ThisUpdate:       template.ThisUpdate.UTC(),
-		NextUpdate:       template.NextUpdate.UTC(),
-		SingleExtensions: template.ExtraExtensions,
-	}
-
-	switch template.Status {
-	case Good:
-		innerResponse.Good = true
-	case Unknown:
-		innerResponse.Unknown = true
-	case Revoked:
-		innerResponse.Revoked = revokedInfo{
-			RevocationTime: template.RevokedAt.UTC(),
-			Reason:         asn1.Enumerated(template.RevocationReason),
+	responses := make([]singleResponse, 0, len(templates))
+	for _, template := range templates {
+		innerResponse, err := newSingleResponse(issuer, publicKeyInfo.PublicKey.RightAlign(), template)
+		if err != nil {
+			return nil, err
 		}
+		responses = append(responses, innerResponse)
 	}
+	template := templates[0]
 
 	rawResponderID := asn1.RawValue{
 		Class:      2, // context-specific
@@ -742,10 +918,11 @@ func CreateResponse(issuer, responderCert *x509.Certificate, template Response,
 		Bytes:      responderCert.RawSubject,
 	}
 	tbsResponseData := responseData{
-		Version:        0,
-		RawResponderID: rawResponderID,
-		ProducedAt:     time.Now().Truncate(time.Minute).UTC(),
-		Responses:      []singleResponse{innerResponse},
+		Version:            0,
+		RawResponderID:     rawResponderID,
+		ProducedAt:         time.Now().Truncate(time.Minute).UTC(),
+		Responses:          responses,
+		ResponseExtensions: template.ExtraResponseExtensions,
 	}
 
 	tbsResponseDataDER, err := asn1.Marshal(tbsResponseData)
@@ -791,3 +968,54 @@ func CreateResponse(issuer, responderCert *x509.Certificate, template Response,
 		},
 	})
 }
+
+// newSingleResponse returns the status of a certificate of issuer, whose
+// public key is issuerKey, as described by template.
+func newSingleResponse(issuer *x509.Certificate, issuerKey []byte, template Response) (singleResponse, error) {
+	if template.IssuerHash == 0 {
+		template.IssuerHash = crypto.SHA1
+	}
+	hashOID := getOIDFromHashAlgorithm(template.IssuerHash)
+	if hashOID == nil {
+		return singleResponse{}, errors.New("unsupported issuer hash algorithm")
+	}
+
+	if !template.IssuerHash.Available() {
+		return singleResponse{}, fmt.Errorf("issuer hash algorithm %v not linked into binary", template.IssuerHash)
+	}
+	h := template.IssuerHash.New()
+	h.Write(issuerKey)
+	issuerKeyHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	issuerNameHash := h.Sum(nil)
+
+	innerResponse := singleResponse{
+		CertID: certID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  hashOID,
+				Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
+			},
+			NameHash:      issuerNameHash,
+			IssuerKeyHash: issuerKeyHash,
+			SerialNumber:  template.SerialNumber,
+		},
+		ThisUpdate:       template.ThisUpdate.UTC(),
+		NextUpdate:       template.NextUpdate.UTC(),
+		SingleExtensions: template.ExtraExtensions,
+	}
+
+	switch template.Status {
+	case Good:
+		innerResponse.Good = true
+	case Unknown:
+		innerResponse.Unknown = true
+	case Revoked:
+		innerResponse.Revoked = revokedInfo{
+			RevocationTime: template.RevokedAt.UTC(),
+			Reason:         asn1.Enumerated(template.RevocationReason),
+		}
+	}
+	return innerResponse, nil
+}
@@ -436,6 +436,131 @@ func TestOCSPDecodeMultiResponseWithoutMatchingCert(t *testing.T) {
 	}
 }
 
+func TestMultiRequestResponse(t *testing.T) {
+	issuer, key := newTestCA(t, "Test CA")
+	certs := []*x509.Certificate{
+		{SerialNumber: big.NewInt(1)},
+		{SerialNumber: big.NewInt(2)},
+		{SerialNumber: big.NewInt(3)},
+	}
+	nonce, err := GenerateNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := CreateMultiRequest(certs, issuer, &RequestOptions{Hash: crypto.SHA256, Nonce: nonce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs, err := ParseRequests(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != len(certs) {
+		t.Fatalf("got %d requests, want %d", len(reqs), len(certs))
+	}
+	nonceExt, err := requestNonce(reqs[0])
+	if err != nil || nonceExt == nil {
+		t.Fatalf("request has no valid nonce: %v", err)
+	}
+	var templates []Response
+	for i, req := range reqs {
+		if req.SerialNumber.Cmp(certs[i].SerialNumber) != 0 || req.HashAlgorithm != crypto.SHA256 {
+			t.Errorf("request %d: got serial %v and hash %v", i, req.SerialNumber, req.HashAlgorithm)
+		}
+		templates = append(templates, Response{
+			Status:                  i % 2,
+			SerialNumber:            req.SerialNumber,
+			ThisUpdate:              time.Now().Truncate(time.Second),
+			RevokedAt:               time.Now().Add(-time.Hour).Truncate(time.Second),
+			IssuerHash:              req.HashAlgorithm,
+			ExtraResponseExtensions: []pkix.Extension{*nonceExt},
+		})
+	}
+	if first, err := ParseRequest(der); err != nil || !reflect.DeepEqual(first, reqs[0]) {
+		t.Errorf("ParseRequest = %+v, %v; want the first request", first, err)
+	}
+
+	der, err = CreateMultiResponse(issuer, issuer, templates, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resps, err := ParseResponses(der, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != len(certs) {
+		t.Fatalf("got %d responses, want %d", len(resps), len(certs))
+	}
+	for i, resp := range resps {
+		if resp.SerialNumber.Cmp(certs[i].SerialNumber) != 0 || resp.Status != templates[i].Status {
+			t.Errorf("response %d: got serial %v and status %d", i, resp.SerialNumber, resp.Status)
+		}
+		if err := resp.CheckNonce(nonce); err != nil {
+			t.Errorf("response %d: %v", i, err)
+		}
+		single, err := ParseResponseForCert(der, certs[i], issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(single, resp) {
+			t.Errorf("ParseResponseForCert = %+v, want %+v", single, resp)
+		}
+	}
+	if _, err := ParseResponse(der, issuer); err == nil {
+		t.Error("ParseResponse accepted a response with multiple statuses")
+	}
+
+	if _, err := CreateMultiRequest(nil, issuer, nil); err == nil {
+		t.Error("CreateMultiRequest accepted no certificates")
+	}
+	if _, err := CreateRequest(certs[0], issuer, &RequestOptions{Nonce: make([]byte, 33)}); err == nil {
+		t.Error("CreateRequest accepted a 33 byte nonce")
+	}
+	if _, err := CreateMultiResponse(issuer, issuer, nil, key); err == nil {
+		t.Error("CreateMultiResponse accepted no statuses")
+	}
+}
+
+func TestCheckNonce(t *testing.T) {
+	issuer, key := newTestCA(t, "Test CA")
+	nonce := []byte{1, 2, 3}
+	value, err := asn1.Marshal(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		extensions []pkix.Extension
+		want       error
+	}{
+		{[]pkix.Extension{{Id: idPKIXOCSPNonce, Value: value}}, nil},
+		{nil, ErrNoNonce},
+		{[]pkix.Extension{{Id: idPKIXOCSPBasic, Value: value}}, ErrNoNonce},
+		{[]pkix.Extension{{Id: idPKIXOCSPNonce, Value: value[:len(value)-1]}}, ParseError("invalid OCSP nonce")},
+	} {
+		der, err := CreateResponse(issuer, issuer, Response{
+			Status:                  Good,
+			SerialNumber:            big.NewInt(1),
+			ThisUpdate:              time.Now(),
+			ExtraResponseExtensions: tt.extensions,
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ParseResponse(der, issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := resp.CheckNonce(nonce); err != tt.want {
+			t.Errorf("CheckNonce with extensions %v: got %v, want %v", tt.extensions, err, tt.want)
+		}
+		if tt.want == nil {
+			if err := resp.CheckNonce([]byte{1, 2, 4}); err != ErrNonceMismatch {
+				t.Errorf("CheckNonce with another nonce: got %v, want %v", err, ErrNonceMismatch)
+			}
+		}
+	}
+}
+
 // This OCSP response was taken from GTS's public OCSP responder.
 // To recreate:
 //   $ openssl s_client -tls1 -showcerts -servername golang.org -connect golang.org:443
@@ -0,0 +1,327 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var idPKIXOCSPNonce = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 5, 5, 7, 48, 1, 2})
+
+// ErrUnknownCertificate may be returned by a Source for serial numbers it
+// does not know about. The Responder then replies with an unauthorized
+// error, as described in RFC 5019, Section 2.2.3.
+var ErrUnknownCertificate = errors.New("ocsp: unknown certificate")
+
+// A Source provides the status of certificates for a Responder.
+type Source interface {
+	// Status returns the status of the certificate with the given serial
+	// number, issued by the Responder's Issuer. Only the Status,
+	// RevokedAt, RevocationReason, ThisUpdate, NextUpdate and
+	// ExtraExtensions fields of the returned Response are used.
+	//
+	// If the certificate is not known, Status returns either a Response
+	// with an Unknown status, or ErrUnknownCertificate.
+	Status(ctx context.Context, serial *big.Int) (*Response, error)
+}
+
+const (
+	// maxRequestSize limits the size of OCSP requests read from POST
+	// bodies.
+	maxRequestSize = 10 << 10
+
+	// maxNonceSize is the maximum nonce length, see RFC 8954, Section 2.1.
+	maxNonceSize = 32
+
+	// maxCachedResponses limits the number of responses kept by a
+	// Responder or a Fetcher.
+	maxCachedResponses = 10000
+)
+
+// Responder is an http.Handler that answers OCSP requests for certificates
+// issued by a single CA, as described in RFC 6960, Appendix A, and RFC 5019.
+// Requests are accepted by POST, and by GET with the base64-encoded request
+// as the last part of the path, so the Responder is usually mounted at the
+// root of its own host, or behind http.StripPrefix.
+//
+// Signed responses are cached for requests without a nonce. Requests with
+// a nonce are answered with a freshly signed response that includes the
+// nonce.
+type Responder struct {
+	// Issuer is the CA certificate whose certificates the Responder
+	// answers for.
+	Issuer *x509.Certificate
+
+	// ResponderCert is the certificate of Signer. If nil, Signer is the
+	// key of Issuer. Otherwise, ResponderCert must have been issued by
+	// Issuer for OCSP signing, and is included in responses.
+	ResponderCert *x509.Certificate
+
+	// Signer signs the responses.
+	Signer crypto.Signer
+
+	// Source provides the status of certificates.
+	Source Source
+
+	// CacheDuration is the maximum time a signed response is reused.
+	// Responses are never reused after their NextUpdate time. If zero,
+	// one hour is used. If negative, responses are not cached.
+	CacheDuration time.Duration
+
+	// ErrorLog optionally specifies a logger for errors returned by Source
+	// and by signing. If nil, logging goes to os.Stderr via the log
+	// package's standard logger.
+	ErrorLog *log.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	der        []byte
+	thisUpdate time.Time
+	nextUpdate time.Time
+	expires    time.Time
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var der []byte
+	switch req.Method {
+	case http.MethodGet:
+		// The base64 encoding may contain escaped slashes, so the last
+		// part of the escaped path is used.
+		path := req.URL.EscapedPath()
+		b64, err := url.PathUnescape(path[strings.LastIndex(path, "/")+1:])
+		if err == nil {
+			der, err = base64.StdEncoding.DecodeString(b64)
+		}
+		if err != nil {
+			r.writeResponse(w, MalformedRequestErrorResponse, nil)
+			return
+		}
+	case http.MethodPost:
+		var err error
+		if der, err = io.ReadAll(http.MaxBytesReader(w, req.Body, maxRequestSize)); err != nil {
+			r.writeResponse(w, MalformedRequestErrorResponse, nil)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ocspReq, err := ParseRequest(der)
+	if err != nil {
+		r.writeResponse(w, MalformedRequestErrorResponse, nil)
+		return
+	}
+	nonce, err := requestNonce(ocspReq)
+	if err != nil {
+		r.writeResponse(w, MalformedRequestErrorResponse, nil)
+		return
+	}
+	if !r.issuedByIssuer(ocspReq) {
+		r.writeResponse(w, UnauthorizedErrorResponse, nil)
+		return
+	}
+
+	cacheKey := ocspReq.HashAlgorithm.String() + ":" + ocspReq.SerialNumber.Text(16)
+	if nonce == nil {
+		if c, ok := r.cached(cacheKey); ok {
+			r.writeResponse(w, c.der, &c)
+			return
+		}
+	}
+
+	status, err := r.Source.Status(req.Context(), ocspReq.SerialNumber)
+	if errors.Is(err, ErrUnknownCertificate) {
+		r.writeResponse(w, UnauthorizedErrorResponse, nil)
+		return
+	}
+	if err != nil {
+		r.logf("ocsp: status of serial %x: %v", ocspReq.SerialNumber, err)
+		r.writeResponse(w, InternalErrorErrorResponse, nil)
+		return
+	}
+
+	template := Response{
+		Status:           status.Status,
+		SerialNumber:     ocspReq.SerialNumber,
+		ThisUpdate:       status.ThisUpdate,
+		NextUpdate:       status.NextUpdate,
+		RevokedAt:        status.RevokedAt,
+		RevocationReason: status.RevocationReason,
+		IssuerHash:       ocspReq.HashAlgorithm,
+		ExtraExtensions:  status.ExtraExtensions,
+	}
+	if template.ThisUpdate.IsZero() {
+		template.ThisUpdate = time.Now()
+	}
+	if nonce != nil {
+		template.ExtraResponseExtensions = []pkix.Extension{*nonce}
+	}
+	responderCert := r.Issuer
+	if r.ResponderCert != nil {
+		responderCert = r.ResponderCert
+		template.Certificate = r.ResponderCert
+	}
+	resp, err := CreateResponse(r.Issuer, responderCert, template, r.Signer)
+	if err != nil {
+		r.logf("ocsp: signing response for serial %x: %v", ocspReq.SerialNumber, err)
+		r.writeResponse(w, InternalErrorErrorResponse, nil)
+		return
+	}
+
+	if nonce != nil {
+		// The response is specific to this request.
+		w.Header().Set("Cache-Control", "no-store")
+		r.writeResponse(w, resp, nil)
+		return
+	}
+	c := cachedResponse{
+		der:        resp,
+		thisUpdate: template.ThisUpdate,
+		nextUpdate: template.NextUpdate,
+	}
+	r.store(cacheKey, &c)
+	r.writeResponse(w, resp, &c)
+}
+
+// requestNonce returns the nonce extension of req, or nil if there is none.
+func requestNonce(req *Request) (*pkix.Extension, error) {
+	for _, ext := range req.Extensions {
+		if !ext.Id.Equal(idPKIXOCSPNonce) {
+			continue
+		}
+		var nonce []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &nonce); err != nil || len(rest) != 0 {
+			return nil, ParseError("invalid OCSP nonce")
+		}
+		if len(nonce) < 1 || len(nonce) > maxNonceSize {
+			return nil, ParseError("invalid OCSP nonce length")
+		}
+		return &pkix.Extension{Id: idPKIXOCSPNonce, Value: ext.Value}, nil
+	}
+	return nil, nil
+}
+
+// issuedByIssuer reports whether req refers to a certificate of r.Issuer.
+func (r *Responder) issuedByIssuer(req *Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.Issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return false
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(r.Issuer.RawSubject)
+	if !bytes.Equal(h.Sum(nil), req.IssuerNameHash) {
+		return false
+	}
+	h.Reset()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	return bytes.Equal(h.Sum(nil), req.IssuerKeyHash)
+}
+
+func (r *Responder) cached(key string) (cachedResponse, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.cache[key]
+	if !ok || !time.Now().Before(c.expires) {
+		return cachedResponse{}, false
+	}
+	return c, true
+}
+
+func (r *Responder) store(key string, c *cachedResponse) {
+	d := r.CacheDuration
+	if d == 0 {
+		d = time.Hour
+	}
+	if d < 0 {
+		return
+	}
+	now := time.Now()
+	c.expires = now.Add(d)
+	if !c.nextUpdate.IsZero() && c.nextUpdate.Before(c.expires) {
+		c.expires = c.nextUpdate
+	}
+	if !now.Before(c.expires) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache == nil {
+		r.cache = make(map[string]cachedResponse)
+	}
+	if len(r.cache) >= maxCachedResponses {
+		for k, v := range r.cache {
+			if !now.Before(v.expires) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= maxCachedResponses {
+			r.cache = make(map[string]cachedResponse)
+		}
+	}
+	r.cache[key] = *c
+}
+
+// writeResponse writes an OCSP response. If c is not nil, it sets the HTTP
+// caching headers recommended by RFC 5019, Section 6.2.
+func (r *Responder) writeResponse(w http.ResponseWriter, der []byte, c *cachedResponse) {
+	h := w.Header()
+	h.Set("Content-Type", "application/ocsp-response")
+	h.Set("Content-Length", strconv.Itoa(len(der)))
+	if c != nil {
+		now := time.Now()
+		sum := sha256.Sum256(der)
+		h.Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		h.Set("Last-Modified", c.thisUpdate.UTC().Format(http.TimeFormat))
+		if !c.nextUpdate.IsZero() {
+			maxAge := int(c.nextUpdate.Sub(now) / time.Second)
+			if maxAge < 0 {
+				maxAge = 0
+			}
+			h.Set("Expires", c.nextUpdate.UTC().Format(http.TimeFormat))
+			h.Set("Cache-Control", "max-age="+strconv.Itoa(maxAge)+", public, no-transform, must-revalidate")
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(der)
+}
+
+func (r *Responder) logf(format string, args ...interface{}) {
+	if r.ErrorLog != nil {
+		r.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSource struct {
+	mu       sync.Mutex
+	statuses map[string]*Response
+	calls    int
+}
+
+func (s *testSource) Status(ctx context.Context, serial *big.Int) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if serial.Int64() == 666 {
+		return nil, errors.New("database unavailable")
+	}
+	status, ok := s.statuses[serial.String()]
+	if !ok {
+		return nil, ErrUnknownCertificate
+	}
+	return status, nil
+}
+
+func newTestCA(t *testing.T, name string) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func newTestResponder(t *testing.T) (*Responder, *testSource) {
+	issuer, key := newTestCA(t, "Test CA")
+	revokedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	source := &testSource{statuses: map[string]*Response{
+		"1": {Status: Good, NextUpdate: time.Now().Add(24 * time.Hour).Truncate(time.Second)},
+		"2": {Status: Revoked, RevokedAt: revokedAt, RevocationReason: KeyCompromise},
+	}}
+	return &Responder{Issuer: issuer, Signer: key, Source: source}, source
+}
+
+func newOCSPRequest(t *testing.T, issuer *x509.Certificate, serial int64, nonce []byte) []byte {
+	t.Helper()
+	req, err := CreateRequest(&x509.Certificate{SerialNumber: big.NewInt(serial)}, issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce == nil {
+		return req
+	}
+	parsed, err := ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.Marshal(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed.Extensions = []pkix.Extension{{Id: idPKIXOCSPNonce, Value: value}}
+	req, err = parsed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func postOCSP(t *testing.T, url string, req []byte) *http.Response {
+	t.Helper()
+	res, err := http.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func readOCSP(t *testing.T, res *http.Response, issuer *x509.Certificate) (*Response, error) {
+	t.Helper()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP status %s", res.Status)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	der, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ParseResponse(der, issuer)
+}
+
+func TestResponder(t *testing.T) {
+	r, source := newTestResponder(t)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res := postOCSP(t, ts.URL, newOCSPRequest(t, r.Issuer, 1, nil))
+	resp, err := readOCSP(t, res, r.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != Good || resp.SerialNumber.Int64() != 1 {
+		t.Errorf("got status %d for serial %v, want Good for 1", resp.Status, resp.SerialNumber)
+	}
+	if !resp.NextUpdate.Equal(source.statuses["1"].NextUpdate) {
+		t.Errorf("NextUpdate = %v, want %v", resp.NextUpdate, source.statuses["1"].NextUpdate)
+	}
+	if res.Header.Get("ETag") == "" || res.Header.Get("Expires") == "" {
+		t.Errorf("missing caching headers: %v", res.Header)
+	}
+
+	// The same request over GET is answered from the cache.
+	b64 := base64.StdEncoding.EncodeToString(newOCSPRequest(t, r.Issuer, 1, nil))
+	res, err = http.Get(ts.URL + "/" + url.PathEscape(b64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readOCSP(t, res, r.Issuer); err != nil {
+		t.Fatal(err)
+	}
+	if source.calls != 1 {
+		t.Errorf("Source was called %d times, want 1", source.calls)
+	}
+
+	res = postOCSP(t, ts.URL, newOCSPRequest(t, r.Issuer, 2, nil))
+	resp, err = readOCSP(t, res, r.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != Revoked || resp.RevocationReason != KeyCompromise || !resp.RevokedAt.Equal(source.statuses["2"].RevokedAt) {
+		t.Errorf("got status %d, reason %d, revoked at %v", resp.Status, resp.RevocationReason, resp.RevokedAt)
+	}
+}
+
+func TestResponderNonce(t *testing.T) {
+	r, source := newTestResponder(t)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		nonce := []byte{1, 2, 3, byte(i)}
+		res := postOCSP(t, ts.URL, newOCSPRequest(t, r.Issuer, 1, nonce))
+		if cc := res.Header.Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", cc)
+		}
+		resp, err := readOCSP(t, res, r.Issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := asn1.Marshal(nonce)
+		if len(resp.ResponseExtensions) != 1 || !resp.ResponseExtensions[0].Id.Equal(idPKIXOCSPNonce) || !bytes.Equal(resp.ResponseExtensions[0].Value, want) {
+			t.Errorf("response extensions %v, want nonce %x", resp.ResponseExtensions, want)
+		}
+	}
+	if source.calls != 2 {
+		t.Errorf("Source was called %d times, want 2", source.calls)
+	}
+
+	res := postOCSP(t, ts.URL, newOCSPRequest(t, r.Issuer, 1, make([]byte, 33)))
+	if _, err := readOCSP(t, res, r.Issuer); err != (ResponseError{Malformed}) {
+		t.Errorf("oversized nonce: got %v, want malformed request error", err)
+	}
+}
+
+func TestResponderErrors(t *testing.T) {
+	r, _ := newTestResponder(t)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	otherCA, _ := newTestCA(t, "Other CA")
+
+	tests := []struct {
+		name string
+		req  []byte
+		want ResponseStatus
+	}{
+		{"garbage", []byte("garbage"), Malformed},
+		{"unknown serial", newOCSPRequest(t, r.Issuer, 3, nil), Unauthorized},
+		{"other issuer", newOCSPRequest(t, otherCA, 1, nil), Unauthorized},
+		{"source failure", newOCSPRequest(t, r.Issuer, 666, nil), InternalError},
+	}
+	for _, tt := range tests {
+		res := postOCSP(t, ts.URL, tt.req)
+		if _, err := readOCSP(t, res, r.Issuer); err != (ResponseError{tt.want}) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	res, err := http.Get(ts.URL + "/not-base64!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readOCSP(t, res, r.Issuer); err != (ResponseError{Malformed}) {
+		t.Errorf("bad GET request: got %v, want malformed request error", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL, nil)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("PUT: got HTTP status %s", res.Status)
+	}
+}
+
+func TestResponderDelegated(t *testing.T) {
+	r, _ := newTestResponder(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(100),
+		Subject:      pkix.Name{CommonName: "OCSP Responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, r.Issuer, key.Public(), r.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ResponderCert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	r.Signer = key
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, err := readOCSP(t, postOCSP(t, ts.URL, newOCSPRequest(t, r.Issuer, 1, nil)), r.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Certificate == nil || !resp.Certificate.Equal(r.ResponderCert) {
+		t.Error("response does not include the responder certificate")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrResponseNotYetValid is returned by Verify if the ThisUpdate time of a
+// response is in the future.
+var ErrResponseNotYetValid = errors.New("ocsp: response is not yet valid")
+
+// ErrResponseExpired is returned by Verify if the NextUpdate time of a
+// response is in the past, or the response is older than
+// VerifyOptions.MaxAge.
+var ErrResponseExpired = errors.New("ocsp: response has expired")
+
+// VerifyOptions contains the parameters of Response.Verify.
+type VerifyOptions struct {
+	// Issuer is the certificate of the CA that issued the certificate
+	// whose status the response is about. It must be set.
+	Issuer *x509.Certificate
+
+	// Roots is the set of trusted root certificates. If it is not nil,
+	// Issuer must chain up to one of them, through the certificates of
+	// Intermediates if needed. If it is nil, Issuer is trusted as is.
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+
+	// CurrentTime is the time at which the response and the certificates
+	// are checked. If zero, the current time is used.
+	CurrentTime time.Time
+
+	// ClockSkew is the tolerated difference between the local clock and
+	// the clock of the responder. A response is accepted up to ClockSkew
+	// before its ThisUpdate time and after its NextUpdate time.
+	ClockSkew time.Duration
+
+	// MaxAge, if not zero, is the maximum time elapsed since the ThisUpdate
+	// time of a response, also for responses without a NextUpdate time.
+	MaxAge time.Duration
+}
+
+// Verify checks that resp, as returned by ParseResponseForCert with a nil
+// issuer, is a status from opts.Issuer that is valid at opts.CurrentTime.
+//
+// The response must either be signed by opts.Issuer, or by a delegated
+// responder certificate included in the response that is directly issued by
+// opts.Issuer and has the OCSP signing extended key usage, as specified in
+// RFC 6960, Section 4.2.2.2. Responses without a signing certificate and
+// responses that include opts.Issuer itself are checked against the key of
+// opts.Issuer.
+//
+// Errors about the validity period of the response are ErrResponseNotYetValid
+// and ErrResponseExpired.
+func (resp *Response) Verify(opts VerifyOptions) error {
+	issuer := opts.Issuer
+	if issuer == nil {
+		return errors.New("ocsp: no issuer to verify the response against")
+	}
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if opts.Roots != nil {
+		if _, err := issuer.Verify(x509.VerifyOptions{
+			Roots:         opts.Roots,
+			Intermediates: opts.Intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return fmt.Errorf("ocsp: issuer is not trusted: %w", err)
+		}
+	}
+	if err := resp.checkIssuerHashes(issuer); err != nil {
+		return err
+	}
+
+	signer := issuer
+	if c := resp.Certificate; c != nil && !bytes.Equal(c.Raw, issuer.Raw) {
+		if err := c.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("ocsp: responder certificate is not issued by the issuer: %w", err)
+		}
+		if !hasOCSPSigning(c) {
+			return errors.New("ocsp: responder certificate is not authorized for OCSP signing")
+		}
+		if now.Add(opts.ClockSkew).Before(c.NotBefore) || now.Add(-opts.ClockSkew).After(c.NotAfter) {
+			return errors.New("ocsp: responder certificate is expired or not yet valid")
+		}
+		signer = c
+	}
+	if err := resp.CheckSignatureFrom(signer); err != nil {
+		return fmt.Errorf("ocsp: bad OCSP signature: %w", err)
+	}
+
+	if resp.ThisUpdate.After(now.Add(opts.ClockSkew)) {
+		return ErrResponseNotYetValid
+	}
+	if !resp.NextUpdate.IsZero() && now.Add(-opts.ClockSkew).After(resp.NextUpdate) {
+		return ErrResponseExpired
+	}
+	if opts.MaxAge > 0 && now.Sub(resp.ThisUpdate) > opts.MaxAge+opts.ClockSkew {
+		return ErrResponseExpired
+	}
+	return nil
+}
+
+// checkIssuerHashes checks that the certificate ID of a parsed response
+// names issuer. Responses that weren't parsed have no certificate ID.
+func (resp *Response) checkIssuerHashes(issuer *x509.Certificate) error {
+	if resp.issuerNameHash == nil && resp.issuerKeyHash == nil {
+		return nil
+	}
+	if !resp.IssuerHash.Available() {
+		return fmt.Errorf("ocsp: issuer hash algorithm %v not linked into binary", resp.IssuerHash)
+	}
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return err
+	}
+	h := resp.IssuerHash.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	if !bytes.Equal(nameHash, resp.issuerNameHash) || !bytes.Equal(keyHash, resp.issuerKeyHash) {
+		return errors.New("ocsp: response is not about a certificate of the issuer")
+	}
+	return nil
+}
+
+func hasOCSPSigning(c *x509.Certificate) bool {
+	for _, usage := range c.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
+}
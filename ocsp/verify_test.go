@@ -0,0 +1,139 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func issueTestCert(t *testing.T, tmpl, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestResponseVerify(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	root, rootKey := newTestCA(t, "Test Root")
+	issuer, issuerKey := issueTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, root, rootKey)
+	responderTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "OCSP Responder"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+	responder, responderKey := issueTestCert(t, responderTmpl, issuer, issuerKey)
+	responderTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	unauthorized, unauthorizedKey := issueTestCert(t, responderTmpl, issuer, issuerKey)
+	responderTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+	otherResponder, otherResponderKey := issueTestCert(t, responderTmpl, root, rootKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	template := Response{
+		Status:       Good,
+		SerialNumber: big.NewInt(42),
+		ThisUpdate:   now.Add(-time.Minute),
+		NextUpdate:   now.Add(time.Hour),
+	}
+	// parse returns the response created by the issuer, signed by the
+	// certificate signer or by the issuer if signer is nil.
+	parse := func(issuer, signer *x509.Certificate, key crypto.Signer, template Response) *Response {
+		t.Helper()
+		responderCert := issuer
+		if signer != nil {
+			template.Certificate = signer
+			responderCert = signer
+		}
+		der, err := CreateResponse(issuer, responderCert, template, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ParseResponseForCert(der, &x509.Certificate{SerialNumber: big.NewInt(42)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	expired := template
+	expired.ThisUpdate, expired.NextUpdate = now.Add(-2*time.Hour), now.Add(-time.Minute)
+	future := template
+	future.ThisUpdate = now.Add(time.Minute)
+	noNextUpdate := template
+	noNextUpdate.ThisUpdate, noNextUpdate.NextUpdate = now.Add(-2*time.Hour), time.Time{}
+
+	for _, tt := range []struct {
+		name    string
+		resp    *Response
+		opts    VerifyOptions
+		wantErr string
+	}{
+		{"signed by issuer", parse(issuer, nil, issuerKey, template), VerifyOptions{Issuer: issuer}, ""},
+		{"issuer included", parse(issuer, issuer, issuerKey, template), VerifyOptions{Issuer: issuer}, ""},
+		{"delegated responder", parse(issuer, responder, responderKey, template), VerifyOptions{Issuer: issuer}, ""},
+		{"chain to roots", parse(issuer, responder, responderKey, template), VerifyOptions{Issuer: issuer, Roots: roots}, ""},
+		{"untrusted issuer", parse(issuer, nil, issuerKey, template), VerifyOptions{Issuer: issuer, Roots: x509.NewCertPool()}, "issuer is not trusted"},
+		{"responder without OCSP signing", parse(issuer, unauthorized, unauthorizedKey, template), VerifyOptions{Issuer: issuer}, "not authorized"},
+		{"responder of another CA", parse(issuer, otherResponder, otherResponderKey, template), VerifyOptions{Issuer: issuer}, "not issued by the issuer"},
+		{"signed by another key", parse(issuer, nil, rootKey, template), VerifyOptions{Issuer: issuer}, "bad OCSP signature"},
+		{"wrong issuer", parse(root, nil, rootKey, template), VerifyOptions{Issuer: issuer}, "not about a certificate of the issuer"},
+		{"responder expired", parse(issuer, responder, responderKey, template), VerifyOptions{Issuer: issuer, CurrentTime: now.Add(2 * time.Hour)}, "responder certificate is expired"},
+		{"expired", parse(issuer, nil, issuerKey, expired), VerifyOptions{Issuer: issuer}, ErrResponseExpired.Error()},
+		{"expired within skew", parse(issuer, nil, issuerKey, expired), VerifyOptions{Issuer: issuer, ClockSkew: 5 * time.Minute}, ""},
+		{"not yet valid", parse(issuer, nil, issuerKey, future), VerifyOptions{Issuer: issuer}, ErrResponseNotYetValid.Error()},
+		{"not yet valid within skew", parse(issuer, nil, issuerKey, future), VerifyOptions{Issuer: issuer, ClockSkew: 5 * time.Minute}, ""},
+		{"older than max age", parse(issuer, nil, issuerKey, noNextUpdate), VerifyOptions{Issuer: issuer, MaxAge: time.Hour}, ErrResponseExpired.Error()},
+		{"within max age", parse(issuer, nil, issuerKey, noNextUpdate), VerifyOptions{Issuer: issuer, MaxAge: 3 * time.Hour}, ""},
+		{"no issuer", parse(issuer, nil, issuerKey, template), VerifyOptions{}, "no issuer"},
+	} {
+		err := tt.resp.Verify(tt.opts)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	err := parse(issuer, nil, issuerKey, expired).Verify(VerifyOptions{Issuer: issuer})
+	if !errors.Is(err, ErrResponseExpired) {
+		t.Errorf("got error %v, want ErrResponseExpired", err)
+	}
+}
@@ -3,7 +3,8 @@
 // license that can be found in the LICENSE file.
 
 // Package armor implements OpenPGP ASCII Armor, see RFC 4880. OpenPGP Armor is
-// very similar to PEM except that it has an additional CRC checksum.
+// very similar to PEM except that it has an additional CRC checksum, which
+// RFC 9580 makes optional.
 //
 // Deprecated: this package is unmaintained except for security fixes. New
 // applications should consider a more focused, modern alternative to OpenPGP
@@ -32,7 +33,9 @@ import (
 //	'=' base64 encoded checksum
 //	-----END Type-----
 //
-// where Headers is a possibly empty sequence of Key: Value lines.
+// where Headers is a possibly empty sequence of Key: Value lines. The
+// checksum is optional, as RFC 9580 recommends to omit it: if it is
+// present, reading Body fails with ArmorCorrupt when it doesn't match.
 //
 // Since the armored data can be very large, this package presents a streaming
 // interface.
@@ -96,6 +99,7 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 	if isPrefix {
 		return 0, ArmorCorrupt
 	}
+	line = bytes.TrimRight(line, " \t\r")
 
 	if bytes.HasPrefix(line, armorEnd) {
 		l.eof = true
@@ -108,7 +112,7 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 		var m int
 		m, err = base64.StdEncoding.Decode(expectedBytes[0:], line[1:])
 		if m != 3 || err != nil {
-			return
+			return 0, ArmorCorrupt
 		}
 		l.crc = uint32(expectedBytes[0])<<16 |
 			uint32(expectedBytes[1])<<8 |
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"hash/adler32"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -93,3 +94,104 @@ okWuf3+xA9ksp1npSY/mDvgHijmjvtpRDe6iUeqfCn8N9u9CBg8geANgaG8+QA4=
 -----END PGP SIGNATURE-----`
 
 const longValueExpected = "0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz"
+
+func TestEncodeOptions(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	tests := []struct {
+		opts      *EncodeOptions
+		lineLen   int
+		checksum  bool
+		wantLines []string
+	}{
+		{nil, 64, true, nil},
+		{&EncodeOptions{LineLength: 76}, 76, true, nil},
+		{&EncodeOptions{OmitChecksum: true}, 64, false, nil},
+		{&EncodeOptions{
+			LineLength:   20,
+			OmitChecksum: true,
+			Headers:      []Header{{"Comment", "b"}, {"Comment", "a"}, {"Version", "1"}},
+		}, 20, false, []string{"Comment: b", "Comment: a", "Version: 1"}},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		w, err := EncodeWithOptions(&buf, "PGP MESSAGE", test.opts)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		w.Write(data[:30])
+		w.Write(data[30:])
+		if err := w.Close(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		lines := strings.Split(buf.String(), "\n")
+		if got := lines[1 : 1+len(test.wantLines)]; strings.Join(got, "\n") != strings.Join(test.wantLines, "\n") {
+			t.Errorf("%d: got headers %q, want %q", i, got, test.wantLines)
+		}
+		body := lines[2+len(test.wantLines) : len(lines)-1]
+		if hasChecksum := strings.HasPrefix(body[len(body)-1], "="); hasChecksum != test.checksum {
+			t.Errorf("%d: checksum present: %v, want %v", i, hasChecksum, test.checksum)
+		}
+		for _, l := range body {
+			if len(l) > test.lineLen {
+				t.Errorf("%d: line %q longer than %d", i, l, test.lineLen)
+			}
+		}
+		if len(body[0]) != test.lineLen {
+			t.Errorf("%d: got line length %d, want %d", i, len(body[0]), test.lineLen)
+		}
+
+		b, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		contents, err := io.ReadAll(b.Body)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !bytes.Equal(contents, data) {
+			t.Errorf("%d: got %x, want %x", i, contents, data)
+		}
+	}
+
+	for _, opts := range []*EncodeOptions{
+		{LineLength: 77},
+		{LineLength: -1},
+		{Headers: []Header{{"Comment", "a\nb"}}},
+		{Headers: []Header{{"Bad: key", "a"}}},
+		{Headers: []Header{{"", "a"}}},
+	} {
+		if _, err := EncodeWithOptions(io.Discard, "PGP MESSAGE", opts); err == nil {
+			t.Errorf("EncodeWithOptions succeeded with %+v", opts)
+		}
+	}
+}
+
+func TestDecodeChecksum(t *testing.T) {
+	tests := []struct {
+		armor string
+		ok    bool
+	}{
+		{armorExample1, true},
+		{strings.Replace(armorExample1, "=/teI\n", "", 1), true},
+		{strings.Replace(armorExample1, "=/teI", "=/teJ", 1), false},
+		{strings.Replace(armorExample1, "=/teI", "=/te!", 1), false},
+		{strings.Replace(armorExample1, "\n", " \r\n", -1), true},
+	}
+	for i, test := range tests {
+		b, err := Decode(strings.NewReader(test.armor))
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		contents, err := io.ReadAll(b.Body)
+		if test.ok && (err != nil || adler32.Checksum(contents) != 0x27b144be) {
+			t.Errorf("%d: got error %v and contents %x", i, err, contents)
+		}
+		if !test.ok && err != ArmorCorrupt {
+			t.Errorf("%d: got error %v, want ArmorCorrupt", i, err)
+		}
+	}
+}
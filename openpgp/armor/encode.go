@@ -7,6 +7,10 @@ package armor
 import (
 	"encoding/base64"
 	"io"
+	"sort"
+	"strings"
+
+	"github.com/gitpod-io/golang-crypto/openpgp/errors"
 )
 
 var armorHeaderSep = []byte(": ")
@@ -104,6 +108,7 @@ type encoding struct {
 	b64       io.WriteCloser
 	crc       uint32
 	blockType []byte
+	checksum  bool
 }
 
 func (e *encoding) Write(data []byte) (n int, err error) {
@@ -118,6 +123,10 @@ func (e *encoding) Close() (err error) {
 	}
 	e.breaker.Close()
 
+	if !e.checksum {
+		return writeSlices(e.out, newline, armorEnd, e.blockType, armorEndOfLine)
+	}
+
 	var checksumBytes [3]byte
 	checksumBytes[0] = byte(e.crc >> 16)
 	checksumBytes[1] = byte(e.crc >> 8)
@@ -129,17 +138,70 @@ func (e *encoding) Close() (err error) {
 	return writeSlices(e.out, blockEnd, b64ChecksumBytes[:], newline, armorEnd, e.blockType, armorEndOfLine)
 }
 
+// Header is an armor header line, such as "Comment: text".
+type Header struct {
+	Key, Value string
+}
+
+// EncodeOptions configures EncodeWithOptions.
+type EncodeOptions struct {
+	// LineLength is the number of base64 characters per line. It must be
+	// at most 76, the limit of RFC 9580, Section 6.2. If zero, 64 is used.
+	LineLength int
+
+	// OmitChecksum omits the CRC24 checksum line, which RFC 9580, Section
+	// 6.1 recommends for new data, and forbids for messages protected with
+	// version 2 SEIPD packets. Decode accepts blocks without a checksum.
+	OmitChecksum bool
+
+	// Headers are written in order, so a key may be repeated, as for
+	// several "Comment" lines.
+	Headers []Header
+}
+
 // Encode returns a WriteCloser which will encode the data written to it in
-// OpenPGP armor.
+// OpenPGP armor. The headers are written sorted by key, and the block ends
+// with a CRC24 checksum.
 func Encode(out io.Writer, blockType string, headers map[string]string) (w io.WriteCloser, err error) {
+	opts := &EncodeOptions{}
+	for k, v := range headers {
+		opts.Headers = append(opts.Headers, Header{k, v})
+	}
+	sort.Slice(opts.Headers, func(i, j int) bool {
+		return opts.Headers[i].Key < opts.Headers[j].Key
+	})
+	return EncodeWithOptions(out, blockType, opts)
+}
+
+// EncodeWithOptions is like Encode, with the line length, checksum and
+// headers given by opts. A nil opts is like one with its zero value. As
+// with Encode, the data is encoded as it is written, and the armor is
+// completed by Close.
+func EncodeWithOptions(out io.Writer, blockType string, opts *EncodeOptions) (w io.WriteCloser, err error) {
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	lineLength := opts.LineLength
+	if lineLength == 0 {
+		lineLength = 64
+	}
+	if lineLength < 0 || lineLength > 76 {
+		return nil, errors.InvalidArgumentError("armor: invalid line length")
+	}
+	for _, h := range opts.Headers {
+		if h.Key == "" || strings.ContainsAny(h.Key, ":\r\n") || strings.ContainsAny(h.Value, "\r\n") {
+			return nil, errors.InvalidArgumentError("armor: invalid header")
+		}
+	}
+
 	bType := []byte(blockType)
 	err = writeSlices(out, armorStart, bType, armorEndOfLineOut)
 	if err != nil {
 		return
 	}
 
-	for k, v := range headers {
-		err = writeSlices(out, []byte(k), armorHeaderSep, []byte(v), newline)
+	for _, h := range opts.Headers {
+		err = writeSlices(out, []byte(h.Key), armorHeaderSep, []byte(h.Value), newline)
 		if err != nil {
 			return
 		}
@@ -152,9 +214,10 @@ func Encode(out io.Writer, blockType string, headers map[string]string) (w io.Wr
 
 	e := &encoding{
 		out:       out,
-		breaker:   newLineBreaker(out, 64),
+		breaker:   newLineBreaker(out, lineLength),
 		crc:       crc24Init,
 		blockType: bType,
+		checksum:  !opts.OmitChecksum,
 	}
 	e.b64 = base64.NewEncoder(base64.StdEncoding, e.breaker)
 	return e, nil
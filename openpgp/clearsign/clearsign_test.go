@@ -8,9 +8,12 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/gitpod-io/golang-crypto/openpgp"
+	"github.com/gitpod-io/golang-crypto/openpgp/errors"
 	"github.com/gitpod-io/golang-crypto/openpgp/packet"
 )
 
@@ -249,6 +252,93 @@ func TestParseInvalid(t *testing.T) {
 	}
 }
 
+func readAll(t *testing.T, input []byte, keyring openpgp.KeyRing) ([]byte, *Reader, error) {
+	t.Helper()
+	r, err := NewReader(iotest.HalfReader(bytes.NewReader(input)), keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := io.ReadAll(r)
+	return plaintext, r, err
+}
+
+func TestReader(t *testing.T) {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(signingKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, input := range [][]byte{clearsignInput, clearsignInput2} {
+		b, _ := Decode(input)
+		plaintext, r, err := readAll(t, input, keyring)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+		if !bytes.Equal(plaintext, b.Plaintext) {
+			t.Errorf("#%d: got plaintext %q, want %q", i, plaintext, b.Plaintext)
+		}
+		if r.Signer != keyring[0] {
+			t.Errorf("#%d: signer not set", i)
+		}
+		if got, want := r.Headers.Get("Hash"), b.Headers.Get("Hash"); got != want {
+			t.Errorf("#%d: got Hash header %q, want %q", i, got, want)
+		}
+	}
+
+	// Lines longer than the buffer, with whitespace around its boundaries.
+	long := strings.Repeat("x", 4090)
+	in := []string{
+		"",
+		"a",
+		"-a\n",
+		"- a\n",
+		"a\n  \n  \nb\n",
+		long + "\n",
+		long + "       \t\t  \n" + long + "\n",
+		long + "     \tb \n",
+		long + long + long + "\r\n-\n",
+		long + "     \r\r\n",
+		strings.Repeat(long+"    \n", 10),
+	}
+	for i, text := range in {
+		var buf bytes.Buffer
+		w, err := Encode(&buf, keyring[0].PrivateKey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, text)
+		w.Close()
+
+		b, _ := Decode(buf.Bytes())
+		if b == nil {
+			t.Fatalf("#%d: failed to decode clearsign message", i)
+		}
+		plaintext, _, err := readAll(t, buf.Bytes(), keyring)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+		if !bytes.Equal(plaintext, b.Plaintext) {
+			t.Errorf("#%d: plaintext differs from Decode", i)
+		}
+
+		tampered := bytes.Replace(buf.Bytes(), []byte("\n\n"), []byte("\n\nc"), 1)
+		if _, _, err := readAll(t, tampered, keyring); err == nil {
+			t.Errorf("#%d: tampered message verified", i)
+		}
+	}
+
+	if _, _, err := readAll(t, clearsignInput, openpgp.EntityList{}); err != errors.ErrUnknownIssuer {
+		t.Errorf("got error %v without the signing key, want %v", err, errors.ErrUnknownIssuer)
+	}
+	truncated := clearsignInput[:bytes.Index(clearsignInput, endText)]
+	if _, _, err := readAll(t, truncated, keyring); err != io.ErrUnexpectedEOF {
+		t.Errorf("got error %v for a truncated message, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := NewReader(strings.NewReader(invalidInputs[1]), keyring); err == nil {
+		t.Error("NewReader accepted an invalid message")
+	}
+}
+
 var clearsignInput = []byte(`
 ;lasjlkfdsa
 
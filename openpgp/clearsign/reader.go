@@ -0,0 +1,297 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clearsign
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"hash"
+	"io"
+	"net/textproto"
+	"strings"
+
+	"github.com/gitpod-io/golang-crypto/openpgp"
+	"github.com/gitpod-io/golang-crypto/openpgp/armor"
+	"github.com/gitpod-io/golang-crypto/openpgp/errors"
+	"github.com/gitpod-io/golang-crypto/openpgp/packet"
+)
+
+// defaultHashes are the hashes computed by a Reader for messages without a
+// Hash header.
+var defaultHashes = []crypto.Hash{crypto.SHA256, crypto.SHA512}
+
+// A Reader reads the plaintext of a clearsigned message, and verifies its
+// signature once all of it has been read. Unlike Decode, it doesn't need the
+// whole message in memory.
+//
+// The plaintext returned by Read is unverified until Read returns io.EOF,
+// which it only does if the signature is valid. Otherwise, the last call to
+// Read returns the verification error: callers must not act on the
+// plaintext before seeing io.EOF.
+type Reader struct {
+	// Headers holds the unverified Hash headers of the message.
+	Headers textproto.MIMEHeader
+
+	// Signer is the entity that made the signature. It is set once Read
+	// returns io.EOF.
+	Signer *openpgp.Entity
+
+	keyring openpgp.KeyRing
+	r       *bufio.Reader
+	hashes  map[crypto.Hash]hash.Hash
+	toHash  io.Writer
+
+	buf         []byte // plaintext not yet returned by Read
+	pending     []byte // trailing whitespace of the current line
+	atLineStart bool
+	isFirstLine bool
+	err         error // returned once buf is drained
+}
+
+// NewReader returns a Reader for the first clearsigned message in r, whose
+// signature is checked against the keys of keyring. It discards any data
+// before the message, and reads its headers. The only allowed header type is
+// Hash, which must name the hash of the signature, if present.
+//
+// Signatures with a salt, such as the version 6 signatures of RFC 9580, can't
+// be verified while the message is read, and are rejected: use Decode for
+// them.
+func NewReader(r io.Reader, keyring openpgp.KeyRing) (*Reader, error) {
+	cr := &Reader{
+		Headers:     make(textproto.MIMEHeader),
+		keyring:     keyring,
+		r:           bufio.NewReader(r),
+		hashes:      make(map[crypto.Hash]hash.Hash),
+		atLineStart: true,
+		isFirstLine: true,
+	}
+
+	// Skip to the start line.
+	for {
+		line, err := cr.readLine()
+		if err == io.EOF {
+			return nil, errors.StructuralError("no clearsigned message found")
+		} else if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if bytes.Equal(line, start[1:]) {
+			break
+		}
+	}
+
+	// Next come a series of header lines, ended by an empty line.
+	for {
+		line, err := cr.readLine()
+		if err == io.EOF {
+			return nil, errors.StructuralError("truncated clearsigned message headers")
+		} else if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		if bytes.IndexFunc(line, func(r rune) bool {
+			return r < 0x20 || r > 0x7e
+		}) != -1 {
+			return nil, errors.StructuralError("invalid character in clearsigned message header")
+		}
+		key, val, ok := strings.Cut(string(line), ":")
+		if !ok || strings.TrimSpace(key) != "Hash" {
+			return nil, errors.StructuralError("invalid clearsigned message header")
+		}
+		val = strings.TrimSpace(val)
+		cr.Headers.Add("Hash", val)
+		for _, name := range strings.Split(val, ",") {
+			if h := hashOfName(strings.TrimSpace(name)); h.Available() {
+				cr.hashes[h] = h.New()
+			}
+		}
+	}
+	if len(cr.Headers) == 0 {
+		for _, h := range defaultHashes {
+			cr.hashes[h] = h.New()
+		}
+	}
+	var ws []io.Writer
+	for _, h := range cr.hashes {
+		ws = append(ws, h)
+	}
+	cr.toHash = io.MultiWriter(ws...)
+
+	return cr, nil
+}
+
+// readLine reads a line without its line ending. If the line doesn't fit in
+// the buffer, the rest of it is discarded and bufio.ErrBufferFull is
+// returned.
+func (cr *Reader) readLine() ([]byte, error) {
+	line, err := cr.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		for err == bufio.ErrBufferFull {
+			_, err = cr.r.ReadSlice('\n')
+		}
+		if err == nil {
+			err = bufio.ErrBufferFull
+		}
+		return nil, err
+	}
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	return line, nil
+}
+
+// Read reads the plaintext of the message, with the same line endings and
+// without the trailing whitespace, like the Plaintext of a Block.
+func (cr *Reader) Read(p []byte) (n int, err error) {
+	for len(cr.buf) == 0 && cr.err == nil {
+		cr.err = cr.readText()
+	}
+	if len(cr.buf) > 0 {
+		n = copy(p, cr.buf)
+		cr.buf = cr.buf[n:]
+		return n, nil
+	}
+	return 0, cr.err
+}
+
+// readText processes the next chunk of the message body. The whole line
+// doesn't need to fit in the buffer: the data that's hashed and returned is
+// the same as with getLine, except that trailing whitespace is held back in
+// pending until it's known whether it ends the line.
+func (cr *Reader) readText() error {
+	frag, err := cr.r.ReadSlice('\n')
+	switch err {
+	case nil, bufio.ErrBufferFull:
+	case io.EOF:
+		// No armored data was found, so this isn't a complete message.
+		return io.ErrUnexpectedEOF
+	default:
+		return err
+	}
+	cr.buf = cr.buf[:0]
+
+	if cr.atLineStart {
+		if err == nil {
+			line := bytes.TrimSuffix(frag[:len(frag)-1], []byte{'\r'})
+			if bytes.Equal(line, endText) {
+				return cr.verify()
+			}
+		}
+		// The final CRLF isn't included in the hash so we don't write it
+		// until we've seen the next line.
+		if cr.isFirstLine {
+			cr.isFirstLine = false
+		} else {
+			cr.toHash.Write(crlf)
+		}
+		frag = bytes.TrimPrefix(frag, dashEscape)
+		cr.atLineStart = false
+	}
+
+	if err == bufio.ErrBufferFull {
+		data := append(cr.pending, frag...)
+		text := bytes.TrimRight(data, " \t\r")
+		cr.write(text)
+		cr.pending = append([]byte(nil), data[len(text):]...)
+		return nil
+	}
+
+	data := append(cr.pending, frag[:len(frag)-1]...)
+	data = bytes.TrimSuffix(data, []byte{'\r'})
+	cr.write(bytes.TrimRight(data, " \t"))
+	cr.buf = append(cr.buf, lf)
+	cr.pending = nil
+	cr.atLineStart = true
+	return nil
+}
+
+func (cr *Reader) write(text []byte) {
+	cr.toHash.Write(text)
+	cr.buf = append(cr.buf, text...)
+}
+
+// verify reads the armored signature that follows the message, and checks
+// that it was made by a key of cr.keyring. It returns io.EOF on success.
+func (cr *Reader) verify() error {
+	// Armor expects to see the header line.
+	armored := io.MultiReader(bytes.NewReader(append(append([]byte(nil), endText...), lf)), cr.r)
+	block, err := armor.Decode(armored)
+	if err != nil {
+		return err
+	}
+	if block.Type != "PGP SIGNATURE" {
+		return errors.StructuralError("bad armor type " + block.Type)
+	}
+
+	var p packet.Packet
+	var issuerKeyId uint64
+	var hashFunc crypto.Hash
+	var keys []openpgp.Key
+	packets := packet.NewReader(block.Body)
+	for {
+		p, err = packets.Next()
+		if err == io.EOF {
+			return errors.ErrUnknownIssuer
+		}
+		if err != nil {
+			return err
+		}
+
+		switch sig := p.(type) {
+		case *packet.Signature:
+			if sig.IssuerKeyId == nil {
+				return errors.StructuralError("signature doesn't have an issuer")
+			}
+			if len(sig.Salt) > 0 {
+				return errors.UnsupportedError("salted signatures of clearsigned messages can't be streamed")
+			}
+			issuerKeyId = *sig.IssuerKeyId
+			hashFunc = sig.Hash
+		case *packet.SignatureV3:
+			issuerKeyId = sig.IssuerKeyId
+			hashFunc = sig.Hash
+		default:
+			return errors.StructuralError("non signature packet found")
+		}
+
+		keys = cr.keyring.KeysByIdUsage(issuerKeyId, packet.KeyFlagSign)
+		if len(keys) > 0 {
+			break
+		}
+	}
+
+	h := cr.hashes[hashFunc]
+	if h == nil {
+		return errors.StructuralError("signature hash " + nameOfHash(hashFunc) + " not announced by the Hash header")
+	}
+	for _, key := range keys {
+		switch sig := p.(type) {
+		case *packet.Signature:
+			err = key.PublicKey.VerifySignature(h, sig)
+		case *packet.SignatureV3:
+			err = key.PublicKey.VerifySignatureV3(h, sig)
+		}
+		if err == nil {
+			cr.Signer = key.Entity
+			return io.EOF
+		}
+	}
+	return err
+}
+
+// hashOfName returns the hash with the given OpenPGP name, or zero if the
+// name isn't known.
+func hashOfName(name string) crypto.Hash {
+	for _, h := range []crypto.Hash{crypto.MD5, crypto.SHA1, crypto.RIPEMD160, crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		if nameOfHash(h) == name {
+			return h
+		}
+	}
+	return 0
+}
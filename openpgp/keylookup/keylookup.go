@@ -0,0 +1,224 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package keylookup fetches OpenPGP public keys from the Web Key Directory
+// (WKD) of the domain of an email address, as specified by
+// draft-koch-openpgp-webkey-service, and from keyservers speaking the HTTP
+// Keyserver Protocol (HKP), as specified by draft-shaw-openpgp-hkp.
+//
+// Keys fetched by email address are only returned if they have a valid
+// self-signed user ID with that address, since neither a web server nor a
+// keyserver is trusted to vouch for the binding.
+//
+// Deprecated: this package is unmaintained except for security fixes. New
+// applications should consider a more focused, modern alternative to OpenPGP
+// for their specific task. If you are required to interoperate with OpenPGP
+// systems and need a maintained package, consider a community fork.
+// See https://golang.org/issue/44226.
+package keylookup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/openpgp"
+)
+
+// ErrKeyNotFound is returned when the server has no key for the query, or
+// none of the keys it returned matches it.
+var ErrKeyNotFound = errors.New("keylookup: key not found")
+
+// maxKeySize is the maximum size of the response bodies that are read.
+const maxKeySize = 1 << 20
+
+// A Client fetches keys over HTTP.
+type Client struct {
+	// HTTPClient is used for the requests. If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+
+	// Keyserver is the URL of the HKP keyserver, such as
+	// "hkps://keys.openpgp.org". The hkp scheme is an alias for http on
+	// port 11371, and hkps for https. Keyserver is only used by the HKP
+	// lookups.
+	Keyserver string
+
+	// Now returns the current time, which is used to ignore expired keys.
+	// If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// zbase32 is the z-base-32 encoding used for the hashed local parts of
+// WKD URLs.
+var zbase32 = base32.NewEncoding("ybndrfg8ejkmcpqxot1uwisza345h769").WithPadding(base32.NoPadding)
+
+// WKDURLs returns the URLs of the keys of email in the Web Key Directory of
+// its domain: the one of the advanced method, followed by the one of the
+// direct method.
+func WKDURLs(email string) (advanced, direct string, err error) {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", "", fmt.Errorf("keylookup: invalid email address %q", email)
+	}
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	h := sha1.Sum([]byte(strings.ToLower(local)))
+	hu := zbase32.EncodeToString(h[:]) + "?l=" + url.QueryEscape(local)
+	advanced = "https://openpgpkey." + domain + "/.well-known/openpgpkey/" + domain + "/hu/" + hu
+	direct = "https://" + domain + "/.well-known/openpgpkey/hu/" + hu
+	return advanced, direct, nil
+}
+
+// LookupWKD fetches the keys of email from the Web Key Directory of its
+// domain. The advanced method is tried first, and the direct method if it
+// fails.
+func (c *Client) LookupWKD(ctx context.Context, email string) (openpgp.EntityList, error) {
+	advanced, direct, err := WKDURLs(email)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.get(ctx, advanced)
+	if err != nil {
+		body, err = c.get(ctx, direct)
+	}
+	if err != nil {
+		return nil, err
+	}
+	el, err := openpgp.ReadKeyRing(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("keylookup: invalid key from %s: %w", email, err)
+	}
+	return c.filterEmail(el, email)
+}
+
+// LookupHKP searches the keyserver for the keys of email.
+func (c *Client) LookupHKP(ctx context.Context, email string) (openpgp.EntityList, error) {
+	el, err := c.hkpGet(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return c.filterEmail(el, email)
+}
+
+// LookupHKPFingerprint fetches the key with the given fingerprint, of 20
+// bytes for v4 keys or 32 bytes for v6 keys, from the keyserver.
+func (c *Client) LookupHKPFingerprint(ctx context.Context, fingerprint []byte) (*openpgp.Entity, error) {
+	el, err := c.hkpGet(ctx, "0x"+strings.ToUpper(hex.EncodeToString(fingerprint)))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range el {
+		if bytes.Equal(e.PrimaryKey.FingerprintBytes(), fingerprint) {
+			return e, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (c *Client) hkpGet(ctx context.Context, search string) (openpgp.EntityList, error) {
+	if c.Keyserver == "" {
+		return nil, errors.New("keylookup: no keyserver")
+	}
+	u, err := url.Parse(c.Keyserver)
+	if err != nil {
+		return nil, fmt.Errorf("keylookup: invalid keyserver URL: %w", err)
+	}
+	switch u.Scheme {
+	case "hkp":
+		u.Scheme = "http"
+		if u.Port() == "" {
+			u.Host += ":11371"
+		}
+	case "hkps":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("keylookup: unsupported keyserver URL scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/pks/lookup"
+	u.RawQuery = url.Values{
+		"op":      {"get"},
+		"options": {"mr"},
+		"search":  {search},
+	}.Encode()
+	body, err := c.get(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("keylookup: invalid key from keyserver: %w", err)
+	}
+	return el, nil
+}
+
+func (c *Client) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrKeyNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("keylookup: GET %s: %s", u, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxKeySize {
+		return nil, fmt.Errorf("keylookup: GET %s: response too large", u)
+	}
+	return body, nil
+}
+
+// filterEmail returns the entities of el that are neither revoked nor
+// expired and have a self-signed user ID with the address email, compared
+// case-insensitively. Their other identities are removed.
+func (c *Client) filterEmail(el openpgp.EntityList, email string) (openpgp.EntityList, error) {
+	now := time.Now()
+	if c.Now != nil {
+		now = c.Now()
+	}
+	var matches openpgp.EntityList
+	for _, e := range el {
+		if len(e.Revocations) > 0 {
+			continue
+		}
+		identities := make(map[string]*openpgp.Identity)
+		for name, id := range e.Identities {
+			if strings.EqualFold(id.UserId.Email, email) && !id.SelfSignature.KeyExpired(now) {
+				identities[name] = id
+			}
+		}
+		if len(identities) == 0 {
+			continue
+		}
+		e.Identities = identities
+		matches = append(matches, e)
+	}
+	if len(matches) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return matches, nil
+}
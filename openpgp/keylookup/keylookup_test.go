@@ -0,0 +1,176 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package keylookup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/openpgp"
+	"github.com/gitpod-io/golang-crypto/openpgp/armor"
+)
+
+func TestWKDURLs(t *testing.T) {
+	// Example from draft-koch-openpgp-webkey-service, Section 3.1.
+	advanced, direct, err := WKDURLs("Joe.Doe@Example.ORG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const hu = "iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe"
+	if want := "https://openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/" + hu; advanced != want {
+		t.Errorf("got advanced URL %q, want %q", advanced, want)
+	}
+	if want := "https://example.org/.well-known/openpgpkey/hu/" + hu; direct != want {
+		t.Errorf("got direct URL %q, want %q", direct, want)
+	}
+	for _, email := range []string{"", "joe", "@example.org", "joe@"} {
+		if _, _, err := WKDURLs(email); err == nil {
+			t.Errorf("WKDURLs(%q) succeeded", email)
+		}
+	}
+}
+
+// rewriteTransport sends all the requests to the test server at target.
+type rewriteTransport struct {
+	target *url.URL
+	urls   []string
+}
+
+func (rt *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.urls = append(rt.urls, req.URL.String())
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestClient(t *testing.T, handler http.Handler) (*Client, *rewriteTransport) {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	target, _ := url.Parse(ts.URL)
+	rt := &rewriteTransport{target: target}
+	return &Client{HTTPClient: &http.Client{Transport: rt}, Keyserver: "hkps://keys.example.com"}, rt
+}
+
+func serializeKeys(t *testing.T, armored bool, entities ...*openpgp.Entity) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if armored {
+		a, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = a
+	}
+	for _, e := range entities {
+		if err := e.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, ok := w.(io.Closer); ok {
+		a.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestLookupWKD(t *testing.T) {
+	joe, err := openpgp.NewEntity("Joe Doe", "", "joe.doe@example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := openpgp.NewEntity("Mallory", "", "mallory@example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := serializeKeys(t, false, mallory, joe)
+	c, rt := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the direct method is set up.
+		if r.URL.Path != "/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(keys)
+	}))
+
+	el, err := c.LookupWKD(context.Background(), "Joe.Doe@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 || el[0].PrimaryKey.KeyId != joe.PrimaryKey.KeyId {
+		t.Errorf("got %d keys, want the key of joe.doe only", len(el))
+	}
+	if len(rt.urls) != 2 {
+		t.Errorf("got requests %q, want the advanced method then the direct one", rt.urls)
+	}
+
+	if _, err := c.LookupWKD(context.Background(), "jane@example.org"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got error %v for an unknown address, want ErrKeyNotFound", err)
+	}
+}
+
+func TestLookupHKP(t *testing.T) {
+	joe, err := openpgp.NewEntity("Joe Doe", "", "joe.doe@example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := serializeKeys(t, true, joe)
+	var searches []string
+	c, rt := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/pks/lookup" || q.Get("op") != "get" || q.Get("options") != "mr" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		searches = append(searches, q.Get("search"))
+		w.Write(keys)
+	}))
+
+	el, err := c.LookupHKP(context.Background(), "joe.doe@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 || el[0].PrimaryKey.KeyId != joe.PrimaryKey.KeyId {
+		t.Errorf("got %d keys, want the key of joe.doe", len(el))
+	}
+	if u, _ := url.Parse(rt.urls[0]); u.Scheme != "https" || u.Host != "keys.example.com" {
+		t.Errorf("got request to %q, want https://keys.example.com", rt.urls[0])
+	}
+	// The keyserver returns a key that doesn't have the requested user ID.
+	if _, err := c.LookupHKP(context.Background(), "jane@example.org"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got error %v for a mismatched user ID, want ErrKeyNotFound", err)
+	}
+
+	fingerprint := joe.PrimaryKey.FingerprintBytes()
+	e, err := c.LookupHKPFingerprint(context.Background(), fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PrimaryKey.KeyId != joe.PrimaryKey.KeyId {
+		t.Error("got the wrong key by fingerprint")
+	}
+	other := append([]byte(nil), fingerprint...)
+	other[0] ^= 1
+	if _, err := c.LookupHKPFingerprint(context.Background(), other); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got error %v for a mismatched fingerprint, want ErrKeyNotFound", err)
+	}
+	if len(searches) != 4 || searches[2][:2] != "0x" {
+		t.Errorf("got searches %q", searches)
+	}
+
+	c.Keyserver = "hkp://keys.example.com"
+	rt.urls = nil
+	if _, err := c.LookupHKP(context.Background(), "joe.doe@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := url.Parse(rt.urls[0]); u.Scheme != "http" || u.Host != "keys.example.com:11371" {
+		t.Errorf("got request to %q, want http://keys.example.com:11371", rt.urls[0])
+	}
+}
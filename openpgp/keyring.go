@@ -0,0 +1,202 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openpgp
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/gitpod-io/golang-crypto/openpgp/packet"
+)
+
+// A Keyring is a set of entities indexed by the fingerprints of their
+// primary keys. Unlike an EntityList, it holds a single Entity per primary
+// key: inserting another copy of a key, for instance an update fetched from
+// a keyserver, merges its new signatures, identities and subkeys into the
+// Entity already in the Keyring. A Keyring implements KeyRing. The zero
+// value is an empty Keyring. Its methods must not be called concurrently
+// if one of them modifies the Keyring.
+type Keyring struct {
+	entities EntityList
+	index    map[string]*Entity // indexed by fingerprint
+}
+
+// NewKeyring returns a Keyring holding the entities of el, merged as by
+// Insert.
+func NewKeyring(el EntityList) *Keyring {
+	kr := &Keyring{index: make(map[string]*Entity)}
+	for _, e := range el {
+		kr.Insert(e)
+	}
+	return kr
+}
+
+// Insert adds e to kr and returns the Entity held by kr for its primary
+// key. If kr already has an Entity with the same primary key, e is merged
+// into it, which then holds:
+//   - the signatures of both, without duplicates;
+//   - the newest self-signature of each identity found in either;
+//   - the newest binding signature of each subkey found in either;
+//   - the private keys of e, if it has some and the Entity has none.
+//
+// Otherwise e itself is added, after the entities already in kr. Entities
+// are expected to come from ReadEntity, ReadKeyRing or NewEntity, which
+// verify their self-signatures.
+func (kr *Keyring) Insert(e *Entity) *Entity {
+	if kr.index == nil {
+		kr.index = make(map[string]*Entity)
+	}
+	fp := string(e.PrimaryKey.FingerprintBytes())
+	existing, ok := kr.index[fp]
+	if !ok {
+		kr.index[fp] = e
+		kr.entities = append(kr.entities, e)
+		return e
+	}
+	if existing != e {
+		existing.merge(e)
+	}
+	return existing
+}
+
+// Import reads one or more keys from r, as ReadKeyRing does, and inserts
+// them into kr. It returns the entities of kr that they were merged into.
+func (kr *Keyring) Import(r io.Reader) ([]*Entity, error) {
+	el, err := ReadKeyRing(r)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]*Entity, 0, len(el))
+	for _, e := range el {
+		entities = append(entities, kr.Insert(e))
+	}
+	return entities, nil
+}
+
+// Entity returns the Entity whose primary key has the given fingerprint,
+// or nil if there is none in kr.
+func (kr *Keyring) Entity(fingerprint []byte) *Entity {
+	return kr.index[string(fingerprint)]
+}
+
+// Delete removes the Entity whose primary key has the given fingerprint
+// from kr, and reports whether there was one.
+func (kr *Keyring) Delete(fingerprint []byte) bool {
+	e, ok := kr.index[string(fingerprint)]
+	if !ok {
+		return false
+	}
+	delete(kr.index, string(fingerprint))
+	for i, other := range kr.entities {
+		if other == e {
+			kr.entities = append(kr.entities[:i:i], kr.entities[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Entities returns the entities of kr, in the order they were first
+// inserted.
+func (kr *Keyring) Entities() EntityList {
+	return append(EntityList(nil), kr.entities...)
+}
+
+// KeysById returns the set of keys that have the given key id.
+func (kr *Keyring) KeysById(id uint64) []Key {
+	return kr.entities.KeysById(id)
+}
+
+// KeysByIdUsage returns the set of keys with the given id that also meet
+// the key usage given by requiredUsage. See EntityList.KeysByIdUsage.
+func (kr *Keyring) KeysByIdUsage(id uint64, requiredUsage byte) []Key {
+	return kr.entities.KeysByIdUsage(id, requiredUsage)
+}
+
+// DecryptionKeys returns all private keys that are valid for decryption.
+func (kr *Keyring) DecryptionKeys() []Key {
+	return kr.entities.DecryptionKeys()
+}
+
+// Serialize writes the public part of the entities of kr to w, as in a
+// pubring file, which ReadKeyRing and Import can read back. No private key
+// material will be output.
+func (kr *Keyring) Serialize(w io.Writer) error {
+	for _, e := range kr.entities {
+		if err := e.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge adds the signatures, identities and subkeys of other, which has the
+// same primary key as e, to e.
+func (e *Entity) merge(other *Entity) {
+	if e.PrivateKey == nil && other.PrivateKey != nil {
+		e.PrivateKey = other.PrivateKey
+		e.PrimaryKey = &other.PrivateKey.PublicKey
+	}
+	e.Revocations = mergeSignatures(e.Revocations, other.Revocations)
+	if other.DirectSignature != nil && (e.DirectSignature == nil || other.DirectSignature.CreationTime.After(e.DirectSignature.CreationTime)) {
+		e.DirectSignature = other.DirectSignature
+	}
+
+	for name, ident := range other.Identities {
+		existing, ok := e.Identities[name]
+		if !ok {
+			e.Identities[name] = ident
+			continue
+		}
+		if ident.SelfSignature.CreationTime.After(existing.SelfSignature.CreationTime) {
+			existing.SelfSignature = ident.SelfSignature
+		}
+		existing.Signatures = mergeSignatures(existing.Signatures, ident.Signatures)
+	}
+
+Subkeys:
+	for _, subkey := range other.Subkeys {
+		fp := subkey.PublicKey.FingerprintBytes()
+		for i := range e.Subkeys {
+			existing := &e.Subkeys[i]
+			if !bytes.Equal(existing.PublicKey.FingerprintBytes(), fp) {
+				continue
+			}
+			if existing.PrivateKey == nil && subkey.PrivateKey != nil {
+				existing.PrivateKey = subkey.PrivateKey
+				existing.PublicKey = &subkey.PrivateKey.PublicKey
+			}
+			if shouldReplaceSubkeySig(existing.Sig, subkey.Sig) {
+				existing.Sig = subkey.Sig
+			}
+			existing.Revocations = mergeSignatures(existing.Revocations, subkey.Revocations)
+			continue Subkeys
+		}
+		e.Subkeys = append(e.Subkeys, subkey)
+	}
+}
+
+// mergeSignatures returns sigs with the signatures of others that it
+// doesn't already hold.
+func mergeSignatures(sigs, others []*packet.Signature) []*packet.Signature {
+	seen := make(map[string]bool)
+	for _, sig := range sigs {
+		seen[signatureBytes(sig)] = true
+	}
+	for _, sig := range others {
+		if b := signatureBytes(sig); !seen[b] {
+			seen[b] = true
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// signatureBytes returns the serialization of sig, which identifies it.
+func signatureBytes(sig *packet.Signature) string {
+	var buf bytes.Buffer
+	sig.Serialize(&buf)
+	return buf.String()
+}
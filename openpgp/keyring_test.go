@@ -0,0 +1,135 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/openpgp/packet"
+)
+
+// publicCopy returns the public part of e, as read back from its
+// serialization.
+func publicCopy(t *testing.T, e *Entity) *Entity {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := e.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	el, err := ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return el[0]
+}
+
+func TestKeyring(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEd25519}
+	e, err := NewEntity("Golang Gopher", "", "gopher@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewEntity("Signer", "", "signer@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := publicCopy(t, e)
+
+	// Update the key with a new identity, a certification and a subkey.
+	if err := e.AddUserId("Golang Gopher", "work", "gopher@example.com", config); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SignIdentity("Golang Gopher <gopher@golang.com>", signer, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	var update bytes.Buffer
+	if err := e.Serialize(&update); err != nil {
+		t.Fatal(err)
+	}
+
+	kr := NewKeyring(EntityList{original, publicCopy(t, signer)})
+	if got := kr.Insert(publicCopy(t, original)); got != original {
+		t.Error("Insert of a known key didn't return the Entity of the keyring")
+	}
+	for i := 0; i < 2; i++ {
+		imported, err := kr.Import(bytes.NewReader(update.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(imported) != 1 || imported[0] != original {
+			t.Fatalf("Import returned %d entities, want the original one", len(imported))
+		}
+	}
+	if n := len(kr.Entities()); n != 2 {
+		t.Fatalf("got %d entities, want 2", n)
+	}
+
+	merged := kr.Entity(e.PrimaryKey.FingerprintBytes())
+	if merged != original {
+		t.Fatal("Entity didn't return the merged entity")
+	}
+	if len(merged.Identities) != 2 {
+		t.Errorf("got %d identities, want 2", len(merged.Identities))
+	}
+	if sigs := merged.Identities["Golang Gopher <gopher@golang.com>"].Signatures; len(sigs) != 1 {
+		t.Errorf("got %d certifications, want 1", len(sigs))
+	}
+	if len(merged.Subkeys) != 2 {
+		t.Errorf("got %d subkeys, want 2", len(merged.Subkeys))
+	}
+	if merged.PrivateKey != nil {
+		t.Error("merged entity has a private key")
+	}
+	if keys := kr.KeysByIdUsage(e.Subkeys[1].PublicKey.KeyId, packet.KeyFlagSign); len(keys) != 1 {
+		t.Errorf("got %d keys for the new signing subkey, want 1", len(keys))
+	}
+
+	// Private keys are merged into public entities.
+	kr.Insert(e)
+	if merged.PrivateKey != e.PrivateKey || merged.Subkeys[0].PrivateKey == nil || len(kr.DecryptionKeys()) != 1 {
+		t.Error("private keys were not merged")
+	}
+
+	var buf bytes.Buffer
+	if err := kr.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	el, err := ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 2 || len(el[0].Identities) != 2 || len(el[0].Subkeys) != 2 || el[0].PrivateKey != nil {
+		t.Errorf("got %d entities with unexpected contents after serialization", len(el))
+	}
+
+	// Revocations are merged.
+	if err := e.RevokeKey(packet.KeyCompromised, "", config); err != nil {
+		t.Fatal(err)
+	}
+	kr.Insert(publicCopy(t, e))
+	kr.Insert(publicCopy(t, e))
+	if len(merged.Revocations) != 1 {
+		t.Errorf("got %d revocations, want 1", len(merged.Revocations))
+	}
+
+	if !kr.Delete(e.PrimaryKey.FingerprintBytes()) {
+		t.Error("Delete didn't find the key")
+	}
+	if kr.Delete(e.PrimaryKey.FingerprintBytes()) {
+		t.Error("Delete found a deleted key")
+	}
+	if kr.Entity(e.PrimaryKey.FingerprintBytes()) != nil || len(kr.Entities()) != 1 || kr.Entities()[0].PrimaryKey.KeyId != signer.PrimaryKey.KeyId {
+		t.Error("key still in the keyring after Delete")
+	}
+
+	var zero Keyring
+	if zero.Insert(signer) != signer || zero.Entity(signer.PrimaryKey.FingerprintBytes()) != signer {
+		t.Error("Insert into a zero Keyring failed")
+	}
+}
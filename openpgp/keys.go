@@ -5,8 +5,14 @@
 package openpgp
 
 import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"io"
+	"strconv"
 	"time"
 
 	"github.com/gitpod-io/golang-crypto/openpgp/armor"
@@ -24,11 +30,17 @@ var PrivateKeyType = "PGP PRIVATE KEY BLOCK"
 // (which must be a signing key), one or more identities claimed by that key,
 // and zero or more subkeys, which may be encryption keys.
 type Entity struct {
-	PrimaryKey  *packet.PublicKey
-	PrivateKey  *packet.PrivateKey
-	Identities  map[string]*Identity // indexed by Identity.Name
+	PrimaryKey *packet.PublicKey
+	PrivateKey *packet.PrivateKey
+	Identities map[string]*Identity // indexed by Identity.Name
+	// Revocations are the revocation signatures of the primary key. See
+	// Revoked.
 	Revocations []*packet.Signature
 	Subkeys     []Subkey
+	// DirectSignature is the newest valid direct-key self-signature, if
+	// any. v6 keys need not have identities, in which case it holds the
+	// key flags and preferences of the primary key.
+	DirectSignature *packet.Signature
 }
 
 // An Identity represents an identity claimed by an Entity and zero or more
@@ -45,7 +57,39 @@ type Identity struct {
 type Subkey struct {
 	PublicKey  *packet.PublicKey
 	PrivateKey *packet.PrivateKey
-	Sig        *packet.Signature
+	// Sig is the newest binding signature of the subkey.
+	Sig *packet.Signature
+	// Revocations are the revocation signatures of the subkey. See
+	// Revoked.
+	Revocations []*packet.Signature
+}
+
+// Revoked reports whether the primary key of e, and thus the whole Entity,
+// has been revoked. A revoked Entity is not used to encrypt or sign
+// messages, and KeysByIdUsage doesn't return any of its keys.
+func (e *Entity) Revoked() bool {
+	return len(e.Revocations) > 0
+}
+
+// Revoked reports whether the subkey has been revoked. Revoked subkeys are
+// not used to encrypt or sign messages, and KeysByIdUsage doesn't return
+// them.
+func (s *Subkey) Revoked() bool {
+	return len(s.Revocations) > 0
+}
+
+// keyRevoked reports whether pk, the primary key of e or one of its
+// subkeys, has been revoked.
+func (e *Entity) keyRevoked(pk *packet.PublicKey) bool {
+	if e.Revoked() {
+		return true
+	}
+	for i := range e.Subkeys {
+		if e.Subkeys[i].PublicKey == pk {
+			return e.Subkeys[i].Revoked()
+		}
+	}
+	return false
 }
 
 // A Key identifies a specific public key in an Entity. This is either the
@@ -86,15 +130,28 @@ func (e *Entity) primaryIdentity() *Identity {
 	return firstIdentity
 }
 
+// primarySelfSignature returns the self-signature of the primary identity or,
+// for entities without identities, the direct-key signature.
+func (e *Entity) primarySelfSignature() *packet.Signature {
+	if i := e.primaryIdentity(); i != nil {
+		return i.SelfSignature
+	}
+	return e.DirectSignature
+}
+
 // encryptionKey returns the best candidate Key for encrypting a message to the
 // given Entity.
 func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
+	if e.Revoked() {
+		return Key{}, false
+	}
 	candidateSubkey := -1
 
 	// Iterate the keys to find the newest key
 	var maxTime time.Time
 	for i, subkey := range e.Subkeys {
-		if subkey.Sig.FlagsValid &&
+		if !subkey.Revoked() &&
+			subkey.Sig.FlagsValid &&
 			subkey.Sig.FlagEncryptCommunications &&
 			subkey.PublicKey.PubKeyAlgo.CanEncrypt() &&
 			!subkey.Sig.KeyExpired(now) &&
@@ -113,11 +170,11 @@ func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
 	// the primary key doesn't have any usage metadata then we
 	// assume that the primary key is ok. Or, if the primary key is
 	// marked as ok to encrypt to, then we can obviously use it.
-	i := e.primaryIdentity()
-	if !i.SelfSignature.FlagsValid || i.SelfSignature.FlagEncryptCommunications &&
+	selfSig := e.primarySelfSignature()
+	if !selfSig.FlagsValid || selfSig.FlagEncryptCommunications &&
 		e.PrimaryKey.PubKeyAlgo.CanEncrypt() &&
-		!i.SelfSignature.KeyExpired(now) {
-		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature}, true
+		!selfSig.KeyExpired(now) {
+		return Key{e, e.PrimaryKey, e.PrivateKey, selfSig}, true
 	}
 
 	// This Entity appears to be signing only.
@@ -127,10 +184,14 @@ func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
 // signingKey return the best candidate Key for signing a message with this
 // Entity.
 func (e *Entity) signingKey(now time.Time) (Key, bool) {
+	if e.Revoked() {
+		return Key{}, false
+	}
 	candidateSubkey := -1
 
 	for i, subkey := range e.Subkeys {
-		if subkey.Sig.FlagsValid &&
+		if !subkey.Revoked() &&
+			subkey.Sig.FlagsValid &&
 			subkey.Sig.FlagSign &&
 			subkey.PublicKey.PubKeyAlgo.CanSign() &&
 			!subkey.Sig.KeyExpired(now) {
@@ -146,10 +207,10 @@ func (e *Entity) signingKey(now time.Time) (Key, bool) {
 
 	// If we have no candidate subkey then we assume that it's ok to sign
 	// with the primary key.
-	i := e.primaryIdentity()
-	if !i.SelfSignature.FlagsValid || i.SelfSignature.FlagSign &&
-		!i.SelfSignature.KeyExpired(now) {
-		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature}, true
+	selfSig := e.primarySelfSignature()
+	if !selfSig.FlagsValid || selfSig.FlagSign &&
+		!selfSig.KeyExpired(now) {
+		return Key{e, e.PrimaryKey, e.PrivateKey, selfSig}, true
 	}
 
 	return Key{}, false
@@ -171,6 +232,9 @@ func (el EntityList) KeysById(id uint64) (keys []Key) {
 					break
 				}
 			}
+			if selfSig == nil {
+				selfSig = e.DirectSignature
+			}
 			keys = append(keys, Key{e, e.PrimaryKey, e.PrivateKey, selfSig})
 		}
 
@@ -188,7 +252,7 @@ func (el EntityList) KeysById(id uint64) (keys []Key) {
 // the bitwise-OR of packet.KeyFlag* values.
 func (el EntityList) KeysByIdUsage(id uint64, requiredUsage byte) (keys []Key) {
 	for _, key := range el.KeysById(id) {
-		if len(key.Entity.Revocations) > 0 {
+		if key.Entity.keyRevoked(key.PublicKey) {
 			continue
 		}
 
@@ -221,6 +285,8 @@ func (el EntityList) KeysByIdUsage(id uint64, requiredUsage byte) (keys []Key) {
 }
 
 // DecryptionKeys returns all private keys that are valid for decryption.
+// They include revoked keys, so that messages encrypted before the revocation
+// can still be read.
 func (el EntityList) DecryptionKeys() (keys []Key) {
 	for _, e := range el {
 		for _, subKey := range e.Subkeys {
@@ -250,6 +316,10 @@ func ReadArmoredKeyRing(r io.Reader) (EntityList, error) {
 
 // ReadKeyRing reads one or more public/private keys. Unsupported keys are
 // ignored as long as at least a single valid key is found.
+//
+// Revocation signatures must be valid self-signatures, or the key is
+// skipped as unreadable. Revoked keys are kept so that their revocation can
+// be seen, see Entity.Revoked and Subkey.Revoked, but are not used.
 func ReadKeyRing(r io.Reader) (el EntityList, err error) {
 	packets := packet.NewReader(r)
 	var lastUnsupportedError error
@@ -352,9 +422,16 @@ EachPacket:
 			if pkt.SigType == packet.SigTypeKeyRevocation {
 				revocations = append(revocations, pkt)
 			} else if pkt.SigType == packet.SigTypeDirectSignature {
-				// TODO: RFC4880 5.2.1 permits signatures
-				// directly on keys (eg. to bind additional
-				// revocation keys).
+				// RFC 4880 5.2.1 permits signatures directly on
+				// keys. We only keep self-signatures, which hold
+				// the properties of v6 keys. See RFC 9580,
+				// section 5.2.3.10.
+				// TODO: signatures by other keys (eg. to bind
+				// additional revocation keys).
+				if e.PrimaryKey.VerifyDirectKeySignature(pkt) == nil &&
+					(e.DirectSignature == nil || pkt.CreationTime.After(e.DirectSignature.CreationTime)) {
+					e.DirectSignature = pkt
+				}
 			}
 			// Else, ignoring the signature as it does not follow anything
 			// we would know to attach it to.
@@ -381,7 +458,9 @@ EachPacket:
 		}
 	}
 
-	if len(e.Identities) == 0 {
+	// v6 keys carry their properties in a direct-key signature, so that
+	// identities are optional. See RFC 9580, section 10.1.1.
+	if len(e.Identities) == 0 && (e.PrimaryKey.Version != 6 || e.DirectSignature == nil) {
 		return nil, errors.StructuralError("entity without any identities")
 	}
 
@@ -415,7 +494,9 @@ func addUserID(e *Entity, packets *packet.Reader, pkt *packet.UserId) error {
 		}
 
 		sig, ok := p.(*packet.Signature)
-		if !ok {
+		if !ok || sig.SigType == packet.SigTypeKeyRevocation {
+			// Key revocations belong to the primary key, even
+			// when misplaced after a user ID.
 			packets.Unread(p)
 			break
 		}
@@ -463,9 +544,8 @@ func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *p
 
 		switch sig.SigType {
 		case packet.SigTypeSubkeyRevocation:
-			subKey.Sig = sig
+			subKey.Revocations = append(subKey.Revocations, sig)
 		case packet.SigTypeSubkeyBinding:
-
 			if shouldReplaceSubkeySig(subKey.Sig, sig) {
 				subKey.Sig = sig
 			}
@@ -490,43 +570,167 @@ func shouldReplaceSubkeySig(existingSig, potentialNewSig *packet.Signature) bool
 		return true
 	}
 
-	if existingSig.SigType == packet.SigTypeSubkeyRevocation {
-		return false // never override a revocation signature
-	}
-
 	return potentialNewSig.CreationTime.After(existingSig.CreationTime)
 }
 
 const defaultRSAKeyBits = 2048
 
-// NewEntity returns an Entity that contains a fresh RSA/RSA keypair with a
-// single identity composed of the given full name, comment and email, any of
-// which may be empty but must not contain any of "()<>\x00".
+// NewEntity returns an Entity that contains a fresh keypair with a single
+// identity composed of the given full name, comment and email, any of which
+// may be empty but must not contain any of "()<>\x00". The primary key, which
+// certifies and signs, and the encryption subkey are RSA keys, unless
+// config.Algorithm selects an elliptic curve algorithm. They expire after
+// config.KeyLifetimeSecs, if set.
 // If config is nil, sensible defaults will be used.
 func NewEntity(name, comment, email string, config *packet.Config) (*Entity, error) {
 	creationTime := config.Now()
 
-	bits := defaultRSAKeyBits
-	if config != nil && config.RSABits != 0 {
-		bits = config.RSABits
-	}
-
 	uid := packet.NewUserId(name, comment, email)
 	if uid == nil {
 		return nil, errors.InvalidArgumentError("user id field contained invalid characters")
 	}
-	signingPriv, err := rsa.GenerateKey(config.Random(), bits)
+	signingPriv, err := newSigningKey(creationTime, config)
 	if err != nil {
 		return nil, err
 	}
-	encryptingPriv, err := rsa.GenerateKey(config.Random(), bits)
+	encryptingPriv, err := newDecryptionKey(creationTime, config)
 	if err != nil {
 		return nil, err
 	}
 
+	return newEntity(uid, signingPriv, encryptingPriv, false, config)
+}
+
+// newSigningKey generates a signing key of the algorithm of config.
+func newSigningKey(creationTime time.Time, config *packet.Config) (*packet.PrivateKey, error) {
+	switch config.PublicKeyAlgorithm() {
+	case packet.PubKeyAlgoRSA:
+		priv, err := rsa.GenerateKey(config.Random(), rsaBits(config))
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewRSAPrivateKey(creationTime, priv), nil
+	case packet.PubKeyAlgoEd25519:
+		_, priv, err := ed25519.GenerateKey(config.Random())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewEd25519PrivateKey(creationTime, priv), nil
+	case packet.PubKeyAlgoECDSA:
+		curve, err := keyCurve(config)
+		if err != nil {
+			return nil, err
+		}
+		priv, err := ecdsa.GenerateKey(curve, config.Random())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewECDSAPrivateKey(creationTime, priv), nil
+	}
+	return nil, errors.InvalidArgumentError("unsupported public key algorithm for new keys: " + strconv.Itoa(int(config.PublicKeyAlgorithm())))
+}
+
+// newDecryptionKey generates an encryption key of the encryption algorithm
+// that matches the algorithm of config.
+func newDecryptionKey(creationTime time.Time, config *packet.Config) (*packet.PrivateKey, error) {
+	switch config.PublicKeyAlgorithm() {
+	case packet.PubKeyAlgoRSA:
+		priv, err := rsa.GenerateKey(config.Random(), rsaBits(config))
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewRSAPrivateKey(creationTime, priv), nil
+	case packet.PubKeyAlgoEd25519:
+		priv, err := ecdh.X25519().GenerateKey(config.Random())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewX25519PrivateKey(creationTime, priv), nil
+	case packet.PubKeyAlgoECDSA:
+		curve, err := keyCurve(config)
+		if err != nil {
+			return nil, err
+		}
+		priv, err := ecdsa.GenerateKey(curve, config.Random())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewECDHPrivateKey(creationTime, priv), nil
+	}
+	return nil, errors.InvalidArgumentError("unsupported public key algorithm for new keys: " + strconv.Itoa(int(config.PublicKeyAlgorithm())))
+}
+
+func rsaBits(config *packet.Config) int {
+	if config != nil && config.RSABits != 0 {
+		return config.RSABits
+	}
+	return defaultRSAKeyBits
+}
+
+func keyCurve(config *packet.Config) (elliptic.Curve, error) {
+	switch curve := config.EllipticCurve(); curve {
+	case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		return curve, nil
+	}
+	return nil, errors.InvalidArgumentError("unsupported elliptic curve for new keys")
+}
+
+// keyLifetime returns the KeyLifetimeSecs of the self-signatures of new keys.
+func keyLifetime(config *packet.Config) *uint32 {
+	secs := config.KeyLifetime()
+	if secs == 0 {
+		return nil
+	}
+	return &secs
+}
+
+// NewEntityFromKeys returns an Entity with a single identity composed of the
+// given full name, comment and email, whose primary key is signer and, if
+// decrypter is not nil, with an encryption subkey that is decrypter. signer
+// must implement RSA, ECDSA or Ed25519, and decrypter must implement RSA.
+//
+// This allows using keys held by hardware tokens or other external key
+// stores: their private key material is never accessed, so the Entity can
+// sign and decrypt, and be serialized with Serialize, but SerializePrivate
+// fails.
+//
+// Key IDs depend on the creation time of the keys, which is taken from
+// config.Now(). To recreate the Entity of existing keys, set config.Time to
+// return their original creation time.
+// If config is nil, sensible defaults will be used.
+func NewEntityFromKeys(name, comment, email string, signer crypto.Signer, decrypter crypto.Decrypter, config *packet.Config) (*Entity, error) {
+	creationTime := config.Now()
+
+	uid := packet.NewUserId(name, comment, email)
+	if uid == nil {
+		return nil, errors.InvalidArgumentError("user id field contained invalid characters")
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, errors.InvalidArgumentError("unsupported signer public key type")
+	}
+	var encrypting *packet.PrivateKey
+	if decrypter != nil {
+		if _, ok := decrypter.Public().(*rsa.PublicKey); !ok {
+			return nil, errors.InvalidArgumentError("unsupported decrypter public key type")
+		}
+		encrypting = packet.NewDecrypterPrivateKey(creationTime, decrypter)
+	}
+
+	return newEntity(uid, packet.NewSignerPrivateKey(creationTime, signer), encrypting, true, config)
+}
+
+// newEntity returns an Entity for uid with the given primary key and, if it
+// is not nil, encryption subkey, both self-signed. The preferences of config
+// are only covered by the self-signature, and thus serialized, if
+// signPreferences is set: NewEntity has always set them after signing, and
+// keeps doing so to produce the same output.
+func newEntity(uid *packet.UserId, signing, encrypting *packet.PrivateKey, signPreferences bool, config *packet.Config) (*Entity, error) {
+	creationTime := signing.CreationTime
 	e := &Entity{
-		PrimaryKey: packet.NewRSAPublicKey(creationTime, &signingPriv.PublicKey),
-		PrivateKey: packet.NewRSAPrivateKey(creationTime, signingPriv),
+		PrimaryKey: &signing.PublicKey,
+		PrivateKey: signing,
 		Identities: make(map[string]*Identity),
 	}
 	isPrimaryId := true
@@ -536,55 +740,205 @@ func NewEntity(name, comment, email string, config *packet.Config) (*Entity, err
 		SelfSignature: &packet.Signature{
 			CreationTime: creationTime,
 			SigType:      packet.SigTypePositiveCert,
-			PubKeyAlgo:   packet.PubKeyAlgoRSA,
+			PubKeyAlgo:   signing.PubKeyAlgo,
 			Hash:         config.Hash(),
 			IsPrimaryId:  &isPrimaryId,
 			FlagsValid:   true,
 			FlagSign:     true,
 			FlagCertify:  true,
 			IssuerKeyId:  &e.PrimaryKey.KeyId,
+			// The lifetime of the primary key, and thus of the
+			// whole Entity.
+			KeyLifetimeSecs: keyLifetime(config),
 		},
 	}
-	err = e.Identities[uid.Id].SelfSignature.SignUserId(uid.Id, e.PrimaryKey, e.PrivateKey, config)
-	if err != nil {
-		return nil, err
+	selfSignature := e.Identities[uid.Id].SelfSignature
+	if !signPreferences {
+		if err := selfSignature.SignUserId(uid.Id, e.PrimaryKey, e.PrivateKey, config); err != nil {
+			return nil, err
+		}
 	}
 
 	// If the user passes in a DefaultHash via packet.Config,
 	// set the PreferredHash for the SelfSignature.
 	if config != nil && config.DefaultHash != 0 {
-		e.Identities[uid.Id].SelfSignature.PreferredHash = []uint8{hashToHashId(config.DefaultHash)}
+		selfSignature.PreferredHash = []uint8{hashToHashId(config.DefaultHash)}
 	}
 
 	// Likewise for DefaultCipher.
 	if config != nil && config.DefaultCipher != 0 {
-		e.Identities[uid.Id].SelfSignature.PreferredSymmetric = []uint8{uint8(config.DefaultCipher)}
-	}
-
-	e.Subkeys = make([]Subkey, 1)
-	e.Subkeys[0] = Subkey{
-		PublicKey:  packet.NewRSAPublicKey(creationTime, &encryptingPriv.PublicKey),
-		PrivateKey: packet.NewRSAPrivateKey(creationTime, encryptingPriv),
-		Sig: &packet.Signature{
-			CreationTime:              creationTime,
-			SigType:                   packet.SigTypeSubkeyBinding,
-			PubKeyAlgo:                packet.PubKeyAlgoRSA,
-			Hash:                      config.Hash(),
-			FlagsValid:                true,
-			FlagEncryptStorage:        true,
-			FlagEncryptCommunications: true,
-			IssuerKeyId:               &e.PrimaryKey.KeyId,
-		},
+		selfSignature.PreferredSymmetric = []uint8{uint8(config.DefaultCipher)}
+	}
+
+	if signPreferences {
+		if err := selfSignature.SignUserId(uid.Id, e.PrimaryKey, e.PrivateKey, config); err != nil {
+			return nil, err
+		}
 	}
-	e.Subkeys[0].PublicKey.IsSubkey = true
-	e.Subkeys[0].PrivateKey.IsSubkey = true
-	err = e.Subkeys[0].Sig.SignKey(e.Subkeys[0].PublicKey, e.PrivateKey, config)
+
+	if encrypting == nil {
+		return e, nil
+	}
+	err := e.addNewSubkey(encrypting, &packet.Signature{
+		FlagEncryptStorage:        true,
+		FlagEncryptCommunications: true,
+	}, config)
 	if err != nil {
 		return nil, err
 	}
 	return e, nil
 }
 
+// AddUserId adds an identity composed of the given full name, comment and
+// email to e, self-signed with the same key flags, preferences and
+// expiration as the primary identity. The private key of e must have been
+// decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddUserId(name, comment, email string, config *packet.Config) error {
+	if err := e.checkPrivateKey(); err != nil {
+		return err
+	}
+	uid := packet.NewUserId(name, comment, email)
+	if uid == nil {
+		return errors.InvalidArgumentError("user id field contained invalid characters")
+	}
+	if _, ok := e.Identities[uid.Id]; ok {
+		return errors.InvalidArgumentError("user id exists already")
+	}
+
+	sig := &packet.Signature{
+		CreationTime:    config.Now(),
+		SigType:         packet.SigTypePositiveCert,
+		PubKeyAlgo:      e.PrivateKey.PubKeyAlgo,
+		Hash:            config.Hash(),
+		FlagsValid:      true,
+		FlagSign:        true,
+		FlagCertify:     true,
+		IssuerKeyId:     &e.PrimaryKey.KeyId,
+		KeyLifetimeSecs: keyLifetime(config),
+	}
+	if primary := e.primarySelfSignature(); primary != nil {
+		sig.FlagsValid = primary.FlagsValid
+		sig.FlagSign = primary.FlagSign
+		sig.FlagCertify = primary.FlagCertify
+		sig.FlagEncryptCommunications = primary.FlagEncryptCommunications
+		sig.FlagEncryptStorage = primary.FlagEncryptStorage
+		sig.FlagAuthenticate = primary.FlagAuthenticate
+		sig.PreferredSymmetric = primary.PreferredSymmetric
+		sig.PreferredHash = primary.PreferredHash
+		sig.PreferredCompression = primary.PreferredCompression
+		// Key expiration is relative to the creation of the key,
+		// not of the signature.
+		sig.KeyLifetimeSecs = primary.KeyLifetimeSecs
+	}
+	if err := sig.SignUserId(uid.Id, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	if e.Identities == nil {
+		e.Identities = make(map[string]*Identity)
+	}
+	e.Identities[uid.Id] = &Identity{
+		Name:          uid.Id,
+		UserId:        uid,
+		SelfSignature: sig,
+	}
+	return nil
+}
+
+// AddSigningSubkey adds a fresh signing subkey of config.Algorithm to e,
+// cross-signed so that it can't be claimed by another key. Sign and Encrypt
+// then sign messages with it rather than with the primary key. The private
+// key of e must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddSigningSubkey(config *packet.Config) error {
+	if err := e.checkPrivateKey(); err != nil {
+		return err
+	}
+	priv, err := newSigningKey(config.Now(), config)
+	if err != nil {
+		return err
+	}
+	return e.addNewSubkey(priv, &packet.Signature{FlagSign: true}, config)
+}
+
+// AddEncryptionSubkey adds a fresh encryption subkey, of the encryption
+// algorithm that matches config.Algorithm, to e. Messages encrypted to e
+// use the newest encryption subkey. The private key of e must have been
+// decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddEncryptionSubkey(config *packet.Config) error {
+	if err := e.checkPrivateKey(); err != nil {
+		return err
+	}
+	priv, err := newDecryptionKey(config.Now(), config)
+	if err != nil {
+		return err
+	}
+	return e.addNewSubkey(priv, &packet.Signature{
+		FlagEncryptStorage:        true,
+		FlagEncryptCommunications: true,
+	}, config)
+}
+
+// AddAuthenticationSubkey adds a fresh subkey of config.Algorithm to e,
+// flagged for authentication only, such as for use as an SSH key. The
+// private key of e must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddAuthenticationSubkey(config *packet.Config) error {
+	if err := e.checkPrivateKey(); err != nil {
+		return err
+	}
+	priv, err := newSigningKey(config.Now(), config)
+	if err != nil {
+		return err
+	}
+	return e.addNewSubkey(priv, &packet.Signature{FlagAuthenticate: true}, config)
+}
+
+func (e *Entity) checkPrivateKey() error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("Entity's private key must be decrypted")
+	}
+	return nil
+}
+
+// addNewSubkey adds priv to e as a subkey, bound by sig, which only needs
+// its key flags set. Signing subkeys are cross-signed.
+func (e *Entity) addNewSubkey(priv *packet.PrivateKey, sig *packet.Signature, config *packet.Config) error {
+	priv.IsSubkey = true
+	sig.CreationTime = priv.CreationTime
+	sig.SigType = packet.SigTypeSubkeyBinding
+	sig.PubKeyAlgo = e.PrivateKey.PubKeyAlgo
+	sig.Hash = config.Hash()
+	sig.FlagsValid = true
+	sig.IssuerKeyId = &e.PrimaryKey.KeyId
+	sig.KeyLifetimeSecs = keyLifetime(config)
+	if sig.FlagSign {
+		sig.EmbeddedSignature = &packet.Signature{
+			CreationTime: priv.CreationTime,
+			SigType:      packet.SigTypePrimaryKeyBinding,
+			PubKeyAlgo:   priv.PubKeyAlgo,
+			Hash:         config.Hash(),
+			IssuerKeyId:  &priv.KeyId,
+		}
+		if err := sig.EmbeddedSignature.CrossSignKey(e.PrimaryKey, priv, config); err != nil {
+			return err
+		}
+	}
+	if err := sig.SignKey(&priv.PublicKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	e.Subkeys = append(e.Subkeys, Subkey{
+		PublicKey:  &priv.PublicKey,
+		PrivateKey: priv,
+		Sig:        sig,
+	})
+	return nil
+}
+
 // SerializePrivate serializes an Entity, including private key material, but
 // excluding signatures from other entities, to the given Writer.
 // Identities and subkeys are re-signed in case they changed since NewEntry.
@@ -594,6 +948,10 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 	if err != nil {
 		return
 	}
+	err = serializeSignatures(w, e.Revocations)
+	if err != nil {
+		return
+	}
 	for _, ident := range e.Identities {
 		err = ident.UserId.Serialize(w)
 		if err != nil {
@@ -613,6 +971,10 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 		if err != nil {
 			return
 		}
+		err = serializeSignatures(w, subkey.Revocations)
+		if err != nil {
+			return
+		}
 		err = subkey.Sig.SignKey(subkey.PublicKey, e.PrivateKey, config)
 		if err != nil {
 			return
@@ -632,6 +994,10 @@ func (e *Entity) Serialize(w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	err = serializeSignatures(w, e.Revocations)
+	if err != nil {
+		return err
+	}
 	for _, ident := range e.Identities {
 		err = ident.UserId.Serialize(w)
 		if err != nil {
@@ -653,6 +1019,10 @@ func (e *Entity) Serialize(w io.Writer) error {
 		if err != nil {
 			return err
 		}
+		err = serializeSignatures(w, subkey.Revocations)
+		if err != nil {
+			return err
+		}
 		err = subkey.Sig.Serialize(w)
 		if err != nil {
 			return err
@@ -691,3 +1061,71 @@ func (e *Entity) SignIdentity(identity string, signer *Entity, config *packet.Co
 	ident.Signatures = append(ident.Signatures, sig)
 	return nil
 }
+
+func serializeSignatures(w io.Writer, sigs []*packet.Signature) error {
+	for _, sig := range sigs {
+		if err := sig.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeKey revokes the primary key of e, and thus the whole Entity, by
+// adding a revocation signature with the given reason to e.Revocations.
+// reasonText is a human-readable explanation, which may be empty. The
+// private key of e must have been decrypted if necessary. Call Serialize to
+// publish the revocation.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RevokeKey(reason packet.ReasonForRevocation, reasonText string, config *packet.Config) error {
+	if err := e.checkPrivateKey(); err != nil {
+		return err
+	}
+	sig := e.newRevocation(packet.SigTypeKeyRevocation, reason, reasonText, config)
+	if err := sig.RevokeKey(e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	e.Revocations = append(e.Revocations, sig)
+	return nil
+}
+
+// RevokeSubkey revokes sk, which must point into e.Subkeys, by adding a
+// revocation signature with the given reason to sk.Revocations. reasonText
+// is a human-readable explanation, which may be empty. The private key of e
+// must have been decrypted if necessary. Call Serialize to publish the
+// revocation.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RevokeSubkey(sk *Subkey, reason packet.ReasonForRevocation, reasonText string, config *packet.Config) error {
+	if err := e.checkPrivateKey(); err != nil {
+		return err
+	}
+	found := false
+	for i := range e.Subkeys {
+		if &e.Subkeys[i] == sk {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.InvalidArgumentError("given subkey is not a subkey of the Entity")
+	}
+	sig := e.newRevocation(packet.SigTypeSubkeyRevocation, reason, reasonText, config)
+	if err := sig.RevokeSubkey(sk.PublicKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	sk.Revocations = append(sk.Revocations, sig)
+	return nil
+}
+
+func (e *Entity) newRevocation(sigType packet.SignatureType, reason packet.ReasonForRevocation, reasonText string, config *packet.Config) *packet.Signature {
+	reasonCode := uint8(reason)
+	return &packet.Signature{
+		CreationTime:         config.Now(),
+		SigType:              sigType,
+		PubKeyAlgo:           e.PrivateKey.PubKeyAlgo,
+		Hash:                 config.Hash(),
+		IssuerKeyId:          &e.PrimaryKey.KeyId,
+		RevocationReason:     &reasonCode,
+		RevocationReasonText: reasonText,
+	}
+}
@@ -3,6 +3,12 @@ package openpgp
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
 	"strings"
 	"testing"
 	"time"
@@ -417,6 +423,31 @@ func TestNewEntityWithPreferredHash(t *testing.T) {
 	}
 }
 
+func TestNewEntityPreferredHashNotSerialized(t *testing.T) {
+	// NewEntity sets the preferences after the self-signature, which
+	// doesn't cover them, so they are not serialized.
+	c := &packet.Config{
+		DefaultHash: crypto.SHA256,
+	}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := entity.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	public, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, identity := range public.Identities {
+		if len(identity.SelfSignature.PreferredHash) != 0 {
+			t.Fatalf("read back preferred hashes %v, want none", identity.SelfSignature.PreferredHash)
+		}
+	}
+}
+
 func TestNewEntityWithoutPreferredHash(t *testing.T) {
 	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", nil)
 	if err != nil {
@@ -493,3 +524,323 @@ func TestNewEntityPublicSerialization(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// externalSigner and externalDecrypter hide the type of a private key, like
+// the keys of a hardware token.
+type externalSigner struct{ crypto.Signer }
+
+type externalDecrypter struct{ crypto.Decrypter }
+
+func TestNewEntityFromKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creationTime := time.Unix(1700000000, 0)
+	config := &packet.Config{DefaultHash: crypto.SHA256, Time: func() time.Time { return creationTime }}
+
+	for name, signer := range map[string]crypto.Signer{"RSA": rsaKey, "ECDSA": ecdsaKey, "Ed25519": ed25519Key} {
+		entity, err := NewEntityFromKeys("Golang Gopher", name, "no-reply@golang.com", externalSigner{signer}, externalDecrypter{decryptKey}, config)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !entity.PrimaryKey.CreationTime.Equal(creationTime) {
+			t.Errorf("%s: creation time %v, want %v", name, entity.PrimaryKey.CreationTime, creationTime)
+		}
+
+		// The public Entity can be read back.
+		var buf bytes.Buffer
+		if err := entity.Serialize(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		public, err := ReadEntity(packet.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if public.PrimaryKey.KeyId != entity.PrimaryKey.KeyId {
+			t.Errorf("%s: read back key ID %X, want %X", name, public.PrimaryKey.KeyId, entity.PrimaryKey.KeyId)
+		}
+
+		// Signatures made with the external key verify.
+		message := "Hello, hardware token"
+		var sig bytes.Buffer
+		if err := DetachSign(&sig, entity, strings.NewReader(message), config); err != nil {
+			t.Fatalf("%s: DetachSign: %v", name, err)
+		}
+		if _, err := CheckDetachedSignature(EntityList{public}, strings.NewReader(message), &sig); err != nil {
+			t.Errorf("%s: CheckDetachedSignature: %v", name, err)
+		}
+
+		// Messages encrypted to the Entity are decrypted with the external key.
+		var ciphertext bytes.Buffer
+		w, err := Encrypt(&ciphertext, []*Entity{public}, nil, nil, config)
+		if err != nil {
+			t.Fatalf("%s: Encrypt: %v", name, err)
+		}
+		io.WriteString(w, message)
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		md, err := ReadMessage(&ciphertext, EntityList{entity}, nil, config)
+		if err != nil {
+			t.Fatalf("%s: ReadMessage: %v", name, err)
+		}
+		plaintext, err := io.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(plaintext) != message {
+			t.Errorf("%s: decrypted %q, want %q", name, plaintext, message)
+		}
+
+		if err := entity.SerializePrivate(io.Discard, config); err == nil {
+			t.Errorf("%s: SerializePrivate of external keys succeeded", name)
+		}
+	}
+
+	// A sign-only Entity has no subkeys.
+	entity, err := NewEntityFromKeys("Golang Gopher", "", "", externalSigner{ecdsaKey}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entity.Subkeys) != 0 {
+		t.Errorf("sign-only Entity has %d subkeys", len(entity.Subkeys))
+	}
+
+	// Unsupported keys are rejected.
+	if _, err := NewEntityFromKeys("Golang Gopher", "", "", rsaKey, externalDecrypter{ecdsaKeyDecrypter{ecdsaKey}}, nil); err == nil {
+		t.Error("NewEntityFromKeys accepted an ECDSA decrypter")
+	}
+}
+
+type ecdsaKeyDecrypter struct{ *ecdsa.PrivateKey }
+
+func (ecdsaKeyDecrypter) Decrypt(io.Reader, []byte, crypto.DecrypterOpts) ([]byte, error) {
+	return nil, errors.UnsupportedError("ECDSA decryption")
+}
+
+func TestNewEntityAlgorithms(t *testing.T) {
+	creationTime := time.Unix(1700000000, 0)
+	for _, tt := range []struct {
+		name        string
+		algo        packet.PublicKeyAlgorithm
+		curve       elliptic.Curve
+		encryptAlgo packet.PublicKeyAlgorithm
+	}{
+		{"Ed25519", packet.PubKeyAlgoEd25519, nil, packet.PubKeyAlgoX25519},
+		{"P-256", packet.PubKeyAlgoECDSA, nil, packet.PubKeyAlgoECDH},
+		{"P-384", packet.PubKeyAlgoECDSA, elliptic.P384(), packet.PubKeyAlgoECDH},
+		{"RSA", packet.PubKeyAlgoRSA, nil, packet.PubKeyAlgoRSA},
+	} {
+		config := &packet.Config{
+			Algorithm:       tt.algo,
+			Curve:           tt.curve,
+			RSABits:         1024,
+			DefaultHash:     crypto.SHA256,
+			KeyLifetimeSecs: 3600,
+			Time:            func() time.Time { return creationTime },
+		}
+		entity, err := NewEntity("Golang Gopher", tt.name, "no-reply@golang.com", config)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := entity.AddUserId("Golang Gopher", tt.name, "gopher@example.com", config); err != nil {
+			t.Fatalf("%s: AddUserId: %v", tt.name, err)
+		}
+		if err := entity.AddSigningSubkey(config); err != nil {
+			t.Fatalf("%s: AddSigningSubkey: %v", tt.name, err)
+		}
+		if err := entity.AddAuthenticationSubkey(config); err != nil {
+			t.Fatalf("%s: AddAuthenticationSubkey: %v", tt.name, err)
+		}
+
+		// The private Entity can be read back.
+		var buf bytes.Buffer
+		if err := entity.SerializePrivate(&buf, config); err != nil {
+			t.Fatalf("%s: SerializePrivate: %v", tt.name, err)
+		}
+		read, err := ReadEntity(packet.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("%s: ReadEntity: %v", tt.name, err)
+		}
+		if read.PrimaryKey.PubKeyAlgo != tt.algo || len(read.Identities) != 2 || len(read.Subkeys) != 3 {
+			t.Fatalf("%s: read back algorithm %d with %d identities and %d subkeys", tt.name, read.PrimaryKey.PubKeyAlgo, len(read.Identities), len(read.Subkeys))
+		}
+		if ident := read.Identities["Golang Gopher ("+tt.name+") <gopher@example.com>"]; ident == nil || ident.SelfSignature.KeyLifetimeSecs == nil {
+			t.Errorf("%s: added identity missing or without expiration", tt.name)
+		}
+		encryption, signing, auth := read.Subkeys[0], read.Subkeys[1], read.Subkeys[2]
+		if encryption.PublicKey.PubKeyAlgo != tt.encryptAlgo || !encryption.Sig.FlagEncryptCommunications {
+			t.Errorf("%s: encryption subkey of algorithm %d", tt.name, encryption.PublicKey.PubKeyAlgo)
+		}
+		if signing.PublicKey.PubKeyAlgo != tt.algo || !signing.Sig.FlagSign || signing.Sig.EmbeddedSignature == nil {
+			t.Errorf("%s: signing subkey of algorithm %d, without cross-signature", tt.name, signing.PublicKey.PubKeyAlgo)
+		}
+		if !auth.Sig.FlagAuthenticate || auth.Sig.FlagSign {
+			t.Errorf("%s: authentication subkey flags: %+v", tt.name, auth.Sig)
+		}
+
+		// Messages are encrypted to the encryption subkey and signed with
+		// the signing subkey.
+		now := creationTime.Add(time.Minute)
+		useConfig := &packet.Config{Time: func() time.Time { return now }}
+		message := "Hello, curves"
+		var ciphertext bytes.Buffer
+		w, err := Encrypt(&ciphertext, []*Entity{read}, read, nil, useConfig)
+		if err != nil {
+			t.Fatalf("%s: Encrypt: %v", tt.name, err)
+		}
+		io.WriteString(w, message)
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		md, err := ReadMessage(&ciphertext, EntityList{read}, nil, useConfig)
+		if err != nil {
+			t.Fatalf("%s: ReadMessage: %v", tt.name, err)
+		}
+		plaintext, err := io.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(plaintext) != message || md.DecryptedWith.PublicKey != encryption.PublicKey {
+			t.Errorf("%s: decrypted %q with key %X", tt.name, plaintext, md.DecryptedWith.PublicKey.KeyId)
+		}
+		if md.SignatureError != nil || md.SignedByKeyId != signing.PublicKey.KeyId {
+			t.Errorf("%s: signed by %X, want the signing subkey %X: %v", tt.name, md.SignedByKeyId, signing.PublicKey.KeyId, md.SignatureError)
+		}
+
+		// The keys expire.
+		if _, ok := read.encryptionKey(creationTime.Add(2 * time.Hour)); ok {
+			t.Errorf("%s: encryption key valid after its expiration", tt.name)
+		}
+	}
+}
+
+func TestNewEntityUnsupportedAlgorithm(t *testing.T) {
+	if _, err := NewEntity("", "", "", &packet.Config{Algorithm: packet.PubKeyAlgoDSA}); err == nil {
+		t.Error("NewEntity made a DSA key")
+	}
+	if _, err := NewEntity("", "", "", &packet.Config{Algorithm: packet.PubKeyAlgoECDSA, Curve: elliptic.P224()}); err == nil {
+		t.Error("NewEntity made a P-224 key")
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEd25519}
+	e, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Revoked() {
+		t.Fatal("new Entity is revoked")
+	}
+	if err := e.RevokeKey(packet.KeySuperseded, "replaced by a new key", config); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	kring, err := ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := kring[0]
+	if !read.Revoked() || len(read.Revocations) != 1 {
+		t.Fatalf("got %d revocations, want 1", len(read.Revocations))
+	}
+	if sig := read.Revocations[0]; sig.RevocationReason == nil || *sig.RevocationReason != uint8(packet.KeySuperseded) || sig.RevocationReasonText != "replaced by a new key" {
+		t.Errorf("got revocation reason %v %q", sig.RevocationReason, sig.RevocationReasonText)
+	}
+	if _, ok := read.encryptionKey(time.Now()); ok {
+		t.Error("revoked Entity has an encryption key")
+	}
+	if _, ok := read.signingKey(time.Now()); ok {
+		t.Error("revoked Entity has a signing key")
+	}
+	if keys := kring.KeysByIdUsage(read.PrimaryKey.KeyId, 0); len(keys) != 0 {
+		t.Errorf("KeysByIdUsage returned %d keys of a revoked Entity", len(keys))
+	}
+	if _, err := Encrypt(io.Discard, kring, nil, nil, nil); err == nil {
+		t.Error("Encrypt succeeded to a revoked Entity")
+	}
+
+	// Revocations misplaced after a user ID still apply to the key.
+	buf.Reset()
+	e.PrimaryKey.Serialize(&buf)
+	for _, ident := range e.Identities {
+		ident.UserId.Serialize(&buf)
+		ident.SelfSignature.Serialize(&buf)
+	}
+	e.Revocations[0].Serialize(&buf)
+	if kring, err = ReadKeyRing(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !kring[0].Revoked() {
+		t.Error("revocation after a user ID was ignored")
+	}
+}
+
+func TestRevokeSubkey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEd25519}
+	e, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Time = func() time.Time { return time.Now().Add(time.Minute) }
+	if err := e.AddEncryptionSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	newest := &e.Subkeys[1]
+	if key, ok := e.encryptionKey(config.Now()); !ok || key.PublicKey != newest.PublicKey {
+		t.Fatal("new subkey is not used for encryption")
+	}
+	if err := e.RevokeSubkey(newest, packet.KeyCompromised, "", config); err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := e.encryptionKey(config.Now()); !ok || key.PublicKey != e.Subkeys[0].PublicKey {
+		t.Error("revoked subkey is used for encryption")
+	}
+	if err := e.RevokeSubkey(&Subkey{PublicKey: newest.PublicKey}, packet.NoReason, "", config); err == nil {
+		t.Error("RevokeSubkey succeeded with a foreign subkey")
+	}
+
+	var buf bytes.Buffer
+	if err := e.SerializePrivate(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	kring, err := ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := kring[0]
+	if read.Revoked() || read.Subkeys[0].Revoked() || !read.Subkeys[1].Revoked() {
+		t.Fatal("wrong keys revoked after reading the Entity")
+	}
+	if sig := read.Subkeys[1].Sig; sig.SigType != packet.SigTypeSubkeyBinding {
+		t.Errorf("got subkey signature type %d, want a binding signature", sig.SigType)
+	}
+	if keys := kring.KeysByIdUsage(read.Subkeys[1].PublicKey.KeyId, 0); len(keys) != 0 {
+		t.Errorf("KeysByIdUsage returned a revoked subkey")
+	}
+	if keys := kring.KeysByIdUsage(read.Subkeys[0].PublicKey.KeyId, 0); len(keys) != 1 {
+		t.Errorf("KeysByIdUsage didn't return the valid subkey")
+	}
+	// Revoked keys can still decrypt.
+	if keys := kring.DecryptionKeys(); len(keys) != 2 {
+		t.Errorf("got %d decryption keys, want 2", len(keys))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"io"
+	"strconv"
+
+	"github.com/gitpod-io/golang-crypto/hkdf"
+	"github.com/gitpod-io/golang-crypto/openpgp/errors"
+)
+
+// AEADMode represents the different Authenticated Encryption with Associated
+// Data modes specified for OpenPGP. See RFC 9580, section 9.6.
+type AEADMode uint8
+
+const (
+	AEADModeEAX AEADMode = 1
+	AEADModeOCB AEADMode = 2
+	AEADModeGCM AEADMode = 3
+)
+
+// NonceLength returns the length, in bytes, of the nonce of mode.
+func (mode AEADMode) NonceLength() int {
+	switch mode {
+	case AEADModeEAX:
+		return 16
+	case AEADModeOCB:
+		return 15
+	case AEADModeGCM:
+		return 12
+	}
+	return 0
+}
+
+// TagLength returns the length, in bytes, of the authentication tag of
+// mode.
+func (mode AEADMode) TagLength() int {
+	switch mode {
+	case AEADModeEAX, AEADModeOCB, AEADModeGCM:
+		return 16
+	}
+	return 0
+}
+
+// AEADConfig configures AEAD encryption. See Config.AEAD.
+type AEADConfig struct {
+	// Mode is the AEAD mode. If zero, OCB is used, which all
+	// implementations of RFC 9580 support.
+	Mode AEADMode
+	// ChunkSize is the size in bytes of the chunks of plaintext that are
+	// authenticated separately. It must be a power of two between 64 and
+	// 4194304, inclusive. If zero, 4194304 is used, like GnuPG does.
+	ChunkSize uint64
+}
+
+func (c *AEADConfig) mode() AEADMode {
+	if c.Mode == 0 {
+		return AEADModeOCB
+	}
+	return c.Mode
+}
+
+// chunkSizeByte returns the chunk size octet of RFC 9580, section 5.13.2,
+// for the configured chunk size.
+func (c *AEADConfig) chunkSizeByte() (byte, error) {
+	if c.ChunkSize == 0 {
+		return maxChunkSizeByte, nil
+	}
+	for b := byte(0); b <= maxChunkSizeByte; b++ {
+		if c.ChunkSize == 1<<(b+6) {
+			return b, nil
+		}
+	}
+	return 0, errors.InvalidArgumentError("AEAD chunk size " + strconv.FormatUint(c.ChunkSize, 10))
+}
+
+// new returns a cipher.AEAD for mode using the given block cipher.
+func (mode AEADMode) new(block cipher.Block) (cipher.AEAD, error) {
+	switch mode {
+	case AEADModeEAX:
+		return newEAX(block)
+	case AEADModeOCB:
+		return newOCB(block, mode.NonceLength())
+	case AEADModeGCM:
+		return cipher.NewGCM(block)
+	}
+	return nil, errors.UnsupportedError("AEAD mode " + strconv.Itoa(int(mode)))
+}
+
+// deriveAEADKey derives key material for AEAD encryption from ikm using
+// HKDF-SHA256, as used by RFC 9580, sections 5.3.2, 5.5.3 and 5.13.2.
+func deriveAEADKey(ikm, salt, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
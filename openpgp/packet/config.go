@@ -6,9 +6,12 @@ package packet
 
 import (
 	"crypto"
+	"crypto/elliptic"
 	"crypto/rand"
 	"io"
 	"time"
+
+	"github.com/gitpod-io/golang-crypto/openpgp/s2k"
 )
 
 // Config collects a number of parameters along with sensible defaults.
@@ -43,9 +46,44 @@ type Config struct {
 	// use a value that is at least 65536. See RFC 4880 Section
 	// 3.7.1.3.
 	S2KCount int
+	// Argon2, if not nil, selects the Argon2 S2K function of RFC 9580,
+	// section 3.7.1.4, for symmetric encryption instead of the iterated
+	// and salted function configured with S2KCount. Not all
+	// implementations of OpenPGP support it.
+	Argon2 *s2k.Argon2Config
+	// AEAD, if not nil, makes symmetric encryption with a passphrase use
+	// the AEAD encryption of RFC 9580: version 2 SymmetricallyEncrypted
+	// packets, section 5.13.2, preceded by version 6 SymmetricKeyEncrypted
+	// packets, section 5.3.2. Otherwise, messages are encrypted with CFB
+	// and protected by an MDC. Not all implementations of OpenPGP support
+	// it. Encryption to public keys always uses the MDC, as it would need
+	// version 6 EncryptedKey packets, which are not supported.
+	AEAD *AEADConfig
 	// RSABits is the number of bits in new RSA keys made with NewEntity.
 	// If zero, then 2048 bit keys are created.
 	RSABits int
+	// Algorithm is the public key algorithm of new keys made with
+	// NewEntity and the Entity methods that add subkeys: PubKeyAlgoRSA,
+	// PubKeyAlgoEd25519 or PubKeyAlgoECDSA. Encryption subkeys use the
+	// matching encryption algorithm: RSA, X25519 for Ed25519, and ECDH for
+	// ECDSA. If zero, RSA is used.
+	Algorithm PublicKeyAlgorithm
+	// Curve is the elliptic curve of new ECDSA and ECDH keys: P-256,
+	// P-384 or P-521 from crypto/elliptic. If nil, P-256 is used.
+	Curve elliptic.Curve
+	// KeyLifetimeSecs is the number of seconds after their creation that
+	// new keys made with NewEntity and the Entity methods that add subkeys
+	// expire. If zero, the keys don't expire.
+	KeyLifetimeSecs uint32
+	// SigLifetimeSecs is the number of seconds after their creation that
+	// new message signatures, such as those made by DetachSign, expire. If
+	// zero, the signatures don't expire.
+	SigLifetimeSecs uint32
+	// IssuerFingerprint, if true, makes new message signatures identify
+	// the signing key by its fingerprint, with the issuer fingerprint
+	// subpacket of RFC 9580, section 5.2.3.35, in addition to its key ID.
+	// v6 signatures always do.
+	IssuerFingerprint bool
 }
 
 func (c *Config) Random() io.Reader {
@@ -89,3 +127,57 @@ func (c *Config) PasswordHashIterations() int {
 	}
 	return c.S2KCount
 }
+
+// PublicKeyAlgorithm returns the algorithm of new keys.
+func (c *Config) PublicKeyAlgorithm() PublicKeyAlgorithm {
+	if c == nil || c.Algorithm == 0 {
+		return PubKeyAlgoRSA
+	}
+	return c.Algorithm
+}
+
+// EllipticCurve returns the curve of new ECDSA and ECDH keys.
+func (c *Config) EllipticCurve() elliptic.Curve {
+	if c == nil || c.Curve == nil {
+		return elliptic.P256()
+	}
+	return c.Curve
+}
+
+// KeyLifetime returns the lifetime of new keys, in seconds, or zero if
+// they don't expire.
+func (c *Config) KeyLifetime() uint32 {
+	if c == nil {
+		return 0
+	}
+	return c.KeyLifetimeSecs
+}
+
+func (c *Config) argon2() *s2k.Argon2Config {
+	if c == nil {
+		return nil
+	}
+	return c.Argon2
+}
+
+func (c *Config) aead() *AEADConfig {
+	if c == nil {
+		return nil
+	}
+	return c.AEAD
+}
+
+// SigLifetime returns the lifetime of new message signatures, in seconds,
+// or zero if they don't expire.
+func (c *Config) SigLifetime() uint32 {
+	if c == nil {
+		return 0
+	}
+	return c.SigLifetimeSecs
+}
+
+// UseIssuerFingerprint reports whether new message signatures include
+// the fingerprint of the signing key.
+func (c *Config) UseIssuerFingerprint() bool {
+	return c != nil && c.IssuerFingerprint
+}
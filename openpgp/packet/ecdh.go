@@ -0,0 +1,187 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/hkdf"
+	"github.com/gitpod-io/golang-crypto/openpgp/errors"
+	"github.com/gitpod-io/golang-crypto/openpgp/s2k"
+)
+
+// NewECDHPublicKey returns a PublicKey for the ECDH algorithm of RFC 6637
+// that wraps the given key, which must be on one of the NIST curves P-256,
+// P-384 or P-521. The key derivation parameters are those recommended for
+// the curve by RFC 6637.
+func NewECDHPublicKey(creationTime time.Time, pub *ecdsa.PublicKey) *PublicKey {
+	pk := newECPublicKey(creationTime, PubKeyAlgoECDH, pub)
+	hash, cipher := crypto.SHA512, CipherAES256
+	switch pub.Curve {
+	case elliptic.P256():
+		hash, cipher = crypto.SHA256, CipherAES128
+	case elliptic.P384():
+		hash, cipher = crypto.SHA384, CipherAES192
+	}
+	hashId, _ := s2k.HashToHashId(hash)
+	pk.ecdh = &ecdhKdf{KdfHash: kdfHashFunction(hashId), KdfAlgo: kdfAlgorithm(cipher)}
+
+	pk.setFingerPrintAndKeyId()
+	return pk
+}
+
+// ecdhKEK derives the key encryption key of an ECDH key from the shared
+// secret z, as specified in RFC 6637, Section 7.
+func ecdhKEK(pub *PublicKey, z []byte) ([]byte, error) {
+	hash, ok := s2k.HashIdToHash(byte(pub.ecdh.KdfHash))
+	if !ok || !hash.Available() {
+		return nil, errors.UnsupportedError("ECDH KDF hash: " + strconv.Itoa(int(pub.ecdh.KdfHash)))
+	}
+	cipher := CipherFunction(pub.ecdh.KdfAlgo)
+	switch cipher {
+	case CipherAES128, CipherAES192, CipherAES256:
+	default:
+		return nil, errors.UnsupportedError("ECDH key wrap cipher: " + strconv.Itoa(int(cipher)))
+	}
+	if hash.Size() < cipher.KeySize() {
+		return nil, errors.UnsupportedError("ECDH KDF hash too short for the key wrap cipher")
+	}
+
+	// The parameters of RFC 6637, Section 8.
+	var param bytes.Buffer
+	param.WriteByte(byte(len(pub.ec.oid)))
+	param.Write(pub.ec.oid)
+	param.WriteByte(byte(PubKeyAlgoECDH))
+	pub.ecdh.serialize(&param)
+	param.WriteString("Anonymous Sender    ")
+	param.Write(pub.Fingerprint[:])
+
+	h := hash.New()
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write(z)
+	h.Write(param.Bytes())
+	return h.Sum(nil)[:cipher.KeySize()], nil
+}
+
+// ecdhEncrypt encrypts keyBlock to the ECDH key pub, and returns the
+// encoded ephemeral public key and the wrapped key block.
+func ecdhEncrypt(rand io.Reader, pub *PublicKey, keyBlock []byte) (ephemeral, wrapped []byte, err error) {
+	recipient, err := pub.PublicKey.(*ecdsa.PublicKey).ECDH()
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := recipient.Curve().GenerateKey(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	z, err := priv.ECDH(recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	kek, err := ecdhKEK(pub, z)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Pad to a multiple of 8 bytes as in PKCS #5, see RFC 6637, Section 8.
+	padding := 8 - len(keyBlock)%8
+	padded := append(append([]byte{}, keyBlock...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	if wrapped, err = aesKeyWrap(kek, padded); err != nil {
+		return nil, nil, err
+	}
+	return priv.PublicKey().Bytes(), wrapped, nil
+}
+
+// ecdhDecrypt reverses ecdhEncrypt with the ECDH private key priv.
+func ecdhDecrypt(priv *PrivateKey, ephemeral, wrapped []byte) ([]byte, error) {
+	ecPriv, ok := priv.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.InvalidArgumentError("ECDH private key is not an *ecdsa.PrivateKey")
+	}
+	k, err := ecPriv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	eph, err := k.Curve().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, errors.StructuralError("invalid ECDH ephemeral key: " + err.Error())
+	}
+	z, err := k.ECDH(eph)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := ecdhKEK(&priv.PublicKey, z)
+	if err != nil {
+		return nil, err
+	}
+	m, err := aesKeyUnwrap(kek, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	// Other implementations pad to larger sizes than 8 bytes, so accept
+	// any padding that leaves room for the cipher and the checksum.
+	padding := int(m[len(m)-1])
+	if padding == 0 || padding > len(m)-3 ||
+		subtle.ConstantTimeCompare(m[len(m)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) != 1 {
+		return nil, errors.StructuralError("invalid ECDH key block padding")
+	}
+	return m[:len(m)-padding], nil
+}
+
+// x25519KEK derives the key encryption key of the X25519 algorithm, as
+// specified in RFC 9580, Section 5.1.6.
+func x25519KEK(ephemeral, recipient, shared []byte) []byte {
+	ikm := make([]byte, 0, len(ephemeral)+len(recipient)+len(shared))
+	ikm = append(append(append(ikm, ephemeral...), recipient...), shared...)
+	kek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, nil, []byte("OpenPGP X25519")), kek); err != nil {
+		panic("openpgp: internal error: HKDF failed: " + err.Error())
+	}
+	return kek
+}
+
+// x25519Encrypt encrypts the session key key to the X25519 key pub, and
+// returns the ephemeral public key and the wrapped session key.
+func x25519Encrypt(rand io.Reader, pub *PublicKey, key []byte) (ephemeral, wrapped []byte, err error) {
+	recipient := pub.PublicKey.(*ecdh.PublicKey)
+	priv, err := ecdh.X25519().GenerateKey(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := priv.ECDH(recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeral = priv.PublicKey().Bytes()
+	if wrapped, err = aesKeyWrap(x25519KEK(ephemeral, recipient.Bytes(), shared), key); err != nil {
+		return nil, nil, err
+	}
+	return ephemeral, wrapped, nil
+}
+
+// x25519Decrypt reverses x25519Encrypt with the X25519 private key priv.
+func x25519Decrypt(priv *PrivateKey, ephemeral, wrapped []byte) ([]byte, error) {
+	k, ok := priv.PrivateKey.(*ecdh.PrivateKey)
+	if !ok {
+		return nil, errors.InvalidArgumentError("X25519 private key is not an *ecdh.PrivateKey")
+	}
+	eph, err := ecdh.X25519().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, errors.StructuralError("invalid X25519 ephemeral key: " + err.Error())
+	}
+	shared, err := k.ECDH(eph)
+	if err != nil {
+		return nil, err
+	}
+	return aesKeyUnwrap(x25519KEK(ephemeral, k.PublicKey().Bytes(), shared), wrapped)
+}
@@ -27,6 +27,14 @@ type EncryptedKey struct {
 	Key        []byte         // only valid after a successful Decrypt
 
 	encryptedMPI1, encryptedMPI2 parsedMPI
+
+	// encryptedSession is the wrapped session key of the ECDH and X25519
+	// algorithms. For X25519, it starts with the cipher of the session key,
+	// which isn't encrypted. See RFC 9580, sections 5.1.4 and 5.1.6.
+	encryptedSession []byte
+	// ephemeral is the ephemeral public key of the X25519 algorithm. For
+	// ECDH, it is encryptedMPI1.
+	ephemeral []byte
 }
 
 func (e *EncryptedKey) parse(r io.Reader) (err error) {
@@ -55,11 +63,43 @@ func (e *EncryptedKey) parse(r io.Reader) (err error) {
 		if err != nil {
 			return
 		}
+	case PubKeyAlgoECDH:
+		e.encryptedMPI1.bytes, e.encryptedMPI1.bitLength, err = readMPI(r)
+		if err != nil {
+			return
+		}
+		if e.encryptedSession, err = readSizedField(r); err != nil {
+			return
+		}
+	case PubKeyAlgoX25519:
+		e.ephemeral = make([]byte, 32)
+		if _, err = readFull(r, e.ephemeral); err != nil {
+			return
+		}
+		if e.encryptedSession, err = readSizedField(r); err != nil {
+			return
+		}
+		if len(e.encryptedSession) == 0 {
+			return errors.StructuralError("X25519 encrypted key without cipher")
+		}
 	}
 	_, err = consumeAll(r)
 	return
 }
 
+// readSizedField reads a field preceded by its one-octet size.
+func readSizedField(r io.Reader) ([]byte, error) {
+	var size [1]byte
+	if _, err := readFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	field := make([]byte, size[0])
+	if _, err := readFull(r, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
 func checksumKeyMaterial(key []byte) uint16 {
 	var checksum uint16
 	for _, v := range key {
@@ -80,12 +120,34 @@ func (e *EncryptedKey) Decrypt(priv *PrivateKey, config *Config) error {
 	switch priv.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSAEncryptOnly:
 		// Supports both *rsa.PrivateKey and crypto.Decrypter
-		k := priv.PrivateKey.(crypto.Decrypter)
-		b, err = k.Decrypt(config.Random(), padToKeySize(k.Public().(*rsa.PublicKey), e.encryptedMPI1.bytes), nil)
+		k, ok := priv.PrivateKey.(crypto.Decrypter)
+		if !ok {
+			return errors.InvalidArgumentError("private key does not implement crypto.Decrypter")
+		}
+		pub, ok := k.Public().(*rsa.PublicKey)
+		if !ok {
+			return errors.InvalidArgumentError("crypto.Decrypter does not implement RSA")
+		}
+		b, err = k.Decrypt(config.Random(), padToKeySize(pub, e.encryptedMPI1.bytes), &rsa.PKCS1v15DecryptOptions{})
 	case PubKeyAlgoElGamal:
 		c1 := new(big.Int).SetBytes(e.encryptedMPI1.bytes)
 		c2 := new(big.Int).SetBytes(e.encryptedMPI2.bytes)
 		b, err = elgamal.Decrypt(priv.PrivateKey.(*elgamal.PrivateKey), c1, c2)
+	case PubKeyAlgoECDH:
+		b, err = ecdhDecrypt(priv, e.encryptedMPI1.bytes, e.encryptedSession)
+	case PubKeyAlgoX25519:
+		// The session key is neither prefixed by its cipher nor
+		// checksummed.
+		if e.encryptedSession == nil {
+			return errors.InvalidArgumentError("EncryptedKey is not an X25519 encrypted key")
+		}
+		key, err := x25519Decrypt(priv, e.ephemeral, e.encryptedSession[1:])
+		if err != nil {
+			return err
+		}
+		e.CipherFunc = CipherFunction(e.encryptedSession[0])
+		e.Key = key
+		return nil
 	default:
 		err = errors.InvalidArgumentError("cannot decrypted encrypted session key with private key of type " + strconv.Itoa(int(priv.PubKeyAlgo)))
 	}
@@ -93,6 +155,9 @@ func (e *EncryptedKey) Decrypt(priv *PrivateKey, config *Config) error {
 	if err != nil {
 		return err
 	}
+	if len(b) < 3 {
+		return errors.StructuralError("EncryptedKey too short")
+	}
 
 	e.CipherFunc = CipherFunction(b[0])
 	e.Key = b[1 : len(b)-2]
@@ -113,6 +178,10 @@ func (e *EncryptedKey) Serialize(w io.Writer) error {
 		mpiLen = 2 + len(e.encryptedMPI1.bytes)
 	case PubKeyAlgoElGamal:
 		mpiLen = 2 + len(e.encryptedMPI1.bytes) + 2 + len(e.encryptedMPI2.bytes)
+	case PubKeyAlgoECDH:
+		mpiLen = 2 + len(e.encryptedMPI1.bytes) + 1 + len(e.encryptedSession)
+	case PubKeyAlgoX25519:
+		mpiLen = len(e.ephemeral) + 1 + len(e.encryptedSession)
 	default:
 		return errors.InvalidArgumentError("don't know how to serialize encrypted key type " + strconv.Itoa(int(e.Algo)))
 	}
@@ -128,6 +197,14 @@ func (e *EncryptedKey) Serialize(w io.Writer) error {
 		writeMPIs(w, e.encryptedMPI1)
 	case PubKeyAlgoElGamal:
 		writeMPIs(w, e.encryptedMPI1, e.encryptedMPI2)
+	case PubKeyAlgoECDH:
+		writeMPIs(w, e.encryptedMPI1)
+		w.Write([]byte{byte(len(e.encryptedSession))})
+		w.Write(e.encryptedSession)
+	case PubKeyAlgoX25519:
+		w.Write(e.ephemeral)
+		w.Write([]byte{byte(len(e.encryptedSession))})
+		w.Write(e.encryptedSession)
 	default:
 		panic("internal error")
 	}
@@ -156,6 +233,10 @@ func SerializeEncryptedKey(w io.Writer, pub *PublicKey, cipherFunc CipherFunctio
 		return serializeEncryptedKeyRSA(w, config.Random(), buf, pub.PublicKey.(*rsa.PublicKey), keyBlock)
 	case PubKeyAlgoElGamal:
 		return serializeEncryptedKeyElGamal(w, config.Random(), buf, pub.PublicKey.(*elgamal.PublicKey), keyBlock)
+	case PubKeyAlgoECDH:
+		return serializeEncryptedKeyECDH(w, config.Random(), buf, pub, keyBlock)
+	case PubKeyAlgoX25519:
+		return serializeEncryptedKeyX25519(w, config.Random(), buf, pub, cipherFunc, key)
 	case PubKeyAlgoDSA, PubKeyAlgoRSASignOnly:
 		return errors.InvalidArgumentError("cannot encrypt to public key of type " + strconv.Itoa(int(pub.PubKeyAlgo)))
 	}
@@ -206,3 +287,56 @@ func serializeEncryptedKeyElGamal(w io.Writer, rand io.Reader, header [10]byte,
 	}
 	return writeBig(w, c2)
 }
+
+func serializeEncryptedKeyECDH(w io.Writer, rand io.Reader, header [10]byte, pub *PublicKey, keyBlock []byte) error {
+	ephemeral, wrapped, err := ecdhEncrypt(rand, pub, keyBlock)
+	if err != nil {
+		return errors.InvalidArgumentError("ECDH encryption failed: " + err.Error())
+	}
+
+	packetLen := 10 /* header length */
+	packetLen += 2 /* mpi size */ + len(ephemeral)
+	packetLen += 1 /* wrapped key size */ + len(wrapped)
+
+	err = serializeHeader(w, packetTypeEncryptedKey, packetLen)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(header[:])
+	if err != nil {
+		return err
+	}
+	// The ephemeral key starts with the 0x04 of uncompressed points.
+	err = writeMPI(w, 8*uint16(len(ephemeral))-5, ephemeral)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append([]byte{byte(len(wrapped))}, wrapped...))
+	return err
+}
+
+func serializeEncryptedKeyX25519(w io.Writer, rand io.Reader, header [10]byte, pub *PublicKey, cipherFunc CipherFunction, key []byte) error {
+	ephemeral, wrapped, err := x25519Encrypt(rand, pub, key)
+	if err != nil {
+		return errors.InvalidArgumentError("X25519 encryption failed: " + err.Error())
+	}
+
+	packetLen := 10 /* header length */
+	packetLen += len(ephemeral)
+	packetLen += 1 /* size */ + 1 /* cipher */ + len(wrapped)
+
+	err = serializeHeader(w, packetTypeEncryptedKey, packetLen)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(header[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(ephemeral)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append([]byte{byte(1 + len(wrapped)), byte(cipherFunc)}, wrapped...))
+	return err
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from RFC 3394, Section 4.
+var keyWrapTests = []struct {
+	kek, plaintext, ciphertext string
+}{
+	{
+		"000102030405060708090A0B0C0D0E0F",
+		"00112233445566778899AABBCCDDEEFF",
+		"1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F1011121314151617",
+		"00112233445566778899AABBCCDDEEFF",
+		"96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		"00112233445566778899AABBCCDDEEFF0001020304050607",
+		"A8F9BC1612C68B3FF6E6F4FBE30E71E4769C8B80A32CB8958CD5D17D6B254DA1",
+	},
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	for i, test := range keyWrapTests {
+		kek, _ := hex.DecodeString(test.kek)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		wrapped, err := aesKeyWrap(kek, plaintext)
+		if err != nil {
+			t.Errorf("#%d: aesKeyWrap: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(wrapped, ciphertext) {
+			t.Errorf("#%d: got %x, want %x", i, wrapped, ciphertext)
+		}
+		unwrapped, err := aesKeyUnwrap(kek, ciphertext)
+		if err != nil {
+			t.Errorf("#%d: aesKeyUnwrap: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(unwrapped, plaintext) {
+			t.Errorf("#%d: unwrapped %x, want %x", i, unwrapped, plaintext)
+		}
+
+		ciphertext[len(ciphertext)-1] ^= 1
+		if _, err := aesKeyUnwrap(kek, ciphertext); err == nil {
+			t.Errorf("#%d: corrupted ciphertext unwrapped", i)
+		}
+	}
+}
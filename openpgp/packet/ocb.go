@@ -0,0 +1,282 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"math/bits"
+)
+
+// This file implements the OCB and EAX modes of RFC 9580, section 9.6, for
+// 128-bit block ciphers and 16-byte tags.
+
+// double multiplies b by x in GF(2^128), as defined in RFC 7253, section 2.
+func double(b [16]byte) [16]byte {
+	var out [16]byte
+	carry := b[0] >> 7
+	for i := 0; i < 15; i++ {
+		out[i] = b[i]<<1 | b[i+1]>>7
+	}
+	out[15] = b[15]<<1 ^ 0x87*carry
+	return out
+}
+
+func xorBlock(dst, a, b []byte) {
+	subtle.XORBytes(dst[:16], a[:16], b[:16])
+}
+
+// ocb implements OCB3 as specified in RFC 7253.
+type ocb struct {
+	block     cipher.Block
+	nonceSize int
+
+	lStar, lDollar [16]byte
+	// l holds L_i for i < 64, enough for any block counter.
+	l [64][16]byte
+}
+
+func newOCB(block cipher.Block, nonceSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.New("openpgp: OCB requires a 128-bit block cipher")
+	}
+	o := &ocb{block: block, nonceSize: nonceSize}
+	block.Encrypt(o.lStar[:], o.lStar[:])
+	o.lDollar = double(o.lStar)
+	o.l[0] = double(o.lDollar)
+	for i := 1; i < len(o.l); i++ {
+		o.l[i] = double(o.l[i-1])
+	}
+	return o, nil
+}
+
+func (o *ocb) NonceSize() int { return o.nonceSize }
+
+func (o *ocb) Overhead() int { return 16 }
+
+// initialOffset returns Offset_0 for nonce, with a 128-bit tag.
+func (o *ocb) initialOffset(nonce []byte) [16]byte {
+	var n [16]byte
+	copy(n[16-len(nonce):], nonce)
+	n[15-len(nonce)] |= 1
+	bottom := uint(n[15] & 63)
+	n[15] &^= 63
+
+	var stretch [24]byte
+	o.block.Encrypt(stretch[:16], n[:])
+	for i := 0; i < 8; i++ {
+		stretch[16+i] = stretch[i] ^ stretch[i+1]
+	}
+	var offset [16]byte
+	byteShift, bitShift := bottom/8, bottom%8
+	for i := range offset {
+		offset[i] = stretch[uint(i)+byteShift] << bitShift
+		if bitShift != 0 {
+			offset[i] |= stretch[uint(i)+byteShift+1] >> (8 - bitShift)
+		}
+	}
+	return offset
+}
+
+// hash computes HASH(K, A).
+func (o *ocb) hash(adata []byte) [16]byte {
+	var sum, offset, tmp [16]byte
+	for i := 1; len(adata) >= 16; i++ {
+		xorBlock(offset[:], offset[:], o.l[bits.TrailingZeros(uint(i))][:])
+		xorBlock(tmp[:], adata, offset[:])
+		o.block.Encrypt(tmp[:], tmp[:])
+		xorBlock(sum[:], sum[:], tmp[:])
+		adata = adata[16:]
+	}
+	if len(adata) > 0 {
+		xorBlock(offset[:], offset[:], o.lStar[:])
+		tmp = [16]byte{}
+		copy(tmp[:], adata)
+		tmp[len(adata)] = 0x80
+		xorBlock(tmp[:], tmp[:], offset[:])
+		o.block.Encrypt(tmp[:], tmp[:])
+		xorBlock(sum[:], sum[:], tmp[:])
+	}
+	return sum
+}
+
+// crypt encrypts or decrypts src into dst, which may overlap exactly, and
+// returns the tag.
+func (o *ocb) crypt(encrypt bool, dst, nonce, src, adata []byte) [16]byte {
+	if len(nonce) != o.nonceSize {
+		panic("openpgp: incorrect nonce length given to OCB")
+	}
+	offset := o.initialOffset(nonce)
+	var checksum, tmp [16]byte
+	for i := 1; len(src) >= 16; i++ {
+		xorBlock(offset[:], offset[:], o.l[bits.TrailingZeros(uint(i))][:])
+		if encrypt {
+			xorBlock(checksum[:], checksum[:], src)
+		}
+		xorBlock(tmp[:], src, offset[:])
+		if encrypt {
+			o.block.Encrypt(tmp[:], tmp[:])
+		} else {
+			o.block.Decrypt(tmp[:], tmp[:])
+		}
+		xorBlock(dst, tmp[:], offset[:])
+		if !encrypt {
+			xorBlock(checksum[:], checksum[:], dst)
+		}
+		src, dst = src[16:], dst[16:]
+	}
+	if len(src) > 0 {
+		xorBlock(offset[:], offset[:], o.lStar[:])
+		var pad [16]byte
+		o.block.Encrypt(pad[:], offset[:])
+		var p [16]byte
+		if encrypt {
+			copy(p[:], src)
+		}
+		subtle.XORBytes(dst, src, pad[:len(src)])
+		if !encrypt {
+			copy(p[:], dst[:len(src)])
+		}
+		p[len(src)] = 0x80
+		xorBlock(checksum[:], checksum[:], p[:])
+	}
+	xorBlock(tmp[:], checksum[:], offset[:])
+	xorBlock(tmp[:], tmp[:], o.lDollar[:])
+	o.block.Encrypt(tmp[:], tmp[:])
+	h := o.hash(adata)
+	xorBlock(tmp[:], tmp[:], h[:])
+	return tmp
+}
+
+func (o *ocb) Seal(dst, nonce, plaintext, adata []byte) []byte {
+	ret, out := sliceForAppend(dst, len(plaintext)+16)
+	tag := o.crypt(true, out, nonce, plaintext, adata)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (o *ocb) Open(dst, nonce, ciphertext, adata []byte) ([]byte, error) {
+	if len(ciphertext) < 16 {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-16:]
+	ciphertext = ciphertext[:len(ciphertext)-16]
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	expected := o.crypt(false, out, nonce, ciphertext, adata)
+	if subtle.ConstantTimeCompare(expected[:], tag) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+var errOpen = errors.New("openpgp: message authentication failed")
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// eax implements EAX as specified in "The EAX Mode of Operation" by
+// Bellare, Rogaway and Wagner.
+type eax struct {
+	block  cipher.Block
+	k1, k2 [16]byte
+}
+
+func newEAX(block cipher.Block) (cipher.AEAD, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.New("openpgp: EAX requires a 128-bit block cipher")
+	}
+	e := &eax{block: block}
+	block.Encrypt(e.k1[:], e.k1[:])
+	e.k1 = double(e.k1)
+	e.k2 = double(e.k1)
+	return e, nil
+}
+
+func (e *eax) NonceSize() int { return 16 }
+
+func (e *eax) Overhead() int { return 16 }
+
+// omac computes OMAC^t_K(data), that is CMAC_K([t]_16 || data).
+func (e *eax) omac(t byte, data []byte) [16]byte {
+	var mac [16]byte
+	mac[15] = t
+	if len(data) == 0 {
+		xorBlock(mac[:], mac[:], e.k1[:])
+		e.block.Encrypt(mac[:], mac[:])
+		return mac
+	}
+	e.block.Encrypt(mac[:], mac[:])
+	for len(data) > 16 {
+		xorBlock(mac[:], mac[:], data)
+		e.block.Encrypt(mac[:], mac[:])
+		data = data[16:]
+	}
+	var last [16]byte
+	copy(last[:], data)
+	if len(data) == 16 {
+		xorBlock(last[:], last[:], e.k1[:])
+	} else {
+		last[len(data)] = 0x80
+		xorBlock(last[:], last[:], e.k2[:])
+	}
+	xorBlock(mac[:], mac[:], last[:])
+	e.block.Encrypt(mac[:], mac[:])
+	return mac
+}
+
+func (e *eax) tag(n [16]byte, ciphertext, adata []byte) [16]byte {
+	h := e.omac(1, adata)
+	c := e.omac(2, ciphertext)
+	var tag [16]byte
+	xorBlock(tag[:], n[:], h[:])
+	xorBlock(tag[:], tag[:], c[:])
+	return tag
+}
+
+func (e *eax) Seal(dst, nonce, plaintext, adata []byte) []byte {
+	if len(nonce) != 16 {
+		panic("openpgp: incorrect nonce length given to EAX")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+16)
+	n := e.omac(0, nonce)
+	cipher.NewCTR(e.block, n[:]).XORKeyStream(out, plaintext)
+	tag := e.tag(n, out[:len(plaintext)], adata)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (e *eax) Open(dst, nonce, ciphertext, adata []byte) ([]byte, error) {
+	if len(nonce) != 16 {
+		panic("openpgp: incorrect nonce length given to EAX")
+	}
+	if len(ciphertext) < 16 {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-16:]
+	ciphertext = ciphertext[:len(ciphertext)-16]
+	n := e.omac(0, nonce)
+	expected := e.tag(n, ciphertext, adata)
+	if subtle.ConstantTimeCompare(expected[:], tag) != 1 {
+		return nil, errOpen
+	}
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	cipher.NewCTR(e.block, n[:]).XORKeyStream(out, ciphertext)
+	return ret, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// ocbTests are from RFC 7253, Appendix A.
+var ocbTests = []struct {
+	nonce, adata, plaintext, ciphertext string
+}{
+	{"BBAA99887766554433221100", "", "", "785407BFFFC8AD9EDCC5520AC9111EE6"},
+	{"BBAA99887766554433221101", "0001020304050607", "0001020304050607", "6820B3657B6F615A5725BDA0D3B4EB3A257C9AF1F8F03009"},
+	{"BBAA99887766554433221102", "0001020304050607", "", "81017F8203F081277152FADE694A0A00"},
+	{"BBAA99887766554433221103", "", "0001020304050607", "45DD69F8F5AAE72414054CD1F35D82760B2CD00D2F99BFA9"},
+	{"BBAA99887766554433221104", "000102030405060708090A0B0C0D0E0F", "000102030405060708090A0B0C0D0E0F", "571D535B60B277188BE5147170A9A22C3AD7A4FF3835B8C5701C1CCEC8FC3358"},
+}
+
+func TestOCB(t *testing.T) {
+	block, _ := aes.NewCipher(mustDecodeHex("000102030405060708090A0B0C0D0E0F"))
+	for i, test := range ocbTests {
+		nonce := mustDecodeHex(test.nonce)
+		aead, err := newOCB(block, len(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		testAEAD(t, i, aead, nonce, mustDecodeHex(test.adata), mustDecodeHex(test.plaintext), mustDecodeHex(test.ciphertext))
+	}
+}
+
+// TestOCBIterative runs the test of RFC 7253, Appendix A, which covers
+// many lengths of plaintext and associated data.
+func TestOCBIterative(t *testing.T) {
+	key := make([]byte, 16)
+	key[15] = 128
+	block, _ := aes.NewCipher(key)
+	aead, _ := newOCB(block, 12)
+	var c []byte
+	nonce := make([]byte, 12)
+	for i := 0; i < 128; i++ {
+		s := make([]byte, i)
+		for j, test := range []struct{ plaintext, adata []byte }{{s, s}, {s, nil}, {nil, s}} {
+			n := 3*i + j + 1
+			nonce[10], nonce[11] = byte(n>>8), byte(n)
+			c = aead.Seal(c, nonce, test.plaintext, test.adata)
+		}
+	}
+	nonce[10], nonce[11] = byte(385>>8), byte(385&0xff)
+	got := aead.Seal(nil, nonce, nil, c)
+	if want := mustDecodeHex("67E944D23256C5E0B6C61FA22FDF1EA2"); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+// eaxTests are from "The EAX Mode of Operation", Appendix E.
+var eaxTests = []struct {
+	key, nonce, adata, plaintext, ciphertext string
+}{
+	{"233952DEE4D5ED5F9B9C6D6FF80FF478", "62EC67F9C3A4A407FCB2A8C49031A8B3", "6BFB914FD07EAE6B", "", "E037830E8389F27B025A2D6527E79D01"},
+	{"91945D3F4DCBEE0BF45EF52255F095A4", "BECAF043B0A23D843194BA972C66DEBD", "FA3BFD4806EB53FA", "F7FB", "19DD5C4C9331049D0BDAB0277408F67967E5"},
+	{"01F74AD64077F2E704C0F60ADA3DD523", "70C3DB4F0D26368400A10ED05D2BFF5E", "234A3463C1264AC6", "1A47CB4933", "D851D5BAE03A59F238A23E39199DC9266626C40F80"},
+}
+
+func TestEAX(t *testing.T) {
+	for i, test := range eaxTests {
+		block, _ := aes.NewCipher(mustDecodeHex(test.key))
+		aead, err := newEAX(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testAEAD(t, i, aead, mustDecodeHex(test.nonce), mustDecodeHex(test.adata), mustDecodeHex(test.plaintext), mustDecodeHex(test.ciphertext))
+	}
+}
+
+func testAEAD(t *testing.T, i int, aead interface {
+	Seal(dst, nonce, plaintext, adata []byte) []byte
+	Open(dst, nonce, ciphertext, adata []byte) ([]byte, error)
+}, nonce, adata, plaintext, ciphertext []byte) {
+	if got := aead.Seal(nil, nonce, plaintext, adata); !bytes.Equal(got, ciphertext) {
+		t.Errorf("#%d: Seal got %x, want %x", i, got, ciphertext)
+	}
+	got, err := aead.Open(nil, nonce, ciphertext, adata)
+	if err != nil {
+		t.Errorf("#%d: Open failed: %s", i, err)
+	} else if !bytes.Equal(got, plaintext) {
+		t.Errorf("#%d: Open got %x, want %x", i, got, plaintext)
+	}
+	corrupt := append([]byte(nil), ciphertext...)
+	corrupt[len(corrupt)-1] ^= 1
+	if _, err := aead.Open(nil, nonce, corrupt, adata); err == nil {
+		t.Errorf("#%d: Open succeeded with a corrupted tag", i)
+	}
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -15,26 +15,40 @@ import (
 )
 
 // OnePassSignature represents a one-pass signature packet. See RFC 4880,
-// section 5.4.
+// section 5.4, and RFC 9580, section 5.4.
 type OnePassSignature struct {
+	// Version is the version of the packet: 3, or 6 for packets that
+	// precede v6 signatures. Zero means 3.
+	Version    int
 	SigType    SignatureType
 	Hash       crypto.Hash
 	PubKeyAlgo PublicKeyAlgorithm
 	KeyId      uint64
 	IsLast     bool
+
+	// The following fields are only set for version 6 packets.
+	Salt           []byte // the salt of the signature, to be hashed before the data.
+	KeyFingerprint []byte // the fingerprint of the signing key.
 }
 
-const onePassSignatureVersion = 3
+const (
+	onePassSignatureVersion   = 3
+	onePassSignatureVersionV6 = 6
+)
 
 func (ops *OnePassSignature) parse(r io.Reader) (err error) {
 	var buf [13]byte
 
-	_, err = readFull(r, buf[:])
+	_, err = readFull(r, buf[:4])
 	if err != nil {
 		return
 	}
-	if buf[0] != onePassSignatureVersion {
-		err = errors.UnsupportedError("one-pass-signature packet version " + strconv.Itoa(int(buf[0])))
+	switch buf[0] {
+	case onePassSignatureVersion:
+	case onePassSignatureVersionV6:
+		ops.Version = onePassSignatureVersionV6
+	default:
+		return errors.UnsupportedError("one-pass-signature packet version " + strconv.Itoa(int(buf[0])))
 	}
 
 	var ok bool
@@ -45,6 +59,33 @@ func (ops *OnePassSignature) parse(r io.Reader) (err error) {
 
 	ops.SigType = SignatureType(buf[1])
 	ops.PubKeyAlgo = PublicKeyAlgorithm(buf[3])
+
+	if ops.Version == onePassSignatureVersionV6 {
+		// RFC 9580, section 5.4: the salt and the fingerprint of the
+		// signing key take the place of the key id.
+		if _, err = readFull(r, buf[:1]); err != nil {
+			return
+		}
+		ops.Salt = make([]byte, buf[0])
+		if _, err = readFull(r, ops.Salt); err != nil {
+			return
+		}
+		ops.KeyFingerprint = make([]byte, 32)
+		if _, err = readFull(r, ops.KeyFingerprint); err != nil {
+			return
+		}
+		ops.KeyId = binary.BigEndian.Uint64(ops.KeyFingerprint[:8])
+		if _, err = readFull(r, buf[:1]); err != nil {
+			return
+		}
+		ops.IsLast = buf[0] != 0
+		return
+	}
+
+	_, err = readFull(r, buf[4:])
+	if err != nil {
+		return
+	}
 	ops.KeyId = binary.BigEndian.Uint64(buf[4:12])
 	ops.IsLast = buf[12] != 0
 	return
@@ -52,6 +93,10 @@ func (ops *OnePassSignature) parse(r io.Reader) (err error) {
 
 // Serialize marshals the given OnePassSignature to w.
 func (ops *OnePassSignature) Serialize(w io.Writer) error {
+	if ops.Version == onePassSignatureVersionV6 {
+		return ops.serializeV6(w)
+	}
+
 	var buf [13]byte
 	buf[0] = onePassSignatureVersion
 	buf[1] = uint8(ops.SigType)
@@ -72,3 +117,27 @@ func (ops *OnePassSignature) Serialize(w io.Writer) error {
 	_, err := w.Write(buf[:])
 	return err
 }
+
+func (ops *OnePassSignature) serializeV6(w io.Writer) error {
+	if len(ops.KeyFingerprint) != 32 {
+		return errors.InvalidArgumentError("one-pass-signature needs a v6 key fingerprint")
+	}
+	hashId, ok := s2k.HashToHashId(ops.Hash)
+	if !ok {
+		return errors.UnsupportedError("hash type: " + strconv.Itoa(int(ops.Hash)))
+	}
+	buf := []byte{onePassSignatureVersionV6, uint8(ops.SigType), hashId, uint8(ops.PubKeyAlgo), byte(len(ops.Salt))}
+	buf = append(buf, ops.Salt...)
+	buf = append(buf, ops.KeyFingerprint...)
+	if ops.IsLast {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+
+	if err := serializeHeader(w, packetTypeOnePassSignature, len(buf)); err != nil {
+		return err
+	}
+	_, err := w.Write(buf)
+	return err
+}
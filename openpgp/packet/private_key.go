@@ -9,7 +9,9 @@ import (
 	"crypto"
 	"crypto/cipher"
 	"crypto/dsa"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha1"
 	"io"
@@ -23,18 +25,29 @@ import (
 )
 
 // PrivateKey represents a possibly encrypted private key. See RFC 4880,
-// section 5.5.3.
+// section 5.5.3, and RFC 9580, section 5.5.3.
 type PrivateKey struct {
 	PublicKey
 	Encrypted     bool // if true then the private key is unavailable until Decrypt has been called.
 	encryptedData []byte
 	cipher        CipherFunction
 	s2k           func(out, in []byte)
-	PrivateKey    interface{} // An *{rsa|dsa|ecdsa}.PrivateKey or crypto.Signer/crypto.Decrypter (Decryptor RSA only).
+	PrivateKey    interface{} // An *{rsa|dsa|ecdsa}.PrivateKey, ed25519.PrivateKey, *ecdh.PrivateKey or crypto.Signer/crypto.Decrypter (Decryptor RSA only).
 	sha1Checksum  bool
 	iv            []byte
+	// aead is the mode protecting the key material when the S2K usage
+	// octet is 253. See RFC 9580, section 5.5.3.
+	aead AEADMode
 }
 
+// S2K usage octets, see RFC 9580, section 3.7.2.1.
+const (
+	s2kUsageNone     = 0
+	s2kUsageAEAD     = 253
+	s2kUsageCFB      = 254
+	s2kUsageChecksum = 255
+)
+
 func NewRSAPrivateKey(creationTime time.Time, priv *rsa.PrivateKey) *PrivateKey {
 	pk := new(PrivateKey)
 	pk.PublicKey = *NewRSAPublicKey(creationTime, &priv.PublicKey)
@@ -63,8 +76,37 @@ func NewECDSAPrivateKey(creationTime time.Time, priv *ecdsa.PrivateKey) *Private
 	return pk
 }
 
+// NewEd25519PrivateKey returns a PrivateKey, with a v4 public key, that
+// wraps the given ed25519.PrivateKey.
+func NewEd25519PrivateKey(creationTime time.Time, priv ed25519.PrivateKey) *PrivateKey {
+	pk := new(PrivateKey)
+	pk.PublicKey = *NewEd25519PublicKey(creationTime, priv.Public().(ed25519.PublicKey))
+	pk.PrivateKey = priv
+	return pk
+}
+
+// NewX25519PrivateKey returns a PrivateKey, with a v4 public key, that wraps
+// the given X25519 key.
+func NewX25519PrivateKey(creationTime time.Time, priv *ecdh.PrivateKey) *PrivateKey {
+	pk := new(PrivateKey)
+	pk.PublicKey = *NewX25519PublicKey(creationTime, priv.PublicKey())
+	pk.PrivateKey = priv
+	return pk
+}
+
+// NewECDHPrivateKey returns a PrivateKey for the ECDH algorithm of RFC 6637
+// that wraps the given key, which must be on one of the NIST curves P-256,
+// P-384 or P-521. The key derivation parameters are those recommended for
+// the curve by RFC 6637.
+func NewECDHPrivateKey(creationTime time.Time, priv *ecdsa.PrivateKey) *PrivateKey {
+	pk := new(PrivateKey)
+	pk.PublicKey = *NewECDHPublicKey(creationTime, &priv.PublicKey)
+	pk.PrivateKey = priv
+	return pk
+}
+
 // NewSignerPrivateKey creates a PrivateKey from a crypto.Signer that
-// implements RSA or ECDSA.
+// implements RSA, ECDSA or Ed25519.
 func NewSignerPrivateKey(creationTime time.Time, signer crypto.Signer) *PrivateKey {
 	pk := new(PrivateKey)
 	// In general, the public Keys should be used as pointers. We still
@@ -78,6 +120,8 @@ func NewSignerPrivateKey(creationTime time.Time, signer crypto.Signer) *PrivateK
 		pk.PublicKey = *NewECDSAPublicKey(creationTime, pubkey)
 	case ecdsa.PublicKey:
 		pk.PublicKey = *NewECDSAPublicKey(creationTime, &pubkey)
+	case ed25519.PublicKey:
+		pk.PublicKey = *NewEd25519PublicKey(creationTime, pubkey)
 	default:
 		panic("openpgp: unknown crypto.Signer type in NewSignerPrivateKey")
 	}
@@ -85,6 +129,23 @@ func NewSignerPrivateKey(creationTime time.Time, signer crypto.Signer) *PrivateK
 	return pk
 }
 
+// NewDecrypterPrivateKey creates a PrivateKey from a crypto.Decrypter that
+// implements RSA, such as a key held by a hardware token. Its Decrypt method
+// is called with *rsa.PKCS1v15DecryptOptions.
+func NewDecrypterPrivateKey(creationTime time.Time, decrypter crypto.Decrypter) *PrivateKey {
+	pk := new(PrivateKey)
+	switch pubkey := decrypter.Public().(type) {
+	case *rsa.PublicKey:
+		pk.PublicKey = *NewRSAPublicKey(creationTime, pubkey)
+	case rsa.PublicKey:
+		pk.PublicKey = *NewRSAPublicKey(creationTime, &pubkey)
+	default:
+		panic("openpgp: unknown crypto.Decrypter type in NewDecrypterPrivateKey")
+	}
+	pk.PrivateKey = decrypter
+	return pk
+}
+
 func (pk *PrivateKey) parse(r io.Reader) (err error) {
 	err = (&pk.PublicKey).parse(r)
 	if err != nil {
@@ -98,22 +159,55 @@ func (pk *PrivateKey) parse(r io.Reader) (err error) {
 
 	s2kType := buf[0]
 
+	// v6 keys give the length of the fields that describe the encryption
+	// so that keys using unknown methods can be skipped.
+	fields := r
+	var fieldsReader *bytes.Reader
+	if pk.isV6() && s2kType != s2kUsageNone {
+		if _, err = readFull(r, buf[:]); err != nil {
+			return
+		}
+		fieldsBytes := make([]byte, buf[0])
+		if _, err = readFull(r, fieldsBytes); err != nil {
+			return
+		}
+		fieldsReader = bytes.NewReader(fieldsBytes)
+		fields = fieldsReader
+	}
+
 	switch s2kType {
-	case 0:
+	case s2kUsageNone:
 		pk.s2k = nil
 		pk.Encrypted = false
-	case 254, 255:
-		_, err = readFull(r, buf[:])
+	case s2kUsageAEAD, s2kUsageCFB, s2kUsageChecksum:
+		if pk.isV6() && s2kType == s2kUsageChecksum {
+			return errors.StructuralError("v6 private key with malleable s2k usage")
+		}
+		_, err = readFull(fields, buf[:])
 		if err != nil {
 			return
 		}
 		pk.cipher = CipherFunction(buf[0])
 		pk.Encrypted = true
-		pk.s2k, err = s2k.Parse(r)
+		if s2kType == s2kUsageAEAD {
+			if _, err = readFull(fields, buf[:]); err != nil {
+				return
+			}
+			pk.aead = AEADMode(buf[0])
+		}
+		s2kFields := fields
+		if pk.isV6() {
+			// The S2K specifier is preceded by its length.
+			if _, err = readFull(fields, buf[:]); err != nil {
+				return
+			}
+			s2kFields = io.LimitReader(fields, int64(buf[0]))
+		}
+		pk.s2k, err = s2k.Parse(s2kFields)
 		if err != nil {
 			return
 		}
-		if s2kType == 254 {
+		if s2kType == s2kUsageCFB {
 			pk.sha1Checksum = true
 		}
 	default:
@@ -125,12 +219,22 @@ func (pk *PrivateKey) parse(r io.Reader) (err error) {
 		if blockSize == 0 {
 			return errors.UnsupportedError("unsupported cipher in private key: " + strconv.Itoa(int(pk.cipher)))
 		}
-		pk.iv = make([]byte, blockSize)
-		_, err = readFull(r, pk.iv)
+		ivSize := blockSize
+		if s2kType == s2kUsageAEAD {
+			ivSize = pk.aead.NonceLength()
+			if ivSize == 0 {
+				return errors.UnsupportedError("unsupported AEAD mode in private key: " + strconv.Itoa(int(pk.aead)))
+			}
+		}
+		pk.iv = make([]byte, ivSize)
+		_, err = readFull(fields, pk.iv)
 		if err != nil {
 			return
 		}
 	}
+	if fieldsReader != nil && fieldsReader.Len() != 0 {
+		return errors.StructuralError("private key s2k fields length mismatch")
+	}
 
 	pk.encryptedData, err = io.ReadAll(r)
 	if err != nil {
@@ -159,7 +263,7 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 	if err != nil {
 		return
 	}
-	buf.WriteByte(0 /* no encryption */)
+	buf.WriteByte(s2kUsageNone)
 
 	privateKeyBuf := bytes.NewBuffer(nil)
 
@@ -172,6 +276,10 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 		err = serializeElGamalPrivateKey(privateKeyBuf, priv)
 	case *ecdsa.PrivateKey:
 		err = serializeECDSAPrivateKey(privateKeyBuf, priv)
+	case ed25519.PrivateKey:
+		_, err = privateKeyBuf.Write(priv.Seed())
+	case *ecdh.PrivateKey:
+		_, err = privateKeyBuf.Write(priv.Bytes())
 	default:
 		err = errors.InvalidArgumentError("unknown private key type")
 	}
@@ -185,7 +293,12 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 	if pk.IsSubkey {
 		ptype = packetTypePrivateSubkey
 	}
-	err = serializeHeader(w, ptype, len(contents)+len(privateKeyBytes)+2)
+	checksumLen := 2
+	if pk.isV6() {
+		// Unencrypted v6 keys have no checksum.
+		checksumLen = 0
+	}
+	err = serializeHeader(w, ptype, len(contents)+len(privateKeyBytes)+checksumLen)
 	if err != nil {
 		return
 	}
@@ -197,6 +310,9 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	if pk.isV6() {
+		return
+	}
 
 	checksum := mod64kHash(privateKeyBytes)
 	var checksumBytes [2]byte
@@ -243,6 +359,9 @@ func (pk *PrivateKey) Decrypt(passphrase []byte) error {
 
 	key := make([]byte, pk.cipher.KeySize())
 	pk.s2k(key, passphrase)
+	if pk.aead != 0 {
+		return pk.decryptAEAD(key)
+	}
 	block := pk.cipher.new(key)
 	cfb := cipher.NewCFBDecrypter(block, pk.iv)
 
@@ -278,6 +397,34 @@ func (pk *PrivateKey) Decrypt(passphrase []byte) error {
 	return pk.parsePrivateKey(data)
 }
 
+// decryptAEAD decrypts key material protected with S2K usage 253. See RFC
+// 9580, section 5.5.3.
+func (pk *PrivateKey) decryptAEAD(key []byte) error {
+	tag := byte(packetTypePrivateKey)
+	if pk.IsSubkey {
+		tag = byte(packetTypePrivateSubkey)
+	}
+	info := []byte{0xc0 | tag, byte(pk.version()), byte(pk.cipher), byte(pk.aead)}
+	kek, err := deriveAEADKey(key, nil, info, len(key))
+	if err != nil {
+		return err
+	}
+	aead, err := pk.aead.new(pk.cipher.new(kek))
+	if err != nil {
+		return err
+	}
+	// The associated data is the packet tag followed by the public key.
+	adata := bytes.NewBuffer([]byte{info[0]})
+	if err := pk.PublicKey.serializeWithoutHeaders(adata); err != nil {
+		return err
+	}
+	data, err := aead.Open(nil, pk.iv, pk.encryptedData, adata.Bytes())
+	if err != nil {
+		return errors.StructuralError("private key authentication failure")
+	}
+	return pk.parsePrivateKey(data)
+}
+
 func (pk *PrivateKey) parsePrivateKey(data []byte) (err error) {
 	switch pk.PublicKey.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly, PubKeyAlgoRSAEncryptOnly:
@@ -286,8 +433,13 @@ func (pk *PrivateKey) parsePrivateKey(data []byte) (err error) {
 		return pk.parseDSAPrivateKey(data)
 	case PubKeyAlgoElGamal:
 		return pk.parseElGamalPrivateKey(data)
-	case PubKeyAlgoECDSA:
+	case PubKeyAlgoECDSA, PubKeyAlgoECDH:
+		// ECDH keys are stored as ECDSA keys for convenience.
 		return pk.parseECDSAPrivateKey(data)
+	case PubKeyAlgoEd25519:
+		return pk.parseEd25519PrivateKey(data)
+	case PubKeyAlgoX25519:
+		return pk.parseX25519PrivateKey(data)
 	}
 	panic("impossible")
 }
@@ -382,3 +534,40 @@ func (pk *PrivateKey) parseECDSAPrivateKey(data []byte) (err error) {
 
 	return nil
 }
+
+func (pk *PrivateKey) parseEd25519PrivateKey(data []byte) (err error) {
+	ed25519Pub := pk.PublicKey.PublicKey.(ed25519.PublicKey)
+	if len(data) < ed25519.SeedSize {
+		return errors.StructuralError("truncated Ed25519 private key")
+	}
+
+	priv := ed25519.NewKeyFromSeed(data[:ed25519.SeedSize])
+	if !bytes.Equal(priv.Public().(ed25519.PublicKey), ed25519Pub) {
+		return errors.StructuralError("Ed25519 private key does not match public key")
+	}
+	pk.PrivateKey = priv
+	pk.Encrypted = false
+	pk.encryptedData = nil
+
+	return nil
+}
+
+func (pk *PrivateKey) parseX25519PrivateKey(data []byte) (err error) {
+	x25519Pub := pk.PublicKey.PublicKey.(*ecdh.PublicKey)
+	if len(data) < 32 {
+		return errors.StructuralError("truncated X25519 private key")
+	}
+
+	priv, err := ecdh.X25519().NewPrivateKey(data[:32])
+	if err != nil {
+		return err
+	}
+	if !priv.PublicKey().Equal(x25519Pub) {
+		return errors.StructuralError("X25519 private key does not match public key")
+	}
+	pk.PrivateKey = priv
+	pk.Encrypted = false
+	pk.encryptedData = nil
+
+	return nil
+}
@@ -8,11 +8,13 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/dsa"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha1"
-	_ "crypto/sha256"
+	"crypto/sha256"
 	_ "crypto/sha512"
 	"encoding/binary"
 	"fmt"
@@ -149,20 +151,35 @@ func (f *ecdhKdf) byteLen() int {
 	return 4
 }
 
-// PublicKey represents an OpenPGP public key. See RFC 4880, section 5.5.2.
+// PublicKey represents an OpenPGP public key. See RFC 4880, section 5.5.2,
+// and RFC 9580, section 5.5.2.
 type PublicKey struct {
+	// Version is the version of the key packet, 4 or 6. Zero means 4.
+	Version      int
 	CreationTime time.Time
 	PubKeyAlgo   PublicKeyAlgorithm
-	PublicKey    interface{} // *rsa.PublicKey, *dsa.PublicKey or *ecdsa.PublicKey
-	Fingerprint  [20]byte
-	KeyId        uint64
-	IsSubkey     bool
+	PublicKey    interface{} // *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey or *ecdh.PublicKey
+	// Fingerprint is the SHA-1 fingerprint of a v4 key. It is zero for
+	// v6 keys, which use FingerprintV6 instead.
+	Fingerprint [20]byte
+	// FingerprintV6 is the SHA-256 fingerprint of a v6 key.
+	FingerprintV6 [32]byte
+	KeyId         uint64
+	IsSubkey      bool
 
 	n, e, p, q, g, y parsedMPI
 
 	// RFC 6637 fields
 	ec   *ecdsaKey
 	ecdh *ecdhKdf
+
+	// native holds the public key of the X25519 and Ed25519 algorithms,
+	// which is not encoded as an MPI. See RFC 9580, section 5.5.5.
+	native []byte
+}
+
+func (pk *PublicKey) isV6() bool {
+	return pk.Version == 6
 }
 
 // signingKey provides a convenient abstraction over signature verification
@@ -225,9 +242,17 @@ func NewElGamalPublicKey(creationTime time.Time, pub *elgamal.PublicKey) *Public
 }
 
 func NewECDSAPublicKey(creationTime time.Time, pub *ecdsa.PublicKey) *PublicKey {
+	pk := newECPublicKey(creationTime, PubKeyAlgoECDSA, pub)
+	pk.setFingerPrintAndKeyId()
+	return pk
+}
+
+// newECPublicKey returns a PublicKey of the ECDSA or ECDH algorithm, without
+// its ECDH parameters, fingerprint and key ID.
+func newECPublicKey(creationTime time.Time, algo PublicKeyAlgorithm, pub *ecdsa.PublicKey) *PublicKey {
 	pk := &PublicKey{
 		CreationTime: creationTime,
-		PubKeyAlgo:   PubKeyAlgoECDSA,
+		PubKeyAlgo:   algo,
 		PublicKey:    pub,
 		ec:           new(ecdsaKey),
 	}
@@ -250,23 +275,65 @@ func NewECDSAPublicKey(creationTime time.Time, pub *ecdsa.PublicKey) *PublicKey
 	// nearest byte. See https://tools.ietf.org/html/rfc6637#section-6
 	fieldBytes := (pub.Curve.Params().BitSize + 7) & ^7
 	pk.ec.p.bitLength = uint16(3 + fieldBytes + fieldBytes)
+	return pk
+}
+
+// NewEd25519PublicKey returns a v4 PublicKey that wraps the given
+// ed25519.PublicKey, using the algorithm of RFC 9580, section 5.5.5.9.
+func NewEd25519PublicKey(creationTime time.Time, pub ed25519.PublicKey) *PublicKey {
+	pk := &PublicKey{
+		CreationTime: creationTime,
+		PubKeyAlgo:   PubKeyAlgoEd25519,
+		PublicKey:    pub,
+		native:       []byte(pub),
+	}
+
+	pk.setFingerPrintAndKeyId()
+	return pk
+}
+
+// NewX25519PublicKey returns a v4 PublicKey that wraps the given X25519
+// key, using the algorithm of RFC 9580, section 5.5.5.7.
+func NewX25519PublicKey(creationTime time.Time, pub *ecdh.PublicKey) *PublicKey {
+	if pub.Curve() != ecdh.X25519() {
+		panic("openpgp: NewX25519PublicKey called with a non-X25519 key")
+	}
+	pk := &PublicKey{
+		CreationTime: creationTime,
+		PubKeyAlgo:   PubKeyAlgoX25519,
+		PublicKey:    pub,
+		native:       pub.Bytes(),
+	}
 
 	pk.setFingerPrintAndKeyId()
 	return pk
 }
 
 func (pk *PublicKey) parse(r io.Reader) (err error) {
-	// RFC 4880, section 5.5.2
+	// RFC 4880, section 5.5.2, and RFC 9580, section 5.5.2.
 	var buf [6]byte
 	_, err = readFull(r, buf[:])
 	if err != nil {
 		return
 	}
-	if buf[0] != 4 {
-		return errors.UnsupportedError("public key version")
+	if buf[0] != 4 && buf[0] != 6 {
+		return errors.UnsupportedError("public key version " + strconv.Itoa(int(buf[0])))
 	}
+	pk.Version = int(buf[0])
 	pk.CreationTime = time.Unix(int64(uint32(buf[1])<<24|uint32(buf[2])<<16|uint32(buf[3])<<8|uint32(buf[4])), 0)
 	pk.PubKeyAlgo = PublicKeyAlgorithm(buf[5])
+
+	var lr *io.LimitedReader
+	if pk.isV6() {
+		// v6 keys give the length of the key material so that keys
+		// with unknown algorithms can be skipped.
+		if _, err = readFull(r, buf[:4]); err != nil {
+			return
+		}
+		lr = &io.LimitedReader{R: r, N: int64(binary.BigEndian.Uint32(buf[:4]))}
+		r = lr
+	}
+
 	switch pk.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSAEncryptOnly, PubKeyAlgoRSASignOnly:
 		err = pk.parseRSA(r)
@@ -291,18 +358,49 @@ func (pk *PublicKey) parse(r io.Reader) (err error) {
 		}
 		// The ECDH key is stored in an ecdsa.PublicKey for convenience.
 		pk.PublicKey, err = pk.ec.newECDSA()
+	case PubKeyAlgoEd25519:
+		if err = pk.parseNative(r, ed25519.PublicKeySize); err != nil {
+			return
+		}
+		pk.PublicKey = ed25519.PublicKey(pk.native)
+	case PubKeyAlgoX25519:
+		if err = pk.parseNative(r, 32); err != nil {
+			return
+		}
+		pk.PublicKey, err = ecdh.X25519().NewPublicKey(pk.native)
 	default:
 		err = errors.UnsupportedError("public key type: " + strconv.Itoa(int(pk.PubKeyAlgo)))
 	}
 	if err != nil {
 		return
 	}
+	if lr != nil && lr.N != 0 {
+		return errors.StructuralError("public key material length mismatch")
+	}
 
 	pk.setFingerPrintAndKeyId()
 	return
 }
 
+// parseNative reads a fixed-size public key of the X25519 or Ed25519
+// algorithms. See RFC 9580, section 5.5.5.
+func (pk *PublicKey) parseNative(r io.Reader, size int) (err error) {
+	pk.native = make([]byte, size)
+	_, err = readFull(r, pk.native)
+	return
+}
+
 func (pk *PublicKey) setFingerPrintAndKeyId() {
+	if pk.isV6() {
+		// RFC 9580, section 5.5.4.3
+		fingerPrint := sha256.New()
+		pk.SerializeSignaturePrefix(fingerPrint)
+		pk.serializeWithoutHeaders(fingerPrint)
+		copy(pk.FingerprintV6[:], fingerPrint.Sum(nil))
+		pk.KeyId = binary.BigEndian.Uint64(pk.FingerprintV6[:8])
+		return
+	}
+
 	// RFC 4880, section 12.2
 	fingerPrint := sha1.New()
 	pk.SerializeSignaturePrefix(fingerPrint)
@@ -311,6 +409,15 @@ func (pk *PublicKey) setFingerPrintAndKeyId() {
 	pk.KeyId = binary.BigEndian.Uint64(pk.Fingerprint[12:20])
 }
 
+// FingerprintBytes returns the fingerprint of the key: the SHA-1 fingerprint
+// for v4 keys and the SHA-256 fingerprint for v6 keys.
+func (pk *PublicKey) FingerprintBytes() []byte {
+	if pk.isV6() {
+		return pk.FingerprintV6[:]
+	}
+	return pk.Fingerprint[:]
+}
+
 // parseRSA parses RSA public key material from the given Reader. See RFC 4880,
 // section 5.5.2.
 func (pk *PublicKey) parseRSA(r io.Reader) (err error) {
@@ -394,38 +501,42 @@ func (pk *PublicKey) parseElGamal(r io.Reader) (err error) {
 
 // SerializeSignaturePrefix writes the prefix for this public key to the given Writer.
 // The prefix is used when calculating a signature over this public key. See
-// RFC 4880, section 5.2.4.
+// RFC 4880, section 5.2.4, and RFC 9580, section 5.2.4.
 func (pk *PublicKey) SerializeSignaturePrefix(h io.Writer) {
-	var pLength uint16
-	switch pk.PubKeyAlgo {
-	case PubKeyAlgoRSA, PubKeyAlgoRSAEncryptOnly, PubKeyAlgoRSASignOnly:
-		pLength += 2 + uint16(len(pk.n.bytes))
-		pLength += 2 + uint16(len(pk.e.bytes))
-	case PubKeyAlgoDSA:
-		pLength += 2 + uint16(len(pk.p.bytes))
-		pLength += 2 + uint16(len(pk.q.bytes))
-		pLength += 2 + uint16(len(pk.g.bytes))
-		pLength += 2 + uint16(len(pk.y.bytes))
-	case PubKeyAlgoElGamal:
-		pLength += 2 + uint16(len(pk.p.bytes))
-		pLength += 2 + uint16(len(pk.g.bytes))
-		pLength += 2 + uint16(len(pk.y.bytes))
-	case PubKeyAlgoECDSA:
-		pLength += uint16(pk.ec.byteLen())
-	case PubKeyAlgoECDH:
-		pLength += uint16(pk.ec.byteLen())
-		pLength += uint16(pk.ecdh.byteLen())
-	default:
-		panic("unknown public key algorithm")
+	length := pk.bodyLength()
+	if pk.isV6() {
+		h.Write([]byte{0x9b, byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)})
+		return
 	}
-	pLength += 6
-	h.Write([]byte{0x99, byte(pLength >> 8), byte(pLength)})
+	h.Write([]byte{0x99, byte(length >> 8), byte(length)})
 	return
 }
 
 func (pk *PublicKey) Serialize(w io.Writer) (err error) {
+	packetType := packetTypePublicKey
+	if pk.IsSubkey {
+		packetType = packetTypePublicSubkey
+	}
+	err = serializeHeader(w, packetType, pk.bodyLength())
+	if err != nil {
+		return
+	}
+	return pk.serializeWithoutHeaders(w)
+}
+
+// bodyLength returns the length of the public key packet body, as written
+// by serializeWithoutHeaders.
+func (pk *PublicKey) bodyLength() int {
 	length := 6 // 6 byte header
+	if pk.isV6() {
+		length += 4 // key material length
+	}
+	return length + pk.keyMaterialLength()
+}
 
+// keyMaterialLength returns the length of the algorithm-specific fields
+// of the public key.
+func (pk *PublicKey) keyMaterialLength() (length int) {
 	switch pk.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSAEncryptOnly, PubKeyAlgoRSASignOnly:
 		length += 2 + len(pk.n.bytes)
@@ -444,25 +555,18 @@ func (pk *PublicKey) Serialize(w io.Writer) (err error) {
 	case PubKeyAlgoECDH:
 		length += pk.ec.byteLen()
 		length += pk.ecdh.byteLen()
+	case PubKeyAlgoX25519, PubKeyAlgoEd25519:
+		length += len(pk.native)
 	default:
 		panic("unknown public key algorithm")
 	}
-
-	packetType := packetTypePublicKey
-	if pk.IsSubkey {
-		packetType = packetTypePublicSubkey
-	}
-	err = serializeHeader(w, packetType, length)
-	if err != nil {
-		return
-	}
-	return pk.serializeWithoutHeaders(w)
+	return
 }
 
 // serializeWithoutHeaders marshals the PublicKey to w in the form of an
 // OpenPGP public key packet, not including the packet header.
 func (pk *PublicKey) serializeWithoutHeaders(w io.Writer) (err error) {
-	var buf [6]byte
+	var buf [10]byte
 	buf[0] = 4
 	t := uint32(pk.CreationTime.Unix())
 	buf[1] = byte(t >> 24)
@@ -470,8 +574,14 @@ func (pk *PublicKey) serializeWithoutHeaders(w io.Writer) (err error) {
 	buf[3] = byte(t >> 8)
 	buf[4] = byte(t)
 	buf[5] = byte(pk.PubKeyAlgo)
+	n := 6
+	if pk.isV6() {
+		buf[0] = 6
+		binary.BigEndian.PutUint32(buf[6:], uint32(pk.keyMaterialLength()))
+		n = 10
+	}
 
-	_, err = w.Write(buf[:])
+	_, err = w.Write(buf[:n])
 	if err != nil {
 		return
 	}
@@ -490,13 +600,17 @@ func (pk *PublicKey) serializeWithoutHeaders(w io.Writer) (err error) {
 			return
 		}
 		return pk.ecdh.serialize(w)
+	case PubKeyAlgoX25519, PubKeyAlgoEd25519:
+		_, err = w.Write(pk.native)
+		return
 	}
 	return errors.InvalidArgumentError("bad public-key algorithm")
 }
 
 // CanSign returns true iff this public key can generate signatures
 func (pk *PublicKey) CanSign() bool {
-	return pk.PubKeyAlgo != PubKeyAlgoRSAEncryptOnly && pk.PubKeyAlgo != PubKeyAlgoElGamal
+	return pk.PubKeyAlgo != PubKeyAlgoRSAEncryptOnly && pk.PubKeyAlgo != PubKeyAlgoElGamal &&
+		pk.PubKeyAlgo != PubKeyAlgoECDH && pk.PubKeyAlgo != PubKeyAlgoX25519
 }
 
 // VerifySignature returns nil iff sig is a valid signature, made by this
@@ -516,6 +630,11 @@ func (pk *PublicKey) VerifySignature(signed hash.Hash, sig *Signature) (err erro
 	if pk.PubKeyAlgo != sig.PubKeyAlgo {
 		return errors.InvalidArgumentError("public key and signature use different algorithms")
 	}
+	// v6 keys only make v6 signatures and v4 keys only v4 signatures.
+	// See RFC 9580, section 5.2.3.
+	if pk.isV6() != sig.isV6() {
+		return errors.SignatureError("signature version " + strconv.Itoa(sig.version()) + " made by a v" + strconv.Itoa(pk.version()) + " key")
+	}
 
 	switch pk.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
@@ -542,11 +661,24 @@ func (pk *PublicKey) VerifySignature(signed hash.Hash, sig *Signature) (err erro
 			return errors.SignatureError("ECDSA verification failure")
 		}
 		return nil
+	case PubKeyAlgoEd25519:
+		ed25519PublicKey := pk.PublicKey.(ed25519.PublicKey)
+		if !ed25519.Verify(ed25519PublicKey, hashBytes, sig.Ed25519Signature) {
+			return errors.SignatureError("Ed25519 verification failure")
+		}
+		return nil
 	default:
 		return errors.SignatureError("Unsupported public key algorithm used in signature")
 	}
 }
 
+func (pk *PublicKey) version() int {
+	if pk.Version == 0 {
+		return 4
+	}
+	return pk.Version
+}
+
 // VerifySignatureV3 returns nil iff sig is a valid signature, made by this
 // public key, of the data hashed into signed. signed is mutated by this call.
 func (pk *PublicKey) VerifySignatureV3(signed hash.Hash, sig *SignatureV3) (err error) {
@@ -591,13 +723,23 @@ func (pk *PublicKey) VerifySignatureV3(signed hash.Hash, sig *SignatureV3) (err
 	}
 }
 
-// keySignatureHash returns a Hash of the message that needs to be signed for
-// pk to assert a subkey relationship to signed.
-func keySignatureHash(pk, signed signingKey, hashFunc crypto.Hash) (h hash.Hash, err error) {
+// newSignatureHash returns a new hash.Hash for a signature, seeded with the
+// salt of v6 signatures. salt is nil for older signature versions.
+func newSignatureHash(hashFunc crypto.Hash, salt []byte) (h hash.Hash, err error) {
 	if !hashFunc.Available() {
 		return nil, errors.UnsupportedError("hash function")
 	}
 	h = hashFunc.New()
+	h.Write(salt)
+	return
+}
+
+// keySignatureHash returns a Hash of the message that needs to be signed for
+// pk to assert a subkey relationship to signed.
+func keySignatureHash(pk, signed signingKey, hashFunc crypto.Hash, salt []byte) (h hash.Hash, err error) {
+	if h, err = newSignatureHash(hashFunc, salt); err != nil {
+		return nil, err
+	}
 
 	// RFC 4880, section 5.2.4
 	pk.SerializeSignaturePrefix(h)
@@ -610,7 +752,7 @@ func keySignatureHash(pk, signed signingKey, hashFunc crypto.Hash) (h hash.Hash,
 // VerifyKeySignature returns nil iff sig is a valid signature, made by this
 // public key, of signed.
 func (pk *PublicKey) VerifyKeySignature(signed *PublicKey, sig *Signature) error {
-	h, err := keySignatureHash(pk, signed, sig.Hash)
+	h, err := keySignatureHash(pk, signed, sig.Hash, sig.Salt)
 	if err != nil {
 		return err
 	}
@@ -627,7 +769,7 @@ func (pk *PublicKey) VerifyKeySignature(signed *PublicKey, sig *Signature) error
 		// Verify the cross-signature. This is calculated over the same
 		// data as the main signature, so we cannot just recursively
 		// call signed.VerifyKeySignature(...)
-		if h, err = keySignatureHash(pk, signed, sig.EmbeddedSignature.Hash); err != nil {
+		if h, err = keySignatureHash(pk, signed, sig.EmbeddedSignature.Hash, sig.EmbeddedSignature.Salt); err != nil {
 			return errors.StructuralError("error while hashing for cross-signature: " + err.Error())
 		}
 		if err := signed.VerifySignature(h, sig.EmbeddedSignature); err != nil {
@@ -638,11 +780,10 @@ func (pk *PublicKey) VerifyKeySignature(signed *PublicKey, sig *Signature) error
 	return nil
 }
 
-func keyRevocationHash(pk signingKey, hashFunc crypto.Hash) (h hash.Hash, err error) {
-	if !hashFunc.Available() {
-		return nil, errors.UnsupportedError("hash function")
+func keyRevocationHash(pk signingKey, hashFunc crypto.Hash, salt []byte) (h hash.Hash, err error) {
+	if h, err = newSignatureHash(hashFunc, salt); err != nil {
+		return nil, err
 	}
-	h = hashFunc.New()
 
 	// RFC 4880, section 5.2.4
 	pk.SerializeSignaturePrefix(h)
@@ -654,7 +795,18 @@ func keyRevocationHash(pk signingKey, hashFunc crypto.Hash) (h hash.Hash, err er
 // VerifyRevocationSignature returns nil iff sig is a valid signature, made by this
 // public key.
 func (pk *PublicKey) VerifyRevocationSignature(sig *Signature) (err error) {
-	h, err := keyRevocationHash(pk, sig.Hash)
+	h, err := keyRevocationHash(pk, sig.Hash, sig.Salt)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
+// VerifyDirectKeySignature returns nil iff sig is a valid direct-key
+// signature over this public key, made by this public key. See RFC 9580,
+// section 5.2.1.
+func (pk *PublicKey) VerifyDirectKeySignature(sig *Signature) (err error) {
+	h, err := keyRevocationHash(pk, sig.Hash, sig.Salt)
 	if err != nil {
 		return err
 	}
@@ -663,11 +815,10 @@ func (pk *PublicKey) VerifyRevocationSignature(sig *Signature) (err error) {
 
 // userIdSignatureHash returns a Hash of the message that needs to be signed
 // to assert that pk is a valid key for id.
-func userIdSignatureHash(id string, pk *PublicKey, hashFunc crypto.Hash) (h hash.Hash, err error) {
-	if !hashFunc.Available() {
-		return nil, errors.UnsupportedError("hash function")
+func userIdSignatureHash(id string, pk *PublicKey, hashFunc crypto.Hash, salt []byte) (h hash.Hash, err error) {
+	if h, err = newSignatureHash(hashFunc, salt); err != nil {
+		return nil, err
 	}
-	h = hashFunc.New()
 
 	// RFC 4880, section 5.2.4
 	pk.SerializeSignaturePrefix(h)
@@ -688,7 +839,7 @@ func userIdSignatureHash(id string, pk *PublicKey, hashFunc crypto.Hash) (h hash
 // VerifyUserIdSignature returns nil iff sig is a valid signature, made by this
 // public key, that id is the identity of pub.
 func (pk *PublicKey) VerifyUserIdSignature(id string, pub *PublicKey, sig *Signature) (err error) {
-	h, err := userIdSignatureHash(id, pub, sig.Hash)
+	h, err := userIdSignatureHash(id, pub, sig.Hash, sig.Salt)
 	if err != nil {
 		return err
 	}
@@ -705,16 +856,16 @@ func (pk *PublicKey) VerifyUserIdSignatureV3(id string, pub *PublicKey, sig *Sig
 	return pk.VerifySignatureV3(h, sig)
 }
 
-// KeyIdString returns the public key's fingerprint in capital hex
+// KeyIdString returns the public key's key id in capital hex
 // (e.g. "6C7EE1B8621CC013").
 func (pk *PublicKey) KeyIdString() string {
-	return fmt.Sprintf("%X", pk.Fingerprint[12:20])
+	return fmt.Sprintf("%016X", pk.KeyId)
 }
 
-// KeyIdShortString returns the short form of public key's fingerprint
+// KeyIdShortString returns the short form of public key's key id
 // in capital hex, as shown by gpg --list-keys (e.g. "621CC013").
 func (pk *PublicKey) KeyIdShortString() string {
-	return fmt.Sprintf("%X", pk.Fingerprint[16:20])
+	return fmt.Sprintf("%08X", uint32(pk.KeyId))
 }
 
 // A parsedMPI is used to store the contents of a big integer, along with the
@@ -9,6 +9,7 @@ import (
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"encoding/asn1"
 	"encoding/binary"
 	"hash"
@@ -29,8 +30,16 @@ const (
 	KeyFlagEncryptStorage
 )
 
-// Signature represents a signature. See RFC 4880, section 5.2.
+// KeyFlagAuthenticate marks keys that may be used for authentication, such
+// as SSH keys. See RFC 9580, section 5.2.3.29.
+const KeyFlagAuthenticate = 0x20
+
+// Signature represents a v4 or v6 signature. See RFC 4880, section 5.2, and
+// RFC 9580, section 5.2.
 type Signature struct {
+	// Version is the version of the signature packet, 4 or 6. Zero means
+	// 4. It is set by Sign from the version of the signing key.
+	Version    int
 	SigType    SignatureType
 	PubKeyAlgo PublicKeyAlgorithm
 	Hash       crypto.Hash
@@ -42,9 +51,14 @@ type Signature struct {
 	HashTag      [2]byte
 	CreationTime time.Time
 
+	// Salt is the random value hashed before the signed data in v6
+	// signatures. See RFC 9580, section 5.2.4.
+	Salt []byte
+
 	RSASignature         parsedMPI
 	DSASigR, DSASigS     parsedMPI
 	ECDSASigR, ECDSASigS parsedMPI
+	Ed25519Signature     []byte
 
 	// rawSubpackets contains the unparsed subpackets, in order.
 	rawSubpackets []outputSubpacket
@@ -57,13 +71,20 @@ type Signature struct {
 	IssuerKeyId                                             *uint64
 	IsPrimaryId                                             *bool
 
+	// IssuerFingerprint is the fingerprint of the signing key, if given.
+	// See RFC 9580, section 5.2.3.35. When it is present, IssuerKeyId is
+	// set as well.
+	IssuerFingerprint []byte
+
 	// FlagsValid is set if any flags were given. See RFC 4880, section
 	// 5.2.3.21 for details.
 	FlagsValid                                                           bool
 	FlagCertify, FlagSign, FlagEncryptCommunications, FlagEncryptStorage bool
+	FlagAuthenticate                                                     bool
 
 	// RevocationReason is set if this signature has been revoked.
-	// See RFC 4880, section 5.2.3.23 for details.
+	// See RFC 4880, section 5.2.3.23 for details. Its values are those of
+	// ReasonForRevocation.
 	RevocationReason     *uint8
 	RevocationReasonText string
 
@@ -79,26 +100,43 @@ type Signature struct {
 	outSubpackets []outputSubpacket
 }
 
+func (sig *Signature) isV6() bool {
+	return sig.Version == 6
+}
+
+func (sig *Signature) version() int {
+	if sig.Version == 0 {
+		return 4
+	}
+	return sig.Version
+}
+
 func (sig *Signature) parse(r io.Reader) (err error) {
-	// RFC 4880, section 5.2.3
-	var buf [5]byte
+	// RFC 4880, section 5.2.3, and RFC 9580, section 5.2.3.
+	var buf [7]byte
 	_, err = readFull(r, buf[:1])
 	if err != nil {
 		return
 	}
-	if buf[0] != 4 {
+	if buf[0] != 4 && buf[0] != 6 {
 		err = errors.UnsupportedError("signature packet version " + strconv.Itoa(int(buf[0])))
 		return
 	}
+	sig.Version = int(buf[0])
+	// v6 signatures use four-octet lengths for the subpacket areas.
+	lengthLen := 2
+	if sig.isV6() {
+		lengthLen = 4
+	}
 
-	_, err = readFull(r, buf[:5])
+	_, err = readFull(r, buf[:3+lengthLen])
 	if err != nil {
 		return
 	}
 	sig.SigType = SignatureType(buf[0])
 	sig.PubKeyAlgo = PublicKeyAlgorithm(buf[1])
 	switch sig.PubKeyAlgo {
-	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly, PubKeyAlgoDSA, PubKeyAlgoECDSA:
+	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly, PubKeyAlgoDSA, PubKeyAlgoECDSA, PubKeyAlgoEd25519:
 	default:
 		err = errors.UnsupportedError("public key algorithm " + strconv.Itoa(int(sig.PubKeyAlgo)))
 		return
@@ -110,37 +148,29 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		return errors.UnsupportedError("hash function " + strconv.Itoa(int(buf[2])))
 	}
 
-	hashedSubpacketsLength := int(buf[3])<<8 | int(buf[4])
-	l := 6 + hashedSubpacketsLength
-	sig.HashSuffix = make([]byte, l+6)
-	sig.HashSuffix[0] = 4
-	copy(sig.HashSuffix[1:], buf[:5])
-	hashedSubpackets := sig.HashSuffix[6:l]
-	_, err = readFull(r, hashedSubpackets)
+	hashedSubpacketsLength := readSubpacketsLength(buf[3:], lengthLen)
+	l := 1 + 3 + lengthLen + hashedSubpacketsLength
+	header := make([]byte, 1+3+lengthLen, l)
+	header[0] = byte(sig.Version)
+	copy(header[1:], buf[:3+lengthLen])
+	hashedSubpackets, err := readSubpackets(r, hashedSubpacketsLength)
 	if err != nil {
 		return
 	}
-	// See RFC 4880, section 5.2.4
-	trailer := sig.HashSuffix[l:]
-	trailer[0] = 4
-	trailer[1] = 0xff
-	trailer[2] = uint8(l >> 24)
-	trailer[3] = uint8(l >> 16)
-	trailer[4] = uint8(l >> 8)
-	trailer[5] = uint8(l)
+	// See RFC 4880, section 5.2.4, and RFC 9580, section 5.2.4.
+	sig.HashSuffix = append(append(header, hashedSubpackets...),
+		byte(sig.Version), 0xff, uint8(l>>24), uint8(l>>16), uint8(l>>8), uint8(l))
 
 	err = parseSignatureSubpackets(sig, hashedSubpackets, true)
 	if err != nil {
 		return
 	}
 
-	_, err = readFull(r, buf[:2])
+	_, err = readFull(r, buf[:lengthLen])
 	if err != nil {
 		return
 	}
-	unhashedSubpacketsLength := int(buf[0])<<8 | int(buf[1])
-	unhashedSubpackets := make([]byte, unhashedSubpacketsLength)
-	_, err = readFull(r, unhashedSubpackets)
+	unhashedSubpackets, err := readSubpackets(r, readSubpacketsLength(buf[:], lengthLen))
 	if err != nil {
 		return
 	}
@@ -154,6 +184,23 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		return
 	}
 
+	if sig.isV6() {
+		saltLen, err := saltLength(sig.Hash)
+		if err != nil {
+			return err
+		}
+		if _, err = readFull(r, buf[:1]); err != nil {
+			return err
+		}
+		if int(buf[0]) != saltLen {
+			return errors.StructuralError("signature salt has wrong length for hash function")
+		}
+		sig.Salt = make([]byte, saltLen)
+		if _, err = readFull(r, sig.Salt); err != nil {
+			return err
+		}
+	}
+
 	switch sig.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
 		sig.RSASignature.bytes, sig.RSASignature.bitLength, err = readMPI(r)
@@ -167,12 +214,49 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		if err == nil {
 			sig.ECDSASigS.bytes, sig.ECDSASigS.bitLength, err = readMPI(r)
 		}
+	case PubKeyAlgoEd25519:
+		sig.Ed25519Signature = make([]byte, ed25519.SignatureSize)
+		_, err = readFull(r, sig.Ed25519Signature)
 	default:
 		panic("unreachable")
 	}
 	return
 }
 
+func readSubpacketsLength(b []byte, lengthLen int) int {
+	if lengthLen == 4 {
+		return int(binary.BigEndian.Uint32(b))
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+// readSubpackets reads a subpacket area of the given length, without
+// trusting the length for the allocation.
+func readSubpackets(r io.Reader, length int) ([]byte, error) {
+	subpackets, err := io.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+	if len(subpackets) != length {
+		return nil, errors.StructuralError("signature subpackets truncated")
+	}
+	return subpackets, nil
+}
+
+// saltLength returns the size of the salt of v6 signatures using hash h.
+// See RFC 9580, section 9.5.
+func saltLength(h crypto.Hash) (int, error) {
+	switch h {
+	case crypto.SHA256, crypto.SHA224, crypto.SHA3_256:
+		return 16, nil
+	case crypto.SHA384:
+		return 24, nil
+	case crypto.SHA512, crypto.SHA3_512:
+		return 32, nil
+	}
+	return 0, errors.UnsupportedError("hash function " + strconv.Itoa(int(h)) + " in v6 signature")
+}
+
 // parseSignatureSubpackets parses subpackets of the main signature packet. See
 // RFC 4880, section 5.2.3.1.
 func parseSignatureSubpackets(sig *Signature, subpackets []byte, isHashed bool) (err error) {
@@ -205,6 +289,7 @@ const (
 	reasonForRevocationSubpacket signatureSubpacketType = 29
 	featuresSubpacket            signatureSubpacketType = 30
 	embeddedSignatureSubpacket   signatureSubpacketType = 32
+	issuerFingerprintSubpacket   signatureSubpacketType = 33
 )
 
 // parseSignatureSubpacket parses a single subpacket. len(subpacket) is >= 1.
@@ -346,6 +431,9 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		if subpacket[0]&KeyFlagEncryptStorage != 0 {
 			sig.FlagEncryptStorage = true
 		}
+		if subpacket[0]&KeyFlagAuthenticate != 0 {
+			sig.FlagAuthenticate = true
+		}
 	case reasonForRevocationSubpacket:
 		// Reason For Revocation, section 5.2.3.23
 		if !isHashed {
@@ -373,8 +461,8 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 			return
 		}
 		sig.EmbeddedSignature = new(Signature)
-		// Embedded signatures are required to be v4 signatures see
-		// section 12.1. However, we only parse v4 signatures in this
+		// Embedded signatures are required to be v4 or v6 signatures,
+		// see section 12.1. However, we only parse those in this
 		// file anyway.
 		if err := sig.EmbeddedSignature.parse(bytes.NewBuffer(subpacket)); err != nil {
 			return nil, err
@@ -382,6 +470,28 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		if sigType := sig.EmbeddedSignature.SigType; sigType != SigTypePrimaryKeyBinding {
 			return nil, errors.StructuralError("cross-signature has unexpected type " + strconv.Itoa(int(sigType)))
 		}
+	case issuerFingerprintSubpacket:
+		// Issuer fingerprint, RFC 9580, section 5.2.3.35
+		if len(subpacket) == 0 {
+			err = errors.StructuralError("empty issuer fingerprint subpacket")
+			return
+		}
+		fp := subpacket[1:]
+		switch {
+		case subpacket[0] == 4 && len(fp) == 20:
+			if sig.IssuerKeyId == nil {
+				sig.IssuerKeyId = new(uint64)
+				*sig.IssuerKeyId = binary.BigEndian.Uint64(fp[12:])
+			}
+		case subpacket[0] == 6 && len(fp) == 32:
+			sig.IssuerKeyId = new(uint64)
+			*sig.IssuerKeyId = binary.BigEndian.Uint64(fp[:8])
+		default:
+			err = errors.StructuralError("issuer fingerprint subpacket with bad length or version")
+			return
+		}
+		sig.IssuerFingerprint = make([]byte, len(fp))
+		copy(sig.IssuerFingerprint, fp)
 	default:
 		if isCritical {
 			err = errors.UnsupportedError("unknown critical signature subpacket type " + strconv.Itoa(int(packetType)))
@@ -469,9 +579,13 @@ func (sig *Signature) buildHashSuffix() (err error) {
 	hashedSubpacketsLen := subpacketsLength(sig.outSubpackets, true)
 
 	var ok bool
-	l := 6 + hashedSubpacketsLen
+	lengthLen := 2
+	if sig.isV6() {
+		lengthLen = 4
+	}
+	l := 4 + lengthLen + hashedSubpacketsLen
 	sig.HashSuffix = make([]byte, l+6)
-	sig.HashSuffix[0] = 4
+	sig.HashSuffix[0] = byte(sig.version())
 	sig.HashSuffix[1] = uint8(sig.SigType)
 	sig.HashSuffix[2] = uint8(sig.PubKeyAlgo)
 	sig.HashSuffix[3], ok = s2k.HashToHashId(sig.Hash)
@@ -479,11 +593,15 @@ func (sig *Signature) buildHashSuffix() (err error) {
 		sig.HashSuffix = nil
 		return errors.InvalidArgumentError("hash cannot be represented in OpenPGP: " + strconv.Itoa(int(sig.Hash)))
 	}
-	sig.HashSuffix[4] = byte(hashedSubpacketsLen >> 8)
-	sig.HashSuffix[5] = byte(hashedSubpacketsLen)
-	serializeSubpackets(sig.HashSuffix[6:l], sig.outSubpackets, true)
+	if sig.isV6() {
+		binary.BigEndian.PutUint32(sig.HashSuffix[4:], uint32(hashedSubpacketsLen))
+	} else {
+		sig.HashSuffix[4] = byte(hashedSubpacketsLen >> 8)
+		sig.HashSuffix[5] = byte(hashedSubpacketsLen)
+	}
+	serializeSubpackets(sig.HashSuffix[4+lengthLen:l], sig.outSubpackets, true)
 	trailer := sig.HashSuffix[l:]
-	trailer[0] = 4
+	trailer[0] = byte(sig.version())
 	trailer[1] = 0xff
 	trailer[2] = byte(l >> 24)
 	trailer[3] = byte(l >> 16)
@@ -508,8 +626,28 @@ func (sig *Signature) signPrepareHash(h hash.Hash) (digest []byte, err error) {
 // the hash of the message to be signed and will be mutated by this function.
 // On success, the signature is stored in sig. Call Serialize to write it out.
 // If config is nil, sensible defaults will be used.
+//
+// If priv is a v6 key, a v6 signature is made. Then sig.Salt must hold a
+// random salt of the size required for sig.Hash, which must have been
+// written to h before the message.
 func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err error) {
-	sig.outSubpackets = sig.buildSubpackets()
+	if priv.isV6() {
+		saltLen, err := saltLength(sig.Hash)
+		if err != nil {
+			return err
+		}
+		if len(sig.Salt) != saltLen {
+			return errors.InvalidArgumentError("v6 signature needs a salt of " + strconv.Itoa(saltLen) + " bytes")
+		}
+		sig.Version = 6
+		sig.IssuerFingerprint = priv.FingerprintV6[:]
+	} else {
+		sig.Version = 0
+		sig.Salt = nil
+	}
+	if sig.outSubpackets, err = sig.buildSubpackets(); err != nil {
+		return
+	}
 	digest, err := sig.signPrepareHash(h)
 	if err != nil {
 		return
@@ -551,6 +689,10 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 			sig.ECDSASigR = fromBig(r)
 			sig.ECDSASigS = fromBig(s)
 		}
+	case PubKeyAlgoEd25519:
+		// Ed25519 signs the digest itself rather than a prehash of
+		// it. See RFC 9580, section 5.2.3.4.
+		sig.Ed25519Signature, err = priv.PrivateKey.(crypto.Signer).Sign(config.Random(), digest, crypto.Hash(0))
 	default:
 		err = errors.UnsupportedError("public key algorithm: " + strconv.Itoa(int(sig.PubKeyAlgo)))
 	}
@@ -576,7 +718,10 @@ func unwrapECDSASig(b []byte) (r, s *big.Int, err error) {
 // Serialize to write it out.
 // If config is nil, sensible defaults will be used.
 func (sig *Signature) SignUserId(id string, pub *PublicKey, priv *PrivateKey, config *Config) error {
-	h, err := userIdSignatureHash(id, pub, sig.Hash)
+	if err := sig.newSalt(priv, config); err != nil {
+		return err
+	}
+	h, err := userIdSignatureHash(id, pub, sig.Hash, sig.Salt)
 	if err != nil {
 		return err
 	}
@@ -587,55 +732,115 @@ func (sig *Signature) SignUserId(id string, pub *PublicKey, priv *PrivateKey, co
 // success, the signature is stored in sig. Call Serialize to write it out.
 // If config is nil, sensible defaults will be used.
 func (sig *Signature) SignKey(pub *PublicKey, priv *PrivateKey, config *Config) error {
-	h, err := keySignatureHash(&priv.PublicKey, pub, sig.Hash)
+	if err := sig.newSalt(priv, config); err != nil {
+		return err
+	}
+	h, err := keySignatureHash(&priv.PublicKey, pub, sig.Hash, sig.Salt)
 	if err != nil {
 		return err
 	}
 	return sig.Sign(h, priv, config)
 }
 
+// CrossSignKey computes the primary key binding signature of RFC 4880,
+// section 5.2.1, with which the signing subkey priv asserts that it belongs
+// to the primary key primary. It must be set as the EmbeddedSignature of the
+// subkey binding signature of a signing subkey. On success, the signature is
+// stored in sig.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) CrossSignKey(primary *PublicKey, priv *PrivateKey, config *Config) error {
+	if err := sig.newSalt(priv, config); err != nil {
+		return err
+	}
+	h, err := keySignatureHash(primary, &priv.PublicKey, sig.Hash, sig.Salt)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// RevokeKey computes a key revocation signature from priv of pub, which must
+// be the public key of priv. On success, the signature is stored in sig. Call
+// Serialize to write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) RevokeKey(pub *PublicKey, priv *PrivateKey, config *Config) error {
+	if err := sig.newSalt(priv, config); err != nil {
+		return err
+	}
+	h, err := keyRevocationHash(pub, sig.Hash, sig.Salt)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// RevokeSubkey computes a subkey revocation signature from priv of the
+// subkey pub. It is computed over the same data as the binding signature of
+// SignKey. On success, the signature is stored in sig. Call Serialize to
+// write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) RevokeSubkey(pub *PublicKey, priv *PrivateKey, config *Config) error {
+	return sig.SignKey(pub, priv, config)
+}
+
+// newSalt sets sig.Salt to a fresh random value if priv makes v6
+// signatures.
+func (sig *Signature) newSalt(priv *PrivateKey, config *Config) error {
+	if !priv.isV6() {
+		return nil
+	}
+	saltLen, err := saltLength(sig.Hash)
+	if err != nil {
+		return err
+	}
+	sig.Salt = make([]byte, saltLen)
+	_, err = io.ReadFull(config.Random(), sig.Salt)
+	return err
+}
+
 // Serialize marshals sig to w. Sign, SignUserId or SignKey must have been
 // called first.
 func (sig *Signature) Serialize(w io.Writer) (err error) {
+	var body bytes.Buffer
+	if err = sig.serializeBody(&body); err != nil {
+		return
+	}
+	if err = serializeHeader(w, packetTypeSignature, body.Len()); err != nil {
+		return
+	}
+	_, err = w.Write(body.Bytes())
+	return
+}
+
+// serializeBody marshals sig to w without the packet header, as in
+// embedded signature subpackets.
+func (sig *Signature) serializeBody(w io.Writer) (err error) {
 	if len(sig.outSubpackets) == 0 {
 		sig.outSubpackets = sig.rawSubpackets
 	}
-	if sig.RSASignature.bytes == nil && sig.DSASigR.bytes == nil && sig.ECDSASigR.bytes == nil {
+	if sig.RSASignature.bytes == nil && sig.DSASigR.bytes == nil && sig.ECDSASigR.bytes == nil && sig.Ed25519Signature == nil {
 		return errors.InvalidArgumentError("Signature: need to call Sign, SignUserId or SignKey before Serialize")
 	}
 
-	sigLength := 0
-	switch sig.PubKeyAlgo {
-	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
-		sigLength = 2 + len(sig.RSASignature.bytes)
-	case PubKeyAlgoDSA:
-		sigLength = 2 + len(sig.DSASigR.bytes)
-		sigLength += 2 + len(sig.DSASigS.bytes)
-	case PubKeyAlgoECDSA:
-		sigLength = 2 + len(sig.ECDSASigR.bytes)
-		sigLength += 2 + len(sig.ECDSASigS.bytes)
-	default:
-		panic("impossible")
+	lengthLen := 2
+	if sig.isV6() {
+		lengthLen = 4
 	}
-
 	unhashedSubpacketsLen := subpacketsLength(sig.outSubpackets, false)
-	length := len(sig.HashSuffix) - 6 /* trailer not included */ +
-		2 /* length of unhashed subpackets */ + unhashedSubpacketsLen +
-		2 /* hash tag */ + sigLength
-	err = serializeHeader(w, packetTypeSignature, length)
-	if err != nil {
-		return
-	}
 
 	_, err = w.Write(sig.HashSuffix[:len(sig.HashSuffix)-6])
 	if err != nil {
 		return
 	}
 
-	unhashedSubpackets := make([]byte, 2+unhashedSubpacketsLen)
-	unhashedSubpackets[0] = byte(unhashedSubpacketsLen >> 8)
-	unhashedSubpackets[1] = byte(unhashedSubpacketsLen)
-	serializeSubpackets(unhashedSubpackets[2:], sig.outSubpackets, false)
+	unhashedSubpackets := make([]byte, lengthLen+unhashedSubpacketsLen)
+	if sig.isV6() {
+		binary.BigEndian.PutUint32(unhashedSubpackets, uint32(unhashedSubpacketsLen))
+	} else {
+		unhashedSubpackets[0] = byte(unhashedSubpacketsLen >> 8)
+		unhashedSubpackets[1] = byte(unhashedSubpacketsLen)
+	}
+	serializeSubpackets(unhashedSubpackets[lengthLen:], sig.outSubpackets, false)
 
 	_, err = w.Write(unhashedSubpackets)
 	if err != nil {
@@ -645,6 +850,12 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	if sig.isV6() {
+		_, err = w.Write(append([]byte{byte(len(sig.Salt))}, sig.Salt...))
+		if err != nil {
+			return
+		}
+	}
 
 	switch sig.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
@@ -653,6 +864,8 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 		err = writeMPIs(w, sig.DSASigR, sig.DSASigS)
 	case PubKeyAlgoECDSA:
 		err = writeMPIs(w, sig.ECDSASigR, sig.ECDSASigS)
+	case PubKeyAlgoEd25519:
+		_, err = w.Write(sig.Ed25519Signature)
 	default:
 		panic("impossible")
 	}
@@ -667,12 +880,18 @@ type outputSubpacket struct {
 	contents      []byte
 }
 
-func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
+func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket, err error) {
 	creationTime := make([]byte, 4)
 	binary.BigEndian.PutUint32(creationTime, uint32(sig.CreationTime.Unix()))
 	subpackets = append(subpackets, outputSubpacket{true, creationTimeSubpacket, false, creationTime})
 
-	if sig.IssuerKeyId != nil {
+	if sig.IssuerFingerprint != nil {
+		contents := append([]byte{byte(sig.version())}, sig.IssuerFingerprint...)
+		subpackets = append(subpackets, outputSubpacket{true, issuerFingerprintSubpacket, false, contents})
+	}
+
+	// v6 signatures identify the issuer by fingerprint only.
+	if sig.IssuerKeyId != nil && !sig.isV6() {
 		keyId := make([]byte, 8)
 		binary.BigEndian.PutUint64(keyId, *sig.IssuerKeyId)
 		subpackets = append(subpackets, outputSubpacket{true, issuerSubpacket, false, keyId})
@@ -700,6 +919,9 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		if sig.FlagEncryptStorage {
 			flags |= KeyFlagEncryptStorage
 		}
+		if sig.FlagAuthenticate {
+			flags |= KeyFlagAuthenticate
+		}
 		subpackets = append(subpackets, outputSubpacket{true, keyFlagsSubpacket, false, []byte{flags}})
 	}
 
@@ -715,6 +937,11 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		subpackets = append(subpackets, outputSubpacket{true, primaryUserIdSubpacket, false, []byte{1}})
 	}
 
+	if sig.RevocationReason != nil {
+		reason := append([]byte{*sig.RevocationReason}, sig.RevocationReasonText...)
+		subpackets = append(subpackets, outputSubpacket{true, reasonForRevocationSubpacket, false, reason})
+	}
+
 	if len(sig.PreferredSymmetric) > 0 {
 		subpackets = append(subpackets, outputSubpacket{true, prefSymmetricAlgosSubpacket, false, sig.PreferredSymmetric})
 	}
@@ -727,5 +954,13 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		subpackets = append(subpackets, outputSubpacket{true, prefCompressionSubpacket, false, sig.PreferredCompression})
 	}
 
+	if sig.EmbeddedSignature != nil {
+		var buf bytes.Buffer
+		if err = sig.EmbeddedSignature.serializeBody(&buf); err != nil {
+			return nil, err
+		}
+		subpackets = append(subpackets, outputSubpacket{true, embeddedSignatureSubpacket, false, buf.Bytes()})
+	}
+
 	return
 }
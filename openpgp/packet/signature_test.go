@@ -7,8 +7,11 @@ package packet
 import (
 	"bytes"
 	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/hex"
 	"testing"
+	"time"
 )
 
 func TestSignatureRead(t *testing.T) {
@@ -75,4 +78,86 @@ func TestSignUserId(t *testing.T) {
 	}
 }
 
+func TestSignUserIdV6(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := NewEd25519PrivateKey(time.Unix(1700000000, 0), priv)
+	privKey.Version = 6
+	privKey.setFingerPrintAndKeyId()
+	pubKey := &privKey.PublicKey
+
+	sig := &Signature{
+		SigType:      SigTypePositiveCert,
+		PubKeyAlgo:   PubKeyAlgoEd25519,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Unix(1700000000, 0),
+	}
+	if err := sig.SignUserId("test", pubKey, privKey, nil); err != nil {
+		t.Fatalf("failed to sign user id: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := sig.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	packet, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig = packet.(*Signature)
+	if sig.Version != 6 || len(sig.Salt) != 16 {
+		t.Errorf("got version %d and %d byte salt, want 6 and 16", sig.Version, len(sig.Salt))
+	}
+	if !bytes.Equal(sig.IssuerFingerprint, pubKey.FingerprintBytes()) || *sig.IssuerKeyId != pubKey.KeyId {
+		t.Errorf("bad issuer")
+	}
+	if err := pubKey.VerifyUserIdSignature("test", pubKey, sig); err != nil {
+		t.Errorf("failed to verify signature: %v", err)
+	}
+	if err := pubKey.VerifyUserIdSignature("other", pubKey, sig); err == nil {
+		t.Errorf("signature verified for the wrong user id")
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := NewEd25519PrivateKey(time.Unix(1700000000, 0), priv)
+	pubKey := &privKey.PublicKey
+
+	reason := uint8(KeyCompromised)
+	sig := &Signature{
+		SigType:              SigTypeKeyRevocation,
+		PubKeyAlgo:           PubKeyAlgoEd25519,
+		Hash:                 crypto.SHA256,
+		CreationTime:         time.Unix(1700000000, 0),
+		IssuerKeyId:          &pubKey.KeyId,
+		RevocationReason:     &reason,
+		RevocationReasonText: "lost",
+	}
+	if err := sig.RevokeKey(pubKey, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := sig.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	packet, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig = packet.(*Signature)
+	if sig.RevocationReason == nil || *sig.RevocationReason != uint8(KeyCompromised) || sig.RevocationReasonText != "lost" {
+		t.Errorf("got revocation reason %v %q, want %d %q", sig.RevocationReason, sig.RevocationReasonText, KeyCompromised, "lost")
+	}
+	if err := pubKey.VerifyRevocationSignature(sig); err != nil {
+		t.Errorf("failed to verify signature: %v", err)
+	}
+}
+
 const signatureDataHex = "c2c05c04000102000605024cb45112000a0910ab105c91af38fb158f8d07ff5596ea368c5efe015bed6e78348c0f033c931d5f2ce5db54ce7f2a7e4b4ad64db758d65a7a71773edeab7ba2a9e0908e6a94a1175edd86c1d843279f045b021a6971a72702fcbd650efc393c5474d5b59a15f96d2eaad4c4c426797e0dcca2803ef41c6ff234d403eec38f31d610c344c06f2401c262f0993b2e66cad8a81ebc4322c723e0d4ba09fe917e8777658307ad8329adacba821420741009dfe87f007759f0982275d028a392c6ed983a0d846f890b36148c7358bdb8a516007fac760261ecd06076813831a36d0459075d1befa245ae7f7fb103d92ca759e9498fe60ef8078a39a3beda510deea251ea9f0a7f0df6ef42060f20780360686f3e400e"
@@ -19,24 +19,43 @@ import (
 const maxSessionKeySizeInBytes = 64
 
 // SymmetricKeyEncrypted represents a passphrase protected session key. See RFC
-// 4880, section 5.3.
+// 4880, section 5.3, and RFC 9580, section 5.3.
 type SymmetricKeyEncrypted struct {
-	CipherFunc   CipherFunction
+	// Version is the version of the packet, 4 or 6. Zero means 4.
+	// Version 6 packets precede version 2 SymmetricallyEncrypted
+	// packets.
+	Version    int
+	CipherFunc CipherFunction
+	// Mode is the AEAD mode protecting the session key in version 6
+	// packets.
+	Mode         AEADMode
 	s2k          func(out, in []byte)
+	nonce        []byte
 	encryptedKey []byte
 }
 
-const symmetricKeyEncryptedVersion = 4
+const (
+	symmetricKeyEncryptedVersion   = 4
+	symmetricKeyEncryptedVersionV6 = 6
+)
 
 func (ske *SymmetricKeyEncrypted) parse(r io.Reader) error {
 	// RFC 4880, section 5.3.
 	var buf [2]byte
-	if _, err := readFull(r, buf[:]); err != nil {
+	if _, err := readFull(r, buf[:1]); err != nil {
 		return err
 	}
-	if buf[0] != symmetricKeyEncryptedVersion {
+	switch buf[0] {
+	case symmetricKeyEncryptedVersion:
+	case symmetricKeyEncryptedVersionV6:
+		ske.Version = symmetricKeyEncryptedVersionV6
+		return ske.parseV6(r)
+	default:
 		return errors.UnsupportedError("SymmetricKeyEncrypted version")
 	}
+	if _, err := readFull(r, buf[1:]); err != nil {
+		return err
+	}
 	ske.CipherFunc = CipherFunction(buf[1])
 
 	if ske.CipherFunc.KeySize() == 0 {
@@ -67,13 +86,75 @@ func (ske *SymmetricKeyEncrypted) parse(r io.Reader) error {
 	return nil
 }
 
+// parseV6 parses the remainder of a version 6 packet. See RFC 9580, section
+// 5.3.2.
+func (ske *SymmetricKeyEncrypted) parseV6(r io.Reader) error {
+	var buf [4]byte
+	if _, err := readFull(r, buf[:]); err != nil {
+		return err
+	}
+	fieldsLen, s2kLen := int(buf[0]), int(buf[3])
+	ske.CipherFunc = CipherFunction(buf[1])
+	ske.Mode = AEADMode(buf[2])
+	if ske.CipherFunc.KeySize() == 0 || ske.CipherFunc.blockSize() != 16 {
+		return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(buf[1])))
+	}
+	nonceLen := ske.Mode.NonceLength()
+	if nonceLen == 0 {
+		return errors.UnsupportedError("unknown AEAD mode: " + strconv.Itoa(int(buf[2])))
+	}
+	if fieldsLen != 3+s2kLen+nonceLen {
+		return errors.StructuralError("SymmetricKeyEncrypted field length mismatch")
+	}
+
+	s2kBytes := make([]byte, s2kLen)
+	if _, err := readFull(r, s2kBytes); err != nil {
+		return err
+	}
+	var err error
+	s2kReader := bytes.NewReader(s2kBytes)
+	if ske.s2k, err = s2k.Parse(s2kReader); err != nil {
+		return err
+	}
+	if s2kReader.Len() != 0 {
+		return errors.StructuralError("SymmetricKeyEncrypted s2k length mismatch")
+	}
+
+	ske.nonce = make([]byte, nonceLen)
+	if _, err := readFull(r, ske.nonce); err != nil {
+		return err
+	}
+
+	// The encrypted session key is followed by the authentication tag.
+	maxLen := maxSessionKeySizeInBytes + ske.Mode.TagLength()
+	ske.encryptedKey, err = io.ReadAll(io.LimitReader(r, int64(maxLen)+1))
+	if err != nil {
+		return err
+	}
+	if len(ske.encryptedKey) > maxLen {
+		return errors.UnsupportedError("oversized encrypted session key")
+	}
+	if len(ske.encryptedKey) <= ske.Mode.TagLength() {
+		return errors.StructuralError("truncated encrypted session key")
+	}
+	return nil
+}
+
 // Decrypt attempts to decrypt an encrypted session key and returns the key and
 // the cipher to use when decrypting a subsequent Symmetrically Encrypted Data
 // packet.
+//
+// For version 6 packets, the returned cipher is that of the packet itself;
+// the version 2 SymmetricallyEncrypted packet that follows names its own
+// cipher. A wrong passphrase results in an ErrKeyIncorrect error.
 func (ske *SymmetricKeyEncrypted) Decrypt(passphrase []byte) ([]byte, CipherFunction, error) {
 	key := make([]byte, ske.CipherFunc.KeySize())
 	ske.s2k(key, passphrase)
 
+	if ske.Version == symmetricKeyEncryptedVersionV6 {
+		return ske.decryptV6(key)
+	}
+
 	if len(ske.encryptedKey) == 0 {
 		return key, ske.CipherFunc, nil
 	}
@@ -95,10 +176,30 @@ func (ske *SymmetricKeyEncrypted) Decrypt(passphrase []byte) ([]byte, CipherFunc
 	return plaintextKey, cipherFunc, nil
 }
 
+func (ske *SymmetricKeyEncrypted) decryptV6(key []byte) ([]byte, CipherFunction, error) {
+	// RFC 9580, section 5.3.2: the packet header is the associated
+	// data and the info for deriving the key encryption key.
+	adata := []byte{0xc0 | byte(packetTypeSymmetricKeyEncrypted), symmetricKeyEncryptedVersionV6, byte(ske.CipherFunc), byte(ske.Mode)}
+	kek, err := deriveAEADKey(key, nil, adata, len(key))
+	if err != nil {
+		return nil, ske.CipherFunc, err
+	}
+	aead, err := ske.Mode.new(ske.CipherFunc.new(kek))
+	if err != nil {
+		return nil, ske.CipherFunc, err
+	}
+	plaintextKey, err := aead.Open(nil, ske.nonce, ske.encryptedKey, adata)
+	if err != nil {
+		return nil, ske.CipherFunc, errors.ErrKeyIncorrect
+	}
+	return plaintextKey, ske.CipherFunc, nil
+}
+
 // SerializeSymmetricKeyEncrypted serializes a symmetric key packet to w. The
 // packet contains a random session key, encrypted by a key derived from the
 // given passphrase. The session key is returned and must be passed to
-// SerializeSymmetricallyEncrypted.
+// SerializeSymmetricallyEncrypted. The packet is a version 6 packet if
+// config.AEAD is set, and version 4 otherwise.
 // If config is nil, sensible defaults will be used.
 func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Config) (key []byte, err error) {
 	cipherFunc := config.Cipher()
@@ -106,17 +207,24 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 	if keySize == 0 {
 		return nil, errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(cipherFunc)))
 	}
+	if config.aead() != nil && cipherFunc.blockSize() != 16 {
+		return nil, errors.UnsupportedError("AEAD encryption with cipher " + strconv.Itoa(int(cipherFunc)))
+	}
 
 	s2kBuf := new(bytes.Buffer)
 	keyEncryptingKey := make([]byte, keySize)
 	// s2k.Serialize salts and stretches the passphrase, and writes the
 	// resulting key to keyEncryptingKey and the s2k descriptor to s2kBuf.
-	err = s2k.Serialize(s2kBuf, keyEncryptingKey, config.Random(), passphrase, &s2k.Config{Hash: config.Hash(), S2KCount: config.PasswordHashIterations()})
+	err = s2k.Serialize(s2kBuf, keyEncryptingKey, config.Random(), passphrase, &s2k.Config{Hash: config.Hash(), S2KCount: config.PasswordHashIterations(), Argon2: config.argon2()})
 	if err != nil {
 		return
 	}
 	s2kBytes := s2kBuf.Bytes()
 
+	if aeadConfig := config.aead(); aeadConfig != nil {
+		return serializeSymmetricKeyEncryptedV6(w, cipherFunc, aeadConfig.mode(), keyEncryptingKey, s2kBytes, config.Random())
+	}
+
 	packetLength := 2 /* header */ + len(s2kBytes) + 1 /* cipher type */ + keySize
 	err = serializeHeader(w, packetTypeSymmetricKeyEncrypted, packetLength)
 	if err != nil {
@@ -153,3 +261,45 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 	key = sessionKey
 	return
 }
+
+// serializeSymmetricKeyEncryptedV6 writes a version 6 packet holding a random
+// session key, encrypted with mode by a key derived from key. See RFC 9580,
+// section 5.3.2.
+func serializeSymmetricKeyEncryptedV6(w io.Writer, cipherFunc CipherFunction, mode AEADMode, key, s2kBytes []byte, rand io.Reader) ([]byte, error) {
+	if mode.NonceLength() == 0 {
+		return nil, errors.UnsupportedError("unknown AEAD mode: " + strconv.Itoa(int(mode)))
+	}
+	adata := []byte{0xc0 | byte(packetTypeSymmetricKeyEncrypted), symmetricKeyEncryptedVersionV6, byte(cipherFunc), byte(mode)}
+	kek, err := deriveAEADKey(key, nil, adata, len(key))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := mode.new(cipherFunc.new(kek))
+	if err != nil {
+		return nil, err
+	}
+
+	keySize := cipherFunc.KeySize()
+	sessionKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand, sessionKey); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, mode.NonceLength())
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return nil, err
+	}
+
+	fieldsLen := 3 + len(s2kBytes) + len(nonce)
+	packetLength := 2 /* version and count */ + fieldsLen + keySize + mode.TagLength()
+	if err := serializeHeader(w, packetTypeSymmetricKeyEncrypted, packetLength); err != nil {
+		return nil, err
+	}
+	buf := []byte{symmetricKeyEncryptedVersionV6, byte(fieldsLen), byte(cipherFunc), byte(mode), byte(len(s2kBytes))}
+	buf = append(buf, s2kBytes...)
+	buf = append(buf, nonce...)
+	buf = aead.Seal(buf, nonce, sessionKey, adata)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	return sessionKey, nil
+}
@@ -6,9 +6,14 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/rand"
 	"encoding/hex"
 	"io"
 	"testing"
+
+	"github.com/gitpod-io/golang-crypto/openpgp/errors"
+	"github.com/gitpod-io/golang-crypto/openpgp/s2k"
 )
 
 func TestSymmetricKeyEncrypted(t *testing.T) {
@@ -60,6 +65,78 @@ func TestSymmetricKeyEncrypted(t *testing.T) {
 const symmetricallyEncryptedHex = "8c0d04030302371a0b38d884f02060c91cf97c9973b8e58e028e9501708ccfe618fb92afef7fa2d80ddadd93cf"
 const symmetricallyEncryptedContentsHex = "cb1062004d14c4df636f6e74656e74732e0a"
 
+func TestSymmetricKeyEncryptedV6(t *testing.T) {
+	passphrase := []byte("password")
+	var s2kBuf bytes.Buffer
+	kek := make([]byte, CipherAES128.KeySize())
+	s2kConfig := &s2k.Config{Hash: crypto.SHA256, Argon2: &s2k.Argon2Config{Passes: 1, Parallelism: 1, MemoryExp: 10}}
+	if err := s2k.Serialize(&s2kBuf, kek, rand.Reader, passphrase, s2kConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	// Encrypt a session key as described in RFC 9580, section 5.3.2.
+	adata := []byte{0xc0 | byte(packetTypeSymmetricKeyEncrypted), symmetricKeyEncryptedVersionV6, byte(CipherAES128), byte(AEADModeGCM)}
+	kek, err := deriveAEADKey(kek, nil, adata, len(kek))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := AEADModeGCM.new(CipherAES128.new(kek))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionKey := make([]byte, CipherAES256.KeySize())
+	nonce := make([]byte, AEADModeGCM.NonceLength())
+	rand.Read(sessionKey)
+	rand.Read(nonce)
+	fields := append([]byte{byte(CipherAES128), byte(AEADModeGCM), byte(s2kBuf.Len())}, s2kBuf.Bytes()...)
+	fields = append(fields, nonce...)
+	body := append([]byte{symmetricKeyEncryptedVersionV6, byte(len(fields))}, fields...)
+	body = aead.Seal(body, nonce, sessionKey, adata)
+
+	var buf bytes.Buffer
+	serializeHeader(&buf, packetTypeSymmetricKeyEncrypted, len(body))
+	buf.Write(body)
+	contents := []byte("hello world\n")
+	if err := serializeAEADEncrypted(&buf, CipherAES256, AEADModeGCM, 6, sessionKey, contents); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("failed to read SymmetricKeyEncrypted: %s", err)
+	}
+	ske, ok := p.(*SymmetricKeyEncrypted)
+	if !ok || ske.Version != 6 {
+		t.Fatal("didn't find a version 6 SymmetricKeyEncrypted packet")
+	}
+	if _, _, err := ske.Decrypt([]byte("wrong")); err != errors.ErrKeyIncorrect {
+		t.Errorf("Decrypt with wrong passphrase: got %v, want ErrKeyIncorrect", err)
+	}
+	key, _, err := ske.Decrypt(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, sessionKey) {
+		t.Errorf("bad session key got:%x want:%x", key, sessionKey)
+	}
+
+	p, err = Read(&buf)
+	if err != nil {
+		t.Fatalf("failed to read SymmetricallyEncrypted: %s", err)
+	}
+	r, err := p.(*SymmetricallyEncrypted).Decrypt(0, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, contents) {
+		t.Errorf("bad contents got:%x want:%x", got, contents)
+	}
+}
+
 func TestSerializeSymmetricKeyEncryptedCiphers(t *testing.T) {
 	tests := [...]struct {
 		cipherFunc CipherFunction
@@ -114,3 +191,38 @@ func TestSerializeSymmetricKeyEncryptedCiphers(t *testing.T) {
 		}
 	}
 }
+
+func TestSerializeSymmetricKeyEncryptedV6(t *testing.T) {
+	passphrase := []byte("testing")
+	for _, mode := range []AEADMode{AEADModeEAX, AEADModeOCB, AEADModeGCM} {
+		var buf bytes.Buffer
+		config := &Config{DefaultCipher: CipherAES256, AEAD: &AEADConfig{Mode: mode}}
+		key, err := SerializeSymmetricKeyEncrypted(&buf, passphrase, config)
+		if err != nil {
+			t.Fatalf("mode %d: failed to serialize: %s", mode, err)
+		}
+		p, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("mode %d: failed to reparse: %s", mode, err)
+		}
+		ske, ok := p.(*SymmetricKeyEncrypted)
+		if !ok || ske.Version != 6 || ske.Mode != mode {
+			t.Fatalf("mode %d: got %#v", mode, p)
+		}
+		parsedKey, cipherFunc, err := ske.Decrypt(passphrase)
+		if err != nil {
+			t.Fatalf("mode %d: failed to decrypt: %s", mode, err)
+		}
+		if !bytes.Equal(key, parsedKey) || cipherFunc != CipherAES256 {
+			t.Errorf("mode %d: got key %x and cipher %d, want %x and %d", mode, parsedKey, cipherFunc, key, CipherAES256)
+		}
+		if _, _, err := ske.Decrypt([]byte("wrong")); err != errors.ErrKeyIncorrect {
+			t.Errorf("mode %d: Decrypt with wrong passphrase: got %v, want ErrKeyIncorrect", mode, err)
+		}
+	}
+
+	config := &Config{DefaultCipher: CipherCAST5, AEAD: &AEADConfig{}}
+	if _, err := SerializeSymmetricKeyEncrypted(io.Discard, passphrase, config); err == nil {
+		t.Error("SerializeSymmetricKeyEncrypted succeeded with a 64-bit cipher")
+	}
+}
@@ -17,14 +17,28 @@ import (
 
 // SymmetricallyEncrypted represents a symmetrically encrypted byte string. The
 // encrypted contents will consist of more OpenPGP packets. See RFC 4880,
-// sections 5.7 and 5.13.
+// sections 5.7 and 5.13, and RFC 9580, section 5.13.
 type SymmetricallyEncrypted struct {
-	MDC      bool // true iff this is a type 18 packet and thus has an embedded MAC.
+	MDC bool // true iff this is a type 18 packet and thus has an embedded MAC.
+	// Version is the version of a type 18 packet: 1 for CFB encryption
+	// with an MDC, or 2 for AEAD encryption as specified in RFC 9580,
+	// section 5.13.2.
+	Version int
+
+	// The following fields are only set for version 2 packets.
+	Cipher        CipherFunction
+	Mode          AEADMode
+	ChunkSizeByte byte
+	salt          [32]byte
+
 	contents io.Reader
 	prefix   []byte
 }
 
-const symmetricallyEncryptedVersion = 1
+const (
+	symmetricallyEncryptedVersion   = 1
+	symmetricallyEncryptedVersionV2 = 2
+)
 
 func (se *SymmetricallyEncrypted) parse(r io.Reader) error {
 	if se.MDC {
@@ -34,9 +48,16 @@ func (se *SymmetricallyEncrypted) parse(r io.Reader) error {
 		if err != nil {
 			return err
 		}
-		if buf[0] != symmetricallyEncryptedVersion {
+		switch buf[0] {
+		case symmetricallyEncryptedVersion:
+		case symmetricallyEncryptedVersionV2:
+			if err := se.parseV2(r); err != nil {
+				return err
+			}
+		default:
 			return errors.UnsupportedError("unknown SymmetricallyEncrypted version")
 		}
+		se.Version = int(buf[0])
 	}
 	se.contents = r
 	return nil
@@ -45,7 +66,13 @@ func (se *SymmetricallyEncrypted) parse(r io.Reader) error {
 // Decrypt returns a ReadCloser, from which the decrypted contents of the
 // packet can be read. An incorrect key can, with high probability, be detected
 // immediately and this will result in a KeyIncorrect error being returned.
+//
+// Version 2 packets name their own cipher, so c is ignored for them.
 func (se *SymmetricallyEncrypted) Decrypt(c CipherFunction, key []byte) (io.ReadCloser, error) {
+	if se.Version == symmetricallyEncryptedVersionV2 {
+		return se.decryptV2(key)
+	}
+
 	keySize := c.KeySize()
 	if keySize == 0 {
 		return nil, errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(c)))
@@ -252,17 +279,31 @@ func (c noOpCloser) Close() error {
 
 // SerializeSymmetricallyEncrypted serializes a symmetrically encrypted packet
 // to w and returns a WriteCloser to which the to-be-encrypted packets can be
-// written.
+// written. The packet is a version 2 packet if config.AEAD is set, and
+// version 1 otherwise.
 // If config is nil, sensible defaults will be used.
 func SerializeSymmetricallyEncrypted(w io.Writer, c CipherFunction, key []byte, config *Config) (contents io.WriteCloser, err error) {
 	if c.KeySize() != len(key) {
 		return nil, errors.InvalidArgumentError("SymmetricallyEncrypted.Serialize: bad key length")
 	}
+	var chunkSizeByte byte
+	aeadConfig := config.aead()
+	if aeadConfig != nil {
+		if c.blockSize() != 16 {
+			return nil, errors.UnsupportedError("AEAD encryption with cipher " + strconv.Itoa(int(c)))
+		}
+		if chunkSizeByte, err = aeadConfig.chunkSizeByte(); err != nil {
+			return
+		}
+	}
 	writeCloser := noOpCloser{w}
 	ciphertext, err := serializeStreamHeader(writeCloser, packetTypeSymmetricallyEncryptedMDC)
 	if err != nil {
 		return
 	}
+	if aeadConfig != nil {
+		return serializeSymmetricallyEncryptedV2(ciphertext, c, aeadConfig.mode(), chunkSizeByte, key, config.Random())
+	}
 
 	_, err = ciphertext.Write([]byte{symmetricallyEncryptedVersion})
 	if err != nil {
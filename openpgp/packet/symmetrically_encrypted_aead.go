@@ -0,0 +1,301 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packet
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"strconv"
+
+	"github.com/gitpod-io/golang-crypto/openpgp/errors"
+)
+
+// maxChunkSizeByte is the largest chunk size octet that is accepted, which
+// corresponds to 4 MiB chunks. See RFC 9580, section 5.13.2.
+const maxChunkSizeByte = 16
+
+// parseV2 parses the fields of a version 2 packet that follow the version
+// number. See RFC 9580, section 5.13.2.
+func (se *SymmetricallyEncrypted) parseV2(r io.Reader) error {
+	var buf [3]byte
+	if _, err := readFull(r, buf[:]); err != nil {
+		return err
+	}
+	se.Cipher = CipherFunction(buf[0])
+	se.Mode = AEADMode(buf[1])
+	se.ChunkSizeByte = buf[2]
+	if se.Cipher.KeySize() == 0 || se.Cipher.blockSize() != 16 {
+		return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(buf[0])))
+	}
+	if se.Mode.NonceLength() == 0 {
+		return errors.UnsupportedError("unknown AEAD mode: " + strconv.Itoa(int(buf[1])))
+	}
+	if se.ChunkSizeByte > maxChunkSizeByte {
+		return errors.UnsupportedError("AEAD chunk size octet: " + strconv.Itoa(int(buf[2])))
+	}
+	_, err := readFull(r, se.salt[:])
+	return err
+}
+
+// decryptV2 derives the message key from the session key and returns a
+// reader for the plaintext. The first chunk is authenticated before
+// returning, so that a wrong key is detected immediately.
+func (se *SymmetricallyEncrypted) decryptV2(key []byte) (io.ReadCloser, error) {
+	keySize := se.Cipher.KeySize()
+	if len(key) != keySize {
+		return nil, errors.InvalidArgumentError("SymmetricallyEncrypted: incorrect key length")
+	}
+
+	adata := []byte{0xc0 | byte(packetTypeSymmetricallyEncryptedMDC), symmetricallyEncryptedVersionV2, byte(se.Cipher), byte(se.Mode), se.ChunkSizeByte}
+	nonceLen := se.Mode.NonceLength()
+	keyAndIV, err := deriveAEADKey(key, se.salt[:], adata, keySize+nonceLen-8)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := se.Mode.new(se.Cipher.new(keyAndIV[:keySize]))
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := 1 << (se.ChunkSizeByte + 6)
+	tagLen := se.Mode.TagLength()
+	// The buffer holds a chunk along with the final tag that may follow
+	// it, which can only be told apart from another chunk at EOF.
+	bufSize := chunkSize + 2*tagLen
+	if se.prefix == nil {
+		buf := make([]byte, bufSize)
+		n, err := readFull(se.contents, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		se.prefix = buf[:n]
+	}
+
+	ar := &aeadReader{
+		aead:      aead,
+		r:         se.contents,
+		iv:        keyAndIV[keySize:],
+		adata:     adata,
+		chunkSize: chunkSize,
+		buf:       append(make([]byte, 0, bufSize), se.prefix...),
+	}
+	if err := ar.nextChunk(); err != nil {
+		// Nothing has been authenticated yet if the index did not move,
+		// which means that the key is wrong.
+		if _, ok := err.(errors.SignatureError); ok && ar.index == 0 {
+			return nil, errors.ErrKeyIncorrect
+		}
+		return nil, err
+	}
+	return ar, nil
+}
+
+// aeadReader decrypts and authenticates the chunks of a version 2
+// SymmetricallyEncrypted packet. See RFC 9580, section 5.13.2.
+type aeadReader struct {
+	aead      cipher.AEAD
+	r         io.Reader
+	iv        []byte
+	adata     []byte
+	chunkSize int
+
+	index     uint64 // index of the next chunk
+	total     uint64 // plaintext bytes so far
+	buf       []byte // ciphertext read ahead
+	out       []byte // buffer for decrypted chunks
+	plaintext []byte // decrypted data not yet returned
+	eof       bool   // the final tag was verified
+	err       error
+}
+
+func (ar *aeadReader) nonce(index uint64) []byte {
+	nonce := make([]byte, len(ar.iv)+8)
+	copy(nonce, ar.iv)
+	binary.BigEndian.PutUint64(nonce[len(ar.iv):], index)
+	return nonce
+}
+
+// nextChunk decrypts the next chunk into ar.plaintext and, at the end of the
+// packet, checks the final authentication tag.
+func (ar *aeadReader) nextChunk() error {
+	n, err := readFull(ar.r, ar.buf[len(ar.buf):cap(ar.buf)])
+	ar.buf = ar.buf[:len(ar.buf)+n]
+	atEOF := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		atEOF = true
+	default:
+		return err
+	}
+
+	tagLen := ar.aead.Overhead()
+	chunk := ar.buf[:ar.chunkSize+tagLen]
+	if atEOF {
+		if len(ar.buf) < tagLen {
+			return errors.SignatureError("AEAD encrypted data truncated")
+		}
+		chunk = ar.buf[:len(ar.buf)-tagLen]
+	}
+
+	if len(chunk) > 0 {
+		if len(chunk) < tagLen {
+			return errors.SignatureError("AEAD encrypted data truncated")
+		}
+		if ar.out == nil {
+			ar.out = make([]byte, 0, ar.chunkSize)
+		}
+		ar.plaintext, err = ar.aead.Open(ar.out[:0], ar.nonce(ar.index), chunk, ar.adata)
+		if err != nil {
+			return errors.SignatureError("AEAD authentication failure")
+		}
+		ar.index++
+		ar.total += uint64(len(ar.plaintext))
+	}
+
+	if atEOF {
+		adata := make([]byte, len(ar.adata)+8)
+		copy(adata, ar.adata)
+		binary.BigEndian.PutUint64(adata[len(ar.adata):], ar.total)
+		if _, err := ar.aead.Open(nil, ar.nonce(ar.index), ar.buf[len(chunk):], adata); err != nil {
+			return errors.SignatureError("AEAD final authentication tag mismatch")
+		}
+		ar.eof = true
+		return nil
+	}
+
+	// Keep the bytes read past the chunk for the next call.
+	ar.buf = ar.buf[:copy(ar.buf, ar.buf[len(chunk):])]
+	return nil
+}
+
+func (ar *aeadReader) Read(buf []byte) (n int, err error) {
+	for len(ar.plaintext) == 0 {
+		if ar.err != nil {
+			return 0, ar.err
+		}
+		if ar.eof {
+			return 0, io.EOF
+		}
+		ar.err = ar.nextChunk()
+	}
+	n = copy(buf, ar.plaintext)
+	ar.plaintext = ar.plaintext[n:]
+	return n, nil
+}
+
+// Close reads the rest of the packet in order to check its authentication
+// tags, like the Close method of the readers for MDC packets.
+func (ar *aeadReader) Close() error {
+	var buf [1024]byte
+	for {
+		_, err := ar.Read(buf[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// serializeSymmetricallyEncryptedV2 writes the fields of a version 2 packet
+// to ciphertext and returns a writer for the plaintext. See RFC 9580,
+// section 5.13.2.
+func serializeSymmetricallyEncryptedV2(ciphertext io.WriteCloser, c CipherFunction, mode AEADMode, chunkSizeByte byte, key []byte, rand io.Reader) (io.WriteCloser, error) {
+	adata := []byte{0xc0 | byte(packetTypeSymmetricallyEncryptedMDC), symmetricallyEncryptedVersionV2, byte(c), byte(mode), chunkSizeByte}
+	var salt [32]byte
+	if _, err := io.ReadFull(rand, salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := ciphertext.Write(adata[1:]); err != nil {
+		return nil, err
+	}
+	if _, err := ciphertext.Write(salt[:]); err != nil {
+		return nil, err
+	}
+
+	keySize := c.KeySize()
+	keyAndIV, err := deriveAEADKey(key, salt[:], adata, keySize+mode.NonceLength()-8)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := mode.new(c.new(keyAndIV[:keySize]))
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := 1 << (chunkSizeByte + 6)
+	return &aeadWriter{
+		aead:      aead,
+		w:         ciphertext,
+		iv:        keyAndIV[keySize:],
+		adata:     adata,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// aeadWriter encrypts and authenticates the plaintext of a version 2
+// SymmetricallyEncrypted packet in chunks. On Close, it writes the last
+// chunk and the final authentication tag.
+type aeadWriter struct {
+	aead      cipher.AEAD
+	w         io.WriteCloser
+	iv        []byte
+	adata     []byte
+	chunkSize int
+
+	index uint64 // index of the next chunk
+	total uint64 // plaintext bytes so far
+	buf   []byte // plaintext of the next chunk
+	out   []byte // buffer for encrypted chunks
+}
+
+func (aw *aeadWriter) nonce(index uint64) []byte {
+	nonce := make([]byte, len(aw.iv)+8)
+	copy(nonce, aw.iv)
+	binary.BigEndian.PutUint64(nonce[len(aw.iv):], index)
+	return nonce
+}
+
+func (aw *aeadWriter) Write(buf []byte) (n int, err error) {
+	for len(buf) > 0 {
+		m := copy(aw.buf[len(aw.buf):aw.chunkSize], buf)
+		aw.buf = aw.buf[:len(aw.buf)+m]
+		buf = buf[m:]
+		n += m
+		if len(aw.buf) == aw.chunkSize {
+			if err := aw.writeChunk(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (aw *aeadWriter) writeChunk() error {
+	aw.out = aw.aead.Seal(aw.out[:0], aw.nonce(aw.index), aw.buf, aw.adata)
+	aw.index++
+	aw.total += uint64(len(aw.buf))
+	aw.buf = aw.buf[:0]
+	_, err := aw.w.Write(aw.out)
+	return err
+}
+
+func (aw *aeadWriter) Close() error {
+	if len(aw.buf) > 0 {
+		if err := aw.writeChunk(); err != nil {
+			return err
+		}
+	}
+	adata := make([]byte, len(aw.adata)+8)
+	copy(adata, aw.adata)
+	binary.BigEndian.PutUint64(adata[len(aw.adata):], aw.total)
+	if _, err := aw.w.Write(aw.aead.Seal(nil, aw.nonce(aw.index), nil, adata)); err != nil {
+		return err
+	}
+	return aw.w.Close()
+}
@@ -6,7 +6,9 @@ package packet
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/binary"
 	"encoding/hex"
 	"io"
 	"testing"
@@ -121,3 +123,157 @@ func TestSerialize(t *testing.T) {
 		t.Errorf("contents not equal got: %x want: %x", contentsCopy.Bytes(), contents)
 	}
 }
+
+// serializeAEADEncrypted writes a version 2 SymmetricallyEncrypted packet
+// containing plaintext to w.
+func serializeAEADEncrypted(w io.Writer, c CipherFunction, mode AEADMode, chunkSizeByte byte, key, plaintext []byte) error {
+	var salt [32]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return err
+	}
+	adata := []byte{0xc0 | byte(packetTypeSymmetricallyEncryptedMDC), symmetricallyEncryptedVersionV2, byte(c), byte(mode), chunkSizeByte}
+	keyAndIV, err := deriveAEADKey(key, salt[:], adata, c.KeySize()+mode.NonceLength()-8)
+	if err != nil {
+		return err
+	}
+	aead, err := mode.new(c.new(keyAndIV[:c.KeySize()]))
+	if err != nil {
+		return err
+	}
+	nonce := func(index uint64) []byte {
+		n := append([]byte{}, keyAndIV[c.KeySize():]...)
+		return binary.BigEndian.AppendUint64(n, index)
+	}
+
+	body := append(adata[1:], salt[:]...)
+	chunkSize := 1 << (chunkSizeByte + 6)
+	var index uint64
+	for i := 0; i < len(plaintext); i += chunkSize {
+		end := i + chunkSize
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		chunk := plaintext[i:end]
+		body = aead.Seal(body, nonce(index), chunk, adata)
+		index++
+	}
+	finalAdata := binary.BigEndian.AppendUint64(append([]byte{}, adata...), uint64(len(plaintext)))
+	body = aead.Seal(body, nonce(index), nil, finalAdata)
+
+	if err := serializeHeader(w, packetTypeSymmetricallyEncryptedMDC, len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+func TestAEADEncrypted(t *testing.T) {
+	key := make([]byte, CipherAES256.KeySize())
+	rand.Read(key)
+	for _, n := range []int{0, 1, 63, 64, 65, 200} {
+		plaintext := make([]byte, n)
+		rand.Read(plaintext)
+		var buf bytes.Buffer
+		if err := serializeAEADEncrypted(&buf, CipherAES256, AEADModeGCM, 0, key, plaintext); err != nil {
+			t.Fatal(err)
+		}
+		encrypted := buf.Bytes()
+
+		p, err := Read(bytes.NewReader(encrypted))
+		if err != nil {
+			t.Fatalf("%d bytes: error from Read: %s", n, err)
+		}
+		se, ok := p.(*SymmetricallyEncrypted)
+		if !ok || se.Version != 2 {
+			t.Fatalf("%d bytes: didn't read a version 2 *SymmetricallyEncrypted", n)
+		}
+		wrongKey := make([]byte, len(key))
+		if _, err := se.Decrypt(0, wrongKey); err != errors.ErrKeyIncorrect {
+			t.Errorf("%d bytes: Decrypt with wrong key: got %v, want ErrKeyIncorrect", n, err)
+		}
+		r, err := se.Decrypt(0, key)
+		if err != nil {
+			t.Fatalf("%d bytes: error from Decrypt: %s", n, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%d bytes: error from ReadAll: %s", n, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%d bytes: error from Close: %s", n, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes: contents not equal got: %x want: %x", n, got, plaintext)
+		}
+
+		// Corrupting the last byte breaks the final authentication tag,
+		// which for an empty message can't be told apart from a wrong key.
+		if n == 0 {
+			continue
+		}
+		encrypted[len(encrypted)-1] ^= 1
+		p, err = Read(bytes.NewReader(encrypted))
+		if err != nil {
+			t.Fatalf("%d bytes: error from Read: %s", n, err)
+		}
+		r, err = p.(*SymmetricallyEncrypted).Decrypt(0, key)
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if _, ok := err.(errors.SignatureError); !ok {
+			t.Errorf("%d bytes: corruption: expected SignatureError, got: %v", n, err)
+		}
+	}
+}
+
+func TestSerializeAEADEncrypted(t *testing.T) {
+	key := make([]byte, CipherAES128.KeySize())
+	rand.Read(key)
+	for _, mode := range []AEADMode{AEADModeEAX, AEADModeOCB, AEADModeGCM} {
+		for _, n := range []int{0, 1, 64, 65, 200} {
+			plaintext := make([]byte, n)
+			rand.Read(plaintext)
+			var buf bytes.Buffer
+			config := &Config{AEAD: &AEADConfig{Mode: mode, ChunkSize: 64}}
+			w, err := SerializeSymmetricallyEncrypted(&buf, CipherAES128, key, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Write in two parts to cross chunk boundaries.
+			if _, err := w.Write(plaintext[:n/3]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(plaintext[n/3:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := Read(&buf)
+			if err != nil {
+				t.Fatalf("mode %d, %d bytes: error from Read: %s", mode, n, err)
+			}
+			se, ok := p.(*SymmetricallyEncrypted)
+			if !ok || se.Version != 2 || se.Mode != mode || se.ChunkSizeByte != 0 {
+				t.Fatalf("mode %d, %d bytes: got %#v", mode, n, p)
+			}
+			r, err := se.Decrypt(0, key)
+			if err != nil {
+				t.Fatalf("mode %d, %d bytes: error from Decrypt: %s", mode, n, err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("mode %d, %d bytes: error from ReadAll: %s", mode, n, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("mode %d, %d bytes: contents not equal got: %x want: %x", mode, n, got, plaintext)
+			}
+		}
+	}
+
+	config := &Config{AEAD: &AEADConfig{ChunkSize: 100}}
+	if _, err := SerializeSymmetricallyEncrypted(io.Discard, CipherAES128, key, config); err == nil {
+		t.Error("SerializeSymmetricallyEncrypted succeeded with an invalid chunk size")
+	}
+}
@@ -63,7 +63,7 @@ type MessageDetails struct {
 	// valid. (An authentication code failure is reported as a
 	// SignatureError error when reading from UnverifiedBody.)
 	SignatureError error               // nil if the signature is good.
-	Signature      *packet.Signature   // the signature packet itself, if v4 (default)
+	Signature      *packet.Signature   // the signature packet itself, if v4 (default) or v6
 	SignatureV3    *packet.SignatureV3 // the signature packet if it is a v2 or v3 signature
 
 	decrypted io.ReadCloser
@@ -118,10 +118,7 @@ ParsePackets:
 		case *packet.EncryptedKey:
 			// This packet contains the decryption key encrypted to a public key.
 			md.EncryptedToKeyIds = append(md.EncryptedToKeyIds, p.KeyId)
-			switch p.Algo {
-			case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly, packet.PubKeyAlgoElGamal:
-				break
-			default:
+			if !p.Algo.CanEncrypt() {
 				continue
 			}
 			var keys []Key
@@ -178,7 +175,7 @@ FindKey:
 					break FindKey
 				}
 			} else {
-				fpr := string(pk.key.PublicKey.Fingerprint[:])
+				fpr := string(pk.key.PublicKey.FingerprintBytes())
 				if v := candidateFingerprints[fpr]; v {
 					continue
 				}
@@ -253,7 +250,7 @@ FindLiteralData:
 				return nil, errors.UnsupportedError("nested signatures")
 			}
 
-			h, wrappedHash, err = hashForSignature(p.Hash, p.SigType)
+			h, wrappedHash, err = hashForSignature(p.Hash, p.SigType, p.Salt)
 			if err != nil {
 				md = nil
 				return
@@ -286,12 +283,14 @@ FindLiteralData:
 // signature. The signature may specify that the contents of the signed message
 // should be preprocessed (i.e. to normalize line endings). Thus this function
 // returns two hashes. The second should be used to hash the message itself and
-// performs any needed preprocessing.
-func hashForSignature(hashId crypto.Hash, sigType packet.SignatureType) (hash.Hash, hash.Hash, error) {
+// performs any needed preprocessing. The salt of v6 signatures, if any, is
+// hashed first.
+func hashForSignature(hashId crypto.Hash, sigType packet.SignatureType, salt []byte) (hash.Hash, hash.Hash, error) {
 	if !hashId.Available() {
 		return nil, nil, errors.UnsupportedError("hash not available: " + strconv.Itoa(int(hashId)))
 	}
 	h := hashId.New()
+	h.Write(salt)
 
 	switch sigType {
 	case packet.SigTypeBinary:
@@ -370,6 +369,7 @@ func CheckDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signe
 	var issuerKeyId uint64
 	var hashFunc crypto.Hash
 	var sigType packet.SignatureType
+	var salt []byte
 	var keys []Key
 	var p packet.Packet
 
@@ -391,6 +391,7 @@ func CheckDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signe
 			issuerKeyId = *sig.IssuerKeyId
 			hashFunc = sig.Hash
 			sigType = sig.SigType
+			salt = sig.Salt
 		case *packet.SignatureV3:
 			issuerKeyId = sig.IssuerKeyId
 			hashFunc = sig.Hash
@@ -409,7 +410,7 @@ func CheckDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signe
 		panic("unreachable")
 	}
 
-	h, wrappedHash, err := hashForSignature(hashFunc, sigType)
+	h, wrappedHash, err := hashForSignature(hashFunc, sigType, salt)
 	if err != nil {
 		return nil, err
 	}
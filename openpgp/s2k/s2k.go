@@ -3,7 +3,7 @@
 // license that can be found in the LICENSE file.
 
 // Package s2k implements the various OpenPGP string-to-key transforms as
-// specified in RFC 4800 section 3.7.1.
+// specified in RFC 4800 section 3.7.1 and RFC 9580 section 3.7.1.
 //
 // Deprecated: this package is unmaintained except for security fixes. New
 // applications should consider a more focused, modern alternative to OpenPGP
@@ -18,6 +18,7 @@ import (
 	"io"
 	"strconv"
 
+	"github.com/gitpod-io/golang-crypto/argon2"
 	"github.com/gitpod-io/golang-crypto/openpgp/errors"
 )
 
@@ -40,6 +41,46 @@ type Config struct {
 	// use a value that is at least 65536. See RFC 4880 Section
 	// 3.7.1.3.
 	S2KCount int
+	// Argon2, if not nil, selects the memory-hard Argon2 S2K function
+	// of RFC 9580, section 3.7.1.4, instead of the iterated and salted
+	// function. Hash and S2KCount are then ignored. Argon2 S2K
+	// specifiers are not understood by implementations of RFC 4880.
+	Argon2 *Argon2Config
+}
+
+// Argon2Config holds the parameters of the Argon2 S2K function. The zero
+// value selects the second recommended option of RFC 9106, section 4:
+// three passes, four lanes and 64 MiB of memory.
+type Argon2Config struct {
+	// Passes is the number of passes over the memory, t in RFC 9106.
+	Passes uint8
+	// Parallelism is the number of lanes, p in RFC 9106.
+	Parallelism uint8
+	// MemoryExp is the base two logarithm of the amount of memory to
+	// use, in KiB. It must be at most 31 and large enough to give each
+	// lane at least 8 KiB.
+	MemoryExp uint8
+}
+
+func (c *Argon2Config) passes() uint8 {
+	if c.Passes == 0 {
+		return 3
+	}
+	return c.Passes
+}
+
+func (c *Argon2Config) parallelism() uint8 {
+	if c.Parallelism == 0 {
+		return 4
+	}
+	return c.Parallelism
+}
+
+func (c *Argon2Config) memoryExp() uint8 {
+	if c.MemoryExp == 0 {
+		return 16
+	}
+	return c.MemoryExp
 }
 
 func (c *Config) hash() crypto.Hash {
@@ -160,9 +201,34 @@ func Iterated(out []byte, h hash.Hash, in []byte, salt []byte, count int) {
 // Parse reads a binary specification for a string-to-key transformation from r
 // and returns a function which performs that transform.
 func Parse(r io.Reader) (f func(out, in []byte), err error) {
-	var buf [9]byte
+	var buf [19]byte
 
-	_, err = io.ReadFull(r, buf[:2])
+	_, err = io.ReadFull(r, buf[:1])
+	if err != nil {
+		return
+	}
+
+	if buf[0] == 4 {
+		// Argon2, RFC 9580, section 3.7.1.4.
+		_, err = io.ReadFull(r, buf[:19])
+		if err != nil {
+			return
+		}
+		salt := buf[:16]
+		passes, parallelism, memoryExp := buf[16], buf[17], buf[18]
+		if passes == 0 || parallelism == 0 {
+			return nil, errors.StructuralError("invalid Argon2 parameters")
+		}
+		if memoryExp > 31 || uint64(1)<<memoryExp < 8*uint64(parallelism) {
+			return nil, errors.StructuralError("invalid Argon2 memory size: " + strconv.Itoa(int(memoryExp)))
+		}
+		f := func(out, in []byte) {
+			Argon2(out, in, salt, passes, parallelism, memoryExp)
+		}
+		return f, nil
+	}
+
+	_, err = io.ReadFull(r, buf[1:2])
 	if err != nil {
 		return
 	}
@@ -206,11 +272,23 @@ func Parse(r io.Reader) (f func(out, in []byte), err error) {
 	return nil, errors.UnsupportedError("S2K function")
 }
 
+// Argon2 writes to out the result of computing the Argon2 S2K function (RFC
+// 9580, section 3.7.1.4) using the given passphrase, salt and parameters. The
+// amount of memory used is 2**memoryExp KiB.
+func Argon2(out, in, salt []byte, passes, parallelism, memoryExp uint8) {
+	key := argon2.IDKey(in, salt, uint32(passes), 1<<memoryExp, parallelism, uint32(len(out)))
+	copy(out, key)
+}
+
 // Serialize salts and stretches the given passphrase and writes the
 // resulting key into key. It also serializes an S2K descriptor to
 // w. The key stretching can be configured with c, which may be
 // nil. In that case, sensible defaults will be used.
 func Serialize(w io.Writer, key []byte, rand io.Reader, passphrase []byte, c *Config) error {
+	if c != nil && c.Argon2 != nil {
+		return serializeArgon2(w, key, rand, passphrase, c.Argon2)
+	}
+
 	var buf [11]byte
 	buf[0] = 3 /* iterated and salted */
 	buf[1], _ = HashToHashId(c.hash())
@@ -229,8 +307,32 @@ func Serialize(w io.Writer, key []byte, rand io.Reader, passphrase []byte, c *Co
 	return nil
 }
 
+func serializeArgon2(w io.Writer, key []byte, rand io.Reader, passphrase []byte, c *Argon2Config) error {
+	passes, parallelism, memoryExp := c.passes(), c.parallelism(), c.memoryExp()
+	if memoryExp > 31 || uint64(1)<<memoryExp < 8*uint64(parallelism) {
+		return errors.InvalidArgumentError("invalid Argon2 memory size: " + strconv.Itoa(int(memoryExp)))
+	}
+
+	var buf [20]byte
+	buf[0] = 4 /* Argon2 */
+	salt := buf[1:17]
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return err
+	}
+	buf[17] = passes
+	buf[18] = parallelism
+	buf[19] = memoryExp
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+
+	Argon2(key, passphrase, salt, passes, parallelism, memoryExp)
+	return nil
+}
+
 // hashToHashIdMapping contains pairs relating OpenPGP's hash identifier with
-// Go's crypto.Hash type. See RFC 4880, section 9.4.
+// Go's crypto.Hash type. See RFC 4880, section 9.4, and RFC 9580, section
+// 9.5.
 var hashToHashIdMapping = []struct {
 	id   byte
 	hash crypto.Hash
@@ -243,6 +345,8 @@ var hashToHashIdMapping = []struct {
 	{9, crypto.SHA384, "SHA384"},
 	{10, crypto.SHA512, "SHA512"},
 	{11, crypto.SHA224, "SHA224"},
+	{12, crypto.SHA3_256, "SHA3-256"},
+	{14, crypto.SHA3_512, "SHA3-512"},
 }
 
 // HashIdToHash returns a crypto.Hash which corresponds to the given OpenPGP
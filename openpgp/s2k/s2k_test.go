@@ -15,6 +15,7 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/gitpod-io/golang-crypto/argon2"
 	_ "github.com/gitpod-io/golang-crypto/ripemd160"
 )
 
@@ -101,6 +102,29 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseArgon2(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	spec := append([]byte{4}, salt...)
+	spec = append(spec, 2, 1, 10)
+	f, err := Parse(bytes.NewReader(spec))
+	if err != nil {
+		t.Fatalf("Parse returned error: %s", err)
+	}
+	out := make([]byte, 32)
+	f(out, []byte("hello"))
+	if expected := argon2.IDKey([]byte("hello"), salt, 2, 1024, 1, 32); !bytes.Equal(out, expected) {
+		t.Errorf("output got: %x want: %x", out, expected)
+	}
+
+	for _, params := range [][3]byte{{0, 1, 10}, {1, 0, 10}, {1, 4, 4}, {1, 1, 32}} {
+		spec := append([]byte{4}, salt...)
+		spec = append(spec, params[:]...)
+		if _, err := Parse(bytes.NewReader(spec)); err == nil {
+			t.Errorf("Parse succeeded with invalid parameters %v", params)
+		}
+	}
+}
+
 func TestSerialize(t *testing.T) {
 	hashes := []crypto.Hash{crypto.MD5, crypto.SHA1, crypto.RIPEMD160,
 		crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.SHA224}
@@ -110,6 +134,7 @@ func TestSerialize(t *testing.T) {
 			testSerializeConfig(t, &Config{Hash: h, S2KCount: c})
 		}
 	}
+	testSerializeConfig(t, &Config{Argon2: &Argon2Config{Passes: 1, Parallelism: 2, MemoryExp: 10}})
 }
 
 func testSerializeConfig(t *testing.T, c *Config) {
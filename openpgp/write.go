@@ -67,14 +67,8 @@ func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.S
 		return errors.InvalidArgumentError("signing key is encrypted")
 	}
 
-	sig := new(packet.Signature)
-	sig.SigType = sigType
-	sig.PubKeyAlgo = signer.PrivateKey.PubKeyAlgo
-	sig.Hash = config.Hash()
-	sig.CreationTime = config.Now()
-	sig.IssuerKeyId = &signer.PrivateKey.KeyId
-
-	h, wrappedHash, err := hashForSignature(sig.Hash, sig.SigType)
+	sig := newMessageSignature(signer.PrivateKey, sigType, config.Hash(), config)
+	h, wrappedHash, err := hashForSignature(sig.Hash, sig.SigType, nil)
 	if err != nil {
 		return
 	}
@@ -88,6 +82,26 @@ func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.S
 	return sig.Serialize(w)
 }
 
+// newMessageSignature returns a signature of type sigType of a message by
+// signer, using hashType, with the creation time, expiration and issuer
+// subpackets requested by config.
+func newMessageSignature(signer *packet.PrivateKey, sigType packet.SignatureType, hashType crypto.Hash, config *packet.Config) *packet.Signature {
+	sig := &packet.Signature{
+		SigType:      sigType,
+		PubKeyAlgo:   signer.PubKeyAlgo,
+		Hash:         hashType,
+		CreationTime: config.Now(),
+		IssuerKeyId:  &signer.KeyId,
+	}
+	if lifetime := config.SigLifetime(); lifetime != 0 {
+		sig.SigLifetimeSecs = &lifetime
+	}
+	if config.UseIssuerFingerprint() {
+		sig.IssuerFingerprint = signer.Fingerprint[:]
+	}
+	return sig
+}
+
 // FileHints contains metadata about encrypted files. This metadata is, itself,
 // encrypted.
 type FileHints struct {
@@ -256,7 +270,8 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 // it. hints contains optional information, that is also encrypted, that aids
 // the recipients in processing the message. The resulting WriteCloser must
 // be closed after the contents of the file have been written.
-// If config is nil, sensible defaults will be used.
+// If config is nil, sensible defaults will be used. The message is always
+// protected by an MDC: config.AEAD only applies to SymmetricallyEncrypt.
 func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
 	if len(to) == 0 {
 		return nil, errors.InvalidArgumentError("no encryption recipient provided")
@@ -290,7 +305,7 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(to[i].PrimaryKey.KeyId, 16) + " because it has no encryption keys")
 		}
 
-		sig := to[i].primaryIdentity().SelfSignature
+		sig := to[i].primarySelfSignature()
 
 		preferredSymmetric := sig.PreferredSymmetric
 		if len(preferredSymmetric) == 0 {
@@ -330,6 +345,13 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		}
 	}
 
+	// Version 2 SymmetricallyEncrypted packets must be preceded by
+	// version 6 EncryptedKey packets, which are not supported.
+	if config != nil && config.AEAD != nil {
+		c := *config
+		c.AEAD = nil
+		config = &c
+	}
 	payload, err := packet.SerializeSymmetricallyEncrypted(ciphertext, cipher, symKey, config)
 	if err != nil {
 		return
@@ -355,8 +377,11 @@ func Sign(output io.Writer, signed *Entity, hints *FileHints, config *packet.Con
 		hashToHashId(crypto.SHA1),
 		hashToHashId(crypto.RIPEMD160),
 	}
-	defaultHashes := candidateHashes[len(candidateHashes)-1:]
-	preferredHashes := signed.primaryIdentity().SelfSignature.PreferredHash
+	// Signers without hash preferences get SHA-256, which RFC 9580,
+	// section 9.5, requires all implementations to support, rather than
+	// a legacy hash function.
+	defaultHashes := candidateHashes[:1]
+	preferredHashes := signed.primarySelfSignature().PreferredHash
 	if len(preferredHashes) == 0 {
 		preferredHashes = defaultHashes
 	}
@@ -382,13 +407,7 @@ func (s signatureWriter) Write(data []byte) (int, error) {
 }
 
 func (s signatureWriter) Close() error {
-	sig := &packet.Signature{
-		SigType:      packet.SigTypeBinary,
-		PubKeyAlgo:   s.signer.PubKeyAlgo,
-		Hash:         s.hashType,
-		CreationTime: s.config.Now(),
-		IssuerKeyId:  &s.signer.KeyId,
-	}
+	sig := newMessageSignature(s.signer, packet.SigTypeBinary, s.hashType, s.config)
 
 	if err := sig.Sign(s.h, s.signer, s.config); err != nil {
 		return err
@@ -6,6 +6,7 @@ package openpgp
 
 import (
 	"bytes"
+	"crypto"
 	"io"
 	"testing"
 	"time"
@@ -63,6 +64,50 @@ func TestSignDetachedP256(t *testing.T) {
 	testDetachedSignature(t, kring, out, signedInput, "check", testKeyP256KeyId)
 }
 
+func TestSignDetachedOptions(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	config := &packet.Config{
+		DefaultHash:       crypto.SHA512,
+		SigLifetimeSecs:   3600,
+		IssuerFingerprint: true,
+	}
+	out := bytes.NewBuffer(nil)
+	if err := DetachSign(out, kring[0], bytes.NewBufferString(signedInput), config); err != nil {
+		t.Fatal(err)
+	}
+	testDetachedSignature(t, kring, bytes.NewReader(out.Bytes()), signedInput, "check", testKey1KeyId)
+
+	p, err := packet.Read(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		t.Fatalf("got %T, want *packet.Signature", p)
+	}
+	if sig.Hash != crypto.SHA512 {
+		t.Errorf("got hash %v, want SHA-512", sig.Hash)
+	}
+	if sig.SigLifetimeSecs == nil || *sig.SigLifetimeSecs != 3600 {
+		t.Errorf("got signature lifetime %v, want 3600", sig.SigLifetimeSecs)
+	}
+	if fp := kring[0].PrivateKey.Fingerprint; !bytes.Equal(sig.IssuerFingerprint, fp[:]) {
+		t.Errorf("got issuer fingerprint %x, want %x", sig.IssuerFingerprint, fp)
+	}
+
+	// By default, signatures don't expire and have no fingerprint.
+	out.Reset()
+	if err := DetachSign(out, kring[0], bytes.NewBufferString(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = packet.Read(out); err != nil {
+		t.Fatal(err)
+	}
+	if sig := p.(*packet.Signature); sig.Hash != crypto.SHA256 || sig.SigLifetimeSecs != nil || sig.IssuerFingerprint != nil {
+		t.Errorf("got hash %v, lifetime %v and fingerprint %x with the default config", sig.Hash, sig.SigLifetimeSecs, sig.IssuerFingerprint)
+	}
+}
+
 func TestNewEntity(t *testing.T) {
 	if testing.Short() {
 		return
@@ -126,8 +171,14 @@ func TestNewEntity(t *testing.T) {
 }
 
 func TestSymmetricEncryption(t *testing.T) {
+	for _, config := range []*packet.Config{nil, {AEAD: &packet.AEADConfig{}}} {
+		testSymmetricEncryption(t, config)
+	}
+}
+
+func testSymmetricEncryption(t *testing.T, config *packet.Config) {
 	buf := new(bytes.Buffer)
-	plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), nil, nil)
+	plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), nil, config)
 	if err != nil {
 		t.Errorf("error writing headers: %s", err)
 		return
@@ -271,6 +322,50 @@ func TestEncryption(t *testing.T) {
 	}
 }
 
+func TestEncryptionIgnoresAEAD(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	config := &packet.Config{AEAD: &packet.AEADConfig{}}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring[:1], nil, nil /* no hints */, config)
+	if err != nil {
+		t.Fatalf("error in Encrypt: %s", err)
+	}
+	const message = "testing"
+	if _, err := w.Write([]byte(message)); err != nil {
+		t.Fatalf("error writing plaintext: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing WriteCloser: %s", err)
+	}
+
+	packets := packet.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatalf("error reading packets: %s", err)
+		}
+		if se, ok := p.(*packet.SymmetricallyEncrypted); ok {
+			if !se.MDC || se.Version != 1 {
+				t.Errorf("got SymmetricallyEncrypted version %d (MDC %v), want version 1 with an MDC", se.Version, se.MDC)
+			}
+			break
+		}
+	}
+
+	md, err := ReadMessage(buf, kring, nil /* no prompt */, nil)
+	if err != nil {
+		t.Fatalf("error reading message: %s", err)
+	}
+	plaintext, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatalf("error reading encrypted contents: %s", err)
+	}
+	if string(plaintext) != message {
+		t.Errorf("got: %s, want: %s", string(plaintext), message)
+	}
+}
+
 var testSigningTests = []struct {
 	keyRingHex string
 }{
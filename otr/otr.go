@@ -2,12 +2,13 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package otr implements the Off The Record protocol as specified in
-// http://www.cypherpunks.ca/otr/Protocol-v2-3.1.0.html
+// Package otr implements versions 2 and 3 of the Off The Record protocol as
+// specified in https://otr.cypherpunks.ca/Protocol-v3-4.1.1.html, including
+// the Socialist Millionaires' Protocol used to authenticate peers.
 //
-// The version of OTR implemented by this package has been deprecated
-// (https://bugs.otr.im/lib/libotr/issues/140). An implementation of OTRv3 is
-// available at https://github.com/coyim/otr3.
+// Version 3 is used with the peers which support it. Version 2 has been
+// deprecated (https://bugs.otr.im/lib/libotr/issues/140) and is only used
+// with the peers which don't.
 package otr
 
 import (
@@ -21,6 +22,7 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"hash"
@@ -54,7 +56,7 @@ const (
 )
 
 // QueryMessage can be sent to a peer to start an OTR conversation.
-var QueryMessage = "?OTRv2?"
+var QueryMessage = "?OTRv23?"
 
 // ErrorPrefix can be used to make an OTR error by appending an error message
 // to it.
@@ -63,6 +65,7 @@ var ErrorPrefix = "?OTR Error:"
 var (
 	fragmentPartSeparator = []byte(",")
 	fragmentPrefix        = []byte("?OTR,")
+	fragmentPrefixV3      = []byte("?OTR|")
 	msgPrefix             = []byte("?OTR:")
 	queryMarker           = []byte("?OTR")
 )
@@ -100,9 +103,12 @@ func isQuery(msg []byte) (greatestCommonVersion int) {
 			return 0
 		}
 
-		if c == '2' {
+		if c == '2' && greatestCommonVersion < 2 {
 			greatestCommonVersion = 2
 		}
+		if c == '3' {
+			greatestCommonVersion = 3
+		}
 	}
 
 	return 0
@@ -132,6 +138,10 @@ const (
 const (
 	// If the requested fragment size is less than this, it will be ignored.
 	minFragmentSize = 18
+	// The same for OTRv3, whose fragments also hold the instance tags.
+	minFragmentSizeV3 = 36
+	// Instance tags below this value are reserved.
+	minInstanceTag = 0x100
 	// Messages are padded to a multiple of this number of bytes.
 	paddingGranularity = 256
 	// The number of bytes in a Diffie-Hellman private value (320-bits).
@@ -175,13 +185,21 @@ type Conversation struct {
 	// If FragmentSize is set, all messages produced by Receive and Send
 	// will be fragmented into messages of, at most, this number of bytes.
 	FragmentSize int
+	// InstanceTag identifies this client in OTRv3 conversations, so that
+	// several clients logged in to the same account can each have their own
+	// conversation with the peer. Values below 0x100 are reserved: if
+	// InstanceTag is one of them, a random tag is chosen when one is first
+	// needed.
+	InstanceTag uint32
 
 	// Once Receive has returned NewKeys once, the following fields are
-	// valid.
-	SSID           [8]byte
-	TheirPublicKey PublicKey
+	// valid. TheirInstanceTag is zero in OTRv2 conversations.
+	SSID             [8]byte
+	TheirPublicKey   PublicKey
+	TheirInstanceTag uint32
 
 	state, authState int
+	version          int // the protocol version of the key exchange
 
 	r       [16]byte
 	x, y    *big.Int
@@ -270,7 +288,7 @@ const (
 // encryption state and zero or more messages to send back to the peer.
 // These messages do not need to be passed to Send before transmission.
 func (c *Conversation) Receive(in []byte) (out []byte, encrypted bool, change SecurityChange, toSend [][]byte, err error) {
-	if bytes.HasPrefix(in, fragmentPrefix) {
+	if bytes.HasPrefix(in, fragmentPrefix) || bytes.HasPrefix(in, fragmentPrefixV3) {
 		in, err = c.processFragment(in)
 		if in == nil || err != nil {
 			return
@@ -281,6 +299,9 @@ func (c *Conversation) Receive(in []byte) (out []byte, encrypted bool, change Se
 		in = in[len(msgPrefix) : len(in)-1]
 	} else if version := isQuery(in); version > 0 {
 		c.authState = authStateAwaitingDHKey
+		c.version = version
+		// Any instance of the peer's client may answer.
+		c.TheirInstanceTag = 0
 		c.reset()
 		toSend = c.encode(c.generateDHCommit())
 		return
@@ -298,15 +319,45 @@ func (c *Conversation) Receive(in []byte) (out []byte, encrypted bool, change Se
 	}
 	msg = msg[:msgLen]
 
-	// The first two bytes are the protocol version (2)
-	if len(msg) < 3 || msg[0] != 0 || msg[1] != 2 {
+	// The first two bytes are the protocol version (2 or 3)
+	if len(msg) < 3 || msg[0] != 0 || (msg[1] != 2 && msg[1] != 3) {
 		err = errors.New("otr: invalid OTR message")
 		return
 	}
 
+	version := int(msg[1])
 	msgType := int(msg[2])
+	header := msg[:3]
 	msg = msg[3:]
 
+	if version == 3 {
+		senderTag, rest, ok1 := getU32(msg)
+		receiverTag, rest, ok2 := getU32(rest)
+		if !ok1 || !ok2 || senderTag < minInstanceTag {
+			err = errors.New("otr: invalid OTR message")
+			return
+		}
+		header = header[:len(header)+8]
+		msg = rest
+
+		if receiverTag != 0 && receiverTag != c.instanceTag() {
+			// The message is for another instance of our client.
+			return
+		}
+		if msgType == msgTypeDHCommit || msgType == msgTypeDHKey && c.authState == authStateAwaitingDHKey && c.TheirInstanceTag == 0 {
+			c.TheirInstanceTag = senderTag
+		} else if c.TheirInstanceTag != 0 && senderTag != c.TheirInstanceTag {
+			// The message is from another instance of the peer's client.
+			return
+		}
+	}
+	if msgType == msgTypeDHCommit {
+		c.version = version
+	} else if c.version != 0 && version != c.version {
+		err = errors.New("otr: unexpected protocol version " + strconv.Itoa(version))
+		return
+	}
+
 	switch msgType {
 	case msgTypeDHCommit:
 		switch c.authState {
@@ -402,7 +453,7 @@ func (c *Conversation) Receive(in []byte) (out []byte, encrypted bool, change Se
 			return
 		}
 		var tlvs []tlv
-		out, tlvs, err = c.processData(msg)
+		out, tlvs, err = c.processData(header, msg)
 		encrypted = true
 
 	EachTLV:
@@ -527,9 +578,28 @@ var fragmentError = errors.New("otr: invalid OTR fragment")
 // processFragment processes a fragmented OTR message and possibly returns a
 // complete message. Fragmented messages look like "?OTR,k,n,msg," where k is
 // the fragment number (starting from 1), n is the number of fragments in this
-// message and msg is a substring of the base64 encoded message.
+// message and msg is a substring of the base64 encoded message. In OTRv3
+// they look like "?OTR|sender|receiver,k,n,msg,", where sender and receiver
+// are the instance tags in hex, and fragments for other instances of our
+// client are ignored.
 func (c *Conversation) processFragment(in []byte) (out []byte, err error) {
-	in = in[len(fragmentPrefix):] // remove "?OTR,"
+	if bytes.HasPrefix(in, fragmentPrefixV3) {
+		in = in[len(fragmentPrefixV3):] // remove "?OTR|"
+		if len(in) < 18 || in[8] != '|' || in[17] != ',' {
+			return nil, fragmentError
+		}
+		senderTag, err1 := strconv.ParseUint(string(in[:8]), 16, 32)
+		receiverTag, err2 := strconv.ParseUint(string(in[9:17]), 16, 32)
+		if err1 != nil || err2 != nil || senderTag < minInstanceTag {
+			return nil, fragmentError
+		}
+		if receiverTag != 0 && uint32(receiverTag) != c.instanceTag() {
+			return nil, nil
+		}
+		in = in[18:]
+	} else {
+		in = in[len(fragmentPrefix):] // remove "?OTR,"
+	}
 	parts := bytes.Split(in, fragmentPartSeparator)
 	if len(parts) != 4 || len(parts[3]) != 0 {
 		return nil, fragmentError
@@ -598,8 +668,7 @@ func (c *Conversation) generateDHCommit() []byte {
 
 func (c *Conversation) serializeDHCommit() []byte {
 	var ret []byte
-	ret = appendU16(ret, 2) // protocol version
-	ret = append(ret, msgTypeDHCommit)
+	ret = c.appendHeader(ret, msgTypeDHCommit)
 	ret = appendData(ret, c.gxBytes)
 	ret = appendData(ret, c.digest[:])
 	return ret
@@ -634,8 +703,7 @@ func (c *Conversation) generateDHKey() []byte {
 
 func (c *Conversation) serializeDHKey() []byte {
 	var ret []byte
-	ret = appendU16(ret, 2) // protocol version
-	ret = append(ret, msgTypeDHKey)
+	ret = c.appendHeader(ret, msgTypeDHKey)
 	ret = appendMPI(ret, c.gy)
 	return ret
 }
@@ -708,8 +776,7 @@ func (c *Conversation) generateRevealSig() []byte {
 	incCounter(&c.myCounter)
 
 	var ret []byte
-	ret = appendU16(ret, 2)
-	ret = append(ret, msgTypeRevealSig)
+	ret = c.appendHeader(ret, msgTypeRevealSig)
 	ret = appendData(ret, c.r[:])
 	ret = append(ret, encryptedSig...)
 	ret = append(ret, mac[:20]...)
@@ -821,8 +888,7 @@ func (c *Conversation) generateSig() []byte {
 	incCounter(&c.myCounter)
 
 	var ret []byte
-	ret = appendU16(ret, 2)
-	ret = append(ret, msgTypeSig)
+	ret = c.appendHeader(ret, msgTypeSig)
 	ret = append(ret, encryptedSig...)
 	ret = append(ret, mac[:macPrefixBytes]...)
 	return ret
@@ -864,7 +930,9 @@ func (c *Conversation) rotateDHKeys() {
 	c.myKeyId++
 }
 
-func (c *Conversation) processData(in []byte) (out []byte, tlvs []tlv, err error) {
+// processData processes the data message in, whose header, which is
+// covered by its MAC, is header.
+func (c *Conversation) processData(header, in []byte) (out []byte, tlvs []tlv, err error) {
 	origIn := in
 	flags, in, ok1 := getU8(in)
 	theirKeyId, in, ok2 := getU32(in)
@@ -891,7 +959,7 @@ func (c *Conversation) processData(in []byte) (out []byte, tlvs []tlv, err error
 	}
 
 	mac := hmac.New(sha1.New, slot.recvMACKey)
-	mac.Write([]byte{0, 2, 3})
+	mac.Write(header)
 	mac.Write(macedData)
 	myMAC := mac.Sum(nil)
 	if len(myMAC) != len(theirMAC) || subtle.ConstantTimeCompare(myMAC, theirMAC) == 0 {
@@ -993,8 +1061,7 @@ func (c *Conversation) generateData(msg []byte, extra *tlv) []byte {
 	ctr.XORKeyStream(encrypted, plaintext)
 
 	var ret []byte
-	ret = appendU16(ret, 2)
-	ret = append(ret, msgTypeData)
+	ret = c.appendHeader(ret, msgTypeData)
 	ret = append(ret, 0 /* flags */)
 	ret = appendU32(ret, c.myKeyId-1)
 	ret = appendU32(ret, c.theirKeyId)
@@ -1149,11 +1216,31 @@ func (c *Conversation) encode(msg []byte) [][]byte {
 
 	// We have to fragment this message.
 	var ret [][]byte
-	bytesPerFragment := c.FragmentSize - minFragmentSize
+	overhead := minFragmentSize
+	if c.version == 3 {
+		overhead = minFragmentSizeV3
+	}
+	if c.FragmentSize <= overhead {
+		return [][]byte{b64}
+	}
+	bytesPerFragment := c.FragmentSize - overhead
 	numFragments := (len(b64) + bytesPerFragment) / bytesPerFragment
 
 	for i := 0; i < numFragments; i++ {
-		frag := []byte("?OTR," + strconv.Itoa(i+1) + "," + strconv.Itoa(numFragments) + ",")
+		var frag []byte
+		if c.version == 3 {
+			frag = append(frag, fragmentPrefixV3...)
+			frag = appendPadded(frag, uint64(c.instanceTag()), 16, 8)
+			frag = append(frag, '|')
+			frag = appendPadded(frag, uint64(c.TheirInstanceTag), 16, 8)
+			frag = append(frag, ',')
+			frag = appendPadded(frag, uint64(i+1), 10, 5)
+			frag = append(frag, ',')
+			frag = appendPadded(frag, uint64(numFragments), 10, 5)
+			frag = append(frag, ',')
+		} else {
+			frag = []byte("?OTR," + strconv.Itoa(i+1) + "," + strconv.Itoa(numFragments) + ",")
+		}
 		todo := bytesPerFragment
 		if todo > len(b64) {
 			todo = len(b64)
@@ -1167,6 +1254,44 @@ func (c *Conversation) encode(msg []byte) [][]byte {
 	return ret
 }
 
+// appendPadded appends v, in the given base and left-padded with zeros to
+// width digits, to out.
+func appendPadded(out []byte, v uint64, base, width int) []byte {
+	s := strconv.FormatUint(v, base)
+	for i := len(s); i < width; i++ {
+		out = append(out, '0')
+	}
+	return append(out, s...)
+}
+
+// appendHeader appends the header of a message of type msgType in the
+// protocol version of the key exchange to out: the version, the type and,
+// in OTRv3, the instance tags.
+func (c *Conversation) appendHeader(out []byte, msgType byte) []byte {
+	if c.version != 3 {
+		out = appendU16(out, 2)
+		return append(out, msgType)
+	}
+	out = appendU16(out, 3)
+	out = append(out, msgType)
+	out = appendU32(out, c.instanceTag())
+	out = appendU32(out, c.TheirInstanceTag)
+	return out
+}
+
+// instanceTag returns c.InstanceTag, first setting it to a random tag if it
+// is reserved.
+func (c *Conversation) instanceTag() uint32 {
+	for c.InstanceTag < minInstanceTag {
+		var b [4]byte
+		if _, err := io.ReadFull(c.rand(), b[:]); err != nil {
+			panic("otr: short read from random source")
+		}
+		c.InstanceTag = binary.BigEndian.Uint32(b[:])
+	}
+	return c.InstanceTag
+}
+
 func (c *Conversation) reset() {
 	c.myKeyId = 0
 
@@ -8,6 +8,8 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"math/big"
 	"os"
@@ -29,7 +31,9 @@ var isQueryTests = []struct {
 	{"?OTR?v?", 0},
 	{"?OTR?v2?", 2},
 	{"?OTRv2?", 2},
-	{"?OTRv23?", 2},
+	{"?OTRv23?", 3},
+	{"?OTRv3?", 3},
+	{"?OTRv32?", 3},
 	{"?OTRv23 ?", 0},
 }
 
@@ -122,6 +126,10 @@ func TestSignVerify(t *testing.T) {
 }
 
 func setupConversation(t *testing.T) (alice, bob *Conversation) {
+	return setupConversationWithQuery(t, QueryMessage)
+}
+
+func setupConversationWithQuery(t *testing.T, query string) (alice, bob *Conversation) {
 	alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
 	bobPrivateKey, _ := hex.DecodeString(bobPrivateKeyHex)
 
@@ -141,16 +149,20 @@ func setupConversation(t *testing.T) (alice, bob *Conversation) {
 		t.Error("Bob believes that the conversation is secure before we've started")
 	}
 
-	performHandshake(t, alice, bob)
+	performHandshakeWithQuery(t, alice, bob, query)
 	return alice, bob
 }
 
 func performHandshake(t *testing.T, alice, bob *Conversation) {
+	performHandshakeWithQuery(t, alice, bob, QueryMessage)
+}
+
+func performHandshakeWithQuery(t *testing.T, alice, bob *Conversation, query string) {
 	var alicesMessage, bobsMessage [][]byte
 	var out []byte
 	var aliceChange, bobChange SecurityChange
 	var err error
-	alicesMessage = append(alicesMessage, []byte(QueryMessage))
+	alicesMessage = append(alicesMessage, []byte(query))
 
 	for round := 0; len(alicesMessage) > 0 || len(bobsMessage) > 0; round++ {
 		bobsMessage = nil
@@ -302,6 +314,106 @@ func TestConversation(t *testing.T) {
 	}
 }
 
+func TestConversationVersions(t *testing.T) {
+	tests := []struct {
+		query          string
+		version        int
+		fragmentPrefix string
+	}{
+		{"?OTRv2?", 2, "?OTR,"},
+		{"?OTRv3?", 3, "?OTR|"},
+		{QueryMessage, 3, "?OTR|"},
+	}
+	for _, test := range tests {
+		alice, bob := setupConversationWithQuery(t, test.query)
+		if alice.version != test.version || bob.version != test.version {
+			t.Errorf("%s: got versions %d and %d, want %d", test.query, alice.version, bob.version, test.version)
+		}
+		if test.version == 3 && (alice.TheirInstanceTag != bob.InstanceTag || bob.TheirInstanceTag != alice.InstanceTag) {
+			t.Errorf("%s: instance tags %x and %x, but the peers have %x and %x", test.query, alice.InstanceTag, bob.InstanceTag, bob.TheirInstanceTag, alice.TheirInstanceTag)
+		}
+		msgs, err := alice.Send(bytes.Repeat([]byte("message "), 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) < 2 || !bytes.HasPrefix(msgs[0], []byte(test.fragmentPrefix)) {
+			t.Errorf("%s: got fragment %q, want prefix %q", test.query, msgs[0], test.fragmentPrefix)
+		}
+		roundTrip(t, alice, bob, []byte("hello"), noMACKeyCheck)
+		roundTrip(t, alice, bob, []byte("bye"), noMACKeyCheck)
+	}
+}
+
+func TestInstanceTags(t *testing.T) {
+	alice, bob := setupConversation(t)
+	bob.FragmentSize = 0
+	msgs, err := bob.Send([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := msgs[0]
+
+	decoded, err := base64.StdEncoding.DecodeString(string(msg[len(msgPrefix) : len(msg)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(b []byte) []byte {
+		return []byte(string(msgPrefix) + base64.StdEncoding.EncodeToString(b) + ".")
+	}
+
+	// A message for another instance of Alice's client is ignored.
+	other := append([]byte(nil), decoded...)
+	binary.BigEndian.PutUint32(other[7:], alice.InstanceTag+1)
+	out, _, _, _, err := alice.Receive(encode(other))
+	if len(out) > 0 || err != nil {
+		t.Errorf("message for another instance: got %q and error %v", out, err)
+	}
+
+	// As is a message from another instance of Bob's client.
+	other = append([]byte(nil), decoded...)
+	binary.BigEndian.PutUint32(other[3:], bob.InstanceTag+1)
+	if out, _, _, _, err := alice.Receive(encode(other)); len(out) > 0 || err != nil {
+		t.Errorf("message from another instance: got %q and error %v", out, err)
+	}
+
+	// A message with a reserved sender tag is invalid.
+	other = append([]byte(nil), decoded...)
+	binary.BigEndian.PutUint32(other[3:], 1)
+	if _, _, _, _, err := alice.Receive(encode(other)); err == nil {
+		t.Error("message with a reserved instance tag accepted")
+	}
+
+	out, encrypted, _, _, err := alice.Receive(msg)
+	if err != nil || !encrypted || string(out) != "hello" {
+		t.Errorf("got %q, encrypted %v and error %v", out, encrypted, err)
+	}
+
+	// Fragments for another instance of Alice's client are ignored.
+	bob.FragmentSize = 50
+	msgs, err = bob.Send([]byte("hello again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := func(tag uint32) []byte {
+		return []byte(hex.EncodeToString(binary.BigEndian.AppendUint32(nil, tag)))
+	}
+	for _, frag := range msgs {
+		other := bytes.Replace(frag, tag(alice.InstanceTag), tag(alice.InstanceTag+1), 1)
+		if out, _, _, _, err := alice.Receive(other); len(out) > 0 || err != nil {
+			t.Errorf("fragment for another instance: got %q and error %v", out, err)
+		}
+	}
+	for _, frag := range msgs {
+		out, _, _, _, err = alice.Receive(frag)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(out) != "hello again" {
+		t.Errorf("got %q from fragments", out)
+	}
+}
+
 func TestGoodSMP(t *testing.T) {
 	var alice, bob Conversation
 
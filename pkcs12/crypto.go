@@ -6,18 +6,37 @@ package pkcs12
 
 import (
 	"bytes"
+	"crypto/aes"
 	"crypto/cipher"
 	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"errors"
+	"hash"
 
+	"github.com/gitpod-io/golang-crypto/pbkdf2"
 	"github.com/gitpod-io/golang-crypto/pkcs12/internal/rc2"
+	"github.com/gitpod-io/golang-crypto/scrypt"
 )
 
 var (
 	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 3})
 	oidPBEWithSHAAnd40BitRC2CBC      = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 6})
+
+	// see https://tools.ietf.org/html/rfc8018#appendix-C
+	oidPBES2          = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 13})
+	oidPBKDF2         = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 12})
+	oidScrypt         = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 11591, 4, 11})
+	oidHmacWithSHA1   = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 7})
+	oidHmacWithSHA256 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 9})
+	oidHmacWithSHA384 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 10})
+	oidHmacWithSHA512 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 11})
+	oidAES128CBC      = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 2})
+	oidAES192CBC      = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 22})
+	oidAES256CBC      = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 42})
 )
 
 // pbeCipher is an abstraction of a PKCS#12 cipher.
@@ -63,7 +82,46 @@ type pbeParams struct {
 	Iterations int
 }
 
-func pbDecrypterFor(algorithm pkix.AlgorithmIdentifier, password []byte) (cipher.BlockMode, int, error) {
+type pbes2Params struct {
+	Kdf              pkix.AlgorithmIdentifier
+	EncryptionScheme pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	Prf        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// scryptParams are the parameters of scrypt, see RFC 7914, Section 7.1.
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// The scrypt parameters accepted when decoding, such that a crafted file
+// can't make the decoder exhaust the memory or the CPU. They cover the
+// parameters of OpenSSL and of the recommendations of RFC 7914.
+const (
+	maxScryptCost     = 1 << 20
+	maxScryptBlock    = 32
+	maxScryptParallel = 16
+	// maxScryptMemory bounds the 128 * BlockSize * CostParameter bytes of
+	// memory used by scrypt.
+	maxScryptMemory = 1 << 30
+)
+
+// pbCipherFor returns the block cipher and IV for algorithm, which is either
+// one of the PKCS#12 password-based encryption schemes or PBES2.
+func pbCipherFor(algorithm pkix.AlgorithmIdentifier, password []byte) (cipher.Block, []byte, error) {
+	if algorithm.Algorithm.Equal(oidPBES2) {
+		return pbes2CipherFor(algorithm, password)
+	}
+
 	var cipherType pbeCipher
 
 	switch {
@@ -72,18 +130,124 @@ func pbDecrypterFor(algorithm pkix.AlgorithmIdentifier, password []byte) (cipher
 	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC):
 		cipherType = shaWith40BitRC2CBC{}
 	default:
-		return nil, 0, NotImplementedError("algorithm " + algorithm.Algorithm.String() + " is not supported")
+		return nil, nil, NotImplementedError("algorithm " + algorithm.Algorithm.String() + " is not supported")
 	}
 
 	var params pbeParams
 	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
 
 	key := cipherType.deriveKey(params.Salt, password, params.Iterations)
 	iv := cipherType.deriveIV(params.Salt, password, params.Iterations)
 
 	block, err := cipherType.create(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return block, iv, nil
+}
+
+// pbes2CipherFor implements PBES2 with PBKDF2 or scrypt and AES-CBC, see
+// RFC 8018, Section 6.2, RFC 7914, Section 7, and RFC 9579.
+func pbes2CipherFor(algorithm pkix.AlgorithmIdentifier, password []byte) (cipher.Block, []byte, error) {
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, err
+	}
+	var deriveKey func(params []byte, password []byte, keyLen int) ([]byte, error)
+	switch kdf := params.Kdf.Algorithm; {
+	case kdf.Equal(oidPBKDF2):
+		deriveKey = pbkdf2Key
+	case kdf.Equal(oidScrypt):
+		deriveKey = scryptKey
+	default:
+		return nil, nil, NotImplementedError("key derivation function " + kdf.String() + " is not supported")
+	}
+
+	var keyLen int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLen = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, nil, NotImplementedError("encryption scheme " + scheme.String() + " is not supported")
+	}
+	var iv []byte
+	if err := unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, nil, errors.New("pkcs12: invalid AES-CBC IV length")
+	}
+
+	// Unlike the PKCS#12 key derivation function, PBKDF2 and scrypt take
+	// the password encoded in UTF-8 rather than as a BMPString, see RFC 9579,
+	// Section 2.
+	utf8Password, err := decodeBMPString(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := deriveKey(params.Kdf.Parameters.FullBytes, []byte(utf8Password), keyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return block, iv, nil
+}
+
+func pbkdf2Key(params []byte, password []byte, keyLen int) ([]byte, error) {
+	var kdfParams pbkdf2Params
+	if err := unmarshal(params, &kdfParams); err != nil {
+		return nil, err
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+		return nil, errors.New("pkcs12: PBKDF2 key length does not match the encryption scheme")
+	}
+	var prf func() hash.Hash
+	switch alg := kdfParams.Prf.Algorithm; {
+	case len(alg) == 0, alg.Equal(oidHmacWithSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHmacWithSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHmacWithSHA384):
+		prf = sha512.New384
+	case alg.Equal(oidHmacWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, NotImplementedError("PBKDF2 pseudorandom function " + alg.String() + " is not supported")
+	}
+	return pbkdf2.Key(password, kdfParams.Salt, kdfParams.Iterations, keyLen, prf), nil
+}
+
+func scryptKey(params []byte, password []byte, keyLen int) ([]byte, error) {
+	var kdfParams scryptParams
+	if err := unmarshal(params, &kdfParams); err != nil {
+		return nil, err
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+		return nil, errors.New("pkcs12: scrypt key length does not match the encryption scheme")
+	}
+	n, r, p := kdfParams.CostParameter, kdfParams.BlockSize, kdfParams.ParallelizationParameter
+	if n < 2 || n > maxScryptCost || n&(n-1) != 0 ||
+		r < 1 || r > maxScryptBlock || p < 1 || p > maxScryptParallel ||
+		128*r*n > maxScryptMemory {
+		return nil, NotImplementedError("scrypt parameters beyond the accepted limits are not supported")
+	}
+	return scrypt.Key(password, kdfParams.Salt, n, r, p, keyLen)
+}
+
+func pbDecrypterFor(algorithm pkix.AlgorithmIdentifier, password []byte) (cipher.BlockMode, int, error) {
+	block, iv, err := pbCipherFor(algorithm, password)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -124,6 +288,22 @@ func pbDecrypt(info decryptable, password []byte) (decrypted []byte, err error)
 	return
 }
 
+// pbEncrypt encrypts plaintext with algorithm, adding PKCS#7 padding.
+func pbEncrypt(algorithm pkix.AlgorithmIdentifier, plaintext, password []byte) ([]byte, error) {
+	block, iv, err := pbCipherFor(algorithm, password)
+	if err != nil {
+		return nil, err
+	}
+
+	psLen := block.BlockSize() - len(plaintext)%block.BlockSize()
+	encrypted := make([]byte, len(plaintext)+psLen)
+	copy(encrypted, plaintext)
+	copy(encrypted[len(plaintext):], bytes.Repeat([]byte{byte(psLen)}, psLen))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	return encrypted, nil
+}
+
 // decryptable abstracts an object that contains ciphertext.
 type decryptable interface {
 	Algorithm() pkix.AlgorithmIdentifier
@@ -0,0 +1,275 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+)
+
+var (
+	oidKeyBag          = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 1})
+	oidCRLBag          = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 4})
+	oidSecretBag       = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 5})
+	oidSafeContentsBag = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 6})
+)
+
+// maxBagDepth limits the nesting of safe contents bags.
+const maxBagDepth = 8
+
+// BagType is the type of a SafeBag.
+type BagType string
+
+// The bag types of RFC 7292, Section 4.2. Nested safe contents bags are
+// flattened by the Decoder, and never returned.
+const (
+	KeyBag         BagType = "keyBag"
+	ShroudedKeyBag BagType = "pkcs8ShroudedKeyBag"
+	CertBag        BagType = "certBag"
+	CRLBag         BagType = "crlBag"
+	SecretBag      BagType = "secretBag"
+	UnknownBagType BagType = ""
+)
+
+const safeContentsBag BagType = "safeContentsBag"
+
+func bagTypeOf(id asn1.ObjectIdentifier) BagType {
+	switch {
+	case id.Equal(oidKeyBag):
+		return KeyBag
+	case id.Equal(oidPKCS8ShroundedKeyBag):
+		return ShroudedKeyBag
+	case id.Equal(oidCertBag):
+		return CertBag
+	case id.Equal(oidCRLBag):
+		return CRLBag
+	case id.Equal(oidSecretBag):
+		return SecretBag
+	case id.Equal(oidSafeContentsBag):
+		return safeContentsBag
+	}
+	return UnknownBagType
+}
+
+// An Attribute is an attribute of a SafeBag, such as its friendly name.
+type Attribute struct {
+	Type asn1.ObjectIdentifier
+	// Values holds the values of the attribute, which are generally of a
+	// single ASN.1 type that depends on Type.
+	Values []asn1.RawValue
+}
+
+// A SafeBag is an item of a PKCS#12 file, with its attributes.
+type SafeBag struct {
+	// Type is the type of the bag, or UnknownBagType if OID isn't known.
+	Type BagType
+	// OID is the bag type identifier.
+	OID asn1.ObjectIdentifier
+	// Value is the DER encoding of the bag value, as stored in the file:
+	// the value of a shrouded key bag is still encrypted.
+	Value []byte
+
+	Attributes []Attribute
+
+	// PKCS8PrivateKey is the DER encoded PKCS #8 private key of a key bag
+	// or a decrypted shrouded key bag. PrivateKey is its parsed form, if
+	// its algorithm is supported by x509.ParsePKCS8PrivateKey.
+	PKCS8PrivateKey []byte
+	PrivateKey      interface{}
+
+	// ContentType and Content are the type identifier and the DER encoded
+	// value of the contents of a certificate, CRL or secret bag. For X.509
+	// certificates, Content is the certificate, and Certificate its parsed
+	// form.
+	ContentType asn1.ObjectIdentifier
+	Content     []byte
+	Certificate *x509.Certificate
+}
+
+// Attribute returns the first value of the attribute of b with the given
+// type, if any.
+func (b *SafeBag) Attribute(id asn1.ObjectIdentifier) (value asn1.RawValue, ok bool) {
+	for _, attr := range b.Attributes {
+		if attr.Type.Equal(id) && len(attr.Values) > 0 {
+			return attr.Values[0], true
+		}
+	}
+	return asn1.RawValue{}, false
+}
+
+// FriendlyName returns the friendlyName attribute of b, or the empty string
+// if b doesn't have one.
+func (b *SafeBag) FriendlyName() string {
+	v, ok := b.Attribute(oidFriendlyName)
+	if !ok || v.Tag != asn1.TagBMPString {
+		return ""
+	}
+	name, err := decodeBMPString(v.Bytes)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// LocalKeyID returns the localKeyId attribute of b, which links a private
+// key to its certificate, or nil if b doesn't have one.
+func (b *SafeBag) LocalKeyID() []byte {
+	v, ok := b.Attribute(oidLocalKeyID)
+	if !ok || v.Tag != asn1.TagOctetString {
+		return nil
+	}
+	return v.Bytes
+}
+
+// typedValue is the value of certificate, CRL and secret bags. Value is
+// the explicitly tagged [0] element, whose Bytes are the DER encoding of
+// the contents.
+type typedValue struct {
+	Id    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// A Decoder reads the safe bags of a PKCS#12 file one at a time. Unlike
+// Decode and ToPEM, it returns every bag, including secret bags and bags
+// of unknown types, with all their attributes, and it decrypts each safe
+// only once it gets to it.
+type Decoder struct {
+	password []byte
+	safes    []contentInfo
+	bags     []safeBag
+	depths   []int
+}
+
+// NewDecoder returns a Decoder for pfxData, after checking its MAC with
+// password.
+func NewDecoder(pfxData []byte, password string) (*Decoder, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, ErrIncorrectPassword
+	}
+	safes, encodedPassword, err := getAuthenticatedSafe(pfxData, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{password: encodedPassword, safes: safes}, nil
+}
+
+// Next returns the next safe bag, or io.EOF after the last one.
+func (d *Decoder) Next() (*SafeBag, error) {
+	for {
+		for len(d.bags) == 0 {
+			if len(d.safes) == 0 {
+				return nil, io.EOF
+			}
+			bags, err := decodeSafe(d.safes[0], d.password)
+			if err != nil {
+				return nil, err
+			}
+			d.safes = d.safes[1:]
+			d.bags = bags
+			d.depths = make([]int, len(bags))
+		}
+		bag, depth := d.bags[0], d.depths[0]
+		d.bags, d.depths = d.bags[1:], d.depths[1:]
+
+		if bagTypeOf(bag.Id) != safeContentsBag {
+			return convertSafeBag(&bag, d.password)
+		}
+		if depth >= maxBagDepth {
+			return nil, errors.New("pkcs12: safe contents bags nested too deeply")
+		}
+		var nested []safeBag
+		if err := unmarshal(bag.Value.Bytes, &nested); err != nil {
+			return nil, errors.New("pkcs12: error decoding safe contents bag: " + err.Error())
+		}
+		depths := make([]int, len(nested))
+		for i := range depths {
+			depths[i] = depth + 1
+		}
+		d.bags = append(nested, d.bags...)
+		d.depths = append(depths, d.depths...)
+	}
+}
+
+// DecodeAll returns all the safe bags of pfxData, in order.
+func DecodeAll(pfxData []byte, password string) ([]*SafeBag, error) {
+	d, err := NewDecoder(pfxData, password)
+	if err != nil {
+		return nil, err
+	}
+	var bags []*SafeBag
+	for {
+		bag, err := d.Next()
+		if err == io.EOF {
+			return bags, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		bags = append(bags, bag)
+	}
+}
+
+func convertSafeBag(bag *safeBag, password []byte) (*SafeBag, error) {
+	b := &SafeBag{
+		Type:  bagTypeOf(bag.Id),
+		OID:   bag.Id,
+		Value: bag.Value.Bytes,
+	}
+	for _, attr := range bag.Attributes {
+		a := Attribute{Type: attr.Id}
+		for rest := attr.Value.Bytes; len(rest) > 0; {
+			var v asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &v); err != nil {
+				return nil, errors.New("pkcs12: error decoding attribute: " + err.Error())
+			}
+			a.Values = append(a.Values, v)
+		}
+		b.Attributes = append(b.Attributes, a)
+	}
+
+	switch b.Type {
+	case KeyBag:
+		b.PKCS8PrivateKey = b.Value
+		b.PrivateKey, _ = x509.ParsePKCS8PrivateKey(b.Value)
+	case ShroudedKeyBag:
+		pkinfo := new(encryptedPrivateKeyInfo)
+		if err := unmarshal(b.Value, pkinfo); err != nil {
+			return nil, errors.New("pkcs12: error decoding PKCS#8 shrouded key bag: " + err.Error())
+		}
+		pkData, err := pbDecrypt(pkinfo, password)
+		if err != nil {
+			return nil, errors.New("pkcs12: error decrypting PKCS#8 shrouded key bag: " + err.Error())
+		}
+		b.PKCS8PrivateKey = pkData
+		b.PrivateKey, _ = x509.ParsePKCS8PrivateKey(pkData)
+	case CertBag, CRLBag, SecretBag:
+		var v typedValue
+		if err := unmarshal(b.Value, &v); err != nil {
+			return nil, errors.New("pkcs12: error decoding " + string(b.Type) + ": " + err.Error())
+		}
+		if v.Value.Class != asn1.ClassContextSpecific || v.Value.Tag != 0 || !v.Value.IsCompound {
+			return nil, errors.New("pkcs12: error decoding " + string(b.Type) + ": missing explicit value tag")
+		}
+		b.ContentType = v.Id
+		b.Content = v.Value.Bytes
+		if b.Type == CertBag && v.Id.Equal(oidCertTypeX509Certificate) {
+			var der []byte
+			if err := unmarshal(v.Value.Bytes, &der); err != nil {
+				return nil, errors.New("pkcs12: error decoding cert bag: " + err.Error())
+			}
+			b.Content = der
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			b.Certificate = cert
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func friendlyNameAttribute(t *testing.T, name string) pkcs12Attribute {
+	t.Helper()
+	s, err := bmpString(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagBMPString, Bytes: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkcs12Attribute{
+		Id:    oidFriendlyName,
+		Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	ca, caKey := newTestCertificate(t, "Test CA", nil, nil)
+	cert, key := newTestCertificate(t, "example.com", ca, caKey)
+	const password = "correct horse"
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var enc Encoder
+	localKeyID, err := localKeyIDAttribute([]byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBag, err := makeCertBag(cert.Raw, []pkcs12Attribute{friendlyNameAttribute(t, "server"), localKeyID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBag, err := enc.makeShroudedKeyBag(key, encodedPassword, []pkcs12Attribute{localKeyID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKeyBag, err := enc.makeShroudedKeyBag(caKey, encodedPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretType := asn1.ObjectIdentifier{1, 2, 3, 4}
+	secret, err := asn1.Marshal([]byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretValue, err := explicitValue(typedValue{Id: secretType, Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: secret}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretBag := safeBag{Id: oidSecretBag, Value: secretValue, Attributes: []pkcs12Attribute{friendlyNameAttribute(t, "api token")}}
+	unknownValue, err := explicitValue(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownBag := safeBag{Id: asn1.ObjectIdentifier{1, 2, 3, 5}, Value: unknownValue}
+	nestedValue, err := explicitValue([]safeBag{caKeyBag, unknownBag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nestedBag := safeBag{Id: oidSafeContentsBag, Value: nestedValue}
+
+	var authenticatedSafe [3]contentInfo
+	if authenticatedSafe[0], err = enc.makeEncryptedContentInfo([]safeBag{certBag}, encodedPassword); err != nil {
+		t.Fatal(err)
+	}
+	if authenticatedSafe[1], err = makeDataContentInfo([]safeBag{keyBag, nestedBag}); err != nil {
+		t.Fatal(err)
+	}
+	if authenticatedSafe[2], err = makeDataContentInfo([]safeBag{secretBag}); err != nil {
+		t.Fatal(err)
+	}
+	pfxData, err := enc.marshalPFX(authenticatedSafe[:], encodedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Decode(pfxData, password); err == nil {
+		t.Error("Decode succeeded with three safes")
+	}
+	if _, err := DecodeAll(pfxData, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("DecodeAll with a wrong password: got %v, want %v", err, ErrIncorrectPassword)
+	}
+
+	bags, err := DecodeAll(pfxData, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []BagType
+	for _, b := range bags {
+		types = append(types, b.Type)
+	}
+	if want := []BagType{CertBag, ShroudedKeyBag, ShroudedKeyBag, UnknownBagType, SecretBag}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("got bags %q, want %q", types, want)
+	}
+
+	if b := bags[0]; b.Certificate == nil || !bytes.Equal(b.Content, cert.Raw) || !b.ContentType.Equal(oidCertTypeX509Certificate) {
+		t.Errorf("certificate bag doesn't hold the certificate")
+	} else if b.FriendlyName() != "server" || !bytes.Equal(b.LocalKeyID(), []byte{1, 2, 3}) {
+		t.Errorf("certificate bag has friendlyName %q and localKeyId %x", b.FriendlyName(), b.LocalKeyID())
+	}
+	if b := bags[1]; !reflect.DeepEqual(b.PrivateKey, key) || !bytes.Equal(b.LocalKeyID(), []byte{1, 2, 3}) {
+		t.Errorf("first key bag doesn't hold the key, or has localKeyId %x", b.LocalKeyID())
+	}
+	if b := bags[2]; !reflect.DeepEqual(b.PrivateKey, caKey) || b.LocalKeyID() != nil || len(b.PKCS8PrivateKey) == 0 {
+		t.Errorf("nested key bag doesn't hold the CA key")
+	}
+	if b := bags[3]; !b.OID.Equal(unknownBag.Id) || !bytes.Equal(b.Value, unknownValue.Bytes) {
+		t.Errorf("unknown bag has type %v and value %x", b.OID, b.Value)
+	}
+	if b := bags[4]; !b.ContentType.Equal(secretType) || !bytes.Equal(b.Content, secret) || b.FriendlyName() != "api token" {
+		t.Errorf("secret bag has type %v, content %x and friendlyName %q", b.ContentType, b.Content, b.FriendlyName())
+	}
+}
+
+func TestDecoderTestdata(t *testing.T) {
+	for commonName, base64P12 := range testdata {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+
+		d, err := NewDecoder(p12, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var certs, keys int
+		for {
+			b, err := d.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch b.Type {
+			case CertBag:
+				certs++
+				if b.Certificate.Subject.CommonName != commonName {
+					t.Errorf("got common name %q, want %q", b.Certificate.Subject.CommonName, commonName)
+				}
+			case ShroudedKeyBag:
+				keys++
+				if b.PrivateKey == nil {
+					t.Errorf("%s: key bag without a parsed private key", commonName)
+				}
+			}
+			if b.LocalKeyID() == nil {
+				t.Errorf("%s: %s without localKeyId", commonName, b.Type)
+			}
+		}
+		if certs != 1 || keys != 1 {
+			t.Errorf("%s: got %d certificates and %d keys, want one of each", commonName, certs, keys)
+		}
+	}
+}
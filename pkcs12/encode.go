@@ -0,0 +1,286 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+)
+
+const (
+	// defaultIterations is the default iteration count of the key
+	// derivation and the MAC, matching OpenSSL 3.
+	defaultIterations = 2048
+
+	saltLen = 16
+)
+
+// An Encoder creates PKCS#12 files. The zero value encodes private keys and
+// certificates with PBES2, using PBKDF2 with HMAC-SHA-256 and AES-256-CBC,
+// and protects the file with an HMAC-SHA-256 MAC, as recommended by RFC 9579.
+// These files are accepted by OpenSSL 1.1.1 and later, Windows Server 2019
+// and later, recent versions of macOS, and Java 8u301 and later.
+type Encoder struct {
+	// Legacy selects pbeWithSHAAnd3-KeyTripleDES-CBC encryption and an
+	// HMAC-SHA-1 MAC, for consumers that do not support PBES2.
+	Legacy bool
+
+	// Iterations is the iteration count of the password-based key
+	// derivation used for encryption. If zero, 2048 is used.
+	Iterations int
+
+	// MACIterations is the iteration count of the key derivation for the
+	// MAC. If zero, 2048 is used.
+	MACIterations int
+
+	// Rand is the source of randomness for salts and IVs. If nil,
+	// crypto/rand.Reader is used.
+	Rand io.Reader
+}
+
+func (enc *Encoder) iterations() int {
+	if enc.Iterations == 0 {
+		return defaultIterations
+	}
+	return enc.Iterations
+}
+
+func (enc *Encoder) macIterations() int {
+	if enc.MACIterations == 0 {
+		return defaultIterations
+	}
+	return enc.MACIterations
+}
+
+func (enc *Encoder) rand() io.Reader {
+	if enc.Rand == nil {
+		return rand.Reader
+	}
+	return enc.Rand
+}
+
+// Encode produces pfxData containing one private key, its certificate, and
+// optionally the certificates of its chain in caCerts, protected by
+// password. privateKey must be a type supported by
+// x509.MarshalPKCS8PrivateKey.
+//
+// The certificates are stored in an encrypted safe, and the private key in
+// a shrouded key bag. The key and its certificate are linked by a localKeyId
+// attribute set to the SHA-1 hash of the certificate.
+//
+// Files with caCerts can be read with ToPEM, but not with Decode, which
+// expects exactly one certificate.
+func (enc *Encoder) Encode(privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, password string) (pfxData []byte, err error) {
+	if enc.Iterations < 0 || enc.MACIterations < 0 {
+		return nil, errors.New("pkcs12: negative iteration count")
+	}
+	if certificate == nil {
+		return nil, errors.New("pkcs12: missing certificate")
+	}
+
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := sha1.Sum(certificate.Raw)
+	localKeyID, err := localKeyIDAttribute(keyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	certBags := make([]safeBag, 0, 1+len(caCerts))
+	bag, err := makeCertBag(certificate.Raw, []pkcs12Attribute{localKeyID})
+	if err != nil {
+		return nil, err
+	}
+	certBags = append(certBags, bag)
+	for _, cert := range caCerts {
+		bag, err := makeCertBag(cert.Raw, nil)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+
+	keyBag, err := enc.makeShroudedKeyBag(privateKey, encodedPassword, []pkcs12Attribute{localKeyID})
+	if err != nil {
+		return nil, err
+	}
+
+	var authenticatedSafe [2]contentInfo
+	if authenticatedSafe[0], err = enc.makeEncryptedContentInfo(certBags, encodedPassword); err != nil {
+		return nil, err
+	}
+	if authenticatedSafe[1], err = makeDataContentInfo([]safeBag{keyBag}); err != nil {
+		return nil, err
+	}
+
+	return enc.marshalPFX(authenticatedSafe[:], encodedPassword)
+}
+
+// marshalPFX returns the PFX PDU of authenticatedSafe, with a MAC keyed by
+// password.
+func (enc *Encoder) marshalPFX(authenticatedSafe []contentInfo, password []byte) ([]byte, error) {
+	content, err := asn1.Marshal(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	var pfx pfxPdu
+	pfx.Version = 3
+	pfx.AuthSafe.ContentType = oidDataContentType
+	if pfx.AuthSafe.Content, err = explicitValue(content); err != nil {
+		return nil, err
+	}
+
+	pfx.MacData.Mac.Algorithm = pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	if enc.Legacy {
+		pfx.MacData.Mac.Algorithm.Algorithm = oidSHA1
+	}
+	pfx.MacData.MacSalt = make([]byte, saltLen)
+	if _, err := io.ReadFull(enc.rand(), pfx.MacData.MacSalt); err != nil {
+		return nil, err
+	}
+	pfx.MacData.Iterations = enc.macIterations()
+	if pfx.MacData.Mac.Digest, err = computeMac(&pfx.MacData, content, password); err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pfx)
+}
+
+// encryptionAlgorithm returns a new algorithm identifier, with a random salt
+// and IV, for encrypting a safe or a key bag.
+func (enc *Encoder) encryptionAlgorithm() (pkix.AlgorithmIdentifier, error) {
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(enc.rand(), salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	if enc.Legacy {
+		params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: enc.iterations()})
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, err
+		}
+		return pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBEWithSHAAnd3KeyTripleDESCBC,
+			Parameters: asn1.RawValue{FullBytes: params},
+		}, nil
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(enc.rand(), iv); err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: enc.iterations(),
+		Prf:        pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		Kdf:              pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPBES2,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, nil
+}
+
+func (enc *Encoder) makeShroudedKeyBag(privateKey interface{}, password []byte, attributes []pkcs12Attribute) (bag safeBag, err error) {
+	pkData, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return bag, errors.New("pkcs12: error encoding PKCS#8 private key: " + err.Error())
+	}
+
+	var pkinfo encryptedPrivateKeyInfo
+	if pkinfo.AlgorithmIdentifier, err = enc.encryptionAlgorithm(); err != nil {
+		return bag, err
+	}
+	if pkinfo.EncryptedData, err = pbEncrypt(pkinfo.AlgorithmIdentifier, pkData, password); err != nil {
+		return bag, errors.New("pkcs12: error encrypting PKCS#8 shrouded key bag: " + err.Error())
+	}
+
+	bag.Id = oidPKCS8ShroundedKeyBag
+	bag.Attributes = attributes
+	bag.Value, err = explicitValue(pkinfo)
+	return bag, err
+}
+
+func (enc *Encoder) makeEncryptedContentInfo(bags []safeBag, password []byte) (ci contentInfo, err error) {
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		return ci, err
+	}
+
+	var ed encryptedData
+	ed.EncryptedContentInfo.ContentType = oidDataContentType
+	if ed.EncryptedContentInfo.ContentEncryptionAlgorithm, err = enc.encryptionAlgorithm(); err != nil {
+		return ci, err
+	}
+	if ed.EncryptedContentInfo.EncryptedContent, err = pbEncrypt(ed.EncryptedContentInfo.ContentEncryptionAlgorithm, data, password); err != nil {
+		return ci, err
+	}
+
+	ci.ContentType = oidEncryptedDataContentType
+	ci.Content, err = explicitValue(ed)
+	return ci, err
+}
+
+func makeDataContentInfo(bags []safeBag) (ci contentInfo, err error) {
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		return ci, err
+	}
+
+	ci.ContentType = oidDataContentType
+	ci.Content, err = explicitValue(data)
+	return ci, err
+}
+
+func makeCertBag(der []byte, attributes []pkcs12Attribute) (bag safeBag, err error) {
+	bag.Id = oidCertBag
+	bag.Attributes = attributes
+	bag.Value, err = explicitValue(certBag{Id: oidCertTypeX509Certificate, Data: der})
+	return bag, err
+}
+
+func localKeyIDAttribute(id []byte) (attr pkcs12Attribute, err error) {
+	value, err := asn1.Marshal(id)
+	if err != nil {
+		return attr, err
+	}
+	attr.Id = oidLocalKeyID
+	attr.Value = asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value}
+	return attr, nil
+}
+
+// explicitValue returns the DER encoding of v wrapped in an explicit [0]
+// tag. The tags of asn1.RawValue fields are ignored by asn1.Marshal, so they
+// have to be applied by hand.
+func explicitValue(v interface{}) (asn1.RawValue, error) {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}, nil
+}
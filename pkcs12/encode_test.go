@@ -0,0 +1,237 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/scrypt"
+)
+
+func newTestCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestEncode(t *testing.T) {
+	ca, caKey := newTestCertificate(t, "Test CA", nil, nil)
+	cert, key := newTestCertificate(t, "example.com", ca, caKey)
+
+	tests := []struct {
+		name     string
+		enc      Encoder
+		macAlg   asn1.ObjectIdentifier
+		keyAlg   asn1.ObjectIdentifier
+		password string
+	}{
+		{"modern", Encoder{}, oidSHA256, oidPBES2, "correct horse"},
+		{"modern empty password", Encoder{}, oidSHA256, oidPBES2, ""},
+		{"legacy", Encoder{Legacy: true, Iterations: 1000, MACIterations: 1}, oidSHA1, oidPBEWithSHAAnd3KeyTripleDESCBC, "correct horse"},
+	}
+	for _, tt := range tests {
+		pfxData, err := tt.enc.Encode(key, cert, nil, tt.password)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var pfx pfxPdu
+		if err := unmarshal(pfxData, &pfx); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !pfx.MacData.Mac.Algorithm.Algorithm.Equal(tt.macAlg) {
+			t.Errorf("%s: MAC algorithm %v, want %v", tt.name, pfx.MacData.Mac.Algorithm.Algorithm, tt.macAlg)
+		}
+		if want := tt.enc.macIterations(); pfx.MacData.Iterations != want {
+			t.Errorf("%s: %d MAC iterations, want %d", tt.name, pfx.MacData.Iterations, want)
+		}
+
+		password, _ := bmpString(tt.password)
+		bags, _, err := getSafeContents(pfxData, password)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, bag := range bags {
+			if !bag.Id.Equal(oidPKCS8ShroundedKeyBag) {
+				continue
+			}
+			var pkinfo encryptedPrivateKeyInfo
+			if err := unmarshal(bag.Value.Bytes, &pkinfo); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !pkinfo.AlgorithmIdentifier.Algorithm.Equal(tt.keyAlg) {
+				t.Errorf("%s: key encryption algorithm %v, want %v", tt.name, pkinfo.AlgorithmIdentifier.Algorithm, tt.keyAlg)
+			}
+		}
+
+		gotKey, gotCert, err := Decode(pfxData, tt.password)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(gotKey, key) {
+			t.Errorf("%s: decoded private key does not match", tt.name)
+		}
+		if !gotCert.Equal(cert) {
+			t.Errorf("%s: decoded certificate does not match", tt.name)
+		}
+
+		if _, _, err := Decode(pfxData, "wrong"); err != ErrIncorrectPassword {
+			t.Errorf("%s: wrong password: got %v, want %v", tt.name, err, ErrIncorrectPassword)
+		}
+	}
+}
+
+func TestEncodeChain(t *testing.T) {
+	ca, caKey := newTestCertificate(t, "Test CA", nil, nil)
+	cert, key := newTestCertificate(t, "example.com", ca, caKey)
+
+	var enc Encoder
+	pfxData, err := enc.Encode(key, cert, []*x509.Certificate{ca}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("got %d PEM blocks, want 3", len(blocks))
+	}
+	if blocks[0].Type != certificateType || blocks[1].Type != certificateType || blocks[2].Type != privateKeyType {
+		t.Errorf("got PEM blocks of types %q, %q, %q", blocks[0].Type, blocks[1].Type, blocks[2].Type)
+	}
+	if id := blocks[0].Headers["localKeyId"]; id == "" || id != blocks[2].Headers["localKeyId"] {
+		t.Errorf("certificate localKeyId %q does not match key localKeyId %q", id, blocks[2].Headers["localKeyId"])
+	}
+	if _, ok := blocks[1].Headers["localKeyId"]; ok {
+		t.Error("CA certificate has a localKeyId")
+	}
+}
+
+func TestPBES2Decrypt(t *testing.T) {
+	password, _ := bmpString("password")
+	for _, prf := range []asn1.ObjectIdentifier{nil, oidHmacWithSHA1, oidHmacWithSHA512} {
+		kdfParams, _ := asn1.Marshal(pbkdf2Params{
+			Salt:       []byte("saltsalt"),
+			Iterations: 1,
+			Prf:        pkix.AlgorithmIdentifier{Algorithm: prf, Parameters: asn1.NullRawValue},
+		})
+		if prf == nil {
+			kdfParams, _ = asn1.Marshal(pbkdf2Params{Salt: []byte("saltsalt"), Iterations: 1})
+		}
+		ivParams, _ := asn1.Marshal(make([]byte, 16))
+		params, _ := asn1.Marshal(pbes2Params{
+			Kdf:              pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+			EncryptionScheme: pkix.AlgorithmIdentifier{Algorithm: oidAES128CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+		})
+		alg := pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}
+
+		encrypted, err := pbEncrypt(alg, []byte("0123456789abcdef"), password)
+		if err != nil {
+			t.Fatalf("PRF %v: %v", prf, err)
+		}
+		if len(encrypted) != 32 {
+			t.Errorf("PRF %v: got %d bytes of ciphertext, want 32", prf, len(encrypted))
+		}
+		decrypted, err := pbDecrypt(encryptedContentInfo{ContentEncryptionAlgorithm: alg, EncryptedContent: encrypted}, password)
+		if err != nil {
+			t.Fatalf("PRF %v: %v", prf, err)
+		}
+		if string(decrypted) != "0123456789abcdef" {
+			t.Errorf("PRF %v: decrypted %q", prf, decrypted)
+		}
+	}
+}
+
+func TestPBES2ScryptDecrypt(t *testing.T) {
+	password, _ := bmpString("password")
+	newAlg := func(n, r, p int) pkix.AlgorithmIdentifier {
+		kdfParams, _ := asn1.Marshal(scryptParams{
+			Salt:                     []byte("saltsalt"),
+			CostParameter:            n,
+			BlockSize:                r,
+			ParallelizationParameter: p,
+			KeyLength:                32,
+		})
+		ivParams, _ := asn1.Marshal(make([]byte, 16))
+		params, _ := asn1.Marshal(pbes2Params{
+			Kdf:              pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+			EncryptionScheme: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+		})
+		return pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}
+	}
+
+	alg := newAlg(1024, 8, 1)
+	encrypted, err := pbEncrypt(alg, []byte("0123456789abcdef"), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(mustScrypt(t, "password", 1024, 8, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, make([]byte, 16)).CryptBlocks(want, encrypted)
+	if string(want[:16]) != "0123456789abcdef" {
+		t.Errorf("ciphertext is not encrypted with the scrypt key")
+	}
+	decrypted, err := pbDecrypt(encryptedContentInfo{ContentEncryptionAlgorithm: alg, EncryptedContent: encrypted}, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != "0123456789abcdef" {
+		t.Errorf("decrypted %q", decrypted)
+	}
+
+	for _, params := range [][3]int{{1000, 8, 1}, {1 << 21, 1, 1}, {1 << 20, 16, 1}, {1024, 8, 17}, {1024, 0, 1}} {
+		alg := newAlg(params[0], params[1], params[2])
+		_, err := pbDecrypt(encryptedContentInfo{ContentEncryptionAlgorithm: alg, EncryptedContent: encrypted}, password)
+		if _, ok := err.(NotImplementedError); !ok {
+			t.Errorf("scrypt parameters %v: got error %v, want a NotImplementedError", params, err)
+		}
+	}
+}
+
+func mustScrypt(t *testing.T, password string, n, r, p int) []byte {
+	t.Helper()
+	key, err := scrypt.Key([]byte(password), []byte("saltsalt"), n, r, p, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,359 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package keystore reads the JKS and JCEKS keystores of Java, to migrate
+// their keys and certificates to other formats, such as PKCS#12.
+//
+// The formats are those of the sun.security.provider.JavaKeyStore and
+// com.sun.crypto.provider.JceKeyStore classes of OpenJDK. Only private key
+// and trusted certificate entries are supported: the secret key entries of
+// JCEKS keystores are serialized Java objects.
+package keystore
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gitpod-io/golang-crypto/cryptobyte"
+	"github.com/gitpod-io/golang-crypto/pkcs12"
+)
+
+const (
+	magicJKS   = 0xfeedfeed
+	magicJCEKS = 0xcececece
+
+	tagPrivateKey  = 1
+	tagTrustedCert = 2
+	tagSecretKey   = 3
+)
+
+var (
+	// oidJKSKeyProtector identifies the proprietary algorithm of JKS
+	// keystores, of sun.security.provider.KeyProtector.
+	oidJKSKeyProtector = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1})
+	// oidPBEWithMD5AndTripleDES identifies the algorithm of JCEKS keystores,
+	// of com.sun.crypto.provider.KeyProtector.
+	oidPBEWithMD5AndTripleDES = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 42, 2, 19, 1})
+)
+
+// errMalformed is returned for keystores which can't be parsed.
+var errMalformed = errors.New("keystore: malformed keystore")
+
+// An Entry is a private key or trusted certificate entry of a keystore.
+type Entry struct {
+	// Alias is the name of the entry in the keystore.
+	Alias string
+	// CreationTime is the time at which the entry was added.
+	CreationTime time.Time
+
+	// PKCS8PrivateKey is the decrypted DER encoded PKCS #8 private key of a
+	// private key entry, and nil for a trusted certificate entry.
+	// PrivateKey is its parsed form, if its algorithm is supported by
+	// x509.ParsePKCS8PrivateKey.
+	PKCS8PrivateKey []byte
+	PrivateKey      interface{}
+
+	// Certificates is the certificate chain of a private key entry, leaf
+	// first, or the single certificate of a trusted certificate entry.
+	Certificates []*x509.Certificate
+}
+
+// Decode reads the entries of a JKS or JCEKS keystore, in the order in
+// which they are stored. The integrity of the keystore is checked with
+// storePassword, and the private keys are decrypted with keyPassword,
+// which is often the same.
+//
+// If either password is incorrect, pkcs12.ErrIncorrectPassword is
+// returned, and if the keystore holds secret key entries, a
+// pkcs12.NotImplementedError.
+func Decode(data []byte, storePassword, keyPassword string) ([]*Entry, error) {
+	if len(data) < sha1.Size {
+		return nil, errMalformed
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+
+	// The integrity of the keystore is checked first, so that a wrong
+	// password is not reported as a malformed key.
+	h := sha1.New()
+	h.Write(utf16BE(storePassword))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	if subtle.ConstantTimeCompare(h.Sum(nil), digest) != 1 {
+		// A keystore that isn't one is more likely than a wrong password.
+		var magic uint32
+		if s := cryptobyte.String(body); !s.ReadUint32(&magic) || magic != magicJKS && magic != magicJCEKS {
+			return nil, errMalformed
+		}
+		return nil, pkcs12.ErrIncorrectPassword
+	}
+
+	s := cryptobyte.String(body)
+	var magic, version, count uint32
+	if !s.ReadUint32(&magic) || !s.ReadUint32(&version) || !s.ReadUint32(&count) {
+		return nil, errMalformed
+	}
+	if magic != magicJKS && magic != magicJCEKS || version != 1 && version != 2 {
+		return nil, errMalformed
+	}
+
+	var entries []*Entry
+	for i := uint32(0); i < count; i++ {
+		var tag uint32
+		var millis uint64
+		var alias cryptobyte.String
+		if !s.ReadUint32(&tag) || !s.ReadUint16LengthPrefixed(&alias) || !s.ReadUint64(&millis) {
+			return nil, errMalformed
+		}
+		name, err := decodeModifiedUTF8(alias)
+		if err != nil {
+			return nil, err
+		}
+		e := &Entry{
+			Alias:        name,
+			CreationTime: time.UnixMilli(int64(millis)),
+		}
+
+		switch tag {
+		case tagPrivateKey:
+			var encrypted cryptobyte.String
+			var n uint32
+			if !readUint32LengthPrefixed(&s, &encrypted) || !s.ReadUint32(&n) {
+				return nil, errMalformed
+			}
+			if e.PKCS8PrivateKey, err = decryptKey(encrypted, keyPassword); err != nil {
+				return nil, err
+			}
+			if key, err := x509.ParsePKCS8PrivateKey(e.PKCS8PrivateKey); err == nil {
+				e.PrivateKey = key
+			}
+			// Each certificate takes at least four bytes, which bounds
+			// n by the size of the keystore.
+			if uint64(n)*4 > uint64(len(s)) {
+				return nil, errMalformed
+			}
+			for j := uint32(0); j < n; j++ {
+				cert, err := readCertificate(&s, version)
+				if err != nil {
+					return nil, err
+				}
+				e.Certificates = append(e.Certificates, cert)
+			}
+		case tagTrustedCert:
+			cert, err := readCertificate(&s, version)
+			if err != nil {
+				return nil, err
+			}
+			e.Certificates = []*x509.Certificate{cert}
+		case tagSecretKey:
+			if magic == magicJCEKS {
+				return nil, pkcs12.NotImplementedError("JCEKS secret key entries are not supported")
+			}
+			return nil, errMalformed
+		default:
+			return nil, errMalformed
+		}
+		entries = append(entries, e)
+	}
+	if !s.Empty() {
+		return nil, errMalformed
+	}
+	return entries, nil
+}
+
+// readCertificate reads a certificate, preceded by its type in version 2
+// keystores.
+func readCertificate(s *cryptobyte.String, version uint32) (*x509.Certificate, error) {
+	if version == 2 {
+		var certType cryptobyte.String
+		if !s.ReadUint16LengthPrefixed(&certType) {
+			return nil, errMalformed
+		}
+		if string(certType) != "X.509" {
+			return nil, pkcs12.NotImplementedError("certificate type " + string(certType) + " is not supported")
+		}
+	}
+	var der cryptobyte.String
+	if !readUint32LengthPrefixed(s, &der) {
+		return nil, errMalformed
+	}
+	return x509.ParseCertificate(der)
+}
+
+// readUint32LengthPrefixed reads a 32-bit length-prefixed byte string
+// from s into out.
+func readUint32LengthPrefixed(s *cryptobyte.String, out *cryptobyte.String) bool {
+	var n uint32
+	var b []byte
+	if !s.ReadUint32(&n) || uint64(n) > uint64(len(*s)) || !s.ReadBytes(&b, int(n)) {
+		return false
+	}
+	*out = b
+	return true
+}
+
+// encryptedPrivateKeyInfo is the EncryptedPrivateKeyInfo of RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// decryptKey decrypts the EncryptedPrivateKeyInfo of a private key entry.
+func decryptKey(der []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errMalformed
+	}
+	switch {
+	case info.Algorithm.Algorithm.Equal(oidJKSKeyProtector):
+		return decryptJKS(info.EncryptedData, password)
+	case info.Algorithm.Algorithm.Equal(oidPBEWithMD5AndTripleDES):
+		var params pbeParams
+		if rest, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil || len(rest) > 0 {
+			return nil, errMalformed
+		}
+		return decryptJCEKS(info.EncryptedData, params, password)
+	}
+	return nil, pkcs12.NotImplementedError("key protection algorithm " + info.Algorithm.Algorithm.String() + " is not supported")
+}
+
+// decryptJKS decrypts a key protected by the algorithm of JKS keystores.
+// The data is made of a 20-byte salt, the key XORed with a keystream of
+// chained SHA-1 digests of the password and the salt, and the SHA-1 digest
+// of the password and the key.
+func decryptJKS(data []byte, password string) ([]byte, error) {
+	if len(data) < 2*sha1.Size {
+		return nil, errMalformed
+	}
+	salt := data[:sha1.Size]
+	ciphertext := data[sha1.Size : len(data)-sha1.Size]
+	check := data[len(data)-sha1.Size:]
+
+	passwd := utf16BE(password)
+	key := make([]byte, len(ciphertext))
+	digest := salt
+	for i := 0; i < len(key); i += sha1.Size {
+		h := sha1.New()
+		h.Write(passwd)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		subtle.XORBytes(key[i:], ciphertext[i:], digest)
+	}
+
+	h := sha1.New()
+	h.Write(passwd)
+	h.Write(key)
+	if subtle.ConstantTimeCompare(h.Sum(nil), check) != 1 {
+		return nil, pkcs12.ErrIncorrectPassword
+	}
+	return key, nil
+}
+
+// decryptJCEKS decrypts a key protected with PBEWithMD5AndTripleDES, the
+// algorithm of JCEKS keystores.
+func decryptJCEKS(data []byte, params pbeParams, password string) ([]byte, error) {
+	if len(params.Salt) != 8 || params.Iterations <= 0 || params.Iterations > 1<<24 {
+		return nil, errMalformed
+	}
+	if len(data) == 0 || len(data)%des.BlockSize != 0 {
+		return nil, errMalformed
+	}
+	passwd := []byte(password)
+	for _, c := range passwd {
+		if c < 0x20 || c > 0x7e {
+			return nil, errors.New("keystore: JCEKS key passwords must be printable ASCII")
+		}
+	}
+
+	salt := append([]byte(nil), params.Salt...)
+	if bytes.Equal(salt[:4], salt[4:]) {
+		// OpenJDK means to invert the first half of the salt if both
+		// halves are equal, but swaps the wrong bytes, which must be
+		// reproduced.
+		for i := 0; i < 2; i++ {
+			salt[i], salt[2] = salt[3-i], salt[i]
+		}
+	}
+	var derived []byte
+	for i := 0; i < 2; i++ {
+		digest := salt[i*4 : i*4+4]
+		for j := 0; j < params.Iterations; j++ {
+			h := md5.New()
+			h.Write(digest)
+			h.Write(passwd)
+			digest = h.Sum(nil)
+		}
+		derived = append(derived, digest...)
+	}
+
+	block, err := des.NewTripleDESCipher(derived[:24])
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, derived[24:]).CryptBlocks(key, data)
+
+	// An incorrect password most likely shows as incorrect padding.
+	n := int(key[len(key)-1])
+	if n == 0 || n > des.BlockSize {
+		return nil, pkcs12.ErrIncorrectPassword
+	}
+	for _, b := range key[len(key)-n:] {
+		if int(b) != n {
+			return nil, pkcs12.ErrIncorrectPassword
+		}
+	}
+	key = key[:len(key)-n]
+	if _, err := asn1.Unmarshal(key, new(asn1.RawValue)); err != nil {
+		return nil, pkcs12.ErrIncorrectPassword
+	}
+	return key, nil
+}
+
+// utf16BE returns the UTF-16 big-endian encoding of s, which is how Java
+// turns passwords into bytes for keystore digests and JKS keys.
+func utf16BE(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
+
+// decodeModifiedUTF8 decodes the modified UTF-8 of Java's DataInput, which
+// encodes NUL with two bytes and the characters beyond the BMP as two
+// encoded surrogates.
+func decodeModifiedUTF8(b []byte) (string, error) {
+	var units []uint16
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c < 0x80:
+			units = append(units, uint16(c))
+			b = b[1:]
+		case c&0xe0 == 0xc0 && len(b) >= 2 && b[1]&0xc0 == 0x80:
+			units = append(units, uint16(c&0x1f)<<6|uint16(b[1]&0x3f))
+			b = b[2:]
+		case c&0xf0 == 0xe0 && len(b) >= 3 && b[1]&0xc0 == 0x80 && b[2]&0xc0 == 0x80:
+			units = append(units, uint16(c&0x0f)<<12|uint16(b[1]&0x3f)<<6|uint16(b[2]&0x3f))
+			b = b[3:]
+		default:
+			return "", errMalformed
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,307 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/cryptobyte"
+	"github.com/gitpod-io/golang-crypto/pkcs12"
+)
+
+func newTestCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// protectJKS encrypts key with the algorithm of JKS keystores.
+func protectJKS(key []byte, password string) []byte {
+	salt := make([]byte, sha1.Size)
+	rand.Read(salt)
+	data := append([]byte(nil), salt...)
+	digest := salt
+	for i := 0; i < len(key); i += sha1.Size {
+		h := sha1.New()
+		h.Write(utf16BE(password))
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(key); j++ {
+			data = append(data, key[i+j]^digest[j])
+		}
+	}
+	h := sha1.New()
+	h.Write(utf16BE(password))
+	h.Write(key)
+	data = h.Sum(data)
+	der, _ := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: data,
+	})
+	return der
+}
+
+// protectJCEKS encrypts key with PBEWithMD5AndTripleDES, with the given
+// salt, as JCEKS keystores do.
+func protectJCEKS(key []byte, password string, salt []byte) []byte {
+	const iterations = 200
+	s := append([]byte(nil), salt...)
+	if bytes.Equal(s[:4], s[4:]) {
+		s[0], s[1], s[2] = s[3], s[0], s[1]
+	}
+	var derived []byte
+	for i := 0; i < 2; i++ {
+		digest := s[i*4 : i*4+4]
+		for j := 0; j < iterations; j++ {
+			h := md5.New()
+			h.Write(digest)
+			h.Write([]byte(password))
+			digest = h.Sum(nil)
+		}
+		derived = append(derived, digest...)
+	}
+	block, _ := des.NewTripleDESCipher(derived[:24])
+	n := des.BlockSize - len(key)%des.BlockSize
+	data := append(append([]byte(nil), key...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, derived[24:]).CryptBlocks(data, data)
+	params, _ := asn1.Marshal(pbeParams{Salt: salt, Iterations: iterations})
+	der, _ := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBEWithMD5AndTripleDES, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+	return der
+}
+
+type testEntry struct {
+	tag   uint32
+	alias []byte // in modified UTF-8
+	key   []byte // the protected key of a private key entry
+	certs []*x509.Certificate
+}
+
+// buildKeystore returns a version 2 keystore with entries.
+func buildKeystore(magic uint32, password string, entries []testEntry) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint32(magic)
+	b.AddUint32(2)
+	b.AddUint32(uint32(len(entries)))
+	for _, e := range entries {
+		b.AddUint32(e.tag)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(e.alias) })
+		b.AddUint64(uint64(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli()))
+		if e.tag == tagPrivateKey {
+			b.AddUint32LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(e.key) })
+			b.AddUint32(uint32(len(e.certs)))
+		}
+		for _, c := range e.certs {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte("X.509")) })
+			b.AddUint32LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(c.Raw) })
+		}
+	}
+	body := b.BytesOrPanic()
+	h := sha1.New()
+	h.Write(utf16BE(password))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	return h.Sum(body)
+}
+
+func TestDecode(t *testing.T) {
+	caCert, caKey := newTestCertificate(t, "CA", nil, nil)
+	leafCert, leafKey := newTestCertificate(t, "leaf", caCert, caKey)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		magic uint32
+		key   []byte
+	}{
+		{"JKS", magicJKS, protectJKS(pkcs8, "keypass")},
+		{"JCEKS", magicJCEKS, protectJCEKS(pkcs8, "keypass", []byte("saltsalt"))},
+		{"JCEKS equal salt halves", magicJCEKS, protectJCEKS(pkcs8, "keypass", []byte("abcdabcd"))},
+		{"JKS key in JCEKS", magicJCEKS, protectJKS(pkcs8, "keypass")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ks := buildKeystore(test.magic, "storepass", []testEntry{
+				{tag: tagPrivateKey, alias: []byte("server"), key: test.key, certs: []*x509.Certificate{leafCert, caCert}},
+				// "ca\x00é" in modified UTF-8.
+				{tag: tagTrustedCert, alias: []byte("ca\xc0\x80\xc3\xa9"), certs: []*x509.Certificate{caCert}},
+			})
+			entries, err := Decode(ks, "storepass", "keypass")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("got %d entries, want 2", len(entries))
+			}
+
+			e := entries[0]
+			if e.Alias != "server" || !e.CreationTime.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+				t.Errorf("got alias %q and time %v", e.Alias, e.CreationTime)
+			}
+			if !bytes.Equal(e.PKCS8PrivateKey, pkcs8) || !reflect.DeepEqual(e.PrivateKey, leafKey) {
+				t.Errorf("got key %T, want the leaf key", e.PrivateKey)
+			}
+			if len(e.Certificates) != 2 || !e.Certificates[0].Equal(leafCert) || !e.Certificates[1].Equal(caCert) {
+				t.Errorf("got %d certificates, want the leaf and the CA", len(e.Certificates))
+			}
+
+			e = entries[1]
+			if e.Alias != "ca\x00é" || e.PKCS8PrivateKey != nil || e.PrivateKey != nil {
+				t.Errorf("got alias %q and key %T for the trusted certificate", e.Alias, e.PrivateKey)
+			}
+			if len(e.Certificates) != 1 || !e.Certificates[0].Equal(caCert) {
+				t.Errorf("got %d certificates, want the CA", len(e.Certificates))
+			}
+
+			if _, err := Decode(ks, "wrong", "keypass"); err != pkcs12.ErrIncorrectPassword {
+				t.Errorf("with a wrong store password: got error %v, want ErrIncorrectPassword", err)
+			}
+			if _, err := Decode(ks, "storepass", "wrong"); err != pkcs12.ErrIncorrectPassword {
+				t.Errorf("with a wrong key password: got error %v, want ErrIncorrectPassword", err)
+			}
+		})
+	}
+}
+
+// The keystores in testdata are made by keytool, rather than by
+// buildKeystore, with these commands for $T set to JKS and to JCEKS, and $t
+// to its lower case:
+//
+//	keytool -genkeypair -storetype $T -keystore keytool.$t -storepass storepass -keypass keypass -alias ec -keyalg EC -groupname secp256r1 -dname CN=ec -validity 36500
+//	keytool -genkeypair -storetype $T -keystore keytool.$t -storepass storepass -keypass keypass -alias rsa -keyalg RSA -keysize 2048 -dname CN=rsa -validity 36500
+//	keytool -exportcert -storetype $T -keystore keytool.$t -storepass storepass -alias ec -file ec.der
+//	keytool -importcert -storetype $T -keystore keytool.$t -storepass storepass -alias ca -file ec.der -noprompt
+func TestDecodeKeytool(t *testing.T) {
+	for _, name := range []string{"keytool.jks", "keytool.jceks"} {
+		t.Run(name, func(t *testing.T) {
+			ks, err := os.ReadFile("testdata/" + name)
+			if os.IsNotExist(err) {
+				t.Skipf("testdata/%s was not generated with keytool", name)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, err := Decode(ks, "storepass", "keypass")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// keytool stores the entries in the order of a hash table.
+			aliases := make(map[string]*Entry)
+			for _, e := range entries {
+				aliases[e.Alias] = e
+			}
+			if len(entries) != 3 || len(aliases) != 3 {
+				t.Fatalf("got %d entries, want ec, rsa and ca", len(entries))
+			}
+
+			for alias, want := range map[string]interface{}{"ec": &ecdsa.PrivateKey{}, "rsa": &rsa.PrivateKey{}} {
+				e := aliases[alias]
+				if e == nil {
+					t.Fatalf("no %q entry", alias)
+				}
+				if reflect.TypeOf(e.PrivateKey) != reflect.TypeOf(want) {
+					t.Fatalf("%s: got key %T, want %T", alias, e.PrivateKey, want)
+				}
+				if len(e.Certificates) != 1 || e.Certificates[0].Subject.CommonName != alias {
+					t.Fatalf("%s: got %d certificates, want the self-signed one", alias, len(e.Certificates))
+				}
+				pub := e.PrivateKey.(interface{ Public() crypto.PublicKey }).Public()
+				if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(e.Certificates[0].PublicKey) {
+					t.Errorf("%s: the key doesn't match the certificate", alias)
+				}
+			}
+
+			e := aliases["ca"]
+			if e == nil || e.PrivateKey != nil || len(e.Certificates) != 1 || !e.Certificates[0].Equal(aliases["ec"].Certificates[0]) {
+				t.Errorf("the ca entry isn't the trusted certificate of ec")
+			}
+
+			if _, err := Decode(ks, "wrong", "keypass"); err != pkcs12.ErrIncorrectPassword {
+				t.Errorf("with a wrong store password: got error %v, want ErrIncorrectPassword", err)
+			}
+			if _, err := Decode(ks, "storepass", "wrong"); err != pkcs12.ErrIncorrectPassword {
+				t.Errorf("with a wrong key password: got error %v, want ErrIncorrectPassword", err)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	caCert, _ := newTestCertificate(t, "CA", nil, nil)
+	ks := buildKeystore(magicJKS, "", []testEntry{
+		{tag: tagTrustedCert, alias: []byte("ca"), certs: []*x509.Certificate{caCert}},
+	})
+	if entries, err := Decode(ks, "", ""); err != nil || len(entries) != 1 {
+		t.Fatalf("got %d entries and error %v, want 1 entry", len(entries), err)
+	}
+
+	tests := map[string][]byte{
+		"empty":        nil,
+		"not keystore": bytes.Repeat([]byte{1}, 100),
+		"bad magic":    buildKeystore(0x12345678, "", nil),
+		"truncated":    buildKeystore(magicJKS, "", []testEntry{{tag: tagTrustedCert, alias: []byte("ca")}}),
+		"bad tag":      buildKeystore(magicJKS, "", []testEntry{{tag: 7, alias: []byte("x")}}),
+		"bad alias":    buildKeystore(magicJKS, "", []testEntry{{tag: tagTrustedCert, alias: []byte{0xff}, certs: []*x509.Certificate{caCert}}}),
+		"bad key": buildKeystore(magicJKS, "", []testEntry{
+			{tag: tagPrivateKey, alias: []byte("k"), key: []byte{0x30, 0x00}},
+		}),
+	}
+	for name, data := range tests {
+		if _, err := Decode(data, "", ""); err == nil {
+			t.Errorf("%s: Decode succeeded", name)
+		}
+	}
+
+	secret := buildKeystore(magicJCEKS, "", []testEntry{{tag: tagSecretKey, alias: []byte("s")}})
+	var notImplemented pkcs12.NotImplementedError
+	if _, err := Decode(secret, "", ""); !errors.As(err, &notImplemented) {
+		t.Errorf("with a secret key: got error %v, want a NotImplementedError", err)
+	}
+}
@@ -7,8 +7,11 @@ package pkcs12
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"hash"
 )
 
 type macData struct {
@@ -24,19 +27,47 @@ type digestInfo struct {
 }
 
 var (
-	oidSHA1 = asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26})
+	oidSHA1   = asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26})
+	oidSHA256 = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 1})
+	oidSHA384 = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 2})
+	oidSHA512 = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 3})
 )
 
-func verifyMac(macData *macData, message, password []byte) error {
-	if !macData.Mac.Algorithm.Algorithm.Equal(oidSHA1) {
-		return NotImplementedError("unknown digest algorithm: " + macData.Mac.Algorithm.Algorithm.String())
+func computeMac(macData *macData, message, password []byte) ([]byte, error) {
+	var newHash func() hash.Hash
+	switch alg := macData.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		newHash = sha1.New
+	case alg.Equal(oidSHA256):
+		newHash = sha256.New
+	case alg.Equal(oidSHA384):
+		newHash = sha512.New384
+	case alg.Equal(oidSHA512):
+		newHash = sha512.New
+	default:
+		return nil, NotImplementedError("unknown digest algorithm: " + alg.String())
 	}
 
-	key := pbkdf(sha1Sum, 20, 64, macData.MacSalt, password, macData.Iterations, 3, 20)
+	// The MAC key is derived with the same hash function, whose output and
+	// block sizes are the u and v values of RFC 7292, Appendix B.2.
+	h := newHash()
+	sum := func(in []byte) []byte {
+		h.Reset()
+		h.Write(in)
+		return h.Sum(nil)
+	}
+	key := pbkdf(sum, h.Size(), h.BlockSize(), macData.MacSalt, password, macData.Iterations, 3, h.Size())
 
-	mac := hmac.New(sha1.New, key)
+	mac := hmac.New(newHash, key)
 	mac.Write(message)
-	expectedMAC := mac.Sum(nil)
+	return mac.Sum(nil), nil
+}
+
+func verifyMac(macData *macData, message, password []byte) error {
+	expectedMAC, err := computeMac(macData, message, password)
+	if err != nil {
+		return err
+	}
 
 	if !hmac.Equal(macData.Mac.Digest, expectedMAC) {
 		return ErrIncorrectPassword
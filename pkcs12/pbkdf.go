@@ -102,7 +102,7 @@ func pbkdf(hash func([]byte) []byte, u, v int, salt, password []byte, r int, ID
 	c := (size + u - 1) / u
 
 	//    6.  For i=1, 2, ..., c, do the following:
-	A := make([]byte, c*20)
+	A := make([]byte, c*u)
 	var IjBuf []byte
 	for i := 0; i < c; i++ {
 		//        A.  Set A2=H^r(D||I). (i.e., the r-th hash of D||1,
@@ -111,7 +111,7 @@ func pbkdf(hash func([]byte) []byte, u, v int, salt, password []byte, r int, ID
 		for j := 1; j < r; j++ {
 			Ai = hash(Ai)
 		}
-		copy(A[i*20:], Ai[:])
+		copy(A[i*u:], Ai[:])
 
 		if i < c-1 { // skip on last iteration
 			// B.  Concatenate copies of Ai to create a string B of length v
@@ -6,10 +6,11 @@
 //
 // This implementation is distilled from https://tools.ietf.org/html/rfc7292
 // and referenced documents. It is intended for decoding P12/PFX-stored
-// certificates and keys for use with the crypto/tls package.
+// certificates and keys for use with the crypto/tls package, and for
+// encoding a key and its certificate chain with an Encoder.
 //
-// This package is frozen. If it's missing functionality you need, consider
-// an alternative like software.sslmate.com/src/go-pkcs12.
+// This package is frozen beyond that. If it's missing functionality you
+// need, consider an alternative like software.sslmate.com/src/go-pkcs12.
 package pkcs12
 
 import (
@@ -221,7 +222,8 @@ func convertAttribute(attribute *pkcs12Attribute) (key, value string, err error)
 
 // Decode extracts a certificate and private key from pfxData. This function
 // assumes that there is only one certificate and only one private key in the
-// pfxData; if there are more use ToPEM instead.
+// pfxData; if there are more use ToPEM instead, or DecodeAll or a Decoder
+// for files with other kinds of bags.
 func Decode(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
 	encodedPassword, err := bmpString(password)
 	if err != nil {
@@ -282,6 +284,30 @@ func Decode(pfxData []byte, password string) (privateKey interface{}, certificat
 }
 
 func getSafeContents(p12Data, password []byte) (bags []safeBag, updatedPassword []byte, err error) {
+	authenticatedSafe, password, err := getAuthenticatedSafe(p12Data, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(authenticatedSafe) != 2 {
+		return nil, nil, NotImplementedError("expected exactly two items in the authenticated safe")
+	}
+
+	for _, ci := range authenticatedSafe {
+		safeContents, err := decodeSafe(ci, password)
+		if err != nil {
+			return nil, nil, err
+		}
+		bags = append(bags, safeContents...)
+	}
+
+	return bags, password, nil
+}
+
+// getAuthenticatedSafe checks the MAC of p12Data and returns the content
+// infos of its authenticated safe, which might still be encrypted, and the
+// password that matched the MAC.
+func getAuthenticatedSafe(p12Data, password []byte) (authenticatedSafe []contentInfo, updatedPassword []byte, err error) {
 	pfx := new(pfxPdu)
 	if err := unmarshal(p12Data, pfx); err != nil {
 		return nil, nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
@@ -317,44 +343,39 @@ func getSafeContents(p12Data, password []byte) (bags []safeBag, updatedPassword
 		}
 	}
 
-	var authenticatedSafe []contentInfo
 	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &authenticatedSafe); err != nil {
 		return nil, nil, err
 	}
+	return authenticatedSafe, password, nil
+}
 
-	if len(authenticatedSafe) != 2 {
-		return nil, nil, NotImplementedError("expected exactly two items in the authenticated safe")
-	}
-
-	for _, ci := range authenticatedSafe {
-		var data []byte
+// decodeSafe decrypts, if needed, and decodes the safe bags of an item of
+// the authenticated safe.
+func decodeSafe(ci contentInfo, password []byte) (bags []safeBag, err error) {
+	var data []byte
 
-		switch {
-		case ci.ContentType.Equal(oidDataContentType):
-			if err := unmarshal(ci.Content.Bytes, &data); err != nil {
-				return nil, nil, err
-			}
-		case ci.ContentType.Equal(oidEncryptedDataContentType):
-			var encryptedData encryptedData
-			if err := unmarshal(ci.Content.Bytes, &encryptedData); err != nil {
-				return nil, nil, err
-			}
-			if encryptedData.Version != 0 {
-				return nil, nil, NotImplementedError("only version 0 of EncryptedData is supported")
-			}
-			if data, err = pbDecrypt(encryptedData.EncryptedContentInfo, password); err != nil {
-				return nil, nil, err
-			}
-		default:
-			return nil, nil, NotImplementedError("only data and encryptedData content types are supported in authenticated safe")
+	switch {
+	case ci.ContentType.Equal(oidDataContentType):
+		if err := unmarshal(ci.Content.Bytes, &data); err != nil {
+			return nil, err
 		}
-
-		var safeContents []safeBag
-		if err := unmarshal(data, &safeContents); err != nil {
-			return nil, nil, err
+	case ci.ContentType.Equal(oidEncryptedDataContentType):
+		var encryptedData encryptedData
+		if err := unmarshal(ci.Content.Bytes, &encryptedData); err != nil {
+			return nil, err
 		}
-		bags = append(bags, safeContents...)
+		if encryptedData.Version != 0 {
+			return nil, NotImplementedError("only version 0 of EncryptedData is supported")
+		}
+		if data, err = pbDecrypt(encryptedData.EncryptedContentInfo, password); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, NotImplementedError("only data and encryptedData content types are supported in authenticated safe")
 	}
 
-	return bags, password, nil
+	if err := unmarshal(data, &bags); err != nil {
+		return nil, err
+	}
+	return bags, nil
 }
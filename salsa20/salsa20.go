@@ -18,12 +18,19 @@ cipher.
 This package also implements XSalsa20: a version of Salsa20 with a 24-byte
 nonce as specified in https://cr.yp.to/snuffle/xsalsa-20081128.pdf. Simply
 passing a 24-byte slice as the nonce triggers XSalsa20.
+
+NewXSalsa20Poly1305 combines XSalsa20 with the Poly1305 authenticator into
+an AEAD that produces the same ciphertexts as nacl/secretbox. HSalsa20
+exposes the key derivation function of XSalsa20 for protocols with other
+constructions.
 */
 package salsa20
 
 // TODO(agl): implement XORKeyStream12 and XORKeyStream8 - the reduced round variants of Salsa20.
 
 import (
+	"errors"
+
 	"github.com/gitpod-io/golang-crypto/internal/alias"
 	"github.com/gitpod-io/golang-crypto/salsa20/salsa"
 )
@@ -56,3 +63,30 @@ func XORKeyStream(out, in []byte, nonce []byte, key *[32]byte) {
 
 	salsa.XORKeyStream(out, in, &subNonce, key)
 }
+
+// HSalsa20 uses the Salsa20 core to derive a 32-byte key from a 32-byte key
+// and a 16-byte nonce, as specified in
+// https://cr.yp.to/snuffle/xsalsa-20081128.pdf. It returns an error if key or
+// nonce have any other length. XSalsa20 encrypts with Salsa20 under the key
+// derived from the first 16 bytes of its nonce.
+//
+// It computes the same function as salsa.HSalsa20 with salsa.Sigma as the
+// constant. Package salsa is the low-level core meant for implementing
+// Salsa20 constructions, with fixed-size arrays and a caller-supplied
+// constant; HSalsa20 is the checked entry point for protocols that only need
+// the key derivation, such as those built on libsodium's
+// crypto_core_hsalsa20.
+func HSalsa20(key, nonce []byte) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, errors.New("salsa20: wrong HSalsa20 key size")
+	}
+	if len(nonce) != 16 {
+		return nil, errors.New("salsa20: wrong HSalsa20 nonce size")
+	}
+	var k, out [32]byte
+	var n [16]byte
+	copy(k[:], key)
+	copy(n[:], nonce)
+	salsa.HSalsa20(&out, &n, &k, &salsa.Sigma)
+	return out[:], nil
+}
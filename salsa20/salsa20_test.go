@@ -137,3 +137,24 @@ func BenchmarkXOR1K(b *testing.B) {
 	}
 	b.SetBytes(1024)
 }
+
+func TestHSalsa20(t *testing.T) {
+	// From the test of crypto_core_hsalsa20 in NaCl, core2.c.
+	key := fromHex("1b27556473e985d462cd51197a9a46c76009549eac6474f206c4ee0844f68389")
+	nonce := fromHex("69696ee955b62b73cd62bda875fc73d6")
+	want := fromHex("dc908dda0b9344a953629b733820778880f3ceb421bb61b91cbd4c3e66256ce4")
+	got, err := HSalsa20(key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	if _, err := HSalsa20(key[:31], nonce); err == nil {
+		t.Error("HSalsa20 accepted a short key")
+	}
+	if _, err := HSalsa20(key, nonce[:15]); err == nil {
+		t.Error("HSalsa20 accepted a short nonce")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package salsa20
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/gitpod-io/golang-crypto/internal/alias"
+	"github.com/gitpod-io/golang-crypto/internal/poly1305"
+	"github.com/gitpod-io/golang-crypto/salsa20/salsa"
+)
+
+const (
+	// KeySize is the size of the key used by XSalsa20-Poly1305, in bytes.
+	KeySize = 32
+
+	// NonceSizeX is the size of the nonce used by XSalsa20-Poly1305, in
+	// bytes. It is long enough to be generated at random.
+	NonceSizeX = 24
+
+	// Overhead is the size of the Poly1305 authentication tag, and the
+	// difference between a ciphertext length and its plaintext.
+	Overhead = poly1305.TagSize
+)
+
+type xsalsa20poly1305 struct {
+	key [KeySize]byte
+}
+
+// NewXSalsa20Poly1305 returns an XSalsa20-Poly1305 AEAD that uses the given
+// 256-bit key and 24-byte nonces. Its ciphertexts are those of
+// golang.org/x/crypto/nacl/secretbox and of crypto_secretbox_xsalsa20poly1305
+// in NaCl and libsodium: the Poly1305 tag, keyed with the first 32 bytes of
+// the keystream, followed by the plaintext encrypted with the rest of it.
+//
+// That construction doesn't authenticate additional data, so Seal panics if
+// additionalData is not empty, and Open returns an error.
+func NewXSalsa20Poly1305(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("salsa20: bad key length")
+	}
+	ret := new(xsalsa20poly1305)
+	copy(ret.key[:], key)
+	return ret, nil
+}
+
+func (c *xsalsa20poly1305) NonceSize() int {
+	return NonceSizeX
+}
+
+func (c *xsalsa20poly1305) Overhead() int {
+	return Overhead
+}
+
+// setup returns the Salsa20 key and counter for nonce, and the Poly1305 key
+// and the remaining keystream of the first block.
+func (c *xsalsa20poly1305) setup(nonce []byte) (key *[32]byte, counter *[16]byte, polyKey *[32]byte, firstBlock []byte) {
+	var hNonce [16]byte
+	copy(hNonce[:], nonce[:16])
+	key = new([32]byte)
+	salsa.HSalsa20(key, &hNonce, &c.key, &salsa.Sigma)
+	counter = new([16]byte)
+	copy(counter[:], nonce[16:])
+
+	var block [64]byte
+	salsa.XORKeyStream(block[:], block[:], counter, key)
+	polyKey = new([32]byte)
+	copy(polyKey[:], block[:32])
+	counter[8] = 1
+	return key, counter, polyKey, block[32:]
+}
+
+// xor encrypts or decrypts src into dst with the keystream following the
+// Poly1305 key.
+func xor(dst, src []byte, key *[32]byte, counter *[16]byte, firstBlock []byte) {
+	n := len(src)
+	if n > len(firstBlock) {
+		n = len(firstBlock)
+	}
+	subtle.XORBytes(dst[:n], src[:n], firstBlock[:n])
+	salsa.XORKeyStream(dst[n:], src[n:], counter, key)
+}
+
+func (c *xsalsa20poly1305) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSizeX {
+		panic("salsa20: bad nonce length passed to Seal")
+	}
+	if len(additionalData) != 0 {
+		panic("salsa20: XSalsa20-Poly1305 doesn't support additional data")
+	}
+	ret, out := sliceForAppend(dst, Overhead+len(plaintext))
+	if alias.InexactOverlap(out[Overhead:], plaintext) {
+		// The tag comes first, so plaintext[:0] as dst means moving the
+		// plaintext forward before encrypting it in place.
+		if alias.InexactOverlap(out[:len(plaintext)], plaintext) {
+			panic("salsa20: invalid buffer overlap")
+		}
+		copy(out[Overhead:], plaintext)
+		plaintext = out[Overhead:]
+	}
+	key, counter, polyKey, firstBlock := c.setup(nonce)
+	ciphertext := out[Overhead:]
+	xor(ciphertext, plaintext, key, counter, firstBlock)
+	var tag [Overhead]byte
+	poly1305.Sum(&tag, ciphertext, polyKey)
+	copy(out, tag[:])
+	return ret
+}
+
+var errOpen = errors.New("salsa20: message authentication failed")
+
+func (c *xsalsa20poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSizeX {
+		panic("salsa20: bad nonce length passed to Open")
+	}
+	if len(ciphertext) < Overhead || len(additionalData) != 0 {
+		return nil, errOpen
+	}
+	box := ciphertext
+	var tag [Overhead]byte
+	copy(tag[:], box)
+	ciphertext = box[Overhead:]
+	key, counter, polyKey, firstBlock := c.setup(nonce)
+	if !poly1305.Verify(&tag, ciphertext, polyKey) {
+		return nil, errOpen
+	}
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	if alias.InexactOverlap(out, ciphertext) {
+		// ciphertext[:0] as dst means decrypting in place and moving the
+		// plaintext back over the tag.
+		if alias.InexactOverlap(out, box[:len(out)]) {
+			panic("salsa20: invalid buffer overlap")
+		}
+		xor(ciphertext, ciphertext, key, counter, firstBlock)
+		copy(out, ciphertext)
+		return ret, nil
+	}
+	xor(out, ciphertext, key, counter, firstBlock)
+	return ret, nil
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes. If the
+// original slice has sufficient capacity then no allocation is performed.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package salsa20
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/nacl/secretbox"
+)
+
+func TestXSalsa20Poly1305(t *testing.T) {
+	var key [KeySize]byte
+	var nonce [NonceSizeX]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for i := range nonce {
+		nonce[i] = byte(100 + i)
+	}
+	aead, err := NewXSalsa20Poly1305(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aead.NonceSize() != NonceSizeX || aead.Overhead() != secretbox.Overhead {
+		t.Errorf("got nonce size %d and overhead %d", aead.NonceSize(), aead.Overhead())
+	}
+
+	for _, n := range []int{0, 1, 31, 32, 33, 63, 64, 65, 100, 1000} {
+		plaintext := make([]byte, n)
+		for i := range plaintext {
+			plaintext[i] = byte(i * 7)
+		}
+		prefix := []byte("prefix")
+		want := secretbox.Seal(nil, plaintext, &nonce, &key)
+		ciphertext := aead.Seal(prefix, nonce[:], plaintext, nil)
+		if !bytes.Equal(ciphertext, append(prefix, want...)) {
+			t.Fatalf("%d bytes: Seal doesn't match secretbox.Seal", n)
+		}
+		got, err := aead.Open(nil, nonce[:], want, nil)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Fatalf("%d bytes: Open of a secretbox failed: %v", n, err)
+		}
+
+		// In place, as allowed by cipher.AEAD.
+		buf := make([]byte, n, n+Overhead)
+		copy(buf, plaintext)
+		if sealed := aead.Seal(buf[:0], nonce[:], buf, nil); !bytes.Equal(sealed, want) {
+			t.Fatalf("%d bytes: in-place Seal doesn't match secretbox.Seal", n)
+		}
+		buf = buf[:n+Overhead]
+		if opened, err := aead.Open(buf[:0], nonce[:], buf, nil); err != nil || !bytes.Equal(opened, plaintext) {
+			t.Fatalf("%d bytes: in-place Open failed: %v", n, err)
+		}
+
+		for i := range want {
+			tampered := append([]byte(nil), want...)
+			tampered[i] ^= 1
+			if _, err := aead.Open(nil, nonce[:], tampered, nil); err == nil {
+				t.Fatalf("%d bytes: Open accepted a ciphertext modified at byte %d", n, i)
+			}
+		}
+	}
+
+	if _, err := aead.Open(nil, nonce[:], make([]byte, Overhead-1), nil); err == nil {
+		t.Error("Open accepted a short ciphertext")
+	}
+	if _, err := aead.Open(nil, nonce[:], secretbox.Seal(nil, nil, &nonce, &key), []byte("ad")); err == nil {
+		t.Error("Open accepted additional data")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Seal accepted additional data")
+			}
+		}()
+		aead.Seal(nil, nonce[:], nil, []byte("ad"))
+	}()
+	if _, err := NewXSalsa20Poly1305(key[:31]); err == nil {
+		t.Error("NewXSalsa20Poly1305 accepted a short key")
+	}
+}
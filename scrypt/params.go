@@ -0,0 +1,144 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Params are the cost parameters of Key.
+type Params struct {
+	N int // CPU/memory cost, a power of two greater than 1
+	R int // block size
+	P int // parallelization
+}
+
+// Memory returns the amount of memory, in bytes, used by Key with p.
+func (p Params) Memory() int {
+	return 128 * p.N * p.R
+}
+
+// calibrationR is the block size used by Calibrate, as recommended by the
+// scrypt paper.
+const calibrationR = 8
+
+// Calibrate measures the speed of Key on the current machine, and returns the
+// parameters that make it take about target without using more than
+// maxMemory bytes. N is the largest power of two that fits both constraints,
+// R is 8, and P is increased above 1 only if maxMemory is too small for N
+// alone to reach target.
+//
+// Calibrate runs Key a few times, and takes about as long as target. The
+// result depends on the load of the machine, so it should be computed ahead
+// of time, for example when a service is first set up, rather than each time
+// a password is hashed.
+func Calibrate(target time.Duration, maxMemory int) (Params, error) {
+	if target <= 0 {
+		return Params{}, errors.New("scrypt: target duration must be positive")
+	}
+	maxN := maxMemory / (128 * calibrationR)
+	if maxN < 2 {
+		return Params{}, errors.New("scrypt: maximum memory is too small")
+	}
+	// Round down to a power of two.
+	maxN = 1 << (bits.Len(uint(maxN)) - 1)
+
+	// Measure with increasing N, until a run takes long enough to minimize
+	// the error of the timer, or takes a good part of target.
+	n := 1 << 10
+	if n > maxN {
+		n = maxN
+	}
+	var d time.Duration
+	for {
+		start := time.Now()
+		if _, err := Key([]byte("password"), []byte("salt"), n, calibrationR, 1, 32); err != nil {
+			return Params{}, err
+		}
+		d = time.Since(start)
+		if d >= target/4 || d >= 100*time.Millisecond || n >= maxN {
+			break
+		}
+		n *= 2
+	}
+	perN := float64(d) / float64(n)
+
+	p := Params{N: 2, R: calibrationR, P: 1}
+	for p.N < maxN && perN*float64(2*p.N) <= float64(target) {
+		p.N *= 2
+	}
+	if p.N == maxN {
+		if extra := int(float64(target) / (perN * float64(p.N))); extra > 1 {
+			p.P = extra
+		}
+		if maxP := (1<<30 - 1) / p.R; p.P > maxP {
+			p.P = maxP
+		}
+	}
+	return p, nil
+}
+
+// ParamsFromHash parses a scrypt hash in the PHC string format used by
+// passlib and others, such as
+//
+//	$scrypt$ln=15,r=8,p=1$c2FsdHNhbHQ$/T9lcxL/PciEjoGiPeLBheQEAI0Aon8FJ4XaTbIpMCM
+//
+// where ln is the base 2 logarithm of N, and the salt and hash are base64
+// encoded without padding. It returns the cost parameters, the salt and the
+// derived key, so that the password can be checked by comparing the key with
+// the output of Key, using subtle.ConstantTimeCompare.
+func ParamsFromHash(hash string) (params Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != "scrypt" {
+		return Params{}, nil, nil, errors.New("scrypt: hash is not in the $scrypt$ format")
+	}
+
+	var ln int
+	seen := make(map[string]bool)
+	for _, kv := range strings.Split(parts[2], ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || seen[k] {
+			return Params{}, nil, nil, errors.New("scrypt: malformed hash parameters")
+		}
+		seen[k] = true
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return Params{}, nil, nil, errors.New("scrypt: invalid hash parameter " + k)
+		}
+		switch k {
+		case "ln":
+			ln = n
+		case "r":
+			params.R = n
+		case "p":
+			params.P = n
+		default:
+			return Params{}, nil, nil, errors.New("scrypt: unknown hash parameter " + k)
+		}
+	}
+	if !seen["ln"] || !seen["r"] || !seen["p"] {
+		return Params{}, nil, nil, errors.New("scrypt: missing hash parameters")
+	}
+	if ln >= bits.UintSize-1 {
+		return Params{}, nil, nil, errors.New("scrypt: parameters are too large")
+	}
+	params.N = 1 << ln
+	if uint64(params.R)*uint64(params.P) >= 1<<30 {
+		return Params{}, nil, nil, errors.New("scrypt: parameters are too large")
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil {
+		return Params{}, nil, nil, errors.New("scrypt: invalid hash salt")
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(key) == 0 {
+		return Params{}, nil, nil, errors.New("scrypt: invalid hash key")
+	}
+	return params, salt, key, nil
+}
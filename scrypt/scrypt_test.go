@@ -7,6 +7,7 @@ package scrypt
 import (
 	"bytes"
 	"testing"
+	"time"
 )
 
 type testVector struct {
@@ -153,6 +154,66 @@ func TestKey(t *testing.T) {
 	}
 }
 
+func TestParamsFromHash(t *testing.T) {
+	const hash = "$scrypt$ln=10,r=8,p=1$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI"
+	params, salt, key, err := ParamsFromHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != (Params{N: 1024, R: 8, P: 1}) || string(salt) != "saltsalt" {
+		t.Fatalf("got params %+v and salt %q", params, salt)
+	}
+	k, err := Key([]byte("password"), salt, params.N, params.R, params.P, len(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k, key) {
+		t.Errorf("got key %x, want %x", k, key)
+	}
+
+	for _, h := range []string{
+		"",
+		"$scrypt$ln=10,r=8,p=1$c2FsdHNhbHQ",
+		"$argon2id$ln=10,r=8,p=1$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=10,r=8$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=10,r=8,p=1,p=1$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=10,r=8,p=0$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=10,r=8,p=1,v=1$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=99,r=8,p=1$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=10,r=1073741824,p=1$c2FsdHNhbHQ$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=10,r=8,p=1$c2FsdHNhbHQ=$AOLXEESCcPmf2DxU3D47ZJxp5ZTcHC0S2Mb2eFXc4tI",
+		"$scrypt$ln=10,r=8,p=1$c2FsdHNhbHQ$",
+	} {
+		if _, _, _, err := ParamsFromHash(h); err == nil {
+			t.Errorf("ParamsFromHash(%q) succeeded", h)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	const maxMemory = 4 << 20
+	params, err := Calibrate(20*time.Millisecond, maxMemory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.N < 2 || params.N&(params.N-1) != 0 || params.R != 8 || params.P < 1 {
+		t.Fatalf("invalid params %+v", params)
+	}
+	if params.Memory() > maxMemory {
+		t.Errorf("params %+v use %d bytes, want at most %d", params, params.Memory(), maxMemory)
+	}
+	if _, err := Key([]byte("password"), []byte("salt"), params.N, params.R, params.P, 32); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := Calibrate(time.Second, 1024); err == nil {
+		t.Error("Calibrate accepted a maximum memory below 2 KiB")
+	}
+	if _, err := Calibrate(0, maxMemory); err == nil {
+		t.Error("Calibrate accepted a zero target")
+	}
+}
+
 var sink []byte
 
 func BenchmarkKey(b *testing.B) {
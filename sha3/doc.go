@@ -3,7 +3,9 @@
 // license that can be found in the LICENSE file.
 
 // Package sha3 implements the SHA-3 fixed-output-length hash functions and
-// the SHAKE variable-output-length hash functions defined by FIPS-202.
+// the SHAKE variable-output-length hash functions defined by FIPS-202, as
+// well as the cSHAKE, KMAC, TupleHash and ParallelHash functions derived from
+// them by NIST SP 800-185.
 //
 // All types in this package also implement [encoding.BinaryMarshaler],
 // [encoding.BinaryAppender] and [encoding.BinaryUnmarshaler] to marshal and
@@ -18,9 +20,9 @@
 // bytes of output. The SHAKE instances are faster than the SHA3 instances;
 // the latter have to allocate memory to conform to the hash.Hash interface.
 //
-// If you need a secret-key MAC (message authentication code), prepend the
-// secret key to the input, hash with SHAKE256 and read at least 32 bytes of
-// output.
+// If you need a secret-key MAC (message authentication code), use KMAC256, or
+// prepend the secret key to the input, hash with SHAKE256 and read at least
+// 32 bytes of output.
 //
 // # Security strengths
 //
@@ -0,0 +1,283 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sha3
+
+// This file implements the KMAC, TupleHash and ParallelHash functions
+// derived from cSHAKE by NIST SP 800-185 [2] (see shake.go).
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"math/bits"
+)
+
+func rightEncode(x uint64) []byte {
+	// Let n be the smallest positive integer for which 2^(8n) > x.
+	n := (bits.Len64(x) + 7) / 8
+	if n == 0 {
+		n = 1
+	}
+	// Return x as n bytes in big-endian order followed by n as a byte.
+	b := make([]byte, 9)
+	binary.BigEndian.PutUint64(b, x)
+	b[8] = byte(n)
+	return b[8-n:]
+}
+
+// writeEncodedString writes encode_string(s) of Section 2.3.2 of [2] to h.
+func writeEncodedString(h ShakeHash, s []byte) {
+	h.Write(leftEncode(uint64(len(s)) * 8))
+	h.Write(s)
+}
+
+// kmac implements KMAC and KMACXOF, as specified in Section 4 of [2].
+type kmac struct {
+	*cshakeState
+
+	// keyBlock is bytepad(encode_string(K), rate), which is absorbed
+	// after the cSHAKE initialization block.
+	keyBlock []byte
+
+	outputLen int
+	xof       bool
+	finalized bool
+}
+
+func newKMAC(key, S []byte, rate, outputLen int, xof bool) *kmac {
+	if outputLen <= 0 {
+		panic("sha3: invalid KMAC output length")
+	}
+	k := &kmac{
+		cshakeState: newCShake([]byte("KMAC"), S, rate, outputLen, dsbyteCShake).(*cshakeState),
+		outputLen:   outputLen,
+		xof:         xof,
+	}
+	encodedKey := append(leftEncode(uint64(len(key))*8), key...)
+	k.keyBlock = bytepad(encodedKey, rate)
+	k.cshakeState.Write(k.keyBlock)
+	return k
+}
+
+// NewKMAC128 returns a new KMAC128 hash.Hash computing a MAC of outputLen
+// bytes with the given key, which should be at least 16 bytes long. S is a
+// customization string used for domain separation, and may be empty.
+//
+// Unlike with KMACXOF128, the output length is an input of the MAC, so
+// that truncating the output of KMAC128 does not yield its output for a
+// shorter length.
+func NewKMAC128(key, S []byte, outputLen int) hash.Hash {
+	return newKMAC(key, S, rateK256, outputLen, false)
+}
+
+// NewKMAC256 returns a new KMAC256 hash.Hash computing a MAC of outputLen
+// bytes with the given key, which should be at least 32 bytes long, and the
+// customization string S. See NewKMAC128.
+func NewKMAC256(key, S []byte, outputLen int) hash.Hash {
+	return newKMAC(key, S, rateK512, outputLen, false)
+}
+
+// NewKMACXOF128 returns a new KMACXOF128 ShakeHash, the variant of KMAC128
+// with an arbitrary output length, using the given key and customization
+// string S. Its Sum method returns 32 bytes of output.
+func NewKMACXOF128(key, S []byte) ShakeHash {
+	return newKMAC(key, S, rateK256, 32, true)
+}
+
+// NewKMACXOF256 returns a new KMACXOF256 ShakeHash, the variant of KMAC256
+// with an arbitrary output length, using the given key and customization
+// string S. Its Sum method returns 64 bytes of output.
+func NewKMACXOF256(key, S []byte) ShakeHash {
+	return newKMAC(key, S, rateK512, 64, true)
+}
+
+func (k *kmac) Size() int { return k.outputLen }
+
+// finalize absorbs right_encode(L), where L is the output length in bits,
+// or zero for KMACXOF.
+func (k *kmac) finalize() {
+	if k.finalized {
+		return
+	}
+	k.finalized = true
+	if k.xof {
+		k.cshakeState.Write(rightEncode(0))
+	} else {
+		k.cshakeState.Write(rightEncode(uint64(k.outputLen) * 8))
+	}
+}
+
+func (k *kmac) Read(out []byte) (int, error) {
+	k.finalize()
+	return k.cshakeState.Read(out)
+}
+
+func (k *kmac) Sum(b []byte) []byte {
+	dup := k.clone()
+	out := make([]byte, k.outputLen)
+	dup.Read(out)
+	return append(b, out...)
+}
+
+func (k *kmac) Reset() {
+	k.cshakeState.Reset()
+	k.cshakeState.Write(k.keyBlock)
+	k.finalized = false
+}
+
+func (k *kmac) clone() *kmac {
+	dup := *k
+	dup.cshakeState = k.cshakeState.Clone().(*cshakeState)
+	return &dup
+}
+
+func (k *kmac) Clone() ShakeHash {
+	return k.clone()
+}
+
+const magicKMAC = "sha\x0c"
+
+func (k *kmac) MarshalBinary() ([]byte, error) {
+	return k.AppendBinary(nil)
+}
+
+// AppendBinary appends magic || output length || finalized || length of
+// the key block || key block || cSHAKE state.
+func (k *kmac) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, magicKMAC...)
+	b = binary.BigEndian.AppendUint64(b, uint64(k.outputLen))
+	if k.finalized {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(k.keyBlock)))
+	b = append(b, k.keyBlock...)
+	return k.cshakeState.AppendBinary(b)
+}
+
+func (k *kmac) UnmarshalBinary(b []byte) error {
+	const headerSize = len(magicKMAC) + 8 + 1 + 4
+	if len(b) < headerSize || string(b[:len(magicKMAC)]) != magicKMAC {
+		return errors.New("sha3: invalid hash state identifier")
+	}
+	b = b[len(magicKMAC):]
+	outputLen := binary.BigEndian.Uint64(b)
+	finalized := b[8]
+	keyBlockLen := binary.BigEndian.Uint32(b[9:])
+	b = b[13:]
+	if finalized > 1 || uint64(keyBlockLen) > uint64(len(b)) {
+		return errors.New("sha3: invalid hash state")
+	}
+	if outputLen != uint64(k.outputLen) {
+		return errors.New("sha3: invalid hash state function")
+	}
+	if err := k.cshakeState.UnmarshalBinary(b[keyBlockLen:]); err != nil {
+		return err
+	}
+	k.keyBlock = append([]byte(nil), b[:keyBlockLen]...)
+	k.finalized = finalized == 1
+	return nil
+}
+
+// tupleHash computes TupleHash or TupleHashXOF, as specified in Section 5
+// of [2].
+func tupleHash(h ShakeHash, out []byte, tuple [][]byte, xof bool) {
+	for _, s := range tuple {
+		writeEncodedString(h, s)
+	}
+	if xof {
+		h.Write(rightEncode(0))
+	} else {
+		h.Write(rightEncode(uint64(len(out)) * 8))
+	}
+	h.Read(out)
+}
+
+// TupleHash128 writes the TupleHash128 digest of len(out) bytes of the
+// sequence of strings tuple into out. Unlike the digest of their
+// concatenation, the digest is unambiguous: moving bytes from one string
+// to the next changes it. S is a customization string used for domain
+// separation, and may be empty.
+func TupleHash128(out []byte, tuple [][]byte, S []byte) {
+	tupleHash(NewCShake128([]byte("TupleHash"), S), out, tuple, false)
+}
+
+// TupleHash256 writes the TupleHash256 digest of len(out) bytes of tuple,
+// with the customization string S, into out. See TupleHash128.
+func TupleHash256(out []byte, tuple [][]byte, S []byte) {
+	tupleHash(NewCShake256([]byte("TupleHash"), S), out, tuple, false)
+}
+
+// TupleHashXOF128 writes len(out) bytes of the TupleHashXOF128 output for
+// tuple and the customization string S into out. Unlike with TupleHash128,
+// shorter outputs are prefixes of longer ones.
+func TupleHashXOF128(out []byte, tuple [][]byte, S []byte) {
+	tupleHash(NewCShake128([]byte("TupleHash"), S), out, tuple, true)
+}
+
+// TupleHashXOF256 writes len(out) bytes of the TupleHashXOF256 output for
+// tuple and the customization string S into out. See TupleHashXOF128.
+func TupleHashXOF256(out []byte, tuple [][]byte, S []byte) {
+	tupleHash(NewCShake256([]byte("TupleHash"), S), out, tuple, true)
+}
+
+// parallelHash computes ParallelHash or ParallelHashXOF, as specified in
+// Section 6 of [2]. Each block of blockSize bytes of data is hashed with
+// shakeSum into chainLen bytes.
+func parallelHash(h ShakeHash, shakeSum func(hash, data []byte), chainLen int, out, data []byte, blockSize int, xof bool) {
+	if blockSize <= 0 {
+		panic("sha3: invalid ParallelHash block size")
+	}
+	h.Write(leftEncode(uint64(blockSize)))
+	chain := make([]byte, chainLen)
+	n := 0
+	for ; len(data) > 0; n++ {
+		block := data
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		shakeSum(chain, block)
+		h.Write(chain)
+		data = data[len(block):]
+	}
+	h.Write(rightEncode(uint64(n)))
+	if xof {
+		h.Write(rightEncode(0))
+	} else {
+		h.Write(rightEncode(uint64(len(out)) * 8))
+	}
+	h.Read(out)
+}
+
+// ParallelHash128 writes the ParallelHash128 digest of len(out) bytes of
+// data into out. The data is split into blocks of blockSize bytes whose
+// hashes are independent of each other, and S is a customization string
+// used for domain separation, which may be empty.
+func ParallelHash128(out, data []byte, blockSize int, S []byte) {
+	parallelHash(NewCShake128([]byte("ParallelHash"), S), ShakeSum128, 32, out, data, blockSize, false)
+}
+
+// ParallelHash256 writes the ParallelHash256 digest of len(out) bytes of
+// data, with the block size blockSize and the customization string S, into
+// out. See ParallelHash128.
+func ParallelHash256(out, data []byte, blockSize int, S []byte) {
+	parallelHash(NewCShake256([]byte("ParallelHash"), S), ShakeSum256, 64, out, data, blockSize, false)
+}
+
+// ParallelHashXOF128 writes len(out) bytes of the ParallelHashXOF128
+// output for data, with the block size blockSize and the customization
+// string S, into out. Unlike with ParallelHash128, shorter outputs are
+// prefixes of longer ones.
+func ParallelHashXOF128(out, data []byte, blockSize int, S []byte) {
+	parallelHash(NewCShake128([]byte("ParallelHash"), S), ShakeSum128, 32, out, data, blockSize, true)
+}
+
+// ParallelHashXOF256 writes len(out) bytes of the ParallelHashXOF256
+// output for data, with the block size blockSize and the customization
+// string S, into out. See ParallelHashXOF128.
+func ParallelHashXOF256(out, data []byte, blockSize int, S []byte) {
+	parallelHash(NewCShake256([]byte("ParallelHash"), S), ShakeSum256, 64, out, data, blockSize, true)
+}
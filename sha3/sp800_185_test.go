@@ -0,0 +1,197 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sha3
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func seq(start byte, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = start + byte(i)
+	}
+	return b
+}
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Sample values from NIST SP 800-185, at
+// https://csrc.nist.gov/projects/cryptographic-standards-and-guidelines/example-values.
+func TestKMAC(t *testing.T) {
+	key := seq(0x40, 32)
+	tests := []struct {
+		name string
+		new  func(key, S []byte, outputLen int) ShakeHash
+		data []byte
+		S    string
+		want string
+	}{
+		{"KMAC128", kmac128, seq(0, 4), "",
+			"E5 78 0B 0D 3E A6 F7 D3 A4 29 C5 70 6A A4 3A 00 FA DB D7 D4 96 28 83 9E 31 87 24 3F 45 6E E1 4E"},
+		{"KMAC128", kmac128, seq(0, 4), "My Tagged Application",
+			"3B 1F BA 96 3C D8 B0 B5 9E 8C 1A 6D 71 88 8B 71 43 65 1A F8 BA 0A 70 70 C0 97 9E 28 11 32 4A A5"},
+		{"KMAC128", kmac128, seq(0, 200), "My Tagged Application",
+			"1F 5B 4E 6C CA 02 20 9E 0D CB 5C A6 35 B8 9A 15 E2 71 EC C7 60 07 1D FD 80 5F AA 38 F9 72 92 30"},
+		{"KMACXOF128", kmacXOF128, seq(0, 4), "",
+			"CD 83 74 0B BD 92 CC C8 CF 03 2B 14 81 A0 F4 46 0E 7C A9 DD 12 B0 8A 0C 40 31 17 8B AC D6 EC 35"},
+		{"KMAC256", kmac256, seq(0, 4), "My Tagged Application",
+			"20 C5 70 C3 13 46 F7 03 C9 AC 36 C6 1C 03 CB 64 C3 97 0D 0C FC 78 7E 9B 79 59 9D 27 3A 68 D2 F7 " +
+				"F6 9D 4C C3 DE 9D 10 4A 35 16 89 F2 7C F6 F5 95 1F 01 03 F3 3F 4F 24 87 10 24 D9 C2 77 73 A8 DD"},
+	}
+	for i, tt := range tests {
+		want := unhex(tt.want)
+		h := tt.new(key, []byte(tt.S), len(want))
+		h.Write(tt.data)
+		if got := h.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("%d: %s: got %x, want %x", i, tt.name, got, want)
+		}
+		// Read must agree with Sum, and Reset restore the keyed state.
+		h.Reset()
+		h.Write(tt.data)
+		got := make([]byte, len(want))
+		h.Read(got)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d: %s: Read after Reset: got %x, want %x", i, tt.name, got, want)
+		}
+	}
+}
+
+func kmac128(key, S []byte, outputLen int) ShakeHash {
+	return NewKMAC128(key, S, outputLen).(ShakeHash)
+}
+func kmac256(key, S []byte, outputLen int) ShakeHash {
+	return NewKMAC256(key, S, outputLen).(ShakeHash)
+}
+func kmacXOF128(key, S []byte, outputLen int) ShakeHash { return NewKMACXOF128(key, S) }
+
+func TestKMACOutputLength(t *testing.T) {
+	key := seq(0x40, 32)
+	long := NewKMAC128(key, nil, 64)
+	short := NewKMAC128(key, nil, 32)
+	if bytes.HasPrefix(long.Sum(nil), short.Sum(nil)) {
+		t.Error("KMAC128 output of 32 bytes is a prefix of the output of 64 bytes")
+	}
+
+	xof := NewKMACXOF128(key, nil)
+	sum := xof.Sum(nil)
+	out := make([]byte, 64)
+	xof.Read(out[:10])
+	xof.Read(out[10:])
+	if !bytes.Equal(out[:32], sum) {
+		t.Errorf("KMACXOF128 Sum %x is not a prefix of its output %x", sum, out)
+	}
+	if bytes.Equal(sum, short.Sum(nil)) {
+		t.Error("KMACXOF128 and KMAC128 outputs are equal")
+	}
+}
+
+func TestKMACMarshal(t *testing.T) {
+	key, data := seq(0x40, 32), seq(0, 300)
+	for _, newHash := range []func() ShakeHash{
+		func() ShakeHash { return kmac128(key, []byte("S"), 32) },
+		func() ShakeHash { return kmac256(key, nil, 48) },
+		func() ShakeHash { return NewKMACXOF256(key, []byte("S")) },
+	} {
+		h := newHash()
+		h.Write(data[:150])
+		state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write(data[150:])
+		want := h.Sum(nil)
+
+		h2 := newHash()
+		if err := h2.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			t.Fatal(err)
+		}
+		h2.Write(data[150:])
+		if got := h2.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("got %x after unmarshaling, want %x", got, want)
+		}
+		if err := newHash().(encoding.BinaryUnmarshaler).UnmarshalBinary(state[:20]); err == nil {
+			t.Error("truncated state accepted")
+		}
+	}
+}
+
+func TestTupleHash(t *testing.T) {
+	short := [][]byte{seq(0, 3), seq(0x10, 6)}
+	long := [][]byte{seq(0, 3), seq(0x10, 6), seq(0x20, 9)}
+	tests := []struct {
+		name  string
+		hash  func(out []byte, tuple [][]byte, S []byte)
+		tuple [][]byte
+		S     string
+		want  string
+	}{
+		{"TupleHash128", TupleHash128, short, "",
+			"C5 D8 78 6C 1A FB 9B 82 11 1A B3 4B 65 B2 C0 04 8F A6 4E 6D 48 E2 63 26 4C E1 70 7D 3F FC 8E D1"},
+		{"TupleHash128", TupleHash128, short, "My Tuple App",
+			"75 CD B2 0F F4 DB 11 54 E8 41 D7 58 E2 41 60 C5 4B AE 86 EB 8C 13 E7 F5 F4 0E B3 55 88 E9 6D FB"},
+		{"TupleHash128", TupleHash128, long, "My Tuple App",
+			"E6 0F 20 2C 89 A2 63 1E DA 8D 4C 58 8C A5 FD 07 F3 9E 51 51 99 8D EC CF 97 3A DB 38 04 BB 6E 84"},
+		{"TupleHashXOF128", TupleHashXOF128, short, "",
+			"2F 10 3C D7 C3 23 20 35 34 95 C6 8D E1 A8 12 92 45 C6 32 5F 6F 2A 3D 60 8D 92 17 9C 96 E6 84 88"},
+		{"TupleHash256", TupleHash256, short, "",
+			"CF B7 05 8C AC A5 E6 68 F8 1A 12 A2 0A 21 95 CE 97 A9 25 F1 DB A3 E7 44 9A 56 F8 22 01 EC 60 73 " +
+				"11 AC 26 96 B1 AB 5E A2 35 2D F1 42 3B DE 7B D4 BB 78 C9 AE D1 A8 53 C7 86 72 F9 EB 23 BB E1 94"},
+	}
+	for i, tt := range tests {
+		want := unhex(tt.want)
+		got := make([]byte, len(want))
+		tt.hash(got, tt.tuple, []byte(tt.S))
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d: %s: got %x, want %x", i, tt.name, got, want)
+		}
+	}
+
+	// Moving a byte between the strings changes the digest.
+	a, b := make([]byte, 32), make([]byte, 32)
+	TupleHash128(a, [][]byte{[]byte("ab"), []byte("c")}, nil)
+	TupleHash128(b, [][]byte{[]byte("a"), []byte("bc")}, nil)
+	if bytes.Equal(a, b) {
+		t.Error("TupleHash128 is ambiguous")
+	}
+}
+
+func TestParallelHash(t *testing.T) {
+	data := unhex("00 01 02 03 04 05 06 07 10 11 12 13 14 15 16 17 20 21 22 23 24 25 26 27")
+	tests := []struct {
+		name string
+		hash func(out, data []byte, blockSize int, S []byte)
+		S    string
+		want string
+	}{
+		{"ParallelHash128", ParallelHash128, "",
+			"BA 8D C1 D1 D9 79 33 1D 3F 81 36 03 C6 7F 72 60 9A B5 E4 4B 94 A0 B8 F9 AF 46 51 44 54 A2 B4 F5"},
+		{"ParallelHash128", ParallelHash128, "Parallel Data",
+			"FC 48 4D CB 3F 84 DC EE DC 35 34 38 15 1B EE 58 15 7D 6E FE D0 44 5A 81 F1 65 E4 95 79 5B 72 06"},
+		{"ParallelHashXOF128", ParallelHashXOF128, "",
+			"FE 47 D6 61 E4 9F FE 5B 7D 99 99 22 C0 62 35 67 50 CA F5 52 98 5B 8E 8C E6 66 7F 27 27 C3 C8 D3"},
+		{"ParallelHash256", ParallelHash256, "",
+			"BC 1E F1 24 DA 34 49 5E 94 8E AD 20 7D D9 84 22 35 DA 43 2D 2B BC 54 B4 C1 10 E6 4C 45 11 05 53 " +
+				"1B 7F 2A 3E 0C E0 55 C0 28 05 E7 C2 DE 1F B7 46 AF 97 A1 DD 01 F4 3B 82 4E 31 B8 76 12 41 04 29"},
+	}
+	for i, tt := range tests {
+		want := unhex(tt.want)
+		got := make([]byte, len(want))
+		tt.hash(got, data, 8, []byte(tt.S))
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d: %s: got %x, want %x", i, tt.name, got, want)
+		}
+	}
+}
@@ -104,7 +104,9 @@ type ConstraintExtension struct {
 type AddedKey struct {
 	// PrivateKey must be a *rsa.PrivateKey, *dsa.PrivateKey,
 	// ed25519.PrivateKey or *ecdsa.PrivateKey, which will be inserted into the
-	// agent.
+	// agent. The keyring returned by NewKeyring also accepts any other
+	// crypto.Signer, such as a key held by a remote signing service, since
+	// it doesn't need the private key itself; see also NewSignerAgent.
 	PrivateKey interface{}
 	// Certificate, if not nil, is communicated to the agent and will be
 	// stored with the key.
@@ -120,6 +122,44 @@ type AddedKey struct {
 	// ConstraintExtensions are the experimental or private-use constraints
 	// defined by users.
 	ConstraintExtensions []ConstraintExtension
+	// DestinationConstraints, if not empty, restrict the hosts through
+	// which and to which the key may be used, as described in the
+	// restrict-destination-v00@openssh.com section of [PROTOCOL.agent].
+	// Each connection the key is used for must be listed. The keyring
+	// returned by NewKeyring does not enforce destination constraints and
+	// refuses keys that carry them.
+	DestinationConstraints []DestinationConstraint
+}
+
+// DestinationConstraint permits the use of a key to authenticate from one
+// host to another. See the OpenSSH ssh-add(1) -h option.
+type DestinationConstraint struct {
+	// From is the host the connection originates from. An empty From
+	// Hostname means the host the agent runs on. From Username must be
+	// empty.
+	From DestinationHop
+	// To is the host the key may authenticate to. Its Hostname must not be
+	// empty.
+	To DestinationHop
+}
+
+// DestinationHop describes one of the hosts of a DestinationConstraint.
+type DestinationHop struct {
+	// Username, if not empty, is the only user the key may authenticate
+	// as on this host.
+	Username string
+	// Hostname is the name of the host, only used for display purposes.
+	Hostname string
+	// HostKeys lists the keys the host is identified with.
+	HostKeys []HostKeySpec
+}
+
+// HostKeySpec identifies a host by its host key, or by a certificate
+// authority that signs its host certificates.
+type HostKeySpec struct {
+	HostKey ssh.PublicKey
+	// IsCA reports whether HostKey is a certificate authority key.
+	IsCA bool
 }
 
 // See [PROTOCOL.agent], section 3.
@@ -151,6 +191,10 @@ const (
 	agentConstrainExtension = 255
 )
 
+// restrictDestinationExtension is the name of the constraint extension
+// carrying DestinationConstraints.
+const restrictDestinationExtension = "restrict-destination-v00@openssh.com"
+
 // maxAgentResponseBytes is the maximum agent reply size that is accepted. This
 // is a sanity check, not a limit in the spec.
 const maxAgentResponseBytes = 16 << 20
@@ -217,6 +261,34 @@ type constrainExtensionAgentMsg struct {
 	Rest []byte `ssh:"rest"`
 }
 
+// These structures mirror the wire format of the constraints of the
+// restrict-destination-v00@openssh.com extension. Hops and constraints are
+// each wrapped in a string.
+type destinationConstraintMsg struct {
+	From     []byte
+	To       []byte
+	Reserved []byte
+
+	// Rest is a field used for parsing, not part of message
+	Rest []byte `ssh:"rest"`
+}
+
+type destinationHopMsg struct {
+	Username string
+	Hostname string
+	Reserved []byte
+	// HostKeys is a sequence of hostKeySpecMsg.
+	HostKeys []byte `ssh:"rest"`
+}
+
+type hostKeySpecMsg struct {
+	KeyBlob []byte
+	IsCA    bool
+
+	// Rest is a field used for parsing, not part of message
+	Rest []byte `ssh:"rest"`
+}
+
 // See [PROTOCOL.agent], section 4.7
 const agentExtension = 27
 const agentExtensionFailure = 28
@@ -661,6 +733,23 @@ func (c *client) Add(key AddedKey) error {
 		constraints = append(constraints, agentConstrainConfirm)
 	}
 
+	for _, ext := range key.ConstraintExtensions {
+		constraints = append(constraints, agentConstrainExtension)
+		constraints = append(constraints, ssh.Marshal(ext)...)
+	}
+
+	if len(key.DestinationConstraints) > 0 {
+		details, err := marshalDestinationConstraints(key.DestinationConstraints)
+		if err != nil {
+			return err
+		}
+		constraints = append(constraints, agentConstrainExtension)
+		constraints = append(constraints, ssh.Marshal(ConstraintExtension{
+			ExtensionName:    restrictDestinationExtension,
+			ExtensionDetails: details,
+		})...)
+	}
+
 	cert := key.Certificate
 	if cert == nil {
 		return c.insertKey(key.PrivateKey, key.Comment, constraints)
@@ -668,6 +757,46 @@ func (c *client) Add(key AddedKey) error {
 	return c.insertCert(key.PrivateKey, cert, key.Comment, constraints)
 }
 
+func marshalDestinationConstraints(dcs []DestinationConstraint) ([]byte, error) {
+	marshalHop := func(h DestinationHop) []byte {
+		msg := destinationHopMsg{
+			Username: h.Username,
+			Hostname: h.Hostname,
+		}
+		for _, k := range h.HostKeys {
+			msg.HostKeys = append(msg.HostKeys, ssh.Marshal(hostKeySpecMsg{
+				KeyBlob: k.HostKey.Marshal(),
+				IsCA:    k.IsCA,
+			})...)
+		}
+		return ssh.Marshal(msg)
+	}
+
+	var details []byte
+	for _, dc := range dcs {
+		if dc.From.Username != "" {
+			return nil, errors.New("agent: destination constraint has a From username")
+		}
+		if dc.To.Hostname == "" {
+			return nil, errors.New("agent: destination constraint has no To hostname")
+		}
+		for _, h := range []DestinationHop{dc.From, dc.To} {
+			for _, k := range h.HostKeys {
+				if k.HostKey == nil {
+					return nil, errors.New("agent: destination constraint has a nil host key")
+				}
+			}
+		}
+		details = append(details, ssh.Marshal(struct {
+			Constraint []byte
+		}{ssh.Marshal(destinationConstraintMsg{
+			From: marshalHop(dc.From),
+			To:   marshalHop(dc.To),
+		})})...)
+	}
+	return details, nil
+}
+
 func (c *client) insertCert(s interface{}, cert *ssh.Certificate, comment string, constraints []byte) error {
 	var req []byte
 	switch k := s.(type) {
@@ -0,0 +1,123 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+var errFiltered = errors.New("agent: operation not permitted by the key filter")
+
+type filteredAgent struct {
+	agent Agent
+	allow func(key *Key) bool
+}
+
+// NewFilteredAgent returns an agent that only exposes the keys of agent for
+// which allow returns true: List omits the other keys, and signature
+// requests for them fail. The returned agent is read-only, and doesn't
+// support extensions, so that it can't affect the keys it hides: Add,
+// Remove, RemoveAll, Lock, Unlock and Extension return errors.
+func NewFilteredAgent(agent Agent, allow func(key *Key) bool) ExtendedAgent {
+	return &filteredAgent{agent: agent, allow: allow}
+}
+
+func (f *filteredAgent) List() ([]*Key, error) {
+	keys, err := f.agent.List()
+	if err != nil {
+		return nil, err
+	}
+	var allowed []*Key
+	for _, k := range keys {
+		if f.allow(k) {
+			allowed = append(allowed, k)
+		}
+	}
+	return allowed, nil
+}
+
+// allowed reports whether key is one of the keys returned by List.
+func (f *filteredAgent) allowed(key ssh.PublicKey) (bool, error) {
+	keys, err := f.List()
+	if err != nil {
+		return false, err
+	}
+	want := key.Marshal()
+	for _, k := range keys {
+		if bytes.Equal(k.Blob, want) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *filteredAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return f.SignWithFlags(key, data, 0)
+}
+
+func (f *filteredAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags SignatureFlags) (*ssh.Signature, error) {
+	if ok, err := f.allowed(key); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errFiltered
+	}
+	if flags == 0 {
+		return f.agent.Sign(key, data)
+	}
+	if ext, ok := f.agent.(ExtendedAgent); ok {
+		return ext.SignWithFlags(key, data, flags)
+	}
+	return nil, fmt.Errorf("agent: unsupported signature flags: %d", flags)
+}
+
+func (f *filteredAgent) Signers() ([]ssh.Signer, error) {
+	signers, err := f.agent.Signers()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := f.List()
+	if err != nil {
+		return nil, err
+	}
+	var allowed []ssh.Signer
+	for _, s := range signers {
+		blob := s.PublicKey().Marshal()
+		for _, k := range keys {
+			if bytes.Equal(k.Blob, blob) {
+				allowed = append(allowed, s)
+				break
+			}
+		}
+	}
+	return allowed, nil
+}
+
+func (f *filteredAgent) Add(key AddedKey) error {
+	return errFiltered
+}
+
+func (f *filteredAgent) Remove(key ssh.PublicKey) error {
+	return errFiltered
+}
+
+func (f *filteredAgent) RemoveAll() error {
+	return errFiltered
+}
+
+func (f *filteredAgent) Lock(passphrase []byte) error {
+	return errFiltered
+}
+
+func (f *filteredAgent) Unlock(passphrase []byte) error {
+	return errFiltered
+}
+
+func (f *filteredAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	return nil, ErrExtensionUnsupported
+}
@@ -17,7 +17,7 @@ import (
 // ForwardToAgent or ForwardToRemote should be called to route
 // the authentication requests.
 func RequestAgentForwarding(session *ssh.Session) error {
-	ok, err := session.SendRequest("auth-agent-req@openssh.com", true, nil)
+	ok, err := session.SendRequest(ForwardingRequestType, true, nil)
 	if err != nil {
 		return err
 	}
@@ -78,6 +78,77 @@ func ForwardToRemote(client *ssh.Client, addr string) error {
 	return nil
 }
 
+// ForwardingRequestType is the type of the session request with which a
+// client asks for agent forwarding, see RequestAgentForwarding. A server that
+// accepts it by replying true can then reach the agent of the client with
+// OpenForwardedAgent or ServeForwardedAgent.
+const ForwardingRequestType = "auth-agent-req@openssh.com"
+
+// OpenForwardedAgent opens a channel to the agent that the client of conn
+// forwards, and returns a client for it. The returned channel must be closed
+// once the agent is no longer needed.
+func OpenForwardedAgent(conn ssh.Conn) (ExtendedAgent, ssh.Channel, error) {
+	channel, reqs, err := conn.OpenChannel(channelType, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	go ssh.DiscardRequests(reqs)
+	return NewClient(channel), channel, nil
+}
+
+// ServeForwardedAgent accepts connections on l, typically a Unix socket whose
+// path is given to programs in the SSH_AUTH_SOCK environment variable, and
+// forwards each of them to the agent of the client of conn, through a new
+// channel.
+//
+// If allow is not nil, only the keys for which it returns true are exposed,
+// and the agent is read-only, see NewFilteredAgent. Otherwise, the
+// connections are forwarded as is.
+//
+// ServeForwardedAgent returns when l.Accept fails, for example after l is
+// closed. Forwarded connections continue until either side closes them, or
+// conn is closed.
+func ServeForwardedAgent(conn ssh.Conn, l net.Listener, allow func(key *Key) bool) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveForwardedAgent(conn, c, allow)
+	}
+}
+
+func serveForwardedAgent(conn ssh.Conn, c net.Conn, allow func(key *Key) bool) {
+	defer c.Close()
+	channel, reqs, err := conn.OpenChannel(channelType, nil)
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(reqs)
+
+	if allow != nil {
+		ServeAgent(NewFilteredAgent(NewClient(channel), allow), c)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		io.Copy(channel, c)
+		channel.CloseWrite()
+		wg.Done()
+	}()
+	go func() {
+		io.Copy(c, channel)
+		if cw, ok := c.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
 func forwardUnixSocket(channel ssh.Channel, addr string) {
 	conn, err := net.Dial("unix", addr)
 	if err != nil {
@@ -32,6 +32,13 @@ type keyring struct {
 
 var errLocked = errors.New("agent: locked")
 
+// errDestinationConstrained is returned when adding a key with
+// destination constraints. Enforcing them requires tracking the
+// session-bind@openssh.com extension for every connection, which the
+// keyring does not do, and accepting such a key unrestricted would be
+// worse than refusing it.
+var errDestinationConstrained = errors.New("agent: destination constraints are not supported")
+
 // NewKeyring returns an Agent that holds keys in memory.  It is safe
 // for concurrent use by multiple goroutines.
 func NewKeyring() Agent {
@@ -145,13 +152,17 @@ func (r *keyring) List() ([]*Key, error) {
 
 // Insert adds a private key to the keyring. If a certificate
 // is given, that certificate is added as public key. Note that
-// any constraints given are ignored.
+// ConfirmBeforeUse and ConstraintExtensions are ignored, and keys with
+// DestinationConstraints are rejected.
 func (r *keyring) Add(key AddedKey) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if r.locked {
 		return errLocked
 	}
+	if len(key.DestinationConstraints) > 0 {
+		return errDestinationConstrained
+	}
 	signer, err := ssh.NewSignerFromKey(key.PrivateKey)
 
 	if err != nil {
@@ -205,29 +216,34 @@ func (r *keyring) SignWithFlags(key ssh.PublicKey, data []byte, flags SignatureF
 	wanted := key.Marshal()
 	for _, k := range r.keys {
 		if bytes.Equal(k.signer.PublicKey().Marshal(), wanted) {
-			if flags == 0 {
-				return k.signer.Sign(rand.Reader, data)
-			} else {
-				if algorithmSigner, ok := k.signer.(ssh.AlgorithmSigner); !ok {
-					return nil, fmt.Errorf("agent: signature does not support non-default signature algorithm: %T", k.signer)
-				} else {
-					var algorithm string
-					switch flags {
-					case SignatureFlagRsaSha256:
-						algorithm = ssh.KeyAlgoRSASHA256
-					case SignatureFlagRsaSha512:
-						algorithm = ssh.KeyAlgoRSASHA512
-					default:
-						return nil, fmt.Errorf("agent: unsupported signature flags: %d", flags)
-					}
-					return algorithmSigner.SignWithAlgorithm(rand.Reader, data, algorithm)
-				}
-			}
+			return signWithFlags(k.signer, data, flags)
 		}
 	}
 	return nil, errors.New("not found")
 }
 
+// signWithFlags signs data with signer, using the RSA signature algorithm
+// selected by flags, if any.
+func signWithFlags(signer ssh.Signer, data []byte, flags SignatureFlags) (*ssh.Signature, error) {
+	if flags == 0 {
+		return signer.Sign(rand.Reader, data)
+	}
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("agent: signature does not support non-default signature algorithm: %T", signer)
+	}
+	var algorithm string
+	switch flags {
+	case SignatureFlagRsaSha256:
+		algorithm = ssh.KeyAlgoRSASHA256
+	case SignatureFlagRsaSha512:
+		algorithm = ssh.KeyAlgoRSASHA512
+	default:
+		return nil, fmt.Errorf("agent: unsupported signature flags: %d", flags)
+	}
+	return algorithmSigner.SignWithAlgorithm(rand.Reader, data, algorithm)
+}
+
 // Signers returns signers for all the known keys.
 func (r *keyring) Signers() ([]ssh.Signer, error) {
 	r.mu.Lock()
@@ -4,7 +4,10 @@
 
 package agent
 
-import "testing"
+import (
+	"crypto"
+	"testing"
+)
 
 func addTestKey(t *testing.T, a Agent, keyName string) {
 	err := a.Add(AddedKey{
@@ -120,3 +123,24 @@ func TestAddDuplicateKey(t *testing.T) {
 		t.Fatal("key with the updated comment not found")
 	}
 }
+
+func TestKeyringOpaqueSigner(t *testing.T) {
+	k := NewKeyring()
+	for _, name := range []string{"rsa", "ecdsa", "ed25519"} {
+		signer := &opaqueSigner{Signer: testPrivateKeys[name].(crypto.Signer)}
+		if err := k.Add(AddedKey{PrivateKey: signer, Comment: name}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		data := []byte("data")
+		sig, err := k.Sign(testPublicKeys[name], data)
+		if err != nil {
+			t.Fatalf("%s: Sign: %v", name, err)
+		}
+		if err := testPublicKeys[name].Verify(data, sig); err != nil {
+			t.Errorf("%s: Verify: %v", name, err)
+		}
+		if signer.signed != 1 {
+			t.Errorf("%s: the crypto.Signer was called %d times, want 1", name, signer.signed)
+		}
+	}
+}
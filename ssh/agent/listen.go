@@ -0,0 +1,72 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// PeerCredentials are the credentials of the process at the other end of a
+// connection to an agent.
+type PeerCredentials struct {
+	// UID and GID are the user and group IDs of the peer, or -1 on
+	// Windows, where named pipes made by Listen are only accessible to the
+	// user running the process.
+	UID, GID int
+	// PID is the process ID of the peer, or -1 if it is unknown.
+	PID int
+}
+
+// GetPeerCredentials returns the credentials of the peer of c, which must be
+// a UNIX socket connection on Linux, macOS or FreeBSD, or a named pipe
+// connection accepted from a listener made by Listen on Windows.
+func GetPeerCredentials(c net.Conn) (*PeerCredentials, error) {
+	return peerCredentials(c)
+}
+
+// Serve accepts connections on l and serves the agent protocol on each of
+// them in a new goroutine, with ServeAgent. It returns the error of Accept,
+// which is net.ErrClosed once l is closed. The listener can come from
+// Listen, SystemdListeners or net.Listen.
+//
+// Before serving a connection, Serve calls checkPeer with the credentials of
+// its peer, or nil if they can't be determined, and closes the connection
+// if checkPeer returns an error. If checkPeer is nil, only peers running as
+// the same user as the process, or as root, are served, as by ssh-agent(1).
+func Serve(l net.Listener, agent Agent, checkPeer func(*PeerCredentials) error) error {
+	if checkPeer == nil {
+		checkPeer = checkSameUser
+	}
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer c.Close()
+			creds, err := peerCredentials(c)
+			if err != nil {
+				creds = nil
+			}
+			if checkPeer(creds) != nil {
+				return
+			}
+			ServeAgent(agent, c)
+		}()
+	}
+}
+
+func checkSameUser(creds *PeerCredentials) error {
+	if creds == nil {
+		return errors.New("agent: unknown peer credentials")
+	}
+	if uid := os.Getuid(); creds.UID != uid && creds.UID != 0 {
+		return fmt.Errorf("agent: peer runs as user %d, not %d", creds.UID, uid)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix && !windows
+
+package agent
+
+import (
+	"errors"
+	"net"
+)
+
+var errListenUnsupported = errors.New("agent: agent sockets are not supported on this platform")
+
+// Listen returns an error on platforms without UNIX sockets or named
+// pipes.
+func Listen(address string) (net.Listener, error) {
+	return nil, errListenUnsupported
+}
+
+// Dial returns an error on platforms without UNIX sockets or named pipes.
+func Dial(address string) (net.Conn, error) {
+	return nil, errListenUnsupported
+}
+
+// SystemdListeners returns nil on platforms without systemd.
+func SystemdListeners() ([]net.Listener, error) {
+	return nil, nil
+}
+
+func peerCredentials(c net.Conn) (*PeerCredentials, error) {
+	return nil, errListenUnsupported
+}
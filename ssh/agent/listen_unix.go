@@ -0,0 +1,144 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Listen returns a listener for agent clients at address, which is the path
+// of a UNIX socket, such as the value of SSH_AUTH_SOCK, or on Windows the
+// name of a named pipe, such as `\\.\pipe\openssh-ssh-agent` for
+// compatibility with the agent of OpenSSH for Windows. UNIX sockets are made
+// accessible only to their owner, and named pipes only to the user running
+// the process.
+func Listen(address string) (net.Listener, error) {
+	// The socket is created with the permissions allowed by the umask, so
+	// it is bound in a private directory, and only linked at address once
+	// its permissions are restricted. Unlike a rename, the link fails if
+	// address exists, as binding to it would.
+	dir, err := os.MkdirTemp(filepath.Dir(address), ".agent-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+	testHookBound()
+	if err := os.Chmod(tmp, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Link(tmp, address); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: l, address: address}, nil
+}
+
+// testHookBound is called by Listen once its socket is bound. It is changed
+// by tests.
+var testHookBound = func() {}
+
+// unixListener is a listener bound to another path than address, which it
+// removes when it is closed.
+type unixListener struct {
+	*net.UnixListener
+	address string
+	once    sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.address, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() { os.Remove(l.address) })
+	return err
+}
+
+// Dial connects to the agent at address, the path of a UNIX socket or on
+// Windows the name of a named pipe, as for Listen.
+func Dial(address string) (net.Conn, error) {
+	return net.Dial("unix", address)
+}
+
+// listenFDsStart is the first file descriptor passed by systemd,
+// SD_LISTEN_FDS_START. It is changed by tests.
+var listenFDsStart = 3
+
+// SystemdListeners returns the listeners passed to the process by systemd
+// socket activation, as with sd_listen_fds(3), or nil if there are none, for
+// instance with a socket unit listening on %t/ssh-agent.socket. The
+// LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment variables are unset,
+// so that child processes don't use them.
+func SystemdListeners() ([]net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, errors.New("agent: invalid LISTEN_FDS " + strconv.Quote(fds))
+	}
+
+	var listeners []net.Listener
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func peerCredentials(c net.Conn) (*PeerCredentials, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("agent: peer credentials of a non-UNIX socket connection")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var creds *PeerCredentials
+	var credsErr error
+	if err := raw.Control(func(fd uintptr) {
+		creds, credsErr = getsockoptPeerCredentials(int(fd))
+	}); err != nil {
+		return nil, err
+	}
+	return creds, credsErr
+}
@@ -0,0 +1,196 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// listKeys connects to the agent at address and lists its keys.
+func listKeys(t *testing.T, address string) ([]*Key, error) {
+	t.Helper()
+	c, err := Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	return NewClient(c).List()
+}
+
+func TestListenServe(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(address); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("got socket mode %v and error %v, want 0600", fi.Mode().Perm(), err)
+	}
+
+	keyring := NewKeyring()
+	if err := keyring.Add(AddedKey{PrivateKey: testPrivateKeys["ed25519"], Comment: "ed25519"}); err != nil {
+		t.Fatal(err)
+	}
+	peers := make(chan *PeerCredentials, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(l, keyring, func(creds *PeerCredentials) error {
+			peers <- creds
+			return checkSameUser(creds)
+		})
+	}()
+
+	keys, err := listKeys(t, address)
+	if err != nil || len(keys) != 1 || keys[0].Comment != "ed25519" {
+		t.Errorf("got keys %v and error %v, want the ed25519 key", keys, err)
+	}
+	creds := <-peers
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "freebsd" {
+		if creds == nil || creds.UID != os.Getuid() {
+			t.Errorf("got peer credentials %+v, want user %d", creds, os.Getuid())
+		}
+		if runtime.GOOS != "freebsd" && creds != nil && creds.PID != os.Getpid() {
+			t.Errorf("got peer PID %d, want %d", creds.PID, os.Getpid())
+		}
+	}
+
+	l.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Serve returned %v after Close, want net.ErrClosed", err)
+	}
+
+	// A refused peer is disconnected.
+	os.Remove(address)
+	if l, err = Listen(address); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go Serve(l, keyring, func(creds *PeerCredentials) error {
+		return errors.New("refused")
+	})
+	if _, err := listKeys(t, address); err == nil {
+		t.Error("refused peer could list keys")
+	}
+}
+
+func TestCheckSameUser(t *testing.T) {
+	uid := os.Getuid()
+	for _, test := range []struct {
+		creds *PeerCredentials
+		ok    bool
+	}{
+		{nil, false},
+		{&PeerCredentials{UID: uid}, true},
+		{&PeerCredentials{UID: 0}, true},
+		{&PeerCredentials{UID: uid + 1}, uid+1 == 0},
+	} {
+		if err := checkSameUser(test.creds); (err == nil) != test.ok {
+			t.Errorf("checkSameUser(%+v): got error %v, want success %v", test.creds, err, test.ok)
+		}
+	}
+}
+
+func TestListenPermissions(t *testing.T) {
+	// With a umask that allows everything, the socket must still never be
+	// accessible to others.
+	defer syscall.Umask(syscall.Umask(0))
+	dir := t.TempDir()
+	address := filepath.Join(dir, "agent.sock")
+
+	// Nothing may connect at address before the permissions of the
+	// socket are restricted.
+	bound := false
+	testHookBound = func() {
+		bound = true
+		if fi, err := os.Lstat(address); err == nil {
+			t.Errorf("socket at address with mode %v while it is bound", fi.Mode())
+		}
+	}
+	l, err := Listen(address)
+	testHookBound = func() {}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bound {
+		t.Error("Listen didn't bind the socket in a private directory")
+	}
+	fi, err := os.Stat(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Type() != os.ModeSocket || fi.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v right after Listen, want a socket with permissions 0600", fi.Mode())
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("got directory entries %v and error %v, want only the socket", entries, err)
+	}
+	if got := l.Addr().String(); got != address {
+		t.Errorf("got address %q, want %q", got, address)
+	}
+
+	if l, err := Listen(address); err == nil {
+		l.Close()
+		t.Error("Listen succeeded at the address of another listener")
+	}
+	l.Close()
+	if _, err := os.Lstat(address); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got error %v after Close, want the socket removed", err)
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	if ls, err := SystemdListeners(); ls != nil || err != nil {
+		t.Fatalf("got %d listeners and error %v without socket activation", len(ls), err)
+	}
+
+	address := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	defer func(start int) { listenFDsStart = start }(listenFDsStart)
+	listenFDsStart = int(f.Fd())
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "ssh-agent.socket")
+	ls, err := SystemdListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 {
+		t.Fatalf("got %d listeners, want 1", len(ls))
+	}
+	defer ls[0].Close()
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("LISTEN_FDS is still set")
+	}
+
+	go Serve(ls[0], NewKeyring(), nil)
+	if keys, err := listKeys(t, address); err != nil || len(keys) != 0 {
+		t.Errorf("got keys %v and error %v, want none", keys, err)
+	}
+
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if ls, err := SystemdListeners(); ls != nil || err != nil {
+		t.Errorf("got %d listeners and error %v for another process", len(ls), err)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the size of the buffers of named pipe instances.
+const pipeBufferSize = 64 << 10
+
+// Listen returns a listener for agent clients at address, the name of a
+// named pipe such as `\\.\pipe\openssh-ssh-agent`, the pipe of the agent of
+// OpenSSH for Windows. The pipe is only accessible to the user running the
+// process and to the system, and rejects remote clients. See the UNIX
+// version for the other platforms.
+func Listen(address string) (net.Listener, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;SY)(A;;GA;;;" + user.User.Sid.String() + ")")
+	if err != nil {
+		return nil, err
+	}
+	name, err := windows.UTF16PtrFromString(address)
+	if err != nil {
+		return nil, err
+	}
+	l := &pipeListener{
+		address: address,
+		name:    name,
+		sa: &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		},
+	}
+	// The first instance fails if another process already owns the pipe.
+	if l.next, err = l.newInstance(windows.FILE_FLAG_FIRST_PIPE_INSTANCE); err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "pipe", Addr: pipeAddr(address), Err: err}
+	}
+	return l, nil
+}
+
+// Dial connects to the agent at address, the name of a named pipe, as
+// for Listen.
+func Dial(address string) (net.Conn, error) {
+	f, err := os.OpenFile(address, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeConn{f: f, addr: pipeAddr(address)}, nil
+}
+
+// SystemdListeners returns nil on Windows, which doesn't have systemd.
+func SystemdListeners() ([]net.Listener, error) {
+	return nil, nil
+}
+
+func peerCredentials(c net.Conn) (*PeerCredentials, error) {
+	pc, ok := c.(*pipeConn)
+	if !ok {
+		return nil, errors.New("agent: peer credentials of a non-named pipe connection")
+	}
+	var pid uint32
+	if err := windows.GetNamedPipeClientProcessId(windows.Handle(pc.f.Fd()), &pid); err != nil {
+		return nil, err
+	}
+	return &PeerCredentials{UID: -1, GID: -1, PID: int(pid)}, nil
+}
+
+// A pipeListener accepts connections on instances of a named pipe, always
+// keeping one waiting for the next client.
+type pipeListener struct {
+	address string
+	name    *uint16
+	sa      *windows.SecurityAttributes
+
+	mu        sync.Mutex
+	next      windows.Handle // the instance for the next client
+	accepting bool
+	closed    bool
+}
+
+func (l *pipeListener) newInstance(flags uint32) (windows.Handle, error) {
+	return windows.CreateNamedPipe(l.name,
+		windows.PIPE_ACCESS_DUPLEX|flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, l.sa)
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed || l.accepting {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := l.next
+	l.accepting = true
+	l.mu.Unlock()
+
+	err := windows.ConnectNamedPipe(h, nil)
+	if err == windows.ERROR_PIPE_CONNECTED {
+		err = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accepting = false
+	if l.closed {
+		windows.CloseHandle(h)
+		return nil, net.ErrClosed
+	}
+	if err != nil {
+		// Make the instance available for another client.
+		windows.DisconnectNamedPipe(h)
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: l.Addr(), Err: err}
+	}
+	if l.next, err = l.newInstance(0); err != nil {
+		l.closed = true
+		windows.CloseHandle(h)
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: l.Addr(), Err: err}
+	}
+	return &pipeConn{f: os.NewFile(uintptr(h), l.address), addr: pipeAddr(l.address)}, nil
+}
+
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return net.ErrClosed
+	}
+	l.closed = true
+	accepting := l.accepting
+	l.mu.Unlock()
+
+	if accepting {
+		// Wake up the pending ConnectNamedPipe, after which Accept
+		// closes the instance.
+		if f, err := os.OpenFile(l.address, os.O_RDWR, 0); err == nil {
+			f.Close()
+		}
+		return nil
+	}
+	return windows.CloseHandle(l.next)
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.address)
+}
+
+// pipeAddr is the net.Addr of a named pipe.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// A pipeConn is a connection to a named pipe, which doesn't support
+// deadlines.
+type pipeConn struct {
+	f    *os.File
+	addr pipeAddr
+}
+
+func (c *pipeConn) Read(b []byte) (int, error)         { return c.f.Read(b) }
+func (c *pipeConn) Write(b []byte) (int, error)        { return c.f.Write(b) }
+func (c *pipeConn) Close() error                       { return c.f.Close() }
+func (c *pipeConn) LocalAddr() net.Addr                { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr               { return c.addr }
+func (c *pipeConn) SetDeadline(t time.Time) error      { return c.f.SetDeadline(t) }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return c.f.SetReadDeadline(t) }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return c.f.SetWriteDeadline(t) }
@@ -0,0 +1,19 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import "golang.org/x/sys/unix"
+
+func getsockoptPeerCredentials(fd int) (*PeerCredentials, error) {
+	cred, err := unix.GetsockoptXucred(fd, unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	if err != nil {
+		return nil, err
+	}
+	creds := &PeerCredentials{UID: int(cred.Uid), GID: -1, PID: -1}
+	if cred.Ngroups > 0 {
+		creds.GID = int(cred.Groups[0])
+	}
+	return creds, nil
+}
@@ -0,0 +1,13 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix && !linux && !darwin && !freebsd
+
+package agent
+
+import "errors"
+
+func getsockoptPeerCredentials(fd int) (*PeerCredentials, error) {
+	return nil, errors.New("agent: peer credentials are not supported on this platform")
+}
@@ -203,6 +203,9 @@ func parseConstraints(constraints []byte) (lifetimeSecs uint32, confirmBeforeUse
 	for len(constraints) != 0 {
 		switch constraints[0] {
 		case agentConstrainLifetime:
+			if len(constraints) < 5 {
+				return 0, false, nil, errors.New("agent: truncated lifetime constraint")
+			}
 			lifetimeSecs = binary.BigEndian.Uint32(constraints[1:5])
 			constraints = constraints[5:]
 		case agentConstrainConfirm:
@@ -233,10 +236,79 @@ func setConstraints(key *AddedKey, constraintBytes []byte) error {
 
 	key.LifetimeSecs = lifetimeSecs
 	key.ConfirmBeforeUse = confirmBeforeUse
-	key.ConstraintExtensions = constraintExtensions
+	for _, ext := range constraintExtensions {
+		if ext.ExtensionName != restrictDestinationExtension {
+			key.ConstraintExtensions = append(key.ConstraintExtensions, ext)
+			continue
+		}
+		dcs, err := parseDestinationConstraints(ext.ExtensionDetails)
+		if err != nil {
+			return err
+		}
+		key.DestinationConstraints = append(key.DestinationConstraints, dcs...)
+	}
 	return nil
 }
 
+func parseDestinationConstraints(details []byte) ([]DestinationConstraint, error) {
+	parseHop := func(data []byte) (DestinationHop, error) {
+		var msg destinationHopMsg
+		if err := ssh.Unmarshal(data, &msg); err != nil {
+			return DestinationHop{}, err
+		}
+		h := DestinationHop{Username: msg.Username, Hostname: msg.Hostname}
+		for rest := msg.HostKeys; len(rest) > 0; {
+			var k hostKeySpecMsg
+			if err := ssh.Unmarshal(rest, &k); err != nil {
+				return DestinationHop{}, err
+			}
+			pub, err := ssh.ParsePublicKey(k.KeyBlob)
+			if err != nil {
+				return DestinationHop{}, err
+			}
+			h.HostKeys = append(h.HostKeys, HostKeySpec{HostKey: pub, IsCA: k.IsCA})
+			rest = k.Rest
+		}
+		return h, nil
+	}
+
+	var dcs []DestinationConstraint
+	for len(details) > 0 {
+		var wrapped struct {
+			Constraint []byte
+			Rest       []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(details, &wrapped); err != nil {
+			return nil, err
+		}
+		details = wrapped.Rest
+
+		var msg destinationConstraintMsg
+		if err := ssh.Unmarshal(wrapped.Constraint, &msg); err != nil {
+			return nil, err
+		}
+		var dc DestinationConstraint
+		var err error
+		if dc.From, err = parseHop(msg.From); err != nil {
+			return nil, err
+		}
+		if dc.To, err = parseHop(msg.To); err != nil {
+			return nil, err
+		}
+		if dc.From.Username != "" {
+			return nil, errors.New("agent: destination constraint has a From username")
+		}
+		if dc.To.Hostname == "" {
+			return nil, errors.New("agent: destination constraint has no To hostname")
+		}
+		dcs = append(dcs, dc)
+	}
+	if len(dcs) == 0 {
+		return nil, errors.New("agent: empty destination constraint")
+	}
+	return dcs, nil
+}
+
 func parseRSAKey(req []byte) (*AddedKey, error) {
 	var k rsaKeyMsg
 	if err := ssh.Unmarshal(req, &k); err != nil {
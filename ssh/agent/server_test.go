@@ -5,10 +5,12 @@
 package agent
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
 	"fmt"
 	pseudorand "math/rand"
+	"net"
 	"reflect"
 	"strings"
 	"testing"
@@ -87,6 +89,111 @@ func TestSetupForwardAgent(t *testing.T) {
 	conn.Close()
 }
 
+func TestServeForwardedAgent(t *testing.T) {
+	a, b, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer a.Close()
+	defer b.Close()
+
+	keyring := NewKeyring()
+	for _, k := range []string{"rsa", "ecdsa"} {
+		if err := keyring.Add(AddedKey{PrivateKey: testPrivateKeys[k], Comment: k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serverConf := ssh.ServerConfig{
+		NoClientAuth: true,
+	}
+	serverConf.AddHostKey(testSigners["rsa"])
+	incoming := make(chan *ssh.ServerConn, 1)
+	go func() {
+		conn, _, reqs, err := ssh.NewServerConn(a, &serverConf)
+		if err != nil {
+			t.Errorf("NewServerConn error: %v", err)
+		} else {
+			go ssh.DiscardRequests(reqs)
+		}
+		incoming <- conn
+	}()
+
+	conf := ssh.ClientConfig{
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	conn, chans, reqs, err := ssh.NewClientConn(b, "", &conf)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	client := ssh.NewClient(conn, chans, reqs)
+	defer client.Close()
+	if err := ForwardToAgent(client, keyring); err != nil {
+		t.Fatalf("ForwardToAgent: %v", err)
+	}
+	server := <-incoming
+	if server == nil {
+		t.Fatal("Unable to get server")
+	}
+
+	agentClient, ch, err := OpenForwardedAgent(server)
+	if err != nil {
+		t.Fatalf("OpenForwardedAgent: %v", err)
+	}
+	if keys, err := agentClient.List(); err != nil || len(keys) != 2 {
+		t.Errorf("List through OpenForwardedAgent: got %d keys, %v; want 2 keys", len(keys), err)
+	}
+	ch.Close()
+
+	serve := func(allow func(*Key) bool) ExtendedAgent {
+		l, err := netListener()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go ServeForwardedAgent(server, l, allow)
+		c, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return NewClient(c)
+	}
+
+	if keys, err := serve(nil).List(); err != nil || len(keys) != 2 {
+		t.Errorf("List without a filter: got %d keys, %v; want 2 keys", len(keys), err)
+	}
+
+	filtered := serve(func(k *Key) bool { return k.Comment == "rsa" })
+	keys, err := filtered.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Comment != "rsa" {
+		t.Fatalf("List with a filter: got %v, want the rsa key", keys)
+	}
+	data := []byte("data")
+	sig, err := filtered.Sign(testPublicKeys["rsa"], data)
+	if err != nil {
+		t.Fatalf("Sign with an allowed key: %v", err)
+	}
+	if err := testPublicKeys["rsa"].Verify(data, sig); err != nil {
+		t.Error(err)
+	}
+	if _, err := filtered.Sign(testPublicKeys["ecdsa"], data); err == nil {
+		t.Error("Sign with a filtered key succeeded")
+	}
+	if err := filtered.RemoveAll(); err == nil {
+		t.Error("RemoveAll through a filtered agent succeeded")
+	}
+	if err := filtered.Lock([]byte("passphrase")); err == nil {
+		t.Error("Lock through a filtered agent succeeded")
+	}
+	if keys, err := keyring.List(); err != nil || len(keys) != 2 {
+		t.Errorf("got %d keys, %v in the forwarded agent, want 2 keys", len(keys), err)
+	}
+}
+
 func TestV1ProtocolMessages(t *testing.T) {
 	c1, c2, err := netPipe()
 	if err != nil {
@@ -264,3 +371,127 @@ func TestParseConstraints(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+// addRecorder is an Agent that records the keys added to it without
+// storing them.
+type addRecorder struct {
+	Agent
+	added chan AddedKey
+}
+
+func (a *addRecorder) Add(key AddedKey) error {
+	a.added <- key
+	return nil
+}
+
+func TestAddConstraints(t *testing.T) {
+	recorder := &addRecorder{Agent: NewKeyring(), added: make(chan AddedKey, 1)}
+	client, cleanup := startAgent(t, recorder)
+	defer cleanup()
+
+	want := AddedKey{
+		PrivateKey:       testPrivateKeys["ed25519"],
+		Comment:          "constrained",
+		LifetimeSecs:     60,
+		ConfirmBeforeUse: true,
+		ConstraintExtensions: []ConstraintExtension{{
+			ExtensionName:    "my-constraint@example.com",
+			ExtensionDetails: []byte("details"),
+		}},
+		DestinationConstraints: []DestinationConstraint{
+			{
+				To: DestinationHop{
+					Hostname: "jump.example.com",
+					HostKeys: []HostKeySpec{{HostKey: testPublicKeys["rsa"]}},
+				},
+			},
+			{
+				From: DestinationHop{
+					Hostname: "jump.example.com",
+					HostKeys: []HostKeySpec{{HostKey: testPublicKeys["rsa"]}},
+				},
+				To: DestinationHop{
+					Username: "deploy",
+					Hostname: "*.internal.example.com",
+					HostKeys: []HostKeySpec{
+						{HostKey: testPublicKeys["ecdsa"]},
+						{HostKey: testPublicKeys["ed25519"], IsCA: true},
+					},
+				},
+			},
+		},
+	}
+	if err := client.Add(want); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	got := <-recorder.added
+	if got.LifetimeSecs != want.LifetimeSecs || got.ConfirmBeforeUse != want.ConfirmBeforeUse {
+		t.Errorf("got lifetime %d and confirm %v, want %d and %v", got.LifetimeSecs, got.ConfirmBeforeUse, want.LifetimeSecs, want.ConfirmBeforeUse)
+	}
+	if !reflect.DeepEqual(got.ConstraintExtensions, want.ConstraintExtensions) {
+		t.Errorf("got extensions %v, want %v", got.ConstraintExtensions, want.ConstraintExtensions)
+	}
+	if len(got.DestinationConstraints) != len(want.DestinationConstraints) {
+		t.Fatalf("got %d destination constraints, want %d", len(got.DestinationConstraints), len(want.DestinationConstraints))
+	}
+	sameHop := func(a, b DestinationHop) bool {
+		if a.Username != b.Username || a.Hostname != b.Hostname || len(a.HostKeys) != len(b.HostKeys) {
+			return false
+		}
+		for i := range a.HostKeys {
+			if a.HostKeys[i].IsCA != b.HostKeys[i].IsCA || !bytes.Equal(a.HostKeys[i].HostKey.Marshal(), b.HostKeys[i].HostKey.Marshal()) {
+				return false
+			}
+		}
+		return true
+	}
+	for i, dc := range got.DestinationConstraints {
+		w := want.DestinationConstraints[i]
+		if !sameHop(dc.From, w.From) || !sameHop(dc.To, w.To) {
+			t.Errorf("destination constraint %d: got %+v, want %+v", i, dc, w)
+		}
+	}
+
+	invalid := want
+	invalid.DestinationConstraints = []DestinationConstraint{{From: DestinationHop{Username: "root"}, To: DestinationHop{Hostname: "example.com"}}}
+	if err := client.Add(invalid); err == nil {
+		t.Error("Add succeeded with a From username")
+	}
+}
+
+func TestKeyringRejectsDestinationConstraints(t *testing.T) {
+	keyring := NewKeyring()
+	client, cleanup := startAgent(t, keyring)
+	defer cleanup()
+
+	key := AddedKey{
+		PrivateKey: testPrivateKeys["ed25519"],
+		DestinationConstraints: []DestinationConstraint{{
+			To: DestinationHop{
+				Hostname: "example.com",
+				HostKeys: []HostKeySpec{{HostKey: testPublicKeys["rsa"]}},
+			},
+		}},
+	}
+	if err := client.Add(key); err == nil {
+		t.Fatal("Add of a destination-constrained key succeeded")
+	}
+	if keys, err := keyring.List(); err != nil || len(keys) != 0 {
+		t.Errorf("List: got %d keys, %v, want none", len(keys), err)
+	}
+}
+
+func TestParseDestinationConstraintsMalformed(t *testing.T) {
+	for _, details := range [][]byte{
+		nil,
+		{0, 0, 0, 5, 1},
+		ssh.Marshal(struct{ Constraint []byte }{[]byte("garbage")}),
+	} {
+		if _, err := parseDestinationConstraints(details); err == nil {
+			t.Errorf("parseDestinationConstraints(%x) succeeded", details)
+		}
+	}
+	if _, _, _, err := parseConstraints([]byte{agentConstrainLifetime, 0}); err == nil {
+		t.Error("parseConstraints accepted a truncated lifetime")
+	}
+}
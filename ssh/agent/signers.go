@@ -0,0 +1,167 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"errors"
+	"sync"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+var errReadOnly = errors.New("agent: the keys of the agent are read-only")
+
+// A SignerKey is a key of an agent returned by NewSignerAgent.
+type SignerKey struct {
+	// Signer holds the private key, which may be stored in hardware,
+	// such as a PKCS#11 token or a TPM. Its public key must be an
+	// *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey.
+	Signer crypto.Signer
+	// Certificate, if not nil, is a certificate for the public key of
+	// Signer. The agent then lists the certificate instead of the key.
+	Certificate *ssh.Certificate
+	// Comment describes the key.
+	Comment string
+}
+
+type signerAgent struct {
+	keys func() ([]SignerKey, error)
+
+	mu         sync.Mutex
+	locked     bool
+	passphrase []byte
+}
+
+// NewSignerAgent returns an agent that holds the keys returned by keys,
+// which lets ServeAgent front keys that can only be used through a
+// crypto.Signer, such as those of PKCS#11 tokens and TPMs. The agent calls
+// keys on every request, so that it follows tokens being inserted and
+// removed, and the private keys never leave the signers.
+//
+// The keys of the returned agent are read-only: Add, Remove and RemoveAll
+// return errors. Lock and Unlock behave like those of NewKeyring. It is safe
+// for concurrent use by multiple goroutines if keys and the signers are.
+func NewSignerAgent(keys func() ([]SignerKey, error)) ExtendedAgent {
+	return &signerAgent{keys: keys}
+}
+
+// signers returns the keys of the agent as ssh.Signers.
+func (a *signerAgent) signers() ([]ssh.Signer, []string, error) {
+	a.mu.Lock()
+	locked := a.locked
+	a.mu.Unlock()
+	if locked {
+		return nil, nil, errLocked
+	}
+
+	keys, err := a.keys()
+	if err != nil {
+		return nil, nil, err
+	}
+	signers := make([]ssh.Signer, 0, len(keys))
+	comments := make([]string, 0, len(keys))
+	for _, k := range keys {
+		signer, err := ssh.NewSignerFromSigner(k.Signer)
+		if err != nil {
+			return nil, nil, err
+		}
+		if k.Certificate != nil {
+			if signer, err = ssh.NewCertSigner(k.Certificate, signer); err != nil {
+				return nil, nil, err
+			}
+		}
+		signers = append(signers, signer)
+		comments = append(comments, k.Comment)
+	}
+	return signers, comments, nil
+}
+
+func (a *signerAgent) List() ([]*Key, error) {
+	signers, comments, err := a.signers()
+	if err == errLocked {
+		// section 2.7: locked agents return empty.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]*Key, 0, len(signers))
+	for i, s := range signers {
+		pub := s.PublicKey()
+		ids = append(ids, &Key{
+			Format:  pub.Type(),
+			Blob:    pub.Marshal(),
+			Comment: comments[i],
+		})
+	}
+	return ids, nil
+}
+
+func (a *signerAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *signerAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags SignatureFlags) (*ssh.Signature, error) {
+	signers, _, err := a.signers()
+	if err != nil {
+		return nil, err
+	}
+	wanted := key.Marshal()
+	for _, s := range signers {
+		if bytes.Equal(s.PublicKey().Marshal(), wanted) {
+			return signWithFlags(s, data, flags)
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (a *signerAgent) Signers() ([]ssh.Signer, error) {
+	signers, _, err := a.signers()
+	return signers, err
+}
+
+func (a *signerAgent) Add(key AddedKey) error {
+	return errReadOnly
+}
+
+func (a *signerAgent) Remove(key ssh.PublicKey) error {
+	return errReadOnly
+}
+
+func (a *signerAgent) RemoveAll() error {
+	return errReadOnly
+}
+
+func (a *signerAgent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return errLocked
+	}
+	a.locked = true
+	a.passphrase = passphrase
+	return nil
+}
+
+func (a *signerAgent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.locked {
+		return errors.New("agent: not locked")
+	}
+	if subtle.ConstantTimeCompare(passphrase, a.passphrase) != 1 {
+		return errors.New("agent: incorrect passphrase")
+	}
+	a.locked = false
+	a.passphrase = nil
+	return nil
+}
+
+func (a *signerAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	return nil, ErrExtensionUnsupported
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+// opaqueSigner hides the private key behind crypto.Signer, like the
+// signers of hardware tokens.
+type opaqueSigner struct {
+	crypto.Signer
+	signed int
+}
+
+func (s *opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.signed++
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSignerAgent(t *testing.T) {
+	var keys []SignerKey
+	for _, name := range []string{"rsa", "ecdsa", "ed25519"} {
+		keys = append(keys, SignerKey{
+			Signer:  &opaqueSigner{Signer: testPrivateKeys[name].(crypto.Signer)},
+			Comment: name,
+		})
+	}
+	keys = append(keys, SignerKey{
+		Signer:      &opaqueSigner{Signer: testPrivateKeys["ecdsa"].(crypto.Signer)},
+		Certificate: testSigners["cert"].PublicKey().(*ssh.Certificate),
+		Comment:     "cert",
+	})
+	var tokenErr error
+	agent, cleanup := startAgent(t, NewSignerAgent(func() ([]SignerKey, error) {
+		return keys, tokenErr
+	}))
+	defer cleanup()
+
+	list, err := agent.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != len(keys) {
+		t.Fatalf("got %d keys, want %d", len(list), len(keys))
+	}
+	data := []byte("hello")
+	for i, k := range list {
+		if k.Comment != keys[i].Comment || (k.Comment == "cert") != (k.Format == ssh.CertAlgoECDSA256v01) {
+			t.Errorf("got key %s with comment %q, want comment %q", k.Format, k.Comment, keys[i].Comment)
+		}
+		sig, err := agent.Sign(k, data)
+		if err != nil {
+			t.Fatalf("Sign(%s): %v", k.Comment, err)
+		}
+		if err := k.Verify(data, sig); err != nil {
+			t.Errorf("Verify(%s): %v", k.Comment, err)
+		}
+		if n := keys[i].Signer.(*opaqueSigner).signed; n != 1 {
+			t.Errorf("%s signed %d times, want 1", k.Comment, n)
+		}
+	}
+	sig, err := agent.SignWithFlags(list[0], data, SignatureFlagRsaSha512)
+	if err != nil {
+		t.Fatalf("SignWithFlags: %v", err)
+	}
+	if sig.Format != ssh.KeyAlgoRSASHA512 {
+		t.Errorf("got signature format %q, want %q", sig.Format, ssh.KeyAlgoRSASHA512)
+	}
+
+	if err := agent.Add(AddedKey{PrivateKey: testPrivateKeys["dsa"]}); err == nil {
+		t.Error("Add succeeded")
+	}
+	if err := agent.RemoveAll(); err == nil {
+		t.Error("RemoveAll succeeded")
+	}
+
+	// Removing the token removes its keys.
+	keys = keys[:1]
+	if list, err := agent.List(); err != nil || len(list) != 1 {
+		t.Errorf("got %d keys and error %v after removing keys, want 1 key", len(list), err)
+	}
+	tokenErr = errors.New("token unavailable")
+	if _, err := agent.List(); err == nil {
+		t.Error("List succeeded with an unavailable token")
+	}
+	tokenErr = nil
+
+	passphrase := []byte("secret")
+	if err := agent.Lock(passphrase); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if list, err := agent.List(); err != nil || len(list) != 0 {
+		t.Errorf("got %d keys and error %v from locked agent, want 0 keys", len(list), err)
+	}
+	if _, err := agent.Sign(testPublicKeys["rsa"], data); err == nil {
+		t.Error("Sign succeeded on locked agent")
+	}
+	if err := agent.Unlock([]byte("wrong")); err == nil {
+		t.Error("Unlock with wrong passphrase succeeded")
+	}
+	if err := agent.Unlock(passphrase); err != nil {
+		t.Errorf("Unlock: %v", err)
+	}
+	if list, err := agent.List(); err != nil || len(list) != 1 {
+		t.Errorf("got %d keys and error %v after Unlock, want 1 key", len(list), err)
+	}
+}
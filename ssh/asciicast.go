@@ -0,0 +1,176 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// An AsciicastWriter is a SessionRecorder that writes sessions in the
+// asciicast v2 format of asciinema, which can be replayed with
+// "asciinema play". The output and standard error of the session are
+// written as output events, the input of the client as input events, and
+// window changes as resize events.
+//
+// The header, which holds the terminal size and type, is written along
+// with the first event other than SessionPty, with the default size of 80
+// columns and 24 rows if the session has no pseudo-terminal. The command
+// or subsystem of the session is written to the header if it is requested
+// before then.
+type AsciicastWriter struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	err     error
+	started bool
+	start   time.Time
+	last    time.Time // of the latest event
+	header  asciicastHeader
+	// partial holds the incomplete UTF-8 sequences at the end of the
+	// data of the previous events, by event code.
+	partial map[string][]byte
+}
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint32            `json:"width"`
+	Height    uint32            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewAsciicastWriter returns an AsciicastWriter writing to w. Its Close
+// method closes w if it is an io.Closer.
+func NewAsciicastWriter(w io.Writer) *AsciicastWriter {
+	return &AsciicastWriter{
+		w:       w,
+		header:  asciicastHeader{Version: 2, Width: 80, Height: 24},
+		partial: make(map[string][]byte),
+	}
+}
+
+// Record writes e to the recording. Write errors are reported by Close.
+func (a *AsciicastWriter) Record(e SessionEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.start.IsZero() {
+		a.start = e.Time
+	}
+	switch e.Type {
+	case SessionPty:
+		if !a.started {
+			a.setSize(e.Size)
+			if e.Term != "" {
+				a.header.Env = map[string]string{"TERM": e.Term}
+			}
+			return
+		}
+	case SessionWindowChange:
+		if !a.started {
+			a.setSize(e.Size)
+			return
+		}
+		a.writeEvent(e.Time, "r", fmt.Sprintf("%dx%d", e.Size.Columns, e.Size.Rows))
+		return
+	case SessionExec, SessionSubsystem:
+		if !a.started {
+			a.header.Command = e.Command
+		}
+	}
+	a.writeHeader()
+
+	switch e.Type {
+	case SessionInput:
+		a.writeData(e.Time, "i", e.Data)
+	case SessionOutput, SessionStderr:
+		a.writeData(e.Time, "o", e.Data)
+	}
+}
+
+func (a *AsciicastWriter) setSize(size TerminalSize) {
+	if size.Columns > 0 && size.Rows > 0 {
+		a.header.Width, a.header.Height = size.Columns, size.Rows
+	}
+}
+
+func (a *AsciicastWriter) writeHeader() {
+	if a.started {
+		return
+	}
+	a.started = true
+	if a.start.IsZero() {
+		a.start = time.Now()
+	}
+	a.header.Timestamp = a.start.Unix()
+	a.writeJSON(a.header)
+}
+
+// writeData writes an event of data, keeping an incomplete UTF-8 sequence
+// at its end for the next event of the same code, since asciicast events
+// hold text.
+func (a *AsciicastWriter) writeData(t time.Time, code string, data []byte) {
+	buf := append(a.partial[code], data...)
+	n := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				n = i
+			}
+			break
+		}
+	}
+	a.partial[code] = append([]byte(nil), buf[n:]...)
+	if n > 0 {
+		a.writeEvent(t, code, string(buf[:n]))
+	}
+}
+
+func (a *AsciicastWriter) writeEvent(t time.Time, code, data string) {
+	// Microseconds are precise enough, and avoid the exponent notation of
+	// tiny numbers.
+	elapsed := math.Round(t.Sub(a.start).Seconds()*1e6) / 1e6
+	a.writeJSON([]interface{}{elapsed, code, data})
+	a.last = t
+}
+
+func (a *AsciicastWriter) writeJSON(v interface{}) {
+	if a.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		a.err = err
+		return
+	}
+	_, a.err = a.w.Write(append(b, '\n'))
+}
+
+// Close writes the header if no event was written yet and the remaining
+// incomplete UTF-8 sequences, at the time of the last event, closes the underlying writer if it is an
+// io.Closer, and returns the first error encountered.
+func (a *AsciicastWriter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.writeHeader()
+	for _, code := range []string{"i", "o"} {
+		if p := a.partial[code]; len(p) > 0 {
+			a.writeEvent(a.last, code, string(p))
+			delete(a.partial, code)
+		}
+	}
+	if c, ok := a.w.(io.Closer); ok {
+		if err := c.Close(); a.err == nil {
+			a.err = err
+		}
+	}
+	return a.err
+}
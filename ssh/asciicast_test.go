@@ -0,0 +1,74 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsciicastWriter(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	var buf bytes.Buffer
+	a := NewAsciicastWriter(&buf)
+	for _, e := range []SessionEvent{
+		{Time: at(0), Type: SessionPty, Term: "xterm", Size: TerminalSize{Columns: 100, Rows: 30}},
+		{Time: at(time.Millisecond), Type: SessionWindowChange, Size: TerminalSize{Columns: 120, Rows: 40}},
+		{Time: at(2 * time.Millisecond), Type: SessionShell},
+		{Time: at(500 * time.Millisecond), Type: SessionOutput, Data: []byte("$ ")},
+		{Time: at(time.Second), Type: SessionInput, Data: []byte("ls\r")},
+		{Time: at(1500 * time.Millisecond), Type: SessionOutput, Data: []byte("caf\xc3")},
+		{Time: at(1500*time.Millisecond + time.Microsecond), Type: SessionOutput, Data: []byte("\xa9\r\n")},
+		{Time: at(2 * time.Second), Type: SessionStderr, Data: []byte("oops\r\n")},
+		{Time: at(3 * time.Second), Type: SessionWindowChange, Size: TerminalSize{Columns: 80, Rows: 24}},
+	} {
+		a.Record(e)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"version":2,"width":120,"height":40,"timestamp":1700000000,"env":{"TERM":"xterm"}}
+[0.5,"o","$ "]
+[1,"i","ls\r"]
+[1.5,"o","caf"]
+[1.500001,"o","é\r\n"]
+[2,"o","oops\r\n"]
+[3,"r","80x24"]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAsciicastWriterExec(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	var buf bytes.Buffer
+	a := NewAsciicastWriter(&buf)
+	a.Record(SessionEvent{Time: start, Type: SessionExec, Command: "uname -a"})
+	a.Record(SessionEvent{Time: start.Add(time.Second), Type: SessionOutput, Data: []byte("Linux\n\xe2\x82")})
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 4 || lines[3] != "" {
+		t.Fatalf("got output %q, want 3 lines", buf.String())
+	}
+	if want := `{"version":2,"width":80,"height":24,"timestamp":1700000000,"command":"uname -a"}`; lines[0] != want {
+		t.Errorf("got header %s, want %s", lines[0], want)
+	}
+	if want := `[1,"o","Linux\n"]`; lines[1] != want {
+		t.Errorf("got event %s, want %s", lines[1], want)
+	}
+	// The incomplete sequence is written on Close.
+	if want := "[1,\"o\",\"\ufffd\ufffd\"]"; lines[2] != want {
+		t.Errorf("got last event %s, want %s", lines[2], want)
+	}
+}
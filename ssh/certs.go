@@ -295,6 +295,15 @@ type CertChecker struct {
 	// for user certificates.
 	SupportedCriticalOptions []string
 
+	// CriticalOptionHandlers maps the name of a critical option to a
+	// function that validates its value. Options present in this map are
+	// treated as supported, and the handler is called with the principal
+	// being checked, the certificate and the option's value. A non-nil
+	// error from a handler causes the certificate to be rejected.
+	// Handlers only run for user certificates, and only after the
+	// signature, validity period and principals have been checked.
+	CriticalOptionHandlers map[string]func(principal string, cert *Certificate, value string) error
+
 	// IsUserAuthority should return true if the key is recognized as an
 	// authority for the given user certificate. This allows for
 	// certificates to be signed by other certificates. This must be set
@@ -388,9 +397,15 @@ func (c *CertChecker) CheckCert(principal string, cert *Certificate) error {
 	}
 
 	for opt := range cert.CriticalOptions {
-		// sourceAddressCriticalOption will be enforced by
-		// serverAuthenticate
-		if opt == sourceAddressCriticalOption {
+		// sourceAddressCriticalOption and verifyRequiredCriticalOption
+		// will be enforced by serverAuthenticate
+		if opt == sourceAddressCriticalOption || opt == verifyRequiredCriticalOption {
+			continue
+		}
+
+		// Options with a handler are supported, but the handler only
+		// runs once the certificate has been fully verified below.
+		if _, ok := c.CriticalOptionHandlers[opt]; ok && cert.CertType == UserCert {
 			continue
 		}
 
@@ -436,6 +451,21 @@ func (c *CertChecker) CheckCert(principal string, cert *Certificate) error {
 		return fmt.Errorf("ssh: certificate signature does not verify")
 	}
 
+	if cert.CertType == UserCert {
+		opts := make([]string, 0, len(cert.CriticalOptions))
+		for opt := range cert.CriticalOptions {
+			if _, ok := c.CriticalOptionHandlers[opt]; ok {
+				opts = append(opts, opt)
+			}
+		}
+		sort.Strings(opts)
+		for _, opt := range opts {
+			if err := c.CriticalOptionHandlers[opt](principal, cert, cert.CriticalOptions[opt]); err != nil {
+				return fmt.Errorf("ssh: critical option %q rejected: %w", opt, err)
+			}
+		}
+	}
+
 	return nil
 }
 
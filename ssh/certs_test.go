@@ -9,6 +9,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -161,6 +162,82 @@ func TestValidateCertTime(t *testing.T) {
 	}
 }
 
+func TestCriticalOptionHandlers(t *testing.T) {
+	cert := &Certificate{
+		ValidPrincipals: []string{"user"},
+		Key:             testPublicKeys["rsa"],
+		ValidBefore:     CertTimeInfinity,
+		CertType:        UserCert,
+		Permissions: Permissions{
+			CriticalOptions: map[string]string{"org-team": "infra"},
+		},
+	}
+	cert.SignCert(rand.Reader, testSigners["ecdsa"])
+
+	checker := CertChecker{
+		IsUserAuthority: func(k PublicKey) bool {
+			return bytes.Equal(k.Marshal(), testPublicKeys["ecdsa"].Marshal())
+		},
+	}
+	if err := checker.CheckCert("user", cert); err == nil {
+		t.Fatal("cert with unknown critical option passed validation")
+	}
+
+	var gotPrincipal, gotValue string
+	checker.CriticalOptionHandlers = map[string]func(string, *Certificate, string) error{
+		"org-team": func(principal string, c *Certificate, value string) error {
+			gotPrincipal, gotValue = principal, value
+			if value != "infra" {
+				return errors.New("wrong team")
+			}
+			return nil
+		},
+	}
+	if err := checker.CheckCert("user", cert); err != nil {
+		t.Fatalf("CheckCert: %v", err)
+	}
+	if gotPrincipal != "user" || gotValue != "infra" {
+		t.Errorf("handler got (%q, %q), want (%q, %q)", gotPrincipal, gotValue, "user", "infra")
+	}
+
+	cert.CriticalOptions["org-team"] = "web"
+	cert.SignCert(rand.Reader, testSigners["ecdsa"])
+	if err := checker.CheckCert("user", cert); err == nil {
+		t.Error("cert rejected by critical option handler passed validation")
+	}
+
+	// Handlers must not see certificates that fail verification, nor
+	// host certificates.
+	called := false
+	checker.CriticalOptionHandlers["org-team"] = func(string, *Certificate, string) error {
+		called = true
+		return nil
+	}
+	cert.CriticalOptions["org-team"] = "infra"
+	cert.SignCert(rand.Reader, testSigners["ecdsa"])
+	forged := *cert
+	forged.Permissions.CriticalOptions = map[string]string{"org-team": "forged"}
+	expired := *cert
+	expired.ValidBefore = 1
+	expired.SignCert(rand.Reader, testSigners["ecdsa"])
+	host := *cert
+	host.CertType = HostCert
+	host.SignCert(rand.Reader, testSigners["ecdsa"])
+	for name, c := range map[string]*Certificate{"forged": &forged, "expired": &expired, "host": &host} {
+		called = false
+		if err := checker.CheckCert("user", c); err == nil {
+			t.Errorf("%s cert passed validation", name)
+		}
+		if called {
+			t.Errorf("handler called for %s cert", name)
+		}
+	}
+	called = false
+	if err := checker.CheckCert("other", cert); err == nil || called {
+		t.Errorf("cert for other principal: got %v and handler called %v, want error and no call", err, called)
+	}
+}
+
 // TODO(hanwen): tests for
 //
 // host keys:
@@ -11,6 +11,8 @@ import (
 	"io"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -21,8 +23,42 @@ const (
 	channelMaxPacket = 1 << 15
 	// We follow OpenSSH here.
 	channelWindowSize = 64 * channelMaxPacket
+	// maxChannelMaxPacket is the largest ChannelMaxPacket, which keeps
+	// data packets well below the maxPacket limit of the transport.
+	maxChannelMaxPacket = 1 << 17
 )
 
+// channelFlowControl returns the initial window and the maximum incoming
+// payload size of a new channel of type chanType. c may be nil.
+func (c *Config) channelFlowControl(chanType string) (windowSize, maxPacket uint32) {
+	windowSize, maxPacket = channelWindowSize, channelMaxPacket
+	if c == nil {
+		return windowSize, maxPacket
+	}
+	if c.ChannelWindowSize > 0 {
+		windowSize = c.ChannelWindowSize
+	}
+	if c.ChannelMaxPacket > 0 {
+		maxPacket = c.ChannelMaxPacket
+	}
+	if c.ChannelFlowControl != nil {
+		w, p := c.ChannelFlowControl(chanType)
+		if w > 0 {
+			windowSize = w
+		}
+		if p > 0 {
+			maxPacket = p
+		}
+	}
+	if maxPacket > maxChannelMaxPacket {
+		maxPacket = maxChannelMaxPacket
+	}
+	if windowSize < maxPacket {
+		windowSize = maxPacket
+	}
+	return windowSize, maxPacket
+}
+
 // NewChannel represents an incoming request to a channel. It must either be
 // accepted for use by calling Accept, or rejected by calling Reject.
 type NewChannel interface {
@@ -160,6 +196,10 @@ type channel struct {
 	maxIncomingPayload uint32
 	maxRemotePayload   uint32
 
+	// windowSize and maxPacket are the initial window and the
+	// maxIncomingPayload advertised to the peer.
+	windowSize, maxPacket uint32
+
 	mux *mux
 
 	// decided is set to true if an accept or reject message has been sent
@@ -173,10 +213,10 @@ type channel struct {
 	// Pending internal channel messages.
 	msg chan interface{}
 
-	// Since requests have no ID, there can be only one request
-	// with WantReply=true outstanding.  This lock is held by a
-	// goroutine that has such an outgoing request pending.
-	sentRequestMu sync.Mutex
+	// Since requests have no ID, the replies to the outgoing
+	// requests with WantReply=true are expected in the order in
+	// which the requests were sent.
+	sentRequests replyQueue
 
 	incomingRequests chan *Request
 
@@ -193,6 +233,11 @@ type channel struct {
 	myWindow   uint32
 	myConsumed uint32
 
+	// streams, if not nil, receives the data and the extended data of
+	// type 1 in the order they arrive, instead of pending and extPending.
+	// It is protected by windowMu.
+	streams *streamBuffer
+
 	// writeMu serializes calls to mux.conn.writePacket() and
 	// protects sentClose and packetPool. This mutex must be
 	// different from windowMu, as writePacket can block if there
@@ -203,6 +248,22 @@ type channel struct {
 	// packetPool has a buffer for each extended channel ID to
 	// save allocations during writes.
 	packetPool map[uint32][]byte
+
+	// Statistics for ConnMetrics. opened is set once the channel is
+	// confirmed or accepted, at openedAt.
+	created, openedAt        time.Time
+	opened                   atomic.Bool
+	bytesSent, bytesReceived atomic.Uint64
+
+	// sendLimits and receiveLimits are the rate limiters of the data sent
+	// and received on the channel. done, which is only set with
+	// sendLimits, is closed when the channel is closed.
+	sendLimits, receiveLimits rateLimits
+	done                      chan struct{}
+
+	// recording records the events of inbound session channels, if the
+	// server records sessions.
+	recording atomic.Pointer[sessionRecording]
 }
 
 // writePacket sends a packet. If the packet is a channel close, it updates
@@ -255,6 +316,9 @@ func (ch *channel) WriteExtended(data []byte, extendedCode uint32) (n int, err e
 		if space, err = ch.remoteWin.reserve(space); err != nil {
 			return n, err
 		}
+		if len(ch.sendLimits) > 0 && !ch.waitSendLimits(space) {
+			return n, io.EOF
+		}
 		if want := headerLength + space; uint32(cap(packet)) < want {
 			packet = make([]byte, want)
 		} else {
@@ -273,6 +337,10 @@ func (ch *channel) WriteExtended(data []byte, extendedCode uint32) (n int, err e
 		if err = ch.writePacket(packet); err != nil {
 			return n, err
 		}
+		ch.bytesSent.Add(uint64(len(todo)))
+		if extendedCode <= 1 {
+			ch.recordData(SessionOutput+SessionEventType(extendedCode), todo)
+		}
 
 		n += len(todo)
 		data = data[len(todo):]
@@ -293,7 +361,7 @@ func (ch *channel) handleData(packet []byte) error {
 	}
 	if len(packet) < headerLen {
 		// malformed data packet
-		return parseError(packet[0])
+		return malformed(packet[0], parseError(packet[0]))
 	}
 
 	var extended uint32
@@ -307,24 +375,31 @@ func (ch *channel) handleData(packet []byte) error {
 	}
 	if length > ch.maxIncomingPayload {
 		// TODO(hanwen): should send Disconnect?
-		return errors.New("ssh: incoming packet exceeds maximum payload size")
+		return malformed(packet[0], errors.New("ssh: incoming packet exceeds maximum payload size"))
 	}
 
 	data := packet[headerLen:]
 	if length != uint32(len(data)) {
-		return errors.New("ssh: wrong packet length")
+		return malformed(packet[0], errors.New("ssh: wrong packet length"))
 	}
 
 	ch.windowMu.Lock()
 	if ch.myWindow < length {
 		ch.windowMu.Unlock()
 		// TODO(hanwen): should send Disconnect with reason?
-		return errors.New("ssh: remote side wrote too much")
+		return malformed(packet[0], errors.New("ssh: remote side wrote too much"))
 	}
 	ch.myWindow -= length
+	streams := ch.streams
 	ch.windowMu.Unlock()
+	ch.bytesReceived.Add(uint64(length))
 
-	if extended == 1 {
+	if extended == 0 {
+		ch.recordData(SessionInput, data)
+	}
+	if streams != nil && extended <= 1 {
+		streams.write(extended == 1, data)
+	} else if extended == 1 {
 		ch.extPending.write(data)
 	} else if extended > 0 {
 		// discard other extended data.
@@ -334,14 +409,28 @@ func (ch *channel) handleData(packet []byte) error {
 	return nil
 }
 
+// adjustWindow records that adj bytes of received data were consumed, and
+// enlarges the window of the peer accordingly. With receive rate limits,
+// the window is only enlarged once the data is within the limits, which
+// throttles the peer.
 func (c *channel) adjustWindow(adj uint32) error {
+	if len(c.receiveLimits) > 0 {
+		if d := c.receiveLimits.reserve(int(adj)); d > 0 {
+			time.AfterFunc(d, func() { c.sendWindowAdjust(adj) })
+			return nil
+		}
+	}
+	return c.sendWindowAdjust(adj)
+}
+
+func (c *channel) sendWindowAdjust(adj uint32) error {
 	c.windowMu.Lock()
 	// Since myConsumed and myWindow are managed on our side, and can never
 	// exceed the initial window setting, we don't worry about overflow.
 	c.myConsumed += adj
 	var sendAdj uint32
-	if (channelWindowSize-c.myWindow > 3*c.maxIncomingPayload) ||
-		(c.myWindow < channelWindowSize/2) {
+	if (c.windowSize-c.myWindow > 3*c.maxIncomingPayload) ||
+		(c.myWindow < c.windowSize/2) {
 		sendAdj = c.myConsumed
 		c.myConsumed = 0
 		c.myWindow += sendAdj
@@ -379,16 +468,43 @@ func (c *channel) ReadExtended(data []byte, extended uint32) (n int, err error)
 	return n, err
 }
 
+// streamOutput makes the data and the extended data of type 1 received
+// from now on available in order from the returned buffer.
+func (c *channel) streamOutput() *streamBuffer {
+	c.windowMu.Lock()
+	defer c.windowMu.Unlock()
+	if c.streams == nil {
+		c.streams = newStreamBuffer()
+	}
+	return c.streams
+}
+
+func (c *channel) streamsEOF() {
+	c.windowMu.Lock()
+	streams := c.streams
+	c.windowMu.Unlock()
+	if streams != nil {
+		streams.eof()
+	}
+}
+
 func (c *channel) close() {
+	c.channelClosed()
 	c.pending.eof()
 	c.extPending.eof()
+	c.streamsEOF()
 	close(c.msg)
 	close(c.incomingRequests)
+	c.sentRequests.close()
 	c.writeMu.Lock()
 	// This is not necessary for a normal channel teardown, but if
 	// there was another error, it is.
 	c.sentClose = true
 	c.writeMu.Unlock()
+	if c.done != nil {
+		close(c.done)
+	}
+	c.stopRecording()
 	// Unblock writers.
 	c.remoteWin.close()
 }
@@ -421,24 +537,25 @@ func (ch *channel) handlePacket(packet []byte) error {
 		// it is logical to signal EOF at the same time.
 		ch.extPending.eof()
 		ch.pending.eof()
+		ch.streamsEOF()
 		return nil
 	}
 
 	decoded, err := decode(packet)
 	if err != nil {
-		return err
+		return malformed(packet[0], err)
 	}
 
 	switch msg := decoded.(type) {
 	case *channelOpenFailureMsg:
 		if err := ch.responseMessageReceived(); err != nil {
-			return err
+			return malformed(packet[0], err)
 		}
 		ch.mux.chanList.remove(msg.PeersID)
 		ch.msg <- msg
 	case *channelOpenConfirmMsg:
 		if err := ch.responseMessageReceived(); err != nil {
-			return err
+			return malformed(packet[0], err)
 		}
 		if msg.MaxPacketSize < minPacketLength || msg.MaxPacketSize > 1<<31 {
 			return fmt.Errorf("ssh: invalid MaxPacketSize %d from peer", msg.MaxPacketSize)
@@ -449,7 +566,7 @@ func (ch *channel) handlePacket(packet []byte) error {
 		ch.msg <- msg
 	case *windowAdjustMsg:
 		if !ch.remoteWin.add(msg.AdditionalBytes) {
-			return fmt.Errorf("ssh: invalid window update for %d bytes", msg.AdditionalBytes)
+			return malformed(packet[0], fmt.Errorf("ssh: invalid window update for %d bytes", msg.AdditionalBytes))
 		}
 	case *channelRequestMsg:
 		req := Request{
@@ -459,17 +576,32 @@ func (ch *channel) handlePacket(packet []byte) error {
 			ch:        ch,
 		}
 
+		ch.recordRequest(&req)
 		ch.incomingRequests <- &req
+	case *channelRequestSuccessMsg:
+		ch.sentRequests.complete(true, nil)
+	case *channelRequestFailureMsg:
+		ch.sentRequests.complete(false, nil)
 	default:
-		ch.msg <- msg
+		// ch.msg is only read for the response to the opening of an
+		// outbound channel, so the peer sending more unexpected messages
+		// must not block the connection.
+		select {
+		case ch.msg <- msg:
+		default:
+			return malformed(packet[0], fmt.Errorf("ssh: unexpected message %T on channel", msg))
+		}
 	}
 	return nil
 }
 
 func (m *mux) newChannel(chanType string, direction channelDirection, extraData []byte) *channel {
+	windowSize, maxPacket := m.config.channelFlowControl(chanType)
 	ch := &channel{
 		remoteWin:        window{Cond: newCond()},
-		myWindow:         channelWindowSize,
+		windowSize:       windowSize,
+		maxPacket:        maxPacket,
+		myWindow:         windowSize,
 		pending:          newBuffer(),
 		extPending:       newBuffer(),
 		direction:        direction,
@@ -479,7 +611,13 @@ func (m *mux) newChannel(chanType string, direction channelDirection, extraData
 		extraData:        extraData,
 		mux:              m,
 		packetPool:       make(map[uint32][]byte),
+		created:          time.Now(),
+	}
+	if m.config != nil && m.config.ChannelWindowBlocked != nil {
+		blocked := m.config.ChannelWindowBlocked
+		ch.remoteWin.blocked = func(d time.Duration) { blocked(chanType, d) }
 	}
+	m.setupRateLimits(ch)
 	ch.localId = m.chanList.add(ch)
 	return ch
 }
@@ -504,7 +642,11 @@ func (ch *channel) Accept() (Channel, <-chan *Request, error) {
 	if ch.decided {
 		return nil, nil, errDecidedAlready
 	}
-	ch.maxIncomingPayload = channelMaxPacket
+	if err := ch.startRecording(); err != nil {
+		ch.Reject(ResourceShortage, "session recording failed")
+		return nil, nil, err
+	}
+	ch.maxIncomingPayload = ch.maxPacket
 	confirm := channelOpenConfirmMsg{
 		PeersID:       ch.remoteId,
 		MyID:          ch.localId,
@@ -515,6 +657,7 @@ func (ch *channel) Accept() (Channel, <-chan *Request, error) {
 	if err := ch.sendMessage(confirm); err != nil {
 		return nil, nil, err
 	}
+	ch.channelOpened()
 
 	return ch, ch.incomingRequests, nil
 }
@@ -583,38 +726,36 @@ func (ch *channel) SendRequest(name string, wantReply bool, payload []byte) (boo
 		return false, errUndecided
 	}
 
-	if wantReply {
-		ch.sentRequestMu.Lock()
-		defer ch.sentRequestMu.Unlock()
-	}
-
-	msg := channelRequestMsg{
-		PeersID:             ch.remoteId,
-		Request:             name,
-		WantReply:           wantReply,
-		RequestSpecificData: payload,
+	if !wantReply {
+		return false, ch.sendMessage(channelRequestMsg{
+			PeersID:             ch.remoteId,
+			Request:             name,
+			RequestSpecificData: payload,
+		})
 	}
 
-	if err := ch.sendMessage(msg); err != nil {
+	r, err := ch.SendRequestAsync(name, payload)
+	if err != nil {
 		return false, err
 	}
+	ok, _, err := r.Wait()
+	return ok, err
+}
 
-	if wantReply {
-		m, ok := (<-ch.msg)
-		if !ok {
-			return false, io.EOF
-		}
-		switch m.(type) {
-		case *channelRequestFailureMsg:
-			return false, nil
-		case *channelRequestSuccessMsg:
-			return true, nil
-		default:
-			return false, fmt.Errorf("ssh: unexpected response to channel request: %#v", m)
-		}
-	}
-
-	return false, nil
+// SendRequestAsync sends a channel request with want reply set, and
+// returns its pending reply. See AsyncRequestSender.
+func (ch *channel) SendRequestAsync(name string, payload []byte) (*RequestReply, error) {
+	if !ch.decided {
+		return nil, errUndecided
+	}
+	return ch.sentRequests.send(func() error {
+		return ch.sendMessage(channelRequestMsg{
+			PeersID:             ch.remoteId,
+			Request:             name,
+			WantReply:           true,
+			RequestSpecificData: payload,
+		})
+	})
 }
 
 // ackRequest either sends an ack or nack to the channel request.
@@ -6,6 +6,7 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -69,28 +70,55 @@ func NewClient(c Conn, chans <-chan NewChannel, reqs <-chan *Request) *Client {
 // as the underlying transport.  The Request and NewChannel channels
 // must be serviced or the connection will hang.
 func NewClientConn(c net.Conn, addr string, config *ClientConfig) (Conn, <-chan NewChannel, <-chan *Request, error) {
+	return NewClientConnContext(context.Background(), c, addr, config)
+}
+
+// NewClientConnContext is like NewClientConn, but aborts the key exchange
+// and the authentication if ctx is done before they complete, in which case
+// c is closed and the error wraps ctx.Err(). ctx is passed to the callbacks
+// of the AuthMethods made by PasswordCallbackContext,
+// PublicKeysCallbackContext and KeyboardInteractiveContext. Once the
+// connection is established, ctx does not affect it anymore.
+func NewClientConnContext(ctx context.Context, c net.Conn, addr string, config *ClientConfig) (Conn, <-chan NewChannel, <-chan *Request, error) {
 	fullConf := *config
 	fullConf.SetDefaults()
 	if fullConf.HostKeyCallback == nil {
 		c.Close()
 		return nil, nil, nil, errors.New("ssh: must specify HostKeyCallback")
 	}
+	policy, err := fullConf.policyAlgorithms()
+	if err != nil {
+		c.Close()
+		return nil, nil, nil, err
+	}
+	if policy != nil {
+		fullConf.HostKeyAlgorithms = applyPolicy(fullConf.HostKeyAlgorithms, policy.HostKeys)
+	}
 
 	conn := &connection{
 		sshConn: sshConn{conn: c, user: fullConf.User},
 	}
 
-	if err := conn.clientHandshake(addr, &fullConf); err != nil {
+	stop := watchContext(ctx, c)
+	err = conn.clientHandshake(ctx, addr, &fullConf)
+	if ctxErr := stop(); ctxErr != nil {
+		err = ctxErr
+	}
+	if err != nil {
 		c.Close()
 		return nil, nil, nil, fmt.Errorf("ssh: handshake failed: %w", err)
 	}
 	conn.mux = newMux(conn.transport)
-	return conn, conn.mux.incomingChannels, conn.mux.incomingRequests, nil
+	reqs := (<-chan *Request)(conn.mux.incomingRequests)
+	if fullConf.HostKeysCallback != nil {
+		reqs = conn.handleHostKeys(reqs, addr, fullConf.HostKeysCallback)
+	}
+	return conn, conn.mux.incomingChannels, reqs, nil
 }
 
 // clientHandshake performs the client side key exchange. See RFC 4253 Section
 // 7.
-func (c *connection) clientHandshake(dialAddress string, config *ClientConfig) error {
+func (c *connection) clientHandshake(ctx context.Context, dialAddress string, config *ClientConfig) error {
 	if config.ClientVersion != "" {
 		c.clientVersion = []byte(config.ClientVersion)
 	} else {
@@ -110,7 +138,7 @@ func (c *connection) clientHandshake(dialAddress string, config *ClientConfig) e
 	}
 
 	c.sessionID = c.transport.getSessionID()
-	return c.clientAuthenticate(config)
+	return c.clientAuthenticate(ctx, config)
 }
 
 // verifyHostKeySignature verifies the host key obtained in the key exchange.
@@ -185,6 +213,23 @@ func Dial(network, addr string, config *ClientConfig) (*Client, error) {
 	return NewClient(c, chans, reqs), nil
 }
 
+// DialContext is like Dial, but uses ctx to connect to the server and for
+// the handshake, as NewClientConnContext does. config.Timeout also applies
+// to the TCP connection. Once the Client is returned, ctx does not affect it
+// anymore.
+func DialContext(ctx context.Context, network, addr string, config *ClientConfig) (*Client, error) {
+	d := net.Dialer{Timeout: config.Timeout}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := NewClientConnContext(ctx, conn, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c, chans, reqs), nil
+}
+
 // HostKeyCallback is the function type used for verifying server
 // keys.  A HostKeyCallback must return nil if the host key is OK, or
 // an error to reject it. It receives the hostname as passed to Dial
@@ -196,6 +241,29 @@ type HostKeyCallback func(hostname string, remote net.Addr, key PublicKey) error
 // the server. A BannerCallback receives the message sent by the remote server.
 type BannerCallback func(message string) error
 
+// An AuthBanner is a banner sent by the server during user authentication,
+// with the state of the authentication when it was received.
+type AuthBanner struct {
+	// Message is the text of the banner, which may span several lines.
+	Message string
+	// Language is the language tag of the message, as in RFC 3066. It is
+	// generally empty.
+	Language string
+	// User is the user being authenticated.
+	User string
+	// Method is the authentication method in progress, such as
+	// "publickey", or "none" for the initial query of the methods.
+	Method string
+	// Attempt is the number of authentication attempts started so far,
+	// including the current one and the initial "none" query.
+	Attempt int
+}
+
+// AuthBannerCallback is the function type used by the client to handle the
+// banners sent by the server during user authentication. See
+// ClientConfig.AuthBannerCallback.
+type AuthBannerCallback func(banner AuthBanner) error
+
 // A ClientConfig structure is used to configure a Client. It must not be
 // modified after having been passed to an SSH function.
 type ClientConfig struct {
@@ -224,6 +292,22 @@ type ClientConfig struct {
 	// simplistic display on Stderr.
 	BannerCallback BannerCallback
 
+	// AuthBannerCallback, if not nil, is called instead of BannerCallback
+	// with each banner sent by the server and the state of the
+	// authentication, so that banners can for instance be attributed to a
+	// method, or only displayed for some of them. If it returns an error,
+	// the authentication is aborted.
+	AuthBannerCallback AuthBannerCallback
+
+	// HostKeysCallback, if not nil, is called with the host keys a server
+	// announces with the "hostkeys-00@openssh.com" extension of OpenSSH,
+	// once the server proved that it holds their private keys. The keys
+	// may include ones already known. It can be used to update a
+	// known_hosts file, for instance to learn the new keys of a host key
+	// rotation, with knownhosts.HostKeysUpdater. The callback runs on its
+	// own goroutine.
+	HostKeysCallback HostKeysCallback
+
 	// ClientVersion contains the version identification string that will
 	// be used for the connection. If empty, a reasonable default is used.
 	ClientVersion string
@@ -235,6 +319,13 @@ type ClientConfig struct {
 	// any of the CertAlgo and KeyAlgo constants.
 	HostKeyAlgorithms []string
 
+	// GSSAPIKeyExchange, if non-nil, enables the GSS-API key exchange
+	// methods of RFC 4462 section 2 for the Kerberos V5 mechanism, which
+	// are then preferred to the methods of KeyExchanges. The server
+	// authenticates with a GSS-API MIC rather than a host key signature,
+	// but HostKeyCallback is still called with its host key.
+	GSSAPIKeyExchange *GSSAPIKeyExchangeConfig
+
 	// Timeout is the maximum amount of time for the TCP connection to establish.
 	//
 	// A Timeout of zero means no timeout.
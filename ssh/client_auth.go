@@ -6,6 +6,7 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -21,7 +22,8 @@ const (
 )
 
 // clientAuthenticate authenticates with the remote server. See RFC 4252.
-func (c *connection) clientAuthenticate(config *ClientConfig) error {
+// ctx is passed to the callbacks of the AuthMethods.
+func (c *connection) clientAuthenticate(ctx context.Context, config *ClientConfig) error {
 	// initiate user auth session
 	if err := c.transport.writePacket(Marshal(&serviceRequestMsg{serviceUserAuth})); err != nil {
 		return err
@@ -52,6 +54,7 @@ func (c *connection) clientAuthenticate(config *ClientConfig) error {
 			extensions[string(name)] = value
 			payload = rest
 		}
+		c.pingSupported = string(extensions["ping@openssh.com"]) == "0"
 		packet, err = c.transport.readPacket()
 		if err != nil {
 			return err
@@ -68,11 +71,14 @@ func (c *connection) clientAuthenticate(config *ClientConfig) error {
 	var lastMethods []string
 
 	sessionID := c.transport.getSessionID()
+	c.transport.authBanner.User = config.User
 	for auth := AuthMethod(new(noneAuth)); auth != nil; {
-		ok, methods, err := auth.auth(sessionID, config.User, c.transport, config.Rand, extensions)
+		c.transport.authBanner.Method = auth.method()
+		c.transport.authBanner.Attempt++
+		ok, methods, err := auth.auth(ctx, sessionID, config.User, c.transport, config.Rand, extensions)
 		if err != nil {
 			// On disconnect, return error immediately
-			if _, ok := err.(*disconnectMsg); ok {
+			if _, ok := err.(*DisconnectError); ok {
 				return err
 			}
 			// We return the error later if there is no other method left to
@@ -128,12 +134,12 @@ func contains(list []string, e string) bool {
 
 // An AuthMethod represents an instance of an RFC 4252 authentication method.
 type AuthMethod interface {
-	// auth authenticates user over transport t.
-	// Returns true if authentication is successful.
+	// auth authenticates user over transport t, passing ctx to the
+	// callbacks of the method. Returns true if authentication is successful.
 	// If authentication is not successful, a []string of alternative
 	// method names is returned. If the slice is nil, it will be ignored
 	// and the previous set of possible methods will be reused.
-	auth(session []byte, user string, p packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error)
+	auth(ctx context.Context, session []byte, user string, p packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error)
 
 	// method returns the RFC 4252 method name.
 	method() string
@@ -142,7 +148,7 @@ type AuthMethod interface {
 // "none" authentication, RFC 4252 section 5.2.
 type noneAuth int
 
-func (n *noneAuth) auth(session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
+func (n *noneAuth) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
 	if err := c.writePacket(Marshal(&userAuthRequestMsg{
 		User:    user,
 		Service: serviceSSH,
@@ -160,9 +166,9 @@ func (n *noneAuth) method() string {
 
 // passwordCallback is an AuthMethod that fetches the password through
 // a function call, e.g. by prompting the user.
-type passwordCallback func() (password string, err error)
+type passwordCallback func(ctx context.Context) (password string, err error)
 
-func (cb passwordCallback) auth(session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
+func (cb passwordCallback) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
 	type passwordAuthMsg struct {
 		User     string `sshtype:"50"`
 		Service  string
@@ -171,7 +177,7 @@ func (cb passwordCallback) auth(session []byte, user string, c packetConn, rand
 		Password string
 	}
 
-	pw, err := cb()
+	pw, err := cb(ctx)
 	// REVIEW NOTE: is there a need to support skipping a password attempt?
 	// The program may only find out that the user doesn't have a password
 	// when prompting.
@@ -198,12 +204,18 @@ func (cb passwordCallback) method() string {
 
 // Password returns an AuthMethod using the given password.
 func Password(secret string) AuthMethod {
-	return passwordCallback(func() (string, error) { return secret, nil })
+	return passwordCallback(func(context.Context) (string, error) { return secret, nil })
 }
 
 // PasswordCallback returns an AuthMethod that uses a callback for
 // fetching a password.
 func PasswordCallback(prompt func() (secret string, err error)) AuthMethod {
+	return passwordCallback(func(context.Context) (string, error) { return prompt() })
+}
+
+// PasswordCallbackContext is like PasswordCallback, but passes to prompt
+// the Context given to NewClientConnContext or DialContext.
+func PasswordCallbackContext(prompt func(ctx context.Context) (secret string, err error)) AuthMethod {
 	return passwordCallback(prompt)
 }
 
@@ -217,13 +229,24 @@ type publickeyAuthMsg struct {
 	Algoname string
 	PubKey   []byte
 	// Sig is tagged with "rest" so Marshal will exclude it during
-	// validateKey
+	// validateKey. In publicKeyHostboundMethod requests, it starts with the
+	// host key of the server.
 	Sig []byte `ssh:"rest"`
 }
 
+const (
+	// publicKeyHostboundMethod is the variant of the publickey method
+	// whose requests and signatures include the host key of the server, so
+	// that they cannot be forwarded to another server. See [PROTOCOL].
+	publicKeyHostboundMethod = "publickey-hostbound-v00@openssh.com"
+	// publicKeyHostboundExtension is the SSH_MSG_EXT_INFO extension with
+	// which servers announce that they accept publicKeyHostboundMethod.
+	publicKeyHostboundExtension = "publickey-hostbound@openssh.com"
+)
+
 // publicKeyCallback is an AuthMethod that uses a set of key
 // pairs for authentication.
-type publicKeyCallback func() ([]Signer, error)
+type publicKeyCallback func(ctx context.Context) ([]Signer, error)
 
 func (cb publicKeyCallback) method() string {
 	return "publickey"
@@ -299,19 +322,26 @@ func pickSignatureAlgorithm(signer Signer, extensions map[string][]byte) (MultiA
 	return as, algo, nil
 }
 
-func (cb publicKeyCallback) auth(session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error) {
+func (cb publicKeyCallback) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error) {
 	// Authentication is performed by sending an enquiry to test if a key is
 	// acceptable to the remote. If the key is acceptable, the client will
 	// attempt to authenticate with the valid key.  If not the client will repeat
 	// the process with the remaining keys.
 
-	signers, err := cb()
+	signers, err := cb(ctx)
 	if err != nil {
 		return authFailure, nil, err
 	}
 	var methods []string
 	var errSigAlgo error
 
+	// Bind the requests to the host key of the server if it accepts it.
+	method := cb.method()
+	var hostKey []byte
+	if t, ok := c.(*handshakeTransport); ok && len(t.serverHostKey) > 0 && string(extensions[publicKeyHostboundExtension]) == "0" {
+		method, hostKey = publicKeyHostboundMethod, t.serverHostKey
+	}
+
 	origSignersLen := len(signers)
 	for idx := 0; idx < len(signers); idx++ {
 		signer := signers[idx]
@@ -324,7 +354,7 @@ func (cb publicKeyCallback) auth(session []byte, user string, c packetConn, rand
 			errSigAlgo = err
 			continue
 		}
-		ok, err := validateKey(pub, algo, user, c)
+		ok, err := validateKey(pub, algo, user, method, hostKey, c)
 		if err != nil {
 			return authFailure, nil, err
 		}
@@ -348,24 +378,28 @@ func (cb publicKeyCallback) auth(session []byte, user string, c packetConn, rand
 		}
 
 		pubKey := pub.Marshal()
-		data := buildDataSignedForAuth(session, userAuthRequestMsg{
+		req := userAuthRequestMsg{
 			User:    user,
 			Service: serviceSSH,
-			Method:  cb.method(),
-		}, algo, pubKey)
+			Method:  method,
+		}
+		data := buildDataSignedForAuth(session, req, algo, pubKey)
+		if hostKey != nil {
+			data = buildDataSignedForHostboundAuth(session, req, algo, pubKey, hostKey)
+		}
 		sign, err := as.SignWithAlgorithm(rand, data, underlyingAlgo(algo))
 		if err != nil {
 			return authFailure, nil, err
 		}
 
-		// manually wrap the serialized signature in a string
-		s := Marshal(sign)
-		sig := make([]byte, stringLength(len(s)))
-		marshalString(sig, s)
+		// manually wrap the serialized signature in a string, after the
+		// host key of hostbound requests
+		sig := hostboundRest(hostKey)
+		sig = appendString(sig, string(Marshal(sign)))
 		msg := publickeyAuthMsg{
 			User:     user,
 			Service:  serviceSSH,
-			Method:   cb.method(),
+			Method:   method,
 			HasSig:   true,
 			Algoname: algo,
 			PubKey:   pubKey,
@@ -393,16 +427,28 @@ func (cb publicKeyCallback) auth(session []byte, user string, c packetConn, rand
 	return authFailure, methods, errSigAlgo
 }
 
-// validateKey validates the key provided is acceptable to the server.
-func validateKey(key PublicKey, algo string, user string, c packetConn) (bool, error) {
+// hostboundRest returns the host key field of hostbound requests, which
+// precedes the signature, or nil if hostKey is nil.
+func hostboundRest(hostKey []byte) []byte {
+	if hostKey == nil {
+		return nil
+	}
+	return appendString(nil, string(hostKey))
+}
+
+// validateKey validates the key provided is acceptable to the server. method
+// is "publickey", or publicKeyHostboundMethod with the host key of the
+// server.
+func validateKey(key PublicKey, algo string, user string, method string, hostKey []byte, c packetConn) (bool, error) {
 	pubKey := key.Marshal()
 	msg := publickeyAuthMsg{
 		User:     user,
 		Service:  serviceSSH,
-		Method:   "publickey",
+		Method:   method,
 		HasSig:   false,
 		Algoname: algo,
 		PubKey:   pubKey,
+		Sig:      hostboundRest(hostKey),
 	}
 	if err := c.writePacket(Marshal(&msg)); err != nil {
 		return false, err
@@ -452,12 +498,18 @@ func confirmKeyAck(key PublicKey, c packetConn) (bool, error) {
 // PublicKeys returns an AuthMethod that uses the given key
 // pairs.
 func PublicKeys(signers ...Signer) AuthMethod {
-	return publicKeyCallback(func() ([]Signer, error) { return signers, nil })
+	return publicKeyCallback(func(context.Context) ([]Signer, error) { return signers, nil })
 }
 
 // PublicKeysCallback returns an AuthMethod that runs the given
 // function to obtain a list of key pairs.
 func PublicKeysCallback(getSigners func() (signers []Signer, err error)) AuthMethod {
+	return publicKeyCallback(func(context.Context) ([]Signer, error) { return getSigners() })
+}
+
+// PublicKeysCallbackContext is like PublicKeysCallback, but passes to
+// getSigners the Context given to NewClientConnContext or DialContext.
+func PublicKeysCallbackContext(getSigners func(ctx context.Context) (signers []Signer, err error)) AuthMethod {
 	return publicKeyCallback(getSigners)
 }
 
@@ -511,6 +563,11 @@ func handleBannerResponse(c packetConn, packet []byte) error {
 		return nil
 	}
 
+	if transport.authBannerCallback != nil {
+		banner := transport.authBanner
+		banner.Message, banner.Language = msg.Message, msg.Language
+		return transport.authBannerCallback(banner)
+	}
 	if transport.bannerCallback != nil {
 		return transport.bannerCallback(msg.Message)
 	}
@@ -537,7 +594,28 @@ func (cb KeyboardInteractiveChallenge) method() string {
 	return "keyboard-interactive"
 }
 
-func (cb KeyboardInteractiveChallenge) auth(session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
+func (cb KeyboardInteractiveChallenge) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error) {
+	challenge := func(_ context.Context, name, instruction string, questions []string, echos []bool) ([]string, error) {
+		return cb(name, instruction, questions, echos)
+	}
+	return keyboardInteractiveContext(challenge).auth(ctx, session, user, c, rand, extensions)
+}
+
+// KeyboardInteractiveContext is like KeyboardInteractive, but passes to
+// challenge the Context given to NewClientConnContext or DialContext.
+func KeyboardInteractiveContext(challenge func(ctx context.Context, name, instruction string, questions []string, echos []bool) (answers []string, err error)) AuthMethod {
+	return keyboardInteractiveContext(challenge)
+}
+
+// keyboardInteractiveContext is the AuthMethod of KeyboardInteractive and
+// KeyboardInteractiveContext.
+type keyboardInteractiveContext func(ctx context.Context, name, instruction string, questions []string, echos []bool) (answers []string, err error)
+
+func (cb keyboardInteractiveContext) method() string {
+	return "keyboard-interactive"
+}
+
+func (cb keyboardInteractiveContext) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
 	type initiateMsg struct {
 		User       string `sshtype:"50"`
 		Service    string
@@ -620,7 +698,7 @@ func (cb KeyboardInteractiveChallenge) auth(session []byte, user string, c packe
 			return authFailure, nil, errors.New("ssh: extra data following keyboard-interactive pairs")
 		}
 
-		answers, err := cb(msg.Name, msg.Instruction, prompts, echos)
+		answers, err := cb(ctx, msg.Name, msg.Instruction, prompts, echos)
 		if err != nil {
 			return authFailure, nil, err
 		}
@@ -652,9 +730,9 @@ type retryableAuthMethod struct {
 	maxTries   int
 }
 
-func (r *retryableAuthMethod) auth(session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (ok authResult, methods []string, err error) {
+func (r *retryableAuthMethod) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (ok authResult, methods []string, err error) {
 	for i := 0; r.maxTries <= 0 || i < r.maxTries; i++ {
-		ok, methods, err = r.authMethod.auth(session, user, c, rand, extensions)
+		ok, methods, err = r.authMethod.auth(ctx, session, user, c, rand, extensions)
 		if ok != authFailure || err != nil { // either success, partial success or error terminate
 			return ok, methods, err
 		}
@@ -681,6 +759,88 @@ func RetryableAuthMethod(auth AuthMethod, maxTries int) AuthMethod {
 	return &retryableAuthMethod{authMethod: auth, maxTries: maxTries}
 }
 
+// hostbasedAuthMsg is the SSH_MSG_USERAUTH_REQUEST message of the hostbased
+// method. See RFC 4252, section 9.
+type hostbasedAuthMsg struct {
+	User       string `sshtype:"50"`
+	Service    string
+	Method     string
+	Algoname   string
+	PubKey     []byte
+	ClientHost string
+	ClientUser string
+	Sig        []byte
+}
+
+// hostbasedAuth is an AuthMethod that authenticates with a host key of the
+// client host.
+type hostbasedAuth struct {
+	clientHost string
+	clientUser string
+	signers    []Signer
+}
+
+func (h *hostbasedAuth) method() string {
+	return "hostbased"
+}
+
+func (h *hostbasedAuth) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error) {
+	var methods []string
+	var errSigAlgo error
+	for _, signer := range h.signers {
+		as, algo, err := pickSignatureAlgorithm(signer, extensions)
+		if err != nil {
+			if errSigAlgo == nil {
+				errSigAlgo = err
+			}
+			continue
+		}
+
+		pubKey := signer.PublicKey().Marshal()
+		data := buildDataSignedForHostbased(session, userAuthRequestMsg{
+			User:    user,
+			Service: serviceSSH,
+			Method:  h.method(),
+		}, algo, pubKey, h.clientHost, h.clientUser)
+		sign, err := as.SignWithAlgorithm(rand, data, underlyingAlgo(algo))
+		if err != nil {
+			return authFailure, nil, err
+		}
+
+		msg := hostbasedAuthMsg{
+			User:       user,
+			Service:    serviceSSH,
+			Method:     h.method(),
+			Algoname:   algo,
+			PubKey:     pubKey,
+			ClientHost: h.clientHost,
+			ClientUser: h.clientUser,
+			Sig:        Marshal(sign),
+		}
+		if err := c.writePacket(Marshal(&msg)); err != nil {
+			return authFailure, nil, err
+		}
+		var success authResult
+		success, methods, err = handleAuthResponse(c)
+		if err != nil {
+			return authFailure, nil, err
+		}
+		if success == authSuccess || !contains(methods, h.method()) {
+			return success, methods, err
+		}
+	}
+	return authFailure, methods, errSigAlgo
+}
+
+// HostbasedAuth returns an AuthMethod for "hostbased" authentication (RFC
+// 4252 section 9), which logs in on behalf of the user clientUser of the
+// client host clientHost by signing with one of the host keys of the client.
+// clientHost should be the fully qualified domain name of the client host.
+// The host keys are tried in order.
+func HostbasedAuth(clientHost, clientUser string, hostKeys ...Signer) AuthMethod {
+	return &hostbasedAuth{clientHost: clientHost, clientUser: clientUser, signers: hostKeys}
+}
+
 // GSSAPIWithMICAuthMethod is an AuthMethod with "gssapi-with-mic" authentication.
 // See RFC 4462 section 3
 // gssAPIClient is implementation of the GSSAPIClient interface, see the definition of the interface for details.
@@ -697,7 +857,7 @@ type gssAPIWithMICCallback struct {
 	target       string
 }
 
-func (g *gssAPIWithMICCallback) auth(session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
+func (g *gssAPIWithMICCallback) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, _ map[string][]byte) (authResult, []string, error) {
 	m := &userAuthRequestMsg{
 		User:    user,
 		Service: serviceSSH,
@@ -6,6 +6,7 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -47,6 +49,12 @@ func tryAuthWithGSSAPIWithMICConfig(t *testing.T, clientConfig *ClientConfig, gs
 
 // tryAuthBothSides runs the handshake and returns the resulting errors from both sides of the connection.
 func tryAuthBothSides(t *testing.T, config *ClientConfig, gssAPIWithMICConfig *GSSAPIWithMICConfig) (clientError error, serverAuthErrors []error) {
+	return tryAuthBothSidesContext(t, context.Background(), config, gssAPIWithMICConfig)
+}
+
+// tryAuthBothSidesContext is like tryAuthBothSides, but runs the client side
+// of the handshake with NewClientConnContext and ctx.
+func tryAuthBothSidesContext(t *testing.T, ctx context.Context, config *ClientConfig, gssAPIWithMICConfig *GSSAPIWithMICConfig) (clientError error, serverAuthErrors []error) {
 	c1, c2, err := netPipe()
 	if err != nil {
 		t.Fatalf("netPipe: %v", err)
@@ -101,10 +109,51 @@ func tryAuthBothSides(t *testing.T, config *ClientConfig, gssAPIWithMICConfig *G
 	}
 
 	go newServer(c1, serverConfig)
-	_, _, _, err = NewClientConn(c2, "", config)
+	_, _, _, err = NewClientConnContext(ctx, c2, "", config)
 	return err, serverAuthErrors
 }
 
+func TestClientAuthContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	checkContext := func(ctx context.Context) error {
+		if v := ctx.Value(ctxKey{}); v != "value" {
+			return fmt.Errorf("callback got context value %v, want %q", v, "value")
+		}
+		return nil
+	}
+	answers := keyboardInteractive(map[string]string{
+		"question1": "answer1",
+		"question2": "answer2",
+	})
+
+	for name, auth := range map[string]AuthMethod{
+		"password": PasswordCallbackContext(func(ctx context.Context) (string, error) {
+			return clientPassword, checkContext(ctx)
+		}),
+		"publickey": PublicKeysCallbackContext(func(ctx context.Context) ([]Signer, error) {
+			return []Signer{testSigners["rsa"]}, checkContext(ctx)
+		}),
+		"keyboard-interactive": KeyboardInteractiveContext(func(ctx context.Context, name, instruction string, questions []string, echos []bool) ([]string, error) {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			return answers.Challenge(name, instruction, questions, echos)
+		}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := &ClientConfig{
+				User:            "testuser",
+				Auth:            []AuthMethod{auth},
+				HostKeyCallback: InsecureIgnoreHostKey(),
+			}
+			if err, _ := tryAuthBothSidesContext(t, ctx, config, nil); err != nil {
+				t.Fatalf("unable to dial remote side: %s", err)
+			}
+		})
+	}
+}
+
 type loggingAlgorithmSigner struct {
 	used []string
 	AlgorithmSigner
@@ -613,7 +662,7 @@ func TestClientAuthMaxAuthTries(t *testing.T) {
 	}
 	serverConfig.AddHostKey(testSigners["rsa"])
 
-	expectedErr := fmt.Errorf("ssh: handshake failed: %v", &disconnectMsg{
+	expectedErr := fmt.Errorf("ssh: handshake failed: %v", &DisconnectError{
 		Reason:  2,
 		Message: "too many authentication failures",
 	})
@@ -687,7 +736,7 @@ func TestClientAuthMaxAuthTriesPublicKey(t *testing.T) {
 		t.Fatalf("unable to dial remote side: %s", err)
 	}
 
-	expectedErr := fmt.Errorf("ssh: handshake failed: %v", &disconnectMsg{
+	expectedErr := fmt.Errorf("ssh: handshake failed: %v", &DisconnectError{
 		Reason:  2,
 		Message: "too many authentication failures",
 	})
@@ -1168,10 +1217,10 @@ func (cb configurablePublicKeyCallback) method() string {
 	return "publickey"
 }
 
-func (cb configurablePublicKeyCallback) auth(session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error) {
+func (cb configurablePublicKeyCallback) auth(ctx context.Context, session []byte, user string, c packetConn, rand io.Reader, extensions map[string][]byte) (authResult, []string, error) {
 	pub := cb.signer.PublicKey()
 
-	ok, err := validateKey(pub, cb.signatureAlgo, user, c)
+	ok, err := validateKey(pub, cb.signatureAlgo, user, "publickey", nil, c)
 	if err != nil {
 		return authFailure, nil, err
 	}
@@ -1382,3 +1431,213 @@ func TestKeyboardInteractiveAuthEarlyFail(t *testing.T) {
 		t.Errorf("expected PasswordCallback() to be called")
 	}
 }
+
+func TestClientAuthHostbased(t *testing.T) {
+	type hostbasedAttempt struct {
+		clientHost, clientUser string
+		key                    PublicKey
+	}
+	for _, tt := range []struct {
+		name       string
+		hostKeys   []Signer
+		clientHost string
+		wantErr    bool
+	}{
+		{"ecdsa", []Signer{testSigners["ecdsa"]}, "client.example.com", false},
+		{"rsa", []Signer{testSigners["rsa"]}, "client.example.com", false},
+		{"second key", []Signer{testSigners["ed25519"], testSigners["ecdsa"]}, "client.example.com", false},
+		{"unknown host", []Signer{testSigners["ecdsa"]}, "other.example.com", true},
+		{"unknown key", []Signer{testSigners["ed25519"]}, "client.example.com", true},
+	} {
+		c1, c2, err := netPipe()
+		if err != nil {
+			t.Fatalf("netPipe: %v", err)
+		}
+
+		var attempts []hostbasedAttempt
+		serverConfig := &ServerConfig{
+			HostbasedCallback: func(conn ConnMetadata, clientHost, clientUser string, key PublicKey) (*Permissions, error) {
+				attempts = append(attempts, hostbasedAttempt{clientHost, clientUser, key})
+				if clientHost != "client.example.com" || clientUser != "localuser" || conn.User() != "testuser" {
+					return nil, errors.New("host not trusted")
+				}
+				if k := key.Marshal(); !bytes.Equal(k, testPublicKeys["ecdsa"].Marshal()) && !bytes.Equal(k, testPublicKeys["rsa"].Marshal()) {
+					return nil, errors.New("unknown host key")
+				}
+				return &Permissions{Extensions: map[string]string{"client-host": clientHost}}, nil
+			},
+		}
+		serverConfig.AddHostKey(testSigners["rsa"])
+		permsCh := make(chan *Permissions, 1)
+		go func() {
+			conn, _, _, err := NewServerConn(c1, serverConfig)
+			if err != nil {
+				permsCh <- nil
+				return
+			}
+			permsCh <- conn.Permissions
+		}()
+
+		clientConfig := &ClientConfig{
+			User:            "testuser",
+			Auth:            []AuthMethod{HostbasedAuth(tt.clientHost, "localuser", tt.hostKeys...)},
+			HostKeyCallback: InsecureIgnoreHostKey(),
+		}
+		_, _, _, err = NewClientConn(c2, "", clientConfig)
+		c2.Close()
+		perms := <-permsCh
+		c1.Close()
+
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: hostbased authentication succeeded", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if perms == nil || perms.Extensions["client-host"] != "client.example.com" {
+			t.Errorf("%s: got permissions %v", tt.name, perms)
+		}
+		if len(attempts) != len(tt.hostKeys) {
+			t.Errorf("%s: HostbasedCallback called %d times, want %d", tt.name, len(attempts), len(tt.hostKeys))
+		}
+	}
+}
+
+func TestServerAuthHostbasedPermissions(t *testing.T) {
+	skSigner := newTestSKSigners(t, 0)[KeyAlgoSKED25519]
+	for _, tt := range []struct {
+		name    string
+		key     Signer
+		perms   *Permissions
+		wantErr bool
+	}{
+		{"source address", testSigners["ecdsa"], &Permissions{CriticalOptions: map[string]string{sourceAddressCriticalOption: "127.0.0.1/32,::1/128"}}, false},
+		{"other source address", testSigners["ecdsa"], &Permissions{CriticalOptions: map[string]string{sourceAddressCriticalOption: "192.0.2.0/24"}}, true},
+		{"security key without touch", skSigner, nil, true},
+		{"no-touch-required", skSigner, &Permissions{Extensions: map[string]string{noTouchRequiredExtension: ""}}, false},
+	} {
+		c1, c2, err := netPipe()
+		if err != nil {
+			t.Fatalf("netPipe: %v", err)
+		}
+		serverConfig := &ServerConfig{
+			HostbasedCallback: func(conn ConnMetadata, clientHost, clientUser string, key PublicKey) (*Permissions, error) {
+				return tt.perms, nil
+			},
+		}
+		serverConfig.AddHostKey(testSigners["rsa"])
+		go func() {
+			NewServerConn(c1, serverConfig)
+			c1.Close()
+		}()
+
+		clientConfig := &ClientConfig{
+			User:            "testuser",
+			Auth:            []AuthMethod{HostbasedAuth("client.example.com", "localuser", tt.key)},
+			HostKeyCallback: InsecureIgnoreHostKey(),
+		}
+		_, _, _, err = NewClientConn(c2, "", clientConfig)
+		c2.Close()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: hostbased authentication succeeded", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestServerAuthHostbasedBadSignature(t *testing.T) {
+	// A host key that signs with a different key than it claims.
+	signer := &wrongKeySigner{Signer: testSigners["ecdsap256"], pub: testPublicKeys["ecdsa"]}
+	called := false
+	serverConfig := &ServerConfig{
+		HostbasedCallback: func(conn ConnMetadata, clientHost, clientUser string, key PublicKey) (*Permissions, error) {
+			called = true
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(testSigners["rsa"])
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	go NewServerConn(c1, serverConfig)
+
+	clientConfig := &ClientConfig{
+		User:            "testuser",
+		Auth:            []AuthMethod{HostbasedAuth("client.example.com", "localuser", signer)},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+	if _, _, _, err := NewClientConn(c2, "", clientConfig); err == nil {
+		t.Error("hostbased authentication with a bad signature succeeded")
+	}
+	if called {
+		t.Error("HostbasedCallback called for a bad signature")
+	}
+}
+
+// wrongKeySigner signs with Signer but reports pub as its public key.
+type wrongKeySigner struct {
+	Signer
+	pub PublicKey
+}
+
+func (s *wrongKeySigner) PublicKey() PublicKey {
+	return s.pub
+}
+
+func TestPublicKeyHostbound(t *testing.T) {
+	var methods []string
+	var authErrs []error
+	serverConf := &ServerConfig{
+		PublicKeyCallback: func(conn ConnMetadata, key PublicKey) (*Permissions, error) {
+			if bytes.Equal(key.Marshal(), testPublicKeys["rsa"].Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+		AuthLogCallback: func(conn ConnMetadata, method string, err error) {
+			methods = append(methods, method)
+			authErrs = append(authErrs, err)
+		},
+	}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+	clientConf := &ClientConfig{
+		User:            "testuser",
+		Auth:            []AuthMethod{PublicKeys(testSigners["rsa"])},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+
+	conn, clientErr, serverErr := connectWithPolicies(t, clientConf, serverConf)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("client: %v, server: %v", clientErr, serverErr)
+	}
+	conn.Close()
+	if want := []string{"none", "publickey"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("got methods %q, want %q", methods, want)
+	}
+
+	// The client binds its requests to the host key it saw, which must be
+	// the one of the key exchange, even if the server has others.
+	methods, authErrs = nil, nil
+	serverConf.AddHostKey(testSigners["ed25519"])
+	clientConf.HostKeyAlgorithms = []string{testPublicKeys["ecdsa"].Type()}
+	serverConf.BannerCallback = func(conn ConnMetadata) string {
+		// Pretend the key exchange used the other host key.
+		conn.(*connection).transport.serverHostKey = testPublicKeys["ed25519"].Marshal()
+		return ""
+	}
+	if _, clientErr, _ = connectWithPolicies(t, clientConf, serverConf); clientErr == nil {
+		t.Fatal("client authenticated with a request bound to another host key")
+	}
+	if len(authErrs) != 2 || authErrs[1] == nil || !strings.Contains(authErrs[1].Error(), "another host key") {
+		t.Errorf("got authentication errors %v, want another host key", authErrs)
+	}
+}
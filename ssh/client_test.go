@@ -6,12 +6,14 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestClientVersion(t *testing.T) {
@@ -365,3 +367,58 @@ func TestUnsupportedAlgorithm(t *testing.T) {
 		})
 	}
 }
+
+func TestDialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The server accepts connections, but never sends its version.
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	config := &ClientConfig{HostKeyCallback: InsecureIgnoreHostKey()}
+	_, err = DialContext(ctx, "tcp", l.Addr().String(), config)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DialContext: got %v, want context.DeadlineExceeded", err)
+	}
+
+	// A context that is done after the handshake doesn't affect the
+	// connection.
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ecdsap256"])
+	go func() {
+		_, _, reqs, err := NewServerConn(c2, serverConf)
+		if err == nil {
+			for req := range reqs {
+				req.Reply(true, nil)
+			}
+		}
+	}()
+	ctx, cancel = context.WithCancel(context.Background())
+	client, _, _, err := NewClientConnContext(ctx, c1, "", config)
+	if err != nil {
+		t.Fatalf("NewClientConnContext: %v", err)
+	}
+	defer client.Close()
+	cancel()
+	if ok, _, err := client.SendRequest("ping", true, nil); err != nil || !ok {
+		t.Errorf("SendRequest after cancel: %v, %v", ok, err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"math"
 	"sync"
+	"time"
 
 	_ "crypto/sha1"
 	_ "crypto/sha256"
@@ -45,6 +46,7 @@ var preferredCiphers = []string{
 // preference order.
 var supportedKexAlgos = []string{
 	kexAlgoCurve25519SHA256, kexAlgoCurve25519SHA256LibSSH,
+	kexAlgoSNTRUP761x25519SHA512, kexAlgoSNTRUP761x25519SHA512OpenSSH,
 	// P384 and P521 are not constant-time yet, but since we don't
 	// reuse ephemeral keys, using them for ECDH should be OK.
 	kexAlgoECDH256, kexAlgoECDH384, kexAlgoECDH521,
@@ -62,8 +64,11 @@ var serverForbiddenKexAlgos = map[string]struct{}{
 // preferredKexAlgos specifies the default preference for key-exchange
 // algorithms in preference order. The diffie-hellman-group16-sha512 algorithm
 // is disabled by default because it is a bit slower than the others.
+// sntrup761x25519-sha512 is only checked against OpenSSH when the peer
+// generates the key, so it is not preferred to curve25519-sha256 yet.
 var preferredKexAlgos = []string{
 	kexAlgoCurve25519SHA256, kexAlgoCurve25519SHA256LibSSH,
+	kexAlgoSNTRUP761x25519SHA512, kexAlgoSNTRUP761x25519SHA512OpenSSH,
 	kexAlgoECDH256, kexAlgoECDH384, kexAlgoECDH521,
 	kexAlgoDH14SHA256, kexAlgoDH14SHA1,
 }
@@ -89,6 +94,7 @@ var supportedMACs = []string{
 	"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
 }
 
+// supportedCompressions is the default of Config.Compression.
 var supportedCompressions = []string{compressionNone}
 
 // hashFuncs keeps the mapping of supported signature algorithms to their
@@ -287,6 +293,79 @@ type Config struct {
 	// The allowed MAC algorithms. If unspecified then a sensible default is
 	// used. Unsupported values are silently ignored.
 	MACs []string
+
+	// The allowed compression algorithms, in order of preference: "none",
+	// "zlib" and "zlib@openssh.com", which only compresses the packets that
+	// follow the authentication of the user. If unspecified, the packets
+	// are not compressed. Unsupported values are silently ignored.
+	Compression []string
+
+	// Metrics, if non-nil, receives events of the connection, such as
+	// packets, key exchanges and channels, for instrumentation.
+	Metrics *ConnMetrics
+
+	// AlgorithmPolicy, if not empty, names a preset that restricts the
+	// algorithms that may be negotiated: one of PolicyStrict, PolicyCompat
+	// or PolicyFIPS. Unset algorithm lists, including the host key and
+	// public key authentication algorithms of ClientConfig and
+	// ServerConfig, default to those of the policy, and the algorithms of
+	// explicit lists that the policy doesn't allow are ignored. Connections
+	// fail if the policy is unknown.
+	AlgorithmPolicy string
+
+	// ChannelWindowSize is the initial and maximum flow control window of
+	// each channel: the amount of data the peer may send on the channel
+	// before it has to wait for the data to be read locally. Larger windows
+	// improve throughput on links with a high bandwidth-delay product, at
+	// the cost of buffering up to that much data per channel. If zero,
+	// 2 MiB is used. It is raised to ChannelMaxPacket if smaller.
+	ChannelWindowSize uint32
+
+	// ChannelMaxPacket is the maximum payload size of the data packets the
+	// peer may send on each channel. If zero, 32 KiB is used. It is capped
+	// at 128 KiB.
+	ChannelMaxPacket uint32
+
+	// ChannelFlowControl, if non-nil, is called for each channel opened
+	// locally or by the peer, with its type, before the window and maximum
+	// packet size are advertised to the peer. Non-zero return values
+	// replace ChannelWindowSize and ChannelMaxPacket for that channel.
+	ChannelFlowControl func(chanType string) (windowSize, maxPacket uint32)
+
+	// ChannelWindowBlocked, if non-nil, is called when a write to a
+	// channel had to wait for the peer to enlarge its flow control window,
+	// with the type of the channel and the time spent waiting. It is called
+	// from the writing goroutine, once it can proceed or the channel is
+	// closed.
+	ChannelWindowBlocked func(chanType string, waited time.Duration)
+
+	// ChannelRateLimit, if non-nil, is called for each channel opened
+	// locally or by the peer, with its type, and returns the rate limiters
+	// of the data sent and received on it, either of which may be nil.
+	// Writes wait for the send limiter. Received data is throttled by
+	// delaying the enlargement of the flow control window of the peer
+	// until it is within the receive limiter, so the peer may still send
+	// up to a window of data at once: a smaller window, see
+	// ChannelFlowControl, makes the limit smoother.
+	ChannelRateLimit func(chanType string) (send, receive *RateLimiter)
+
+	// ConnRateLimit, if non-nil, is called for each connection, and
+	// returns rate limiters like ChannelRateLimit, which apply to the data
+	// of all the channels of the connection, in addition to their own
+	// limiters.
+	ConnRateLimit func() (send, receive *RateLimiter)
+
+	// DropMalformedMessages makes the connection drop the connection
+	// protocol messages that are malformed or violate RFC 4254, such as
+	// truncated channel data, data and requests for unknown channels, data
+	// overflowing the flow control window or window adjustments overflowing
+	// it, instead of closing the connection. This is meant for servers
+	// exposed to scanners and misbehaving clients, so that other channels
+	// and requests of a connection keep working. Messages that can't be
+	// dropped without corrupting the state of the connection, and errors of
+	// the transport, still close it. Dropped messages are reported to
+	// Metrics.MessageDropped.
+	DropMalformedMessages bool
 }
 
 // SetDefaults sets sensible values for unset fields in config. This is
@@ -296,6 +375,12 @@ func (c *Config) SetDefaults() {
 	if c.Rand == nil {
 		c.Rand = rand.Reader
 	}
+	// An unknown policy is reported when the connection is set up.
+	if p, _ := c.policyAlgorithms(); p != nil {
+		c.Ciphers = applyPolicy(c.Ciphers, p.Ciphers)
+		c.KeyExchanges = applyPolicy(c.KeyExchanges, p.KeyExchanges)
+		c.MACs = applyPolicy(c.MACs, p.MACs)
+	}
 	if c.Ciphers == nil {
 		c.Ciphers = preferredCiphers
 	}
@@ -332,6 +417,17 @@ func (c *Config) SetDefaults() {
 	}
 	c.MACs = macs
 
+	if c.Compression == nil {
+		c.Compression = supportedCompressions
+	}
+	var compressions []string
+	for _, algo := range c.Compression {
+		if compressionAlgos[algo] {
+			compressions = append(compressions, algo)
+		}
+	}
+	c.Compression = compressions
+
 	if c.RekeyThreshold == 0 {
 		// cipher specific default
 	} else if c.RekeyThreshold < minRekeyThreshold {
@@ -368,6 +464,42 @@ func buildDataSignedForAuth(sessionID []byte, req userAuthRequestMsg, algo strin
 	return Marshal(data)
 }
 
+// buildDataSignedForHostboundAuth returns the data that is signed in
+// publickey-hostbound-v00@openssh.com requests, which is the data of
+// buildDataSignedForAuth followed by the host key of the server. See
+// [PROTOCOL].
+func buildDataSignedForHostboundAuth(sessionID []byte, req userAuthRequestMsg, algo string, pubKey, hostKey []byte) []byte {
+	data := buildDataSignedForAuth(sessionID, req, algo, pubKey)
+	return appendString(data, string(hostKey))
+}
+
+// buildDataSignedForHostbased returns the data that the client host signs in
+// hostbased authentication. See RFC 4252, section 9.
+func buildDataSignedForHostbased(sessionID []byte, req userAuthRequestMsg, algo string, pubKey []byte, clientHost, clientUser string) []byte {
+	data := struct {
+		Session    []byte
+		Type       byte
+		User       string
+		Service    string
+		Method     string
+		Algo       string
+		PubKey     []byte
+		ClientHost string
+		ClientUser string
+	}{
+		sessionID,
+		msgUserAuthRequest,
+		req.User,
+		req.Service,
+		req.Method,
+		algo,
+		pubKey,
+		clientHost,
+		clientUser,
+	}
+	return Marshal(data)
+}
+
 func appendU16(buf []byte, n uint16) []byte {
 	return append(buf, byte(n>>8), byte(n))
 }
@@ -410,6 +542,10 @@ type window struct {
 	win          uint32 // RFC 4254 5.2 says the window size can grow to 2^32-1
 	writeWaiters int
 	closed       bool
+
+	// blocked, if non-nil, is called after reserve had to wait for the
+	// window to be enlarged, with the time spent waiting.
+	blocked func(time.Duration)
 }
 
 // add adds win to the amount of window available
@@ -450,6 +586,10 @@ func (w *window) reserve(win uint32) (uint32, error) {
 	w.L.Lock()
 	w.writeWaiters++
 	w.Broadcast()
+	var start time.Time
+	if w.win == 0 && !w.closed {
+		start = time.Now()
+	}
 	for w.win == 0 && !w.closed {
 		w.Wait()
 	}
@@ -462,6 +602,9 @@ func (w *window) reserve(win uint32) (uint32, error) {
 		err = io.EOF
 	}
 	w.L.Unlock()
+	if !start.IsZero() && w.blocked != nil {
+		w.blocked(time.Since(start))
+	}
 	return win, err
 }
 
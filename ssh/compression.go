@@ -0,0 +1,553 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// This file implements the zlib compression of RFC 4253, Section 6.2, and
+// its delayed variant zlib@openssh.com, which only starts once the user is
+// authenticated. Each direction has its own zlib stream, which spans all
+// the packets until the next key change; every packet is flushed so that
+// it can be decompressed as soon as it is received.
+
+const (
+	compressionZlib        = "zlib"
+	compressionZlibOpenSSH = "zlib@openssh.com"
+)
+
+// compressionAlgos lists the compression algorithms we support.
+var compressionAlgos = map[string]bool{
+	compressionNone:        true,
+	compressionZlib:        true,
+	compressionZlibOpenSSH: true,
+}
+
+// withCompression returns c, compressing or decompressing the payloads of
+// the packets with the compression algorithm algo. authenticated reports
+// whether the user is authenticated, for the delayed algorithms.
+func withCompression(c packetCipher, algo string, authenticated *atomic.Bool) packetCipher {
+	switch algo {
+	case compressionZlib:
+		return &compressionCipher{packetCipher: c}
+	case compressionZlibOpenSSH:
+		return &compressionCipher{packetCipher: c, authenticated: authenticated}
+	}
+	return c
+}
+
+// compressionCipher is a packetCipher that compresses the packets of one
+// direction with zlib.
+type compressionCipher struct {
+	packetCipher
+
+	// authenticated, if not nil, delays the compression until it is set.
+	authenticated *atomic.Bool
+
+	w   *zlib.Writer
+	buf bytes.Buffer
+
+	r *inflater
+}
+
+func (c *compressionCipher) active() bool {
+	return c.authenticated == nil || c.authenticated.Load()
+}
+
+func (c *compressionCipher) writeCipherPacket(seqNum uint32, w io.Writer, rand io.Reader, packet []byte) error {
+	if !c.active() {
+		return c.packetCipher.writeCipherPacket(seqNum, w, rand, packet)
+	}
+	if c.w == nil {
+		c.w = zlib.NewWriter(&c.buf)
+	}
+	c.buf.Reset()
+	c.w.Write(packet)
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	return c.packetCipher.writeCipherPacket(seqNum, w, rand, c.buf.Bytes())
+}
+
+func (c *compressionCipher) readCipherPacket(seqNum uint32, r io.Reader) ([]byte, error) {
+	packet, err := c.packetCipher.readCipherPacket(seqNum, r)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if !c.active() {
+		return packet, nil
+	}
+	if c.r == nil {
+		c.r = newInflater()
+	}
+	return c.r.inflate(packet, maxPacket)
+}
+
+// Close stops the decompression, once the packets of c have all been read.
+func (c *compressionCipher) Close() error {
+	if c.r != nil {
+		c.r.close()
+	}
+	return nil
+}
+
+// closeCipher releases the resources of c, which won't be used anymore.
+func closeCipher(c packetCipher) {
+	if c, ok := c.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// inflater decompresses a zlib stream that is received packet by packet.
+//
+// OpenSSH ends the compressed packets with a partial flush, which doesn't
+// align them on byte boundaries, so the decoder must be able to stop in
+// the middle of a byte and wait for the next packet. compress/flate can't
+// do that, and only delivers its output at block boundaries of its
+// choosing, so inflater runs its own decoder in a goroutine whose input
+// blocks until the next packet arrives. As all the output of a packet can
+// be decoded from the packet, the decoder delivers its output before it
+// waits for more input.
+type inflater struct {
+	in     chan []byte
+	events chan inflaterEvent
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// err is the error that stopped the decompression.
+	err error
+
+	// The following fields are used by the goroutine.
+
+	// buf is the rest of the current packet.
+	buf []byte
+	// b holds nb bits of input, in the order they are used.
+	b  uint32
+	nb uint
+	// window holds the output, of which the part from flushed on has not
+	// been delivered yet.
+	window  []byte
+	flushed int
+	// litLen and dist are the codes of the current block.
+	litLen, dist huffman
+}
+
+// inflaterEvent is some output of the stream, an error, or, if it is zero,
+// a request for the next packet.
+type inflaterEvent struct {
+	data []byte
+	err  error
+}
+
+func newInflater() *inflater {
+	f := &inflater{
+		in:     make(chan []byte),
+		events: make(chan inflaterEvent),
+		done:   make(chan struct{}),
+	}
+	go f.loop()
+	// Wait for the goroutine to request the first packet.
+	<-f.events
+	return f
+}
+
+func (f *inflater) loop() {
+	err := f.decode()
+	if err == errInflaterClosed {
+		return
+	}
+	f.send(inflaterEvent{err: err})
+}
+
+func (f *inflater) send(ev inflaterEvent) bool {
+	select {
+	case f.events <- ev:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+var errInflaterClosed = errors.New("ssh: decompression stopped")
+
+// readByte returns the next byte of the stream. If the current packet is
+// exhausted, it delivers the pending output and waits for the next packet.
+func (f *inflater) readByte() (byte, error) {
+	for len(f.buf) == 0 {
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+		if !f.send(inflaterEvent{}) {
+			return 0, errInflaterClosed
+		}
+		select {
+		case f.buf = <-f.in:
+		case <-f.done:
+			return 0, errInflaterClosed
+		}
+	}
+	b := f.buf[0]
+	f.buf = f.buf[1:]
+	return b, nil
+}
+
+// flush delivers the pending output, and drops the part of the window that
+// can't be referred to anymore.
+func (f *inflater) flush() error {
+	if f.flushed < len(f.window) {
+		out := append([]byte(nil), f.window[f.flushed:]...)
+		if !f.send(inflaterEvent{data: out}) {
+			return errInflaterClosed
+		}
+		f.flushed = len(f.window)
+	}
+	if len(f.window) > 2*maxWindow {
+		n := copy(f.window, f.window[len(f.window)-maxWindow:])
+		f.window = f.window[:n]
+		f.flushed = n
+	}
+	return nil
+}
+
+// inflate returns the decompressed content of packet, which must not be
+// larger than limit.
+func (f *inflater) inflate(packet []byte, limit int) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.in <- packet
+	var out []byte
+	for {
+		ev := <-f.events
+		switch {
+		case ev.err != nil:
+			f.err = ev.err
+			return nil, f.err
+		case ev.data == nil:
+			return out, nil
+		}
+		out = append(out, ev.data...)
+		if len(out) > limit {
+			f.err = errors.New("ssh: decompressed packet too large")
+			f.close()
+			return nil, f.err
+		}
+	}
+}
+
+func (f *inflater) close() {
+	f.closeOnce.Do(func() { close(f.done) })
+}
+
+// The rest of this file decodes the zlib format of RFC 1950 and the
+// DEFLATE format of RFC 1951, in the manner of puff.c from zlib.
+
+// maxWindow is the largest distance of a back-reference.
+const maxWindow = 32 * 1024
+
+var errCorruptCompressed = errors.New("ssh: invalid compressed data")
+
+func (f *inflater) bits(n uint) (uint32, error) {
+	for f.nb < n {
+		c, err := f.readByte()
+		if err != nil {
+			return 0, err
+		}
+		f.b |= uint32(c) << f.nb
+		f.nb += 8
+	}
+	v := f.b & (1<<n - 1)
+	f.b >>= n
+	f.nb -= n
+	return v, nil
+}
+
+func (f *inflater) decode() error {
+	cmf, err := f.bits(8)
+	if err != nil {
+		return err
+	}
+	flg, err := f.bits(8)
+	if err != nil {
+		return err
+	}
+	if cmf&0x0f != 8 || cmf>>4 > 7 || flg&0x20 != 0 || (cmf<<8|flg)%31 != 0 {
+		return errors.New("ssh: invalid zlib header")
+	}
+	for {
+		final, err := f.bits(1)
+		if err != nil {
+			return err
+		}
+		typ, err := f.bits(2)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 0:
+			err = f.stored()
+		case 1:
+			err = f.fixed()
+		case 2:
+			err = f.dynamic()
+		default:
+			err = errCorruptCompressed
+		}
+		if err != nil {
+			return err
+		}
+		if final == 1 {
+			// The stream of a direction lasts until the next key change.
+			return errors.New("ssh: unexpected end of compressed stream")
+		}
+	}
+}
+
+// output delivers the pending output once there is enough of it, so that
+// the limit of inflate applies before the window grows too much.
+func (f *inflater) output() error {
+	if len(f.window)-f.flushed < maxWindow {
+		return nil
+	}
+	return f.flush()
+}
+
+func (f *inflater) stored() error {
+	// Discard the bits up to the next byte boundary.
+	f.b, f.nb = 0, 0
+	v, err := f.bits(32)
+	if err != nil {
+		return err
+	}
+	n := v & 0xffff
+	if v>>16 != ^n&0xffff {
+		return errCorruptCompressed
+	}
+	for ; n > 0; n-- {
+		c, err := f.readByte()
+		if err != nil {
+			return err
+		}
+		f.window = append(f.window, c)
+	}
+	return f.output()
+}
+
+// huffman is a canonical Huffman code.
+type huffman struct {
+	// count is the number of codes of each length.
+	count [16]uint16
+	// symbol holds the symbols, ordered by code.
+	symbol []uint16
+}
+
+// init builds the code in which the symbol i has the length lengths[i],
+// or no code if it is zero.
+func (h *huffman) init(lengths []uint8) error {
+	h.count = [16]uint16{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	left := 1
+	for l := 1; l < 16; l++ {
+		left = left<<1 - int(h.count[l])
+		if left < 0 {
+			return errCorruptCompressed
+		}
+	}
+	var offs [16]uint16
+	for l := 1; l < 15; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	h.symbol = h.symbol[:0]
+	for range lengths {
+		h.symbol = append(h.symbol, 0)
+	}
+	for sym, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(sym)
+			offs[l]++
+		}
+	}
+	return nil
+}
+
+func (f *inflater) decodeSymbol(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l < 16; l++ {
+		bit, err := f.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first]), nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errCorruptCompressed
+}
+
+var (
+	lengthBase  = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+)
+
+// codes decodes the symbols of a compressed block up to its end.
+func (f *inflater) codes() error {
+	for {
+		sym, err := f.decodeSymbol(&f.litLen)
+		if err != nil {
+			return err
+		}
+		switch {
+		case sym < 256:
+			f.window = append(f.window, byte(sym))
+			if err := f.output(); err != nil {
+				return err
+			}
+			continue
+		case sym == 256:
+			return nil
+		case sym-257 >= len(lengthBase):
+			return errCorruptCompressed
+		}
+		sym -= 257
+		extra, err := f.bits(uint(lengthExtra[sym]))
+		if err != nil {
+			return err
+		}
+		length := int(lengthBase[sym]) + int(extra)
+
+		sym, err = f.decodeSymbol(&f.dist)
+		if err != nil {
+			return err
+		}
+		if sym >= len(distBase) {
+			return errCorruptCompressed
+		}
+		if extra, err = f.bits(uint(distExtra[sym])); err != nil {
+			return err
+		}
+		dist := int(distBase[sym]) + int(extra)
+		if dist > len(f.window) {
+			return errCorruptCompressed
+		}
+		for i := 0; i < length; i++ {
+			f.window = append(f.window, f.window[len(f.window)-dist])
+		}
+		if err := f.output(); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *inflater) fixed() error {
+	var lengths [288 + 30]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		case i < 288:
+			lengths[i] = 8
+		default:
+			lengths[i] = 5
+		}
+	}
+	f.litLen.init(lengths[:288])
+	f.dist.init(lengths[288:])
+	return f.codes()
+}
+
+var codeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+func (f *inflater) dynamic() error {
+	v, err := f.bits(14)
+	if err != nil {
+		return err
+	}
+	nlen, ndist, ncode := int(v&0x1f)+257, int(v>>5&0x1f)+1, int(v>>10)+4
+	if nlen > 286 || ndist > 30 {
+		return errCorruptCompressed
+	}
+
+	var lengths [286 + 30]uint8
+	for i := 0; i < ncode; i++ {
+		l, err := f.bits(3)
+		if err != nil {
+			return err
+		}
+		lengths[codeLengthOrder[i]] = uint8(l)
+	}
+	if err := f.litLen.init(lengths[:19]); err != nil {
+		return err
+	}
+
+	for i := 0; i < nlen+ndist; {
+		sym, err := f.decodeSymbol(&f.litLen)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+		var l uint8
+		var n uint32
+		switch sym {
+		case 16:
+			if i == 0 {
+				return errCorruptCompressed
+			}
+			l = lengths[i-1]
+			n, err = f.bits(2)
+			n += 3
+		case 17:
+			n, err = f.bits(3)
+			n += 3
+		default:
+			n, err = f.bits(7)
+			n += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(n) > nlen+ndist {
+			return errCorruptCompressed
+		}
+		for ; n > 0; n-- {
+			lengths[i] = l
+			i++
+		}
+	}
+	if lengths[256] == 0 {
+		return errCorruptCompressed
+	}
+	if err := f.litLen.init(lengths[:nlen]); err != nil {
+		return err
+	}
+	if err := f.dist.init(lengths[nlen : nlen+ndist]); err != nil {
+		return err
+	}
+	return f.codes()
+}
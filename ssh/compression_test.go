@@ -0,0 +1,162 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+// TestInflaterPartialFlush decompresses packets compressed by zlib with
+// Z_PARTIAL_FLUSH, like OpenSSH does, which don't end on a byte boundary.
+func TestInflaterPartialFlush(t *testing.T) {
+	f := newInflater()
+	defer f.close()
+	for _, tt := range []struct {
+		packet string
+		want   []byte
+	}{
+		{"789c62cd48cdc9c90708", []byte("\x05hello")},
+		{"a0b8f2fca29c94516244110001", append([]byte{0x5e}, bytes.Repeat([]byte("world"), 100)...)},
+		{"9498989e98990710", []byte("\x61again")},
+	} {
+		packet, _ := hex.DecodeString(tt.packet)
+		got, err := f.inflate(packet, maxPacket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestInflaterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	f := newInflater()
+	defer f.close()
+	random := make([]byte, 40000)
+	rand.Read(random)
+	for i, packet := range [][]byte{
+		[]byte("a"),
+		random,
+		bytes.Repeat([]byte("abc"), 30000),
+		random[:100],
+		{},
+		append(random[:1000:1000], random[:1000]...),
+	} {
+		buf.Reset()
+		w.Write(packet)
+		w.Flush()
+		got, err := f.inflate(buf.Bytes(), maxPacket)
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		if !bytes.Equal(got, packet) {
+			t.Errorf("packet %d: got %d bytes, want %d", i, len(got), len(packet))
+		}
+	}
+}
+
+func TestInflaterLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(make([]byte, 2048))
+	w.Flush()
+	payload := buf.Bytes()
+	f := newInflater()
+	if _, err := f.inflate(payload, 1024); err == nil {
+		t.Error("inflate succeeded with a packet larger than the limit")
+	}
+	if _, err := f.inflate(payload, maxPacket); err == nil {
+		t.Error("inflate succeeded after an error")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	for _, algo := range []string{compressionZlib, compressionZlibOpenSSH} {
+		t.Run(algo, func(t *testing.T) {
+			serverConf := &ServerConfig{
+				Config: Config{Compression: []string{algo}},
+				PasswordCallback: func(conn ConnMetadata, password []byte) (*Permissions, error) {
+					return nil, nil
+				},
+			}
+			serverConf.AddHostKey(testSigners["ecdsa"])
+			clientConf := &ClientConfig{
+				// The packets are compressed across several key changes.
+				Config:          Config{Compression: []string{"zstd", algo, compressionNone}, RekeyThreshold: 16 * 1024},
+				User:            "testuser",
+				Auth:            []AuthMethod{Password("password")},
+				HostKeyCallback: InsecureIgnoreHostKey(),
+			}
+
+			c1, c2, err := netPipe()
+			if err != nil {
+				t.Fatalf("netPipe: %v", err)
+			}
+			defer c1.Close()
+			defer c2.Close()
+			go func() {
+				_, chans, reqs, err := NewServerConn(c1, serverConf)
+				if err != nil {
+					t.Errorf("server: %v", err)
+					return
+				}
+				go DiscardRequests(reqs)
+				for newCh := range chans {
+					ch, reqs, err := newCh.Accept()
+					if err != nil {
+						t.Errorf("Accept: %v", err)
+						return
+					}
+					go DiscardRequests(reqs)
+					go func() {
+						io.Copy(ch, ch)
+						ch.CloseWrite()
+					}()
+				}
+			}()
+			conn, chans, reqs, err := NewClientConn(c2, "", clientConf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			go DiscardRequests(reqs)
+			go func() {
+				for newCh := range chans {
+					newCh.Reject(Prohibited, "")
+				}
+			}()
+
+			algs := conn.(AlgorithmsConnMetadata).Algorithms()
+			if algs.Read.Compression != algo || algs.Write.Compression != algo {
+				t.Errorf("negotiated compression %q and %q, want %q", algs.Read.Compression, algs.Write.Compression, algo)
+			}
+
+			ch, _, err := conn.OpenChannel("echo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := bytes.Repeat([]byte("compressible data "), 20000)
+			go func() {
+				ch.Write(want)
+				ch.CloseWrite()
+			}()
+			got, err := io.ReadAll(ch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("echoed %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+}
@@ -5,8 +5,10 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"time"
 )
 
 // OpenChannelError is returned if the other side rejects an
@@ -69,12 +71,12 @@ type Conn interface {
 	Close() error
 
 	// Wait blocks until the connection has shut down, and returns the
-	// error causing the shutdown.
+	// error causing the shutdown. If the remote side disconnected with an
+	// SSH_MSG_DISCONNECT message, the error is a *DisconnectError.
 	Wait() error
 
 	// TODO(hanwen): consider exposing:
 	//   RequestKeyChange
-	//   Disconnect
 }
 
 // DiscardRequests consumes and rejects all requests from the
@@ -94,6 +96,9 @@ type connection struct {
 
 	// The connection protocol.
 	*mux
+
+	// pingSupported is set if the peer answers ping@openssh.com messages.
+	pingSupported bool
 }
 
 func (c *connection) Close() error {
@@ -148,3 +153,33 @@ func (c *sshConn) ServerVersion() []byte {
 func (c *sshConn) RawConn() net.Conn {
 	return c.conn
 }
+
+// watchContext interrupts the I/O on c if ctx is done before the returned
+// stop function is called. stop returns ctx.Err() if the I/O was
+// interrupted, in which case c must not be used anymore.
+func watchContext(ctx context.Context, c net.Conn) (stop func() error) {
+	if ctx.Done() == nil {
+		return func() error { return nil }
+	}
+	stopc := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// A deadline in the past makes pending and future reads and
+			// writes fail, which unblocks the key exchange and the
+			// authentication.
+			c.SetDeadline(time.Unix(1, 0))
+			interrupted <- true
+		case <-stopc:
+			interrupted <- false
+		}
+	}()
+	return func() error {
+		close(stopc)
+		if <-interrupted {
+			return ctx.Err()
+		}
+		return nil
+	}
+}
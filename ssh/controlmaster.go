@@ -0,0 +1,196 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// This file implements the client side of the proxy mode of the connection
+// multiplexing protocol of OpenSSH, as described in its PROTOCOL.mux file.
+// In proxy mode, the master connection forwards the messages of the
+// connection protocol between the control socket and the server, which
+// lets the usual mux drive sessions and outgoing channels. OpenSSH drops
+// the control connection when it receives global requests other than
+// tcpip-forward, and does not route their replies back, so global
+// requests are refused locally.
+
+const (
+	muxMsgHello          = 0x00000001
+	muxCProxy            = 0x1000000f
+	muxSPermissionDenied = 0x80000002
+	muxSFailure          = 0x80000003
+	muxSProxy            = 0x8000000f
+
+	muxProtocolVersion = 4
+)
+
+type muxHelloMsg struct {
+	Type    uint32
+	Version uint32
+	// Extensions are pairs of strings, which are ignored.
+	Extensions []byte `ssh:"rest"`
+}
+
+type muxRequestMsg struct {
+	Type      uint32
+	RequestID uint32
+	Rest      []byte `ssh:"rest"`
+}
+
+// DialControlMaster connects to the control socket at path of an OpenSSH
+// master connection, as set up by the ControlMaster and ControlPath options
+// of ssh(1), and returns a Client whose sessions and channels, such as
+// those of Client.Dial, go through the connection of the master, without
+// authenticating again.
+//
+// The master must support the proxy mode of the multiplexing protocol,
+// which OpenSSH does since version 7.4. Global requests, and with them
+// Client.Listen and keepalives, are not supported and fail with
+// ErrControlMasterRequest. The metadata of the connection to the server,
+// such as the user and the session ID, is not available to the Client.
+func DialControlMaster(path string) (*Client, error) {
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewControlMasterClient(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewControlMasterClient is like DialControlMaster, but uses c, a
+// connection to the control socket of the master.
+func NewControlMasterClient(c net.Conn) (*Client, error) {
+	if err := writeMuxMessage(c, Marshal(&muxHelloMsg{Type: muxMsgHello, Version: muxProtocolVersion})); err != nil {
+		return nil, err
+	}
+	packet, err := readMuxMessage(c)
+	if err != nil {
+		return nil, err
+	}
+	var hello muxHelloMsg
+	if err := Unmarshal(packet, &hello); err != nil || hello.Type != muxMsgHello {
+		return nil, errors.New("ssh: invalid hello from control master")
+	}
+	if hello.Version != muxProtocolVersion {
+		return nil, fmt.Errorf("ssh: unsupported control master protocol version %d", hello.Version)
+	}
+
+	const requestID = 1
+	if err := writeMuxMessage(c, Marshal(&muxRequestMsg{Type: muxCProxy, RequestID: requestID})); err != nil {
+		return nil, err
+	}
+	if packet, err = readMuxMessage(c); err != nil {
+		return nil, err
+	}
+	var reply muxRequestMsg
+	if err := Unmarshal(packet, &reply); err != nil || reply.RequestID != requestID {
+		return nil, errors.New("ssh: invalid reply from control master")
+	}
+	switch reply.Type {
+	case muxSProxy:
+	case muxSPermissionDenied, muxSFailure:
+		var reason struct{ Reason string }
+		Unmarshal(reply.Rest, &reason)
+		return nil, fmt.Errorf("ssh: control master refused proxy mode: %s", reason.Reason)
+	default:
+		return nil, fmt.Errorf("ssh: unexpected reply %#x from control master", reply.Type)
+	}
+
+	conn := &controlConn{
+		sshConn: sshConn{conn: c},
+		mux:     newMux(&controlPacketConn{conn: c}),
+	}
+	return NewClient(conn, conn.mux.incomingChannels, conn.mux.incomingRequests), nil
+}
+
+// ErrControlMasterRequest is returned for global requests sent through a
+// control master, which OpenSSH does not forward reliably.
+var ErrControlMasterRequest = errors.New("ssh: global requests are not supported through a control master")
+
+// controlConn is the Conn of a Client using a control master.
+type controlConn struct {
+	sshConn
+	*mux
+}
+
+func (c *controlConn) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	return false, nil, ErrControlMasterRequest
+}
+
+func (c *controlConn) Close() error {
+	return c.sshConn.conn.Close()
+}
+
+// Disconnect closes the connection to the control socket. The master
+// connection stays open, so nothing is sent to the server.
+func (c *controlConn) Disconnect(reason DisconnectReason, message string) error {
+	return c.Close()
+}
+
+func writeMuxMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(buf, uint32(len(msg)))
+	copy(buf[4:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readMuxMessage(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > maxPacket {
+		return nil, errors.New("ssh: control master message too large")
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// controlPacketConn is the packetConn of the proxy mode. Each packet is
+// sent as a mux message holding a padding length, which is ignored, and
+// the SSH message, without padding or MAC.
+type controlPacketConn struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+}
+
+func (p *controlPacketConn) writePacket(packet []byte) error {
+	msg := make([]byte, 1+len(packet))
+	copy(msg[1:], packet)
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return writeMuxMessage(p.conn, msg)
+}
+
+func (p *controlPacketConn) readPacket() ([]byte, error) {
+	msg, err := readMuxMessage(p.conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) < 2 {
+		return nil, errors.New("ssh: invalid packet from control master")
+	}
+	return msg[1:], nil
+}
+
+func (p *controlPacketConn) Close() error {
+	return p.conn.Close()
+}
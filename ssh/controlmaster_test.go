@@ -0,0 +1,148 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveControlMaster accepts a connection on l and behaves like an OpenSSH
+// master connection in proxy mode, refusing it if refuse is set.
+func serveControlMaster(t *testing.T, l net.Listener, refuse bool) {
+	c, err := l.Accept()
+	if err != nil {
+		t.Errorf("Accept: %v", err)
+		return
+	}
+	defer c.Close()
+	if err := writeMuxMessage(c, Marshal(&muxHelloMsg{Type: muxMsgHello, Version: muxProtocolVersion})); err != nil {
+		t.Errorf("writing hello: %v", err)
+		return
+	}
+	var hello muxHelloMsg
+	packet, err := readMuxMessage(c)
+	if err == nil {
+		err = Unmarshal(packet, &hello)
+	}
+	if err != nil || hello.Type != muxMsgHello || hello.Version != muxProtocolVersion {
+		t.Errorf("got hello %+v, error %v", hello, err)
+		return
+	}
+	var req muxRequestMsg
+	packet, err = readMuxMessage(c)
+	if err == nil {
+		err = Unmarshal(packet, &req)
+	}
+	if err != nil || req.Type != muxCProxy {
+		t.Errorf("got request %+v, error %v", req, err)
+		return
+	}
+	if refuse {
+		writeMuxMessage(c, Marshal(&struct {
+			Type, RequestID uint32
+			Reason          string
+		}{muxSPermissionDenied, req.RequestID, "not allowed"}))
+		return
+	}
+	if err := writeMuxMessage(c, Marshal(&muxRequestMsg{Type: muxSProxy, RequestID: req.RequestID})); err != nil {
+		t.Errorf("writing proxy reply: %v", err)
+		return
+	}
+
+	m := newMux(&controlPacketConn{conn: c})
+	go DiscardRequests(m.incomingRequests)
+	for newCh := range m.incomingChannels {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			return
+		}
+		go func() {
+			for req := range reqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				ch.Write([]byte("output of " + string(req.Payload[4:])))
+				ch.SendRequest("exit-status", false, Marshal(&exitStatusRequestMsg{0}))
+				ch.Close()
+			}
+		}()
+	}
+}
+
+func newControlSocket(t *testing.T) (string, net.Listener) {
+	// Keep the path short, as UNIX socket paths are limited to about 100 bytes.
+	dir, err := os.MkdirTemp("", "mux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "control")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("UNIX sockets are not supported: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return path, l
+}
+
+func TestDialControlMaster(t *testing.T) {
+	path, l := newControlSocket(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveControlMaster(t, l, false)
+	}()
+
+	client, err := DialControlMaster(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		session, err := client.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := session.Output("uname")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != "output of uname" {
+			t.Errorf("got output %q", out)
+		}
+	}
+	if _, err := client.Dial("tcp", "example.com:80"); err == nil {
+		t.Error("Dial succeeded with a master refusing direct-tcpip channels")
+	}
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != ErrControlMasterRequest {
+		t.Errorf("SendRequest: got %v, want ErrControlMasterRequest", err)
+	}
+	if _, err := client.Listen("tcp", "127.0.0.1:0"); !errors.Is(err, ErrControlMasterRequest) {
+		t.Errorf("Listen: got %v, want ErrControlMasterRequest", err)
+	}
+	client.Close()
+	<-done
+}
+
+func TestDialControlMasterRefused(t *testing.T) {
+	path, l := newControlSocket(t)
+	go serveControlMaster(t, l, true)
+
+	_, err := DialControlMaster(path)
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("got error %v, want the reason of the master", err)
+	}
+}
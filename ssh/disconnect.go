@@ -0,0 +1,98 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// DisconnectReason is the reason code of an SSH_MSG_DISCONNECT message.
+// See RFC 4253, section 11.1.
+type DisconnectReason uint32
+
+const (
+	DisconnectHostNotAllowedToConnect     DisconnectReason = 1
+	DisconnectProtocolError               DisconnectReason = 2
+	DisconnectKeyExchangeFailed           DisconnectReason = 3
+	DisconnectMACError                    DisconnectReason = 5
+	DisconnectCompressionError            DisconnectReason = 6
+	DisconnectServiceNotAvailable         DisconnectReason = 7
+	DisconnectProtocolVersionNotSupported DisconnectReason = 8
+	DisconnectHostKeyNotVerifiable        DisconnectReason = 9
+	DisconnectConnectionLost              DisconnectReason = 10
+	DisconnectByApplication               DisconnectReason = 11
+	DisconnectTooManyConnections          DisconnectReason = 12
+	DisconnectAuthCancelledByUser         DisconnectReason = 13
+	DisconnectNoMoreAuthMethodsAvailable  DisconnectReason = 14
+	DisconnectIllegalUserName             DisconnectReason = 15
+)
+
+var disconnectReasonNames = map[DisconnectReason]string{
+	DisconnectHostNotAllowedToConnect:     "SSH_DISCONNECT_HOST_NOT_ALLOWED_TO_CONNECT",
+	DisconnectProtocolError:               "SSH_DISCONNECT_PROTOCOL_ERROR",
+	DisconnectKeyExchangeFailed:           "SSH_DISCONNECT_KEY_EXCHANGE_FAILED",
+	DisconnectMACError:                    "SSH_DISCONNECT_MAC_ERROR",
+	DisconnectCompressionError:            "SSH_DISCONNECT_COMPRESSION_ERROR",
+	DisconnectServiceNotAvailable:         "SSH_DISCONNECT_SERVICE_NOT_AVAILABLE",
+	DisconnectProtocolVersionNotSupported: "SSH_DISCONNECT_PROTOCOL_VERSION_NOT_SUPPORTED",
+	DisconnectHostKeyNotVerifiable:        "SSH_DISCONNECT_HOST_KEY_NOT_VERIFIABLE",
+	DisconnectConnectionLost:              "SSH_DISCONNECT_CONNECTION_LOST",
+	DisconnectByApplication:               "SSH_DISCONNECT_BY_APPLICATION",
+	DisconnectTooManyConnections:          "SSH_DISCONNECT_TOO_MANY_CONNECTIONS",
+	DisconnectAuthCancelledByUser:         "SSH_DISCONNECT_AUTH_CANCELLED_BY_USER",
+	DisconnectNoMoreAuthMethodsAvailable:  "SSH_DISCONNECT_NO_MORE_AUTH_METHODS_AVAILABLE",
+	DisconnectIllegalUserName:             "SSH_DISCONNECT_ILLEGAL_USER_NAME",
+}
+
+// String returns the name of r in RFC 4253, such as
+// "SSH_DISCONNECT_BY_APPLICATION".
+func (r DisconnectReason) String() string {
+	if name, ok := disconnectReasonNames[r]; ok {
+		return name
+	}
+	return "DisconnectReason(" + strconv.FormatUint(uint64(r), 10) + ")"
+}
+
+// DisconnectError is returned when the remote side closes the connection
+// with an SSH_MSG_DISCONNECT message, for instance by NewClientConn when
+// the server rejects the authentication for good, and by Conn.Wait.
+type DisconnectError struct {
+	Reason   DisconnectReason
+	Message  string
+	Language string
+}
+
+func (d *DisconnectError) Error() string {
+	return fmt.Sprintf("ssh: disconnect, reason %d: %s", d.Reason, d.Message)
+}
+
+// DisconnectConn is implemented by the Conn values of this package. It is
+// a separate interface so that adding it did not break implementations of
+// Conn outside this package.
+type DisconnectConn interface {
+	Conn
+
+	// Disconnect tells the remote side that the connection ends, and why,
+	// with an SSH_MSG_DISCONNECT message, and closes the underlying
+	// network connection. The remote side gets a *DisconnectError holding
+	// reason and message from Wait.
+	Disconnect(reason DisconnectReason, message string) error
+}
+
+// Disconnect sends an SSH_MSG_DISCONNECT message with reason and message to
+// the remote side, and closes the connection. Unlike Close, which just
+// closes the network connection, it tells the remote side why the
+// connection ends.
+func (c *connection) Disconnect(reason DisconnectReason, message string) error {
+	err := c.transport.writePacket(Marshal(&disconnectMsg{
+		Reason:  uint32(reason),
+		Message: message,
+	}))
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
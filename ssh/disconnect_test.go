@@ -0,0 +1,64 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnDisconnect(t *testing.T) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+	done := make(chan error, 1)
+	go func() {
+		conn, chans, reqs, err := NewServerConn(c1, serverConf)
+		if err != nil {
+			done <- err
+			return
+		}
+		go DiscardRequests(reqs)
+		go func() {
+			for newCh := range chans {
+				newCh.Reject(Prohibited, "")
+			}
+		}()
+		done <- conn.Conn.(DisconnectConn).Disconnect(DisconnectByApplication, "server going down")
+	}()
+
+	clientConf := &ClientConfig{User: "user", HostKeyCallback: InsecureIgnoreHostKey()}
+	conn, chans, reqs, err := NewClientConn(c2, "", clientConf)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	client := NewClient(conn, chans, reqs)
+	if err := <-done; err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+
+	var de *DisconnectError
+	if err := client.Wait(); !errors.As(err, &de) {
+		t.Fatalf("got error %v from Wait, want a *DisconnectError", err)
+	}
+	if de.Reason != DisconnectByApplication || de.Message != "server going down" {
+		t.Errorf("got reason %v and message %q", de.Reason, de.Message)
+	}
+}
+
+func TestDisconnectReasonString(t *testing.T) {
+	if s := DisconnectNoMoreAuthMethodsAvailable.String(); s != "SSH_DISCONNECT_NO_MORE_AUTH_METHODS_AVAILABLE" {
+		t.Errorf("got %q", s)
+	}
+	if s := DisconnectReason(42).String(); s != "DisconnectReason(42)" {
+		t.Errorf("got %q for an unknown reason", s)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
 // debugHandshake, if set, prints messages sent and received.  Key
@@ -69,6 +70,10 @@ type handshakeTransport struct {
 	// we accept these key types from the server as host key.
 	hostKeyAlgorithms []string
 
+	// serverHostKeyPolicy, if not nil, restricts the host key algorithms
+	// offered by the server to those of the algorithm policy.
+	serverHostKeyPolicy []string
+
 	// On read error, incoming is closed, and readError is set.
 	incoming  chan []byte
 	readError error
@@ -77,7 +82,8 @@ type handshakeTransport struct {
 	writeError       error
 	sentInitPacket   []byte
 	sentInitMsg      *kexInitMsg
-	pendingPackets   [][]byte // Used when a key exchange is in progress.
+	negotiated       NegotiatedAlgorithms // of the last successful key exchange
+	pendingPackets   [][]byte             // Used when a key exchange is in progress.
 	writePacketsLeft uint32
 	writeBytesLeft   int64
 
@@ -91,16 +97,29 @@ type handshakeTransport struct {
 	startKex    chan *pendingKex
 	kexLoopDone chan struct{} // closed (with writeError non-nil) when kexLoop exits
 
+	// gssKexClient and gssKexServer, if set, enable the GSS-API key
+	// exchange methods on the client and on the server.
+	gssKexClient *GSSAPIKeyExchangeConfig
+	gssKexServer GSSAPIKeyExchangeServer
+
 	// data for host key checking
 	hostKeyCallback HostKeyCallback
 	dialAddress     string
 	remoteAddr      net.Addr
+	// serverHostKey is the host key the server proved during the initial
+	// key exchange, which publickey-hostbound-v00@openssh.com requests bind.
+	serverHostKey []byte
 
 	// bannerCallback is non-empty if we are the client and it has been set in
 	// ClientConfig. In that case it is called during the user authentication
 	// dance to handle a custom server's message.
 	bannerCallback BannerCallback
 
+	// authBannerCallback replaces bannerCallback if set, and is called with
+	// the state of the authentication in authBanner.
+	authBannerCallback AuthBannerCallback
+	authBanner         AuthBanner
+
 	// Algorithms agreed in the last key exchange.
 	algorithms *algorithms
 
@@ -122,6 +141,9 @@ type pendingKex struct {
 }
 
 func newHandshakeTransport(conn keyingTransport, config *Config, clientVersion, serverVersion []byte) *handshakeTransport {
+	if m := config.Metrics; m != nil && (m.PacketSent != nil || m.PacketReceived != nil) {
+		conn = &meteredTransport{conn, m}
+	}
 	t := &handshakeTransport{
 		conn:          conn,
 		serverVersion: serverVersion,
@@ -147,6 +169,10 @@ func newClientTransport(conn keyingTransport, clientVersion, serverVersion []byt
 	t.remoteAddr = addr
 	t.hostKeyCallback = config.HostKeyCallback
 	t.bannerCallback = config.BannerCallback
+	t.authBannerCallback = config.AuthBannerCallback
+	if g := config.GSSAPIKeyExchange; g != nil && g.Client != nil {
+		t.gssKexClient = g
+	}
 	if config.HostKeyAlgorithms != nil {
 		t.hostKeyAlgorithms = config.HostKeyAlgorithms
 	} else {
@@ -161,6 +187,10 @@ func newServerTransport(conn keyingTransport, clientVersion, serverVersion []byt
 	t := newHandshakeTransport(conn, &config.Config, clientVersion, serverVersion)
 	t.hostKeys = config.hostKeys
 	t.publicKeyAuthAlgorithms = config.PublicKeyAuthAlgorithms
+	t.gssKexServer = config.GSSAPIKeyExchange
+	if p, _ := config.policyAlgorithms(); p != nil {
+		t.serverHostKeyPolicy = p.HostKeys
+	}
 	go t.readLoop()
 	go t.kexLoop()
 	return t
@@ -323,10 +353,23 @@ write:
 		// another key change request, until we close the done
 		// channel on the pendingKex request.
 
+		start := time.Now()
+		initial := t.sessionID == nil
 		err := t.enterKeyExchange(request.otherInit)
+		if m := t.config.Metrics; m != nil && m.KeyExchange != nil {
+			info := KeyExchangeInfo{Initial: initial, Duration: time.Since(start), Err: err}
+			if t.algorithms != nil {
+				info.Algorithm, info.HostKeyAlgorithm = t.algorithms.kex, t.algorithms.hostKey
+			}
+			m.KeyExchange(info)
+		}
 
 		t.mu.Lock()
 		t.writeError = err
+		if err == nil && t.algorithms != nil {
+			t.negotiated = newNegotiatedAlgorithms(t.algorithms)
+			t.negotiated.StrictKeyExchange = t.strictMode
+		}
 		t.sentInitPacket = nil
 		t.sentInitMsg = nil
 
@@ -480,8 +523,8 @@ func (t *handshakeTransport) sendKexInit() error {
 		CiphersServerClient:     t.config.Ciphers,
 		MACsClientServer:        t.config.MACs,
 		MACsServerClient:        t.config.MACs,
-		CompressionClientServer: supportedCompressions,
-		CompressionServerClient: supportedCompressions,
+		CompressionClientServer: t.config.Compression,
+		CompressionServerClient: t.config.Compression,
 	}
 	io.ReadFull(rand.Reader, msg.Cookie[:])
 
@@ -489,7 +532,10 @@ func (t *handshakeTransport) sendKexInit() error {
 	// and possibly to add the ext-info extension algorithm. Since the slice may be the
 	// user owned KeyExchanges, we create our own slice in order to avoid using user
 	// owned memory by mistake.
-	msg.KexAlgos = make([]string, 0, len(t.config.KeyExchanges)+2) // room for kex-strict and ext-info
+	msg.KexAlgos = make([]string, 0, len(gssKexAlgos)+len(t.config.KeyExchanges)+2) // room for kex-strict and ext-info
+	if t.gssKexClient != nil || t.gssKexServer != nil {
+		msg.KexAlgos = append(msg.KexAlgos, gssKexAlgos...)
+	}
 	msg.KexAlgos = append(msg.KexAlgos, t.config.KeyExchanges...)
 
 	isServer := len(t.hostKeys) > 0
@@ -517,6 +563,10 @@ func (t *handshakeTransport) sendKexInit() error {
 			}
 		}
 
+		if t.serverHostKeyPolicy != nil {
+			msg.ServerHostKeyAlgos = applyPolicy(msg.ServerHostKeyAlgos, t.serverHostKeyPolicy)
+		}
+
 		if t.sessionID == nil {
 			msg.KexAlgos = append(msg.KexAlgos, kexStrictServer)
 		}
@@ -664,7 +714,7 @@ func (t *handshakeTransport) enterKeyExchange(otherInitPacket []byte) error {
 		}
 	}
 
-	kex, ok := kexAlgoMap[t.algorithms.kex]
+	kex, ok := t.kexAlgorithm(t.algorithms.kex)
 	if !ok {
 		return fmt.Errorf("ssh: unexpected key exchange algorithm %v", t.algorithms.kex)
 	}
@@ -683,6 +733,7 @@ func (t *handshakeTransport) enterKeyExchange(otherInitPacket []byte) error {
 	firstKeyExchange := t.sessionID == nil
 	if firstKeyExchange {
 		t.sessionID = result.H
+		t.serverHostKey = result.HostKey
 	}
 	result.SessionID = t.sessionID
 
@@ -699,8 +750,8 @@ func (t *handshakeTransport) enterKeyExchange(otherInitPacket []byte) error {
 	if !isClient && firstKeyExchange && contains(clientInit.KexAlgos, "ext-info-c") {
 		supportedPubKeyAuthAlgosList := strings.Join(t.publicKeyAuthAlgorithms, ",")
 		extInfo := &extInfoMsg{
-			NumExtensions: 2,
-			Payload:       make([]byte, 0, 4+15+4+len(supportedPubKeyAuthAlgosList)+4+16+4+1),
+			NumExtensions: 3,
+			Payload:       make([]byte, 0, 4+15+4+len(supportedPubKeyAuthAlgosList)+4+16+4+1+4+31+4+1),
 		}
 		extInfo.Payload = appendInt(extInfo.Payload, len("server-sig-algs"))
 		extInfo.Payload = append(extInfo.Payload, "server-sig-algs"...)
@@ -710,6 +761,10 @@ func (t *handshakeTransport) enterKeyExchange(otherInitPacket []byte) error {
 		extInfo.Payload = append(extInfo.Payload, "ping@openssh.com"...)
 		extInfo.Payload = appendInt(extInfo.Payload, 1)
 		extInfo.Payload = append(extInfo.Payload, "0"...)
+		extInfo.Payload = appendInt(extInfo.Payload, len(publicKeyHostboundExtension))
+		extInfo.Payload = append(extInfo.Payload, publicKeyHostboundExtension...)
+		extInfo.Payload = appendInt(extInfo.Payload, 1)
+		extInfo.Payload = append(extInfo.Payload, "0"...)
 		if err := t.conn.writePacket(Marshal(extInfo)); err != nil {
 			return err
 		}
@@ -730,6 +785,22 @@ func (t *handshakeTransport) enterKeyExchange(otherInitPacket []byte) error {
 	return nil
 }
 
+// kexAlgorithm returns the implementation of the key exchange method name.
+func (t *handshakeTransport) kexAlgorithm(name string) (kexAlgorithm, bool) {
+	if dh, ok := gssKexGroups[name]; ok {
+		if t.gssKexClient == nil && t.gssKexServer == nil {
+			return nil, false
+		}
+		return &gssKex{
+			group:  kexAlgoMap[dh].(*dhGroup),
+			client: t.gssKexClient,
+			server: t.gssKexServer,
+		}, true
+	}
+	kex, ok := kexAlgoMap[name]
+	return kex, ok
+}
+
 // algorithmSignerWrapper is an AlgorithmSigner that only supports the default
 // key format algorithm.
 //
@@ -793,14 +864,17 @@ func (t *handshakeTransport) client(kex kexAlgorithm, magics *handshakeMagics) (
 		return nil, err
 	}
 
-	if err := verifyHostKeySignature(hostKey, t.algorithms.hostKey, result); err != nil {
-		return nil, err
+	// In GSS-API key exchange, the server authenticates the exchange hash,
+	// which includes its host key, with a MIC rather than a signature.
+	if _, ok := kex.(*gssKex); !ok {
+		if err := verifyHostKeySignature(hostKey, t.algorithms.hostKey, result); err != nil {
+			return nil, err
+		}
 	}
 
 	err = t.hostKeyCallback(t.dialAddress, t.remoteAddr, hostKey)
 	if err != nil {
 		return nil, err
 	}
-
 	return result, nil
 }
@@ -516,6 +516,7 @@ func TestDisconnect(t *testing.T) {
 		Message: "such is life",
 	}
 	trC.writePacket(Marshal(errMsg))
+	wantErr := &DisconnectError{Reason: 42, Message: "such is life"}
 	trC.writePacket([]byte{msgRequestSuccess, 0, 0})
 
 	packet, err := trS.readPacket()
@@ -529,8 +530,8 @@ func TestDisconnect(t *testing.T) {
 	_, err = trS.readPacket()
 	if err == nil {
 		t.Errorf("readPacket 2 succeeded")
-	} else if !reflect.DeepEqual(err, errMsg) {
-		t.Errorf("got error %#v, want %#v", err, errMsg)
+	} else if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("got error %#v, want %#v", err, wantErr)
 	}
 
 	_, err = trS.readPacket()
@@ -0,0 +1,206 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// This file implements the "no-more-sessions@openssh.com",
+// "hostkeys-00@openssh.com" and "hostkeys-prove-00@openssh.com" global
+// requests of Section 2.2 and 2.5 of OpenSSH's PROTOCOL file.
+const (
+	noMoreSessionsRequest = "no-more-sessions@openssh.com"
+	hostKeysRequest       = "hostkeys-00@openssh.com"
+	hostKeysProveRequest  = "hostkeys-prove-00@openssh.com"
+)
+
+// hostKeysProofData is the data signed to prove the possession of a host
+// key.
+type hostKeysProofData struct {
+	Request   string
+	SessionID []byte
+	HostKey   []byte
+}
+
+// announcedHostKeys returns the keys a server announces with
+// hostkeys-00@openssh.com. Certificates are left out, as in OpenSSH.
+func announcedHostKeys(config *ServerConfig) []Signer {
+	var keys []Signer
+	for _, k := range append(config.hostKeys[:len(config.hostKeys):len(config.hostKeys)], config.ExtraHostKeys...) {
+		if _, ok := k.PublicKey().(*Certificate); !ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// announceHostKeys sends the host keys of the server to the client.
+func (s *connection) announceHostKeys(keys []Signer) error {
+	var payload []byte
+	for _, k := range keys {
+		payload = appendString(payload, string(k.PublicKey().Marshal()))
+	}
+	_, _, err := s.SendRequest(hostKeysRequest, false, payload)
+	return err
+}
+
+// serverRequestHandler returns the handler of the global requests that the
+// server answers itself, see mux.handleRequest.
+func (s *connection) serverRequestHandler(config *ServerConfig) func(*Request) bool {
+	var keys []Signer
+	if config.AnnounceHostKeys {
+		keys = announcedHostKeys(config)
+	}
+	rand := config.Rand
+	return func(req *Request) bool {
+		switch {
+		case req.Type == noMoreSessionsRequest:
+			req.mux.noMoreSessions = true
+			req.Reply(true, nil)
+			return true
+		case req.Type == hostKeysProveRequest && keys != nil:
+			sigs, err := proveHostKeys(keys, s.sessionID, req.Payload, s.Algorithms().HostKey, rand)
+			if err != nil {
+				req.Reply(false, nil)
+			} else {
+				req.Reply(true, sigs)
+			}
+			return true
+		}
+		return false
+	}
+}
+
+// proveHostKeys returns the signatures of the keys requested in payload,
+// which must all be in keys. hostKeyAlgo is the host key algorithm of the
+// key exchange.
+func proveHostKeys(keys []Signer, sessionID, payload []byte, hostKeyAlgo string, rand io.Reader) ([]byte, error) {
+	var sigs []byte
+	for len(payload) > 0 {
+		blob, rest, ok := parseString(payload)
+		if !ok {
+			return nil, errShortRead
+		}
+		payload = rest
+		var signer Signer
+		for _, k := range keys {
+			if string(k.PublicKey().Marshal()) == string(blob) {
+				signer = k
+				break
+			}
+		}
+		if signer == nil {
+			return nil, errors.New("ssh: proof requested for unknown host key")
+		}
+		// Like OpenSSH, sign with RSA keys using the algorithm of the key
+		// exchange if it is an RSA one, which the client then expects.
+		// Otherwise any is accepted, so pick the strongest.
+		algo := signer.PublicKey().Type()
+		if algo == KeyAlgoRSA {
+			switch kexAlgo := underlyingAlgo(hostKeyAlgo); kexAlgo {
+			case KeyAlgoRSA, KeyAlgoRSASHA256, KeyAlgoRSASHA512:
+				algo = kexAlgo
+			default:
+				algo = KeyAlgoRSASHA512
+			}
+		}
+		as := pickHostKey([]Signer{signer}, algo)
+		if as == nil {
+			as = algorithmSignerWrapper{signer}
+			algo = signer.PublicKey().Type()
+		}
+		data := Marshal(&hostKeysProofData{hostKeysProveRequest, sessionID, blob})
+		sig, err := signAndMarshal(as, rand, data, algo)
+		if err != nil {
+			return nil, err
+		}
+		sigs = appendString(sigs, string(sig))
+	}
+	return sigs, nil
+}
+
+// HostKeysCallback is the function type used by the client to receive the
+// host keys announced by a server. See ClientConfig.HostKeysCallback.
+type HostKeysCallback func(hostname string, remote net.Addr, keys []PublicKey)
+
+// handleHostKeys returns a channel of the requests of in, except for the
+// host key announcements, whose keys are passed to callback once the
+// server proved that it holds their private keys.
+func (c *connection) handleHostKeys(in <-chan *Request, hostname string, callback HostKeysCallback) <-chan *Request {
+	out := make(chan *Request, chanSize)
+	go func() {
+		defer close(out)
+		for req := range in {
+			if req.Type != hostKeysRequest {
+				out <- req
+				continue
+			}
+			req.Reply(false, nil)
+			keys, err := parseHostKeys(req.Payload)
+			if err != nil || len(keys) == 0 {
+				continue
+			}
+			go func() {
+				if keys := c.verifyHostKeys(keys); len(keys) > 0 {
+					callback(hostname, c.RemoteAddr(), keys)
+				}
+			}()
+		}
+	}()
+	return out
+}
+
+func parseHostKeys(payload []byte) ([]PublicKey, error) {
+	var keys []PublicKey
+	for len(payload) > 0 {
+		blob, rest, ok := parseString(payload)
+		if !ok {
+			return nil, errShortRead
+		}
+		payload = rest
+		key, err := ParsePublicKey(blob)
+		if err != nil {
+			// Skip the keys of unsupported types.
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// verifyHostKeys asks the server to prove that it holds the private keys of
+// keys, and returns the keys it proved, or nil if it failed to.
+func (c *connection) verifyHostKeys(keys []PublicKey) []PublicKey {
+	var payload []byte
+	for _, k := range keys {
+		payload = appendString(payload, string(k.Marshal()))
+	}
+	ok, reply, err := c.SendRequest(hostKeysProveRequest, true, payload)
+	if err != nil || !ok {
+		return nil
+	}
+	for _, k := range keys {
+		blob, rest, ok := parseString(reply)
+		if !ok {
+			return nil
+		}
+		reply = rest
+		sig, rest, ok := parseSignatureBody(blob)
+		if !ok || len(rest) > 0 {
+			return nil
+		}
+		data := Marshal(&hostKeysProofData{hostKeysProveRequest, c.sessionID, k.Marshal()})
+		if err := k.Verify(data, sig); err != nil {
+			return nil
+		}
+	}
+	if len(reply) > 0 {
+		return nil
+	}
+	return keys
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestServerConn runs a server with serverConf on one end of a pipe and
+// returns the client connected to it with clientConf.
+func newTestServerConn(t *testing.T, serverConf *ServerConfig, clientConf *ClientConfig) (Conn, <-chan NewChannel, <-chan *Request) {
+	t.Helper()
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	t.Cleanup(func() { c1.Close(); c2.Close() })
+	go func() {
+		_, chans, reqs, err := NewServerConn(c1, serverConf)
+		if err != nil {
+			return
+		}
+		go DiscardRequests(reqs)
+		for ch := range chans {
+			ch.Accept()
+		}
+	}()
+	clientConf.User = "testuser"
+	clientConf.HostKeyCallback = InsecureIgnoreHostKey()
+	conn, chans, reqs, err := NewClientConn(c2, "example.com:22", clientConf)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, chans, reqs
+}
+
+func TestHostKeysAnnouncement(t *testing.T) {
+	serverConf := &ServerConfig{
+		NoClientAuth:     true,
+		AnnounceHostKeys: true,
+		ExtraHostKeys:    []Signer{testSigners["ed25519"]},
+	}
+	serverConf.AddHostKey(testSigners["rsa"])
+	serverConf.AddHostKey(testSigners["ecdsa"])
+
+	type announcement struct {
+		hostname string
+		keys     []PublicKey
+	}
+	announced := make(chan announcement, 1)
+	clientConf := &ClientConfig{
+		HostKeysCallback: func(hostname string, remote net.Addr, keys []PublicKey) {
+			announced <- announcement{hostname, keys}
+		},
+	}
+	newTestServerConn(t, serverConf, clientConf)
+
+	select {
+	case a := <-announced:
+		if a.hostname != "example.com:22" {
+			t.Errorf("got hostname %q, want example.com:22", a.hostname)
+		}
+		want := []Signer{testSigners["rsa"], testSigners["ecdsa"], testSigners["ed25519"]}
+		if len(a.keys) != len(want) {
+			t.Fatalf("got %d keys, want %d", len(a.keys), len(want))
+		}
+		for i, k := range a.keys {
+			if !bytes.Equal(k.Marshal(), want[i].PublicKey().Marshal()) {
+				t.Errorf("key %d: got %s, want %s", i, k.Type(), want[i].PublicKey().Type())
+			}
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no host keys announced")
+	}
+}
+
+func TestHostKeysProof(t *testing.T) {
+	keys := []Signer{testSigners["rsa"], testSigners["ed25519"]}
+	sessionID := []byte("session")
+	var payload []byte
+	var pubs []PublicKey
+	for _, k := range keys {
+		payload = appendString(payload, string(k.PublicKey().Marshal()))
+		pubs = append(pubs, k.PublicKey())
+	}
+	for _, tt := range []struct {
+		hostKeyAlgo, want string
+	}{
+		{KeyAlgoED25519, KeyAlgoRSASHA512},
+		{KeyAlgoRSASHA256, KeyAlgoRSASHA256},
+		{CertAlgoRSASHA256v01, KeyAlgoRSASHA256},
+		{KeyAlgoRSASHA512, KeyAlgoRSASHA512},
+		{KeyAlgoRSA, KeyAlgoRSA},
+	} {
+		checkHostKeysProof(t, keys, pubs, sessionID, payload, tt.hostKeyAlgo, tt.want)
+	}
+
+	// Proofs are only given for the announced keys.
+	other := appendString(nil, string(testSigners["ecdsa"].PublicKey().Marshal()))
+	if _, err := proveHostKeys(keys, sessionID, other, KeyAlgoED25519, rand.Reader); err == nil {
+		t.Error("proveHostKeys signed with a key that wasn't announced")
+	}
+}
+
+// checkHostKeysProof checks the proofs of keys, whose RSA signatures must
+// use rsaAlgo if the key exchange used hostKeyAlgo.
+func checkHostKeysProof(t *testing.T, keys []Signer, pubs []PublicKey, sessionID, payload []byte, hostKeyAlgo, rsaAlgo string) {
+	t.Helper()
+	sigs, err := proveHostKeys(keys, sessionID, payload, hostKeyAlgo, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range pubs {
+		blob, rest, ok := parseString(sigs)
+		if !ok {
+			t.Fatalf("signature %d missing", i)
+		}
+		sigs = rest
+		sig, _, ok := parseSignatureBody(blob)
+		if !ok {
+			t.Fatalf("signature %d invalid", i)
+		}
+		if k.Type() == KeyAlgoRSA && sig.Format != rsaAlgo {
+			t.Errorf("%s key exchange: got RSA signature format %q, want %q", hostKeyAlgo, sig.Format, rsaAlgo)
+		}
+		data := Marshal(&hostKeysProofData{hostKeysProveRequest, sessionID, k.Marshal()})
+		if err := k.Verify(data, sig); err != nil {
+			t.Errorf("%s key exchange: signature %d: %v", hostKeyAlgo, i, err)
+		}
+	}
+}
+
+func TestNoMoreSessions(t *testing.T) {
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+	conn, _, reqs := newTestServerConn(t, serverConf, &ClientConfig{})
+	go DiscardRequests(reqs)
+
+	ch, _, err := conn.OpenChannel("session", nil)
+	if err != nil {
+		t.Fatalf("OpenChannel before no-more-sessions: %v", err)
+	}
+	ch.Close()
+	if ok, _, err := conn.SendRequest(noMoreSessionsRequest, true, nil); err != nil || !ok {
+		t.Fatalf("no-more-sessions request: %v, %v", ok, err)
+	}
+	if _, _, err := conn.OpenChannel("session", nil); err == nil {
+		t.Error("OpenChannel succeeded after no-more-sessions")
+	}
+	if err := conn.Wait(); err == nil {
+		t.Error("connection not aborted")
+	}
+}
@@ -0,0 +1,768 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sntrup761 implements the Streamlined NTRU Prime 761 key
+// encapsulation mechanism, as used by the sntrup761x25519-sha512 SSH key
+// exchange method.
+//
+// This is a port of the reference implementation from SUPERCOP, which is
+// also the one included in OpenSSH. Like the original, all operations on
+// secret values are meant to run in constant time. See
+// https://ntruprime.cr.yp.to/.
+package sntrup761
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	p = 761
+	q = 4591
+	w = 286
+
+	q12 = (q - 1) / 2
+)
+
+const (
+	hashSize    = 32
+	smallSize   = (p + 3) / 4
+	rqSize      = 1158
+	roundedSize = 1007
+	confirmSize = hashSize
+
+	// PublicKeySize is the size of an encoded public key.
+	PublicKeySize = rqSize
+
+	// PrivateKeySize is the size of an encoded private key, which includes
+	// the public key.
+	PrivateKeySize = 2*smallSize + PublicKeySize + smallSize + hashSize
+
+	// CiphertextSize is the size of an encapsulated key.
+	CiphertextSize = roundedSize + confirmSize
+
+	// SharedKeySize is the size of the shared key.
+	SharedKeySize = hashSize
+)
+
+// ----- constant-time arithmetic
+
+// uint32DivMod returns x / m and x % m for 0 < m < 16384.
+func uint32DivMod(x uint32, m uint16) (uint32, uint16) {
+	v := uint32(0x80000000) / uint32(m)
+	m32 := uint32(m)
+
+	qpart := uint32(uint64(x) * uint64(v) >> 31)
+	x -= qpart * m32
+	quo := qpart
+
+	qpart = uint32(uint64(x) * uint64(v) >> 31)
+	x -= qpart * m32
+	quo += qpart
+
+	x -= m32
+	quo++
+	mask := -(x >> 31)
+	x += mask & m32
+	quo += mask
+
+	return quo, uint16(x)
+}
+
+// int32Mod returns x mod m, in the range [0, m), for 0 < m < 16384.
+func int32Mod(x int32, m uint16) uint16 {
+	_, r := uint32DivMod(0x80000000+uint32(x), m)
+	_, r2 := uint32DivMod(0x80000000, m)
+	r -= r2
+	mask := -(r >> 15)
+	r += mask & m
+	return r
+}
+
+// nonzeroMask returns -1 if x != 0, and 0 otherwise.
+func nonzeroMask(x int16) int32 {
+	v := uint32(uint16(x))
+	v = -v
+	v >>= 31
+	return -int32(v)
+}
+
+// negativeMask returns -1 if x < 0, and 0 otherwise.
+func negativeMask(x int16) int32 {
+	return -int32(uint16(x) >> 15)
+}
+
+// ----- arithmetic mod 3, represented as -1, 0, 1
+
+func f3Freeze(x int16) int8 {
+	return int8(int32Mod(int32(x)+1, 3)) - 1
+}
+
+// ----- arithmetic mod q, represented as -q12...q12
+
+func fqFreeze(x int32) int16 {
+	return int16(int32Mod(x+q12, q)) - q12
+}
+
+func fqRecip(a1 int16) int16 {
+	ai := a1
+	for i := 1; i < q-2; i++ {
+		ai = fqFreeze(int32(a1) * int32(ai))
+	}
+	return ai
+}
+
+// ----- small polynomials
+
+// weightwMask returns 0 if r has weight w, and -1 otherwise.
+func weightwMask(r *[p]int8) int32 {
+	weight := 0
+	for i := range r {
+		weight += int(r[i] & 1)
+	}
+	return nonzeroMask(int16(weight - w))
+}
+
+func r3FromRq(out *[p]int8, r *[p]int16) {
+	for i := range r {
+		out[i] = f3Freeze(r[i])
+	}
+}
+
+// r3Mult sets h = f*g in the ring R3.
+func r3Mult(h, f, g *[p]int8) {
+	var fg [p + p - 1]int8
+
+	for i := 0; i < p; i++ {
+		var result int8
+		for j := 0; j <= i; j++ {
+			result = f3Freeze(int16(result) + int16(f[j])*int16(g[i-j]))
+		}
+		fg[i] = result
+	}
+	for i := p; i < p+p-1; i++ {
+		var result int8
+		for j := i - p + 1; j < p; j++ {
+			result = f3Freeze(int16(result) + int16(f[j])*int16(g[i-j]))
+		}
+		fg[i] = result
+	}
+
+	for i := p + p - 2; i >= p; i-- {
+		fg[i-p] = f3Freeze(int16(fg[i-p]) + int16(fg[i]))
+		fg[i-p+1] = f3Freeze(int16(fg[i-p+1]) + int16(fg[i]))
+	}
+
+	copy(h[:], fg[:p])
+}
+
+// r3Recip sets out = 1/in in the ring R3. It returns 0 on success, and -1
+// if in is not invertible.
+func r3Recip(out, in *[p]int8) int32 {
+	var f, g, v, r [p + 1]int8
+
+	r[0] = 1
+	f[0] = 1
+	f[p-1] = -1
+	f[p] = -1
+	for i := 0; i < p; i++ {
+		g[p-1-i] = in[i]
+	}
+
+	delta := int32(1)
+
+	for loop := 0; loop < 2*p-1; loop++ {
+		copy(v[1:], v[:p])
+		v[0] = 0
+
+		sign := -g[0] * f[0]
+		swap := int8(negativeMask(int16(-delta)) & nonzeroMask(int16(g[0])))
+		delta ^= int32(swap) & (delta ^ -delta)
+		delta++
+
+		for i := range f {
+			t := swap & (f[i] ^ g[i])
+			f[i] ^= t
+			g[i] ^= t
+			t = swap & (v[i] ^ r[i])
+			v[i] ^= t
+			r[i] ^= t
+		}
+
+		for i := range g {
+			g[i] = f3Freeze(int16(g[i]) + int16(sign)*int16(f[i]))
+		}
+		for i := range r {
+			r[i] = f3Freeze(int16(r[i]) + int16(sign)*int16(v[i]))
+		}
+
+		copy(g[:p], g[1:])
+		g[p] = 0
+	}
+
+	sign := f[0]
+	for i := 0; i < p; i++ {
+		out[i] = sign * v[p-1-i]
+	}
+
+	return nonzeroMask(int16(delta))
+}
+
+// ----- polynomials mod q
+
+// rqMultSmall sets h = f*g in the ring Rq.
+func rqMultSmall(h, f *[p]int16, g *[p]int8) {
+	var fg [p + p - 1]int16
+
+	for i := 0; i < p; i++ {
+		var result int16
+		for j := 0; j <= i; j++ {
+			result = fqFreeze(int32(result) + int32(f[j])*int32(g[i-j]))
+		}
+		fg[i] = result
+	}
+	for i := p; i < p+p-1; i++ {
+		var result int16
+		for j := i - p + 1; j < p; j++ {
+			result = fqFreeze(int32(result) + int32(f[j])*int32(g[i-j]))
+		}
+		fg[i] = result
+	}
+
+	for i := p + p - 2; i >= p; i-- {
+		fg[i-p] = fqFreeze(int32(fg[i-p]) + int32(fg[i]))
+		fg[i-p+1] = fqFreeze(int32(fg[i-p+1]) + int32(fg[i]))
+	}
+
+	copy(h[:], fg[:p])
+}
+
+// rqMult3 sets h = 3f in Rq.
+func rqMult3(h, f *[p]int16) {
+	for i := range f {
+		h[i] = fqFreeze(3 * int32(f[i]))
+	}
+}
+
+// rqRecip3 sets out = 1/(3*in) in Rq. It returns 0 on success, and -1 if in
+// is not invertible.
+func rqRecip3(out *[p]int16, in *[p]int8) int32 {
+	var f, g, v, r [p + 1]int16
+
+	r[0] = fqRecip(3)
+	f[0] = 1
+	f[p-1] = -1
+	f[p] = -1
+	for i := 0; i < p; i++ {
+		g[p-1-i] = int16(in[i])
+	}
+
+	delta := int32(1)
+
+	for loop := 0; loop < 2*p-1; loop++ {
+		copy(v[1:], v[:p])
+		v[0] = 0
+
+		swap := int16(negativeMask(int16(-delta)) & nonzeroMask(g[0]))
+		delta ^= int32(swap) & (delta ^ -delta)
+		delta++
+
+		for i := range f {
+			t := swap & (f[i] ^ g[i])
+			f[i] ^= t
+			g[i] ^= t
+			t = swap & (v[i] ^ r[i])
+			v[i] ^= t
+			r[i] ^= t
+		}
+
+		f0 := int32(f[0])
+		g0 := int32(g[0])
+		for i := range g {
+			g[i] = fqFreeze(f0*int32(g[i]) - g0*int32(f[i]))
+		}
+		for i := range r {
+			r[i] = fqFreeze(f0*int32(r[i]) - g0*int32(v[i]))
+		}
+
+		copy(g[:p], g[1:])
+		g[p] = 0
+	}
+
+	scale := int32(fqRecip(f[0]))
+	for i := 0; i < p; i++ {
+		out[i] = fqFreeze(scale * int32(v[p-1-i]))
+	}
+
+	return nonzeroMask(int16(delta))
+}
+
+func round(out, a *[p]int16) {
+	for i := range a {
+		out[i] = a[i] - int16(f3Freeze(a[i]))
+	}
+}
+
+// ----- sorting to generate short polynomials
+
+// minMax sets a, b to min(a, b), max(a, b) in constant time.
+func minMax(a, b *int32) {
+	ab := *b ^ *a
+	c := *b - *a
+	c ^= ab & (c ^ *b)
+	c >>= 31
+	c &= ab
+	*a ^= c
+	*b ^= c
+}
+
+// sortInt32 sorts x in constant time, with the djbsort sorting network.
+func sortInt32(x []int32) {
+	n := len(x)
+	if n < 2 {
+		return
+	}
+	top := 1
+	for top < n-top {
+		top += top
+	}
+
+	for pp := top; pp >= 1; pp >>= 1 {
+		i := 0
+		for i+2*pp <= n {
+			for j := i; j < i+pp; j++ {
+				minMax(&x[j], &x[j+pp])
+			}
+			i += 2 * pp
+		}
+		for j := i; j < n-pp; j++ {
+			minMax(&x[j], &x[j+pp])
+		}
+
+		i = 0
+		j := 0
+	merge:
+		for qq := top; qq > pp; qq >>= 1 {
+			if j != i {
+				for {
+					if j == n-qq {
+						continue merge
+					}
+					a := x[j+pp]
+					for r := qq; r > pp; r >>= 1 {
+						minMax(&a, &x[j+r])
+					}
+					x[j+pp] = a
+					j++
+					if j == i+pp {
+						i += 2 * pp
+						break
+					}
+				}
+			}
+			for i+pp <= n-qq {
+				for j = i; j < i+pp; j++ {
+					a := x[j+pp]
+					for r := qq; r > pp; r >>= 1 {
+						minMax(&a, &x[j+r])
+					}
+					x[j+pp] = a
+				}
+				i += 2 * pp
+			}
+			for j = i; j < n-qq; j++ {
+				a := x[j+pp]
+				for r := qq; r > pp; r >>= 1 {
+					minMax(&a, &x[j+r])
+				}
+				x[j+pp] = a
+			}
+		}
+	}
+}
+
+func sortUint32(x []uint32) {
+	y := make([]int32, len(x))
+	for i := range x {
+		y[i] = int32(x[i] ^ 0x80000000)
+	}
+	sortInt32(y)
+	for i := range x {
+		x[i] = uint32(y[i]) ^ 0x80000000
+	}
+}
+
+func shortFromList(out *[p]int8, in []uint32) {
+	var l [p]uint32
+	for i := 0; i < w; i++ {
+		l[i] = in[i] &^ 1
+	}
+	for i := w; i < p; i++ {
+		l[i] = in[i]&^2 | 1
+	}
+	sortUint32(l[:])
+	for i := range l {
+		out[i] = int8(l[i]&3) - 1
+	}
+}
+
+// ----- hashing
+
+// hashPrefix returns the first 32 bytes of SHA-512(b || in).
+func hashPrefix(b byte, in ...[]byte) [hashSize]byte {
+	h := sha512.New()
+	h.Write([]byte{b})
+	for _, in := range in {
+		h.Write(in)
+	}
+	var out [hashSize]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// ----- randomness
+
+func random32(rand io.Reader) ([]uint32, error) {
+	var buf [4 * p]byte
+	if _, err := io.ReadFull(rand, buf[:]); err != nil {
+		return nil, err
+	}
+	l := make([]uint32, p)
+	for i := range l {
+		l[i] = binary.LittleEndian.Uint32(buf[4*i:])
+	}
+	return l, nil
+}
+
+func shortRandom(rand io.Reader, out *[p]int8) error {
+	l, err := random32(rand)
+	if err != nil {
+		return err
+	}
+	shortFromList(out, l)
+	return nil
+}
+
+func smallRandom(rand io.Reader, out *[p]int8) error {
+	l, err := random32(rand)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		out[i] = int8((l[i]&0x3fffffff)*3>>30) - 1
+	}
+	return nil
+}
+
+// ----- Streamlined NTRU Prime core
+
+func keyGen(rand io.Reader, h *[p]int16, f, ginv *[p]int8) error {
+	var g [p]int8
+	for {
+		if err := smallRandom(rand, &g); err != nil {
+			return err
+		}
+		if r3Recip(ginv, &g) == 0 {
+			break
+		}
+	}
+	if err := shortRandom(rand, f); err != nil {
+		return err
+	}
+	var finv [p]int16
+	rqRecip3(&finv, f) // always works
+	rqMultSmall(h, &finv, &g)
+	return nil
+}
+
+func encrypt(c *[p]int16, r *[p]int8, h *[p]int16) {
+	var hr [p]int16
+	rqMultSmall(&hr, h, r)
+	round(c, &hr)
+}
+
+func decrypt(r *[p]int8, c *[p]int16, f, ginv *[p]int8) {
+	var cf, cf3 [p]int16
+	var e, ev [p]int8
+
+	rqMultSmall(&cf, c, f)
+	rqMult3(&cf3, &cf)
+	r3FromRq(&e, &cf3)
+	r3Mult(&ev, &e, ginv)
+
+	mask := int8(weightwMask(&ev)) // 0 if weight w, else -1
+	for i := 0; i < w; i++ {
+		r[i] = ((ev[i] ^ 1) &^ mask) ^ 1
+	}
+	for i := w; i < p; i++ {
+		r[i] = ev[i] &^ mask
+	}
+}
+
+// ----- encoding small polynomials
+
+func smallEncode(s []byte, f *[p]int8) {
+	for i := 0; i < p/4; i++ {
+		x := byte(f[4*i] + 1)
+		x += byte(f[4*i+1]+1) << 2
+		x += byte(f[4*i+2]+1) << 4
+		x += byte(f[4*i+3]+1) << 6
+		s[i] = x
+	}
+	s[p/4] = byte(f[p-1] + 1)
+}
+
+func smallDecode(f *[p]int8, s []byte) {
+	for i := 0; i < p/4; i++ {
+		x := s[i]
+		f[4*i] = int8(x&3) - 1
+		x >>= 2
+		f[4*i+1] = int8(x&3) - 1
+		x >>= 2
+		f[4*i+2] = int8(x&3) - 1
+		x >>= 2
+		f[4*i+3] = int8(x&3) - 1
+	}
+	f[p-1] = int8(s[p/4]&3) - 1
+}
+
+// ----- encoding general polynomials
+
+// encode appends the mixed-radix encoding of r to out, where
+// 0 <= r[i] < m[i] < 16384.
+func encode(out []byte, r, m []uint16) []byte {
+	if len(r) == 1 {
+		rr, mm := r[0], m[0]
+		for mm > 1 {
+			out = append(out, byte(rr))
+			rr >>= 8
+			mm = (mm + 255) >> 8
+		}
+		return out
+	}
+
+	n := len(r)
+	r2 := make([]uint16, (n+1)/2)
+	m2 := make([]uint16, (n+1)/2)
+	i := 0
+	for ; i < n-1; i += 2 {
+		m0 := uint32(m[i])
+		rr := uint32(r[i]) + uint32(r[i+1])*m0
+		mm := uint32(m[i+1]) * m0
+		for mm >= 16384 {
+			out = append(out, byte(rr))
+			rr >>= 8
+			mm = (mm + 255) >> 8
+		}
+		r2[i/2] = uint16(rr)
+		m2[i/2] = uint16(mm)
+	}
+	if i < n {
+		r2[i/2] = r[i]
+		m2[i/2] = m[i]
+	}
+	return encode(out, r2, m2)
+}
+
+// decode is the inverse of encode. It reduces invalid inputs into range.
+func decode(out []uint16, s []byte, m []uint16) {
+	if len(m) == 1 {
+		switch {
+		case m[0] == 1:
+			out[0] = 0
+		case m[0] <= 256:
+			_, out[0] = uint32DivMod(uint32(s[0]), m[0])
+		default:
+			_, out[0] = uint32DivMod(uint32(s[0])+uint32(s[1])<<8, m[0])
+		}
+		return
+	}
+
+	n := len(m)
+	r2 := make([]uint16, (n+1)/2)
+	m2 := make([]uint16, (n+1)/2)
+	bottomr := make([]uint16, n/2)
+	bottomt := make([]uint32, n/2)
+	i := 0
+	for ; i < n-1; i += 2 {
+		mm := uint32(m[i]) * uint32(m[i+1])
+		switch {
+		case mm > 256*16383:
+			bottomt[i/2] = 256 * 256
+			bottomr[i/2] = uint16(s[0]) + 256*uint16(s[1])
+			s = s[2:]
+			m2[i/2] = uint16((((mm + 255) >> 8) + 255) >> 8)
+		case mm >= 16384:
+			bottomt[i/2] = 256
+			bottomr[i/2] = uint16(s[0])
+			s = s[1:]
+			m2[i/2] = uint16((mm + 255) >> 8)
+		default:
+			bottomt[i/2] = 1
+			bottomr[i/2] = 0
+			m2[i/2] = uint16(mm)
+		}
+	}
+	if i < n {
+		m2[i/2] = m[i]
+	}
+	decode(r2, s, m2)
+	for i = 0; i < n-1; i += 2 {
+		rr := uint32(bottomr[i/2]) + bottomt[i/2]*uint32(r2[i/2])
+		r1, r0 := uint32DivMod(rr, m[i])
+		_, r1m := uint32DivMod(r1, m[i+1]) // only needed for invalid inputs
+		out[i] = r0
+		out[i+1] = r1m
+	}
+	if i < n {
+		out[i] = r2[i/2]
+	}
+}
+
+func rqEncode(s []byte, r *[p]int16) {
+	var rr, m [p]uint16
+	for i := range r {
+		rr[i] = uint16(r[i] + q12)
+		m[i] = q
+	}
+	copy(s, encode(make([]byte, 0, rqSize), rr[:], m[:]))
+}
+
+func rqDecode(r *[p]int16, s []byte) {
+	var rr, m [p]uint16
+	for i := range m {
+		m[i] = q
+	}
+	decode(rr[:], s, m[:])
+	for i := range r {
+		r[i] = int16(rr[i]) - q12
+	}
+}
+
+func roundedEncode(s []byte, r *[p]int16) {
+	var rr, m [p]uint16
+	for i := range r {
+		rr[i] = uint16((int32(r[i]) + q12) * 10923 >> 15)
+		m[i] = (q + 2) / 3
+	}
+	copy(s, encode(make([]byte, 0, roundedSize), rr[:], m[:]))
+}
+
+func roundedDecode(r *[p]int16, s []byte) {
+	var rr, m [p]uint16
+	for i := range m {
+		m[i] = (q + 2) / 3
+	}
+	decode(rr[:], s, m[:])
+	for i := range r {
+		r[i] = int16(rr[i])*3 - q12
+	}
+}
+
+// ----- key encapsulation
+
+// hide returns the ciphertext and the encoding of r, for the public key pk
+// whose hash is cache.
+func hide(r *[p]int8, pk []byte, cache *[hashSize]byte) (c [CiphertextSize]byte, rEnc [smallSize]byte) {
+	smallEncode(rEnc[:], r)
+
+	var h, ct [p]int16
+	rqDecode(&h, pk)
+	encrypt(&ct, r, &h)
+	roundedEncode(c[:roundedSize], &ct)
+
+	// HashConfirm(r, pk).
+	x := hashPrefix(3, rEnc[:])
+	confirm := hashPrefix(2, x[:], cache[:])
+	copy(c[roundedSize:], confirm[:])
+	return c, rEnc
+}
+
+func hashSession(b byte, y, z []byte) [hashSize]byte {
+	x := hashPrefix(3, y)
+	return hashPrefix(b, x[:], z)
+}
+
+// GenerateKey returns a new public and private key pair, using randomness
+// from rand.
+func GenerateKey(rand io.Reader) (publicKey, privateKey []byte, err error) {
+	var h [p]int16
+	var f, v [p]int8
+	if err := keyGen(rand, &h, &f, &v); err != nil {
+		return nil, nil, err
+	}
+
+	sk := make([]byte, PrivateKeySize)
+	smallEncode(sk, &f)
+	smallEncode(sk[smallSize:], &v)
+	pk := sk[2*smallSize : 2*smallSize+PublicKeySize]
+	rqEncode(pk, &h)
+	rho := sk[2*smallSize+PublicKeySize : 2*smallSize+PublicKeySize+smallSize]
+	if _, err := io.ReadFull(rand, rho); err != nil {
+		return nil, nil, err
+	}
+	cache := hashPrefix(4, pk)
+	copy(sk[PrivateKeySize-hashSize:], cache[:])
+
+	return append([]byte(nil), pk...), sk, nil
+}
+
+// Encapsulate generates a shared key and its encapsulation for publicKey,
+// using randomness from rand.
+func Encapsulate(rand io.Reader, publicKey []byte) (ciphertext, sharedKey []byte, err error) {
+	if len(publicKey) != PublicKeySize {
+		return nil, nil, errors.New("sntrup761: invalid public key size")
+	}
+
+	var r [p]int8
+	if err := shortRandom(rand, &r); err != nil {
+		return nil, nil, err
+	}
+	cache := hashPrefix(4, publicKey)
+	c, rEnc := hide(&r, publicKey, &cache)
+	k := hashSession(1, rEnc[:], c[:])
+
+	return c[:], k[:], nil
+}
+
+// Decapsulate returns the shared key encapsulated in ciphertext. As usual
+// for this kind of KEM, an invalid ciphertext results in a pseudorandom
+// shared key rather than an error.
+func Decapsulate(privateKey, ciphertext []byte) (sharedKey []byte, err error) {
+	if len(privateKey) != PrivateKeySize {
+		return nil, errors.New("sntrup761: invalid private key size")
+	}
+	if len(ciphertext) != CiphertextSize {
+		return nil, errors.New("sntrup761: invalid ciphertext size")
+	}
+
+	pk := privateKey[2*smallSize : 2*smallSize+PublicKeySize]
+	rho := privateKey[2*smallSize+PublicKeySize : 2*smallSize+PublicKeySize+smallSize]
+	var cache [hashSize]byte
+	copy(cache[:], privateKey[PrivateKeySize-hashSize:])
+
+	var f, v, r [p]int8
+	var c [p]int16
+	smallDecode(&f, privateKey)
+	smallDecode(&v, privateKey[smallSize:])
+	roundedDecode(&c, ciphertext)
+	decrypt(&r, &c, &f, &v)
+
+	cnew, rEnc := hide(&r, pk, &cache)
+
+	// mask is 0 if the ciphertexts match, and -1 otherwise.
+	var differentBits uint16
+	for i := range cnew {
+		differentBits |= uint16(ciphertext[i] ^ cnew[i])
+	}
+	mask := (1 & ((int32(differentBits) - 1) >> 8)) - 1
+	for i := range rEnc {
+		rEnc[i] ^= byte(mask) & (rEnc[i] ^ rho[i])
+	}
+	k := hashSession(byte(1+mask), rEnc[:], ciphertext)
+
+	return k[:], nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sntrup761
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	mathrand "math/rand"
+	"sort"
+	"testing"
+)
+
+func TestEncapsulate(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pk) != PublicKeySize || len(sk) != PrivateKeySize {
+		t.Fatalf("got key sizes %d and %d", len(pk), len(sk))
+	}
+	for i := 0; i < 3; i++ {
+		ct, k, err := Encapsulate(rand.Reader, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ct) != CiphertextSize || len(k) != SharedKeySize {
+			t.Fatalf("got ciphertext size %d and shared key size %d", len(ct), len(k))
+		}
+		k2, err := Decapsulate(sk, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(k, k2) {
+			t.Fatalf("Decapsulate = %x, want %x", k2, k)
+		}
+
+		ct[0] ^= 1
+		k3, err := Decapsulate(sk, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(k, k3) {
+			t.Error("modified ciphertext decapsulated to the same shared key")
+		}
+	}
+}
+
+func TestInvalidSizes(t *testing.T) {
+	if _, _, err := Encapsulate(rand.Reader, make([]byte, PublicKeySize-1)); err == nil {
+		t.Error("Encapsulate accepted a short public key")
+	}
+	if _, err := Decapsulate(make([]byte, PrivateKeySize), make([]byte, CiphertextSize+1)); err == nil {
+		t.Error("Decapsulate accepted a long ciphertext")
+	}
+}
+
+func TestEncodeSizes(t *testing.T) {
+	var r [p]int16
+	for i := range r {
+		r[i] = q12
+	}
+	var rr, m [p]uint16
+	for i := range r {
+		rr[i] = uint16(r[i] + q12)
+		m[i] = q
+	}
+	if n := len(encode(nil, rr[:], m[:])); n != rqSize {
+		t.Errorf("Rq encoding is %d bytes, want %d", n, rqSize)
+	}
+	for i := range m {
+		rr[i] = 0
+		m[i] = (q + 2) / 3
+	}
+	if n := len(encode(nil, rr[:], m[:])); n != roundedSize {
+		t.Errorf("rounded encoding is %d bytes, want %d", n, roundedSize)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	var r, got [p]int16
+	for i := range r {
+		r[i] = int16(mathrand.Intn(q)) - q12
+	}
+	buf := make([]byte, rqSize)
+	rqEncode(buf, &r)
+	rqDecode(&got, buf)
+	if got != r {
+		t.Error("Rq encoding does not round trip")
+	}
+
+	for i := range r {
+		r[i] = int16(mathrand.Intn((q+2)/3))*3 - q12
+	}
+	buf = make([]byte, roundedSize)
+	roundedEncode(buf, &r)
+	roundedDecode(&got, buf)
+	if got != r {
+		t.Error("rounded encoding does not round trip")
+	}
+}
+
+func TestSort(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 7, 64, 100, p} {
+		x := make([]uint32, n)
+		for i := range x {
+			x[i] = mathrand.Uint32()
+			if i%3 == 0 {
+				x[i] &= 7
+			}
+		}
+		want := append([]uint32(nil), x...)
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		sortUint32(x)
+		for i := range x {
+			if x[i] != want[i] {
+				t.Fatalf("n = %d: sorted[%d] = %d, want %d", n, i, x[i], want[i])
+			}
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	for _, x := range []int32{-1 << 24, -q - 1, -q, -3, -1, 0, 1, 2, 3, q12, q, 1 << 24} {
+		want := big.NewInt(int64(x))
+		want.Mod(want, big.NewInt(q))
+		if want.Int64() > q12 {
+			want.Sub(want, big.NewInt(q))
+		}
+		if got := fqFreeze(x); int64(got) != want.Int64() {
+			t.Errorf("fqFreeze(%d) = %d, want %d", x, got, want)
+		}
+	}
+	for x := int16(-9); x <= 9; x++ {
+		want := ((int(x)%3)+4)%3 - 1
+		if got := f3Freeze(x); int(got) != want {
+			t.Errorf("f3Freeze(%d) = %d, want %d", x, got, want)
+		}
+	}
+	if r := fqFreeze(3 * int32(fqRecip(3))); r != 1 {
+		t.Errorf("3 * fqRecip(3) = %d, want 1", r)
+	}
+}
+
+func BenchmarkGenerateKey(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		GenerateKey(rand.Reader)
+	}
+}
+
+func BenchmarkEncapsulate(b *testing.B) {
+	pk, _, _ := GenerateKey(rand.Reader)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Encapsulate(rand.Reader, pk)
+	}
+}
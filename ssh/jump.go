@@ -0,0 +1,89 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// JumpSpec describes one of the hosts of a connection made by DialJump.
+type JumpSpec struct {
+	// Addr is the host:port address of the SSH server. For all but the
+	// first host, it is resolved and dialed by the previous host.
+	Addr string
+
+	// Config is used for the SSH connection to the host. Its
+	// HostKeyCallback is called with Addr as the hostname.
+	Config *ClientConfig
+}
+
+// DialJump connects to the SSH server of the last of targets through the
+// preceding ones, like the -J option of OpenSSH: the first target is dialed
+// over TCP, and each following one through a "direct-tcpip" channel of the
+// connection to the previous target. Each host is authenticated with the
+// Config of its own JumpSpec.
+//
+// Closing the returned Client also closes the connections to the jump
+// hosts.
+func DialJump(targets ...JumpSpec) (*Client, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("ssh: no target for DialJump")
+	}
+	var via *Client
+	for i, target := range targets {
+		c, err := dialJumpHost(via, target)
+		if err != nil {
+			if via != nil {
+				via.Close()
+			}
+			if i > 0 {
+				err = fmt.Errorf("ssh: jump to %s through %s: %w", target.Addr, targets[i-1].Addr, err)
+			}
+			return nil, err
+		}
+		via = c
+	}
+	return via, nil
+}
+
+// dialJumpHost connects to target through via, or over TCP if via is nil.
+func dialJumpHost(via *Client, target JumpSpec) (*Client, error) {
+	if via == nil {
+		return Dial("tcp", target.Addr, target.Config)
+	}
+
+	ctx := context.Background()
+	if target.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, target.Config.Timeout)
+		defer cancel()
+	}
+	conn, err := via.DialContext(ctx, "tcp", target.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn = &jumpConn{Conn: conn, via: via}
+	c, chans, reqs, err := NewClientConn(conn, target.Addr, target.Config)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c, chans, reqs), nil
+}
+
+// jumpConn is a connection tunneled through the jump host via, which is
+// closed along with it.
+type jumpConn struct {
+	net.Conn
+	via *Client
+}
+
+func (c *jumpConn) Close() error {
+	err := c.Conn.Close()
+	c.via.Close()
+	return err
+}
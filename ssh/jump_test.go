@@ -0,0 +1,154 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// startJumpServer starts an SSH server on a local TCP port, which forwards
+// direct-tcpip channels to their destination. It returns its address.
+func startJumpServer(t *testing.T, hostKey Signer) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		l.Close()
+		wg.Wait()
+	})
+
+	conf := &ServerConfig{NoClientAuth: true}
+	conf.AddHostKey(hostKey)
+	serve := func(c net.Conn) {
+		defer c.Close()
+		_, chans, reqs, err := NewServerConn(c, conf)
+		if err != nil {
+			return
+		}
+		go DiscardRequests(reqs)
+		for newCh := range chans {
+			var msg struct {
+				Raddr string
+				Rport uint32
+				Laddr string
+				Lport uint32
+			}
+			if newCh.ChannelType() != "direct-tcpip" || Unmarshal(newCh.ExtraData(), &msg) != nil {
+				newCh.Reject(UnknownChannelType, "unknown channel type")
+				continue
+			}
+			dst, err := net.Dial("tcp", net.JoinHostPort(msg.Raddr, fmt.Sprint(msg.Rport)))
+			if err != nil {
+				newCh.Reject(ConnectionFailed, err.Error())
+				continue
+			}
+			ch, reqs, err := newCh.Accept()
+			if err != nil {
+				dst.Close()
+				continue
+			}
+			go DiscardRequests(reqs)
+			go func() {
+				io.Copy(dst, ch)
+				dst.Close()
+			}()
+			go func() {
+				io.Copy(ch, dst)
+				ch.Close()
+			}()
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serve(c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestDialJump(t *testing.T) {
+	keys := []string{"rsa", "ecdsa", "ed25519"}
+	var targets []JumpSpec
+	var mu sync.Mutex
+	var checked []string
+	for _, k := range keys {
+		addr := startJumpServer(t, testSigners[k])
+		fixed := FixedHostKey(testPublicKeys[k])
+		targets = append(targets, JumpSpec{
+			Addr: addr,
+			Config: &ClientConfig{
+				User: "testuser",
+				HostKeyCallback: func(hostname string, remote net.Addr, key PublicKey) error {
+					mu.Lock()
+					checked = append(checked, hostname)
+					mu.Unlock()
+					return fixed(hostname, remote, key)
+				},
+			},
+		})
+	}
+
+	client, err := DialJump(targets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checked) != len(targets) {
+		t.Fatalf("host keys of %v checked, want %d hosts", checked, len(targets))
+	}
+	for i := range targets {
+		if checked[i] != targets[i].Addr {
+			t.Errorf("host key %d checked for %s, want %s", i, checked[i], targets[i].Addr)
+		}
+	}
+
+	// The last server can dial the first one, as they all listen locally.
+	conn, err := client.Dial("tcp", targets[0].Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "SSH-" {
+		t.Errorf("got %q, %v through the jump hosts, want SSH-", buf, err)
+	}
+	conn.Close()
+	client.Close()
+}
+
+func TestDialJumpHostKeyMismatch(t *testing.T) {
+	addrs := []string{startJumpServer(t, testSigners["rsa"]), startJumpServer(t, testSigners["ecdsa"])}
+	targets := []JumpSpec{
+		{Addr: addrs[0], Config: &ClientConfig{User: "testuser", HostKeyCallback: FixedHostKey(testPublicKeys["rsa"])}},
+		{Addr: addrs[1], Config: &ClientConfig{User: "testuser", HostKeyCallback: FixedHostKey(testPublicKeys["rsa"])}},
+	}
+	_, err := DialJump(targets...)
+	if err == nil {
+		t.Fatal("DialJump succeeded with a wrong host key for the second host")
+	}
+	if !strings.Contains(err.Error(), addrs[1]) {
+		t.Errorf("error %q does not name the failing host %s", err, addrs[1])
+	}
+
+	if _, err := DialJump(); err == nil {
+		t.Error("DialJump succeeded without targets")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"math/big"
 
 	"github.com/gitpod-io/golang-crypto/curve25519"
+	"github.com/gitpod-io/golang-crypto/ssh/internal/sntrup761"
 )
 
 const (
@@ -30,6 +31,9 @@ const (
 	kexAlgoCurve25519SHA256LibSSH = "curve25519-sha256@libssh.org"
 	kexAlgoCurve25519SHA256       = "curve25519-sha256"
 
+	kexAlgoSNTRUP761x25519SHA512        = "sntrup761x25519-sha512"
+	kexAlgoSNTRUP761x25519SHA512OpenSSH = "sntrup761x25519-sha512@openssh.com"
+
 	// For the following kex only the client half contains a production
 	// ready implementation. The server half only consists of a minimal
 	// implementation to satisfy the automated tests.
@@ -447,6 +451,8 @@ func init() {
 	kexAlgoMap[kexAlgoECDH256] = &ecdh{elliptic.P256()}
 	kexAlgoMap[kexAlgoCurve25519SHA256] = &curve25519sha256{}
 	kexAlgoMap[kexAlgoCurve25519SHA256LibSSH] = &curve25519sha256{}
+	kexAlgoMap[kexAlgoSNTRUP761x25519SHA512] = &hybridKEM{sntrup761KEM{}, crypto.SHA512}
+	kexAlgoMap[kexAlgoSNTRUP761x25519SHA512OpenSSH] = &hybridKEM{sntrup761KEM{}, crypto.SHA512}
 	kexAlgoMap[kexAlgoDHGEXSHA1] = &dhGEXSHA{hashFunc: crypto.SHA1}
 	kexAlgoMap[kexAlgoDHGEXSHA256] = &dhGEXSHA{hashFunc: crypto.SHA256}
 }
@@ -473,6 +479,20 @@ func (kp *curve25519KeyPair) generate(rand io.Reader) error {
 // wrong order.
 var curve25519Zeros [32]byte
 
+// sharedSecret returns the X25519 shared secret with the peer's public value.
+func (kp *curve25519KeyPair) sharedSecret(peerPub []byte) ([]byte, error) {
+	if len(peerPub) != 32 {
+		return nil, errors.New("ssh: peer's curve25519 public value has wrong length")
+	}
+	var pub, secret [32]byte
+	copy(pub[:], peerPub)
+	curve25519.ScalarMult(&secret, &kp.priv, &pub)
+	if subtle.ConstantTimeCompare(secret[:], curve25519Zeros[:]) == 1 {
+		return nil, errors.New("ssh: peer's curve25519 public value has wrong order")
+	}
+	return secret[:], nil
+}
+
 func (kex *curve25519sha256) Client(c packetConn, rand io.Reader, magics *handshakeMagics) (*kexResult, error) {
 	var kp curve25519KeyPair
 	if err := kp.generate(rand); err != nil {
@@ -585,6 +605,178 @@ func (kex *curve25519sha256) Server(c packetConn, rand io.Reader, magics *handsh
 	}, nil
 }
 
+// A kem is a key encapsulation mechanism used by hybridKEM.
+type kem interface {
+	encapsulationKeySize() int
+	ciphertextSize() int
+
+	// generateKey returns a new encapsulation key, and a function that
+	// decapsulates ciphertexts sent for it.
+	generateKey(rand io.Reader) (encapsulationKey []byte, decapsulate func(ciphertext []byte) ([]byte, error), err error)
+
+	encapsulate(rand io.Reader, encapsulationKey []byte) (ciphertext, sharedKey []byte, err error)
+}
+
+// hybridKEM implements the key exchange methods that combine a post-quantum
+// KEM with X25519, such as sntrup761x25519-sha512 and mlkem768x25519-sha256,
+// as described in draft-ietf-sshm-ntruprime-ssh and
+// draft-ietf-sshm-mlkem-hybrid-kex. The client sends its encapsulation key
+// followed by its X25519 public value, the server replies with a ciphertext
+// followed by its X25519 public value, and the shared secret is the hash of
+// the KEM shared key and the X25519 shared secret, encoded as a string.
+type hybridKEM struct {
+	kem      kem
+	hashFunc crypto.Hash
+}
+
+func (kex *hybridKEM) sharedSecret(kemKey, ecdhKey []byte) []byte {
+	h := kex.hashFunc.New()
+	h.Write(kemKey)
+	h.Write(ecdhKey)
+	secret := h.Sum(nil)
+
+	K := make([]byte, stringLength(len(secret)))
+	marshalString(K, secret)
+	return K
+}
+
+func (kex *hybridKEM) Client(c packetConn, rand io.Reader, magics *handshakeMagics) (*kexResult, error) {
+	var kp curve25519KeyPair
+	if err := kp.generate(rand); err != nil {
+		return nil, err
+	}
+	encapsulationKey, decapsulate, err := kex.kem.generateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	clientPub := append(encapsulationKey, kp.pub[:]...)
+	if err := c.writePacket(Marshal(&kexECDHInitMsg{clientPub})); err != nil {
+		return nil, err
+	}
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	var reply kexECDHReplyMsg
+	if err = Unmarshal(packet, &reply); err != nil {
+		return nil, err
+	}
+	n := kex.kem.ciphertextSize()
+	if len(reply.EphemeralPubKey) != n+32 {
+		return nil, errors.New("ssh: peer's hybrid key exchange value has wrong length")
+	}
+
+	kemKey, err := decapsulate(reply.EphemeralPubKey[:n])
+	if err != nil {
+		return nil, err
+	}
+	ecdhKey, err := kp.sharedSecret(reply.EphemeralPubKey[n:])
+	if err != nil {
+		return nil, err
+	}
+	K := kex.sharedSecret(kemKey, ecdhKey)
+
+	h := kex.hashFunc.New()
+	magics.write(h)
+	writeString(h, reply.HostKey)
+	writeString(h, clientPub)
+	writeString(h, reply.EphemeralPubKey)
+	h.Write(K)
+
+	return &kexResult{
+		H:         h.Sum(nil),
+		K:         K,
+		HostKey:   reply.HostKey,
+		Signature: reply.Signature,
+		Hash:      kex.hashFunc,
+	}, nil
+}
+
+func (kex *hybridKEM) Server(c packetConn, rand io.Reader, magics *handshakeMagics, priv AlgorithmSigner, algo string) (*kexResult, error) {
+	packet, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	var kexInit kexECDHInitMsg
+	if err = Unmarshal(packet, &kexInit); err != nil {
+		return nil, err
+	}
+	n := kex.kem.encapsulationKeySize()
+	if len(kexInit.ClientPubKey) != n+32 {
+		return nil, errors.New("ssh: peer's hybrid key exchange value has wrong length")
+	}
+
+	ciphertext, kemKey, err := kex.kem.encapsulate(rand, kexInit.ClientPubKey[:n])
+	if err != nil {
+		return nil, err
+	}
+	var kp curve25519KeyPair
+	if err := kp.generate(rand); err != nil {
+		return nil, err
+	}
+	ecdhKey, err := kp.sharedSecret(kexInit.ClientPubKey[n:])
+	if err != nil {
+		return nil, err
+	}
+	K := kex.sharedSecret(kemKey, ecdhKey)
+	serverPub := append(ciphertext, kp.pub[:]...)
+
+	hostKeyBytes := priv.PublicKey().Marshal()
+
+	h := kex.hashFunc.New()
+	magics.write(h)
+	writeString(h, hostKeyBytes)
+	writeString(h, kexInit.ClientPubKey)
+	writeString(h, serverPub)
+	h.Write(K)
+
+	H := h.Sum(nil)
+
+	sig, err := signAndMarshal(priv, rand, H, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := kexECDHReplyMsg{
+		EphemeralPubKey: serverPub,
+		HostKey:         hostKeyBytes,
+		Signature:       sig,
+	}
+	if err := c.writePacket(Marshal(&reply)); err != nil {
+		return nil, err
+	}
+	return &kexResult{
+		H:         H,
+		K:         K,
+		HostKey:   hostKeyBytes,
+		Signature: sig,
+		Hash:      kex.hashFunc,
+	}, nil
+}
+
+// sntrup761KEM is the Streamlined NTRU Prime 761 KEM.
+type sntrup761KEM struct{}
+
+func (sntrup761KEM) encapsulationKeySize() int { return sntrup761.PublicKeySize }
+
+func (sntrup761KEM) ciphertextSize() int { return sntrup761.CiphertextSize }
+
+func (sntrup761KEM) generateKey(rand io.Reader) ([]byte, func([]byte) ([]byte, error), error) {
+	pk, sk, err := sntrup761.GenerateKey(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pk, func(ciphertext []byte) ([]byte, error) {
+		return sntrup761.Decapsulate(sk, ciphertext)
+	}, nil
+}
+
+func (sntrup761KEM) encapsulate(rand io.Reader, encapsulationKey []byte) ([]byte, []byte, error) {
+	return sntrup761.Encapsulate(rand, encapsulationKey)
+}
+
 // dhGEXSHA implements the diffie-hellman-group-exchange-sha1 and
 // diffie-hellman-group-exchange-sha256 key agreement protocols,
 // as described in RFC 4419
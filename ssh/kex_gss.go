@@ -0,0 +1,251 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// The GSS-API key exchange methods for the Kerberos V5 mechanism. The
+// suffix is the base64 encoded MD5 hash of the DER encoding of the mechanism
+// OID. See RFC 4462, section 2 and RFC 8732.
+const (
+	kexAlgoGSSDH14SHA256 = "gss-group14-sha256-toWM5Slw5Ew8Mqkay+al2g=="
+	kexAlgoGSSDH16SHA512 = "gss-group16-sha512-toWM5Slw5Ew8Mqkay+al2g=="
+)
+
+// gssKexAlgos lists the GSS-API key exchange methods in preference order.
+// If GSS-API key exchange is enabled, they are preferred to the methods of
+// Config.KeyExchanges.
+var gssKexAlgos = []string{kexAlgoGSSDH14SHA256, kexAlgoGSSDH16SHA512}
+
+// gssKexGroups maps each GSS-API key exchange method to the Diffie-Hellman
+// key exchange whose group and hash function it uses.
+var gssKexGroups = map[string]string{
+	kexAlgoGSSDH14SHA256: kexAlgoDH14SHA256,
+	kexAlgoGSSDH16SHA512: kexAlgoDH16SHA512,
+}
+
+// gssKex implements the Diffie-Hellman GSS-API key exchange methods, as
+// described in RFC 4462, section 2.1. Rather than signing the exchange hash
+// with its host key, the server authenticates with a GSS-API MIC of it.
+//
+// The server sends its host key in SSH_MSG_KEXGSS_HOSTKEY, and the host key
+// callback of the client still checks it. The "null" host key algorithm is
+// not supported.
+type gssKex struct {
+	group  *dhGroup
+	client *GSSAPIKeyExchangeConfig
+	server GSSAPIKeyExchangeServer
+}
+
+// generateKey returns a random Diffie-Hellman private key and the matching
+// public value.
+func (kex *gssKex) generateKey(randSource io.Reader) (x, X *big.Int, err error) {
+	for {
+		if x, err = rand.Int(randSource, kex.group.pMinus1); err != nil {
+			return nil, nil, err
+		}
+		if x.Sign() > 0 {
+			break
+		}
+	}
+	return x, new(big.Int).Exp(kex.group.g, x, kex.group.p), nil
+}
+
+// exchangeHash returns the exchange hash H and the encoded shared secret K.
+// See RFC 4462, section 2.1.
+func (kex *gssKex) exchangeHash(magics *handshakeMagics, hostKey []byte, X, Y, ki *big.Int) (H, K []byte) {
+	h := kex.group.hashFunc.New()
+	magics.write(h)
+	writeString(h, hostKey)
+	writeInt(h, X)
+	writeInt(h, Y)
+	K = make([]byte, intLength(ki))
+	marshalInt(K, ki)
+	h.Write(K)
+	return h.Sum(nil), K
+}
+
+func (kex *gssKex) Client(c packetConn, randSource io.Reader, magics *handshakeMagics) (*kexResult, error) {
+	g := kex.client
+	target := "host@" + g.Target
+	defer g.Client.DeleteSecContext()
+
+	token, needContinue, err := g.Client.InitSecContext(target, nil, g.DelegateCredentials)
+	if err != nil {
+		return nil, err
+	}
+	x, X, err := kex.generateKey(randSource)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writePacket(Marshal(&kexGSSInitMsg{Token: token, X: X})); err != nil {
+		return nil, err
+	}
+
+	var hostKey []byte
+	var complete kexGSSCompleteMsg
+	for done := false; !done; {
+		packet, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		switch packet[0] {
+		case msgKexGSSHostKey:
+			var msg kexGSSHostKeyMsg
+			if err := Unmarshal(packet, &msg); err != nil {
+				return nil, err
+			}
+			hostKey = msg.HostKey
+		case msgKexGSSContinue:
+			var msg kexGSSContinueMsg
+			if err := Unmarshal(packet, &msg); err != nil {
+				return nil, err
+			}
+			if !needContinue {
+				return nil, errors.New("ssh: unexpected GSS-API token from server")
+			}
+			token, needContinue, err = g.Client.InitSecContext(target, msg.Token, g.DelegateCredentials)
+			if err != nil {
+				return nil, err
+			}
+			if len(token) > 0 {
+				if err := c.writePacket(Marshal(&kexGSSContinueMsg{Token: token})); err != nil {
+					return nil, err
+				}
+			}
+		case msgKexGSSComplete:
+			if err := Unmarshal(packet, &complete); err != nil {
+				return nil, err
+			}
+			if complete.HasToken {
+				final, _, ok := parseString(complete.Rest)
+				if !ok || !needContinue {
+					return nil, errors.New("ssh: unexpected GSS-API token from server")
+				}
+				token, needContinue, err = g.Client.InitSecContext(target, final, g.DelegateCredentials)
+				if err != nil {
+					return nil, err
+				}
+				if len(token) > 0 {
+					return nil, errors.New("ssh: GSS-API token left after the key exchange completed")
+				}
+			}
+			if needContinue {
+				return nil, errors.New("ssh: GSS-API security context not established")
+			}
+			done = true
+		case msgKexGSSError:
+			var msg kexGSSErrorMsg
+			if err := Unmarshal(packet, &msg); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("ssh: GSS-API key exchange failed: major status %d, minor status %d: %s",
+				msg.MajorStatus, msg.MinorStatus, msg.Message)
+		default:
+			return nil, unexpectedMessageError(msgKexGSSComplete, packet[0])
+		}
+	}
+	if hostKey == nil {
+		return nil, errors.New("ssh: server sent no host key in GSS-API key exchange")
+	}
+
+	ki, err := kex.group.diffieHellman(complete.Y, x)
+	if err != nil {
+		return nil, err
+	}
+	H, K := kex.exchangeHash(magics, hostKey, X, complete.Y, ki)
+	if err := g.Client.VerifyMIC(H, complete.MIC); err != nil {
+		return nil, err
+	}
+
+	return &kexResult{
+		H:       H,
+		K:       K,
+		HostKey: hostKey,
+		Hash:    kex.group.hashFunc,
+	}, nil
+}
+
+func (kex *gssKex) Server(c packetConn, randSource io.Reader, magics *handshakeMagics, priv AlgorithmSigner, algo string) (*kexResult, error) {
+	s := kex.server
+	defer s.DeleteSecContext()
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	var init kexGSSInitMsg
+	if err := Unmarshal(packet, &init); err != nil {
+		return nil, err
+	}
+
+	hostKeyBytes := priv.PublicKey().Marshal()
+	if err := c.writePacket(Marshal(&kexGSSHostKeyMsg{HostKey: hostKeyBytes})); err != nil {
+		return nil, err
+	}
+
+	token := init.Token
+	var out []byte
+	for {
+		var needContinue bool
+		out, _, needContinue, err = s.AcceptSecContext(token)
+		if err != nil {
+			// Tell the client why the key exchange fails.
+			c.writePacket(Marshal(&kexGSSErrorMsg{Message: err.Error()}))
+			return nil, err
+		}
+		if !needContinue {
+			break
+		}
+		if err := c.writePacket(Marshal(&kexGSSContinueMsg{Token: out})); err != nil {
+			return nil, err
+		}
+		packet, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		var msg kexGSSContinueMsg
+		if err := Unmarshal(packet, &msg); err != nil {
+			return nil, err
+		}
+		token = msg.Token
+	}
+
+	y, Y, err := kex.generateKey(randSource)
+	if err != nil {
+		return nil, err
+	}
+	ki, err := kex.group.diffieHellman(init.X, y)
+	if err != nil {
+		return nil, err
+	}
+	H, K := kex.exchangeHash(magics, hostKeyBytes, init.X, Y, ki)
+	mic, err := s.GetMIC(H)
+	if err != nil {
+		return nil, err
+	}
+
+	complete := kexGSSCompleteMsg{Y: Y, MIC: mic}
+	if len(out) > 0 {
+		complete.HasToken = true
+		complete.Rest = appendString(nil, string(out))
+	}
+	if err := c.writePacket(Marshal(&complete)); err != nil {
+		return nil, err
+	}
+
+	return &kexResult{
+		H:       H,
+		K:       K,
+		HostKey: hostKeyBytes,
+		Hash:    kex.group.hashFunc,
+	}, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// kexGSSClient is a GSSAPIKeyExchangeClient that exchanges a fixed token
+// with kexGSSServer.
+type kexGSSClient struct {
+	target string
+	mic    []byte
+}
+
+func (c *kexGSSClient) InitSecContext(target string, token []byte, isGSSDelegCreds bool) ([]byte, bool, error) {
+	c.target = target
+	if token == nil {
+		return []byte("client-token"), true, nil
+	}
+	if string(token) != "server-token" {
+		return nil, false, fmt.Errorf("got token %q, want %q", token, "server-token")
+	}
+	return nil, false, nil
+}
+
+func (c *kexGSSClient) GetMIC(micField []byte) ([]byte, error) {
+	return nil, errors.New("unexpected GetMIC")
+}
+
+func (c *kexGSSClient) VerifyMIC(micField []byte, micToken []byte) error {
+	c.mic = micToken
+	if !bytes.Equal(micToken, append([]byte("mic:"), micField...)) {
+		return errors.New("MIC mismatch")
+	}
+	return nil
+}
+
+func (c *kexGSSClient) DeleteSecContext() error {
+	return nil
+}
+
+type kexGSSServer struct {
+	err error
+	mic []byte
+}
+
+func (s *kexGSSServer) AcceptSecContext(token []byte) ([]byte, string, bool, error) {
+	if s.err != nil {
+		return nil, "", false, s.err
+	}
+	if string(token) != "client-token" {
+		return nil, "", false, fmt.Errorf("got token %q, want %q", token, "client-token")
+	}
+	return []byte("server-token"), "testuser@DOMAIN", false, nil
+}
+
+func (s *kexGSSServer) VerifyMIC(micField []byte, micToken []byte) error {
+	return errors.New("unexpected VerifyMIC")
+}
+
+func (s *kexGSSServer) GetMIC(micField []byte) ([]byte, error) {
+	if s.mic != nil {
+		return s.mic, nil
+	}
+	return append([]byte("mic:"), micField...), nil
+}
+
+func (s *kexGSSServer) DeleteSecContext() error {
+	return nil
+}
+
+func TestGSSAPIKeyExchange(t *testing.T) {
+	var hostKey PublicKey
+	gssClient := &kexGSSClient{}
+	clientConf := &ClientConfig{
+		User: "testuser",
+		HostKeyCallback: func(hostname string, remote net.Addr, key PublicKey) error {
+			hostKey = key
+			return nil
+		},
+		GSSAPIKeyExchange: &GSSAPIKeyExchangeConfig{
+			Client: gssClient,
+			Target: "testtarget",
+		},
+	}
+	serverConf := &ServerConfig{
+		NoClientAuth:      true,
+		GSSAPIKeyExchange: &kexGSSServer{},
+	}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+
+	conn, clientErr, serverErr := connectWithPolicies(t, clientConf, serverConf)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("client: %v, server: %v", clientErr, serverErr)
+	}
+	defer conn.Close()
+
+	if kex := conn.(AlgorithmsConnMetadata).Algorithms().KeyExchange; kex != kexAlgoGSSDH14SHA256 {
+		t.Errorf("negotiated key exchange %q, want %q", kex, kexAlgoGSSDH14SHA256)
+	}
+	if gssClient.target != "host@testtarget" {
+		t.Errorf("got target %q, want %q", gssClient.target, "host@testtarget")
+	}
+	if gssClient.mic == nil {
+		t.Error("the MIC of the server was not verified")
+	}
+	if hostKey == nil || !bytes.Equal(hostKey.Marshal(), testSigners["ecdsa"].PublicKey().Marshal()) {
+		t.Errorf("host key callback got %v, want the ecdsa host key", hostKey)
+	}
+}
+
+func TestGSSAPIKeyExchangeFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		server        *kexGSSServer
+		clientWantErr string
+	}{
+		{"bad MIC", &kexGSSServer{mic: []byte("bogus")}, "MIC mismatch"},
+		{"GSS-API error", &kexGSSServer{err: errors.New("no credentials")}, "no credentials"},
+	} {
+		clientConf := &ClientConfig{
+			User:            "testuser",
+			HostKeyCallback: InsecureIgnoreHostKey(),
+			GSSAPIKeyExchange: &GSSAPIKeyExchangeConfig{
+				Client: &kexGSSClient{},
+				Target: "testtarget",
+			},
+		}
+		serverConf := &ServerConfig{
+			NoClientAuth:      true,
+			GSSAPIKeyExchange: tt.server,
+		}
+		serverConf.AddHostKey(testSigners["ecdsa"])
+
+		_, clientErr, _ := connectWithPolicies(t, clientConf, serverConf)
+		if clientErr == nil || !strings.Contains(clientErr.Error(), tt.clientWantErr) {
+			t.Errorf("%s: got client error %v, want %q", tt.name, clientErr, tt.clientWantErr)
+		}
+	}
+}
+
+func TestGSSAPIKeyExchangeFallback(t *testing.T) {
+	clientConf := &ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: InsecureIgnoreHostKey(),
+		GSSAPIKeyExchange: &GSSAPIKeyExchangeConfig{
+			Client: &kexGSSClient{},
+			Target: "testtarget",
+		},
+	}
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+
+	conn, clientErr, serverErr := connectWithPolicies(t, clientConf, serverConf)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("client: %v, server: %v", clientErr, serverErr)
+	}
+	defer conn.Close()
+	if kex := conn.(AlgorithmsConnMetadata).Algorithms().KeyExchange; strings.HasPrefix(kex, "gss-") {
+		t.Errorf("negotiated key exchange %q with a server without GSS-API key exchange", kex)
+	}
+}
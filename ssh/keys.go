@@ -1080,7 +1080,11 @@ type wrappedSigner struct {
 
 // NewSignerFromSigner takes any crypto.Signer implementation and
 // returns a corresponding Signer interface. This can be used, for
-// example, with keys kept in hardware modules.
+// example, with keys kept in hardware modules or remote signing services,
+// for user authentication, host keys and their proofs, or as a
+// certificate authority with Certificate.SignCert. ECDSA signatures may be
+// returned by signer either ASN.1-encoded, as by crypto/ecdsa, or in the
+// r || s form used by some key management services.
 func NewSignerFromSigner(signer crypto.Signer) (Signer, error) {
 	pubKey, err := NewPublicKey(signer.Public())
 	if err != nil {
@@ -1135,9 +1139,20 @@ func (s *wrappedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm
 			R, S *big.Int
 		}
 		asn1Sig := new(asn1Signature)
-		_, err := asn1.Unmarshal(signature, asn1Sig)
-		if err != nil {
-			return nil, err
+		rest, err := asn1.Unmarshal(signature, asn1Sig)
+		if err != nil || len(rest) > 0 {
+			// Some remote signers, such as cloud KMS services, return
+			// the fixed-size r || s encoding of IEEE P1363 instead.
+			k, ok := s.pubKey.(*ecdsaPublicKey)
+			size := 0
+			if ok {
+				size = (k.Curve.Params().BitSize + 7) / 8
+			}
+			if len(signature) != 2*size {
+				return nil, errors.New("ssh: crypto.Signer returned an invalid signature")
+			}
+			asn1Sig.R = new(big.Int).SetBytes(signature[:size])
+			asn1Sig.S = new(big.Int).SetBytes(signature[size:])
 		}
 
 		switch s.pubKey.(type) {
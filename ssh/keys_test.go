@@ -6,6 +6,7 @@ package ssh
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
 	"crypto/ed25519"
@@ -13,12 +14,14 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"reflect"
 	"strings"
 	"testing"
@@ -810,3 +813,94 @@ func TestCryptoPublicKey(t *testing.T) {
 		}
 	}
 }
+
+// remoteSigner hides a private key behind crypto.Signer, like the clients
+// of key management services. If raw is set, it returns ECDSA signatures
+// in the r || s form.
+type remoteSigner struct {
+	crypto.Signer
+	raw bool
+}
+
+func (s *remoteSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	sig, err := s.Signer.Sign(rand, digest, opts)
+	pub, ok := s.Public().(*ecdsa.PublicKey)
+	if err != nil || !s.raw || !ok {
+		return sig, err
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return nil, err
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	rs.R.FillBytes(raw[:size])
+	rs.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+func TestRemoteSigner(t *testing.T) {
+	for _, name := range []string{"rsa", "ecdsap256", "ecdsap384", "ecdsap521", "ed25519"} {
+		for _, raw := range []bool{false, true} {
+			signer, err := NewSignerFromSigner(&remoteSigner{testPrivateKeys[name].(crypto.Signer), raw})
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			pub := signer.PublicKey()
+
+			data := []byte("data")
+			sig, err := signer.Sign(rand.Reader, data)
+			if err != nil {
+				t.Fatalf("%s: Sign: %v", name, err)
+			}
+			if err := pub.Verify(data, sig); err != nil {
+				t.Errorf("%s: Verify: %v", name, err)
+			}
+
+			// As a certificate authority.
+			cert := &Certificate{
+				Key:             testPublicKeys["ecdsa"],
+				CertType:        UserCert,
+				ValidPrincipals: []string{"user"},
+				ValidBefore:     CertTimeInfinity,
+			}
+			if err := cert.SignCert(rand.Reader, signer); err != nil {
+				t.Fatalf("%s: SignCert: %v", name, err)
+			}
+			checker := &CertChecker{IsUserAuthority: func(k PublicKey) bool {
+				return bytes.Equal(k.Marshal(), pub.Marshal())
+			}}
+			if err := checker.CheckCert("user", cert); err != nil {
+				t.Errorf("%s: CheckCert: %v", name, err)
+			}
+
+			// As a host key proving its possession.
+			sessionID := []byte("session")
+			proof, err := proveHostKeys([]Signer{signer}, sessionID, appendString(nil, string(pub.Marshal())), pub.Type(), rand.Reader)
+			if err != nil {
+				t.Fatalf("%s: proveHostKeys: %v", name, err)
+			}
+			blob, _, _ := parseString(proof)
+			proofSig, _, ok := parseSignatureBody(blob)
+			if !ok {
+				t.Fatalf("%s: invalid host key proof", name)
+			}
+			if err := pub.Verify(Marshal(&hostKeysProofData{hostKeysProveRequest, sessionID, pub.Marshal()}), proofSig); err != nil {
+				t.Errorf("%s: host key proof: %v", name, err)
+			}
+		}
+	}
+
+	bad, _ := NewSignerFromSigner(&badSigner{testPrivateKeys["ecdsap256"].(crypto.Signer)})
+	if _, err := bad.Sign(rand.Reader, []byte("data")); err == nil {
+		t.Error("Sign succeeded with a malformed ECDSA signature")
+	}
+}
+
+type badSigner struct {
+	crypto.Signer
+}
+
+func (s *badSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return make([]byte, 63), nil
+}
@@ -160,8 +160,18 @@ func (db *hostKeyDB) IsHostAuthority(remote ssh.PublicKey, address string) bool
 
 // IsRevoked can be used as a callback in ssh.CertChecker
 func (db *hostKeyDB) IsRevoked(key *ssh.Certificate) bool {
-	_, ok := db.revoked[string(key.Marshal())]
-	return ok
+	return db.revokedCert(key) != nil
+}
+
+// revokedCert returns the @revoked entry for cert, its key or the key of
+// the authority that signed it, or nil if there is none.
+func (db *hostKeyDB) revokedCert(cert *ssh.Certificate) *KnownKey {
+	for _, k := range []ssh.PublicKey{cert, cert.Key, cert.SignatureKey} {
+		if revoked := db.revoked[string(k.Marshal())]; revoked != nil {
+			return revoked
+		}
+	}
+	return nil
 }
 
 const markerCert = "@cert-authority"
@@ -361,7 +371,9 @@ func (db *hostKeyDB) checkAddr(a addr, remoteKey ssh.PublicKey) error {
 	// Algorithm => key.
 	knownKeys := map[string]KnownKey{}
 	for _, l := range db.lines {
-		if l.match(a) {
+		// The key of an authority is not a host key of the hosts it
+		// signs certificates for.
+		if !l.cert && l.match(a) {
 			typ := l.knownKey.Key.Type()
 			if _, ok := knownKeys[typ]; !ok {
 				knownKeys[typ] = l.knownKey
@@ -414,6 +426,11 @@ func (db *hostKeyDB) Read(r io.Reader, filename string) error {
 // operates on the hostname if available, i.e. if a server changes its
 // IP address, the host key check will still succeed, even though a
 // record of the new IP address is not available.
+//
+// Host certificates are accepted if they are signed by a key marked with
+// @cert-authority for the host. Host keys and certificates that are marked
+// with @revoked, or signed by such a key, are rejected with a
+// *RevokedError.
 func New(files ...string) (ssh.HostKeyCallback, error) {
 	db := newHostKeyDB()
 	for _, fn := range files {
@@ -427,12 +444,27 @@ func New(files ...string) (ssh.HostKeyCallback, error) {
 		}
 	}
 
+	return db.hostKeyCallback(), nil
+}
+
+// hostKeyCallback returns a callback checking host keys against db. Host
+// certificates are accepted if they are signed by a @cert-authority key for
+// the host, and a *RevokedError is returned for host keys and certificates
+// that are, or are signed by, a @revoked key.
+func (db *hostKeyDB) hostKeyCallback() ssh.HostKeyCallback {
 	var certChecker ssh.CertChecker
 	certChecker.IsHostAuthority = db.IsHostAuthority
 	certChecker.IsRevoked = db.IsRevoked
 	certChecker.HostKeyFallback = db.check
 
-	return certChecker.CheckHostKey, nil
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if cert, ok := key.(*ssh.Certificate); ok {
+			if revoked := db.revokedCert(cert); revoked != nil {
+				return &RevokedError{Revoked: *revoked}
+			}
+		}
+		return certChecker.CheckHostKey(hostname, remote, key)
+	}
 }
 
 // Normalize normalizes an address into the form used in known_hosts
@@ -6,6 +6,8 @@ package knownhosts
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"fmt"
 	"net"
 	"reflect"
@@ -354,3 +356,55 @@ func TestHashedHostkeyCheck(t *testing.T) {
 		t.Errorf("got error %v, want %v", got, want)
 	}
 }
+
+func TestCertAuthorityMarker(t *testing.T) {
+	newSigner := func() ssh.Signer {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+	ca, otherCA, hostKey := newSigner(), newSigner(), newSigner()
+	newCert := func(ca ssh.Signer) *ssh.Certificate {
+		cert := &ssh.Certificate{
+			Key:             hostKey.PublicKey(),
+			CertType:        ssh.HostCert,
+			ValidPrincipals: []string{"server.example.com"},
+			ValidBefore:     ssh.CertTimeInfinity,
+		}
+		if err := cert.SignCert(rand.Reader, ca); err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	cert := newCert(ca)
+	caLine := "@cert-authority *.example.com " + serialize(ca.PublicKey()) + "\n"
+
+	for _, tt := range []struct {
+		name    string
+		db      string
+		key     ssh.PublicKey
+		good    bool
+		revoked bool
+	}{
+		{"certificate", caLine, cert, true, false},
+		{"certificate from another authority", caLine, newCert(otherCA), false, false},
+		{"authority key as host key", caLine, ca.PublicKey(), false, false},
+		{"revoked authority", caLine + "@revoked * " + serialize(ca.PublicKey()), cert, false, true},
+		{"revoked host key", caLine + "@revoked * " + serialize(hostKey.PublicKey()), cert, false, true},
+		{"revoked certificate", caLine + "@revoked * " + serialize(cert), cert, false, true},
+	} {
+		err := testDB(t, tt.db).hostKeyCallback()("server.example.com:22", testAddr, tt.key)
+		if (err == nil) != tt.good {
+			t.Errorf("%s: got error %v, want good = %v", tt.name, err, tt.good)
+		}
+		if _, ok := err.(*RevokedError); ok != tt.revoked {
+			t.Errorf("%s: got error %v, want revoked = %v", tt.name, err, tt.revoked)
+		}
+	}
+}
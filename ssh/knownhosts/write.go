@@ -0,0 +1,414 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package knownhosts
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+// WriteKnownHost writes a known_hosts line for key to w. The hostname and
+// remote arguments are those passed to an ssh.HostKeyCallback; the line
+// lists the normalized hostname and, if it differs, the remote address.
+func WriteKnownHost(w io.Writer, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	addresses := []string{hostname}
+	if remote != nil {
+		if r := Normalize(remote.String()); r != Normalize(hostname) {
+			addresses = append(addresses, remote.String())
+		}
+	}
+	_, err := io.WriteString(w, Line(addresses, key)+"\n")
+	return err
+}
+
+// AppendHostKey appends key for the given addresses to the known_hosts
+// file at filename, creating the file if it does not exist. If hash is
+// true, each address is written as a separate line with a hashed host
+// name, like OpenSSH does when HashKnownHosts is enabled.
+//
+// The file is locked as described for UpdateHostKey while it is written.
+func AppendHostKey(filename string, addresses []string, key ssh.PublicKey, hash bool) error {
+	return withLock(filename, func() error {
+		f, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var buf bytes.Buffer
+		// Don't glue our line to the last one if the file lacks a
+		// trailing newline.
+		if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+			last := make([]byte, 1)
+			if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+				buf.WriteByte('\n')
+			}
+		}
+		writeLines(&buf, addresses, key, hash)
+		if _, err := f.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		return f.Sync()
+	})
+}
+
+// UpdateHostKey records key as the host key of its type for address in
+// the known_hosts file at filename, creating the file if necessary.
+//
+// Existing entries for address with a key of the same type are removed.
+// Hashed entries are matched by hashing address, and plain entries that
+// list address among other host names only lose that host name. Entries
+// that match address through wildcards or negations, and lines with a
+// marker such as @revoked, are left alone. If any of the removed entries
+// were hashed, the new entry is hashed as well.
+//
+// The file is rewritten atomically. Concurrent writers using this package
+// are serialized with an advisory lock on filename+".lock", which is left
+// in place afterwards.
+func UpdateHostKey(filename, address string, key ssh.PublicKey) error {
+	a := parseAddr(address)
+	hashed := false
+	return rewrite(filename, func(l *line) bool {
+		if l.marker != "" || l.key.Type() != key.Type() {
+			return true
+		}
+		if _, h := dropAddr(l, a); h {
+			hashed = true
+		}
+		return l.hosts != ""
+	}, func(w *bytes.Buffer) error {
+		writeLines(w, []string{address}, key, hashed)
+		return nil
+	})
+}
+
+// UpdateHostKeys updates the known_hosts file at filename with keys, the
+// host keys announced by a server, like the UpdateHostKeys option of
+// OpenSSH. The hostname and remote arguments are those passed to an
+// ssh.HostKeysCallback, and the keys are looked up for hostname, or for
+// remote if hostname is empty.
+//
+// The file is only changed if it already lists one of keys for the host,
+// so that keys are only learned from servers that authenticated with a
+// known key. Then, the keys that are missing are added, hashed if any
+// entry of the host is hashed, and the host is removed from the entries of
+// the keys that are no longer announced, as described for UpdateHostKey.
+// Entries that match the host through wildcards or negations are not
+// changed, and keys marked with @revoked are never added.
+//
+// The file is locked and rewritten as described for UpdateHostKey. It is
+// not rewritten if nothing changes.
+func UpdateHostKeys(filename, hostname string, remote net.Addr, keys []ssh.PublicKey) error {
+	address := hostname
+	if address == "" {
+		address = remote.String()
+	}
+	a := parseAddr(address)
+
+	announced := make(map[string]bool)
+	missing := make(map[string]bool)
+	for _, k := range keys {
+		announced[string(k.Marshal())] = true
+		missing[string(k.Marshal())] = true
+	}
+	known, hashed, removed := false, false, false
+	err := rewrite(filename, func(l *line) bool {
+		blob := string(l.key.Marshal())
+		if l.marker == markerRevoked {
+			delete(missing, blob)
+			return true
+		}
+		if l.marker != "" {
+			return true
+		}
+		if !announced[blob] {
+			hosts := l.hosts
+			if dropped, h := dropAddr(l, a); dropped {
+				removed = true
+				hashed = hashed || h
+			} else {
+				l.hosts = hosts
+			}
+			return l.hosts != ""
+		}
+		if m, err := lineMatcher(l); err == nil && m.match(a) {
+			known = true
+			hashed = hashed || l.hosts[0] == '|'
+			delete(missing, blob)
+		}
+		return true
+	}, func(w *bytes.Buffer) error {
+		if !known || (len(missing) == 0 && !removed) {
+			return errUnchanged
+		}
+		for _, k := range keys {
+			if blob := string(k.Marshal()); missing[blob] {
+				writeLines(w, []string{address}, k, hashed)
+				delete(missing, blob)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errUnchanged) {
+		err = nil
+	}
+	return err
+}
+
+// HostKeysUpdater returns an ssh.HostKeysCallback that calls UpdateHostKeys
+// for the known_hosts file at filename. It is meant to be used with a
+// HostKeyCallback returned by New for the same file. Errors are passed to
+// errorf, if it is not nil.
+func HostKeysUpdater(filename string, errorf func(error)) ssh.HostKeysCallback {
+	return func(hostname string, remote net.Addr, keys []ssh.PublicKey) {
+		if err := UpdateHostKeys(filename, hostname, remote, keys); err != nil && errorf != nil {
+			errorf(err)
+		}
+	}
+}
+
+// dropAddr removes a from the host names of l if l lists it, hashed or
+// without wildcards or negation, leaving l.hosts empty if no host name
+// remains. It reports whether a was removed, and whether it was hashed.
+func dropAddr(l *line, a addr) (dropped, hashed bool) {
+	if l.hosts[0] == '|' {
+		h, err := newHashedHost(l.hosts)
+		if err == nil && h.match(a) {
+			l.hosts = ""
+			return true, true
+		}
+		return false, false
+	}
+	var kept []string
+	for _, p := range strings.Split(l.hosts, ",") {
+		if p == "" {
+			continue
+		}
+		if p[0] != '!' && !strings.ContainsAny(p, "*?") && parseAddr(p) == a {
+			dropped = true
+			continue
+		}
+		kept = append(kept, p)
+	}
+	l.hosts = strings.Join(kept, ",")
+	return dropped, false
+}
+
+// lineMatcher returns the matcher of the host names of l.
+func lineMatcher(l *line) (matcher, error) {
+	if l.hosts[0] == '|' {
+		return newHashedHost(l.hosts)
+	}
+	return newHostnameMatcher(l.hosts)
+}
+
+// ReplaceHostKey replaces oldKey with newKey in all entries of the
+// known_hosts file at filename, including @cert-authority entries, and
+// returns the number of entries changed. Host patterns, hashed or not, and
+// comments are preserved. This is useful after a host key or a host
+// certificate authority has been rotated, for example because the old key
+// was revoked. Entries with the @revoked marker are not changed.
+//
+// The file is locked and rewritten as described for UpdateHostKey. It is
+// not rewritten if no entry matches.
+func ReplaceHostKey(filename string, oldKey, newKey ssh.PublicKey) (int, error) {
+	n := 0
+	err := rewrite(filename, func(l *line) bool {
+		if l.marker != markerRevoked && keyEq(l.key, oldKey) {
+			l.key = newKey
+			n++
+		}
+		return true
+	}, nil)
+	if errors.Is(err, errUnchanged) {
+		err = nil
+	}
+	return n, err
+}
+
+func writeLines(w *bytes.Buffer, addresses []string, key ssh.PublicKey, hash bool) {
+	if !hash {
+		w.WriteString(Line(addresses, key) + "\n")
+		return
+	}
+	for _, a := range addresses {
+		w.WriteString(HashHostname(Normalize(a)) + " " + serialize(key) + "\n")
+	}
+}
+
+// parseAddr splits address as used for matching, defaulting to port 22.
+func parseAddr(address string) addr {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return addr{host: strings.Trim(address, "[]"), port: "22"}
+	}
+	return addr{host: host, port: port}
+}
+
+// line is a parsed known_hosts entry that can be serialized again.
+type line struct {
+	marker  string
+	hosts   string
+	key     ssh.PublicKey
+	comment string
+}
+
+func (l *line) String() string {
+	s := l.hosts + " " + serialize(l.key)
+	if l.marker != "" {
+		s = l.marker + " " + s
+	}
+	if l.comment != "" {
+		s += " " + l.comment
+	}
+	return s
+}
+
+func parseEntry(b []byte) (*line, error) {
+	marker, hosts, key, err := parseLine(b)
+	if err != nil {
+		return nil, err
+	}
+	// Skip the marker, hosts, key type and key blob to find the comment.
+	rest := b
+	if marker != "" {
+		_, rest = nextWord(rest)
+	}
+	for i := 0; i < 3; i++ {
+		_, rest = nextWord(rest)
+	}
+	return &line{marker: marker, hosts: hosts, key: key, comment: string(rest)}, nil
+}
+
+var errUnchanged = errors.New("knownhosts: no entries changed")
+
+// rewrite locks filename and replaces its content. The edit function is
+// called for each entry; it may modify the entry and reports whether to
+// keep it. Comments, blank lines and lines that fail to parse are copied
+// unchanged. If add is not nil, it is called to append new lines; if it
+// returns an error, the file is left unchanged and the error is returned.
+// Without add, rewrite returns errUnchanged if edit made no changes.
+func rewrite(filename string, edit func(*line) bool, add func(*bytes.Buffer) error) error {
+	return withLock(filename, func() error {
+		mode := os.FileMode(0600)
+		old, err := os.ReadFile(filename)
+		switch {
+		case err == nil:
+			if fi, err := os.Stat(filename); err == nil {
+				mode = fi.Mode().Perm()
+			}
+		case errors.Is(err, os.ErrNotExist):
+		default:
+			return err
+		}
+
+		var buf bytes.Buffer
+		changed := false
+		scanner := bufio.NewScanner(bytes.NewReader(old))
+		for scanner.Scan() {
+			raw := scanner.Bytes()
+			trimmed := bytes.TrimSpace(raw)
+			if len(trimmed) == 0 || trimmed[0] == '#' {
+				buf.Write(raw)
+				buf.WriteByte('\n')
+				continue
+			}
+			l, err := parseEntry(trimmed)
+			if err != nil {
+				buf.Write(raw)
+				buf.WriteByte('\n')
+				continue
+			}
+			orig := l.String()
+			if !edit(l) {
+				changed = true
+				continue
+			}
+			if s := l.String(); s != orig {
+				changed = true
+				buf.WriteString(s)
+			} else {
+				buf.Write(raw)
+			}
+			buf.WriteByte('\n')
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		if add != nil {
+			if err := add(&buf); err != nil {
+				return err
+			}
+		} else if !changed {
+			return errUnchanged
+		}
+
+		return writeFileAtomic(filename, buf.Bytes(), mode)
+	})
+}
+
+// writeFileAtomic replaces filename with data by renaming a temporary
+// file, so that readers never observe a partially written file.
+func writeFileAtomic(filename string, data []byte, mode os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// writeMu serializes writers within this process, since file locks are
+// held per process on some platforms.
+var writeMu sync.Mutex
+
+// withLock runs fn while holding an exclusive lock on filename+".lock".
+// A separate lock file is used because the known_hosts file itself is
+// replaced by rename.
+func withLock(filename string, fn func() error) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	f, err := os.OpenFile(filename+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	return fn()
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package knownhosts
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+func checkKnownHost(t *testing.T, filename, address string, want error) {
+	t.Helper()
+	cb, err := New(filename)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	err = cb(address, testAddr, edKey)
+	var keyErr *KeyError
+	switch {
+	case want == nil && err != nil:
+		t.Errorf("%s: got %v, want success", address, err)
+	case want != nil && !errors.As(err, &keyErr):
+		t.Errorf("%s: got %v, want KeyError", address, err)
+	}
+}
+
+func TestWriteKnownHost(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteKnownHost(&buf, "server.org:22", testAddr, edKey); err != nil {
+		t.Fatal(err)
+	}
+	want := "server.org,198.41.30.196 " + edKeyStr + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteKnownHost(&buf, "198.41.30.196:22", testAddr, edKey); err != nil {
+		t.Fatal(err)
+	}
+	if want := "198.41.30.196 " + edKeyStr + "\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAppendHostKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	// A file without a trailing newline.
+	if err := os.WriteFile(filename, []byte("other.org "+ecKeyStr), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendHostKey(filename, []string{"server.org"}, edKey, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendHostKey(filename, []string{"hashed.org:2222"}, edKey, true); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), b)
+	}
+	if !strings.HasPrefix(lines[2], "|1|") {
+		t.Errorf("hashed line %q does not start with |1|", lines[2])
+	}
+	checkKnownHost(t, filename, "server.org:22", nil)
+	checkKnownHost(t, filename, "hashed.org:2222", nil)
+}
+
+func TestAppendHostKeyConcurrent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := AppendHostKey(filename, []string{"server.org"}, edKey, true); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte("\n")); n != 10 {
+		t.Errorf("got %d lines, want 10", n)
+	}
+}
+
+func TestUpdateHostKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	content := "# comment\n" +
+		"server.org,other.org " + alternateEdKeyStr + " old key\n" +
+		"server.org " + ecKeyStr + "\n" +
+		"*.org " + alternateEdKeyStr + "\n"
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateHostKey(filename, "server.org:22", edKey); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# comment\n" +
+		"other.org " + alternateEdKeyStr + " old key\n" +
+		"server.org " + ecKeyStr + "\n" +
+		"*.org " + alternateEdKeyStr + "\n" +
+		"server.org " + edKeyStr + "\n"
+	if string(b) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b, want)
+	}
+	if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("file mode changed: %v, %v", fi.Mode(), err)
+	}
+}
+
+func TestUpdateHashedHostKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	content := HashHostname("server.org") + " " + alternateEdKeyStr + "\n" +
+		HashHostname("other.org") + " " + alternateEdKeyStr + "\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateHostKey(filename, "server.org:22", edKey); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "server.org") {
+		t.Errorf("new entry is not hashed:\n%s", b)
+	}
+	checkKnownHost(t, filename, "server.org:22", nil)
+	checkKnownHost(t, filename, "other.org:22", &KeyError{})
+}
+
+func TestUpdateHostKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	content := "server.org,other.org " + edKeyStr + "\n" +
+		"server.org " + alternateEdKeyStr + " old key\n" +
+		"*.org " + alternateEdKeyStr + "\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	update := HostKeysUpdater(filename, func(err error) { errs = append(errs, err) })
+
+	// Keys are not learned for unknown hosts.
+	update("new.org:22", testAddr, []ssh.PublicKey{edKey, ecKey})
+	if b, err := os.ReadFile(filename); err != nil || string(b) != content {
+		t.Errorf("file changed for an unknown host:\n%s", b)
+	}
+
+	update("server.org:22", testAddr, []ssh.PublicKey{edKey, ecKey})
+	want := "server.org,other.org " + edKeyStr + "\n" +
+		"*.org " + alternateEdKeyStr + "\n" +
+		"server.org " + ecKeyStr + "\n"
+	if b, err := os.ReadFile(filename); err != nil || string(b) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b, want)
+	}
+
+	// Announcing the same keys again doesn't change the file.
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update("server.org:22", testAddr, []ssh.PublicKey{ecKey, edKey})
+	if fi2, err := os.Stat(filename); err != nil || !os.SameFile(fi, fi2) {
+		t.Errorf("file rewritten without changes: %v", err)
+	}
+	if len(errs) > 0 {
+		t.Errorf("got errors %v", errs)
+	}
+}
+
+func TestUpdateHashedHostKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	content := HashHostname("server.org") + " " + edKeyStr + "\n" +
+		"@revoked * " + ecKeyStr + "\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateHostKeys(filename, "server.org:22", testAddr, []ssh.PublicKey{edKey, ecKey, alternateEdKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 || lines[0]+"\n"+lines[1]+"\n" != content {
+		t.Fatalf("got:\n%s\nwant the original lines and a new one", b)
+	}
+	if !strings.HasPrefix(lines[2], "|1|") || !strings.HasSuffix(lines[2], " "+alternateEdKeyStr) {
+		t.Errorf("got new line %q, want a hashed entry for the alternate key", lines[2])
+	}
+}
+
+func TestReplaceHostKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	hashed := HashHostname("server.org")
+	content := hashed + " " + alternateEdKeyStr + " comment\n" +
+		"@revoked * " + alternateEdKeyStr + "\n" +
+		"other.org " + ecKeyStr + "\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := ReplaceHostKey(filename, alternateEdKey, edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("replaced %d entries, want 1", n)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hashed + " " + edKeyStr + " comment\n" +
+		"@revoked * " + alternateEdKeyStr + "\n" +
+		"other.org " + ecKeyStr + "\n"
+	if string(b) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b, want)
+	}
+
+	if n, err := ReplaceHostKey(filename, alternateEdKey, edKey); n != 0 || err != nil {
+		t.Errorf("second ReplaceHostKey: %d, %v", n, err)
+	}
+}
@@ -35,18 +35,14 @@ const (
 // See RFC 4253, section 11.1.
 const msgDisconnect = 1
 
-// disconnectMsg is the message that signals a disconnect. It is also
-// the error type returned from mux.Wait()
+// disconnectMsg is the message that signals a disconnect. It is received
+// as a *DisconnectError.
 type disconnectMsg struct {
 	Reason   uint32 `sshtype:"1"`
 	Message  string
 	Language string
 }
 
-func (d *disconnectMsg) Error() string {
-	return fmt.Sprintf("ssh: disconnect, reason %d: %s", d.Reason, d.Message)
-}
-
 // See RFC 4253, section 7.1.
 const msgKexInit = 20
 
@@ -127,6 +123,46 @@ type kexDHGexRequestMsg struct {
 	MaxBits      uint32
 }
 
+// GSS-API key exchange. See RFC 4462, section 2.
+const msgKexGSSInit = 30
+
+type kexGSSInitMsg struct {
+	Token []byte `sshtype:"30"`
+	X     *big.Int
+}
+
+const msgKexGSSContinue = 31
+
+type kexGSSContinueMsg struct {
+	Token []byte `sshtype:"31"`
+}
+
+const msgKexGSSComplete = 32
+
+// kexGSSCompleteMsg is followed by the final GSS-API token of the server,
+// if HasToken is true.
+type kexGSSCompleteMsg struct {
+	Y        *big.Int `sshtype:"32"`
+	MIC      []byte
+	HasToken bool
+	Rest     []byte `ssh:"rest"`
+}
+
+const msgKexGSSHostKey = 33
+
+type kexGSSHostKeyMsg struct {
+	HostKey []byte `sshtype:"33"`
+}
+
+const msgKexGSSError = 34
+
+type kexGSSErrorMsg struct {
+	MajorStatus uint32 `sshtype:"34"`
+	MinorStatus uint32
+	Message     string
+	Language    string
+}
+
 // See RFC 4253, section 10.
 const msgServiceRequest = 5
 
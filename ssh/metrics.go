@@ -0,0 +1,132 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import "time"
+
+// ConnMetrics holds optional callbacks that receive events of a connection,
+// to export metrics or traces. Any of them may be nil.
+//
+// The callbacks are called synchronously from the goroutines running the
+// connection, so they must return quickly, and they must be safe for
+// concurrent use, also by multiple connections if the ConnMetrics is shared.
+type ConnMetrics struct {
+	// PacketSent and PacketReceived are called for each packet of the
+	// transport, with its message type and the length of its payload,
+	// before encryption and after decryption respectively.
+	PacketSent     func(msgType byte, length int)
+	PacketReceived func(msgType byte, length int)
+
+	// KeyExchange is called when a key exchange completes or fails,
+	// including the initial one.
+	KeyExchange func(KeyExchangeInfo)
+
+	// ChannelOpen is called when a channel is opened, that is when the
+	// peer confirms a channel opened with OpenChannel, or when a channel
+	// opened by the peer is accepted.
+	ChannelOpen func(ChannelInfo)
+
+	// ChannelClose is called when a channel that was opened is closed, by
+	// either side or because the connection was closed.
+	ChannelClose func(ChannelInfo)
+
+	// MessageDropped is called when a malformed message of the connection
+	// protocol is dropped, because Config.DropMalformedMessages is set,
+	// with its message type and the error it caused, to count or log them.
+	MessageDropped func(msgType byte, err error)
+}
+
+// KeyExchangeInfo describes a key exchange for ConnMetrics.KeyExchange.
+type KeyExchangeInfo struct {
+	// Initial is true for the first key exchange of the connection, and
+	// false when rekeying.
+	Initial bool
+
+	// Algorithm and HostKeyAlgorithm are the negotiated key exchange and
+	// host key algorithms. They are empty if negotiation failed.
+	Algorithm        string
+	HostKeyAlgorithm string
+
+	// Duration is the time between the start of the key exchange and its
+	// completion.
+	Duration time.Duration
+
+	// Err is the error that made the key exchange fail, if any.
+	Err error
+}
+
+// ChannelInfo describes a channel for ConnMetrics.ChannelOpen and
+// ConnMetrics.ChannelClose.
+type ChannelInfo struct {
+	// ChannelType is the type of the channel, such as "session".
+	ChannelType string
+
+	// Outbound is true for channels opened with OpenChannel, and false
+	// for channels opened by the peer.
+	Outbound bool
+
+	// OpenLatency is the time between the local request and the peer's
+	// confirmation for outbound channels, and between the peer's request
+	// and Accept for inbound ones.
+	OpenLatency time.Duration
+
+	// Duration, BytesSent and BytesReceived are the time since the channel
+	// was opened and the amount of channel data, including extended data,
+	// transferred over it. They are only set for ChannelClose.
+	Duration      time.Duration
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+// meteredTransport reports the packets of a keyingTransport to ConnMetrics.
+type meteredTransport struct {
+	keyingTransport
+	metrics *ConnMetrics
+}
+
+func (t *meteredTransport) readPacket() ([]byte, error) {
+	p, err := t.keyingTransport.readPacket()
+	if err == nil && t.metrics.PacketReceived != nil {
+		t.metrics.PacketReceived(p[0], len(p))
+	}
+	return p, err
+}
+
+func (t *meteredTransport) writePacket(p []byte) error {
+	// Report before writing, as the transport may overwrite p.
+	if t.metrics.PacketSent != nil {
+		t.metrics.PacketSent(p[0], len(p))
+	}
+	return t.keyingTransport.writePacket(p)
+}
+
+// channelOpened records that ch was opened, and reports it to metrics.
+func (ch *channel) channelOpened() {
+	now := time.Now()
+	ch.openedAt = now
+	ch.opened.Store(true)
+	if m := ch.mux.metrics; m != nil && m.ChannelOpen != nil {
+		m.ChannelOpen(ChannelInfo{
+			ChannelType: ch.chanType,
+			Outbound:    ch.direction == channelOutbound,
+			OpenLatency: now.Sub(ch.created),
+		})
+	}
+}
+
+// channelClosed reports that ch was closed to metrics, if it was opened.
+func (ch *channel) channelClosed() {
+	m := ch.mux.metrics
+	if m == nil || m.ChannelClose == nil || !ch.opened.Swap(false) {
+		return
+	}
+	m.ChannelClose(ChannelInfo{
+		ChannelType:   ch.chanType,
+		Outbound:      ch.direction == channelOutbound,
+		Duration:      time.Since(ch.openedAt),
+		BytesSent:     ch.bytesSent.Load(),
+		BytesReceived: ch.bytesReceived.Load(),
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"io"
+	"sync"
+	"testing"
+)
+
+type testMetrics struct {
+	mu                        sync.Mutex
+	packetsSent, packetsRecvd map[byte]int
+	kex                       []KeyExchangeInfo
+	opened, closed            []ChannelInfo
+}
+
+func (tm *testMetrics) metrics() *ConnMetrics {
+	tm.packetsSent = make(map[byte]int)
+	tm.packetsRecvd = make(map[byte]int)
+	return &ConnMetrics{
+		PacketSent: func(msgType byte, length int) {
+			tm.mu.Lock()
+			defer tm.mu.Unlock()
+			tm.packetsSent[msgType]++
+		},
+		PacketReceived: func(msgType byte, length int) {
+			tm.mu.Lock()
+			defer tm.mu.Unlock()
+			tm.packetsRecvd[msgType]++
+		},
+		KeyExchange: func(info KeyExchangeInfo) {
+			tm.mu.Lock()
+			defer tm.mu.Unlock()
+			tm.kex = append(tm.kex, info)
+		},
+		ChannelOpen: func(info ChannelInfo) {
+			tm.mu.Lock()
+			defer tm.mu.Unlock()
+			tm.opened = append(tm.opened, info)
+		},
+		ChannelClose: func(info ChannelInfo) {
+			tm.mu.Lock()
+			defer tm.mu.Unlock()
+			tm.closed = append(tm.closed, info)
+		},
+	}
+}
+
+func TestConnMetrics(t *testing.T) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	var serverMetrics, clientMetrics testMetrics
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.Metrics = serverMetrics.metrics()
+	serverConf.AddHostKey(testSigners["ecdsap256"])
+
+	serverDone := make(chan error, 1)
+	go func() {
+		conn, chans, reqs, err := NewServerConn(c2, serverConf)
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		defer conn.Close()
+		go DiscardRequests(reqs)
+		newCh := <-chans
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		go DiscardRequests(reqs)
+		_, err = io.Copy(ch, ch)
+		ch.Close()
+		serverDone <- err
+	}()
+
+	clientConf := &ClientConfig{HostKeyCallback: InsecureIgnoreHostKey()}
+	clientConf.Metrics = clientMetrics.metrics()
+	conn, chans, reqs, err := NewClientConn(c1, "", clientConf)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	client := NewClient(conn, chans, reqs)
+	defer client.Close()
+
+	ch, reqs2, err := client.OpenChannel("echo", nil)
+	if err != nil {
+		t.Fatalf("OpenChannel: %v", err)
+	}
+	go DiscardRequests(reqs2)
+	msg := []byte("hello, metrics")
+	if _, err := ch.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	echo, err := io.ReadAll(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(echo) != string(msg) {
+		t.Fatalf("got %q, want %q", echo, msg)
+	}
+	if err := <-serverDone; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+	ch.Close()
+	client.Close()
+	client.Wait()
+
+	clientMetrics.mu.Lock()
+	defer clientMetrics.mu.Unlock()
+	serverMetrics.mu.Lock()
+	defer serverMetrics.mu.Unlock()
+
+	if len(clientMetrics.kex) != 1 || !clientMetrics.kex[0].Initial || clientMetrics.kex[0].Err != nil || clientMetrics.kex[0].Algorithm == "" {
+		t.Errorf("client key exchanges: %+v", clientMetrics.kex)
+	}
+	if len(serverMetrics.kex) != 1 || serverMetrics.kex[0].HostKeyAlgorithm != KeyAlgoECDSA256 {
+		t.Errorf("server key exchanges: %+v", serverMetrics.kex)
+	}
+	for _, msgType := range []byte{msgKexInit, msgNewKeys, msgChannelOpen, msgChannelData} {
+		if clientMetrics.packetsSent[msgType] == 0 || serverMetrics.packetsRecvd[msgType] == 0 {
+			t.Errorf("message type %d: %d sent, %d received", msgType, clientMetrics.packetsSent[msgType], serverMetrics.packetsRecvd[msgType])
+		}
+	}
+
+	if len(clientMetrics.opened) != 1 || !clientMetrics.opened[0].Outbound || clientMetrics.opened[0].ChannelType != "echo" {
+		t.Errorf("client opened channels: %+v", clientMetrics.opened)
+	}
+	if len(serverMetrics.opened) != 1 || serverMetrics.opened[0].Outbound {
+		t.Errorf("server opened channels: %+v", serverMetrics.opened)
+	}
+	if len(clientMetrics.closed) != 1 {
+		t.Fatalf("client closed channels: %+v", clientMetrics.closed)
+	}
+	if got := clientMetrics.closed[0]; got.BytesSent != uint64(len(msg)) || got.BytesReceived != uint64(len(msg)) {
+		t.Errorf("client channel sent %d bytes and received %d, want %d", got.BytesSent, got.BytesReceived, len(msg))
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.24
+
+package ssh
+
+import (
+	"crypto"
+	"crypto/mlkem"
+	"io"
+)
+
+const kexAlgoMLKEM768x25519SHA256 = "mlkem768x25519-sha256"
+
+// crypto/mlkem is only available from Go 1.24, so the ML-KEM hybrid key
+// exchange is registered, at the top of the preference order, only then.
+func init() {
+	supportedKexAlgos = append([]string{kexAlgoMLKEM768x25519SHA256}, supportedKexAlgos...)
+	preferredKexAlgos = append([]string{kexAlgoMLKEM768x25519SHA256}, preferredKexAlgos...)
+	kexAlgoMap[kexAlgoMLKEM768x25519SHA256] = &hybridKEM{mlkem768KEM{}, crypto.SHA256}
+}
+
+// mlkem768KEM is ML-KEM-768, as specified in FIPS 203.
+type mlkem768KEM struct{}
+
+func (mlkem768KEM) encapsulationKeySize() int { return mlkem.EncapsulationKeySize768 }
+
+func (mlkem768KEM) ciphertextSize() int { return mlkem.CiphertextSize768 }
+
+func (mlkem768KEM) generateKey(rand io.Reader) ([]byte, func([]byte) ([]byte, error), error) {
+	seed := make([]byte, mlkem.SeedSize)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, nil, err
+	}
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dk.EncapsulationKey().Bytes(), dk.Decapsulate, nil
+}
+
+// encapsulate ignores rand, as crypto/mlkem always uses crypto/rand.
+func (mlkem768KEM) encapsulate(rand io.Reader, encapsulationKey []byte) ([]byte, []byte, error) {
+	ek, err := mlkem.NewEncapsulationKey768(encapsulationKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedKey, ciphertext := ek.Encapsulate()
+	return ciphertext, sharedKey, nil
+}
@@ -6,8 +6,8 @@ package ssh
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"sync"
 	"sync/atomic"
@@ -91,12 +91,60 @@ type mux struct {
 
 	incomingChannels chan NewChannel
 
-	globalSentMu     sync.Mutex
-	globalResponses  chan interface{}
+	globalReplies    replyQueue
+	pings            pingQueue
 	incomingRequests chan *Request
 
 	errCond *sync.Cond
 	err     error
+
+	// metrics is the ConnMetrics of the connection, if any.
+	metrics *ConnMetrics
+
+	// config is the Config of the connection, if any. It holds the
+	// channel flow control settings.
+	config *Config
+
+	// sendLimits and receiveLimits are the rate limiters of the
+	// connection, which apply to all its channels.
+	sendLimits, receiveLimits rateLimits
+
+	// recordSession, if not nil, returns the recorder of each session
+	// channel accepted by a server. See ServerConfig.RecordSession.
+	recordSession func() (SessionRecorder, error)
+
+	// handleRequest, if not nil, is called by loop with the incoming
+	// global requests before they are delivered on incomingRequests. It
+	// reports whether it handled the request, which is then not delivered.
+	handleRequest func(*Request) bool
+
+	// noMoreSessions is set once the peer sent a
+	// "no-more-sessions@openssh.com" request, after which opening a
+	// "session" channel aborts the connection. It is only used by loop.
+	noMoreSessions bool
+
+	// dropMalformed makes loop drop the messages reported by a
+	// malformedMessageError instead of exiting. See
+	// Config.DropMalformedMessages.
+	dropMalformed bool
+}
+
+// A malformedMessageError reports a connection protocol message that is
+// malformed or violates RFC 4254, but which can be dropped without
+// corrupting the state of the connection.
+type malformedMessageError struct {
+	msgType byte
+	err     error
+}
+
+func (e *malformedMessageError) Error() string {
+	return e.err.Error()
+}
+
+// malformed returns a malformedMessageError for a message of type msgType
+// that failed with err.
+func malformed(msgType byte, err error) error {
+	return &malformedMessageError{msgType: msgType, err: err}
 }
 
 // When debugging, each new chanList instantiation has a different
@@ -114,16 +162,46 @@ func (m *mux) Wait() error {
 
 // newMux returns a mux that runs over the given connection.
 func newMux(p packetConn) *mux {
+	return newMuxRequestHandler(p, nil)
+}
+
+// newMuxRequestHandler is like newMux, but passes the incoming global
+// requests to handleRequest first. See mux.handleRequest.
+func newMuxRequestHandler(p packetConn, handleRequest func(*Request) bool) *mux {
+	var config *Config
+	if t, ok := p.(*handshakeTransport); ok {
+		config = t.config
+	}
+	return newMuxConfig(p, config, handleRequest)
+}
+
+// newMuxConfig is like newMuxRequestHandler, with the settings of config,
+// which may be nil.
+func newMuxConfig(p packetConn, config *Config, handleRequest func(*Request) bool) *mux {
 	m := &mux{
+		handleRequest:    handleRequest,
 		conn:             p,
 		incomingChannels: make(chan NewChannel, chanSize),
-		globalResponses:  make(chan interface{}, 1),
 		incomingRequests: make(chan *Request, chanSize),
 		errCond:          newCond(),
 	}
 	if debugMux {
 		m.chanList.offset = atomic.AddUint32(&globalOff, 1)
 	}
+	if config != nil {
+		m.metrics = config.Metrics
+		m.config = config
+		m.dropMalformed = config.DropMalformedMessages
+		if config.ConnRateLimit != nil {
+			send, receive := config.ConnRateLimit()
+			if send != nil {
+				m.sendLimits = rateLimits{send}
+			}
+			if receive != nil {
+				m.receiveLimits = rateLimits{receive}
+			}
+		}
+	}
 
 	go m.loop()
 	return m
@@ -138,35 +216,29 @@ func (m *mux) sendMessage(msg interface{}) error {
 }
 
 func (m *mux) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
-	if wantReply {
-		m.globalSentMu.Lock()
-		defer m.globalSentMu.Unlock()
+	if !wantReply {
+		return false, nil, m.sendMessage(globalRequestMsg{
+			Type: name,
+			Data: payload,
+		})
 	}
-
-	if err := m.sendMessage(globalRequestMsg{
-		Type:      name,
-		WantReply: wantReply,
-		Data:      payload,
-	}); err != nil {
+	r, err := m.SendRequestAsync(name, payload)
+	if err != nil {
 		return false, nil, err
 	}
+	return r.Wait()
+}
 
-	if !wantReply {
-		return false, nil, nil
-	}
-
-	msg, ok := <-m.globalResponses
-	if !ok {
-		return false, nil, io.EOF
-	}
-	switch msg := msg.(type) {
-	case *globalRequestFailureMsg:
-		return false, msg.Data, nil
-	case *globalRequestSuccessMsg:
-		return true, msg.Data, nil
-	default:
-		return false, nil, fmt.Errorf("ssh: unexpected response to request: %#v", msg)
-	}
+// SendRequestAsync sends a global request with want reply set, and returns
+// its pending reply. See AsyncRequestSender.
+func (m *mux) SendRequestAsync(name string, payload []byte) (*RequestReply, error) {
+	return m.globalReplies.send(func() error {
+		return m.sendMessage(globalRequestMsg{
+			Type:      name,
+			WantReply: true,
+			Data:      payload,
+		})
+	})
 }
 
 // ackRequest must be called after processing a global request that
@@ -188,6 +260,14 @@ func (m *mux) loop() {
 	var err error
 	for err == nil {
 		err = m.onePacket()
+		if merr, ok := err.(*malformedMessageError); ok {
+			if m.dropMalformed {
+				m.messageDropped(merr)
+				err = nil
+			} else {
+				err = merr.err
+			}
+		}
 	}
 
 	for _, ch := range m.chanList.dropAll() {
@@ -196,7 +276,8 @@ func (m *mux) loop() {
 
 	close(m.incomingChannels)
 	close(m.incomingRequests)
-	close(m.globalResponses)
+	m.globalReplies.close()
+	m.pings.close()
 
 	m.conn.Close()
 
@@ -210,6 +291,16 @@ func (m *mux) loop() {
 	}
 }
 
+// messageDropped reports a message dropped by loop to the metrics of m.
+func (m *mux) messageDropped(err *malformedMessageError) {
+	if debugMux {
+		log.Printf("dropped(%d): message type %d: %v", m.chanList.offset, err.msgType, err.err)
+	}
+	if m.metrics != nil && m.metrics.MessageDropped != nil {
+		m.metrics.MessageDropped(err.msgType, err.err)
+	}
+}
+
 // onePacket reads and processes one packet.
 func (m *mux) onePacket() error {
 	packet, err := m.conn.readPacket()
@@ -236,14 +327,21 @@ func (m *mux) onePacket() error {
 	case msgPing:
 		var msg pingMsg
 		if err := Unmarshal(packet, &msg); err != nil {
-			return fmt.Errorf("failed to unmarshal ping@openssh.com message: %w", err)
+			return malformed(packet[0], fmt.Errorf("failed to unmarshal ping@openssh.com message: %w", err))
 		}
 		return m.sendMessage(pongMsg(msg))
+	case msgPong:
+		var msg pongMsg
+		if err := Unmarshal(packet, &msg); err != nil {
+			return malformed(packet[0], fmt.Errorf("failed to unmarshal ping@openssh.com message: %w", err))
+		}
+		m.pings.complete(msg.Data)
+		return nil
 	}
 
 	// assume a channel packet.
 	if len(packet) < 5 {
-		return parseError(packet[0])
+		return malformed(packet[0], parseError(packet[0]))
 	}
 	id := binary.BigEndian.Uint32(packet[1:])
 	ch := m.chanList.getChan(id)
@@ -257,19 +355,25 @@ func (m *mux) onePacket() error {
 func (m *mux) handleGlobalPacket(packet []byte) error {
 	msg, err := decode(packet)
 	if err != nil {
-		return err
+		return malformed(packet[0], err)
 	}
 
 	switch msg := msg.(type) {
 	case *globalRequestMsg:
-		m.incomingRequests <- &Request{
+		req := &Request{
 			Type:      msg.Type,
 			WantReply: msg.WantReply,
 			Payload:   msg.Data,
 			mux:       m,
 		}
-	case *globalRequestSuccessMsg, *globalRequestFailureMsg:
-		m.globalResponses <- msg
+		if m.handleRequest != nil && m.handleRequest(req) {
+			return nil
+		}
+		m.incomingRequests <- req
+	case *globalRequestSuccessMsg:
+		m.globalReplies.complete(true, msg.Data)
+	case *globalRequestFailureMsg:
+		m.globalReplies.complete(false, msg.Data)
 	default:
 		panic(fmt.Sprintf("not a global message %#v", msg))
 	}
@@ -281,7 +385,7 @@ func (m *mux) handleGlobalPacket(packet []byte) error {
 func (m *mux) handleChannelOpen(packet []byte) error {
 	var msg channelOpenMsg
 	if err := Unmarshal(packet, &msg); err != nil {
-		return err
+		return malformed(packet[0], err)
 	}
 
 	if msg.MaxPacketSize < minPacketLength || msg.MaxPacketSize > 1<<31 {
@@ -294,6 +398,10 @@ func (m *mux) handleChannelOpen(packet []byte) error {
 		return m.sendMessage(failMsg)
 	}
 
+	if m.noMoreSessions && msg.ChanType == "session" {
+		return errors.New("ssh: session channel opened after " + noMoreSessionsRequest)
+	}
+
 	c := m.newChannel(msg.ChanType, channelInbound, msg.TypeSpecificData)
 	c.remoteId = msg.PeersID
 	c.maxRemotePayload = msg.MaxPacketSize
@@ -314,7 +422,7 @@ func (m *mux) OpenChannel(chanType string, extra []byte) (Channel, <-chan *Reque
 func (m *mux) openChannel(chanType string, extra []byte) (*channel, error) {
 	ch := m.newChannel(chanType, channelOutbound, extra)
 
-	ch.maxIncomingPayload = channelMaxPacket
+	ch.maxIncomingPayload = ch.maxPacket
 
 	open := channelOpenMsg{
 		ChanType:         chanType,
@@ -329,6 +437,7 @@ func (m *mux) openChannel(chanType string, extra []byte) (*channel, error) {
 
 	switch msg := (<-ch.msg).(type) {
 	case *channelOpenConfirmMsg:
+		ch.channelOpened()
 		return ch, nil
 	case *channelOpenFailureMsg:
 		return nil, &OpenChannelError{msg.Reason, msg.Message}
@@ -340,7 +449,7 @@ func (m *mux) openChannel(chanType string, extra []byte) (*channel, error) {
 func (m *mux) handleUnknownChannelPacket(id uint32, packet []byte) error {
 	msg, err := decode(packet)
 	if err != nil {
-		return err
+		return malformed(packet[0], err)
 	}
 
 	switch msg := msg.(type) {
@@ -354,6 +463,6 @@ func (m *mux) handleUnknownChannelPacket(id uint32, packet []byte) error {
 		}
 		return nil
 	default:
-		return fmt.Errorf("ssh: invalid channel %d", id)
+		return malformed(packet[0], fmt.Errorf("ssh: invalid channel %d", id))
 	}
 }
@@ -5,11 +5,14 @@
 package ssh
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func muxPair() (*mux, *mux) {
@@ -668,6 +671,100 @@ func TestMuxChannelRequestUnblock(t *testing.T) {
 	}
 }
 
+func TestMuxGlobalRequestAsync(t *testing.T) {
+	clientMux, serverMux := muxPair()
+	defer serverMux.Close()
+	defer clientMux.Close()
+
+	// Send all the requests before the server handles any of them.
+	names := []string{"yes", "no", "yes", "yes", "no"}
+	var replies []*RequestReply
+	for _, name := range names {
+		r, err := clientMux.SendRequestAsync(name, []byte(name))
+		if err != nil {
+			t.Fatalf("SendRequestAsync(%q): %v", name, err)
+		}
+		replies = append(replies, r)
+	}
+	select {
+	case <-replies[0].Done():
+		t.Fatal("reply received before the request was handled")
+	default:
+	}
+
+	go func() {
+		for r := range serverMux.incomingRequests {
+			r.Reply(r.Type == "yes", append([]byte("re:"), r.Payload...))
+		}
+	}()
+	for i, r := range replies {
+		ok, data, err := r.Wait()
+		if err != nil || ok != (names[i] == "yes") || string(data) != "re:"+names[i] {
+			t.Errorf("reply %d to %q: %v %q %v", i, names[i], ok, data, err)
+		}
+	}
+}
+
+func TestMuxChannelRequestAsync(t *testing.T) {
+	client, server, mux := channelPair(t)
+	defer server.Close()
+	defer client.Close()
+	defer mux.Close()
+
+	var replies []*RequestReply
+	for i := 0; i < 10; i++ {
+		r, err := client.SendRequestAsync(fmt.Sprint(i%3 == 0), nil)
+		if err != nil {
+			t.Fatalf("SendRequestAsync: %v", err)
+		}
+		replies = append(replies, r)
+		// Mix in blocking requests, which must wait for the pending
+		// replies.
+		if i == 4 {
+			go func() {
+				for r := range server.incomingRequests {
+					r.Reply(r.Type == "true", nil)
+				}
+			}()
+			if ok, err := client.SendRequest("true", true, nil); !ok || err != nil {
+				t.Errorf("SendRequest: %v %v", ok, err)
+			}
+		}
+	}
+	for i, r := range replies {
+		if ok, data, err := r.Wait(); err != nil || ok != (i%3 == 0) || data != nil {
+			t.Errorf("reply %d: %v %q %v", i, ok, data, err)
+		}
+	}
+}
+
+func TestMuxRequestAsyncUnblock(t *testing.T) {
+	a, b, connB := channelPair(t)
+	defer a.Close()
+	defer b.Close()
+	defer connB.Close()
+
+	chanReply, err := a.SendRequestAsync("hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globalReply, err := a.mux.SendRequestAsync("hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-b.incomingRequests
+	connB.conn.Close()
+
+	for _, r := range []*RequestReply{chanReply, globalReply} {
+		if _, _, err := r.Wait(); err != io.EOF {
+			t.Errorf("want EOF, got %v", err)
+		}
+	}
+	if _, err := a.SendRequestAsync("hello", nil); err != io.EOF {
+		t.Errorf("SendRequestAsync on a closed channel: want EOF, got %v", err)
+	}
+}
+
 func TestMuxCloseChannel(t *testing.T) {
 	r, w, mux := channelPair(t)
 	defer mux.Close()
@@ -837,3 +934,275 @@ func TestDebug(t *testing.T) {
 		t.Error("transport debug switched on")
 	}
 }
+
+func TestChannelFlowControlConfig(t *testing.T) {
+	tests := []struct {
+		config                *Config
+		wantWindow, wantMaxPk uint32
+	}{
+		{nil, channelWindowSize, channelMaxPacket},
+		{&Config{}, channelWindowSize, channelMaxPacket},
+		{&Config{ChannelWindowSize: 16 << 20, ChannelMaxPacket: 1 << 16}, 16 << 20, 1 << 16},
+		{&Config{ChannelMaxPacket: 1 << 20}, channelWindowSize, maxChannelMaxPacket},
+		{&Config{ChannelWindowSize: 100}, channelMaxPacket, channelMaxPacket},
+		{&Config{
+			ChannelWindowSize: 1 << 20,
+			ChannelFlowControl: func(chanType string) (uint32, uint32) {
+				if chanType == "bulk" {
+					return 8 << 20, 0
+				}
+				return 0, 0
+			},
+		}, 8 << 20, channelMaxPacket},
+	}
+	for i, tt := range tests {
+		window, maxPacket := tt.config.channelFlowControl("bulk")
+		if window != tt.wantWindow || maxPacket != tt.wantMaxPk {
+			t.Errorf("%d: got window %d and max packet %d, want %d and %d", i, window, maxPacket, tt.wantWindow, tt.wantMaxPk)
+		}
+	}
+}
+
+func TestChannelWindowBlocked(t *testing.T) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.ChannelWindowSize = 4096
+	serverConf.ChannelMaxPacket = 1024
+	serverConf.AddHostKey(testSigners["ecdsap256"])
+
+	accepted := make(chan Channel, 1)
+	go func() {
+		conn, chans, reqs, err := NewServerConn(c2, serverConf)
+		if err != nil {
+			t.Errorf("NewServerConn: %v", err)
+			close(accepted)
+			return
+		}
+		defer conn.Close()
+		go DiscardRequests(reqs)
+		ch, reqs, err := (<-chans).Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			close(accepted)
+			return
+		}
+		go DiscardRequests(reqs)
+		accepted <- ch
+		conn.Wait()
+	}()
+
+	var mu sync.Mutex
+	var blockedTypes []string
+	var waited time.Duration
+	clientConf := &ClientConfig{HostKeyCallback: InsecureIgnoreHostKey()}
+	clientConf.ChannelWindowBlocked = func(chanType string, d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		blockedTypes = append(blockedTypes, chanType)
+		waited += d
+	}
+	conn, chans, reqs, err := NewClientConn(c1, "", clientConf)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	client := NewClient(conn, chans, reqs)
+	defer client.Close()
+
+	ch, reqs2, err := client.OpenChannel("bulk", nil)
+	if err != nil {
+		t.Fatalf("OpenChannel: %v", err)
+	}
+	go DiscardRequests(reqs2)
+	serverCh := <-accepted
+	if serverCh == nil {
+		t.FailNow()
+	}
+	clientCh := ch.(*channel)
+	if clientCh.maxRemotePayload != 1024 {
+		t.Errorf("got max remote payload %d, want 1024", clientCh.maxRemotePayload)
+	}
+
+	data := make([]byte, 3*4096)
+	writeDone := make(chan error, 1)
+	go func() {
+		_, err := ch.Write(data)
+		writeDone <- err
+	}()
+
+	// Read only once the writer has exhausted the window, so that it is
+	// certain to block.
+	for {
+		w := &clientCh.remoteWin
+		w.L.Lock()
+		blocked := w.win == 0 && w.writeWaiters > 0
+		w.L.Unlock()
+		if blocked {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := io.ReadFull(serverCh, make([]byte, len(data))); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if err := <-writeDone; err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(blockedTypes) == 0 || blockedTypes[0] != "bulk" || waited <= 0 {
+		t.Errorf("got blocked callbacks for %q, waiting %v", blockedTypes, waited)
+	}
+}
+
+// droppingMux returns a mux dropping malformed messages, which counts them
+// in dropped, the transport of its peer, and the channel it accepted from a
+// channel opened by the peer. The incoming channels of the mux are
+// rejected, and the requests of the accepted channel are discarded.
+func droppingMux(t testing.TB, dropped *atomic.Int32) (m *mux, peer packetConn, ch *channel) {
+	a, b := memPipe()
+	m = newMuxConfig(a, &Config{
+		DropMalformedMessages: true,
+		Metrics: &ConnMetrics{
+			MessageDropped: func(msgType byte, err error) { dropped.Add(1) },
+		},
+	}, nil)
+	t.Cleanup(func() { m.Close() })
+
+	if err := b.writePacket(Marshal(channelOpenMsg{ChanType: "chan", PeersID: 7, PeersWindow: 1 << 20, MaxPacketSize: 1 << 15})); err != nil {
+		t.Fatal(err)
+	}
+	newCh, ok := <-m.incomingChannels
+	if !ok {
+		t.Fatal("no incoming channel")
+	}
+	c, reqs, err := newCh.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go DiscardRequests(reqs)
+	go func() {
+		for newCh := range m.incomingChannels {
+			newCh.Reject(Prohibited, "")
+		}
+	}()
+	return m, b, c.(*channel)
+}
+
+func TestMuxDropMalformedMessages(t *testing.T) {
+	var dropped atomic.Int32
+	m, peer, ch := droppingMux(t, &dropped)
+	id := ch.localId
+
+	data := func(id uint32, length uint32, payload string) []byte {
+		p := []byte{msgChannelData, 0, 0, 0, 0, 0, 0, 0, 0}
+		marshalUint32(p[1:], id)
+		marshalUint32(p[5:], length)
+		return append(p, payload...)
+	}
+	bad := [][]byte{
+		data(id+100, 1, "x"),                  // unknown channel
+		data(id, 1, "")[:5],                   // truncated data
+		data(id, 10, "x"),                     // wrong length
+		data(id, ch.maxIncomingPayload+1, ""), // too large
+		data(id, 1, "x")[:3],                  // too short for a channel message
+		Marshal(windowAdjustMsg{PeersID: id, AdditionalBytes: 1<<32 - 1}),
+		Marshal(channelOpenConfirmMsg{PeersID: id}), // on an inbound channel
+		{msgChannelRequest, 0, 0, 0, byte(id), 0, 0},
+		{msgGlobalRequest, 0, 0, 0, 9},
+		{msgChannelOpen, 1},
+		{msgPing},
+	}
+	for _, p := range bad {
+		if err := peer.writePacket(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := peer.writePacket(data(id, 5, "hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(ch, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("got %q and error %v, want hello", buf, err)
+	}
+	if err := peer.writePacket(Marshal(globalRequestMsg{Type: "check"})); err != nil {
+		t.Fatal(err)
+	}
+	if req, ok := <-m.incomingRequests; !ok || req.Type != "check" {
+		t.Fatalf("got request %v, want check", req)
+	}
+	if n := dropped.Load(); n != int32(len(bad)) {
+		t.Errorf("got %d dropped messages, want %d", n, len(bad))
+	}
+}
+
+func FuzzMuxMessages(f *testing.F) {
+	// The input is a sequence of packets, each prefixed with its length
+	// as a uint16, for the channel opened by the peer in droppingMux,
+	// whose local ID is 0.
+	packets := func(msgs ...[]byte) []byte {
+		var b []byte
+		for _, msg := range msgs {
+			b = binary.BigEndian.AppendUint16(b, uint16(len(msg)))
+			b = append(b, msg...)
+		}
+		return b
+	}
+	f.Add(packets(Marshal(channelDataMsg{Length: 5, Rest: []byte("hello")})))
+	f.Add(packets(Marshal(windowAdjustMsg{AdditionalBytes: 1 << 20}), Marshal(channelEOFMsg{})))
+	f.Add(packets(Marshal(channelRequestMsg{Request: "exec", WantReply: true, RequestSpecificData: []byte("\x00\x00\x00\x02ls")})))
+	f.Add(packets(Marshal(globalRequestMsg{Type: "keepalive@openssh.com", WantReply: true}), Marshal(channelCloseMsg{})))
+	f.Add(packets(Marshal(channelOpenMsg{ChanType: "direct-tcpip", PeersID: 1, PeersWindow: 1 << 10, MaxPacketSize: 1 << 10})))
+	f.Add(packets([]byte{msgChannelExtendedData, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 'x'}))
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		var dropped atomic.Int32
+		m, peer, ch := droppingMux(t, &dropped)
+		go io.Copy(io.Discard, ch)
+		go io.Copy(io.Discard, ch.Stderr())
+
+		for len(in) >= 2 {
+			n := int(binary.BigEndian.Uint16(in))
+			in = in[2:]
+			if n > len(in) {
+				n = len(in)
+			}
+			// The transport never returns empty packets.
+			if n > 0 {
+				peer.writePacket(in[:n])
+			}
+			in = in[n:]
+		}
+		peer.writePacket(Marshal(globalRequestMsg{Type: "check"}))
+
+		// The mux must either still work, or have closed the connection
+		// because of a message it can't drop.
+		checked := make(chan struct{})
+		go func() {
+			for req := range m.incomingRequests {
+				if req.Type == "check" {
+					close(checked)
+				} else if req.WantReply {
+					req.Reply(false, nil)
+				}
+			}
+		}()
+		exited := make(chan struct{})
+		go func() {
+			m.Wait()
+			close(exited)
+		}()
+		select {
+		case <-checked:
+		case <-exited:
+		case <-time.After(10 * time.Second):
+			t.Fatal("mux is blocked")
+		}
+	})
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrPingUnsupported is returned by Ping if the peer did not announce the
+// ping@openssh.com extension.
+var ErrPingUnsupported = errors.New("ssh: peer does not support ping@openssh.com")
+
+// PingConn is implemented by the Conn values of this package. The
+// ping@openssh.com extension of OpenSSH measures the round-trip time of a
+// connection with a message that the peer answers directly, unlike global
+// requests, which may be delayed by their handlers.
+//
+// Incoming pings are always answered.
+type PingConn interface {
+	Conn
+
+	// Ping sends a ping@openssh.com message with the given data, waits for
+	// its pong and returns the time this took. A client can only ping
+	// servers that announce the extension in their SSH_MSG_EXT_INFO, and
+	// otherwise gets ErrPingUnsupported. Clients don't announce it, so a
+	// server always sends the ping.
+	//
+	// If ctx is done before the pong is received, Ping returns ctx.Err(),
+	// and if the connection is closed, io.EOF.
+	Ping(ctx context.Context, data []byte) (time.Duration, error)
+}
+
+func (c *connection) Ping(ctx context.Context, data []byte) (time.Duration, error) {
+	if !c.pingSupported {
+		return 0, ErrPingUnsupported
+	}
+	start := time.Now()
+	p, err := c.pings.send(string(data), func() error {
+		return c.sendMessage(pingMsg{Data: string(data)})
+	})
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		c.pings.remove(p)
+		return 0, ctx.Err()
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	return time.Since(start), nil
+}
+
+// pendingPing is a ping awaiting its pong.
+type pendingPing struct {
+	data string
+	done chan struct{}
+	err  error
+}
+
+// pingQueue holds the pings awaiting a pong. A pong completes the oldest
+// ping with the same data, so that pongs for canceled pings and unsolicited
+// ones are ignored.
+type pingQueue struct {
+	mu      sync.Mutex
+	pending []*pendingPing
+	closed  bool
+}
+
+// send queues a ping with data and calls send to write it.
+func (q *pingQueue) send(data string, send func() error) (*pendingPing, error) {
+	p := &pendingPing{data: data, done: make(chan struct{})}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, io.EOF
+	}
+	q.pending = append(q.pending, p)
+	q.mu.Unlock()
+
+	if err := send(); err != nil {
+		q.remove(p)
+		return nil, err
+	}
+	return p, nil
+}
+
+// remove forgets p, whose pong is no longer awaited.
+func (q *pingQueue) remove(p *pendingPing) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, pp := range q.pending {
+		if pp == p {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// complete completes the oldest ping with data.
+func (q *pingQueue) complete(data string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, p := range q.pending {
+		if p.data == data {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			close(p.done)
+			return
+		}
+	}
+}
+
+// close fails the pending pings with io.EOF, as well as those sent
+// afterwards.
+func (q *pingQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, p := range q.pending {
+		p.err = io.EOF
+		close(p.done)
+	}
+	q.pending, q.closed = nil, true
+}
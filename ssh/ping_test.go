@@ -0,0 +1,93 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+	servers := make(chan *ServerConn, 1)
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	go func() {
+		conn, chans, reqs, err := NewServerConn(c1, serverConf)
+		if err != nil {
+			t.Error(err)
+			close(servers)
+			return
+		}
+		go DiscardRequests(reqs)
+		go func() {
+			for ch := range chans {
+				ch.Reject(Prohibited, "")
+			}
+		}()
+		servers <- conn
+	}()
+	client, _, reqs, err := NewClientConn(c2, "", &ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go DiscardRequests(reqs)
+	server := <-servers
+	if server == nil {
+		t.FailNow()
+	}
+
+	for _, c := range []Conn{client, server.Conn} {
+		pc, ok := c.(PingConn)
+		if !ok {
+			t.Fatalf("%T does not implement PingConn", c)
+		}
+		if _, err := pc.Ping(context.Background(), []byte("hello")); err != nil {
+			t.Errorf("Ping: %v", err)
+		}
+	}
+
+	// A canceled ping doesn't confuse the following ones.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.(PingConn).Ping(ctx, []byte("canceled")); err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if _, err := client.(PingConn).Ping(context.Background(), []byte("next")); err != nil {
+		t.Errorf("Ping after cancellation: %v", err)
+	}
+
+	// Unsolicited pongs are ignored.
+	if err := server.Conn.(*connection).sendMessage(pongMsg{Data: "unsolicited"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.(PingConn).Ping(context.Background(), nil); err != nil {
+		t.Errorf("Ping after an unsolicited pong: %v", err)
+	}
+
+	client.Close()
+	server.Wait()
+	if _, err := server.Conn.(PingConn).Ping(context.Background(), nil); err == nil {
+		t.Error("Ping succeeded on a closed connection")
+	}
+}
+
+func TestPingUnsupported(t *testing.T) {
+	c := &connection{mux: &mux{}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.Ping(ctx, nil); err != ErrPingUnsupported {
+		t.Errorf("got error %v, want ErrPingUnsupported", err)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"fmt"
+)
+
+// Names of the algorithm policies for Config.AlgorithmPolicy.
+const (
+	// PolicyStrict only allows modern algorithms: no SHA-1, no CBC, RC4 or
+	// 3DES ciphers, no finite field Diffie-Hellman groups below 4096 bits,
+	// and only encrypt-then-MAC or AEAD integrity protection.
+	PolicyStrict = "strict"
+
+	// PolicyCompat allows all the supported algorithms, including the
+	// legacy ones needed to connect to old implementations.
+	PolicyCompat = "compat"
+
+	// PolicyFIPS only allows algorithms approved by FIPS 140-3: NIST curves
+	// and finite field groups, AES, SHA-2, RSA and ECDSA. It only restricts
+	// the negotiated algorithms, it doesn't make their implementations
+	// FIPS validated.
+	PolicyFIPS = "fips"
+)
+
+// Algorithms lists algorithms by category, in order of preference.
+type Algorithms struct {
+	KeyExchanges   []string
+	Ciphers        []string
+	MACs           []string
+	HostKeys       []string
+	PublicKeyAuths []string
+}
+
+var policies = map[string]Algorithms{
+	PolicyStrict: {
+		KeyExchanges: []string{
+			"mlkem768x25519-sha256",
+			kexAlgoSNTRUP761x25519SHA512, kexAlgoSNTRUP761x25519SHA512OpenSSH,
+			kexAlgoCurve25519SHA256, kexAlgoCurve25519SHA256LibSSH,
+			kexAlgoECDH256, kexAlgoECDH384, kexAlgoECDH521,
+			kexAlgoDH16SHA512,
+		},
+		Ciphers: []string{
+			gcm128CipherID, gcm256CipherID,
+			chacha20Poly1305ID,
+			"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		},
+		HostKeys: []string{
+			CertAlgoRSASHA256v01, CertAlgoRSASHA512v01,
+			CertAlgoECDSA256v01, CertAlgoECDSA384v01, CertAlgoECDSA521v01,
+			CertAlgoED25519v01,
+			KeyAlgoECDSA256, KeyAlgoECDSA384, KeyAlgoECDSA521,
+			KeyAlgoRSASHA256, KeyAlgoRSASHA512,
+			KeyAlgoED25519,
+		},
+		PublicKeyAuths: []string{
+			KeyAlgoED25519,
+			KeyAlgoSKED25519, KeyAlgoSKECDSA256,
+			KeyAlgoECDSA256, KeyAlgoECDSA384, KeyAlgoECDSA521,
+			KeyAlgoRSASHA256, KeyAlgoRSASHA512,
+		},
+	},
+	PolicyFIPS: {
+		KeyExchanges: []string{
+			kexAlgoECDH256, kexAlgoECDH384, kexAlgoECDH521,
+			kexAlgoDH14SHA256, kexAlgoDH16SHA512,
+		},
+		Ciphers: []string{
+			gcm128CipherID, gcm256CipherID,
+			"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512",
+		},
+		HostKeys: []string{
+			CertAlgoRSASHA256v01, CertAlgoRSASHA512v01,
+			CertAlgoECDSA256v01, CertAlgoECDSA384v01, CertAlgoECDSA521v01,
+			KeyAlgoECDSA256, KeyAlgoECDSA384, KeyAlgoECDSA521,
+			KeyAlgoRSASHA256, KeyAlgoRSASHA512,
+		},
+		PublicKeyAuths: []string{
+			KeyAlgoSKECDSA256,
+			KeyAlgoECDSA256, KeyAlgoECDSA384, KeyAlgoECDSA521,
+			KeyAlgoRSASHA256, KeyAlgoRSASHA512,
+		},
+	},
+}
+
+// PolicyAlgorithms returns the algorithms allowed by the named algorithm
+// policy, which is one of PolicyStrict, PolicyCompat and PolicyFIPS.
+// Algorithms that are not supported by this build, such as the ML-KEM key
+// exchange before Go 1.24, are omitted.
+func PolicyAlgorithms(name string) (Algorithms, error) {
+	if name == PolicyCompat {
+		return Algorithms{
+			KeyExchanges:   supportedAlgos(supportedKexAlgos, isSupportedKex),
+			Ciphers:        supportedAlgos(supportedCiphers, isSupportedCipher),
+			MACs:           supportedAlgos(supportedMACs, isSupportedMAC),
+			HostKeys:       supportedAlgos(supportedHostKeyAlgos, nil),
+			PublicKeyAuths: supportedAlgos(supportedPubKeyAuthAlgos, nil),
+		}, nil
+	}
+	p, ok := policies[name]
+	if !ok {
+		return Algorithms{}, fmt.Errorf("ssh: unknown algorithm policy %q", name)
+	}
+	return Algorithms{
+		KeyExchanges:   supportedAlgos(p.KeyExchanges, isSupportedKex),
+		Ciphers:        supportedAlgos(p.Ciphers, isSupportedCipher),
+		MACs:           supportedAlgos(p.MACs, isSupportedMAC),
+		HostKeys:       supportedAlgos(p.HostKeys, nil),
+		PublicKeyAuths: supportedAlgos(p.PublicKeyAuths, nil),
+	}, nil
+}
+
+func isSupportedKex(algo string) bool    { return kexAlgoMap[algo] != nil }
+func isSupportedCipher(algo string) bool { return cipherModes[algo] != nil }
+func isSupportedMAC(algo string) bool    { return macModes[algo] != nil }
+
+// supportedAlgos returns a copy of algos, without the algorithms for which
+// supported is false, if it is not nil.
+func supportedAlgos(algos []string, supported func(string) bool) []string {
+	var result []string
+	for _, algo := range algos {
+		if supported == nil || supported(algo) {
+			result = append(result, algo)
+		}
+	}
+	return result
+}
+
+// policyAlgorithms returns the algorithms of the policy of c, or nil if c
+// has no policy.
+func (c *Config) policyAlgorithms() (*Algorithms, error) {
+	if c.AlgorithmPolicy == "" {
+		return nil, nil
+	}
+	p, err := PolicyAlgorithms(c.AlgorithmPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// applyPolicy returns algos restricted to allowed, or allowed if algos is
+// nil.
+func applyPolicy(algos, allowed []string) []string {
+	if algos == nil {
+		return allowed
+	}
+	return supportedAlgos(algos, func(algo string) bool {
+		return contains(allowed, algo)
+	})
+}
+
+// DirectionAlgorithms are the algorithms negotiated for one direction of a
+// connection.
+type DirectionAlgorithms struct {
+	Cipher string
+	// MAC is empty for AEAD ciphers, which don't use a separate MAC.
+	MAC         string
+	Compression string
+}
+
+// NegotiatedAlgorithms are the algorithms negotiated by the last key
+// exchange of a connection.
+type NegotiatedAlgorithms struct {
+	KeyExchange string
+	HostKey     string
+	Read        DirectionAlgorithms
+	Write       DirectionAlgorithms
+	// StrictKeyExchange reports whether both sides agreed to the strict key
+	// exchange of OpenSSH, kex-strict-c-v00@openssh.com and
+	// kex-strict-s-v00@openssh.com, during the initial key exchange. It
+	// resets the sequence numbers at each key exchange and forbids other
+	// messages during the initial one, which defeats the prefix truncation
+	// attack known as Terrapin (CVE-2023-48795). Clients and servers of this
+	// package always offer it, so it is only false with peers that don't.
+	StrictKeyExchange bool
+}
+
+// AlgorithmsConnMetadata is a ConnMetadata that reports the algorithms
+// negotiated for the connection, for example for audit logging. It is
+// implemented by the Conn of a Client or ServerConn, and by the ConnMetadata
+// passed to the authentication callbacks of ServerConfig.
+type AlgorithmsConnMetadata interface {
+	ConnMetadata
+
+	// Algorithms returns the algorithms negotiated by the last key
+	// exchange.
+	Algorithms() NegotiatedAlgorithms
+}
+
+func newNegotiatedAlgorithms(a *algorithms) NegotiatedAlgorithms {
+	return NegotiatedAlgorithms{
+		KeyExchange: a.kex,
+		HostKey:     a.hostKey,
+		Read:        DirectionAlgorithms(a.r),
+		Write:       DirectionAlgorithms(a.w),
+	}
+}
+
+func (c *connection) Algorithms() NegotiatedAlgorithms {
+	c.transport.mu.Lock()
+	defer c.transport.mu.Unlock()
+	return c.transport.negotiated
+}
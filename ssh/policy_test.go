@@ -0,0 +1,142 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"testing"
+)
+
+// connectWithPolicies connects a client and a server with the given
+// configurations, and returns the client connection, or the handshake errors.
+func connectWithPolicies(t *testing.T, clientConf *ClientConfig, serverConf *ServerConfig) (Conn, error, error) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	t.Cleanup(func() {
+		c1.Close()
+		c2.Close()
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, chans, reqs, err := NewServerConn(c1, serverConf)
+		serverErr <- err
+		if err != nil {
+			return
+		}
+		go DiscardRequests(reqs)
+		for newCh := range chans {
+			newCh.Reject(Prohibited, "")
+		}
+		conn.Close()
+	}()
+
+	conn, _, reqs, err := NewClientConn(c2, "", clientConf)
+	if err != nil {
+		c2.Close()
+		return nil, err, <-serverErr
+	}
+	go DiscardRequests(reqs)
+	return conn, nil, <-serverErr
+}
+
+func TestAlgorithmPolicies(t *testing.T) {
+	for _, policy := range []string{PolicyStrict, PolicyCompat, PolicyFIPS} {
+		t.Run(policy, func(t *testing.T) {
+			allowed, err := PolicyAlgorithms(policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			serverConf := &ServerConfig{
+				Config:       Config{AlgorithmPolicy: policy},
+				NoClientAuth: true,
+			}
+			serverConf.AddHostKey(testSigners["rsa"])
+			serverConf.AddHostKey(testSigners["ecdsa"])
+			serverConf.AddHostKey(testSigners["ed25519"])
+			clientConf := &ClientConfig{
+				Config:          Config{AlgorithmPolicy: policy},
+				User:            "testuser",
+				HostKeyCallback: InsecureIgnoreHostKey(),
+			}
+
+			conn, clientErr, serverErr := connectWithPolicies(t, clientConf, serverConf)
+			if clientErr != nil || serverErr != nil {
+				t.Fatalf("client: %v, server: %v", clientErr, serverErr)
+			}
+			defer conn.Close()
+
+			algs := conn.(AlgorithmsConnMetadata).Algorithms()
+			if !algs.StrictKeyExchange {
+				t.Error("strict key exchange not negotiated")
+			}
+			if !contains(allowed.KeyExchanges, algs.KeyExchange) {
+				t.Errorf("negotiated key exchange %q, not allowed by %q", algs.KeyExchange, policy)
+			}
+			if !contains(allowed.HostKeys, algs.HostKey) {
+				t.Errorf("negotiated host key %q, not allowed by %q", algs.HostKey, policy)
+			}
+			for _, d := range []DirectionAlgorithms{algs.Read, algs.Write} {
+				if !contains(allowed.Ciphers, d.Cipher) {
+					t.Errorf("negotiated cipher %q, not allowed by %q", d.Cipher, policy)
+				}
+				if d.MAC != "" && !contains(allowed.MACs, d.MAC) {
+					t.Errorf("negotiated MAC %q, not allowed by %q", d.MAC, policy)
+				}
+				if d.Compression != compressionNone {
+					t.Errorf("negotiated compression %q, want %q", d.Compression, compressionNone)
+				}
+			}
+		})
+	}
+}
+
+func TestAlgorithmPolicyRejectsLegacy(t *testing.T) {
+	serverConf := &ServerConfig{
+		Config:       Config{Ciphers: []string{aes128cbcID}},
+		NoClientAuth: true,
+	}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+	clientConf := &ClientConfig{
+		Config:          Config{AlgorithmPolicy: PolicyStrict},
+		User:            "testuser",
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+	if _, clientErr, _ := connectWithPolicies(t, clientConf, serverConf); clientErr == nil {
+		t.Error("strict client connected to a server that only allows aes128-cbc")
+	}
+
+	// The policy applies to explicit lists too.
+	clientConf = &ClientConfig{
+		Config:            Config{AlgorithmPolicy: PolicyFIPS},
+		User:              "testuser",
+		HostKeyAlgorithms: []string{KeyAlgoED25519, KeyAlgoECDSA256},
+		HostKeyCallback:   InsecureIgnoreHostKey(),
+	}
+	serverConf = &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ed25519"])
+	if _, clientErr, _ := connectWithPolicies(t, clientConf, serverConf); clientErr == nil {
+		t.Error("FIPS client accepted an ed25519 host key")
+	}
+}
+
+func TestUnknownAlgorithmPolicy(t *testing.T) {
+	if _, err := PolicyAlgorithms("bogus"); err == nil {
+		t.Error("PolicyAlgorithms succeeded for an unknown policy")
+	}
+
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ecdsa"])
+	clientConf := &ClientConfig{
+		Config:          Config{AlgorithmPolicy: "bogus"},
+		User:            "testuser",
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+	if _, clientErr, _ := connectWithPolicies(t, clientConf, serverConf); clientErr == nil {
+		t.Error("client connected with an unknown policy")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"sync"
+	"time"
+)
+
+// A RateLimiter limits the throughput of channel data with a token bucket.
+// See Config.ChannelRateLimit and Config.ConnRateLimit. A RateLimiter may
+// be shared by several channels and connections, to limit their total
+// throughput, and its methods may be called concurrently.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that allows bytesPerSecond bytes per
+// second on average, and bursts of up to burst bytes. The bucket starts
+// full.
+func NewRateLimiter(bytesPerSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:   bytesPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// SetRate changes the average rate of l to bytesPerSecond. It applies to
+// the data that has not been accounted for yet.
+func (l *RateLimiter) SetRate(bytesPerSecond float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = bytesPerSecond
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+}
+
+// reserve takes n bytes from the bucket at now, and returns how long the
+// caller must wait before using them. The bucket may go into debt, so that
+// reservations larger than the burst size are possible and later callers
+// wait for the earlier ones.
+func (l *RateLimiter) reserve(now time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(now)
+	l.tokens -= float64(n)
+	if l.tokens >= 0 || l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// rateLimits holds the limiters that apply to the data of a channel in one
+// direction.
+type rateLimits []*RateLimiter
+
+// reserve takes n bytes from all the limiters, and returns how long the
+// caller must wait before using them.
+func (r rateLimits) reserve(n int) time.Duration {
+	var d time.Duration
+	now := time.Now()
+	for _, l := range r {
+		if ld := l.reserve(now, n); ld > d {
+			d = ld
+		}
+	}
+	return d
+}
+
+// setupRateLimits sets the rate limiters of ch, from the limits of the
+// connection and m.config.ChannelRateLimit.
+func (m *mux) setupRateLimits(ch *channel) {
+	send, receive := m.sendLimits, m.receiveLimits
+	if m.config != nil && m.config.ChannelRateLimit != nil {
+		s, r := m.config.ChannelRateLimit(ch.chanType)
+		if s != nil {
+			send = append(send[:len(send):len(send)], s)
+		}
+		if r != nil {
+			receive = append(receive[:len(receive):len(receive)], r)
+		}
+	}
+	ch.sendLimits, ch.receiveLimits = send, receive
+	if len(send) > 0 {
+		ch.done = make(chan struct{})
+	}
+}
+
+// waitSendLimits waits until n bytes may be sent on ch. It returns false if
+// ch was closed in the meantime.
+func (ch *channel) waitSendLimits(n uint32) bool {
+	d := ch.sendLimits.reserve(int(n))
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ch.done:
+		return false
+	}
+}
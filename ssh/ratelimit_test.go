@@ -0,0 +1,141 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := NewRateLimiter(1000, 500)
+	now := l.last
+	if d := l.reserve(now, 500); d != 0 {
+		t.Errorf("reserving the burst: got delay %v, want 0", d)
+	}
+	if d := l.reserve(now, 100); d != 100*time.Millisecond {
+		t.Errorf("got delay %v, want 100ms", d)
+	}
+	// Later callers wait for the debt of the earlier ones.
+	if d := l.reserve(now, 100); d != 200*time.Millisecond {
+		t.Errorf("got delay %v, want 200ms", d)
+	}
+	now = now.Add(time.Second)
+	if d := l.reserve(now, 500); d != 0 {
+		t.Errorf("after refilling: got delay %v, want 0", d)
+	}
+	// The bucket doesn't fill beyond the burst size.
+	now = now.Add(time.Hour)
+	if d := l.reserve(now, 1500); d != time.Second {
+		t.Errorf("got delay %v, want 1s", d)
+	}
+
+	var limits rateLimits
+	if d := limits.reserve(1 << 20); d != 0 {
+		t.Errorf("without limiters: got delay %v, want 0", d)
+	}
+}
+
+// testRateLimit sends n bytes over a channel between a client and a server
+// with the given configurations, and returns how long it took.
+func testRateLimit(t *testing.T, serverConf *ServerConfig, clientConf *ClientConfig, n int) time.Duration {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	serverConf.NoClientAuth = true
+	serverConf.AddHostKey(testSigners["ecdsap256"])
+	received := make(chan int, 1)
+	go func() {
+		defer close(received)
+		conn, chans, reqs, err := NewServerConn(c2, serverConf)
+		if err != nil {
+			t.Errorf("NewServerConn: %v", err)
+			return
+		}
+		defer conn.Close()
+		go DiscardRequests(reqs)
+		ch, reqs, err := (<-chans).Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			return
+		}
+		go DiscardRequests(reqs)
+		got, err := io.Copy(io.Discard, ch)
+		if err != nil {
+			t.Errorf("Read: %v", err)
+		}
+		received <- int(got)
+	}()
+
+	clientConf.HostKeyCallback = InsecureIgnoreHostKey()
+	conn, chans, reqs, err := NewClientConn(c1, "", clientConf)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	client := NewClient(conn, chans, reqs)
+	defer client.Close()
+
+	ch, reqs2, err := client.OpenChannel("bulk", nil)
+	if err != nil {
+		t.Fatalf("OpenChannel: %v", err)
+	}
+	go DiscardRequests(reqs2)
+
+	start := time.Now()
+	if _, err := ch.Write(make([]byte, n)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	ch.CloseWrite()
+	if got := <-received; got != n {
+		t.Errorf("received %d bytes, want %d", got, n)
+	}
+	elapsed := time.Since(start)
+	ch.Close()
+	return elapsed
+}
+
+func TestChannelSendRateLimit(t *testing.T) {
+	const rate, burst, n = 40000, 4096, 16384
+	serverConf := &ServerConfig{}
+	clientConf := &ClientConfig{}
+	clientConf.ConnRateLimit = func() (send, receive *RateLimiter) {
+		return NewRateLimiter(rate, burst), nil
+	}
+	var chanTypes []string
+	clientConf.ChannelRateLimit = func(chanType string) (send, receive *RateLimiter) {
+		chanTypes = append(chanTypes, chanType)
+		return nil, nil
+	}
+	elapsed := testRateLimit(t, serverConf, clientConf, n)
+	want := time.Duration(float64(n-burst) / rate * float64(time.Second))
+	if elapsed < want*9/10 {
+		t.Errorf("sent %d bytes in %v, want at least %v", n, elapsed, want)
+	}
+	if len(chanTypes) != 1 || chanTypes[0] != "bulk" {
+		t.Errorf("ChannelRateLimit was called for %q, want [bulk]", chanTypes)
+	}
+}
+
+func TestChannelReceiveRateLimit(t *testing.T) {
+	const rate, burst, window, n = 40000, 4096, 4096, 20480
+	serverConf := &ServerConfig{}
+	serverConf.ChannelWindowSize = window
+	serverConf.ChannelMaxPacket = 1024
+	serverConf.ChannelRateLimit = func(chanType string) (send, receive *RateLimiter) {
+		return nil, NewRateLimiter(rate, burst)
+	}
+	elapsed := testRateLimit(t, serverConf, &ClientConfig{}, n)
+	// The peer sends the initial window at once, and the last window
+	// adjustment isn't needed.
+	want := time.Duration(float64(n-window-burst) / rate * float64(time.Second))
+	if elapsed < want*9/10 {
+		t.Errorf("received %d bytes in %v, want at least %v", n, elapsed, want)
+	}
+}
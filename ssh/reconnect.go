@@ -0,0 +1,516 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// keepaliveRequest is the global request sent by OpenSSH to check that the
+// peer is alive. Servers reply to it with a failure, which is enough to show
+// that the connection works.
+const keepaliveRequest = "keepalive@openssh.com"
+
+// A ManagedClientConfig structure is used to configure a ManagedClient. It
+// must not be modified after having been passed to DialManaged.
+type ManagedClientConfig struct {
+	// ClientConfig is used for each connection to the server.
+	ClientConfig
+
+	// Dial, if not nil, is used to establish the underlying connections
+	// instead of net.DialTimeout with the Timeout of ClientConfig.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// KeepaliveInterval is the interval between keepalive requests, and
+	// the time to wait for their replies. If zero, 15 seconds is used. If
+	// negative, no keepalive requests are sent.
+	KeepaliveInterval time.Duration
+
+	// KeepaliveCountMax is the number of consecutive keepalive requests
+	// that may go unanswered before the connection is considered dead and
+	// closed, like the ServerAliveCountMax option of OpenSSH. If zero, 3
+	// is used.
+	KeepaliveCountMax int
+
+	// MinReconnectDelay and MaxReconnectDelay bound the delay between
+	// attempts to reconnect, which doubles after each failed attempt. If
+	// zero, they default to 1 second and 1 minute.
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+
+	// MaxReconnectAttempts is the number of consecutive failed attempts
+	// to reconnect after which the ManagedClient gives up. If zero, it
+	// retries forever.
+	MaxReconnectAttempts int
+
+	// OnConnect, if not nil, is called with each new connection before it
+	// is made available to users of the ManagedClient, including the
+	// first one. It can be used to re-establish sessions and port
+	// forwardings. If it returns an error, the connection is closed and
+	// treated as a failed attempt.
+	OnConnect func(*Client) error
+
+	// OnDisconnect, if not nil, is called with the reason when a
+	// connection is lost, before reconnecting.
+	OnDisconnect func(error)
+}
+
+func (c *ManagedClientConfig) keepaliveInterval() time.Duration {
+	if c.KeepaliveInterval == 0 {
+		return 15 * time.Second
+	}
+	return c.KeepaliveInterval
+}
+
+func (c *ManagedClientConfig) keepaliveCountMax() int {
+	if c.KeepaliveCountMax <= 0 {
+		return 3
+	}
+	return c.KeepaliveCountMax
+}
+
+func (c *ManagedClientConfig) reconnectDelays() (min, max time.Duration) {
+	min, max = c.MinReconnectDelay, c.MaxReconnectDelay
+	if min <= 0 {
+		min = time.Second
+	}
+	if max <= 0 {
+		max = time.Minute
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// ManagedClient maintains a Client connection to a server. It sends
+// keepalive requests to detect dead connections, for example ones dropped
+// by a NAT gateway, and transparently dials a new connection when the
+// current one is lost.
+//
+// Sessions, channels and forwardings belong to the Client they were
+// created on, and fail when its connection is lost; use
+// ManagedClientConfig.OnConnect to set them up again. The exception is the
+// remote forwardings set up with ManagedClient.Listen, which are requested
+// again on each new connection.
+type ManagedClient struct {
+	network, addr string
+	config        ManagedClientConfig
+
+	mu     sync.Mutex
+	client *Client       // the current connection, or nil
+	ready  chan struct{} // closed when client is set or err is set
+	err    error         // set if the ManagedClient is no longer usable
+
+	closed    chan struct{} // closed by Close
+	closeOnce sync.Once
+	done      chan struct{} // closed when the run loop exits
+
+	// forwardMu guards listeners and forwardClient, and is held while
+	// the forwardings are requested on a new connection.
+	forwardMu     sync.Mutex
+	listeners     map[*managedListener]bool
+	forwardClient *Client // the last connection the forwardings were requested on
+}
+
+// DialManaged connects to the given SSH server and returns a ManagedClient
+// that keeps the connection alive. The first connection attempt is not
+// retried: its error is returned directly.
+func DialManaged(network, addr string, config *ManagedClientConfig) (*ManagedClient, error) {
+	m := &ManagedClient{
+		network:   network,
+		addr:      addr,
+		config:    *config,
+		ready:     make(chan struct{}),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+		listeners: make(map[*managedListener]bool),
+	}
+	c, err := m.connect()
+	if err != nil {
+		return nil, err
+	}
+	m.setClient(c)
+	go m.run(c)
+	return m, nil
+}
+
+// connect dials a new connection and runs the OnConnect callback on it.
+func (m *ManagedClient) connect() (*Client, error) {
+	dial := m.config.Dial
+	if dial == nil {
+		dial = func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, m.config.Timeout)
+		}
+	}
+	conn, err := dial(m.network, m.addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := NewClientConn(conn, m.addr, &m.config.ClientConfig)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(c, chans, reqs)
+	if m.config.OnConnect != nil {
+		if err := m.config.OnConnect(client); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	m.restoreForwards(client)
+	return client, nil
+}
+
+// restoreForwards requests the forwardings of the listeners returned by
+// Listen on the new connection c.
+func (m *ManagedClient) restoreForwards(c *Client) {
+	m.forwardMu.Lock()
+	defer m.forwardMu.Unlock()
+	m.forwardClient = c
+	for l := range m.listeners {
+		l.attach(c)
+	}
+}
+
+// setClient makes c the current connection, or marks the ManagedClient as
+// reconnecting if c is nil. It reports false if the ManagedClient was
+// closed, in which case c is not used.
+func (m *ManagedClient) setClient(c *Client) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Close closes m.closed before looking at m.client, so either it sees
+	// c or c is detected here.
+	select {
+	case <-m.closed:
+		return false
+	default:
+	}
+	m.client = c
+	if c != nil {
+		close(m.ready)
+	} else {
+		m.ready = make(chan struct{})
+	}
+	return true
+}
+
+func (m *ManagedClient) fail(err error) {
+	m.mu.Lock()
+	m.client = nil
+	m.err = err
+	select {
+	case <-m.ready:
+	default:
+		close(m.ready)
+	}
+	m.mu.Unlock()
+
+	m.forwardMu.Lock()
+	listeners := m.listeners
+	m.listeners = nil
+	m.forwardMu.Unlock()
+	for l := range listeners {
+		l.stop(err)
+	}
+}
+
+// run watches over c and its successors until the ManagedClient is closed
+// or gives up reconnecting.
+func (m *ManagedClient) run(c *Client) {
+	defer close(m.done)
+	for {
+		stop := make(chan struct{})
+		go m.keepalive(c, stop)
+		err := c.Wait()
+		close(stop)
+
+		if !m.setClient(nil) {
+			m.fail(net.ErrClosed)
+			return
+		}
+		if m.config.OnDisconnect != nil {
+			m.config.OnDisconnect(err)
+		}
+
+		c, err = m.reconnect()
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		if !m.setClient(c) {
+			c.Close()
+			m.fail(net.ErrClosed)
+			return
+		}
+	}
+}
+
+// reconnect dials until a connection is established, the maximum number of
+// attempts is reached, or the ManagedClient is closed.
+func (m *ManagedClient) reconnect() (*Client, error) {
+	delay, maxDelay := m.config.reconnectDelays()
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-m.closed:
+			timer.Stop()
+			return nil, net.ErrClosed
+		case <-timer.C:
+		}
+
+		c, err := m.connect()
+		if err == nil {
+			return c, nil
+		}
+		if m.config.MaxReconnectAttempts > 0 && attempt >= m.config.MaxReconnectAttempts {
+			return nil, err
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// keepalive sends keepalive requests on c until stop is closed, and closes
+// c if too many of them go unanswered.
+func (m *ManagedClient) keepalive(c *Client, stop <-chan struct{}) {
+	interval := m.config.keepaliveInterval()
+	if interval < 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := c.SendRequest(keepaliveRequest, true, nil)
+			reply <- err
+		}()
+		timer := time.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case err := <-reply:
+			timer.Stop()
+			if err != nil {
+				// The connection is gone, and Wait will return.
+				return
+			}
+			missed = 0
+		case <-timer.C:
+			missed++
+			if missed >= m.config.keepaliveCountMax() {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// Client returns the current connection to the server. If the connection
+// was lost, it waits until a new one is established. It returns an error if
+// the ManagedClient was closed or gave up reconnecting.
+func (m *ManagedClient) Client() (*Client, error) {
+	for {
+		m.mu.Lock()
+		c, err, ready := m.client, m.err, m.ready
+		m.mu.Unlock()
+		switch {
+		case err != nil:
+			return nil, err
+		case c != nil:
+			return c, nil
+		}
+		<-ready
+	}
+}
+
+// NewSession opens a new Session on the current connection.
+func (m *ManagedClient) NewSession() (*Session, error) {
+	c, err := m.Client()
+	if err != nil {
+		return nil, err
+	}
+	return c.NewSession()
+}
+
+// Dial initiates a connection to the addr from the remote host, using the
+// current connection.
+func (m *ManagedClient) Dial(n, addr string) (net.Conn, error) {
+	c, err := m.Client()
+	if err != nil {
+		return nil, err
+	}
+	return c.Dial(n, addr)
+}
+
+// Listen requests the remote peer open a listening socket on addr, like
+// Client.Listen. Unlike the listeners returned by Client.Listen, the
+// returned listener survives the loss of the connection: the forwarding is
+// requested again on each new connection, so that Accept keeps returning
+// the forwarded connections. If port 0 is requested, the port allocated by
+// the peer the first time is requested on the following connections.
+//
+// If the forwarding cannot be requested again, or the ManagedClient is
+// closed or gives up reconnecting, Accept returns the error.
+func (m *ManagedClient) Listen(n, addr string) (net.Listener, error) {
+	c, err := m.Client()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := c.Listen(n, addr)
+	if err != nil {
+		return nil, err
+	}
+	l := &managedListener{
+		m:       m,
+		network: n,
+		laddr:   ln.Addr(),
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+	}
+	l.setListener(ln)
+
+	m.forwardMu.Lock()
+	defer m.forwardMu.Unlock()
+	if m.listeners == nil {
+		l.stop(net.ErrClosed)
+		return nil, net.ErrClosed
+	}
+	m.listeners[l] = true
+	if m.forwardClient != c {
+		// The connection was replaced before l was registered.
+		l.attach(m.forwardClient)
+	}
+	return l, nil
+}
+
+// managedListener is a net.Listener whose forwarding is requested again on
+// each connection of a ManagedClient.
+type managedListener struct {
+	m       *ManagedClient
+	network string
+	laddr   net.Addr // the address of the first forwarding, requested on each connection
+
+	conns chan net.Conn
+
+	mu   sync.Mutex
+	ln   net.Listener  // the forwarding on the current connection, if any
+	err  error         // set once the listener is unusable
+	done chan struct{} // closed when err is set
+}
+
+// attach requests the forwarding on c, and stops l if it fails. The caller
+// must hold l.m.forwardMu.
+func (l *managedListener) attach(c *Client) {
+	ln, err := c.Listen(l.network, l.laddr.String())
+	if err != nil {
+		delete(l.m.listeners, l)
+		l.stop(fmt.Errorf("ssh: requesting forwarding of %s again: %w", l.laddr, err))
+		return
+	}
+	l.setListener(ln)
+}
+
+// setListener makes ln the forwarding of l on the current connection, and
+// starts serving it.
+func (l *managedListener) setListener(ln net.Listener) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		ln.Close()
+		return
+	}
+	l.ln = ln
+	go l.serve(ln)
+}
+
+// serve passes the connections accepted by ln to Accept, until ln fails
+// because its SSH connection is lost or l is closed.
+func (l *managedListener) serve(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case l.conns <- c:
+		case <-l.done:
+			c.Close()
+			return
+		}
+	}
+}
+
+// stop makes Accept return err, and cancels the current forwarding.
+func (l *managedListener) stop(err error) error {
+	l.mu.Lock()
+	if l.err != nil {
+		l.mu.Unlock()
+		return nil
+	}
+	l.err = err
+	close(l.done)
+	ln := l.ln
+	l.ln = nil
+	l.mu.Unlock()
+	if ln != nil {
+		return ln.Close()
+	}
+	return nil
+}
+
+// Accept waits for and returns the next connection forwarded on any
+// connection of the ManagedClient.
+func (l *managedListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return nil, l.err
+	}
+}
+
+// Close cancels the forwarding and closes the listener.
+func (l *managedListener) Close() error {
+	l.m.forwardMu.Lock()
+	delete(l.m.listeners, l)
+	l.m.forwardMu.Unlock()
+	return l.stop(net.ErrClosed)
+}
+
+// Addr returns the listener's network address.
+func (l *managedListener) Addr() net.Addr {
+	return l.laddr
+}
+
+// Close closes the current connection and stops reconnecting.
+func (m *ManagedClient) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		m.mu.Lock()
+		c := m.client
+		m.mu.Unlock()
+		if c != nil {
+			c.Close()
+		}
+	})
+	<-m.done
+	return nil
+}
@@ -0,0 +1,484 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// managedTestServer accepts SSH connections, replies to global requests and
+// accepts session channels. It grants tcpip-forward requests, allocating
+// port 4242 if port 0 is requested, unless denyForwards is set.
+type managedTestServer struct {
+	listener net.Listener
+
+	mu           sync.Mutex
+	conns        []*ServerConn
+	forwardConn  *ServerConn // the connection of forwardReqs
+	forwardReqs  []string    // the types and ports of the forwarding requests on forwardConn
+	denyForwards bool
+}
+
+func newManagedTestServer(t *testing.T) *managedTestServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &managedTestServer{listener: listener}
+	config := &ServerConfig{NoClientAuth: true}
+	config.AddHostKey(testSigners["ecdsa"])
+
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		s.close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, chans, reqs, err := NewServerConn(c, config)
+				if err != nil {
+					return
+				}
+				s.mu.Lock()
+				s.conns = append(s.conns, conn)
+				s.mu.Unlock()
+				go func() {
+					for r := range reqs {
+						s.handleRequest(conn, r)
+					}
+				}()
+				for newCh := range chans {
+					ch, reqs, err := newCh.Accept()
+					if err != nil {
+						continue
+					}
+					go DiscardRequests(reqs)
+					go ch.Close()
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *managedTestServer) handleRequest(conn *ServerConn, r *Request) {
+	if r.Type != "tcpip-forward" && r.Type != "cancel-tcpip-forward" {
+		r.Reply(false, nil)
+		return
+	}
+	var msg struct {
+		Addr string
+		Port uint32
+	}
+	if err := Unmarshal(r.Payload, &msg); err != nil {
+		r.Reply(false, nil)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if conn != s.forwardConn {
+		s.forwardConn, s.forwardReqs = conn, nil
+	}
+	if msg.Port == 0 {
+		msg.Port = 4242
+	}
+	s.forwardReqs = append(s.forwardReqs, fmt.Sprintf("%s %d", r.Type, msg.Port))
+	r.Reply(!s.denyForwards, Marshal(struct{ Port uint32 }{msg.Port}))
+}
+
+// forwardRequests waits for n forwarding requests on the last connection
+// that sent any, and returns them.
+func (s *managedTestServer) forwardRequests(t *testing.T, n int) []string {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		reqs := s.forwardReqs
+		s.mu.Unlock()
+		if len(reqs) >= n {
+			return reqs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d forwarding requests", n)
+	return nil
+}
+
+// openForwarded opens a forwarded-tcpip channel for port on the last
+// connection that sent a forwarding request.
+func (s *managedTestServer) openForwarded(port uint32) (Channel, error) {
+	s.mu.Lock()
+	conn := s.forwardConn
+	s.mu.Unlock()
+	ch, reqs, err := conn.OpenChannel("forwarded-tcpip", Marshal(&forwardedTCPPayload{
+		Addr:       "127.0.0.1",
+		Port:       port,
+		OriginAddr: "127.0.0.1",
+		OriginPort: 5555,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	go DiscardRequests(reqs)
+	return ch, nil
+}
+
+func (s *managedTestServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *managedTestServer) numConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// dropConns closes all connections accepted so far.
+func (s *managedTestServer) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.forwardConn, s.forwardReqs = nil, nil
+}
+
+func (s *managedTestServer) close() {
+	s.listener.Close()
+	s.dropConns()
+}
+
+func testManagedConfig() *ManagedClientConfig {
+	return &ManagedClientConfig{
+		ClientConfig: ClientConfig{
+			User:            "testuser",
+			HostKeyCallback: InsecureIgnoreHostKey(),
+		},
+		MinReconnectDelay: 10 * time.Millisecond,
+		MaxReconnectDelay: 50 * time.Millisecond,
+	}
+}
+
+func TestManagedClientReconnect(t *testing.T) {
+	s := newManagedTestServer(t)
+	config := testManagedConfig()
+	connects := make(chan *Client, 10)
+	disconnects := make(chan error, 10)
+	config.OnConnect = func(c *Client) error {
+		connects <- c
+		return nil
+	}
+	config.OnDisconnect = func(err error) {
+		disconnects <- err
+	}
+
+	m, err := DialManaged("tcp", s.addr(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	first := <-connects
+
+	s.dropConns()
+	<-disconnects
+	second := <-connects
+	if second == first {
+		t.Fatal("got the same client after reconnecting")
+	}
+
+	c, err := m.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != second {
+		t.Error("Client did not return the new connection")
+	}
+	session, err := m.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	session.Close()
+}
+
+// freezableConn stops delivering data while frozen, like a connection
+// whose peer went away without closing it.
+type freezableConn struct {
+	net.Conn
+	frozen chan struct{}
+}
+
+func (c *freezableConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	select {
+	case <-c.frozen:
+		// Block until the connection is closed.
+		c.Conn.Read(make([]byte, 1<<16))
+		return 0, net.ErrClosed
+	default:
+	}
+	return n, err
+}
+
+func TestManagedClientKeepalive(t *testing.T) {
+	s := newManagedTestServer(t)
+	config := testManagedConfig()
+	config.KeepaliveInterval = 20 * time.Millisecond
+	config.KeepaliveCountMax = 2
+
+	var mu sync.Mutex
+	var conns []*freezableConn
+	config.Dial = func(network, addr string) (net.Conn, error) {
+		c, err := net.Dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		fc := &freezableConn{Conn: c, frozen: make(chan struct{})}
+		mu.Lock()
+		conns = append(conns, fc)
+		mu.Unlock()
+		return fc, nil
+	}
+	disconnected := make(chan struct{}, 10)
+	config.OnDisconnect = func(error) {
+		disconnected <- struct{}{}
+	}
+
+	m, err := DialManaged("tcp", s.addr(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// Let a few keepalives go through.
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-disconnected:
+		t.Fatal("disconnected while the server was answering keepalives")
+	default:
+	}
+
+	mu.Lock()
+	close(conns[0].frozen)
+	mu.Unlock()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dead connection was not detected")
+	}
+	if _, err := m.NewSession(); err != nil {
+		t.Fatalf("NewSession after reconnecting: %v", err)
+	}
+	if n := s.numConns(); n != 2 {
+		t.Errorf("server got %d connections, want 2", n)
+	}
+}
+
+func TestManagedClientClose(t *testing.T) {
+	s := newManagedTestServer(t)
+	m, err := DialManaged("tcp", s.addr(), testManagedConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := m.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait(); err == nil {
+		t.Error("connection still open after Close")
+	}
+	if _, err := m.Client(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Client after Close: got %v, want net.ErrClosed", err)
+	}
+}
+
+func TestManagedClientGiveUp(t *testing.T) {
+	s := newManagedTestServer(t)
+	config := testManagedConfig()
+	config.MaxReconnectAttempts = 2
+	m, err := DialManaged("tcp", s.addr(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	s.close()
+	// Client returns the old connection until the disconnect is noticed,
+	// and then waits for the reconnection attempts.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := m.Client()
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Client succeeded after the server went away")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagedClientOnConnectError(t *testing.T) {
+	s := newManagedTestServer(t)
+	config := testManagedConfig()
+	wantErr := errors.New("setup failed")
+	config.OnConnect = func(*Client) error {
+		return wantErr
+	}
+	if _, err := DialManaged("tcp", s.addr(), config); err != wantErr {
+		t.Errorf("got %v, want %v", err, wantErr)
+	}
+}
+
+// acceptForwarded opens a forwarded connection to port on s and checks that
+// l accepts it.
+func acceptForwarded(t *testing.T, s *managedTestServer, l net.Listener, port uint32) {
+	t.Helper()
+	accepted := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			c.Close()
+		}
+		accepted <- err
+	}()
+	ch, err := s.openForwarded(port)
+	if err != nil {
+		t.Fatalf("opening forwarded channel: %v", err)
+	}
+	defer ch.Close()
+	if err := <-accepted; err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+}
+
+func TestClientCancelRemoteForward(t *testing.T) {
+	s := newManagedTestServer(t)
+	client, err := Dial("tcp", s.addr(), &testManagedConfig().ClientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	l, err := client.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Addr().String(); got != "127.0.0.1:4242" {
+		t.Fatalf("got listener address %s, want 127.0.0.1:4242", got)
+	}
+	acceptForwarded(t, s, l, 4242)
+
+	if err := client.CancelRemoteForward("tcp", "127.0.0.1:4242"); err != nil {
+		t.Fatalf("CancelRemoteForward: %v", err)
+	}
+	if reqs := s.forwardRequests(t, 2); reqs[1] != "cancel-tcpip-forward 4242" {
+		t.Errorf("got forwarding requests %q, want a cancellation", reqs)
+	}
+	if _, err := l.Accept(); err != io.EOF {
+		t.Errorf("Accept after cancellation: got %v, want io.EOF", err)
+	}
+	if _, err := s.openForwarded(4242); err == nil {
+		t.Error("forwarded channel accepted after cancellation")
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close after cancellation: %v", err)
+	}
+	if reqs := s.forwardRequests(t, 2); len(reqs) != 2 {
+		t.Errorf("got forwarding requests %q after Close, want no new request", reqs)
+	}
+}
+
+func TestManagedClientListen(t *testing.T) {
+	s := newManagedTestServer(t)
+	connects := make(chan *Client, 10)
+	config := testManagedConfig()
+	config.OnConnect = func(c *Client) error {
+		connects <- c
+		return nil
+	}
+	m, err := DialManaged("tcp", s.addr(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	<-connects
+
+	l, err := m.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Addr().String(); got != "127.0.0.1:4242" {
+		t.Fatalf("got listener address %s, want 127.0.0.1:4242", got)
+	}
+	acceptForwarded(t, s, l, 4242)
+
+	// The forwarding is requested again, for the allocated port, on the
+	// new connection.
+	s.dropConns()
+	<-connects
+	if reqs := s.forwardRequests(t, 1); reqs[0] != "tcpip-forward 4242" {
+		t.Fatalf("got forwarding requests %q after reconnecting", reqs)
+	}
+	acceptForwarded(t, s, l, 4242)
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if reqs := s.forwardRequests(t, 2); reqs[1] != "cancel-tcpip-forward 4242" {
+		t.Errorf("got forwarding requests %q, want a cancellation", reqs)
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept after Close: got %v, want net.ErrClosed", err)
+	}
+}
+
+func TestManagedClientListenDenied(t *testing.T) {
+	s := newManagedTestServer(t)
+	connects := make(chan *Client, 10)
+	config := testManagedConfig()
+	config.OnConnect = func(c *Client) error {
+		connects <- c
+		return nil
+	}
+	m, err := DialManaged("tcp", s.addr(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	<-connects
+
+	l, err := m.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.denyForwards = true
+	s.mu.Unlock()
+	s.dropConns()
+
+	if _, err := l.Accept(); err == nil {
+		t.Error("Accept succeeded after the forwarding was denied")
+	}
+	if _, err := m.Client(); err != nil {
+		t.Errorf("the ManagedClient failed with the forwarding: %v", err)
+	}
+}
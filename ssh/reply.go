@@ -0,0 +1,125 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"io"
+	"sync"
+)
+
+// AsyncRequestSender is implemented by the Conn and Channel values of this
+// package, whose SendRequest methods wait for the reply of a request before
+// returning. SendRequestAsync instead sends a request with want reply set
+// and returns at once, so that several requests can be in flight without a
+// goroutine for each.
+//
+// The replies are received in the order in which the requests were sent,
+// and SendRequest and SendRequestAsync may be mixed freely.
+type AsyncRequestSender interface {
+	SendRequestAsync(name string, payload []byte) (*RequestReply, error)
+}
+
+// RequestReply is the pending reply to a request sent by SendRequestAsync.
+type RequestReply struct {
+	done    chan struct{}
+	ok      bool
+	payload []byte
+	err     error
+}
+
+func newRequestReply() *RequestReply {
+	return &RequestReply{done: make(chan struct{})}
+}
+
+// Done returns a channel that is closed once the reply is received, or the
+// connection or channel the request was sent on is closed.
+func (r *RequestReply) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait waits for the reply, and returns its status and payload. Replies to
+// channel requests have no payload. If the connection or channel is closed
+// before the reply is received, io.EOF is returned.
+func (r *RequestReply) Wait() (ok bool, payload []byte, err error) {
+	<-r.done
+	return r.ok, r.payload, r.err
+}
+
+func (r *RequestReply) complete(ok bool, payload []byte, err error) {
+	r.ok, r.payload, r.err = ok, payload, err
+	close(r.done)
+}
+
+// replyQueue holds the requests awaiting a reply in the order in which they
+// were sent, since replies do not identify the request they answer. See RFC
+// 4254, sections 4 and 5.4.
+type replyQueue struct {
+	// sendMu is held while a request is queued and sent, so that the
+	// requests are queued in the order in which they are sent.
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	pending []*RequestReply
+	closed  bool
+}
+
+// send queues a reply and calls send to write its request.
+func (q *replyQueue) send(send func() error) (*RequestReply, error) {
+	q.sendMu.Lock()
+	defer q.sendMu.Unlock()
+
+	r := newRequestReply()
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, io.EOF
+	}
+	q.pending = append(q.pending, r)
+	q.mu.Unlock()
+
+	if err := send(); err != nil {
+		q.remove(r)
+		return nil, err
+	}
+	return r, nil
+}
+
+// remove forgets r, whose request could not be sent.
+func (q *replyQueue) remove(r *RequestReply) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, p := range q.pending {
+		if p == r {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// complete completes the oldest pending reply. Replies for which no request
+// is pending are ignored.
+func (q *replyQueue) complete(ok bool, payload []byte) {
+	q.mu.Lock()
+	if len(q.pending) == 0 {
+		q.mu.Unlock()
+		return
+	}
+	r := q.pending[0]
+	q.pending = q.pending[1:]
+	q.mu.Unlock()
+	r.complete(ok, payload, nil)
+}
+
+// close fails the pending replies with io.EOF, as well as the requests sent
+// afterwards.
+func (q *replyQueue) close() {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending, q.closed = nil, true
+	q.mu.Unlock()
+	for _, r := range pending {
+		r.complete(false, nil, io.EOF)
+	}
+}
@@ -6,11 +6,13 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
+	"time"
 )
 
 // The Permissions type holds fine-grained permissions that are
@@ -25,7 +27,9 @@ type Permissions struct {
 	// defines "force-command" (only allow the given command to
 	// execute) and "source-address" (only allow connections from
 	// the given address). The SSH package currently only enforces
-	// the "source-address" critical option. It is up to server
+	// the "source-address" critical option, and the "verify-required"
+	// critical option, which requires security key signatures to have
+	// the user verification flag. It is up to server
 	// implementations to enforce other critical options, such as
 	// "force-command", by checking them after the SSH handshake
 	// is successful. In general, SSH servers should reject
@@ -37,9 +41,11 @@ type Permissions struct {
 	// offer on authenticated connections. Lack of support for an
 	// extension does not preclude authenticating a user. Common
 	// extensions are "permit-agent-forwarding",
-	// "permit-X11-forwarding". The Go SSH library currently does
-	// not act on any extension, and it is up to server
-	// implementations to honor them. Extensions can be used to
+	// "permit-X11-forwarding". The Go SSH library currently only
+	// acts on the "no-touch-required" extension, which accepts
+	// security key signatures without the user presence flag, and
+	// it is up to server implementations to honor the other
+	// extensions. Extensions can be used to
 	// pass data from the authentication callbacks to the server
 	// application layer.
 	Extensions map[string]string
@@ -105,6 +111,14 @@ type ServerConfig struct {
 	// offered is in fact used to authenticate. To record any data
 	// depending on the public key, store it inside a
 	// Permissions.Extensions entry.
+	// Signatures made by security keys must have the user presence
+	// flag, unless the returned Permissions have the
+	// "no-touch-required" extension.
+	// Clients may use the publickey-hostbound-v00@openssh.com variant of
+	// the method, announced to them, which binds their signature to the
+	// host key of the server; it is only accepted for the host key used in
+	// the key exchange, and is reported as "publickey" to the other
+	// callbacks.
 	// If the function returns ErrDenied, the connection is terminated.
 	PublicKeyCallback func(conn ConnMetadata, key PublicKey) (*Permissions, error)
 
@@ -118,6 +132,21 @@ type ServerConfig struct {
 	// If the function returns ErrDenied, the connection is terminated.
 	KeyboardInteractiveCallback func(conn ConnMetadata, client KeyboardInteractiveChallenge) (*Permissions, error)
 
+	// HostbasedCallback, if non-nil, is called when a client
+	// authenticates with hostbased authentication (RFC 4252 section 9),
+	// after the signature made with the host key of the client host has
+	// been verified. clientHost and clientUser are the host name and the
+	// user name on that host claimed by the client. It must return a nil
+	// error if key is a host key of clientHost, for example according to a
+	// known_hosts file, and clientUser on that host may log in as the
+	// user of conn.
+	// As for PublicKeyCallback, the "source-address" critical option of
+	// the returned Permissions is enforced, and signatures made by
+	// security keys must have the user presence flag, unless the
+	// Permissions have the "no-touch-required" extension.
+	// If the function returns ErrDenied, the connection is terminated.
+	HostbasedCallback func(conn ConnMetadata, clientHost, clientUser string, key PublicKey) (*Permissions, error)
+
 	// AuthLogCallback, if non-nil, is called to log all authentication
 	// attempts.
 	AuthLogCallback func(conn ConnMetadata, method string, err error)
@@ -133,9 +162,52 @@ type ServerConfig struct {
 	// the client after key exchange completed but before authentication.
 	BannerCallback func(conn ConnMetadata) string
 
+	// AuthBannerCallback, if present, is called before each authentication
+	// attempt with the method requested by the client, such as "password",
+	// and the returned string, if not empty, is sent to the client as a
+	// banner before the attempt is processed. For the first attempt, it is
+	// called after BannerCallback. Banners can also be sent after an
+	// attempt, with a BannerError.
+	AuthBannerCallback func(conn ConnMetadata, method string) string
+
 	// GSSAPIWithMICConfig includes gssapi server and callback, which if both non-nil, is used
 	// when gssapi-with-mic authentication is selected (RFC 4462 section 3).
 	GSSAPIWithMICConfig *GSSAPIWithMICConfig
+
+	// GSSAPIKeyExchange, if non-nil, enables the GSS-API key exchange
+	// methods of RFC 4462 section 2 for the Kerberos V5 mechanism, which
+	// are then preferred to the methods of KeyExchanges. One of the host
+	// keys is still sent to the client, but it is not used for signing.
+	GSSAPIKeyExchange GSSAPIKeyExchangeServer
+
+	// PreAuthTimeout, if positive, is the time a client has to complete the
+	// key exchange and authenticate, like the LoginGraceTime option of
+	// OpenSSH's sshd. If it is exceeded, the connection is closed.
+	PreAuthTimeout time.Duration
+
+	// StartupLimiter, if non-nil, limits the number of concurrent
+	// unauthenticated connections. Connections over the limits are closed
+	// immediately, and NewServerConn returns ErrTooManyStartups.
+	StartupLimiter *StartupLimiter
+
+	// AnnounceHostKeys makes the server send its host keys, other than
+	// certificates, and ExtraHostKeys to the client after authentication,
+	// with the "hostkeys-00@openssh.com" extension of OpenSSH. The server
+	// then proves that it holds their private keys when the client asks.
+	// This lets clients learn new host keys before the server uses them.
+	AnnounceHostKeys bool
+
+	// ExtraHostKeys are announced along with the host keys when
+	// AnnounceHostKeys is set, but aren't used for key exchange. They are
+	// typically the new keys of a host key rotation, announced before the
+	// server switches to them.
+	ExtraHostKeys []Signer
+
+	// RecordSession, if non-nil, is called when a "session" channel is
+	// accepted, and returns the SessionRecorder that records its data and
+	// requests, or nil to not record it. If it returns an error, the
+	// channel is rejected, and Accept returns the error.
+	RecordSession func(conn ConnMetadata) (SessionRecorder, error)
 }
 
 // AddHostKey adds a private key as a host key. If an existing host
@@ -214,11 +286,27 @@ type ServerConn struct {
 // The returned error may be of type *ServerAuthError for
 // authentication errors.
 func NewServerConn(c net.Conn, config *ServerConfig) (*ServerConn, <-chan NewChannel, <-chan *Request, error) {
+	return NewServerConnContext(context.Background(), c, config)
+}
+
+// NewServerConnContext is like NewServerConn, but aborts the handshake if
+// ctx is done before it completes, in which case c is closed and the error
+// wraps ctx.Err(). Once the connection is established, ctx does not affect
+// it anymore.
+func NewServerConnContext(ctx context.Context, c net.Conn, config *ServerConfig) (*ServerConn, <-chan NewChannel, <-chan *Request, error) {
 	fullConf := *config
 	fullConf.SetDefaults()
 	if fullConf.MaxAuthTries == 0 {
 		fullConf.MaxAuthTries = 6
 	}
+	policy, err := fullConf.policyAlgorithms()
+	if err != nil {
+		c.Close()
+		return nil, nil, nil, err
+	}
+	if policy != nil && len(fullConf.PublicKeyAuthAlgorithms) == 0 {
+		fullConf.PublicKeyAuthAlgorithms = policy.PublicKeyAuths
+	}
 	if len(fullConf.PublicKeyAuthAlgorithms) == 0 {
 		fullConf.PublicKeyAuthAlgorithms = supportedPubKeyAuthAlgos
 	} else {
@@ -229,6 +317,9 @@ func NewServerConn(c net.Conn, config *ServerConfig) (*ServerConn, <-chan NewCha
 			}
 		}
 	}
+	if policy != nil {
+		fullConf.PublicKeyAuthAlgorithms = applyPolicy(fullConf.PublicKeyAuthAlgorithms, policy.PublicKeyAuths)
+	}
 	// Check if the config contains any unsupported key exchanges
 	for _, kex := range fullConf.KeyExchanges {
 		if _, ok := serverForbiddenKexAlgos[kex]; ok {
@@ -237,10 +328,33 @@ func NewServerConn(c net.Conn, config *ServerConfig) (*ServerConn, <-chan NewCha
 		}
 	}
 
+	if fullConf.StartupLimiter != nil {
+		release, err := fullConf.StartupLimiter.acquire(c.RemoteAddr())
+		if err != nil {
+			c.Close()
+			return nil, nil, nil, err
+		}
+		defer release()
+	}
+	var timer *time.Timer
+	if fullConf.PreAuthTimeout > 0 {
+		timer = time.AfterFunc(fullConf.PreAuthTimeout, func() { c.Close() })
+	}
+
 	s := &connection{
 		sshConn: sshConn{conn: c},
 	}
+	stop := watchContext(ctx, c)
 	perms, err := s.serverHandshake(&fullConf)
+	if ctxErr := stop(); ctxErr != nil {
+		c.Close()
+		return nil, nil, nil, fmt.Errorf("ssh: handshake failed: %w", ctxErr)
+	}
+	if timer != nil && !timer.Stop() {
+		// The connection was closed by the timer.
+		c.Close()
+		return nil, nil, nil, errors.New("ssh: pre-authentication timeout exceeded")
+	}
 	if err != nil {
 		c.Close()
 		return nil, nil, nil, err
@@ -267,7 +381,7 @@ func (s *connection) serverHandshake(config *ServerConfig) (*Permissions, error)
 	}
 
 	if !config.NoClientAuth && config.PasswordCallback == nil && config.PublicKeyCallback == nil &&
-		config.KeyboardInteractiveCallback == nil && (config.GSSAPIWithMICConfig == nil ||
+		config.KeyboardInteractiveCallback == nil && config.HostbasedCallback == nil && (config.GSSAPIWithMICConfig == nil ||
 		config.GSSAPIWithMICConfig.AllowLogin == nil || config.GSSAPIWithMICConfig.Server == nil) {
 		return nil, errors.New("ssh: no authentication methods configured but NoClientAuth is also false")
 	}
@@ -316,7 +430,18 @@ func (s *connection) serverHandshake(config *ServerConfig) (*Permissions, error)
 	if err != nil {
 		return nil, err
 	}
-	s.mux = newMux(s.transport)
+	s.mux = newMuxRequestHandler(s.transport, s.serverRequestHandler(config))
+	s.pingSupported = true
+	if config.RecordSession != nil {
+		// Channels are only accepted once NewServerConn returned.
+		recordSession := config.RecordSession
+		s.mux.recordSession = func() (SessionRecorder, error) { return recordSession(s) }
+	}
+	if config.AnnounceHostKeys {
+		if err := s.announceHostKeys(announcedHostKeys(config)); err != nil {
+			return nil, err
+		}
+	}
 	return perms, err
 }
 
@@ -463,6 +588,9 @@ type ServerAuthCallbacks struct {
 
 	// GSSAPIWithMICConfig behaves like [ServerConfig.GSSAPIWithMICConfig].
 	GSSAPIWithMICConfig *GSSAPIWithMICConfig
+
+	// HostbasedCallback behaves like [ServerConfig.HostbasedCallback].
+	HostbasedCallback func(conn ConnMetadata, clientHost, clientUser string, key PublicKey) (*Permissions, error)
 }
 
 // PartialSuccessError can be returned by any of the [ServerConfig]
@@ -528,20 +656,24 @@ func (s *connection) serverAuthenticate(config *ServerConfig) (*Permissions, err
 		PublicKeyCallback:           config.PublicKeyCallback,
 		KeyboardInteractiveCallback: config.KeyboardInteractiveCallback,
 		GSSAPIWithMICConfig:         config.GSSAPIWithMICConfig,
+		HostbasedCallback:           config.HostbasedCallback,
 	}
 
 userAuthLoop:
 	for {
 		if authFailures >= config.MaxAuthTries && config.MaxAuthTries > 0 {
 			discMsg := &disconnectMsg{
-				Reason:  2,
+				Reason:  uint32(DisconnectProtocolError),
 				Message: "too many authentication failures",
 			}
 
 			if err := s.transport.writePacket(Marshal(discMsg)); err != nil {
 				return nil, err
 			}
-			authErrs = append(authErrs, discMsg)
+			authErrs = append(authErrs, &DisconnectError{
+				Reason:  DisconnectProtocolError,
+				Message: discMsg.Message,
+			})
 			return nil, &ServerAuthError{Errors: authErrs}
 		}
 
@@ -578,6 +710,20 @@ userAuthLoop:
 				}
 			}
 		}
+		// Hostbound requests are reported as the publickey method they
+		// are a variant of.
+		method := userAuthReq.Method
+		if method == publicKeyHostboundMethod {
+			method = "publickey"
+		}
+
+		if config.AuthBannerCallback != nil {
+			if msg := config.AuthBannerCallback(s, method); msg != "" {
+				if err := s.transport.writePacket(Marshal(&userAuthBannerMsg{Message: msg})); err != nil {
+					return nil, err
+				}
+			}
+		}
 
 		perms = nil
 		authErr := ErrNoAuth
@@ -618,7 +764,7 @@ userAuthLoop:
 
 			prompter := &sshClientKeyboardInteractive{s}
 			perms, authErr = authConfig.KeyboardInteractiveCallback(s, prompter.Challenge)
-		case "publickey":
+		case "publickey", publicKeyHostboundMethod:
 			if authConfig.PublicKeyCallback == nil {
 				authErr = errors.New("ssh: publickey auth not configured")
 				break
@@ -649,6 +795,20 @@ userAuthLoop:
 				return nil, err
 			}
 
+			// Hostbound requests name the host key the client saw, which
+			// must be the one used in the key exchange of this connection,
+			// not just any of ours. See [PROTOCOL].
+			var hostKey []byte
+			if userAuthReq.Method == publicKeyHostboundMethod {
+				if hostKey, payload, ok = parseString(payload); !ok {
+					return nil, parseError(msgUserAuthRequest)
+				}
+				if !bytes.Equal(hostKey, s.transport.serverHostKey) {
+					authErr = errors.New("ssh: publickey-hostbound request for another host key")
+					break
+				}
+			}
+
 			candidate, ok := cache.get(s.user, pubKeyData)
 			if !ok {
 				candidate.user = s.user
@@ -718,14 +878,81 @@ userAuthLoop:
 				}
 
 				signedData := buildDataSignedForAuth(sessionID, userAuthReq, algo, pubKeyData)
+				if hostKey != nil {
+					signedData = buildDataSignedForHostboundAuth(sessionID, userAuthReq, algo, pubKeyData, hostKey)
+				}
 
 				if err := pubKey.Verify(signedData, sig); err != nil {
 					return nil, err
 				}
+				if err := checkSKSignature(sig, candidate.perms); err != nil {
+					authErr = err
+					break
+				}
 
 				authErr = candidate.result
 				perms = candidate.perms
 			}
+		case "hostbased":
+			if authConfig.HostbasedCallback == nil {
+				authErr = errors.New("ssh: hostbased auth not configured")
+				break
+			}
+			var req struct {
+				Algoname   string
+				PubKey     []byte
+				ClientHost string
+				ClientUser string
+				Sig        []byte
+			}
+			if err := Unmarshal(userAuthReq.Payload, &req); err != nil {
+				return nil, parseError(msgUserAuthRequest)
+			}
+			if !contains(config.PublicKeyAuthAlgorithms, underlyingAlgo(req.Algoname)) {
+				authErr = fmt.Errorf("ssh: algorithm %q not accepted", req.Algoname)
+				break
+			}
+			pubKey, err := ParsePublicKey(req.PubKey)
+			if err != nil {
+				return nil, err
+			}
+			sig, rest, ok := parseSignatureBody(req.Sig)
+			if !ok || len(rest) > 0 {
+				return nil, parseError(msgUserAuthRequest)
+			}
+			// As for publickey, the declared algorithm must match both
+			// the key and the signature.
+			if !contains(algorithmsForKeyFormat(pubKey.Type()), req.Algoname) {
+				authErr = fmt.Errorf("ssh: public key type %q not compatible with selected algorithm %q",
+					pubKey.Type(), req.Algoname)
+				break
+			}
+			if !contains(config.PublicKeyAuthAlgorithms, sig.Format) {
+				authErr = fmt.Errorf("ssh: algorithm %q not accepted", sig.Format)
+				break
+			}
+			if !isAlgoCompatible(req.Algoname, sig.Format) {
+				authErr = fmt.Errorf("ssh: signature %q not compatible with selected algorithm %q", sig.Format, req.Algoname)
+				break
+			}
+
+			signedData := buildDataSignedForHostbased(sessionID, userAuthReq, req.Algoname, req.PubKey, req.ClientHost, req.ClientUser)
+			if err := pubKey.Verify(signedData, sig); err != nil {
+				return nil, err
+			}
+			perms, authErr = authConfig.HostbasedCallback(s, req.ClientHost, req.ClientUser, pubKey)
+			// The permissions are enforced as for publickey.
+			if _, isPartialSuccessError := authErr.(*PartialSuccessError); authErr == nil || isPartialSuccessError {
+				if perms != nil && perms.CriticalOptions[sourceAddressCriticalOption] != "" {
+					if err := checkSourceAddress(s.RemoteAddr(), perms.CriticalOptions[sourceAddressCriticalOption]); err != nil {
+						authErr = err
+						break
+					}
+				}
+				if err := checkSKSignature(sig, perms); err != nil {
+					authErr = err
+				}
+			}
 		case "gssapi-with-mic":
 			if authConfig.GSSAPIWithMICConfig == nil {
 				authErr = errors.New("ssh: gssapi-with-mic auth not configured")
@@ -780,7 +1007,7 @@ userAuthLoop:
 		authErrs = append(authErrs, authErr)
 
 		if config.AuthLogCallback != nil {
-			config.AuthLogCallback(s, userAuthReq.Method, authErr)
+			config.AuthLogCallback(s, method, authErr)
 		}
 
 		var bannerErr *BannerError
@@ -876,6 +1103,9 @@ userAuthLoop:
 			authConfig.GSSAPIWithMICConfig.AllowLogin != nil {
 			failureMsg.Methods = append(failureMsg.Methods, "gssapi-with-mic")
 		}
+		if authConfig.HostbasedCallback != nil {
+			failureMsg.Methods = append(failureMsg.Methods, "hostbased")
+		}
 
 		if len(failureMsg.Methods) == 0 {
 			return nil, errors.New("ssh: no authentication methods available")
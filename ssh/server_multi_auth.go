@@ -0,0 +1,124 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+// SetAuthCallbacks sets the authentication callbacks of s, which are
+// otherwise set individually, to those of callbacks. It is typically used
+// with RequireAll:
+//
+//	config.SetAuthCallbacks(ssh.RequireAll(
+//		ssh.ServerAuthCallbacks{PublicKeyCallback: checkKey},
+//		ssh.ServerAuthCallbacks{KeyboardInteractiveCallback: checkOTP},
+//	))
+func (s *ServerConfig) SetAuthCallbacks(callbacks ServerAuthCallbacks) {
+	s.PasswordCallback = callbacks.PasswordCallback
+	s.PublicKeyCallback = callbacks.PublicKeyCallback
+	s.KeyboardInteractiveCallback = callbacks.KeyboardInteractiveCallback
+	s.GSSAPIWithMICConfig = callbacks.GSSAPIWithMICConfig
+	s.HostbasedCallback = callbacks.HostbasedCallback
+}
+
+// RequireAll returns authentication callbacks which require the client to
+// pass each of steps in order, for instance a public key and then a one-time
+// password with keyboard-interactive authentication. Each step is passed
+// with any of its non-nil callbacks, and the client is only offered the
+// methods of the current step.
+//
+// The callbacks of a step are used as usual. On success, RequireAll returns
+// a PartialSuccessError for the next step to the server, so the callbacks
+// of steps don't need to. They may still return a PartialSuccessError
+// themselves, whose Next callbacks are then required before the following
+// steps.
+//
+// The Permissions of all the steps are merged into those of the
+// connection, with the entries of later steps taking precedence. Permissions
+// returned by a step apply as soon as it passes: for example the
+// "source-address" critical option of a public key of the first step is
+// checked before the second step starts.
+func RequireAll(steps ...ServerAuthCallbacks) ServerAuthCallbacks {
+	return requireAll(nil, steps)
+}
+
+// requireAll returns the callbacks of steps[0], which merge their
+// Permissions with perms and those of the other steps.
+func requireAll(perms *Permissions, steps []ServerAuthCallbacks) ServerAuthCallbacks {
+	if len(steps) == 0 {
+		return ServerAuthCallbacks{}
+	}
+	step, rest := steps[0], steps[1:]
+
+	// done processes the result of a callback of step.
+	done := func(p *Permissions, err error) (*Permissions, error) {
+		next := rest
+		if partial, ok := err.(*PartialSuccessError); ok {
+			next = append([]ServerAuthCallbacks{partial.Next}, rest...)
+		} else if err != nil {
+			return p, err
+		}
+		merged := mergePermissions(perms, p)
+		if len(next) == 0 {
+			return merged, nil
+		}
+		return p, &PartialSuccessError{Next: requireAll(merged, next)}
+	}
+
+	var cb ServerAuthCallbacks
+	if step.PasswordCallback != nil {
+		cb.PasswordCallback = func(conn ConnMetadata, password []byte) (*Permissions, error) {
+			return done(step.PasswordCallback(conn, password))
+		}
+	}
+	if step.PublicKeyCallback != nil {
+		cb.PublicKeyCallback = func(conn ConnMetadata, key PublicKey) (*Permissions, error) {
+			return done(step.PublicKeyCallback(conn, key))
+		}
+	}
+	if step.KeyboardInteractiveCallback != nil {
+		cb.KeyboardInteractiveCallback = func(conn ConnMetadata, client KeyboardInteractiveChallenge) (*Permissions, error) {
+			return done(step.KeyboardInteractiveCallback(conn, client))
+		}
+	}
+	if gss := step.GSSAPIWithMICConfig; gss != nil {
+		cb.GSSAPIWithMICConfig = &GSSAPIWithMICConfig{
+			AllowLogin: func(conn ConnMetadata, srcName string) (*Permissions, error) {
+				return done(gss.AllowLogin(conn, srcName))
+			},
+			Server: gss.Server,
+		}
+	}
+	if step.HostbasedCallback != nil {
+		cb.HostbasedCallback = func(conn ConnMetadata, clientHost, clientUser string, key PublicKey) (*Permissions, error) {
+			return done(step.HostbasedCallback(conn, clientHost, clientUser, key))
+		}
+	}
+	return cb
+}
+
+// mergePermissions returns the union of a and b, with the entries of b
+// taking precedence. It returns a or b as is if the other one is nil.
+func mergePermissions(a, b *Permissions) *Permissions {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	merged := &Permissions{}
+	for _, p := range []*Permissions{a, b} {
+		for k, v := range p.CriticalOptions {
+			if merged.CriticalOptions == nil {
+				merged.CriticalOptions = make(map[string]string)
+			}
+			merged.CriticalOptions[k] = v
+		}
+		for k, v := range p.Extensions {
+			if merged.Extensions == nil {
+				merged.Extensions = make(map[string]string)
+			}
+			merged.Extensions[k] = v
+		}
+	}
+	return merged
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -410,3 +411,124 @@ func TestDynamicAuthCallbacks(t *testing.T) {
 		t.Fatal("server not returned partial success")
 	}
 }
+
+func TestRequireAll(t *testing.T) {
+	errWrongOTP := errors.New("wrong one-time password")
+	serverConfig := &ServerConfig{}
+	serverConfig.SetAuthCallbacks(RequireAll(
+		ServerAuthCallbacks{
+			PublicKeyCallback: func(conn ConnMetadata, key PublicKey) (*Permissions, error) {
+				if !bytes.Equal(key.Marshal(), testPublicKeys["rsa"].Marshal()) {
+					return nil, fmt.Errorf("pubkey for %q not acceptable", conn.User())
+				}
+				return &Permissions{Extensions: map[string]string{"key": "rsa", "step": "1"}}, nil
+			},
+		},
+		ServerAuthCallbacks{
+			KeyboardInteractiveCallback: func(conn ConnMetadata, client KeyboardInteractiveChallenge) (*Permissions, error) {
+				answers, err := client("", "", []string{"otp"}, []bool{true})
+				if err != nil {
+					return nil, err
+				}
+				if len(answers) != 1 || answers[0] != "123456" {
+					return nil, errWrongOTP
+				}
+				return &Permissions{Extensions: map[string]string{"step": "2"}}, nil
+			},
+		},
+	))
+	if serverConfig.PublicKeyCallback == nil || serverConfig.KeyboardInteractiveCallback != nil {
+		t.Fatal("only the public key callback of the first step should be set")
+	}
+
+	clientConfig := &ClientConfig{
+		User: "testuser",
+		Auth: []AuthMethod{
+			KeyboardInteractive(keyboardInteractive{"otp": "123456"}.Challenge),
+			PublicKeys(testSigners["rsa"]),
+		},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+	serverAuthErrors, err := doClientServerAuth(t, serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("client login error: %s", err)
+	}
+	// The error sequence is:
+	// - no auth passed yet
+	// - partial success
+	// - nil
+	if len(serverAuthErrors) != 3 {
+		t.Fatalf("unexpected number of server auth errors: %v, errors: %+v", len(serverAuthErrors), serverAuthErrors)
+	}
+	if _, ok := serverAuthErrors[1].(*PartialSuccessError); !ok {
+		t.Fatalf("expected partial success error, got: %v", serverAuthErrors[1])
+	}
+
+	// A wrong second factor fails the login.
+	clientConfig.Auth = []AuthMethod{
+		PublicKeys(testSigners["rsa"]),
+		KeyboardInteractive(keyboardInteractive{"otp": "000000"}.Challenge),
+	}
+	serverAuthErrors, err = doClientServerAuth(t, serverConfig, clientConfig)
+	if err == nil {
+		t.Fatal("client login with a wrong one-time password must fail")
+	}
+	if last := serverAuthErrors[len(serverAuthErrors)-1]; last != errWrongOTP {
+		t.Errorf("got last server auth error %v, want %v", last, errWrongOTP)
+	}
+}
+
+func TestRequireAllPermissions(t *testing.T) {
+	callbacks := RequireAll(
+		ServerAuthCallbacks{
+			PasswordCallback: func(conn ConnMetadata, password []byte) (*Permissions, error) {
+				return &Permissions{
+					CriticalOptions: map[string]string{"force-command": "true"},
+					Extensions:      map[string]string{"a": "1", "b": "1"},
+				}, nil
+			},
+		},
+		ServerAuthCallbacks{
+			PasswordCallback: func(conn ConnMetadata, password []byte) (*Permissions, error) {
+				// Nested steps are required before the following ones.
+				return nil, &PartialSuccessError{Next: ServerAuthCallbacks{
+					PasswordCallback: func(conn ConnMetadata, password []byte) (*Permissions, error) {
+						return &Permissions{Extensions: map[string]string{"b": "2"}}, nil
+					},
+				}}
+			},
+		},
+		ServerAuthCallbacks{
+			PasswordCallback: func(conn ConnMetadata, password []byte) (*Permissions, error) {
+				if string(password) != "last" {
+					return nil, errors.New("wrong password")
+				}
+				return &Permissions{Extensions: map[string]string{"c": "3"}}, nil
+			},
+		},
+	)
+
+	var perms *Permissions
+	for i := 0; i < 4; i++ {
+		var err error
+		perms, err = callbacks.PasswordCallback(nil, []byte("last"))
+		if i == 3 {
+			if err != nil {
+				t.Fatalf("last step: %v", err)
+			}
+			break
+		}
+		partial, ok := err.(*PartialSuccessError)
+		if !ok {
+			t.Fatalf("step %d: got error %v, want a PartialSuccessError", i, err)
+		}
+		callbacks = partial.Next
+	}
+	want := &Permissions{
+		CriticalOptions: map[string]string{"force-command": "true"},
+		Extensions:      map[string]string{"a": "1", "b": "2", "c": "3"},
+	}
+	if !reflect.DeepEqual(perms, want) {
+		t.Errorf("got permissions %+v, want %+v", perms, want)
+	}
+}
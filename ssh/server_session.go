@@ -0,0 +1,195 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"sync"
+)
+
+// TerminalSize is the size of a terminal, in characters and in pixels, as
+// sent by Session.RequestPty and Session.WindowChange.
+type TerminalSize struct {
+	Columns, Rows uint32
+	Width, Height uint32
+}
+
+// PtyRequest is a request for a pseudo-terminal, as sent by
+// Session.RequestPty.
+type PtyRequest struct {
+	Term  string
+	Size  TerminalSize
+	Modes TerminalModes
+}
+
+// ServerSession handles the requests of a "session" channel accepted by a
+// server, as sent by the methods of Session. It keeps track of the
+// environment variables and the pseudo-terminal requested by the client,
+// and delivers window changes on a channel.
+//
+// The other requests, such as "exec", "shell", "subsystem" and "signal",
+// are delivered by Requests, and must be serviced by the application.
+type ServerSession struct {
+	Channel
+
+	requests      chan *Request
+	windowChanges chan TerminalSize
+
+	mu  sync.Mutex
+	env []string
+	pty *PtyRequest
+}
+
+// NewServerSession returns a ServerSession handling reqs, the requests of
+// the session channel ch.
+func NewServerSession(ch Channel, reqs <-chan *Request) *ServerSession {
+	s := &ServerSession{
+		Channel:       ch,
+		requests:      make(chan *Request),
+		windowChanges: make(chan TerminalSize, 1),
+	}
+	go s.handleRequests(reqs)
+	return s
+}
+
+func (s *ServerSession) handleRequests(reqs <-chan *Request) {
+	defer close(s.requests)
+	defer close(s.windowChanges)
+	for req := range reqs {
+		switch req.Type {
+		case "env":
+			var msg setenvRequest
+			if err := Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			s.mu.Lock()
+			s.env = append(s.env, msg.Name+"="+msg.Value)
+			s.mu.Unlock()
+			req.Reply(true, nil)
+		case "pty-req":
+			pty, err := parsePtyRequest(req.Payload)
+			s.mu.Lock()
+			ok := err == nil && s.pty == nil
+			if ok {
+				s.pty = pty
+			}
+			s.mu.Unlock()
+			req.Reply(ok, nil)
+		case "window-change":
+			var msg ptyWindowChangeMsg
+			if err := Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			s.windowChanged(TerminalSize(msg))
+			req.Reply(true, nil)
+		default:
+			s.requests <- req
+		}
+	}
+}
+
+// windowChanged delivers size, replacing a size that was not received yet.
+func (s *ServerSession) windowChanged(size TerminalSize) {
+	select {
+	case s.windowChanges <- size:
+	default:
+		select {
+		case <-s.windowChanges:
+		default:
+		}
+		s.windowChanges <- size
+	}
+}
+
+func parsePtyRequest(payload []byte) (*PtyRequest, error) {
+	var msg ptyRequestMsg
+	if err := Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+	modes, err := ParseTerminalModes([]byte(msg.Modelist))
+	if err != nil {
+		return nil, err
+	}
+	return &PtyRequest{
+		Term: msg.Term,
+		Size: TerminalSize{
+			Columns: msg.Columns,
+			Rows:    msg.Rows,
+			Width:   msg.Width,
+			Height:  msg.Height,
+		},
+		Modes: modes,
+	}, nil
+}
+
+// Requests returns the channel of the requests that aren't handled by s.
+// It must be serviced, and is closed when the session channel is.
+func (s *ServerSession) Requests() <-chan *Request {
+	return s.requests
+}
+
+// WindowChanges returns a channel that receives the size of the terminal
+// when the client reports that it changed. Only the latest size is kept
+// until it is received. The channel is closed when the session channel is.
+func (s *ServerSession) WindowChanges() <-chan TerminalSize {
+	return s.windowChanges
+}
+
+// Env returns the environment variables requested by the client so far,
+// in the "key=value" form of os/exec. All of them are accepted, so the
+// application should filter them before applying them to a command.
+func (s *ServerSession) Env() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.env...)
+}
+
+// Pty returns the pseudo-terminal requested by the client, or nil if it
+// requested none.
+func (s *ServerSession) Pty() *PtyRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pty
+}
+
+// RFC 4254 Section 6.10.
+type exitStatusRequestMsg struct {
+	Status uint32
+}
+
+// RFC 4254 Section 6.10.
+type exitSignalRequestMsg struct {
+	Signal     string
+	CoreDumped bool
+	Error      string
+	Lang       string
+}
+
+// Exit sends the exit status of the command to the client, and closes the
+// session channel.
+func (s *ServerSession) Exit(status uint32) error {
+	_, err := s.SendRequest("exit-status", false, Marshal(&exitStatusRequestMsg{status}))
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ExitSignal reports to the client that the command was terminated by sig,
+// with the error message msg in the language lang, and closes the session
+// channel. The client returns them in an *ExitError.
+func (s *ServerSession) ExitSignal(sig Signal, coreDumped bool, msg, lang string) error {
+	_, err := s.SendRequest("exit-signal", false, Marshal(&exitSignalRequestMsg{
+		Signal:     string(sig),
+		CoreDumped: coreDumped,
+		Error:      msg,
+		Lang:       lang,
+	}))
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
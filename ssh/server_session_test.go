@@ -0,0 +1,103 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTerminalModes(t *testing.T) {
+	modes := TerminalModes{}.SetFlag(ECHO, false).SetFlag(ICANON, true).SetChar(VINTR, 3).SetSpeed(14400, 38400)
+	want := TerminalModes{ECHO: 0, ICANON: 1, VINTR: 3, TTY_OP_ISPEED: 14400, TTY_OP_OSPEED: 38400}
+	if !reflect.DeepEqual(modes, want) {
+		t.Fatalf("got modes %v, want %v", modes, want)
+	}
+	got, err := ParseTerminalModes(modes.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got parsed modes %v, want %v", got, want)
+	}
+
+	// Parsing stops at undefined opcodes.
+	got, err = ParseTerminalModes([]byte{ECHO, 0, 0, 0, 1, 160, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, TerminalModes{ECHO: 1}) {
+		t.Errorf("got parsed modes %v, want ECHO only", got)
+	}
+	if _, err := ParseTerminalModes([]byte{ECHO, 0, 0}); err == nil {
+		t.Error("ParseTerminalModes succeeded with truncated modes")
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	wantPty := &PtyRequest{
+		Term:  "xterm",
+		Size:  TerminalSize{Columns: 80, Rows: 24, Width: 640, Height: 192},
+		Modes: TerminalModes{}.SetFlag(ECHO, false).SetSpeed(38400, 38400),
+	}
+	resized := make(chan struct{})
+	conn := dial(func(ch Channel, in <-chan *Request, t *testing.T) {
+		s := NewServerSession(ch, in)
+		for req := range s.Requests() {
+			if req.Type != "shell" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			if env := s.Env(); !reflect.DeepEqual(env, []string{"LANG=C", "TERM_PROGRAM=test"}) {
+				t.Errorf("got environment %q", env)
+			}
+			if pty := s.Pty(); !reflect.DeepEqual(pty, wantPty) {
+				t.Errorf("got pty %+v, want %+v", pty, wantPty)
+			}
+			close(resized)
+			if size := <-s.WindowChanges(); size != (TerminalSize{Columns: 120, Rows: 40, Width: 960, Height: 320}) {
+				t.Errorf("got window change %+v", size)
+			}
+			if err := s.ExitSignal(SIGSEGV, true, "segmentation fault", "en"); err != nil {
+				t.Errorf("ExitSignal: %v", err)
+			}
+			return
+		}
+	}, t)
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.Setenv("LANG", "C"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Setenv("TERM_PROGRAM", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm", 24, 80, wantPty.Modes); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	<-resized
+	if err := session.WindowChange(40, 120); err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.Wait()
+	e, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("got error %v, want an *ExitError", err)
+	}
+	if e.Signal() != "SEGV" || !e.CoreDumped() || e.Msg() != "segmentation fault" || e.Lang() != "en" || e.ExitStatus() != 128+11 {
+		t.Errorf("got exit signal %q, core dumped %v, message %q, language %q and status %d",
+			e.Signal(), e.CoreDumped(), e.Msg(), e.Lang(), e.ExitStatus())
+	}
+}
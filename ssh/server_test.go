@@ -6,6 +6,7 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -137,7 +138,7 @@ func TestMaxAuthTriesNoneMethod(t *testing.T) {
 	}
 	for i := 0; i <= serverConfig.MaxAuthTries; i++ {
 		auth := new(noneAuth)
-		_, _, err := auth.auth(c.sessionID, clientConfig.User, c.transport, clientConfig.Rand, nil)
+		_, _, err := auth.auth(context.Background(), c.sessionID, clientConfig.User, c.transport, clientConfig.Rand, nil)
 		if i < serverConfig.MaxAuthTries {
 			if err != nil {
 				t.Fatal(err)
@@ -228,6 +229,104 @@ func TestNewServerConnValidationErrors(t *testing.T) {
 	}
 }
 
+func TestAuthBanners(t *testing.T) {
+	serverConfig := &ServerConfig{
+		AuthBannerCallback: func(conn ConnMetadata, method string) string {
+			if method == "none" {
+				return ""
+			}
+			return "before " + method + " for " + conn.User()
+		},
+		PublicKeyCallback: func(conn ConnMetadata, key PublicKey) (*Permissions, error) {
+			return nil, &BannerError{Err: errors.New("denied"), Message: "key denied"}
+		},
+		PasswordCallback: func(conn ConnMetadata, password []byte) (*Permissions, error) {
+			return &Permissions{}, nil
+		},
+	}
+	serverConfig.AddHostKey(testSigners["rsa"])
+
+	type banner struct {
+		method, message string
+		attempt         int
+	}
+	var banners []banner
+	clientConfig := &ClientConfig{
+		User: "test",
+		Auth: []AuthMethod{
+			PublicKeys(testSigners["rsa"]),
+			Password(clientPassword),
+		},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+		BannerCallback: func(msg string) error {
+			t.Errorf("BannerCallback called with %q", msg)
+			return nil
+		},
+		AuthBannerCallback: func(b AuthBanner) error {
+			if b.User != "test" {
+				t.Errorf("got user %q, want test", b.User)
+			}
+			banners = append(banners, banner{b.Method, b.Message, b.Attempt})
+			return nil
+		},
+	}
+
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	go newServer(c1, serverConfig)
+	c, _, _, err := NewClientConn(c2, "", clientConfig)
+	if err != nil {
+		t.Fatalf("client connection failed: %v", err)
+	}
+	defer c.Close()
+
+	want := []banner{
+		{"publickey", "before publickey for test", 2},
+		{"publickey", "key denied", 2},
+		{"password", "before password for test", 3},
+	}
+	if !reflect.DeepEqual(banners, want) {
+		t.Errorf("got banners:\n%v\nwant banners:\n%v", banners, want)
+	}
+}
+
+func TestAuthBannerCallbackError(t *testing.T) {
+	serverConfig := &ServerConfig{
+		BannerCallback: func(ConnMetadata) string { return "unauthorized access prohibited" },
+		PasswordCallback: func(conn ConnMetadata, password []byte) (*Permissions, error) {
+			return &Permissions{}, nil
+		},
+	}
+	serverConfig.AddHostKey(testSigners["rsa"])
+	errBanner := errors.New("banner refused")
+	clientConfig := &ClientConfig{
+		User:            "test",
+		Auth:            []AuthMethod{Password(clientPassword)},
+		HostKeyCallback: InsecureIgnoreHostKey(),
+		AuthBannerCallback: func(b AuthBanner) error {
+			if b.Method != "none" || b.Attempt != 1 {
+				t.Errorf("got banner during %q attempt %d, want the initial none query", b.Method, b.Attempt)
+			}
+			return errBanner
+		},
+	}
+
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	go newServer(c1, serverConfig)
+	if _, _, _, err := NewClientConn(c2, "", clientConfig); err == nil {
+		t.Fatal("client connection succeeded despite the AuthBannerCallback error")
+	}
+}
+
 func TestBannerError(t *testing.T) {
 	serverConfig := &ServerConfig{
 		BannerCallback: func(ConnMetadata) string {
@@ -390,3 +489,173 @@ func (*markerConn) RemoteAddr() net.Addr { return nil }
 func (*markerConn) SetDeadline(t time.Time) error      { return nil }
 func (*markerConn) SetReadDeadline(t time.Time) error  { return nil }
 func (*markerConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestStartupLimiter(t *testing.T) {
+	addr := func(ip string) net.Addr { return &net.TCPAddr{IP: net.ParseIP(ip), Port: 22} }
+	l := &StartupLimiter{Full: 3, PerSource: 2}
+
+	release1, err := l.acquire(addr("192.0.2.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(addr("192.0.2.1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(addr("192.0.2.1")); err != ErrTooManyStartups {
+		t.Errorf("third startup from one source: got %v, want ErrTooManyStartups", err)
+	}
+	if _, err := l.acquire(addr("2001:db8::1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(addr("2001:db8::2")); err != ErrTooManyStartups {
+		t.Errorf("startup over Full: got %v, want ErrTooManyStartups", err)
+	}
+
+	release1()
+	release1()
+	if l.startups != 2 || l.sources["192.0.2.1"] != 1 {
+		t.Errorf("after release: %d startups, %d from source", l.startups, l.sources["192.0.2.1"])
+	}
+	if _, err := l.acquire(addr("2001:db8::2")); err != nil {
+		t.Errorf("startup after release: %v", err)
+	}
+}
+
+func TestStartupLimiterRandomDrop(t *testing.T) {
+	l := &StartupLimiter{Start: 10, Rate: 30, Full: 20}
+	for _, tt := range []struct {
+		startups int
+		min, max int // expected drops out of 1000
+	}{
+		{9, 0, 0},
+		{10, 200, 400},
+		{15, 550, 750},
+		{19, 850, 1000},
+		{20, 1000, 1000},
+	} {
+		l.startups = tt.startups
+		drops := 0
+		for i := 0; i < 1000; i++ {
+			if l.drop() {
+				drops++
+			}
+		}
+		if drops < tt.min || drops > tt.max {
+			t.Errorf("%d startups: dropped %d connections out of 1000, want between %d and %d", tt.startups, drops, tt.min, tt.max)
+		}
+	}
+}
+
+func TestNewServerConnStartupLimiter(t *testing.T) {
+	serverConf := &ServerConfig{
+		NoClientAuth:   true,
+		StartupLimiter: &StartupLimiter{Full: 1},
+	}
+	serverConf.AddHostKey(testSigners["ecdsap256"])
+	release, err := serverConf.StartupLimiter.acquire(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	c := &markerConn{}
+	if _, _, _, err := NewServerConn(c, serverConf); err != ErrTooManyStartups {
+		t.Fatalf("NewServerConn over the startup limit: got %v, want ErrTooManyStartups", err)
+	}
+	if !c.isClosed() {
+		t.Error("NewServerConn over the startup limit left connection open")
+	}
+	if c.isUsed() {
+		t.Error("NewServerConn over the startup limit used connection")
+	}
+}
+
+func TestPreAuthTimeout(t *testing.T) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	serverConf := &ServerConfig{
+		NoClientAuth:   true,
+		PreAuthTimeout: 50 * time.Millisecond,
+		StartupLimiter: &StartupLimiter{Full: 1},
+	}
+	serverConf.AddHostKey(testSigners["ecdsap256"])
+
+	// The client never sends its version.
+	done := make(chan error, 1)
+	go func() {
+		_, _, _, err := NewServerConn(c2, serverConf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "timeout") {
+			t.Errorf("NewServerConn: got %v, want timeout error", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("NewServerConn did not time out")
+	}
+	if n := serverConf.StartupLimiter.startups; n != 0 {
+		t.Errorf("%d startups after timeout, want 0", n)
+	}
+
+	// A client that completes authentication in time keeps its connection.
+	c3, c4, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c3.Close()
+	defer c4.Close()
+	go func() {
+		_, _, reqs, err := NewServerConn(c4, serverConf)
+		done <- err
+		if err == nil {
+			DiscardRequests(reqs)
+		}
+	}()
+	client, _, _, err := NewClientConn(c3, "", &ClientConfig{HostKeyCallback: InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	defer client.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("NewServerConn: %v", err)
+	}
+	time.Sleep(2 * serverConf.PreAuthTimeout)
+	if _, _, err := client.SendRequest("ping", true, nil); err != nil {
+		t.Errorf("request after the pre-authentication timeout: %v", err)
+	}
+}
+
+func TestNewServerConnContext(t *testing.T) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	serverConf := &ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(testSigners["ecdsap256"])
+
+	// The client never sends its version.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, _, _, err := NewServerConnContext(ctx, c2, serverConf)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("NewServerConnContext: got %v, want context.Canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("NewServerConnContext was not canceled")
+	}
+}
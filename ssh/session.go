@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 )
 
@@ -112,6 +113,66 @@ const (
 	TTY_OP_OSPEED = 129
 )
 
+// SetFlag sets the terminal mode flag mode, such as ECHO or ICANON, and
+// returns m.
+func (m TerminalModes) SetFlag(mode uint8, on bool) TerminalModes {
+	m[mode] = 0
+	if on {
+		m[mode] = 1
+	}
+	return m
+}
+
+// SetChar sets the control character mode, such as VINTR or VEOF, to c,
+// and returns m. A c of 255 disables the control character.
+func (m TerminalModes) SetChar(mode uint8, c byte) TerminalModes {
+	m[mode] = uint32(c)
+	return m
+}
+
+// SetSpeed sets the input and output baud rates of the terminal, and
+// returns m.
+func (m TerminalModes) SetSpeed(input, output uint32) TerminalModes {
+	m[TTY_OP_ISPEED] = input
+	m[TTY_OP_OSPEED] = output
+	return m
+}
+
+// marshal returns the encoded terminal modes of RFC 4254, section 8, in
+// the order of their opcodes.
+func (m TerminalModes) marshal() []byte {
+	modes := make([]int, 0, len(m))
+	for k := range m {
+		modes = append(modes, int(k))
+	}
+	sort.Ints(modes)
+	var tm []byte
+	for _, k := range modes {
+		tm = append(tm, byte(k))
+		tm = binary.BigEndian.AppendUint32(tm, m[uint8(k)])
+	}
+	return append(tm, tty_OP_END)
+}
+
+// ParseTerminalModes parses the encoded terminal modes of a pty-req
+// request, as described in RFC 4254, section 8. Parsing stops at the first
+// opcode from 160 to 255, which are not defined.
+func ParseTerminalModes(b []byte) (TerminalModes, error) {
+	m := make(TerminalModes)
+	for len(b) > 0 {
+		op := b[0]
+		if op == tty_OP_END || op >= 160 {
+			return m, nil
+		}
+		if len(b) < 5 {
+			return nil, errors.New("ssh: truncated terminal modes")
+		}
+		m[op] = binary.BigEndian.Uint32(b[1:5])
+		b = b[5:]
+	}
+	return m, nil
+}
+
 // A Session represents a connection to a remote command or shell.
 type Session struct {
 	// Stdin specifies the remote process's standard input.
@@ -152,6 +213,17 @@ func (s *Session) SendRequest(name string, wantReply bool, payload []byte) (bool
 	return s.ch.SendRequest(name, wantReply, payload)
 }
 
+// SendRequestAsync sends an out-of-band channel request with want reply set
+// on the SSH channel underlying the session, without waiting for the reply.
+// See AsyncRequestSender.
+func (s *Session) SendRequestAsync(name string, payload []byte) (*RequestReply, error) {
+	a, ok := s.ch.(AsyncRequestSender)
+	if !ok {
+		return nil, errors.New("ssh: channel does not support asynchronous requests")
+	}
+	return a.SendRequestAsync(name, payload)
+}
+
 func (s *Session) Close() error {
 	return s.ch.Close()
 }
@@ -188,23 +260,13 @@ type ptyRequestMsg struct {
 
 // RequestPty requests the association of a pty with the session on the remote host.
 func (s *Session) RequestPty(term string, h, w int, termmodes TerminalModes) error {
-	var tm []byte
-	for k, v := range termmodes {
-		kv := struct {
-			Key byte
-			Val uint32
-		}{k, v}
-
-		tm = append(tm, Marshal(&kv)...)
-	}
-	tm = append(tm, tty_OP_END)
 	req := ptyRequestMsg{
 		Term:     term,
 		Columns:  uint32(w),
 		Rows:     uint32(h),
 		Width:    uint32(w * 8),
 		Height:   uint32(h * 8),
-		Modelist: string(tm),
+		Modelist: string(termmodes.marshal()),
 	}
 	ok, err := s.ch.SendRequest("pty-req", true, Marshal(&req))
 	if err == nil && !ok {
@@ -437,6 +499,7 @@ func (s *Session) wait(reqs <-chan *Request) error {
 
 			// Must sanitize strings?
 			wm.signal = sigval.Signal
+			wm.coreDumped = sigval.CoreDumped
 			wm.msg = sigval.Error
 			wm.lang = sigval.Lang
 		default:
@@ -608,10 +671,11 @@ func (e *ExitError) Error() string {
 // Waitmsg stores the information about an exited remote command
 // as reported by Wait.
 type Waitmsg struct {
-	status int
-	signal string
-	msg    string
-	lang   string
+	status     int
+	signal     string
+	coreDumped bool
+	msg        string
+	lang       string
 }
 
 // ExitStatus returns the exit status of the remote command.
@@ -625,6 +689,12 @@ func (w Waitmsg) Signal() string {
 	return w.signal
 }
 
+// CoreDumped reports whether the remote command dumped core when it was
+// terminated by a signal.
+func (w Waitmsg) CoreDumped() bool {
+	return w.coreDumped
+}
+
 // Msg returns the exit message given by the remote command
 func (w Waitmsg) Msg() string {
 	return w.msg
@@ -639,6 +709,9 @@ func (w Waitmsg) String() string {
 	str := fmt.Sprintf("Process exited with status %v", w.status)
 	if w.signal != "" {
 		str += fmt.Sprintf(" from signal %v", w.signal)
+		if w.coreDumped {
+			str += " (core dumped)"
+		}
 	}
 	if w.msg != "" {
 		str += fmt.Sprintf(". Reason was: %v", w.msg)
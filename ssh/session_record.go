@@ -0,0 +1,167 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionEventType is the type of a SessionEvent.
+type SessionEventType int
+
+const (
+	// SessionInput is data sent by the client, such as keystrokes.
+	SessionInput SessionEventType = iota + 1
+	// SessionOutput is data sent by the server on the standard output.
+	SessionOutput
+	// SessionStderr is data sent by the server on the standard error.
+	SessionStderr
+	// SessionPty is a request for a pseudo-terminal, of type Term and
+	// size Size.
+	SessionPty
+	// SessionWindowChange is a change of the terminal size to Size.
+	SessionWindowChange
+	// SessionExec is a request to run Command.
+	SessionExec
+	// SessionShell is a request to run a login shell.
+	SessionShell
+	// SessionSubsystem is a request to run the subsystem Command, such
+	// as "sftp".
+	SessionSubsystem
+)
+
+// A SessionEvent is an event of a recorded session channel. See
+// ServerConfig.RecordSession.
+type SessionEvent struct {
+	// Time is when the server sent or received the event.
+	Time time.Time
+
+	Type SessionEventType
+
+	// Data is the data of SessionInput, SessionOutput and SessionStderr
+	// events. It must not be retained after SessionRecorder.Record
+	// returns.
+	Data []byte
+
+	// Command is the command of SessionExec events, and the name of the
+	// subsystem of SessionSubsystem events.
+	Command string
+
+	// Term is the terminal type of SessionPty events, such as "xterm".
+	Term string
+
+	// Size is the terminal size of SessionPty and SessionWindowChange
+	// events.
+	Size TerminalSize
+}
+
+// A SessionRecorder records the events of a session channel, for instance
+// to audit interactive sessions. See AsciicastWriter for a recorder
+// writing the asciicast format of asciinema.
+//
+// Record is called for the data written by the server as it is sent, and
+// for the data and the requests sent by the client as they are received,
+// so it delays them and should return quickly. The calls are serialized.
+// Requests are recorded whether or not the server accepts them.
+type SessionRecorder interface {
+	Record(event SessionEvent)
+
+	// Close is called once the session channel is closed, after the
+	// last event.
+	Close() error
+}
+
+// sessionRecording serializes the calls to a SessionRecorder.
+type sessionRecording struct {
+	mu     sync.Mutex
+	r      SessionRecorder
+	closed bool
+}
+
+func (s *sessionRecording) record(e SessionEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.r.Record(e)
+	}
+}
+
+func (s *sessionRecording) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.r.Close()
+	}
+}
+
+// startRecording sets up the recording of ch, an inbound session channel
+// being accepted, if the server records sessions.
+func (ch *channel) startRecording() error {
+	if ch.chanType != "session" || ch.direction != channelInbound || ch.mux.recordSession == nil {
+		return nil
+	}
+	r, err := ch.mux.recordSession()
+	if err != nil || r == nil {
+		return err
+	}
+	ch.recording.Store(&sessionRecording{r: r})
+	return nil
+}
+
+// recordData records data sent or received on ch.
+func (ch *channel) recordData(typ SessionEventType, data []byte) {
+	if r := ch.recording.Load(); r != nil {
+		r.record(SessionEvent{Time: time.Now(), Type: typ, Data: data})
+	}
+}
+
+// recordRequest records a request received on ch.
+func (ch *channel) recordRequest(req *Request) {
+	r := ch.recording.Load()
+	if r == nil {
+		return
+	}
+	e := SessionEvent{Time: time.Now()}
+	switch req.Type {
+	case "pty-req":
+		pty, err := parsePtyRequest(req.Payload)
+		if err != nil {
+			return
+		}
+		e.Type, e.Term, e.Size = SessionPty, pty.Term, pty.Size
+	case "window-change":
+		var msg ptyWindowChangeMsg
+		if err := Unmarshal(req.Payload, &msg); err != nil {
+			return
+		}
+		e.Type, e.Size = SessionWindowChange, TerminalSize(msg)
+	case "exec":
+		var msg execMsg
+		if err := Unmarshal(req.Payload, &msg); err != nil {
+			return
+		}
+		e.Type, e.Command = SessionExec, msg.Command
+	case "shell":
+		e.Type = SessionShell
+	case "subsystem":
+		var msg subsystemRequestMsg
+		if err := Unmarshal(req.Payload, &msg); err != nil {
+			return
+		}
+		e.Type, e.Command = SessionSubsystem, msg.Subsystem
+	default:
+		return
+	}
+	r.record(e)
+}
+
+// stopRecording ends the recording of ch, if any.
+func (ch *channel) stopRecording() {
+	if r := ch.recording.Swap(nil); r != nil {
+		r.close()
+	}
+}
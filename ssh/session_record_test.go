@@ -0,0 +1,225 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRecorder keeps the events of a session, without their time.
+type testRecorder struct {
+	mu     sync.Mutex
+	events []SessionEvent
+	closed chan struct{}
+}
+
+func (r *testRecorder) Record(e SessionEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.Time.IsZero() {
+		panic("event without time")
+	}
+	e.Time = time.Time{}
+	if e.Data != nil {
+		e.Data = append([]byte(nil), e.Data...)
+	}
+	r.events = append(r.events, e)
+}
+
+func (r *testRecorder) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestRecordSession(t *testing.T) {
+	rec := &testRecorder{closed: make(chan struct{})}
+	conf := &ServerConfig{NoClientAuth: true}
+	conf.RecordSession = func(conn ConnMetadata) (SessionRecorder, error) {
+		if conn.User() != "testuser" {
+			t.Errorf("got user %q, want testuser", conn.User())
+		}
+		return rec, nil
+	}
+	conn := dialConfig(func(ch Channel, in <-chan *Request, t *testing.T) {
+		defer ch.Close()
+		for req := range in {
+			req.Reply(true, nil)
+			if req.Type != "exec" {
+				continue
+			}
+			input, err := io.ReadAll(ch)
+			if err != nil {
+				t.Errorf("reading input: %v", err)
+			}
+			ch.Write(append([]byte("out:"), input...))
+			ch.Stderr().Write([]byte("err"))
+			ch.SendRequest("exit-status", false, Marshal(&exitStatusRequestMsg{0}))
+			return
+		}
+	}, conf, t)
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.WindowChange(40, 120); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("cat"); err != nil {
+		t.Fatal(err)
+	}
+	stdin.Write([]byte("hello"))
+	stdin.Close()
+	if _, err := io.ReadAll(out); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	<-rec.closed
+
+	want := []SessionEvent{
+		{Type: SessionPty, Term: "xterm", Size: TerminalSize{Columns: 80, Rows: 24, Width: 640, Height: 192}},
+		{Type: SessionWindowChange, Size: TerminalSize{Columns: 120, Rows: 40, Width: 960, Height: 320}},
+		{Type: SessionExec, Command: "cat"},
+		{Type: SessionInput, Data: []byte("hello")},
+		{Type: SessionOutput, Data: []byte("out:hello")},
+		{Type: SessionStderr, Data: []byte("err")},
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("got events %+v\nwant %+v", rec.events, want)
+	}
+}
+
+// TestRecordSessionStreams checks that the input of a channel is recorded
+// when it is delivered in order with its extended data.
+func TestRecordSessionStreams(t *testing.T) {
+	rec := &testRecorder{closed: make(chan struct{})}
+	conf := &ServerConfig{NoClientAuth: true}
+	conf.RecordSession = func(ConnMetadata) (SessionRecorder, error) {
+		return rec, nil
+	}
+	conn := dialConfig(func(ch Channel, in <-chan *Request, t *testing.T) {
+		defer ch.Close()
+		streams := ch.(*channel).streamOutput()
+		for req := range in {
+			req.Reply(true, nil)
+			if req.Type != "exec" {
+				continue
+			}
+			var input []byte
+			for {
+				chunk, ok := streams.next()
+				if !ok {
+					break
+				}
+				input = append(input, chunk.data...)
+				ch.(*channel).adjustWindow(uint32(len(chunk.data)))
+			}
+			ch.Write(append([]byte("out:"), input...))
+			ch.SendRequest("exit-status", false, Marshal(&exitStatusRequestMsg{0}))
+			return
+		}
+	}, conf, t)
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("cat"); err != nil {
+		t.Fatal(err)
+	}
+	stdin.Write([]byte("hello"))
+	stdin.Close()
+	if _, err := io.ReadAll(out); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	<-rec.closed
+
+	want := []SessionEvent{
+		{Type: SessionExec, Command: "cat"},
+		{Type: SessionInput, Data: []byte("hello")},
+		{Type: SessionOutput, Data: []byte("out:hello")},
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("got events %+v\nwant %+v", rec.events, want)
+	}
+}
+
+func TestRecordSessionError(t *testing.T) {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	errRecording := errors.New("recording unavailable")
+	conf := &ServerConfig{NoClientAuth: true}
+	conf.AddHostKey(testSigners["rsa"])
+	conf.RecordSession = func(ConnMetadata) (SessionRecorder, error) {
+		return nil, errRecording
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, chans, reqs, err := NewServerConn(c1, conf)
+		if err != nil {
+			t.Errorf("NewServerConn: %v", err)
+			return
+		}
+		defer conn.Close()
+		go DiscardRequests(reqs)
+		if _, _, err := (<-chans).Accept(); err != errRecording {
+			t.Errorf("Accept: got error %v, want %v", err, errRecording)
+		}
+	}()
+
+	conn, chans, reqs, err := NewClientConn(c2, "", &ClientConfig{HostKeyCallback: InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(conn, chans, reqs)
+	defer client.Close()
+	if _, err := client.NewSession(); err == nil {
+		t.Error("NewSession succeeded without recording")
+	}
+	<-done
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"sync"
+)
+
+// A StreamEvent is an event of a command started with Session.StartStream.
+type StreamEvent struct {
+	// Stderr reports whether Data was written to the standard error of
+	// the command, rather than to its standard output.
+	Stderr bool
+
+	// Data is a chunk of the output of the command. It is empty for the
+	// exit event.
+	Data []byte
+
+	// Exit reports whether this is the last event, sent once the command
+	// exited and all of its output was delivered.
+	Exit bool
+
+	// Err is the error Wait would return, set on the exit event only.
+	Err error
+}
+
+// StartStream runs cmd on the remote host like Start, and returns a channel
+// that receives the chunks of its standard output and standard error in
+// the order the server sent them, followed by an exit event. The channel is
+// closed after the exit event.
+//
+// This makes it possible to react to the output of a command as it
+// arrives, for example to answer the password prompt that "sudo -S" writes
+// to standard error through Stdin or StdinPipe, without a pseudo-terminal.
+//
+// Stdout and Stderr must be nil, and StdoutPipe and StderrPipe must not be
+// used. The channel must be serviced until it is closed: the server is not
+// allowed to send more output than is received, and Wait must not be
+// called, since the exit event reports its result.
+func (s *Session) StartStream(cmd string) (<-chan StreamEvent, error) {
+	if s.Stdout != nil {
+		return nil, errors.New("ssh: Stdout already set")
+	}
+	if s.Stderr != nil {
+		return nil, errors.New("ssh: Stderr already set")
+	}
+	if s.stdoutpipe || s.stderrpipe {
+		return nil, errors.New("ssh: StartStream after StdoutPipe or StderrPipe")
+	}
+	if s.started {
+		return nil, errors.New("ssh: session already started")
+	}
+	ch, ok := s.ch.(*channel)
+	if !ok {
+		return nil, errors.New("ssh: StartStream requires a session opened by Client.NewSession")
+	}
+	streams := ch.streamOutput()
+	// The output is delivered by the events rather than copied.
+	s.stdoutpipe, s.stderrpipe = true, true
+	if err := s.Start(cmd); err != nil {
+		return nil, err
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		for {
+			chunk, ok := streams.next()
+			if !ok {
+				break
+			}
+			events <- StreamEvent{Stderr: chunk.stderr, Data: chunk.data}
+			ch.adjustWindow(uint32(len(chunk.data)))
+		}
+		events <- StreamEvent{Exit: true, Err: s.Wait()}
+		close(events)
+	}()
+	return events, nil
+}
+
+// streamChunk is a chunk of data or extended data received on a channel.
+type streamChunk struct {
+	stderr bool
+	data   []byte
+}
+
+// streamBuffer holds the data and extended data of a channel in the order
+// they were received.
+type streamBuffer struct {
+	cond   *sync.Cond
+	chunks []streamChunk
+	closed bool
+}
+
+func newStreamBuffer() *streamBuffer {
+	return &streamBuffer{cond: newCond()}
+}
+
+// write makes data available to next. data must not be modified after the
+// call to write.
+func (b *streamBuffer) write(stderr bool, data []byte) {
+	b.cond.L.Lock()
+	b.chunks = append(b.chunks, streamChunk{stderr, data})
+	b.cond.Signal()
+	b.cond.L.Unlock()
+}
+
+// eof closes the buffer. Once all the chunks have been consumed, next
+// reports that there are no more.
+func (b *streamBuffer) eof() {
+	b.cond.L.Lock()
+	b.closed = true
+	b.cond.Signal()
+	b.cond.L.Unlock()
+}
+
+// next blocks until a chunk is available, and returns it. It returns false
+// if the buffer is closed and empty.
+func (b *streamBuffer) next() (streamChunk, bool) {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+	for len(b.chunks) == 0 {
+		if b.closed {
+			return streamChunk{}, false
+		}
+		b.cond.Wait()
+	}
+	chunk := b.chunks[0]
+	b.chunks[0] = streamChunk{}
+	b.chunks = b.chunks[1:]
+	return chunk, true
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"io"
+	"testing"
+)
+
+func TestSessionStartStream(t *testing.T) {
+	conn := dial(func(ch Channel, in <-chan *Request, t *testing.T) {
+		defer ch.Close()
+		req, ok := <-in
+		if !ok {
+			// The second session is closed without a request.
+			return
+		}
+		req.Reply(true, nil)
+		go DiscardRequests(in)
+
+		// Like "sudo -S", prompt on stderr and read the password from stdin.
+		io.WriteString(ch.Stderr(), "[sudo] password: ")
+		password, err := bufio.NewReader(ch).ReadString('\n')
+		if err != nil {
+			t.Errorf("reading password: %v", err)
+			return
+		}
+		if password != "hunter2\n" {
+			io.WriteString(ch.Stderr(), "wrong password\n")
+			sendStatus(1, ch, t)
+			return
+		}
+		for i, s := range []string{"out1", "err1", "err2", "out2"} {
+			w := io.Writer(ch)
+			if s[:3] == "err" {
+				w = ch.Stderr()
+			}
+			if _, err := io.WriteString(w, s); err != nil {
+				t.Errorf("write %d: %v", i, err)
+			}
+		}
+		sendStatus(3, ch, t)
+	}, t)
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := session.StartStream("sudo -S true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var exit *StreamEvent
+	for ev := range events {
+		ev := ev
+		switch {
+		case ev.Exit:
+			exit = &ev
+		case ev.Stderr && string(ev.Data) == "[sudo] password: ":
+			io.WriteString(stdin, "hunter2\n")
+		case ev.Stderr:
+			got = append(got, "stderr:"+string(ev.Data))
+		default:
+			got = append(got, "stdout:"+string(ev.Data))
+		}
+	}
+	want := []string{"stdout:out1", "stderr:err1", "stderr:err2", "stdout:out2"}
+	if len(got) != len(want) {
+		t.Fatalf("got events %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got events %q, want %q", got, want)
+		}
+	}
+	if exit == nil {
+		t.Fatal("no exit event")
+	}
+	if e, ok := exit.Err.(*ExitError); !ok || e.ExitStatus() != 3 {
+		t.Errorf("got exit error %v, want exit status 3", exit.Err)
+	}
+
+	session, err = conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if _, err := session.StdoutPipe(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.StartStream("true"); err == nil {
+		t.Error("StartStream succeeded after StdoutPipe")
+	}
+}
@@ -23,6 +23,11 @@ type serverType func(Channel, <-chan *Request, *testing.T)
 
 // dial constructs a new test server and returns a *ClientConn.
 func dial(handler serverType, t *testing.T) *Client {
+	return dialConfig(handler, &ServerConfig{NoClientAuth: true}, t)
+}
+
+// dialConfig is like dial, with a server configured like conf.
+func dialConfig(handler serverType, conf *ServerConfig, t *testing.T) *Client {
 	c1, c2, err := netPipe()
 	if err != nil {
 		t.Fatalf("netPipe: %v", err)
@@ -36,12 +41,9 @@ func dial(handler serverType, t *testing.T) *Client {
 			c1.Close()
 			wg.Done()
 		}()
-		conf := ServerConfig{
-			NoClientAuth: true,
-		}
 		conf.AddHostKey(testSigners["rsa"])
 
-		conn, chans, reqs, err := NewServerConn(c1, &conf)
+		conn, chans, reqs, err := NewServerConn(c1, conf)
 		if err != nil {
 			t.Errorf("Unable to handshake: %v", err)
 			return
@@ -0,0 +1,257 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// Attribute flags, see [SFTP] section 5.
+const (
+	AttrSize        = 0x00000001
+	AttrUIDGID      = 0x00000002
+	AttrPermissions = 0x00000004
+	AttrACModTime   = 0x00000008
+	AttrExtended    = 0x80000000
+)
+
+// Unix file type and permission bits as used on the wire.
+const (
+	modeTypeMask = 0170000
+	modeFIFO     = 0010000
+	modeChar     = 0020000
+	modeDir      = 0040000
+	modeBlock    = 0060000
+	modeRegular  = 0100000
+	modeSymlink  = 0120000
+	modeSocket   = 0140000
+	modeSetuid   = 04000
+	modeSetgid   = 02000
+	modeSticky   = 01000
+)
+
+// ExtendedAttribute is a vendor specific file attribute.
+type ExtendedAttribute struct {
+	Type string
+	Data string
+}
+
+// FileAttributes holds the attributes of a file as defined in [SFTP]
+// section 5. Only the fields whose bit is set in Flags are meaningful.
+type FileAttributes struct {
+	Flags       uint32
+	Size        uint64
+	UID         uint32
+	GID         uint32
+	Permissions uint32
+	ATime       uint32
+	MTime       uint32
+	Extended    []ExtendedAttribute
+}
+
+var errShortAttrs = errors.New("sftp: short file attributes")
+
+func appendUint32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func marshalAttrs(a *FileAttributes) []byte {
+	if a == nil {
+		return make([]byte, 4)
+	}
+	flags := a.Flags &^ AttrExtended
+	if len(a.Extended) > 0 {
+		flags |= AttrExtended
+	}
+	b := appendUint32(nil, flags)
+	if flags&AttrSize != 0 {
+		b = binary.BigEndian.AppendUint64(b, a.Size)
+	}
+	if flags&AttrUIDGID != 0 {
+		b = appendUint32(b, a.UID)
+		b = appendUint32(b, a.GID)
+	}
+	if flags&AttrPermissions != 0 {
+		b = appendUint32(b, a.Permissions)
+	}
+	if flags&AttrACModTime != 0 {
+		b = appendUint32(b, a.ATime)
+		b = appendUint32(b, a.MTime)
+	}
+	if flags&AttrExtended != 0 {
+		b = appendUint32(b, uint32(len(a.Extended)))
+		for _, e := range a.Extended {
+			b = appendString(b, e.Type)
+			b = appendString(b, e.Data)
+		}
+	}
+	return b
+}
+
+func parseUint32(in []byte) (uint32, []byte, bool) {
+	if len(in) < 4 {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(in), in[4:], true
+}
+
+func parseString(in []byte) (string, []byte, bool) {
+	n, in, ok := parseUint32(in)
+	if !ok || uint32(len(in)) < n {
+		return "", nil, false
+	}
+	return string(in[:n]), in[n:], true
+}
+
+// parseAttrs parses the attributes at the start of in, returning them
+// along with the remaining bytes.
+func parseAttrs(in []byte) (*FileAttributes, []byte, error) {
+	a := &FileAttributes{}
+	var ok bool
+	if a.Flags, in, ok = parseUint32(in); !ok {
+		return nil, nil, errShortAttrs
+	}
+	if a.Flags&AttrSize != 0 {
+		if len(in) < 8 {
+			return nil, nil, errShortAttrs
+		}
+		a.Size = binary.BigEndian.Uint64(in)
+		in = in[8:]
+	}
+	if a.Flags&AttrUIDGID != 0 {
+		if a.UID, in, ok = parseUint32(in); !ok {
+			return nil, nil, errShortAttrs
+		}
+		if a.GID, in, ok = parseUint32(in); !ok {
+			return nil, nil, errShortAttrs
+		}
+	}
+	if a.Flags&AttrPermissions != 0 {
+		if a.Permissions, in, ok = parseUint32(in); !ok {
+			return nil, nil, errShortAttrs
+		}
+	}
+	if a.Flags&AttrACModTime != 0 {
+		if a.ATime, in, ok = parseUint32(in); !ok {
+			return nil, nil, errShortAttrs
+		}
+		if a.MTime, in, ok = parseUint32(in); !ok {
+			return nil, nil, errShortAttrs
+		}
+	}
+	if a.Flags&AttrExtended != 0 {
+		var count uint32
+		if count, in, ok = parseUint32(in); !ok {
+			return nil, nil, errShortAttrs
+		}
+		for i := uint32(0); i < count; i++ {
+			var e ExtendedAttribute
+			if e.Type, in, ok = parseString(in); !ok {
+				return nil, nil, errShortAttrs
+			}
+			if e.Data, in, ok = parseString(in); !ok {
+				return nil, nil, errShortAttrs
+			}
+			a.Extended = append(a.Extended, e)
+		}
+	}
+	return a, in, nil
+}
+
+// FileMode returns the permissions and file type as an fs.FileMode.
+func (a *FileAttributes) FileMode() fs.FileMode {
+	m := fs.FileMode(a.Permissions & 0777)
+	switch a.Permissions & modeTypeMask {
+	case modeFIFO:
+		m |= fs.ModeNamedPipe
+	case modeChar:
+		m |= fs.ModeDevice | fs.ModeCharDevice
+	case modeDir:
+		m |= fs.ModeDir
+	case modeBlock:
+		m |= fs.ModeDevice
+	case modeSymlink:
+		m |= fs.ModeSymlink
+	case modeSocket:
+		m |= fs.ModeSocket
+	}
+	if a.Permissions&modeSetuid != 0 {
+		m |= fs.ModeSetuid
+	}
+	if a.Permissions&modeSetgid != 0 {
+		m |= fs.ModeSetgid
+	}
+	if a.Permissions&modeSticky != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+// fromFileMode converts an fs.FileMode to the unix mode bits used on the
+// wire.
+func fromFileMode(m fs.FileMode) uint32 {
+	p := uint32(m.Perm())
+	switch {
+	case m&fs.ModeDir != 0:
+		p |= modeDir
+	case m&fs.ModeSymlink != 0:
+		p |= modeSymlink
+	case m&fs.ModeNamedPipe != 0:
+		p |= modeFIFO
+	case m&fs.ModeSocket != 0:
+		p |= modeSocket
+	case m&fs.ModeCharDevice != 0:
+		p |= modeChar
+	case m&fs.ModeDevice != 0:
+		p |= modeBlock
+	default:
+		p |= modeRegular
+	}
+	if m&fs.ModeSetuid != 0 {
+		p |= modeSetuid
+	}
+	if m&fs.ModeSetgid != 0 {
+		p |= modeSetgid
+	}
+	if m&fs.ModeSticky != 0 {
+		p |= modeSticky
+	}
+	return p
+}
+
+// attrsFromFileInfo builds the attributes sent by the server for fi.
+func attrsFromFileInfo(fi fs.FileInfo) *FileAttributes {
+	mtime := uint32(fi.ModTime().Unix())
+	return &FileAttributes{
+		Flags:       AttrSize | AttrPermissions | AttrACModTime,
+		Size:        uint64(fi.Size()),
+		Permissions: fromFileMode(fi.Mode()),
+		ATime:       mtime,
+		MTime:       mtime,
+	}
+}
+
+// fileInfo implements fs.FileInfo for attributes received from the server.
+type fileInfo struct {
+	name  string
+	attrs *FileAttributes
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return int64(fi.attrs.Size) }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.attrs.FileMode() }
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(int64(fi.attrs.MTime), 0) }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+
+// Sys returns the underlying *FileAttributes.
+func (fi *fileInfo) Sys() interface{} { return fi.attrs }
@@ -0,0 +1,716 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+// Client is an SFTP client. It is safe for concurrent use; requests from
+// different goroutines are multiplexed over the same connection.
+type Client struct {
+	r       io.Reader
+	w       io.WriteCloser
+	session *ssh.Session
+
+	extensions map[string]string
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan response
+	err     error
+}
+
+type response struct {
+	typ  byte
+	data []byte
+	err  error
+}
+
+// NewClient opens a session on conn, starts the "sftp" subsystem and
+// returns a client for it. Closing the client closes the session.
+func NewClient(conn *ssh.Client) (*Client, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, err
+	}
+	c, err := NewClientPipe(r, w)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	c.session = session
+	return c, nil
+}
+
+// NewClientPipe returns a client that reads responses from r and writes
+// requests to w, for example the two halves of an ssh.Channel. It
+// performs the version negotiation before returning.
+func NewClientPipe(r io.Reader, w io.WriteCloser) (*Client, error) {
+	if err := writePacket(w, packetInit, ssh.Marshal(initMsg{Version: ProtocolVersion})); err != nil {
+		return nil, err
+	}
+	typ, data, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if typ != packetVersion {
+		return nil, fmt.Errorf("sftp: expected version packet, got type %d", typ)
+	}
+	var version versionMsg
+	if err := ssh.Unmarshal(data, &version); err != nil {
+		return nil, err
+	}
+	if version.Version != ProtocolVersion {
+		return nil, fmt.Errorf("sftp: unsupported protocol version %d", version.Version)
+	}
+	exts, err := parseExtensions(version.Extensions)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		r:          r,
+		w:          w,
+		extensions: exts,
+		pending:    make(map[uint32]chan response),
+	}
+	go c.loop()
+	return c, nil
+}
+
+// HasExtension reports whether the server announced support for the
+// named extension, and returns the data that came with the announcement.
+func (c *Client) HasExtension(name string) (string, bool) {
+	data, ok := c.extensions[name]
+	return data, ok
+}
+
+// Close closes the connection to the server. Pending requests fail once
+// the reading side of the connection is closed.
+func (c *Client) Close() error {
+	err := c.w.Close()
+	if c.session != nil {
+		if cerr := c.session.Close(); err == nil && cerr != io.EOF {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// loop reads responses and hands them to the goroutine waiting on the
+// matching request ID.
+func (c *Client) loop() {
+	var err error
+	for {
+		var typ byte
+		var data []byte
+		typ, data, err = readPacket(c.r)
+		if err != nil {
+			break
+		}
+		id, _, ok := parseUint32(data)
+		if !ok {
+			err = fmt.Errorf("sftp: short response of type %d", typ)
+			break
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if !ok {
+			err = fmt.Errorf("sftp: response for unknown request %d", id)
+			break
+		}
+		ch <- response{typ: typ, data: data}
+	}
+
+	if err == io.EOF {
+		err = errors.New("sftp: connection closed")
+	}
+	c.mu.Lock()
+	c.err = err
+	for id, ch := range c.pending {
+		ch <- response{err: err}
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+// call sends a request and waits for the response. The ID field of the
+// message is filled in by newMsg, which receives the allocated ID.
+func (c *Client) call(typ byte, newMsg func(id uint32) interface{}) (byte, []byte, error) {
+	ch := make(chan response, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return 0, nil, c.err
+	}
+	id := c.nextID
+	c.nextID++
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err := writePacket(c.w, typ, ssh.Marshal(newMsg(id)))
+	c.writeMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return 0, nil, err
+	}
+
+	resp := <-ch
+	return resp.typ, resp.data, resp.err
+}
+
+func unexpectedResponse(typ byte) error {
+	return fmt.Errorf("sftp: unexpected response of type %d", typ)
+}
+
+func statusToError(data []byte) error {
+	var status statusMsg
+	if err := ssh.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	if status.Code == StatusOK {
+		return nil
+	}
+	return &StatusError{Code: status.Code, Message: status.Message, Lang: status.Lang}
+}
+
+// callStatus sends a request that is answered with a status packet.
+func (c *Client) callStatus(typ byte, newMsg func(id uint32) interface{}) error {
+	respType, data, err := c.call(typ, newMsg)
+	if err != nil {
+		return err
+	}
+	if respType != packetStatus {
+		return unexpectedResponse(respType)
+	}
+	return statusToError(data)
+}
+
+// callHandle sends a request that is answered with a handle packet.
+func (c *Client) callHandle(typ byte, newMsg func(id uint32) interface{}) (string, error) {
+	respType, data, err := c.call(typ, newMsg)
+	if err != nil {
+		return "", err
+	}
+	switch respType {
+	case packetHandle:
+		var msg handleMsg
+		if err := ssh.Unmarshal(data, &msg); err != nil {
+			return "", err
+		}
+		return msg.Handle, nil
+	case packetStatus:
+		if err := statusToError(data); err != nil {
+			return "", err
+		}
+	}
+	return "", unexpectedResponse(respType)
+}
+
+// callAttrs sends a request that is answered with an attrs packet.
+func (c *Client) callAttrs(typ byte, newMsg func(id uint32) interface{}) (*FileAttributes, error) {
+	respType, data, err := c.call(typ, newMsg)
+	if err != nil {
+		return nil, err
+	}
+	switch respType {
+	case packetAttrs:
+		var msg attrsMsg
+		if err := ssh.Unmarshal(data, &msg); err != nil {
+			return nil, err
+		}
+		attrs, _, err := parseAttrs(msg.Attrs)
+		return attrs, err
+	case packetStatus:
+		if err := statusToError(data); err != nil {
+			return nil, err
+		}
+	}
+	return nil, unexpectedResponse(respType)
+}
+
+type name struct {
+	filename string
+	longname string
+	attrs    *FileAttributes
+}
+
+// callName sends a request that is answered with a name packet.
+func (c *Client) callName(typ byte, newMsg func(id uint32) interface{}) ([]name, error) {
+	respType, data, err := c.call(typ, newMsg)
+	if err != nil {
+		return nil, err
+	}
+	switch respType {
+	case packetName:
+		var msg nameMsg
+		if err := ssh.Unmarshal(data, &msg); err != nil {
+			return nil, err
+		}
+		rest := msg.Names
+		var names []name
+		for i := uint32(0); i < msg.Count; i++ {
+			var entry nameEntry
+			if err := ssh.Unmarshal(rest, &entry); err != nil {
+				return nil, err
+			}
+			var attrs *FileAttributes
+			if attrs, rest, err = parseAttrs(entry.Attrs); err != nil {
+				return nil, err
+			}
+			names = append(names, name{entry.Filename, entry.Longname, attrs})
+		}
+		return names, nil
+	case packetStatus:
+		if err := statusToError(data); err != nil {
+			return nil, err
+		}
+	}
+	return nil, unexpectedResponse(respType)
+}
+
+func pathRequest(p string) func(uint32) interface{} {
+	return func(id uint32) interface{} { return pathMsg{ID: id, Path: p} }
+}
+
+// Stat returns information about the named file, following symbolic
+// links.
+func (c *Client) Stat(p string) (fs.FileInfo, error) {
+	attrs, err := c.callAttrs(packetStat, pathRequest(p))
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(p), attrs: attrs}, nil
+}
+
+// Lstat returns information about the named file without following
+// symbolic links.
+func (c *Client) Lstat(p string) (fs.FileInfo, error) {
+	attrs, err := c.callAttrs(packetLstat, pathRequest(p))
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(p), attrs: attrs}, nil
+}
+
+// SetStat changes the attributes of the named file. Only the attributes
+// whose bit is set in attrs.Flags are changed.
+func (c *Client) SetStat(p string, attrs *FileAttributes) error {
+	return c.callStatus(packetSetstat, func(id uint32) interface{} {
+		return pathAttrsMsg{ID: id, Path: p, Attrs: marshalAttrs(attrs)}
+	})
+}
+
+// Chmod changes the permission bits of the named file.
+func (c *Client) Chmod(p string, mode fs.FileMode) error {
+	return c.SetStat(p, &FileAttributes{Flags: AttrPermissions, Permissions: fromFileMode(mode) &^ modeTypeMask})
+}
+
+// Chtimes changes the access and modification times of the named file.
+func (c *Client) Chtimes(p string, atime, mtime time.Time) error {
+	return c.SetStat(p, &FileAttributes{Flags: AttrACModTime, ATime: uint32(atime.Unix()), MTime: uint32(mtime.Unix())})
+}
+
+// Truncate changes the size of the named file.
+func (c *Client) Truncate(p string, size int64) error {
+	return c.SetStat(p, &FileAttributes{Flags: AttrSize, Size: uint64(size)})
+}
+
+// ReadDir returns the entries of the named directory, excluding "." and
+// "..".
+func (c *Client) ReadDir(p string) ([]fs.FileInfo, error) {
+	handle, err := c.callHandle(packetOpendir, pathRequest(p))
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeHandle(handle)
+
+	var infos []fs.FileInfo
+	for {
+		names, err := c.callName(packetReaddir, func(id uint32) interface{} {
+			return handleMsg{ID: id, Handle: handle}
+		})
+		if errors.Is(err, io.EOF) {
+			return infos, nil
+		}
+		if err != nil {
+			return infos, err
+		}
+		for _, n := range names {
+			if n.filename == "." || n.filename == ".." {
+				continue
+			}
+			infos = append(infos, &fileInfo{name: n.filename, attrs: n.attrs})
+		}
+	}
+}
+
+// Mkdir creates a directory with the given permission bits.
+func (c *Client) Mkdir(p string, perm fs.FileMode) error {
+	return c.callStatus(packetMkdir, func(id uint32) interface{} {
+		attrs := &FileAttributes{Flags: AttrPermissions, Permissions: uint32(perm.Perm())}
+		return pathAttrsMsg{ID: id, Path: p, Attrs: marshalAttrs(attrs)}
+	})
+}
+
+// Remove removes the named file.
+func (c *Client) Remove(p string) error {
+	return c.callStatus(packetRemove, pathRequest(p))
+}
+
+// RemoveDirectory removes the named empty directory.
+func (c *Client) RemoveDirectory(p string) error {
+	return c.callStatus(packetRmdir, pathRequest(p))
+}
+
+// Rename renames oldpath to newpath. Many servers refuse to overwrite an
+// existing newpath.
+func (c *Client) Rename(oldpath, newpath string) error {
+	return c.callStatus(packetRename, func(id uint32) interface{} {
+		return renameMsg{ID: id, OldPath: oldpath, NewPath: newpath}
+	})
+}
+
+// Symlink creates linkpath as a symbolic link to target.
+func (c *Client) Symlink(target, linkpath string) error {
+	return c.callStatus(packetSymlink, func(id uint32) interface{} {
+		return symlinkMsg{ID: id, TargetPath: target, LinkPath: linkpath}
+	})
+}
+
+func (c *Client) singleName(typ byte, p string) (string, error) {
+	names, err := c.callName(typ, pathRequest(p))
+	if err != nil {
+		return "", err
+	}
+	if len(names) != 1 {
+		return "", fmt.Errorf("sftp: expected 1 name, got %d", len(names))
+	}
+	return names[0].filename, nil
+}
+
+// ReadLink returns the destination of the named symbolic link.
+func (c *Client) ReadLink(p string) (string, error) {
+	return c.singleName(packetReadlink, p)
+}
+
+// RealPath asks the server to canonicalize the given path. It is commonly
+// used with "." to find the initial working directory.
+func (c *Client) RealPath(p string) (string, error) {
+	return c.singleName(packetRealpath, p)
+}
+
+// Extended sends a request for the named extension. It returns the data
+// of the extended reply, or nil if the server answered with a status of
+// StatusOK.
+func (c *Client) Extended(name string, data []byte) ([]byte, error) {
+	respType, resp, err := c.call(packetExtended, func(id uint32) interface{} {
+		return extendedMsg{ID: id, Name: name, Data: data}
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch respType {
+	case packetExtendedReply:
+		var msg extendedReplyMsg
+		if err := ssh.Unmarshal(resp, &msg); err != nil {
+			return nil, err
+		}
+		return msg.Data, nil
+	case packetStatus:
+		return nil, statusToError(resp)
+	}
+	return nil, unexpectedResponse(respType)
+}
+
+func (c *Client) closeHandle(handle string) error {
+	return c.callStatus(packetClose, func(id uint32) interface{} {
+		return handleMsg{ID: id, Handle: handle}
+	})
+}
+
+// Open opens the named file for reading.
+func (c *Client) Open(p string) (*File, error) {
+	return c.OpenFile(p, os.O_RDONLY)
+}
+
+// Create creates or truncates the named file and opens it for writing.
+func (c *Client) Create(p string) (*File, error) {
+	return c.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+// OpenFile opens the named file with the given flags, which are the
+// os.O_* flags. os.O_SYNC is ignored.
+func (c *Client) OpenFile(p string, flag int) (*File, error) {
+	var pflags uint32
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		pflags = openRead
+	case os.O_WRONLY:
+		pflags = openWrite
+	case os.O_RDWR:
+		pflags = openRead | openWrite
+	}
+	if flag&os.O_APPEND != 0 {
+		pflags |= openAppend
+	}
+	if flag&os.O_CREATE != 0 {
+		pflags |= openCreate
+	}
+	if flag&os.O_TRUNC != 0 {
+		pflags |= openTrunc
+	}
+	if flag&os.O_EXCL != 0 {
+		pflags |= openExcl
+	}
+
+	handle, err := c.callHandle(packetOpen, func(id uint32) interface{} {
+		return openMsg{ID: id, Path: p, PFlags: pflags, Attrs: marshalAttrs(nil)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &File{c: c, name: p, handle: handle}, nil
+}
+
+// ResumeUpload copies src to the remote file at p, starting at the
+// current size of the remote file. The remote file is created if it does
+// not exist. It returns the number of bytes written by this call.
+func (c *Client) ResumeUpload(p string, src io.ReadSeeker) (int64, error) {
+	var offset int64
+	fi, err := c.Stat(p)
+	switch {
+	case err == nil:
+		offset = fi.Size()
+	case !errors.Is(err, fs.ErrNotExist):
+		return 0, err
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	f, err := c.OpenFile(p, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return 0, err
+	}
+	n, err := io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// ResumeDownload appends the contents of the remote file at p to dst,
+// starting at the current size of dst. It returns the number of bytes
+// written by this call.
+func (c *Client) ResumeDownload(p string, dst io.WriteSeeker) (int64, error) {
+	offset, err := dst.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	f, err := c.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(dst, f)
+}
+
+// File is a remote file opened with Client.OpenFile. Reads and writes
+// through the io.Reader and io.Writer interfaces advance a file offset
+// kept on the client.
+type File struct {
+	c      *Client
+	name   string
+	handle string
+
+	mu     sync.Mutex
+	offset int64
+}
+
+// Name returns the path the file was opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Close closes the remote handle.
+func (f *File) Close() error {
+	return f.c.closeHandle(f.handle)
+}
+
+// Stat returns information about the file.
+func (f *File) Stat() (fs.FileInfo, error) {
+	attrs, err := f.c.callAttrs(packetFstat, func(id uint32) interface{} {
+		return handleMsg{ID: id, Handle: f.handle}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(f.name), attrs: attrs}, nil
+}
+
+// SetStat changes the attributes of the open file.
+func (f *File) SetStat(attrs *FileAttributes) error {
+	return f.c.callStatus(packetFsetstat, func(id uint32) interface{} {
+		return handleAttrsMsg{ID: id, Handle: f.handle, Attrs: marshalAttrs(attrs)}
+	})
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(size int64) error {
+	return f.SetStat(&FileAttributes{Flags: AttrSize, Size: uint64(size)})
+}
+
+// readChunk issues a single read request of at most maxDataLength bytes.
+func (f *File) readChunk(b []byte, off int64) (int, error) {
+	if len(b) > maxDataLength {
+		b = b[:maxDataLength]
+	}
+	respType, data, err := f.c.call(packetRead, func(id uint32) interface{} {
+		return readMsg{ID: id, Handle: f.handle, Offset: uint64(off), Length: uint32(len(b))}
+	})
+	if err != nil {
+		return 0, err
+	}
+	switch respType {
+	case packetData:
+		var msg dataMsg
+		if err := ssh.Unmarshal(data, &msg); err != nil {
+			return 0, err
+		}
+		if len(msg.Data) > len(b) {
+			return 0, errors.New("sftp: server sent more data than requested")
+		}
+		return copy(b, msg.Data), nil
+	case packetStatus:
+		err := statusToError(data)
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, unexpectedResponse(respType)
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	n := 0
+	for n < len(b) {
+		m, err := f.readChunk(b[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (f *File) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.readChunk(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	n := 0
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > maxDataLength {
+			chunk = chunk[:maxDataLength]
+		}
+		err := f.c.callStatus(packetWrite, func(id uint32) interface{} {
+			return writeMsg{ID: id, Handle: f.handle, Offset: uint64(off + int64(n)), Data: chunk}
+		})
+		if err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+// Write implements io.Writer.
+func (f *File) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.WriteAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker. Seeking relative to the end of the file
+// requires a round trip to the server.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return f.offset, err
+		}
+		offset += fi.Size()
+	default:
+		return f.offset, fmt.Errorf("sftp: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return f.offset, errors.New("sftp: negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp_test
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+	"github.com/gitpod-io/golang-crypto/ssh/sftp"
+)
+
+func ExampleNewClient() {
+	var conn *ssh.Client // an established connection
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		log.Fatalf("Failed to start sftp: %v", err)
+	}
+	defer client.Close()
+
+	f, err := client.Open("/etc/motd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	io.Copy(os.Stdout, f)
+}
+
+func ExampleServe() {
+	var newChannel ssh.NewChannel // a "session" channel request
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		log.Fatalf("Could not accept channel: %v", err)
+	}
+	go func() {
+		for req := range requests {
+			// The payload of a subsystem request is the
+			// subsystem name as an SSH string.
+			ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+			req.Reply(ok, nil)
+			if !ok {
+				continue
+			}
+			go func() {
+				defer channel.Close()
+				if err := sftp.Serve(channel, &sftp.ServerConfig{Root: "/srv/sftp"}); err != nil {
+					log.Printf("sftp: %v", err)
+				}
+			}()
+		}
+	}()
+}
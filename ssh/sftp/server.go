@@ -0,0 +1,626 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+// ExtensionHandler handles an SSH_FXP_EXTENDED request. The returned
+// data is sent in an extended reply; if it is nil, a status of StatusOK
+// is sent instead. Returning a *StatusError controls the status code
+// reported to the client, other errors are reported as StatusFailure.
+type ExtensionHandler func(data []byte) ([]byte, error)
+
+// ServerConfig holds configuration for Serve.
+type ServerConfig struct {
+	// Root is the local directory that clients see as "/". If empty,
+	// the process working directory is used. Root is not a chroot:
+	// symbolic links already inside it may point elsewhere. Links
+	// created by clients are stored with an absolute target below Root,
+	// so that they stay within Root when they are renamed.
+	Root string
+
+	// ReadOnly causes all requests that would modify the file system
+	// to fail with StatusPermissionDenied.
+	ReadOnly bool
+
+	// Extensions maps extension names to their handlers. The names
+	// are announced to the client during version negotiation.
+	Extensions map[string]ExtensionHandler
+}
+
+type server struct {
+	config     *ServerConfig
+	root       string
+	c          io.ReadWriter
+	handles    map[string]*handle
+	nextHandle uint64
+}
+
+type handle struct {
+	*os.File
+
+	// append is set for files opened in append mode. Writes to them
+	// ignore the offset sent by the client.
+	append bool
+}
+
+// Serve serves the SFTP protocol on the given connection using the local
+// file system. It returns nil when the client closes the connection and
+// an error if the connection fails or the client violates the protocol.
+func Serve(c io.ReadWriter, config *ServerConfig) error {
+	if config == nil {
+		config = &ServerConfig{}
+	}
+	root := config.Root
+	if root == "" {
+		root = "."
+	}
+	s := &server{
+		config:  config,
+		root:    root,
+		c:       c,
+		handles: make(map[string]*handle),
+	}
+	defer s.closeAll()
+
+	typ, data, err := readPacket(c)
+	if err != nil {
+		return err
+	}
+	if typ != packetInit {
+		return fmt.Errorf("sftp: expected init packet, got type %d", typ)
+	}
+	var init initMsg
+	if err := ssh.Unmarshal(data, &init); err != nil {
+		return err
+	}
+	if init.Version < ProtocolVersion {
+		return fmt.Errorf("sftp: unsupported protocol version %d", init.Version)
+	}
+	if err := writePacket(c, packetVersion, ssh.Marshal(versionMsg{
+		Version:    ProtocolVersion,
+		Extensions: s.marshalExtensions(),
+	})); err != nil {
+		return err
+	}
+
+	for {
+		typ, data, err := readPacket(c)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.processRequest(typ, data); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) marshalExtensions() []byte {
+	names := make([]string, 0, len(s.config.Extensions))
+	for name := range s.config.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b []byte
+	for _, name := range names {
+		b = append(b, ssh.Marshal(extensionPair{Name: name, Data: "1"})...)
+	}
+	return b
+}
+
+func (s *server) closeAll() {
+	for h, f := range s.handles {
+		f.Close()
+		delete(s.handles, h)
+	}
+}
+
+// localPath maps a client path to a path on the local file system.
+// Relative paths are resolved against the root.
+func (s *server) localPath(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// realRoot returns the absolute path of the root, with symbolic links
+// resolved.
+func (s *server) realRoot() (string, error) {
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(root)
+}
+
+// symlinkTarget returns the target to store for a link created at
+// linkPath. The client's target is resolved as a client path, relative
+// to the directory of the link, and stored as an absolute path below the
+// real root. Unlike a relative target, it cannot climb above the root
+// when the link, or a directory containing it, is moved elsewhere.
+func (s *server) symlinkTarget(linkPath, target string) (string, error) {
+	if !path.IsAbs(target) {
+		target = path.Join(path.Dir(path.Clean("/"+linkPath)), target)
+	}
+	root, err := s.realRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(path.Clean("/"+target))), nil
+}
+
+// clientTarget returns the target of a link as reported to the client.
+// Targets below the real root, such as those stored by symlinkTarget,
+// are turned back into client paths.
+func (s *server) clientTarget(target string) string {
+	if !filepath.IsAbs(target) {
+		return target
+	}
+	root, err := s.realRoot()
+	if err != nil {
+		return target
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil || !filepath.IsLocal(rel) {
+		return target
+	}
+	return path.Join("/", filepath.ToSlash(rel))
+}
+
+func (s *server) newHandle(f *handle) string {
+	h := strconv.FormatUint(s.nextHandle, 10)
+	s.nextHandle++
+	s.handles[h] = f
+	return h
+}
+
+var errReadOnly = &StatusError{Code: StatusPermissionDenied, Message: "read-only server"}
+var errBadHandle = &StatusError{Code: StatusFailure, Message: "invalid handle"}
+
+func (s *server) send(typ byte, msg interface{}) error {
+	return writePacket(s.c, typ, ssh.Marshal(msg))
+}
+
+func (s *server) sendStatus(id uint32, err error) error {
+	msg := statusMsg{ID: id, Code: StatusOK, Message: "ok"}
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+	case errors.As(err, &statusErr):
+		msg.Code, msg.Message, msg.Lang = statusErr.Code, statusErr.Message, statusErr.Lang
+	case err == io.EOF:
+		msg.Code, msg.Message = StatusEOF, "end of file"
+	case errors.Is(err, fs.ErrNotExist):
+		msg.Code, msg.Message = StatusNoSuchFile, "no such file"
+	case errors.Is(err, fs.ErrPermission):
+		msg.Code, msg.Message = StatusPermissionDenied, "permission denied"
+	default:
+		msg.Code, msg.Message = StatusFailure, s.clientError(err)
+	}
+	return s.send(packetStatus, msg)
+}
+
+// clientError strips the local root from error messages so that clients
+// do not learn where the exported tree lives.
+func (s *server) clientError(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Op + ": " + pathErr.Err.Error()
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Op + ": " + linkErr.Err.Error()
+	}
+	return err.Error()
+}
+
+func (s *server) sendAttrs(id uint32, fi fs.FileInfo, err error) error {
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+	return s.send(packetAttrs, attrsMsg{ID: id, Attrs: marshalAttrs(attrsFromFileInfo(fi))})
+}
+
+func (s *server) sendNames(id uint32, names []name) error {
+	var b []byte
+	for _, n := range names {
+		b = append(b, ssh.Marshal(nameEntry{
+			Filename: n.filename,
+			Longname: n.longname,
+			Attrs:    marshalAttrs(n.attrs),
+		})...)
+	}
+	return s.send(packetName, nameMsg{ID: id, Count: uint32(len(names)), Names: b})
+}
+
+func longname(fi fs.FileInfo) string {
+	return fmt.Sprintf("%s %4d %-8d %-8d %8d %s %s",
+		fi.Mode(), 1, 0, 0, fi.Size(), fi.ModTime().Format("Jan _2 15:04"), fi.Name())
+}
+
+// processRequest processes a single request. It only returns an error if the
+// request cannot be parsed or the reply cannot be sent.
+func (s *server) processRequest(typ byte, data []byte) error {
+	switch typ {
+	case packetOpen:
+		var req openMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		return s.open(&req)
+
+	case packetClose:
+		var req handleMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		f, ok := s.handles[req.Handle]
+		if !ok {
+			return s.sendStatus(req.ID, errBadHandle)
+		}
+		delete(s.handles, req.Handle)
+		return s.sendStatus(req.ID, f.Close())
+
+	case packetRead:
+		var req readMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		f, ok := s.handles[req.Handle]
+		if !ok {
+			return s.sendStatus(req.ID, errBadHandle)
+		}
+		length := req.Length
+		if length > maxDataLength {
+			length = maxDataLength
+		}
+		buf := make([]byte, length)
+		n, err := f.ReadAt(buf, int64(req.Offset))
+		if n == 0 && err != nil {
+			return s.sendStatus(req.ID, err)
+		}
+		return s.send(packetData, dataMsg{ID: req.ID, Data: buf[:n]})
+
+	case packetWrite:
+		var req writeMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		f, ok := s.handles[req.Handle]
+		if !ok {
+			return s.sendStatus(req.ID, errBadHandle)
+		}
+		if s.config.ReadOnly {
+			return s.sendStatus(req.ID, errReadOnly)
+		}
+		var err error
+		if f.append {
+			_, err = f.Seek(0, io.SeekEnd)
+			if err == nil {
+				_, err = f.Write(req.Data)
+			}
+		} else {
+			_, err = f.WriteAt(req.Data, int64(req.Offset))
+		}
+		return s.sendStatus(req.ID, err)
+
+	case packetLstat, packetStat:
+		var req pathMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		stat := os.Stat
+		if typ == packetLstat {
+			stat = os.Lstat
+		}
+		fi, err := stat(s.localPath(req.Path))
+		return s.sendAttrs(req.ID, fi, err)
+
+	case packetFstat:
+		var req handleMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		f, ok := s.handles[req.Handle]
+		if !ok {
+			return s.sendStatus(req.ID, errBadHandle)
+		}
+		fi, err := f.Stat()
+		return s.sendAttrs(req.ID, fi, err)
+
+	case packetSetstat:
+		var req pathAttrsMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		attrs, _, err := parseAttrs(req.Attrs)
+		if err != nil {
+			return err
+		}
+		if s.config.ReadOnly {
+			return s.sendStatus(req.ID, errReadOnly)
+		}
+		return s.sendStatus(req.ID, setStat(s.localPath(req.Path), nil, attrs))
+
+	case packetFsetstat:
+		var req handleAttrsMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		attrs, _, err := parseAttrs(req.Attrs)
+		if err != nil {
+			return err
+		}
+		f, ok := s.handles[req.Handle]
+		if !ok {
+			return s.sendStatus(req.ID, errBadHandle)
+		}
+		if s.config.ReadOnly {
+			return s.sendStatus(req.ID, errReadOnly)
+		}
+		return s.sendStatus(req.ID, setStat(f.Name(), f.File, attrs))
+
+	case packetOpendir:
+		var req pathMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		p := s.localPath(req.Path)
+		fi, err := os.Stat(p)
+		if err == nil && !fi.IsDir() {
+			err = &StatusError{Code: StatusFailure, Message: "not a directory"}
+		}
+		if err != nil {
+			return s.sendStatus(req.ID, err)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return s.sendStatus(req.ID, err)
+		}
+		return s.send(packetHandle, handleMsg{ID: req.ID, Handle: s.newHandle(&handle{File: f})})
+
+	case packetReaddir:
+		var req handleMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		f, ok := s.handles[req.Handle]
+		if !ok {
+			return s.sendStatus(req.ID, errBadHandle)
+		}
+		entries, err := f.ReadDir(100)
+		if len(entries) == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return s.sendStatus(req.ID, err)
+		}
+		names := make([]name, 0, len(entries))
+		for _, e := range entries {
+			fi, err := e.Info()
+			if err != nil {
+				// The entry was removed after it was listed.
+				continue
+			}
+			names = append(names, name{fi.Name(), longname(fi), attrsFromFileInfo(fi)})
+		}
+		return s.sendNames(req.ID, names)
+
+	case packetRemove, packetRmdir:
+		var req pathMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		if s.config.ReadOnly {
+			return s.sendStatus(req.ID, errReadOnly)
+		}
+		p := s.localPath(req.Path)
+		fi, err := os.Lstat(p)
+		if err == nil {
+			switch {
+			case typ == packetRemove && fi.IsDir():
+				err = &StatusError{Code: StatusFailure, Message: "is a directory"}
+			case typ == packetRmdir && !fi.IsDir():
+				err = &StatusError{Code: StatusFailure, Message: "not a directory"}
+			default:
+				err = os.Remove(p)
+			}
+		}
+		return s.sendStatus(req.ID, err)
+
+	case packetMkdir:
+		var req pathAttrsMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		attrs, _, err := parseAttrs(req.Attrs)
+		if err != nil {
+			return err
+		}
+		if s.config.ReadOnly {
+			return s.sendStatus(req.ID, errReadOnly)
+		}
+		perm := fs.FileMode(0755)
+		if attrs.Flags&AttrPermissions != 0 {
+			perm = fs.FileMode(attrs.Permissions).Perm()
+		}
+		return s.sendStatus(req.ID, os.Mkdir(s.localPath(req.Path), perm))
+
+	case packetRealpath:
+		var req pathMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		p := path.Clean("/" + req.Path)
+		return s.sendNames(req.ID, []name{{filename: p, longname: p, attrs: &FileAttributes{}}})
+
+	case packetRename:
+		var req renameMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		if s.config.ReadOnly {
+			return s.sendStatus(req.ID, errReadOnly)
+		}
+		newPath := s.localPath(req.NewPath)
+		if _, err := os.Lstat(newPath); err == nil {
+			// [SFTP] forbids overwriting the target.
+			return s.sendStatus(req.ID, &StatusError{Code: StatusFailure, Message: "target exists"})
+		}
+		return s.sendStatus(req.ID, os.Rename(s.localPath(req.OldPath), newPath))
+
+	case packetReadlink:
+		var req pathMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		target, err := os.Readlink(s.localPath(req.Path))
+		if err != nil {
+			return s.sendStatus(req.ID, err)
+		}
+		target = s.clientTarget(target)
+		return s.sendNames(req.ID, []name{{filename: target, longname: target, attrs: &FileAttributes{}}})
+
+	case packetSymlink:
+		var req symlinkMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		if s.config.ReadOnly {
+			return s.sendStatus(req.ID, errReadOnly)
+		}
+		target, err := s.symlinkTarget(req.LinkPath, req.TargetPath)
+		if err != nil {
+			return s.sendStatus(req.ID, err)
+		}
+		return s.sendStatus(req.ID, os.Symlink(target, s.localPath(req.LinkPath)))
+
+	case packetExtended:
+		var req extendedMsg
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		handler, ok := s.config.Extensions[req.Name]
+		if !ok {
+			return s.sendStatus(req.ID, &StatusError{Code: StatusOpUnsupported, Message: "unsupported extension " + req.Name})
+		}
+		reply, err := handler(req.Data)
+		if err != nil || reply == nil {
+			return s.sendStatus(req.ID, err)
+		}
+		return s.send(packetExtendedReply, extendedReplyMsg{ID: req.ID, Data: reply})
+	}
+
+	// Unknown requests still carry an ID, so we can reject them
+	// without dropping the connection.
+	id, _, ok := parseUint32(data)
+	if !ok {
+		return fmt.Errorf("sftp: short packet of type %d", typ)
+	}
+	return s.sendStatus(id, &StatusError{Code: StatusOpUnsupported, Message: fmt.Sprintf("unsupported request type %d", typ)})
+}
+
+func (s *server) open(req *openMsg) error {
+	attrs, _, err := parseAttrs(req.Attrs)
+	if err != nil {
+		return err
+	}
+	var flag int
+	switch req.PFlags & (openRead | openWrite) {
+	case openRead | openWrite:
+		flag = os.O_RDWR
+	case openWrite:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDONLY
+	}
+	if req.PFlags&openCreate != 0 {
+		flag |= os.O_CREATE
+	}
+	if req.PFlags&openTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+	if req.PFlags&openExcl != 0 {
+		flag |= os.O_EXCL
+	}
+	if s.config.ReadOnly && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		return s.sendStatus(req.ID, errReadOnly)
+	}
+
+	perm := fs.FileMode(0666)
+	if attrs.Flags&AttrPermissions != 0 {
+		perm = fs.FileMode(attrs.Permissions).Perm()
+	}
+	p := s.localPath(req.Path)
+	if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+		return s.sendStatus(req.ID, &StatusError{Code: StatusFailure, Message: "is a directory"})
+	}
+	f, err := os.OpenFile(p, flag, perm)
+	if err != nil {
+		return s.sendStatus(req.ID, err)
+	}
+	h := &handle{File: f, append: req.PFlags&openAppend != 0}
+	return s.send(packetHandle, handleMsg{ID: req.ID, Handle: s.newHandle(h)})
+}
+
+// setStat applies attrs to the file at p, or to f if it is not nil.
+func setStat(p string, f *os.File, attrs *FileAttributes) error {
+	if attrs.Flags&AttrSize != 0 {
+		var err error
+		if f != nil {
+			err = f.Truncate(int64(attrs.Size))
+		} else {
+			err = os.Truncate(p, int64(attrs.Size))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if attrs.Flags&AttrPermissions != 0 {
+		mode := attrs.FileMode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		var err error
+		if f != nil {
+			err = f.Chmod(mode)
+		} else {
+			err = os.Chmod(p, mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if attrs.Flags&AttrUIDGID != 0 {
+		var err error
+		if f != nil {
+			err = f.Chown(int(attrs.UID), int(attrs.GID))
+		} else {
+			err = os.Chown(p, int(attrs.UID), int(attrs.GID))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if attrs.Flags&AttrACModTime != 0 {
+		atime := time.Unix(int64(attrs.ATime), 0)
+		mtime := time.Unix(int64(attrs.MTime), 0)
+		if err := os.Chtimes(p, atime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
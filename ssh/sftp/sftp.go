@@ -0,0 +1,302 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sftp implements version 3 of the SSH File Transfer Protocol, and
+// provides both a client and a server. Both sides run over any
+// io.ReadWriter, such as an ssh.Channel or the pipes of an ssh.Session
+// that requested the "sftp" subsystem.
+//
+// References:
+//
+//	[SFTP]: https://datatracker.ietf.org/doc/html/draft-ietf-secsh-filexfer-02
+//	[PROTOCOL]: https://cvsweb.openbsd.org/cgi-bin/cvsweb/src/usr.bin/ssh/PROTOCOL?rev=HEAD
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/gitpod-io/golang-crypto/ssh"
+)
+
+// ProtocolVersion is the version of the protocol implemented by this
+// package.
+const ProtocolVersion = 3
+
+// Packet types, see [SFTP] section 3.
+const (
+	packetInit          = 1
+	packetVersion       = 2
+	packetOpen          = 3
+	packetClose         = 4
+	packetRead          = 5
+	packetWrite         = 6
+	packetLstat         = 7
+	packetFstat         = 8
+	packetSetstat       = 9
+	packetFsetstat      = 10
+	packetOpendir       = 11
+	packetReaddir       = 12
+	packetRemove        = 13
+	packetMkdir         = 14
+	packetRmdir         = 15
+	packetRealpath      = 16
+	packetStat          = 17
+	packetRename        = 18
+	packetReadlink      = 19
+	packetSymlink       = 20
+	packetStatus        = 101
+	packetHandle        = 102
+	packetData          = 103
+	packetName          = 104
+	packetAttrs         = 105
+	packetExtended      = 200
+	packetExtendedReply = 201
+)
+
+// Flags for the open request, see [SFTP] section 6.3.
+const (
+	openRead   = 0x00000001
+	openWrite  = 0x00000002
+	openAppend = 0x00000004
+	openCreate = 0x00000008
+	openTrunc  = 0x00000010
+	openExcl   = 0x00000020
+)
+
+const (
+	// maxPacketLength caps the size of packets we are willing to
+	// receive. It matches the limit used by OpenSSH.
+	maxPacketLength = 256 * 1024
+
+	// maxDataLength is the largest payload we send in a single read or
+	// write request. Servers are required to handle at least this much.
+	maxDataLength = 32 * 1024
+)
+
+// Status codes, see [SFTP] section 7.
+const (
+	StatusOK               = 0
+	StatusEOF              = 1
+	StatusNoSuchFile       = 2
+	StatusPermissionDenied = 3
+	StatusFailure          = 4
+	StatusBadMessage       = 5
+	StatusNoConnection     = 6
+	StatusConnectionLost   = 7
+	StatusOpUnsupported    = 8
+)
+
+var statusNames = map[uint32]string{
+	StatusOK:               "ok",
+	StatusEOF:              "end of file",
+	StatusNoSuchFile:       "no such file",
+	StatusPermissionDenied: "permission denied",
+	StatusFailure:          "failure",
+	StatusBadMessage:       "bad message",
+	StatusNoConnection:     "no connection",
+	StatusConnectionLost:   "connection lost",
+	StatusOpUnsupported:    "operation unsupported",
+}
+
+// StatusError is returned by the client when the server answers a request
+// with a status other than StatusOK, and may be returned by extension
+// handlers on the server to control the status code sent to the client.
+type StatusError struct {
+	Code    uint32
+	Message string
+	Lang    string
+}
+
+func (e *StatusError) Error() string {
+	name, ok := statusNames[e.Code]
+	if !ok {
+		name = fmt.Sprintf("status %d", e.Code)
+	}
+	if e.Message == "" {
+		return "sftp: " + name
+	}
+	return fmt.Sprintf("sftp: %s: %s", name, e.Message)
+}
+
+// Is reports whether the status corresponds to fs.ErrNotExist,
+// fs.ErrPermission or io.EOF, so that errors.Is can be used on errors
+// returned by the client.
+func (e *StatusError) Is(target error) bool {
+	switch e.Code {
+	case StatusEOF:
+		return target == io.EOF
+	case StatusNoSuchFile:
+		return target == fs.ErrNotExist
+	case StatusPermissionDenied:
+		return target == fs.ErrPermission
+	}
+	return false
+}
+
+// The following messages are the bodies of packets, following the type
+// byte. All requests except init start with the request ID.
+
+type initMsg struct {
+	Version    uint32
+	Extensions []byte `ssh:"rest"`
+}
+
+type versionMsg struct {
+	Version    uint32
+	Extensions []byte `ssh:"rest"`
+}
+
+type extensionPair struct {
+	Name string
+	Data string
+	Rest []byte `ssh:"rest"`
+}
+
+type openMsg struct {
+	ID     uint32
+	Path   string
+	PFlags uint32
+	Attrs  []byte `ssh:"rest"`
+}
+
+type handleMsg struct {
+	ID     uint32
+	Handle string
+}
+
+type readMsg struct {
+	ID     uint32
+	Handle string
+	Offset uint64
+	Length uint32
+}
+
+type writeMsg struct {
+	ID     uint32
+	Handle string
+	Offset uint64
+	Data   []byte
+}
+
+type pathMsg struct {
+	ID   uint32
+	Path string
+}
+
+type pathAttrsMsg struct {
+	ID    uint32
+	Path  string
+	Attrs []byte `ssh:"rest"`
+}
+
+type handleAttrsMsg struct {
+	ID     uint32
+	Handle string
+	Attrs  []byte `ssh:"rest"`
+}
+
+type renameMsg struct {
+	ID      uint32
+	OldPath string
+	NewPath string
+}
+
+// symlinkMsg has its arguments in the order used by OpenSSH, which is
+// the reverse of what [SFTP] specifies. See [PROTOCOL] section 4.1.
+type symlinkMsg struct {
+	ID         uint32
+	TargetPath string
+	LinkPath   string
+}
+
+type statusMsg struct {
+	ID      uint32
+	Code    uint32
+	Message string
+	Lang    string
+	Rest    []byte `ssh:"rest"`
+}
+
+type dataMsg struct {
+	ID   uint32
+	Data []byte
+	Rest []byte `ssh:"rest"`
+}
+
+type nameMsg struct {
+	ID    uint32
+	Count uint32
+	Names []byte `ssh:"rest"`
+}
+
+type nameEntry struct {
+	Filename string
+	Longname string
+	Attrs    []byte `ssh:"rest"`
+}
+
+type attrsMsg struct {
+	ID    uint32
+	Attrs []byte `ssh:"rest"`
+}
+
+type extendedMsg struct {
+	ID   uint32
+	Name string
+	Data []byte `ssh:"rest"`
+}
+
+type extendedReplyMsg struct {
+	ID   uint32
+	Data []byte `ssh:"rest"`
+}
+
+// readPacket reads a single length-prefixed packet, returning its type
+// and body.
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return 0, nil, err
+	}
+	l := binary.BigEndian.Uint32(length[:])
+	if l == 0 {
+		return 0, nil, errors.New("sftp: packet size is 0")
+	}
+	if l > maxPacketLength {
+		return 0, nil, fmt.Errorf("sftp: packet too large: %d", l)
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, err
+	}
+	return buf[0], buf[1:], nil
+}
+
+// writePacket writes a packet consisting of the given type and the
+// already marshaled body.
+func writePacket(w io.Writer, typ byte, body []byte) error {
+	buf := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(buf, uint32(1+len(body)))
+	buf[4] = typ
+	buf = append(buf, body...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func parseExtensions(data []byte) (map[string]string, error) {
+	exts := make(map[string]string)
+	for len(data) > 0 {
+		var pair extensionPair
+		if err := ssh.Unmarshal(data, &pair); err != nil {
+			return nil, err
+		}
+		exts[pair.Name] = pair.Data
+		data = pair.Rest
+	}
+	return exts, nil
+}
@@ -0,0 +1,355 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sftp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func startServer(t *testing.T, config *ServerConfig) *Client {
+	c1, c2 := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Serve(c2, config)
+		c2.Close()
+	}()
+	client, err := NewClientPipe(c1, c1)
+	if err != nil {
+		t.Fatalf("NewClientPipe: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		if err := <-errc; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return client
+}
+
+func TestReadWrite(t *testing.T) {
+	root := t.TempDir()
+	c := startServer(t, &ServerConfig{Root: root})
+
+	// Larger than a single read or write request.
+	want := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	f, err := c.Create("/file")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := f.Write(want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	local, err := os.ReadFile(filepath.Join(root, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(local, want) {
+		t.Fatalf("server wrote %d bytes, want %d", len(local), len(want))
+	}
+
+	f, err = c.Open("file")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("read %d bytes, want %d", len(got), len(want))
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Size() != int64(len(want)) || !fi.Mode().IsRegular() {
+		t.Errorf("Stat: got size %d mode %v", fi.Size(), fi.Mode())
+	}
+
+	buf := make([]byte, 4)
+	if _, err := f.ReadAt(buf, 18); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if string(buf) != "2345" {
+		t.Errorf("ReadAt: got %q, want %q", buf, "2345")
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	root := t.TempDir()
+	c := startServer(t, &ServerConfig{Root: root})
+
+	if err := c.Mkdir("/dir", 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		f, err := c.Create("/dir/" + name)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		f.Close()
+	}
+	if err := c.Rename("/dir/b", "/dir/c"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := c.Rename("/dir/a", "/dir/c"); err == nil {
+		t.Error("Rename over an existing file succeeded")
+	}
+
+	infos, err := c.ReadDir("/dir")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "a" || names[1] != "c" {
+		t.Errorf("ReadDir: got %v, want [a c]", names)
+	}
+
+	fi, err := c.Stat("/dir")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if !fi.IsDir() {
+		t.Errorf("Stat: %v is not a directory", fi.Mode())
+	}
+
+	if err := c.RemoveDirectory("/dir"); err == nil {
+		t.Error("RemoveDirectory of a non-empty directory succeeded")
+	}
+	for _, name := range []string{"a", "c"} {
+		if err := c.Remove("/dir/" + name); err != nil {
+			t.Fatalf("Remove: %v", err)
+		}
+	}
+	if err := c.RemoveDirectory("/dir"); err != nil {
+		t.Fatalf("RemoveDirectory: %v", err)
+	}
+	if _, err := c.Stat("/dir"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat after removal: got %v, want fs.ErrNotExist", err)
+	}
+
+	if p, err := c.RealPath("a/../b/."); err != nil || p != "/b" {
+		t.Errorf("RealPath: got %q, %v, want %q", p, err, "/b")
+	}
+}
+
+func TestEscapeRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := startServer(t, &ServerConfig{Root: root})
+	if _, err := c.Open("../secret"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open outside of root: got %v, want fs.ErrNotExist", err)
+	}
+
+	// Links created by the client must not lead out of the root, even
+	// when chained through other links.
+	if err := c.Mkdir("/d", 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	links := []struct{ target, link string }{
+		{filepath.Join(parent, "secret"), "/abs"},
+		{"../secret", "/rel"},
+		{"/", "/d/up"},
+		{"../../secret", "/d/up/chained"},
+	}
+	for _, l := range links {
+		if err := c.Symlink(l.target, l.link); err != nil {
+			t.Fatalf("Symlink(%q, %q): %v", l.target, l.link, err)
+		}
+	}
+	for _, name := range []string{"abs", "rel", "chained"} {
+		if _, err := os.ReadFile(filepath.Join(root, name)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("reading link %q: got %v, want fs.ErrNotExist", name, err)
+		}
+		if _, err := c.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q): got %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("inside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "rel")); err != nil || string(b) != "inside" {
+		t.Errorf("reading link rel: got %q, %v, want %q", b, err, "inside")
+	}
+}
+
+func TestEscapeRootRename(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := startServer(t, &ServerConfig{Root: root})
+
+	// Links must stay within the root when they are moved to a shallower
+	// directory, on their own or with their directory.
+	for _, dir := range []string{"/a", "/a/b", "/c"} {
+		if err := c.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Mkdir(%q): %v", dir, err)
+		}
+	}
+	for _, link := range []string{"/a/link", "/a/b/link", "/c/rel"} {
+		target := "/secret"
+		if link == "/c/rel" {
+			target = "../secret"
+		}
+		if err := c.Symlink(target, link); err != nil {
+			t.Fatalf("Symlink(%q, %q): %v", target, link, err)
+		}
+	}
+	renames := [][2]string{{"/a/link", "/link"}, {"/a/b", "/b"}, {"/c/rel", "/rel"}}
+	for _, r := range renames {
+		if err := c.Rename(r[0], r[1]); err != nil {
+			t.Fatalf("Rename(%q, %q): %v", r[0], r[1], err)
+		}
+	}
+	moved := []string{"/link", "/b/link", "/rel"}
+	for _, name := range moved {
+		if _, err := c.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q): got %v, want fs.ErrNotExist", name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("inside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range moved {
+		f, err := c.Open(name)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", name, err)
+		}
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil || string(b) != "inside" {
+			t.Errorf("reading link %q: got %q, %v, want %q", name, b, err, "inside")
+		}
+		// The stored target doesn't reveal where the root is.
+		if target, err := c.ReadLink(name); err != nil || target != "/secret" {
+			t.Errorf("ReadLink(%q): got %q, %v, want %q", name, target, err, "/secret")
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	root := t.TempDir()
+	c := startServer(t, &ServerConfig{Root: root})
+
+	want := bytes.Repeat([]byte("resumable "), 5000)
+	if err := os.WriteFile(filepath.Join(root, "upload"), want[:12345], 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.ResumeUpload("/upload", bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("ResumeUpload: %v", err)
+	}
+	if n != int64(len(want)-12345) {
+		t.Errorf("ResumeUpload wrote %d bytes, want %d", n, len(want)-12345)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "upload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("uploaded file differs after resuming")
+	}
+
+	local, err := os.Create(filepath.Join(t.TempDir(), "download"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	if _, err := local.Write(want[:777]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ResumeDownload("/upload", local); err != nil {
+		t.Fatalf("ResumeDownload: %v", err)
+	}
+	got, err = os.ReadFile(local.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("downloaded file differs after resuming")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := startServer(t, &ServerConfig{Root: root, ReadOnly: true})
+
+	if _, err := c.Create("/new"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Create: got %v, want fs.ErrPermission", err)
+	}
+	if err := c.Remove("/file"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Remove: got %v, want fs.ErrPermission", err)
+	}
+	f, err := c.Open("/file")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	f.Close()
+}
+
+func TestExtensions(t *testing.T) {
+	c := startServer(t, &ServerConfig{
+		Root: t.TempDir(),
+		Extensions: map[string]ExtensionHandler{
+			"echo@example.com": func(data []byte) ([]byte, error) {
+				return data, nil
+			},
+			"fail@example.com": func(data []byte) ([]byte, error) {
+				return nil, &StatusError{Code: StatusPermissionDenied, Message: "no"}
+			},
+		},
+	})
+
+	if _, ok := c.HasExtension("echo@example.com"); !ok {
+		t.Error("extension not announced")
+	}
+	reply, err := c.Extended("echo@example.com", []byte("hello"))
+	if err != nil {
+		t.Fatalf("Extended: %v", err)
+	}
+	if string(reply) != "hello" {
+		t.Errorf("Extended: got %q, want %q", reply, "hello")
+	}
+	if _, err := c.Extended("fail@example.com", nil); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Extended: got %v, want fs.ErrPermission", err)
+	}
+	var statusErr *StatusError
+	if _, err := c.Extended("missing@example.com", nil); !errors.As(err, &statusErr) || statusErr.Code != StatusOpUnsupported {
+		t.Errorf("Extended: got %v, want StatusOpUnsupported", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Flags of the signatures made by FIDO/U2F security keys, see
+// openssh/PROTOCOL.u2f.
+const (
+	// SKFlagUserPresent is set if the user touched the security key.
+	SKFlagUserPresent = 0x01
+
+	// SKFlagUserVerified is set if the security key verified the user,
+	// for example with a PIN or a fingerprint.
+	SKFlagUserVerified = 0x04
+)
+
+const (
+	// noTouchRequiredExtension allows security key signatures without
+	// user presence, see openssh/PROTOCOL.certkeys.
+	noTouchRequiredExtension = "no-touch-required"
+
+	// verifyRequiredCriticalOption requires security key signatures with
+	// user verification, see openssh/PROTOCOL.certkeys.
+	verifyRequiredCriticalOption = "verify-required"
+)
+
+// ParseSKSignature returns the authenticator flags and the signature counter
+// of a signature made by a sk-ecdsa-sha2-nistp256@openssh.com or
+// sk-ssh-ed25519@openssh.com key.
+func ParseSKSignature(sig *Signature) (flags byte, counter uint32, err error) {
+	switch sig.Format {
+	case KeyAlgoSKECDSA256, KeyAlgoSKED25519:
+	default:
+		return 0, 0, fmt.Errorf("ssh: signature type %s is not a security key signature", sig.Format)
+	}
+	var skf skFields
+	if err := Unmarshal(sig.Rest, &skf); err != nil {
+		return 0, 0, err
+	}
+	return skf.Flags, skf.Counter, nil
+}
+
+// checkSKSignature enforces the user presence and user verification flags
+// of security key signatures used for authentication. User presence is
+// required unless perms has the "no-touch-required" extension, and user
+// verification is required if perms has the "verify-required" critical
+// option.
+func checkSKSignature(sig *Signature, perms *Permissions) error {
+	if sig.Format != KeyAlgoSKECDSA256 && sig.Format != KeyAlgoSKED25519 {
+		return nil
+	}
+	flags, _, err := ParseSKSignature(sig)
+	if err != nil {
+		return err
+	}
+	var noTouch, verify bool
+	if perms != nil {
+		_, noTouch = perms.Extensions[noTouchRequiredExtension]
+		_, verify = perms.CriticalOptions[verifyRequiredCriticalOption]
+	}
+	if !noTouch && flags&SKFlagUserPresent == 0 {
+		return errors.New("ssh: security key signature without user presence")
+	}
+	if verify && flags&SKFlagUserVerified == 0 {
+		return errors.New("ssh: security key signature without user verification")
+	}
+	return nil
+}
+
+// SKAuthenticator is implemented by FIDO/U2F security keys, such as FIDO2
+// authenticators, that hold the private part of a
+// sk-ecdsa-sha2-nistp256@openssh.com or sk-ssh-ed25519@openssh.com key.
+type SKAuthenticator interface {
+	// SKSign asks the security key to sign a message for application,
+	// the FIDO relying party ID of the key, which is typically "ssh:".
+	// digest is the SHA-256 hash of the message, which is used as the
+	// FIDO client data hash. SKSign returns the signature over the
+	// authenticator data and digest, along with the flags and the
+	// signature counter of the authenticator data. The signature is
+	// ASN.1 DER encoded for ECDSA keys, and 64 bytes long for Ed25519
+	// keys.
+	SKSign(application string, digest []byte) (signature []byte, flags byte, counter uint32, err error)
+}
+
+type skSigner struct {
+	pub  PublicKey
+	auth SKAuthenticator
+}
+
+// NewSignerFromSKAuthenticator returns a Signer for the security key public
+// key pub, as returned by ParsePublicKey or ParseAuthorizedKey, whose
+// signatures are made by auth.
+func NewSignerFromSKAuthenticator(pub PublicKey, auth SKAuthenticator) (Signer, error) {
+	switch pub.(type) {
+	case *skECDSAPublicKey, *skEd25519PublicKey:
+		return &skSigner{pub, auth}, nil
+	default:
+		return nil, fmt.Errorf("ssh: unsupported security key type %s", pub.Type())
+	}
+}
+
+func (s *skSigner) PublicKey() PublicKey {
+	return s.pub
+}
+
+func (s *skSigner) Sign(rand io.Reader, data []byte) (*Signature, error) {
+	var application string
+	switch pub := s.pub.(type) {
+	case *skECDSAPublicKey:
+		application = pub.application
+	case *skEd25519PublicKey:
+		application = pub.application
+	}
+
+	digest := sha256.Sum256(data)
+	signature, flags, counter, err := s.auth.SKSign(application, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.pub.(*skECDSAPublicKey); ok {
+		var asn1Sig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(signature, &asn1Sig); err != nil {
+			return nil, err
+		}
+		signature = Marshal(&asn1Sig)
+	}
+
+	return &Signature{
+		Format: s.pub.Type(),
+		Blob:   signature,
+		Rest:   Marshal(skFields{Flags: flags, Counter: counter}),
+	}, nil
+}
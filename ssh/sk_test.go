@@ -0,0 +1,196 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+// testSKAuthenticator emulates a FIDO2 authenticator with a software key.
+type testSKAuthenticator struct {
+	key     crypto.Signer
+	flags   byte
+	counter uint32
+}
+
+func (a *testSKAuthenticator) SKSign(application string, digest []byte) ([]byte, byte, uint32, error) {
+	a.counter++
+	appDigest := sha256.Sum256([]byte(application))
+	msg := append(appDigest[:], a.flags)
+	msg = binary.BigEndian.AppendUint32(msg, a.counter)
+	msg = append(msg, digest...)
+
+	var sig []byte
+	var err error
+	switch key := a.key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, msg)
+	case *ecdsa.PrivateKey:
+		h := sha256.Sum256(msg)
+		sig, err = ecdsa.SignASN1(rand.Reader, key, h[:])
+	}
+	return sig, a.flags, a.counter, err
+}
+
+func newTestSKSigners(t *testing.T, flags byte) map[string]Signer {
+	t.Helper()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubs := map[string]PublicKey{
+		KeyAlgoSKED25519:  &skEd25519PublicKey{application: "ssh:", PublicKey: edKey.Public().(ed25519.PublicKey)},
+		KeyAlgoSKECDSA256: &skECDSAPublicKey{application: "ssh:", PublicKey: ecKey.PublicKey},
+	}
+	keys := map[string]crypto.Signer{KeyAlgoSKED25519: edKey, KeyAlgoSKECDSA256: ecKey}
+
+	signers := make(map[string]Signer)
+	for algo, pub := range pubs {
+		// Round trip the public key, as it would be read from a file.
+		pub, err := ParsePublicKey(pub.Marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[algo], err = NewSignerFromSKAuthenticator(pub, &testSKAuthenticator{key: keys[algo], flags: flags})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signers
+}
+
+func TestSKSigner(t *testing.T) {
+	for algo, signer := range newTestSKSigners(t, SKFlagUserPresent|SKFlagUserVerified) {
+		data := []byte("sign me")
+		for counter := uint32(1); counter <= 2; counter++ {
+			sig, err := signer.Sign(rand.Reader, data)
+			if err != nil {
+				t.Fatalf("%s: %v", algo, err)
+			}
+			if err := signer.PublicKey().Verify(data, sig); err != nil {
+				t.Errorf("%s: %v", algo, err)
+			}
+			flags, c, err := ParseSKSignature(sig)
+			if err != nil {
+				t.Fatalf("%s: %v", algo, err)
+			}
+			if flags != SKFlagUserPresent|SKFlagUserVerified || c != counter {
+				t.Errorf("%s: got flags %#x and counter %d, want %#x and %d", algo, flags, c, SKFlagUserPresent|SKFlagUserVerified, counter)
+			}
+
+			sig.Rest = Marshal(skFields{Flags: 0, Counter: c})
+			if err := signer.PublicKey().Verify(data, sig); err == nil {
+				t.Errorf("%s: signature with modified flags verified", algo)
+			}
+		}
+	}
+
+	if _, err := NewSignerFromSKAuthenticator(testPublicKeys["ed25519"], &testSKAuthenticator{}); err == nil {
+		t.Error("NewSignerFromSKAuthenticator accepted an Ed25519 key")
+	}
+	if _, _, err := ParseSKSignature(&Signature{Format: KeyAlgoED25519}); err == nil {
+		t.Error("ParseSKSignature accepted an Ed25519 signature")
+	}
+}
+
+func TestClientAuthSecurityKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags byte
+		perms *Permissions
+		ok    bool
+	}{
+		{"user present", SKFlagUserPresent, nil, true},
+		{"no touch", 0, nil, false},
+		{"no touch allowed", 0, &Permissions{Extensions: map[string]string{"no-touch-required": ""}}, true},
+		{"verification required", SKFlagUserPresent, &Permissions{CriticalOptions: map[string]string{"verify-required": ""}}, false},
+		{"user verified", SKFlagUserPresent | SKFlagUserVerified, &Permissions{CriticalOptions: map[string]string{"verify-required": ""}}, true},
+	}
+	for _, tt := range tests {
+		for algo, signer := range newTestSKSigners(t, tt.flags) {
+			serverConfig := &ServerConfig{
+				PublicKeyCallback: func(conn ConnMetadata, key PublicKey) (*Permissions, error) {
+					return tt.perms, nil
+				},
+			}
+			serverConfig.AddHostKey(testSigners["ecdsa"])
+			clientConfig := &ClientConfig{
+				User:            "testuser",
+				Auth:            []AuthMethod{PublicKeys(signer)},
+				HostKeyCallback: InsecureIgnoreHostKey(),
+			}
+
+			c1, c2, err := netPipe()
+			if err != nil {
+				t.Fatalf("netPipe: %v", err)
+			}
+			go newServer(c1, serverConfig)
+			_, _, _, err = NewClientConn(c2, "", clientConfig)
+			c1.Close()
+			c2.Close()
+			if (err == nil) != tt.ok {
+				t.Errorf("%s, %s: got error %v, want success %t", tt.name, algo, err, tt.ok)
+			}
+		}
+	}
+}
+
+func TestClientAuthSecurityKeyCert(t *testing.T) {
+	checker := &CertChecker{
+		IsUserAuthority: func(k PublicKey) bool {
+			return bytes.Equal(k.Marshal(), testPublicKeys["ecdsa"].Marshal())
+		},
+	}
+	for _, flags := range []byte{SKFlagUserPresent, SKFlagUserPresent | SKFlagUserVerified} {
+		signer := newTestSKSigners(t, flags)[KeyAlgoSKED25519]
+		cert := &Certificate{
+			Key:             signer.PublicKey(),
+			ValidPrincipals: []string{"testuser"},
+			ValidBefore:     CertTimeInfinity,
+			CertType:        UserCert,
+			Permissions: Permissions{
+				CriticalOptions: map[string]string{"verify-required": ""},
+			},
+		}
+		if err := cert.SignCert(rand.Reader, testSigners["ecdsa"]); err != nil {
+			t.Fatal(err)
+		}
+		certSigner, err := NewCertSigner(cert, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serverConfig := &ServerConfig{PublicKeyCallback: checker.Authenticate}
+		serverConfig.AddHostKey(testSigners["ecdsa"])
+		clientConfig := &ClientConfig{
+			User:            "testuser",
+			Auth:            []AuthMethod{PublicKeys(certSigner)},
+			HostKeyCallback: InsecureIgnoreHostKey(),
+		}
+		c1, c2, err := netPipe()
+		if err != nil {
+			t.Fatalf("netPipe: %v", err)
+		}
+		go newServer(c1, serverConfig)
+		_, _, _, err = NewClientConn(c2, "", clientConfig)
+		c1.Close()
+		c2.Close()
+		if want := flags&SKFlagUserVerified != 0; (err == nil) != want {
+			t.Errorf("flags %#x: got error %v, want success %t", flags, err, want)
+		}
+	}
+}
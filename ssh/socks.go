@@ -0,0 +1,215 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// See RFC 1928.
+const (
+	socks5Version = 5
+
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+
+	socks5Connect = 0x01
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+
+	socks5Succeeded           = 0x00
+	socks5GeneralFailure      = 0x01
+	socks5NotAllowed          = 0x02
+	socks5HostUnreachable     = 0x04
+	socks5CommandNotSupported = 0x07
+	socks5AddrNotSupported    = 0x08
+)
+
+// socks5HandshakeTimeout bounds the time a SOCKS client may take to send
+// its request.
+const socks5HandshakeTimeout = 30 * time.Second
+
+// ListenSOCKS5 listens on the local TCP address addr, and runs a SOCKS5
+// server on it that tunnels each connection over the SSH connection, like
+// the -D option of OpenSSH. It returns the listener, which must be closed
+// to stop the server. See ServeSOCKS5.
+func (c *Client) ListenSOCKS5(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go c.ServeSOCKS5(l)
+	return l, nil
+}
+
+// ServeSOCKS5 accepts connections on l and handles them as a SOCKS5 server
+// (RFC 1928). For each CONNECT request, it opens a "direct-tcpip" channel to
+// the requested address, so that host names are resolved by the server.
+// Only the CONNECT command, without authentication, is supported: the
+// listener must not be reachable by untrusted users.
+//
+// ServeSOCKS5 returns when l.Accept fails, for example after l is closed.
+// Connections that were already established continue until either side
+// closes them, or the SSH connection is closed.
+func (c *Client) ServeSOCKS5(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go c.handleSOCKS5(conn)
+	}
+}
+
+func (c *Client) handleSOCKS5(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	host, port, err := readSOCKS5Request(conn)
+	if err != nil {
+		var rep socks5Reply
+		if errors.As(err, &rep) {
+			writeSOCKS5Reply(conn, byte(rep))
+		}
+		return
+	}
+
+	// Report the SOCKS client as the originator of the channel, like
+	// OpenSSH does.
+	origHost, origPort := "127.0.0.1", 0
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		origHost, origPort = addr.IP.String(), addr.Port
+	}
+	ch, err := c.dial(origHost, origPort, host, port)
+	if err != nil {
+		rep := byte(socks5GeneralFailure)
+		var openErr *OpenChannelError
+		if errors.As(err, &openErr) {
+			switch openErr.Reason {
+			case Prohibited:
+				rep = socks5NotAllowed
+			case ConnectionFailed:
+				rep = socks5HostUnreachable
+			}
+		}
+		writeSOCKS5Reply(conn, rep)
+		return
+	}
+	defer ch.Close()
+	if err := writeSOCKS5Reply(conn, socks5Succeeded); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, ch)
+		if tc, ok := conn.(interface{ CloseWrite() error }); ok {
+			tc.CloseWrite()
+		} else {
+			conn.Close()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// socks5Reply is an error that must be reported to the SOCKS client with the
+// corresponding reply code.
+type socks5Reply byte
+
+func (r socks5Reply) Error() string {
+	return "ssh: SOCKS5 request failed with reply " + strconv.Itoa(int(r))
+}
+
+var errSOCKS5Version = errors.New("ssh: unsupported SOCKS version")
+
+// readSOCKS5Request performs the method negotiation and reads a CONNECT
+// request from r, returning the requested destination.
+func readSOCKS5Request(rw io.ReadWriter) (host string, port int, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+		return "", 0, err
+	}
+	if hdr[0] != socks5Version {
+		return "", 0, errSOCKS5Version
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(rw, methods); err != nil {
+		return "", 0, err
+	}
+	method := byte(socks5NoAcceptable)
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+	if _, err := rw.Write([]byte{socks5Version, method}); err != nil {
+		return "", 0, err
+	}
+	if method == socks5NoAcceptable {
+		return "", 0, errors.New("ssh: SOCKS client does not support unauthenticated access")
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(rw, req[:]); err != nil {
+		return "", 0, err
+	}
+	if req[0] != socks5Version {
+		return "", 0, errSOCKS5Version
+	}
+
+	switch req[3] {
+	case socks5IPv4, socks5IPv6:
+		ip := make(net.IP, net.IPv4len)
+		if req[3] == socks5IPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(rw, ip); err != nil {
+			return "", 0, err
+		}
+		host = ip.String()
+	case socks5Domain:
+		var n [1]byte
+		if _, err := io.ReadFull(rw, n[:]); err != nil {
+			return "", 0, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(rw, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	default:
+		return "", 0, socks5Reply(socks5AddrNotSupported)
+	}
+	var p [2]byte
+	if _, err := io.ReadFull(rw, p[:]); err != nil {
+		return "", 0, err
+	}
+	if req[1] != socks5Connect {
+		return "", 0, socks5Reply(socks5CommandNotSupported)
+	}
+	return host, int(binary.BigEndian.Uint16(p[:])), nil
+}
+
+// writeSOCKS5Reply writes a reply with the given code. The bound address is
+// not known, so it is always reported as 0.0.0.0:0.
+func writeSOCKS5Reply(w io.Writer, rep byte) error {
+	_, err := w.Write([]byte{socks5Version, rep, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// dialDirectTCPIP returns a client whose server accepts direct-tcpip
+// channels, writes the requested destination to them, and then echoes
+// their data. Destinations on port 1 are rejected.
+func dialDirectTCPIP(t *testing.T) *Client {
+	c1, c2, err := netPipe()
+	if err != nil {
+		t.Fatalf("netPipe: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	t.Cleanup(wg.Wait)
+	wg.Add(1)
+	go func() {
+		defer func() {
+			c1.Close()
+			wg.Done()
+		}()
+		conf := ServerConfig{NoClientAuth: true}
+		conf.AddHostKey(testSigners["rsa"])
+		_, chans, reqs, err := NewServerConn(c1, &conf)
+		if err != nil {
+			t.Errorf("Unable to handshake: %v", err)
+			return
+		}
+		go DiscardRequests(reqs)
+		for newCh := range chans {
+			var msg struct {
+				Raddr string
+				Rport uint32
+				Laddr string
+				Lport uint32
+			}
+			if newCh.ChannelType() != "direct-tcpip" || Unmarshal(newCh.ExtraData(), &msg) != nil {
+				newCh.Reject(UnknownChannelType, "unknown channel type")
+				continue
+			}
+			if msg.Rport == 1 {
+				newCh.Reject(Prohibited, "port 1 is forbidden")
+				continue
+			}
+			ch, reqs, err := newCh.Accept()
+			if err != nil {
+				t.Errorf("Accept: %v", err)
+				continue
+			}
+			go DiscardRequests(reqs)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer ch.Close()
+				fmt.Fprintf(ch, "%s\n", net.JoinHostPort(msg.Raddr, fmt.Sprint(msg.Rport)))
+				io.Copy(ch, ch)
+			}()
+		}
+	}()
+
+	config := &ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: InsecureIgnoreHostKey(),
+	}
+	conn, chans, reqs, err := NewClientConn(c2, "", config)
+	if err != nil {
+		t.Fatalf("unable to dial remote side: %v", err)
+	}
+	return NewClient(conn, chans, reqs)
+}
+
+// socks5Dial connects to the SOCKS5 server at proxy and sends a CONNECT
+// request with the given address type and address. It returns the reply
+// code and the connection.
+func socks5Dial(t *testing.T, proxy string, atyp byte, addr []byte, port uint16) (byte, net.Conn) {
+	conn, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	req := []byte{5, 1, 0, 5, 1, 0, atyp}
+	if atyp == socks5Domain {
+		req = append(req, byte(len(addr)))
+	}
+	req = append(req, addr...)
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	var reply [12]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply[:2], []byte{5, 0}) {
+		t.Fatalf("method selection reply %x", reply[:2])
+	}
+	return reply[3], conn
+}
+
+func TestListenSOCKS5(t *testing.T) {
+	client := dialDirectTCPIP(t)
+	defer client.Close()
+	l, err := client.ListenSOCKS5("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		atyp byte
+		addr []byte
+		want string
+	}{
+		{socks5Domain, []byte("example.com"), "example.com:80"},
+		{socks5IPv4, []byte{192, 0, 2, 1}, "192.0.2.1:80"},
+		{socks5IPv6, net.ParseIP("2001:db8::1"), "[2001:db8::1]:80"},
+	}
+	for _, tt := range tests {
+		rep, conn := socks5Dial(t, l.Addr().String(), tt.atyp, tt.addr, 80)
+		if rep != socks5Succeeded {
+			t.Errorf("%s: reply %d", tt.want, rep)
+			continue
+		}
+		r := bufio.NewReader(conn)
+		if line, err := r.ReadString('\n'); err != nil || line != tt.want+"\n" {
+			t.Errorf("server got destination %q, %v; want %q", line, err, tt.want)
+		}
+		fmt.Fprint(conn, "hello\n")
+		if line, err := r.ReadString('\n'); err != nil || line != "hello\n" {
+			t.Errorf("%s: got %q, %v from the tunnel", tt.want, line, err)
+		}
+	}
+
+	if rep, _ := socks5Dial(t, l.Addr().String(), socks5Domain, []byte("example.com"), 1); rep != socks5NotAllowed {
+		t.Errorf("prohibited destination: got reply %d, want %d", rep, socks5NotAllowed)
+	}
+	if rep, _ := socks5Dial(t, l.Addr().String(), 0x05, nil, 80); rep != socks5AddrNotSupported {
+		t.Errorf("unknown address type: got reply %d, want %d", rep, socks5AddrNotSupported)
+	}
+}
+
+func TestSOCKS5UnsupportedRequests(t *testing.T) {
+	// Only unauthenticated access is supported.
+	var buf bytes.Buffer
+	buf.Write([]byte{5, 1, 2})
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{&buf, &buf}
+	if _, _, err := readSOCKS5Request(rw); err == nil {
+		t.Error("request without a supported method accepted")
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, []byte{5, socks5NoAcceptable}) {
+		t.Errorf("method selection reply %x", got)
+	}
+
+	// BIND is not supported.
+	buf.Reset()
+	buf.Write([]byte{5, 1, 0, 5, 2, 0, socks5IPv4, 127, 0, 0, 1, 0, 80})
+	_, _, err := readSOCKS5Request(rw)
+	if rep, ok := err.(socks5Reply); !ok || rep != socks5CommandNotSupported {
+		t.Errorf("BIND request: got %v, want reply %d", err, socks5CommandNotSupported)
+	}
+
+	// SOCKS4 is not supported.
+	buf.Reset()
+	buf.Write([]byte{4, 1, 0, 80, 127, 0, 0, 1, 0})
+	if _, _, err := readSOCKS5Request(rw); err != errSOCKS5Version {
+		t.Errorf("SOCKS4 request: got %v, want %v", err, errSOCKS5Version)
+	}
+}
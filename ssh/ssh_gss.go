@@ -87,6 +87,45 @@ type GSSAPIServer interface {
 	DeleteSecContext() error
 }
 
+// GSSAPIKeyExchangeClient is a GSSAPIClient that can also verify the MIC with
+// which the server authenticates the GSS-API key exchange methods.
+// Implementations must request mutual authentication and integrity
+// protection when InitSecContext is called from key exchange.
+// See RFC 4462 section 2.
+type GSSAPIKeyExchangeClient interface {
+	GSSAPIClient
+	// VerifyMIC verifies that a cryptographic MIC, contained in the token parameter,
+	// fits the supplied message received from the ssh server.
+	// See RFC 2743 section 2.3.2.
+	VerifyMIC(micField []byte, micToken []byte) error
+}
+
+// GSSAPIKeyExchangeServer is a GSSAPIServer that can also generate the MIC
+// with which it authenticates the GSS-API key exchange methods.
+// See RFC 4462 section 2.
+type GSSAPIKeyExchangeServer interface {
+	GSSAPIServer
+	// GetMIC generates a cryptographic MIC for the exchange hash of the key
+	// exchange, and places the MIC in a token for transfer to the ssh client.
+	// See RFC 2743 section 2.3.1.
+	GetMIC(micField []byte) ([]byte, error)
+}
+
+// GSSAPIKeyExchangeConfig configures the GSS-API key exchange methods of a
+// client. See ClientConfig.GSSAPIKeyExchange.
+type GSSAPIKeyExchangeConfig struct {
+	// Client must be set. It's the implementation of the
+	// GSSAPIKeyExchangeClient interface.
+	Client GSSAPIKeyExchangeClient
+
+	// Target is the server host you want to connect to.
+	Target string
+
+	// DelegateCredentials requests the delegation of the user's
+	// credentials to the server.
+	DelegateCredentials bool
+}
+
 var (
 	// OpenSSH supports Kerberos V5 mechanism only for GSS-API authentication,
 	// so we also support the krb5 mechanism only.
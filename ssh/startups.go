@@ -0,0 +1,117 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	mathrand "math/rand"
+	"net"
+	"sync"
+)
+
+// ErrTooManyStartups is returned by NewServerConn when a connection is
+// dropped by the ServerConfig's StartupLimiter.
+var ErrTooManyStartups = errors.New("ssh: too many unauthenticated connections")
+
+// A StartupLimiter limits the number of concurrent unauthenticated
+// connections of one or more servers, like the MaxStartups and
+// PerSourceMaxStartups options of OpenSSH's sshd. A connection is a startup
+// from the time it is passed to NewServerConn until it authenticates or
+// fails to.
+//
+// When there are Start startups, new connections are dropped with a
+// probability of Rate percent, increasing linearly up to 100 percent when
+// there are Full startups. If Rate or Start is zero, connections are
+// dropped only once there are Full startups.
+//
+// A StartupLimiter may be shared by several ServerConfigs, and must not be
+// copied or modified after first use.
+type StartupLimiter struct {
+	// Start is the number of startups at which connections start being
+	// randomly dropped.
+	Start int
+
+	// Rate is the percentage of connections dropped when there are Start
+	// startups.
+	Rate int
+
+	// Full is the number of startups at which all new connections are
+	// dropped. If zero, the number of startups is unlimited.
+	Full int
+
+	// PerSource is the maximum number of startups from the same IP
+	// address. If zero, it is unlimited.
+	PerSource int
+
+	mu       sync.Mutex
+	startups int
+	sources  map[string]int
+}
+
+// acquire registers a startup from addr, and returns a function to call
+// once it completes.
+func (l *StartupLimiter) acquire(addr net.Addr) (release func(), err error) {
+	source := addrSource(addr)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.drop() {
+		return nil, ErrTooManyStartups
+	}
+	if l.PerSource > 0 && l.sources[source] >= l.PerSource {
+		return nil, ErrTooManyStartups
+	}
+
+	l.startups++
+	if l.sources == nil {
+		l.sources = make(map[string]int)
+	}
+	l.sources[source]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.startups--
+			if l.sources[source]--; l.sources[source] == 0 {
+				delete(l.sources, source)
+			}
+		})
+	}, nil
+}
+
+// drop reports whether a new connection should be dropped, using the same
+// computation as sshd. l.mu must be held.
+func (l *StartupLimiter) drop() bool {
+	if l.Full <= 0 {
+		return false
+	}
+	if l.startups >= l.Full {
+		return true
+	}
+	if l.Start <= 0 || l.Rate <= 0 || l.startups < l.Start || l.Start >= l.Full {
+		return false
+	}
+	p := 100 - l.Rate
+	p *= l.startups - l.Start
+	p /= l.Full - l.Start
+	p += l.Rate
+	return mathrand.Intn(100) < p
+}
+
+// addrSource returns the IP address of addr, or its string representation
+// if it is not an IP network address.
+func addrSource(addr net.Addr) string {
+	switch a := addr.(type) {
+	case nil:
+		return ""
+	case *net.TCPAddr:
+		return a.IP.String()
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
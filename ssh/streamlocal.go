@@ -93,14 +93,21 @@ func (l *unixListener) Accept() (net.Conn, error) {
 	}, nil
 }
 
-// Close closes the listener.
+// Close closes the listener. If the forwarding was already cancelled with
+// CancelRemoteForward, Close does nothing.
 func (l *unixListener) Close() error {
 	// this also closes the listener.
-	l.conn.forwards.remove(&net.UnixAddr{Name: l.socketPath, Net: "unix"})
+	if !l.conn.forwards.remove(&net.UnixAddr{Name: l.socketPath, Net: "unix"}) {
+		return nil
+	}
+	return l.conn.cancelUnixForward(l.socketPath)
+}
+
+func (c *Client) cancelUnixForward(socketPath string) error {
 	m := streamLocalChannelForwardMsg{
-		l.socketPath,
+		socketPath,
 	}
-	ok, _, err := l.conn.SendRequest("cancel-streamlocal-forward@openssh.com", true, Marshal(&m))
+	ok, _, err := c.SendRequest("cancel-streamlocal-forward@openssh.com", true, Marshal(&m))
 	if err == nil && !ok {
 		err = errors.New("ssh: cancel-streamlocal-forward@openssh.com failed")
 	}
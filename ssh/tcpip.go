@@ -251,17 +251,18 @@ func (l *forwardList) handleChannels(in <-chan NewChannel) {
 }
 
 // remove removes the forward entry, and the channel feeding its
-// listener.
-func (l *forwardList) remove(addr net.Addr) {
+// listener. It reports whether the entry existed.
+func (l *forwardList) remove(addr net.Addr) bool {
 	l.Lock()
 	defer l.Unlock()
 	for i, f := range l.entries {
 		if addr.Network() == f.laddr.Network() && addr.String() == f.laddr.String() {
 			l.entries = append(l.entries[:i], l.entries[i+1:]...)
 			close(f.c)
-			return
+			return true
 		}
 	}
+	return false
 }
 
 // closeAll closes and clears all forwards.
@@ -312,22 +313,51 @@ func (l *tcpListener) Accept() (net.Conn, error) {
 	}, nil
 }
 
-// Close closes the listener.
+// Close closes the listener. If the forwarding was already cancelled with
+// CancelRemoteForward, Close does nothing.
 func (l *tcpListener) Close() error {
-	m := channelForwardMsg{
-		l.laddr.IP.String(),
-		uint32(l.laddr.Port),
+	// this also closes the listener.
+	if !l.conn.forwards.remove(l.laddr) {
+		return nil
 	}
+	return l.conn.cancelTCPForward(l.laddr)
+}
 
-	// this also closes the listener.
-	l.conn.forwards.remove(l.laddr)
-	ok, _, err := l.conn.SendRequest("cancel-tcpip-forward", true, Marshal(&m))
+func (c *Client) cancelTCPForward(laddr *net.TCPAddr) error {
+	m := channelForwardMsg{
+		laddr.IP.String(),
+		uint32(laddr.Port),
+	}
+	ok, _, err := c.SendRequest("cancel-tcpip-forward", true, Marshal(&m))
 	if err == nil && !ok {
 		err = errors.New("ssh: cancel-tcpip-forward failed")
 	}
 	return err
 }
 
+// CancelRemoteForward asks the remote peer to stop listening on addr, as
+// set up by a previous call to Listen with the same network. The listener
+// returned by Listen, if any, is closed: its Accept method returns io.EOF.
+// The port of addr must be the one the peer listens on, which is
+// available from the Addr method of the listener if port 0 was requested.
+// N must be "tcp", "tcp4", "tcp6", or "unix".
+func (c *Client) CancelRemoteForward(n, addr string) error {
+	switch n {
+	case "tcp", "tcp4", "tcp6":
+		laddr, err := net.ResolveTCPAddr(n, addr)
+		if err != nil {
+			return err
+		}
+		c.forwards.remove(laddr)
+		return c.cancelTCPForward(laddr)
+	case "unix":
+		c.forwards.remove(&net.UnixAddr{Name: addr, Net: "unix"})
+		return c.cancelUnixForward(addr)
+	default:
+		return fmt.Errorf("ssh: unsupported protocol: %s", n)
+	}
+}
+
 // Addr returns the listener's network address.
 func (l *tcpListener) Addr() net.Addr {
 	return l.laddr
@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/gitpod-io/golang-crypto/internal/testenv"
@@ -98,3 +99,70 @@ func TestSSHCLIAuth(t *testing.T) {
 		t.Fatalf("user certificate authentication failed, error: %v, command output %q", err, string(out))
 	}
 }
+
+// TestSSHCLIKex checks the post-quantum key exchanges against the
+// implementations of OpenSSH, which encapsulates to the keys ssh(1)
+// generates with the reference code.
+func TestSSHCLIKex(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skipf("always fails on Windows, see #64403")
+	}
+	sshCLI := sshClient(t)
+	out, err := testenv.Command(t, sshCLI, "-Q", "kex").Output()
+	if err != nil {
+		t.Fatalf("listing the key exchanges of ssh(1): %v", err)
+	}
+	supported := make(map[string]bool)
+	for _, kex := range strings.Fields(string(out)) {
+		supported[kex] = true
+	}
+
+	dir := t.TempDir()
+	keyPrivPath := filepath.Join(dir, "rsa")
+	if err := os.WriteFile(keyPrivPath, testdata.PEMBytes["rsa"], 0600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", keyPrivPath, err)
+	}
+
+	for _, kex := range []string{
+		"sntrup761x25519-sha512",
+		"sntrup761x25519-sha512@openssh.com",
+		"mlkem768x25519-sha256",
+	} {
+		t.Run(kex, func(t *testing.T) {
+			if !supported[kex] {
+				t.Skipf("ssh(1) doesn't support %s", kex)
+			}
+			config := &ssh.ServerConfig{
+				Config: ssh.Config{KeyExchanges: []string{kex}},
+				PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+					if bytes.Equal(key.Marshal(), testPublicKeys["rsa"].Marshal()) {
+						return nil, nil
+					}
+					return nil, fmt.Errorf("pubkey for %q not acceptable", conn.User())
+				},
+			}
+			config.AddHostKey(testSigners["ed25519"])
+
+			server, err := newTestServer(config)
+			if err != nil {
+				t.Fatalf("unable to start test server: %v", err)
+			}
+			defer server.Close()
+			port, err := server.port()
+			if err != nil {
+				t.Fatalf("unable to get server port: %v", err)
+			}
+
+			cmd := testenv.Command(t, sshCLI, "-vvv", "-i", keyPrivPath, "-o", "StrictHostKeyChecking=no",
+				"-o", "UserKnownHostsFile=/dev/null", "-o", "KexAlgorithms="+kex,
+				"-p", port, "testpubkey@127.0.0.1", "true")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("connecting with %s failed, error: %v, command output %q", kex, err, string(out))
+			}
+			if !strings.Contains(string(out), "kex: algorithm: "+kex) {
+				t.Errorf("ssh(1) didn't use %s, command output %q", kex, string(out))
+			}
+		})
+	}
+}
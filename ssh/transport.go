@@ -10,6 +10,7 @@ import (
 	"errors"
 	"io"
 	"log"
+	"sync/atomic"
 )
 
 // debugTransport if set, will print packet types as they go over the
@@ -75,6 +76,11 @@ type connectionState struct {
 	seqNum           uint32
 	dir              direction
 	pendingKeyChange chan packetCipher
+
+	// authenticated is set once the packets of this direction follow the
+	// acceptance of the authentication of the user, which starts the
+	// delayed compression algorithms.
+	authenticated atomic.Bool
 }
 
 func (t *transport) setStrictMode() error {
@@ -97,13 +103,13 @@ func (t *transport) prepareKeyChange(algs *algorithms, kexResult *kexResult) err
 	if err != nil {
 		return err
 	}
-	t.reader.pendingKeyChange <- ciph
+	t.reader.pendingKeyChange <- withCompression(ciph, algs.r.Compression, &t.reader.authenticated)
 
 	ciph, err = newPacketCipher(t.writer.dir, algs.w, kexResult)
 	if err != nil {
 		return err
 	}
-	t.writer.pendingKeyChange <- ciph
+	t.writer.pendingKeyChange <- withCompression(ciph, algs.w.Compression, &t.writer.authenticated)
 
 	return nil
 }
@@ -139,6 +145,10 @@ func (t *transport) readPacket() (p []byte, err error) {
 	if debugTransport {
 		t.printPacket(p, false)
 	}
+	if t.isClient && len(p) > 0 && p[0] == msgUserAuthSuccess {
+		t.reader.authenticated.Store(true)
+		t.writer.authenticated.Store(true)
+	}
 
 	return p, err
 }
@@ -155,6 +165,7 @@ func (s *connectionState) readPacket(r *bufio.Reader, strictMode bool) ([]byte,
 		case msgNewKeys:
 			select {
 			case cipher := <-s.pendingKeyChange:
+				closeCipher(s.packetCipher)
 				s.packetCipher = cipher
 				if strictMode {
 					s.seqNum = 0
@@ -173,7 +184,11 @@ func (s *connectionState) readPacket(r *bufio.Reader, strictMode bool) ([]byte,
 			if err := Unmarshal(packet, &msg); err != nil {
 				return nil, err
 			}
-			return nil, &msg
+			return nil, &DisconnectError{
+				Reason:   DisconnectReason(msg.Reason),
+				Message:  msg.Message,
+				Language: msg.Language,
+			}
 		}
 	}
 
@@ -189,6 +204,12 @@ func (t *transport) writePacket(packet []byte) error {
 	if debugTransport {
 		t.printPacket(packet, true)
 	}
+	if !t.isClient && len(packet) > 0 && packet[0] == msgUserAuthSuccess {
+		// The client compresses the packets that follow this one, which
+		// may be read before this call returns.
+		t.reader.authenticated.Store(true)
+		defer t.writer.authenticated.Store(true)
+	}
 	return t.writer.writePacket(t.bufWriter, t.rand, packet, t.strictMode)
 }
 
@@ -206,6 +227,7 @@ func (s *connectionState) writePacket(w *bufio.Writer, rand io.Reader, packet []
 	if changeKeys {
 		select {
 		case cipher := <-s.pendingKeyChange:
+			closeCipher(s.packetCipher)
 			s.packetCipher = cipher
 			if strictMode {
 				s.seqNum = 0
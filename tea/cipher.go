@@ -10,6 +10,10 @@
 // birthday bound attacks (see https://sweet32.info). It should only be used
 // where compatibility with legacy systems, not security, is the goal.
 //
+// TEA only uses additions, shifts and XORs, without table lookups, so this
+// implementation runs in constant time and is not vulnerable to
+// cache-timing attacks.
+//
 // Deprecated: any new system should use AES (from crypto/aes, if necessary in
 // an AEAD mode like crypto/cipher.NewGCM) or XChaCha20-Poly1305 (from
 // golang.org/x/crypto/chacha20poly1305).
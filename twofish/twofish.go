@@ -31,8 +31,9 @@ const rsPolynomial = 0x14d  // x^8 + x^6 + x^3 + x^2 + 1, see [TWOFISH] 4.3
 
 // A Cipher is an instance of Twofish encryption using a particular key.
 type Cipher struct {
-	s [4][256]uint32
-	k [40]uint32
+	s            [4][256]uint32
+	k            [40]uint32
+	constantTime bool
 }
 
 type KeySizeError int
@@ -44,6 +45,12 @@ func (k KeySizeError) Error() string {
 // NewCipher creates and returns a Cipher.
 // The key argument should be the Twofish key, 16, 24 or 32 bytes.
 func NewCipher(key []byte) (*Cipher, error) {
+	return newCipher(key, false)
+}
+
+// newCipher returns a Cipher for key, whose key schedule uses constant-time
+// lookups if ct is set.
+func newCipher(key []byte, ct bool) (*Cipher, error) {
 	keylen := len(key)
 
 	if keylen != 16 && keylen != 24 && keylen != 32 {
@@ -65,20 +72,20 @@ func NewCipher(key []byte) (*Cipher, error) {
 	}
 
 	// Calculate subkeys
-	c := new(Cipher)
+	c := &Cipher{constantTime: ct}
 	var tmp [4]byte
 	for i := byte(0); i < 20; i++ {
 		// A = h(p * 2x, Me)
 		for j := range tmp {
 			tmp[j] = 2 * i
 		}
-		A := h(tmp[:], key, 0)
+		A := h(tmp[:], key, 0, ct)
 
 		// B = rolc(h(p * (2x + 1), Mo), 8)
 		for j := range tmp {
 			tmp[j] = 2*i + 1
 		}
-		B := h(tmp[:], key, 1)
+		B := h(tmp[:], key, 1, ct)
 		B = bits.RotateLeft32(B, 8)
 
 		c.k[2*i] = A + B
@@ -91,24 +98,24 @@ func NewCipher(key []byte) (*Cipher, error) {
 	switch k {
 	case 2:
 		for i := range c.s[0] {
-			c.s[0][i] = mdsColumnMult(sbox[1][sbox[0][sbox[0][byte(i)]^S[0]]^S[4]], 0)
-			c.s[1][i] = mdsColumnMult(sbox[0][sbox[0][sbox[1][byte(i)]^S[1]]^S[5]], 1)
-			c.s[2][i] = mdsColumnMult(sbox[1][sbox[1][sbox[0][byte(i)]^S[2]]^S[6]], 2)
-			c.s[3][i] = mdsColumnMult(sbox[0][sbox[1][sbox[1][byte(i)]^S[3]]^S[7]], 3)
+			c.s[0][i] = mdsColumnMult(q(ct, 1, q(ct, 0, q(ct, 0, byte(i))^S[0])^S[4]), 0)
+			c.s[1][i] = mdsColumnMult(q(ct, 0, q(ct, 0, q(ct, 1, byte(i))^S[1])^S[5]), 1)
+			c.s[2][i] = mdsColumnMult(q(ct, 1, q(ct, 1, q(ct, 0, byte(i))^S[2])^S[6]), 2)
+			c.s[3][i] = mdsColumnMult(q(ct, 0, q(ct, 1, q(ct, 1, byte(i))^S[3])^S[7]), 3)
 		}
 	case 3:
 		for i := range c.s[0] {
-			c.s[0][i] = mdsColumnMult(sbox[1][sbox[0][sbox[0][sbox[1][byte(i)]^S[0]]^S[4]]^S[8]], 0)
-			c.s[1][i] = mdsColumnMult(sbox[0][sbox[0][sbox[1][sbox[1][byte(i)]^S[1]]^S[5]]^S[9]], 1)
-			c.s[2][i] = mdsColumnMult(sbox[1][sbox[1][sbox[0][sbox[0][byte(i)]^S[2]]^S[6]]^S[10]], 2)
-			c.s[3][i] = mdsColumnMult(sbox[0][sbox[1][sbox[1][sbox[0][byte(i)]^S[3]]^S[7]]^S[11]], 3)
+			c.s[0][i] = mdsColumnMult(q(ct, 1, q(ct, 0, q(ct, 0, q(ct, 1, byte(i))^S[0])^S[4])^S[8]), 0)
+			c.s[1][i] = mdsColumnMult(q(ct, 0, q(ct, 0, q(ct, 1, q(ct, 1, byte(i))^S[1])^S[5])^S[9]), 1)
+			c.s[2][i] = mdsColumnMult(q(ct, 1, q(ct, 1, q(ct, 0, q(ct, 0, byte(i))^S[2])^S[6])^S[10]), 2)
+			c.s[3][i] = mdsColumnMult(q(ct, 0, q(ct, 1, q(ct, 1, q(ct, 0, byte(i))^S[3])^S[7])^S[11]), 3)
 		}
 	default:
 		for i := range c.s[0] {
-			c.s[0][i] = mdsColumnMult(sbox[1][sbox[0][sbox[0][sbox[1][sbox[1][byte(i)]^S[0]]^S[4]]^S[8]]^S[12]], 0)
-			c.s[1][i] = mdsColumnMult(sbox[0][sbox[0][sbox[1][sbox[1][sbox[0][byte(i)]^S[1]]^S[5]]^S[9]]^S[13]], 1)
-			c.s[2][i] = mdsColumnMult(sbox[1][sbox[1][sbox[0][sbox[0][sbox[0][byte(i)]^S[2]]^S[6]]^S[10]]^S[14]], 2)
-			c.s[3][i] = mdsColumnMult(sbox[0][sbox[1][sbox[1][sbox[0][sbox[1][byte(i)]^S[3]]^S[7]]^S[11]]^S[15]], 3)
+			c.s[0][i] = mdsColumnMult(q(ct, 1, q(ct, 0, q(ct, 0, q(ct, 1, q(ct, 1, byte(i))^S[0])^S[4])^S[8])^S[12]), 0)
+			c.s[1][i] = mdsColumnMult(q(ct, 0, q(ct, 0, q(ct, 1, q(ct, 1, q(ct, 0, byte(i))^S[1])^S[5])^S[9])^S[13]), 1)
+			c.s[2][i] = mdsColumnMult(q(ct, 1, q(ct, 1, q(ct, 0, q(ct, 0, q(ct, 0, byte(i))^S[2])^S[6])^S[10])^S[14]), 2)
+			c.s[3][i] = mdsColumnMult(q(ct, 0, q(ct, 1, q(ct, 1, q(ct, 0, q(ct, 1, byte(i))^S[3])^S[7])^S[11])^S[15]), 3)
 		}
 	}
 
@@ -217,29 +224,29 @@ func mdsColumnMult(in byte, col int) uint32 {
 }
 
 // h implements the S-box generation function. See [TWOFISH] 4.3.5
-func h(in, key []byte, offset int) uint32 {
+func h(in, key []byte, offset int, ct bool) uint32 {
 	var y [4]byte
 	for x := range y {
 		y[x] = in[x]
 	}
 	switch len(key) / 8 {
 	case 4:
-		y[0] = sbox[1][y[0]] ^ key[4*(6+offset)+0]
-		y[1] = sbox[0][y[1]] ^ key[4*(6+offset)+1]
-		y[2] = sbox[0][y[2]] ^ key[4*(6+offset)+2]
-		y[3] = sbox[1][y[3]] ^ key[4*(6+offset)+3]
+		y[0] = q(ct, 1, y[0]) ^ key[4*(6+offset)+0]
+		y[1] = q(ct, 0, y[1]) ^ key[4*(6+offset)+1]
+		y[2] = q(ct, 0, y[2]) ^ key[4*(6+offset)+2]
+		y[3] = q(ct, 1, y[3]) ^ key[4*(6+offset)+3]
 		fallthrough
 	case 3:
-		y[0] = sbox[1][y[0]] ^ key[4*(4+offset)+0]
-		y[1] = sbox[1][y[1]] ^ key[4*(4+offset)+1]
-		y[2] = sbox[0][y[2]] ^ key[4*(4+offset)+2]
-		y[3] = sbox[0][y[3]] ^ key[4*(4+offset)+3]
+		y[0] = q(ct, 1, y[0]) ^ key[4*(4+offset)+0]
+		y[1] = q(ct, 1, y[1]) ^ key[4*(4+offset)+1]
+		y[2] = q(ct, 0, y[2]) ^ key[4*(4+offset)+2]
+		y[3] = q(ct, 0, y[3]) ^ key[4*(4+offset)+3]
 		fallthrough
 	case 2:
-		y[0] = sbox[1][sbox[0][sbox[0][y[0]]^key[4*(2+offset)+0]]^key[4*(0+offset)+0]]
-		y[1] = sbox[0][sbox[0][sbox[1][y[1]]^key[4*(2+offset)+1]]^key[4*(0+offset)+1]]
-		y[2] = sbox[1][sbox[1][sbox[0][y[2]]^key[4*(2+offset)+2]]^key[4*(0+offset)+2]]
-		y[3] = sbox[0][sbox[1][sbox[1][y[3]]^key[4*(2+offset)+3]]^key[4*(0+offset)+3]]
+		y[0] = q(ct, 1, q(ct, 0, q(ct, 0, y[0])^key[4*(2+offset)+0])^key[4*(0+offset)+0])
+		y[1] = q(ct, 0, q(ct, 0, q(ct, 1, y[1])^key[4*(2+offset)+1])^key[4*(0+offset)+1])
+		y[2] = q(ct, 1, q(ct, 1, q(ct, 0, y[2])^key[4*(2+offset)+2])^key[4*(0+offset)+2])
+		y[3] = q(ct, 0, q(ct, 1, q(ct, 1, y[3])^key[4*(2+offset)+3])^key[4*(0+offset)+3])
 	}
 	// [y0 y1 y2 y3] = MDS . [x0 x1 x2 x3]
 	var mdsMult uint32
@@ -254,6 +261,10 @@ func h(in, key []byte, offset int) uint32 {
 // it is not safe to just call Encrypt on successive blocks;
 // instead, use an encryption mode like CBC (see crypto/cipher/cbc.go).
 func (c *Cipher) Encrypt(dst, src []byte) {
+	if c.constantTime {
+		c.encryptConstantTime(dst, src)
+		return
+	}
 	S1 := c.s[0]
 	S2 := c.s[1]
 	S3 := c.s[2]
@@ -298,6 +309,10 @@ func (c *Cipher) Encrypt(dst, src []byte) {
 
 // Decrypt decrypts a 16-byte block from src to dst, which may overlap.
 func (c *Cipher) Decrypt(dst, src []byte) {
+	if c.constantTime {
+		c.decryptConstantTime(dst, src)
+		return
+	}
 	S1 := c.s[0]
 	S2 := c.s[1]
 	S3 := c.s[2]
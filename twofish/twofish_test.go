@@ -92,11 +92,19 @@ var testVectors = []struct {
 }
 
 func TestCipher(t *testing.T) {
+	testCipher(t, NewCipher)
+}
+
+func TestConstantTimeCipher(t *testing.T) {
+	testCipher(t, NewConstantTimeCipher)
+}
+
+func testCipher(t *testing.T, newCipher func([]byte) (*Cipher, error)) {
 	for n, tt := range testVectors {
 		// Test if the plaintext (dec) is encrypts to the given
 		// ciphertext (enc) using the given key. Test also if enc can
 		// be decrypted again into dec.
-		c, err := NewCipher(tt.key)
+		c, err := newCipher(tt.key)
 		if err != nil {
 			t.Errorf("#%d: NewCipher: %v", n, err)
 			return
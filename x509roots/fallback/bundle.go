@@ -6,9 +6,15 @@ package fallback
 
 import "crypto/x509"
 import "encoding/pem"
+import "time"
 
-func mustParse(b []byte) []*x509.Certificate {
-	var roots []*x509.Certificate
+type root struct {
+	cert          *x509.Certificate
+	distrustAfter time.Time
+}
+
+func mustParse(b []byte) []root {
+	var roots []root
 	for len(b) > 0 {
 		var block *pem.Block
 		block, b = pem.Decode(b)
@@ -22,7 +28,17 @@ func mustParse(b []byte) []*x509.Certificate {
 		if err != nil {
 			panic(err)
 		}
-		roots = append(roots, cert)
+		r := root{cert: cert}
+		for k, v := range block.Headers {
+			if k != "Distrust-After" {
+				panic("unexpected PEM header: " + k)
+			}
+			r.distrustAfter, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				panic(err)
+			}
+		}
+		roots = append(roots, r)
 	}
 	return roots
 }
@@ -32,7 +48,7 @@ var bundle = mustParse([]byte(pemRoots))
 // Format of the PEM list is:
 //   * Subject common name
 //   * SHA256 hash
-//   * PEM block
+//   * PEM block, with a Distrust-After header for constrained roots
 
 const pemRoots = `
 # CN=AAA Certificate Services,O=Comodo CA Limited,L=Salford,ST=Greater Manchester,C=GB
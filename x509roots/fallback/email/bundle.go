@@ -0,0 +1,54 @@
+// Code generated by gen_fallback_bundle.go; DO NOT EDIT.
+
+//go:build go1.20
+
+package email
+
+import "crypto/x509"
+import "encoding/pem"
+import "time"
+
+type root struct {
+	cert          *x509.Certificate
+	distrustAfter time.Time
+}
+
+func mustParse(b []byte) []root {
+	var roots []root
+	for len(b) > 0 {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			panic("unexpected PEM block type: " + block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			panic(err)
+		}
+		r := root{cert: cert}
+		for k, v := range block.Headers {
+			if k != "Distrust-After" {
+				panic("unexpected PEM header: " + k)
+			}
+			r.distrustAfter, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				panic(err)
+			}
+		}
+		roots = append(roots, r)
+	}
+	return roots
+}
+
+var bundle = mustParse([]byte(pemRoots))
+
+// Format of the PEM list is:
+//   * Subject common name
+//   * SHA256 hash
+//   * PEM block, with a Distrust-After header for constrained roots
+
+const pemRoots = `
+`
@@ -0,0 +1,13 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.20 && !go1.22
+
+package email
+
+import "crypto/x509"
+
+// addConstrained leaves r out of the pool, since there is no way to enforce
+// its constraints before Go 1.22.
+func addConstrained(p *x509.CertPool, r root) {}
@@ -0,0 +1,13 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.22
+
+package email
+
+import "crypto/x509"
+
+func addConstrained(p *x509.CertPool, r root) {
+	p.AddCertWithConstraint(r.cert, r.check)
+}
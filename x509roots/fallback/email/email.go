@@ -0,0 +1,54 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.20
+
+// Package email embeds the X.509 roots of the Mozilla root store that are
+// trusted for email protection (S/MIME), for applications that verify
+// S/MIME certificates without relying on the operating system.
+//
+// Unlike package fallback, whose bundle only includes roots trusted for TLS
+// server authentication, importing this package has no side effects. Use
+// [CertPool] to build the pool to pass to [x509.VerifyOptions].
+//
+// Some roots in the bundle are only trusted for certificates issued before a
+// given date. With Go 1.22 and later, CertPool adds these roots with their
+// constraints. Earlier versions of Go can't enforce the constraints, and
+// leave these roots out of the pool.
+//
+// This package must be kept up to date for security and compatibility reasons.
+// Use govulncheck to be notified of when new versions of the package are
+// available.
+package email
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// CertPool returns a new pool with the roots of the bundle.
+func CertPool() *x509.CertPool {
+	p := x509.NewCertPool()
+	for _, r := range bundle {
+		if r.distrustAfter.IsZero() {
+			p.AddCert(r.cert)
+			continue
+		}
+		addConstrained(p, r)
+	}
+	return p
+}
+
+// check reports whether chain, which is rooted at r.cert, satisfies the
+// constraints of r.
+func (r root) check(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	if leaf := chain[0]; leaf.NotBefore.After(r.distrustAfter) {
+		return fmt.Errorf("x509roots/fallback/email: certificate issued at %v, after %q was distrusted at %v",
+			leaf.NotBefore, r.cert.Subject.CommonName, r.distrustAfter)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.20
+
+package email
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestCertPool(t *testing.T) {
+	if len(bundle) == 0 {
+		t.Fatal("the bundle has no roots; run go generate in x509roots")
+	}
+	if CertPool().Equal(x509.NewCertPool()) {
+		t.Error("CertPool returned an empty pool")
+	}
+}
@@ -15,17 +15,83 @@
 //
 // It's recommended that only binaries, and not libraries, import this package.
 //
+// Some roots in the bundle are constrained, for example because they are
+// only trusted for certificates issued before a given date. With Go 1.22 and
+// later these roots are added to the fallback pool together with their
+// constraints, using [x509.CertPool.AddCertWithConstraint]. Earlier versions
+// of Go can't enforce the constraints, and leave these roots out of the pool.
+// [ConstrainedRoots] returns the constrained roots for applications that
+// build their own pools.
+//
+// Applications that can't wait for a new release to get updated roots can
+// fetch signed bundles at run time with package
+// golang.org/x/crypto/x509roots/fallback/update.
+//
 // This package must be kept up to date for security and compatibility reasons.
 // Use govulncheck to be notified of when new versions of the package are
 // available.
 package fallback
 
-import "crypto/x509"
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/x509roots/fallback/internal/embedded"
+)
 
 func init() {
+	embedded.Pool = newPool(bundle)
+	x509.SetFallbackRoots(embedded.Pool)
+}
+
+func newPool(roots []root) *x509.CertPool {
 	p := x509.NewCertPool()
-	for _, c := range bundle {
-		p.AddCert(c)
+	for _, r := range roots {
+		if r.distrustAfter.IsZero() {
+			p.AddCert(r.cert)
+			continue
+		}
+		addConstrained(p, ConstrainedRoot{Certificate: r.cert, DistrustAfter: r.distrustAfter})
+	}
+	return p
+}
+
+// A ConstrainedRoot is a root in the bundle that is only trusted subject to
+// additional constraints.
+type ConstrainedRoot struct {
+	Certificate *x509.Certificate
+
+	// DistrustAfter is the time after which certificates issued under this
+	// root are no longer trusted, as determined by the NotBefore time of the
+	// leaf certificate. It corresponds to the NSS
+	// CKA_NSS_SERVER_DISTRUST_AFTER attribute.
+	DistrustAfter time.Time
+}
+
+// Check reports whether chain, which is rooted at r.Certificate, satisfies
+// the constraints of r. It has the signature expected by
+// [x509.CertPool.AddCertWithConstraint].
+func (r ConstrainedRoot) Check(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	if leaf := chain[0]; !r.DistrustAfter.IsZero() && leaf.NotBefore.After(r.DistrustAfter) {
+		return fmt.Errorf("x509roots/fallback: certificate issued at %v, after %q was distrusted at %v",
+			leaf.NotBefore, r.Certificate.Subject.CommonName, r.DistrustAfter)
+	}
+	return nil
+}
+
+// ConstrainedRoots returns the constrained roots of the bundle. These roots
+// are not trusted without their constraints, so they must not be added to a
+// pool with [x509.CertPool.AddCert].
+func ConstrainedRoots() []ConstrainedRoot {
+	var roots []ConstrainedRoot
+	for _, r := range bundle {
+		if !r.distrustAfter.IsZero() {
+			roots = append(roots, ConstrainedRoot{Certificate: r.cert, DistrustAfter: r.distrustAfter})
+		}
 	}
-	x509.SetFallbackRoots(p)
+	return roots
 }
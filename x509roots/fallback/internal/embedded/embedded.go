@@ -0,0 +1,15 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.20
+
+// Package embedded shares the pool of the embedded roots of package fallback
+// with its subpackages, without exporting it.
+package embedded
+
+import "crypto/x509"
+
+// Pool is the pool of the embedded roots, set by the init function of
+// package fallback.
+var Pool *x509.CertPool
@@ -0,0 +1,17 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.22
+
+package update
+
+import (
+	"crypto/x509"
+
+	"golang.org/x/crypto/x509roots/fallback"
+)
+
+func addConstrained(p *x509.CertPool, r fallback.ConstrainedRoot) {
+	p.AddCertWithConstraint(r.Certificate, r.Check)
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.20
+
+// Package update fetches newer versions of the fallback root bundle at run
+// time, and verifies that they are signed by a trusted key.
+//
+// It is separate from package fallback so that binaries that only import
+// the embedded roots don't link in net/http.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/x509roots/fallback"
+	"golang.org/x/crypto/x509roots/fallback/internal/embedded"
+)
+
+// A signed bundle is a bundle in the PEM format of the embedded one,
+// preceded by a signature block:
+//
+//	-----BEGIN X509ROOTS SIGNATURE-----
+//	Version: 20240601
+//
+//	<base64 Ed25519 signature>
+//	-----END X509ROOTS SIGNATURE-----
+//	-----BEGIN CERTIFICATE-----
+//	Distrust-After: 2025-01-01T00:00:00Z
+//	...
+//
+// The signature covers signaturePrefix, the decimal version and a newline,
+// followed by all the bytes after the signature block.
+const (
+	signatureBlockType = "X509ROOTS SIGNATURE"
+	signaturePrefix    = "x509roots/fallback signed bundle v1\n"
+)
+
+// newPool returns a pool of roots, with their constraints.
+func newPool(roots []fallback.ConstrainedRoot) *x509.CertPool {
+	p := x509.NewCertPool()
+	for _, r := range roots {
+		if r.DistrustAfter.IsZero() {
+			p.AddCert(r.Certificate)
+			continue
+		}
+		addConstrained(p, r)
+	}
+	return p
+}
+
+// maxBundleSize is the maximum size of a signed bundle fetched by Update.
+const maxBundleSize = 4 << 20
+
+// An Updater fetches newer versions of the root bundle at run time, and
+// verifies that they are signed by a trusted key.
+//
+// [x509.SetFallbackRoots] may only be called once, so the roots installed
+// by the init function of package fallback, which this package imports,
+// can't be replaced. Instead, Pool
+// returns the roots of the latest verified bundle, to be used for example
+// as the RootCAs of a [crypto/tls.Config]. Until a bundle is fetched, it returns
+// the embedded roots.
+type Updater struct {
+	// URL is the location of the signed bundle.
+	URL string
+
+	// PublicKey is the Ed25519 key the bundle must be signed with. It is
+	// typically embedded in the application.
+	PublicKey ed25519.PublicKey
+
+	// Client is used to fetch the bundle. If nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+
+	mu      sync.Mutex // serializes Update
+	version atomic.Int64
+	pool    atomic.Pointer[x509.CertPool]
+}
+
+// Pool returns a pool of the roots of the latest bundle verified by u, or of
+// the embedded bundle if there is none. The pool must not be modified.
+func (u *Updater) Pool() *x509.CertPool {
+	if p := u.pool.Load(); p != nil {
+		return p
+	}
+	return embedded.Pool
+}
+
+// Version returns the version of the latest bundle verified by u, or zero
+// if there is none.
+func (u *Updater) Version() int64 {
+	return u.version.Load()
+}
+
+// Update fetches the signed bundle and, if it is valid and its version is
+// higher than the one of the current bundle, makes Pool return its roots.
+// It reports whether the pool was replaced. Bundles with a version that
+// isn't higher are ignored, so that an attacker can't roll back the roots
+// to an older signed bundle.
+func (u *Updater) Update(ctx context.Context) (updated bool, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	data, err := u.fetch(ctx)
+	if err != nil {
+		return false, err
+	}
+	version, roots, err := parseSignedBundle(data, u.PublicKey)
+	if err != nil {
+		return false, err
+	}
+	if version <= u.version.Load() {
+		return false, nil
+	}
+	u.pool.Store(newPool(roots))
+	u.version.Store(version)
+	return true, nil
+}
+
+func (u *Updater) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := u.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("x509roots/fallback/update: fetching bundle: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBundleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBundleSize {
+		return nil, errors.New("x509roots/fallback/update: bundle too large")
+	}
+	return data, nil
+}
+
+// SignBundle returns a signed bundle of the given version, for the roots in
+// PEM format of pemRoots, which may have Distrust-After headers like the
+// embedded bundle. It is meant for the tools that publish bundles for an
+// Updater.
+func SignBundle(key ed25519.PrivateKey, version int64, pemRoots []byte) ([]byte, error) {
+	if version <= 0 {
+		return nil, errors.New("x509roots/fallback/update: bundle version must be positive")
+	}
+	if _, err := parseRoots(pemRoots); err != nil {
+		return nil, err
+	}
+	v := strconv.FormatInt(version, 10)
+	sig := ed25519.Sign(key, signedMessage(v, pemRoots))
+	b := pem.EncodeToMemory(&pem.Block{
+		Type:    signatureBlockType,
+		Headers: map[string]string{"Version": v},
+		Bytes:   sig,
+	})
+	return append(b, pemRoots...), nil
+}
+
+func signedMessage(version string, pemRoots []byte) []byte {
+	m := append([]byte(signaturePrefix), version...)
+	m = append(m, '\n')
+	return append(m, pemRoots...)
+}
+
+// parseSignedBundle verifies the signature of a signed bundle, and returns
+// its version and roots.
+func parseSignedBundle(data []byte, key ed25519.PublicKey) (int64, []fallback.ConstrainedRoot, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return 0, nil, errors.New("x509roots/fallback/update: invalid bundle verification key")
+	}
+	block, rest := pem.Decode(data)
+	if block == nil || block.Type != signatureBlockType {
+		return 0, nil, errors.New("x509roots/fallback/update: bundle is not signed")
+	}
+	v := block.Headers["Version"]
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || version <= 0 || len(block.Headers) != 1 {
+		return 0, nil, errors.New("x509roots/fallback/update: invalid bundle signature block")
+	}
+	if !ed25519.Verify(key, signedMessage(v, rest), block.Bytes) {
+		return 0, nil, errors.New("x509roots/fallback/update: invalid bundle signature")
+	}
+	roots, err := parseRoots(rest)
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, roots, nil
+}
+
+// parseRoots parses roots in the PEM format of the embedded bundle. Roots
+// without a Distrust-After header have a zero DistrustAfter.
+func parseRoots(b []byte) ([]fallback.ConstrainedRoot, error) {
+	var roots []fallback.ConstrainedRoot
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("x509roots/fallback/update: unexpected PEM block type %q in bundle", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509roots/fallback/update: invalid root in bundle: %w", err)
+		}
+		r := fallback.ConstrainedRoot{Certificate: cert}
+		for k, v := range block.Headers {
+			if k != "Distrust-After" {
+				return nil, fmt.Errorf("x509roots/fallback/update: unexpected PEM header %q in bundle", k)
+			}
+			if r.DistrustAfter, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, fmt.Errorf("x509roots/fallback/update: invalid Distrust-After header in bundle: %w", err)
+			}
+		}
+		roots = append(roots, r)
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("x509roots/fallback/update: bundle has no roots")
+	}
+	return roots, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.20
+
+package update
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/x509roots/fallback/internal/embedded"
+)
+
+func newTestRoot(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestUpdater(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := newTestRoot(t, "Updated Root")
+	pemRoots := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+
+	var served []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(served)
+	}))
+	defer ts.Close()
+	u := &Updater{URL: ts.URL, PublicKey: pub}
+
+	if u.Pool() != embedded.Pool || u.Version() != 0 {
+		t.Fatal("Updater doesn't start with the embedded roots")
+	}
+	trusted := func() bool {
+		_, err := root.Verify(x509.VerifyOptions{Roots: u.Pool()})
+		return err == nil
+	}
+	if trusted() {
+		t.Fatal("test root is trusted before the update")
+	}
+
+	served, err = SignBundle(priv, 2, pemRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := u.Update(context.Background()); err != nil || !updated {
+		t.Fatalf("Update: %v, %v", updated, err)
+	}
+	if !trusted() || u.Version() != 2 {
+		t.Fatalf("got version %d, want the test root at version 2", u.Version())
+	}
+
+	// Older and current versions are ignored.
+	other := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newTestRoot(t, "Other Root").Raw})
+	for _, version := range []int64{1, 2} {
+		served, err = SignBundle(priv, version, other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated, err := u.Update(context.Background()); err != nil || updated {
+			t.Errorf("Update to version %d: %v, %v", version, updated, err)
+		}
+	}
+	if !trusted() {
+		t.Error("bundle was rolled back")
+	}
+
+	// Tampered bundles and bundles signed by another key are rejected.
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served, err = SignBundle(otherPriv, 3, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Update(context.Background()); err == nil {
+		t.Error("Update accepted a bundle signed by another key")
+	}
+	signed, err := SignBundle(priv, 3, pemRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served = append(signed, other...)
+	if _, err := u.Update(context.Background()); err == nil {
+		t.Error("Update accepted a tampered bundle")
+	}
+	served = pemRoots
+	if _, err := u.Update(context.Background()); err == nil {
+		t.Error("Update accepted an unsigned bundle")
+	}
+	if !trusted() || u.Version() != 2 {
+		t.Error("failed updates replaced the roots")
+	}
+}
+
+func TestSignBundleConstraints(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := newTestRoot(t, "Constrained Root")
+	distrustAfter := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	signed, err := SignBundle(priv, 1, pem.EncodeToMemory(&pem.Block{
+		Type:    "CERTIFICATE",
+		Headers: map[string]string{"Distrust-After": distrustAfter.Format(time.RFC3339)},
+		Bytes:   root.Raw,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, roots, err := parseSignedBundle(signed, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || !roots[0].DistrustAfter.Equal(distrustAfter) {
+		t.Errorf("got roots %v, want the root distrusted after %v", roots, distrustAfter)
+	}
+
+	if _, err := SignBundle(priv, 1, []byte("not PEM")); err == nil {
+		t.Error("SignBundle accepted a bundle without roots")
+	}
+	if _, err := SignBundle(priv, 0, signed); err == nil {
+		t.Error("SignBundle accepted version 0")
+	}
+}
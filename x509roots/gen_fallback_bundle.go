@@ -5,13 +5,17 @@
 //go:build generate
 
 //go:generate go run gen_fallback_bundle.go
+//go:generate go run gen_fallback_bundle.go -purpose emailProtection
 
 package main
 
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"go/format"
@@ -21,6 +25,8 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/gitpod-io/golang-crypto/x509roots/nss"
 )
@@ -29,13 +35,19 @@ const tmpl = `// Code generated by gen_fallback_bundle.go; DO NOT EDIT.
 
 //go:build go1.20
 
-package fallback
+package %s
 
 import "crypto/x509"
 import "encoding/pem"
+import "time"
 
-func mustParse(b []byte) []*x509.Certificate {
-	var roots []*x509.Certificate
+type root struct {
+	cert          *x509.Certificate
+	distrustAfter time.Time
+}
+
+func mustParse(b []byte) []root {
+	var roots []root
 	for len(b) > 0 {
 		var block *pem.Block
 		block, b = pem.Decode(b)
@@ -49,7 +61,17 @@ func mustParse(b []byte) []*x509.Certificate {
 		if err != nil {
 			panic(err)
 		}
-		roots = append(roots, cert)
+		r := root{cert: cert}
+		for k, v := range block.Headers {
+			if k != "Distrust-After" {
+				panic("unexpected PEM header: " + k)
+			}
+			r.distrustAfter, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				panic(err)
+			}
+		}
+		roots = append(roots, r)
 	}
 	return roots
 }
@@ -59,19 +81,39 @@ var bundle = mustParse([]byte(pemRoots))
 // Format of the PEM list is:
 //   * Subject common name
 //   * SHA256 hash
-//   * PEM block
+//   * PEM block, with a Distrust-After header for constrained roots
 
 `
 
 var (
 	certDataURL  = flag.String("certdata-url", "https://hg.mozilla.org/mozilla-central/raw-file/tip/security/nss/lib/ckfw/builtins/certdata.txt", "URL to the raw certdata.txt file to parse (certdata-path overrides this, if provided)")
 	certDataPath = flag.String("certdata-path", "", "Path to the NSS certdata.txt file to parse (this overrides certdata-url, if provided)")
-	output       = flag.String("output", "fallback/bundle.go", "Path to file to write output to")
+	output       = flag.String("output", "", "Path to file to write output to (defaults to the bundle of the purpose)")
+	purpose      = flag.String("purpose", "serverAuth", "Purpose the roots must be trusted for: serverAuth or emailProtection")
+	diff         = flag.Bool("diff", false, "Print a JSON report of the changes between the bundle at the output path and certdata.txt to stdout, instead of writing the bundle")
 )
 
+// purposes maps the values of the -purpose flag to the NSS trust purpose, and
+// to the package and the file that the bundle is written to by default.
+var purposes = map[string]struct {
+	nss            nss.Purpose
+	pkg, outputDir string
+}{
+	"serverAuth":      {nss.PurposeServerAuth, "fallback", "fallback"},
+	"emailProtection": {nss.PurposeEmailProtection, "email", "fallback/email"},
+}
+
 func main() {
 	flag.Parse()
 
+	p, ok := purposes[*purpose]
+	if !ok {
+		log.Fatalf("unknown purpose %q", *purpose)
+	}
+	if *output == "" {
+		*output = p.outputDir + "/bundle.go"
+	}
+
 	var certdata io.Reader
 
 	if *certDataPath != "" {
@@ -100,10 +142,11 @@ func main() {
 		certdata = resp.Body
 	}
 
-	certs, err := nss.Parse(certdata)
+	file, err := nss.ParseFile(certdata, p.nss)
 	if err != nil {
 		log.Fatalf("failed to parse %q: %s", *certDataPath, err)
 	}
+	certs := file.Certificates
 
 	if len(certs) == 0 {
 		log.Fatal("certdata.txt appears to contain zero roots")
@@ -122,19 +165,56 @@ func main() {
 		return subjI < subjJ
 	})
 
-	b := new(bytes.Buffer)
-	b.WriteString(tmpl)
-	fmt.Fprintln(b, "const pemRoots = `")
+	var roots []bundleRoot
+	var excluded []excludedRoot
+	for _, c := range file.Excluded {
+		excluded = append(excluded, excludedRoot{newBundleRoot(c.X509, ""), "manual exclusion"})
+	}
 	for _, c := range certs {
-		if len(c.Constraints) > 0 {
-			// Until the constrained roots API lands, skip anything that has any
-			// additional constraints. Once that API is available, we can add
-			// build constraints that support both the current version and the
-			// new version.
+		var distrustAfter string
+		known := true
+		for _, constraint := range c.Constraints {
+			switch constraint := constraint.(type) {
+			case nss.DistrustAfter:
+				distrustAfter = time.Time(constraint).UTC().Format(time.RFC3339)
+			case nss.EmailDistrustAfter:
+				distrustAfter = time.Time(constraint).UTC().Format(time.RFC3339)
+			default:
+				known = false
+			}
+		}
+		if !known {
+			// Skip roots with constraints that the fallback package can't
+			// enforce, rather than trusting them without the constraint.
+			excluded = append(excluded, excludedRoot{newBundleRoot(c.X509, ""), "unsupported constraint"})
 			continue
 		}
-		fmt.Fprintf(b, "# %s\n# %x\n", c.X509.Subject.String(), sha256.Sum256(c.X509.Raw))
-		pem.Encode(b, &pem.Block{Type: "CERTIFICATE", Bytes: c.X509.Raw})
+		roots = append(roots, newBundleRoot(c.X509, distrustAfter))
+	}
+
+	if *diff {
+		old, err := readBundle(*output)
+		if err != nil {
+			log.Fatalf("failed to read the current bundle: %s", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(diffBundles(old, roots, excluded)); err != nil {
+			log.Fatalf("failed to write the report: %s", err)
+		}
+		return
+	}
+
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, tmpl, p.pkg)
+	fmt.Fprintln(b, "const pemRoots = `")
+	for _, r := range roots {
+		block := &pem.Block{Type: "CERTIFICATE", Bytes: r.der}
+		if r.DistrustAfter != "" {
+			block.Headers = map[string]string{"Distrust-After": r.DistrustAfter}
+		}
+		fmt.Fprintf(b, "# %s\n# %s\n", r.Subject, r.SHA256)
+		pem.Encode(b, block)
 	}
 	fmt.Fprintln(b, "`")
 
@@ -147,3 +227,127 @@ func main() {
 		log.Fatalf("failed to write to %q: %s", *output, err)
 	}
 }
+
+// A bundleRoot is a root of a bundle, as listed in the reports of -diff.
+type bundleRoot struct {
+	Subject string `json:"subject"`
+	SHA256  string `json:"sha256"`
+	// DistrustAfter is the Distrust-After header of the root, in RFC 3339
+	// format, if it is constrained.
+	DistrustAfter string `json:"distrustAfter,omitempty"`
+
+	der []byte
+}
+
+func newBundleRoot(cert *x509.Certificate, distrustAfter string) bundleRoot {
+	return bundleRoot{
+		Subject:       cert.Subject.String(),
+		SHA256:        fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+		DistrustAfter: distrustAfter,
+		der:           cert.Raw,
+	}
+}
+
+// An excludedRoot is a root trusted by certdata.txt that is left out of the
+// bundle.
+type excludedRoot struct {
+	bundleRoot
+	// Reason is "manual exclusion" for the roots that the nss package
+	// excludes, and "unsupported constraint" for the roots with constraints
+	// that the fallback package can't enforce.
+	Reason string `json:"reason"`
+}
+
+// A constraintChange is a root in both bundles whose Distrust-After header
+// changed.
+type constraintChange struct {
+	Subject          string `json:"subject"`
+	SHA256           string `json:"sha256"`
+	OldDistrustAfter string `json:"oldDistrustAfter,omitempty"`
+	DistrustAfter    string `json:"distrustAfter,omitempty"`
+}
+
+// A diffReport is the JSON report printed by -diff. Roots are identified
+// by the SHA-256 hash of their certificate.
+type diffReport struct {
+	// Added are the roots that certdata.txt adds to the bundle.
+	Added []bundleRoot `json:"added"`
+	// Removed are the roots of the bundle that certdata.txt removes or no
+	// longer trusts for the purpose. Roots that are excluded instead are
+	// only listed in Excluded.
+	Removed []bundleRoot `json:"removed"`
+	// Constrained are the roots whose constraints changed.
+	Constrained []constraintChange `json:"constrained"`
+	// Excluded are all the roots trusted by certdata.txt that are not in the
+	// new bundle, whether or not they were in the old one.
+	Excluded []excludedRoot `json:"excluded"`
+}
+
+// diffBundles compares the roots of the old bundle with the new ones.
+func diffBundles(old, roots []bundleRoot, excluded []excludedRoot) *diffReport {
+	r := &diffReport{
+		Added:       []bundleRoot{},
+		Removed:     []bundleRoot{},
+		Constrained: []constraintChange{},
+		Excluded:    append([]excludedRoot{}, excluded...),
+	}
+	oldRoots := make(map[string]bundleRoot)
+	for _, root := range old {
+		oldRoots[root.SHA256] = root
+	}
+	newRoots := make(map[string]bool)
+	for _, root := range roots {
+		newRoots[root.SHA256] = true
+		o, ok := oldRoots[root.SHA256]
+		switch {
+		case !ok:
+			r.Added = append(r.Added, root)
+		case o.DistrustAfter != root.DistrustAfter:
+			r.Constrained = append(r.Constrained, constraintChange{
+				Subject:          root.Subject,
+				SHA256:           root.SHA256,
+				OldDistrustAfter: o.DistrustAfter,
+				DistrustAfter:    root.DistrustAfter,
+			})
+		}
+	}
+	// Excluded roots are reported as such, rather than as removed.
+	for _, root := range excluded {
+		newRoots[root.SHA256] = true
+	}
+	for _, root := range old {
+		if !newRoots[root.SHA256] {
+			r.Removed = append(r.Removed, root)
+		}
+	}
+	return r
+}
+
+// readBundle returns the roots of the bundle generated at path.
+func readBundle(path string) ([]bundleRoot, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_, rest, ok := strings.Cut(string(src), "const pemRoots = `")
+	if !ok {
+		return nil, errors.New("no pemRoots constant in " + path)
+	}
+	data, _, _ := strings.Cut(rest, "`")
+
+	var roots []bundleRoot
+	b := []byte(data)
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, newBundleRoot(cert, block.Headers["Distrust-After"]))
+	}
+	return roots, nil
+}
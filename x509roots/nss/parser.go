@@ -12,8 +12,11 @@ package nss
 import (
 	"bufio"
 	"bytes"
+	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -33,6 +36,7 @@ type Kind int
 
 const (
 	CKA_NSS_SERVER_DISTRUST_AFTER Kind = iota
+	CKA_NSS_EMAIL_DISTRUST_AFTER
 )
 
 // DistrustAfter is a Constraint that indicates a certificate has a
@@ -45,20 +49,96 @@ func (DistrustAfter) Kind() Kind {
 	return CKA_NSS_SERVER_DISTRUST_AFTER
 }
 
-// A Certificate represents a single trusted serverAuth certificate in the NSS
-// certdata.txt list and any constraints that should be applied to chains
-// rooted by it.
+// EmailDistrustAfter is the equivalent of DistrustAfter for the
+// CKA_NSS_EMAIL_DISTRUST_AFTER constraint, which applies to certificates
+// used for email protection. It is only returned by ParsePurpose.
+type EmailDistrustAfter time.Time
+
+func (EmailDistrustAfter) Kind() Kind {
+	return CKA_NSS_EMAIL_DISTRUST_AFTER
+}
+
+// A Purpose is a use of certificates that the roots of certdata.txt may be
+// trusted for.
+type Purpose int
+
+const (
+	// PurposeServerAuth is TLS server authentication, the
+	// CKA_TRUST_SERVER_AUTH trust bit.
+	PurposeServerAuth Purpose = iota
+	// PurposeEmailProtection is email protection (S/MIME), the
+	// CKA_TRUST_EMAIL_PROTECTION trust bit.
+	PurposeEmailProtection
+)
+
+// A Certificate represents a single trusted certificate in the NSS
+// certdata.txt list, the purposes it is trusted for, and any constraints that
+// should be applied to chains rooted by it.
 type Certificate struct {
 	// Certificate is the parsed certificate
 	X509 *x509.Certificate
 	// Constraints contains a list of additional constraints that should be
-	// applied to any certificates that chain to Certificate. If there are
-	// any unknown constraints in the slice, Certificate should not be
-	// trusted.
+	// applied to any certificates that chain to Certificate when used for
+	// serverAuth. If there are any unknown constraints in the slice,
+	// Certificate should not be trusted.
 	Constraints []Constraint
+
+	// ServerAuth and EmailProtection report whether the certificate is
+	// trusted to issue certificates for TLS server authentication and for
+	// email protection (S/MIME), respectively. These are the
+	// CKA_TRUST_SERVER_AUTH and CKA_TRUST_EMAIL_PROTECTION trust bits.
+	ServerAuth      bool
+	EmailProtection bool
+
+	// ServerDistrustAfter and EmailDistrustAfter, if not nil, are the
+	// CKA_NSS_SERVER_DISTRUST_AFTER and CKA_NSS_EMAIL_DISTRUST_AFTER dates,
+	// after which certificates issued by Certificate, according to their
+	// NotBefore, should not be trusted for the respective purpose.
+	ServerDistrustAfter *time.Time
+	EmailDistrustAfter  *time.Time
+
+	// Label is the CKA_LABEL of the certificate object, such as
+	// "ISRG Root X1".
+	Label string
+
+	// Line is the line number in certdata.txt of the CKA_CLASS attribute of
+	// the certificate object, starting at 1.
+	Line int
 }
 
-func parseMulitLineOctal(s *bufio.Scanner) ([]byte, error) {
+// A File is a certdata.txt file, as returned by ParseFile.
+type File struct {
+	// Version is the revision of the file in its CVS_ID line, such as
+	// "1.87", or empty if it has none. Recent files have no CVS_ID: the
+	// version of the builtins module is then in nssckbi.h, see
+	// ParseBuiltinsVersion.
+	Version string
+
+	// Certificates are the roots trusted for the purpose given to
+	// ParseFile, as returned by ParsePurpose.
+	Certificates []*Certificate
+
+	// Excluded are the roots trusted for the purpose that the parser
+	// leaves out of Certificates on purpose, because certdata.txt doesn't
+	// encode all of their constraints.
+	Excluded []*Certificate
+}
+
+// lineScanner is a bufio.Scanner which counts lines.
+type lineScanner struct {
+	*bufio.Scanner
+	line int
+}
+
+func (s *lineScanner) Scan() bool {
+	if !s.Scanner.Scan() {
+		return false
+	}
+	s.line++
+	return true
+}
+
+func parseMulitLineOctal(s *lineScanner) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
 	for s.Scan() {
 		if s.Text() == "END" {
@@ -74,13 +154,31 @@ func parseMulitLineOctal(s *bufio.Scanner) ([]byte, error) {
 }
 
 type certObj struct {
-	c             *x509.Certificate
-	DistrustAfter *time.Time
+	c                  *x509.Certificate
+	DistrustAfter      *time.Time
+	EmailDistrustAfter *time.Time
+	label              string
+	line               int
+	// sha256 is the SHA-256 fingerprint in the comment before the object,
+	// if any.
+	sha256 []byte
+}
+
+func parseDistrustAfter(s *lineScanner) (*time.Time, error) {
+	dateStr, err := parseMulitLineOctal(s)
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.Parse("060102150405Z0700", string(dateStr))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
-func parseCertClass(s *bufio.Scanner) ([sha1.Size]byte, *certObj, error) {
+func parseCertClass(s *lineScanner) ([sha1.Size]byte, *certObj, error) {
 	var h [sha1.Size]byte
-	co := &certObj{}
+	co := &certObj{line: s.line}
 	for s.Scan() {
 		l := s.Text()
 		if l == "" {
@@ -101,15 +199,23 @@ func parseCertClass(s *bufio.Scanner) ([sha1.Size]byte, *certObj, error) {
 			// we don't want it
 			return h, nil, nil
 		} else if l == "CKA_NSS_SERVER_DISTRUST_AFTER MULTILINE_OCTAL" {
-			dateStr, err := parseMulitLineOctal(s)
+			t, err := parseDistrustAfter(s)
+			if err != nil {
+				return h, nil, err
+			}
+			co.DistrustAfter = t
+		} else if l == "CKA_NSS_EMAIL_DISTRUST_AFTER MULTILINE_OCTAL" {
+			t, err := parseDistrustAfter(s)
 			if err != nil {
 				return h, nil, err
 			}
-			t, err := time.Parse("060102150405Z0700", string(dateStr))
+			co.EmailDistrustAfter = t
+		} else if strings.HasPrefix(l, "CKA_LABEL UTF8 ") {
+			label, err := strconv.Unquote(strings.TrimPrefix(l, "CKA_LABEL UTF8 "))
 			if err != nil {
 				return h, nil, err
 			}
-			co.DistrustAfter = &t
+			co.label = label
 		}
 	}
 	if co.c == nil {
@@ -119,10 +225,13 @@ func parseCertClass(s *bufio.Scanner) ([sha1.Size]byte, *certObj, error) {
 }
 
 type trustObj struct {
-	trusted bool
+	trusted      bool
+	emailTrusted bool
+	md5          []byte
+	sha256       []byte
 }
 
-func parseTrustClass(s *bufio.Scanner) ([sha1.Size]byte, *trustObj, error) {
+func parseTrustClass(s *lineScanner) ([sha1.Size]byte, *trustObj, error) {
 	var h [sha1.Size]byte
 	to := &trustObj{trusted: false} // default to untrusted
 
@@ -138,9 +247,16 @@ func parseTrustClass(s *bufio.Scanner) ([sha1.Size]byte, *trustObj, error) {
 				return h, nil, err
 			}
 			copy(h[:], hash)
+		} else if l == "CKA_CERT_MD5_HASH MULTILINE_OCTAL" {
+			hash, err := parseMulitLineOctal(s)
+			if err != nil {
+				return h, nil, err
+			}
+			to.md5 = hash
 		} else if l == "CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_TRUSTED_DELEGATOR" {
-			// we only care about server auth
 			to.trusted = true
+		} else if l == "CKA_TRUST_EMAIL_PROTECTION CK_TRUST CKT_NSS_TRUSTED_DELEGATOR" {
+			to.emailTrusted = true
 		}
 	}
 
@@ -175,6 +291,108 @@ var manualExclusions = map[string]bool{
 //
 // Parse is not intended to be a general purpose parser for certdata.txt.
 func Parse(r io.Reader) ([]*Certificate, error) {
+	f, err := parse(r, parseOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return f.Certificates, nil
+}
+
+// ParseAll is like Parse, but also returns roots that are only trusted for
+// email protection. The ServerAuth and EmailProtection fields of the
+// returned certificates must be checked to build a bundle for one purpose.
+func ParseAll(r io.Reader) ([]*Certificate, error) {
+	f, err := parse(r, parseOptions{all: true})
+	if err != nil {
+		return nil, err
+	}
+	return f.Certificates, nil
+}
+
+// ParsePurpose is like Parse, but returns the roots trusted for the given
+// purpose. The Constraints of the returned certificates are those that apply
+// when they are used for that purpose, such as EmailDistrustAfter for
+// PurposeEmailProtection.
+func ParsePurpose(r io.Reader, purpose Purpose) ([]*Certificate, error) {
+	f, err := parsePurpose(r, purpose, false)
+	if err != nil {
+		return nil, err
+	}
+	return f.Certificates, nil
+}
+
+// ParseFile is like ParsePurpose, but also returns the version of the file,
+// and checks it more strictly: the file must be under the Mozilla Public
+// License 2.0, and the SHA-256 fingerprints in the comments of the
+// certificates and the MD5 hashes of the trust objects must match the
+// certificates.
+func ParseFile(r io.Reader, purpose Purpose) (*File, error) {
+	return parsePurpose(r, purpose, true)
+}
+
+// ParseBuiltinsVersion returns the version of the NSS builtins module, such
+// as "2.68", from the NSS_BUILTINS_LIBRARY_VERSION definition of nssckbi.h,
+// which is next to certdata.txt in the NSS source tree.
+func ParseBuiltinsVersion(r io.Reader) (string, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) == 3 && f[0] == "#define" && f[1] == "NSS_BUILTINS_LIBRARY_VERSION" {
+			return strconv.Unquote(f[2])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("NSS_BUILTINS_LIBRARY_VERSION not found")
+}
+
+func parsePurpose(r io.Reader, purpose Purpose, strict bool) (*File, error) {
+	switch purpose {
+	case PurposeServerAuth:
+		return parse(r, parseOptions{strict: strict})
+	case PurposeEmailProtection:
+	default:
+		return nil, fmt.Errorf("unknown purpose %d", purpose)
+	}
+	f, err := parse(r, parseOptions{all: true, strict: strict})
+	if err != nil {
+		return nil, err
+	}
+	f.Certificates = emailCertificates(f.Certificates)
+	f.Excluded = emailCertificates(f.Excluded)
+	return f, nil
+}
+
+// emailCertificates returns the certificates of all that are trusted for
+// email protection, with the constraints that apply to that purpose.
+func emailCertificates(all []*Certificate) []*Certificate {
+	var certs []*Certificate
+	for _, c := range all {
+		if !c.EmailProtection {
+			continue
+		}
+		c.Constraints = nil
+		if c.EmailDistrustAfter != nil {
+			c.Constraints = append(c.Constraints, EmailDistrustAfter(*c.EmailDistrustAfter))
+		}
+		certs = append(certs, c)
+	}
+	return certs
+}
+
+type parseOptions struct {
+	// all includes the roots only trusted for email protection.
+	all bool
+	// strict enables the checks of ParseFile.
+	strict bool
+}
+
+// mplNotice is the start of the license notice of certdata.txt, with
+// whitespace normalized.
+const mplNotice = "This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0."
+
+func parse(r io.Reader, opts parseOptions) (*File, error) {
 	// certdata.txt is a rather strange format. It is essentially a list of
 	// textual PKCS#11 objects, delimited by empty lines. There are two main
 	// types of objects, certificates (CKO_CERTIFICATE) and trust definitions
@@ -196,7 +414,13 @@ func Parse(r io.Reader) ([]*Certificate, error) {
 	// it feels like that would be over engineered for the little information
 	// that we really care about.
 
-	scanner := bufio.NewScanner(r)
+	scanner := &lineScanner{Scanner: bufio.NewScanner(r)}
+	file := &File{}
+	// header accumulates the comments before the first object, which
+	// contain the license notice.
+	var header []string
+	inHeader := true
+	var fingerprint []byte
 
 	type nssEntry struct {
 		cert  *certObj
@@ -205,10 +429,36 @@ func Parse(r io.Reader) ([]*Certificate, error) {
 	entries := map[[sha1.Size]byte]*nssEntry{}
 
 	for scanner.Scan() {
+		l := scanner.Text()
+		if strings.HasPrefix(l, "#") {
+			comment := strings.TrimSpace(strings.TrimPrefix(l, "#"))
+			if inHeader && comment != "" {
+				header = append(header, comment)
+			}
+			if v := strings.TrimPrefix(comment, "Fingerprint (SHA-256):"); v != comment {
+				b, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(v), ":", ""))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: malformed SHA-256 fingerprint", scanner.line)
+				}
+				fingerprint = b
+			}
+			continue
+		}
+		if strings.HasPrefix(l, "CVS_ID ") {
+			// CVS_ID "@(#) $RCSfile: certdata.txt,v $ $Revision: 1.87 $ $Date: ... $"
+			f := strings.Fields(l)
+			for i := 0; i+1 < len(f); i++ {
+				if f[i] == "$Revision:" {
+					file.Version = f[i+1]
+				}
+			}
+			continue
+		}
 		// scan until we hit CKA_CLASS
-		if !strings.HasPrefix(scanner.Text(), "CKA_CLASS") {
+		if !strings.HasPrefix(l, "CKA_CLASS") {
 			continue
 		}
+		inHeader = false
 
 		f := strings.Fields(scanner.Text())
 		if len(f) != 3 {
@@ -221,6 +471,7 @@ func Parse(r io.Reader) ([]*Certificate, error) {
 				return nil, err
 			}
 			if co != nil {
+				co.sha256 = fingerprint
 				e, ok := entries[h]
 				if !ok {
 					e = &nssEntry{}
@@ -235,6 +486,7 @@ func Parse(r io.Reader) ([]*Certificate, error) {
 				return nil, err
 			}
 			if to != nil {
+				to.sha256 = fingerprint
 				e, ok := entries[h]
 				if !ok {
 					e = &nssEntry{}
@@ -243,12 +495,15 @@ func Parse(r io.Reader) ([]*Certificate, error) {
 				e.trust = to
 			}
 		}
+		fingerprint = nil
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
+	if opts.strict && !strings.Contains(strings.Join(header, " "), mplNotice) {
+		return nil, errors.New("certdata.txt is not under the Mozilla Public License 2.0")
+	}
 
-	var certs []*Certificate
 	for h, e := range entries {
 		if e.cert == nil && e.trust != nil {
 			// We may skip some certificates which are distrusted due to mozilla
@@ -259,18 +514,49 @@ func Parse(r io.Reader) ([]*Certificate, error) {
 		} else if e.cert != nil && e.trust == nil {
 			return nil, fmt.Errorf("missing trust object for certificate with SHA1 hash: %x", h)
 		}
-		if !e.trust.trusted {
-			continue
+		if opts.strict {
+			if err := checkFingerprints(e.cert, e.trust); err != nil {
+				return nil, err
+			}
 		}
-		if manualExclusions[fmt.Sprintf("%x", h)] {
+		if !e.trust.trusted && !(opts.all && e.trust.emailTrusted) {
 			continue
 		}
-		nssCert := &Certificate{X509: e.cert.c}
+		nssCert := &Certificate{
+			X509:                e.cert.c,
+			ServerAuth:          e.trust.trusted,
+			EmailProtection:     e.trust.emailTrusted,
+			ServerDistrustAfter: e.cert.DistrustAfter,
+			EmailDistrustAfter:  e.cert.EmailDistrustAfter,
+			Label:               e.cert.label,
+			Line:                e.cert.line,
+		}
 		if e.cert.DistrustAfter != nil {
 			nssCert.Constraints = append(nssCert.Constraints, DistrustAfter(*e.cert.DistrustAfter))
 		}
-		certs = append(certs, nssCert)
+		if manualExclusions[fmt.Sprintf("%x", h)] {
+			file.Excluded = append(file.Excluded, nssCert)
+			continue
+		}
+		file.Certificates = append(file.Certificates, nssCert)
 	}
 
-	return certs, nil
+	return file, nil
+}
+
+// checkFingerprints checks that the hashes in the certificate object co and
+// in its trust object to, other than the SHA-1 hash which links them, match
+// the certificate.
+func checkFingerprints(co *certObj, to *trustObj) error {
+	raw := co.c.Raw
+	sum256 := sha256.Sum256(raw)
+	for _, fp := range [][]byte{co.sha256, to.sha256} {
+		if fp != nil && !bytes.Equal(fp, sum256[:]) {
+			return fmt.Errorf("line %d: SHA-256 fingerprint does not match the certificate", co.line)
+		}
+	}
+	if sum := md5.Sum(raw); to.md5 != nil && !bytes.Equal(to.md5, sum[:]) {
+		return fmt.Errorf("line %d: MD5 hash of the trust object does not match the certificate", co.line)
+	}
+	return nil
 }
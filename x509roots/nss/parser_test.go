@@ -5,8 +5,10 @@
 package nss
 
 import (
+	"crypto/sha1"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"reflect"
 	"sort"
 	"strings"
@@ -86,6 +88,99 @@ As8e5ZTZ845b2EzwnexhF7sUMlQMAimTHpKG9n/v55IFDlndmQguLvqcAFLTxWYp
 1uwJ
 -----END CERTIFICATE-----`))
 
+func TestParseAll(t *testing.T) {
+	// Make the Comodo root trusted only for email protection.
+	comodoTrust := strings.Index(validCertdata, `# Trust for "Comodo AAA Services root"`)
+	if comodoTrust < 0 {
+		t.Fatal("Comodo trust object not found")
+	}
+	data := validCertdata[:comodoTrust] + strings.Replace(validCertdata[comodoTrust:],
+		"CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_TRUSTED_DELEGATOR",
+		"CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_MUST_VERIFY_TRUST", 1)
+
+	nc, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nc) != 1 || !nc[0].X509.Equal(testTrustcor) {
+		t.Fatalf("Parse returned %d certs, want only the serverAuth one", len(nc))
+	}
+
+	nc, err = ParseAll(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nc) != 2 {
+		t.Fatalf("ParseAll returned %d certs, want 2", len(nc))
+	}
+	for _, c := range nc {
+		wantServerAuth := c.X509.Equal(testTrustcor)
+		if c.ServerAuth != wantServerAuth || !c.EmailProtection {
+			t.Errorf("%s: ServerAuth = %v, EmailProtection = %v; want %v, true", c.X509.Subject, c.ServerAuth, c.EmailProtection, wantServerAuth)
+		}
+	}
+}
+
+func TestParsePurpose(t *testing.T) {
+	// Make the Comodo root trusted only for email protection, and the
+	// Trustcor root only for serverAuth.
+	comodoTrust := strings.Index(validCertdata, `# Trust for "Comodo AAA Services root"`)
+	if comodoTrust < 0 {
+		t.Fatal("Comodo trust object not found")
+	}
+	data := validCertdata[:comodoTrust] + strings.Replace(validCertdata[comodoTrust:],
+		"CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_TRUSTED_DELEGATOR",
+		"CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_MUST_VERIFY_TRUST", 1)
+	trustcorTrust := strings.Index(data, `# Trust for "TrustCor`)
+	if trustcorTrust < 0 {
+		t.Fatal("Trustcor trust object not found")
+	}
+	data = data[:trustcorTrust] + strings.Replace(data[trustcorTrust:],
+		"CKA_TRUST_EMAIL_PROTECTION CK_TRUST CKT_NSS_TRUSTED_DELEGATOR",
+		"CKA_TRUST_EMAIL_PROTECTION CK_TRUST CKT_NSS_MUST_VERIFY_TRUST", 1)
+
+	nc, err := ParsePurpose(strings.NewReader(data), PurposeServerAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nc) != 1 || !nc[0].X509.Equal(testTrustcor) {
+		t.Fatalf("ParsePurpose(PurposeServerAuth) returned %d certs, want only the Trustcor one", len(nc))
+	}
+	if len(nc[0].Constraints) != 1 || nc[0].Constraints[0].Kind() != CKA_NSS_SERVER_DISTRUST_AFTER {
+		t.Errorf("serverAuth constraints = %v, want a DistrustAfter", nc[0].Constraints)
+	}
+
+	nc, err = ParsePurpose(strings.NewReader(data), PurposeEmailProtection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nc) != 1 || !nc[0].X509.Equal(testComodo) {
+		t.Fatalf("ParsePurpose(PurposeEmailProtection) returned %d certs, want only the Comodo one", len(nc))
+	}
+	if len(nc[0].Constraints) != 0 {
+		t.Errorf("email constraints = %v, want none", nc[0].Constraints)
+	}
+
+	// The Trustcor root has an email distrust date.
+	nc, err = ParsePurpose(strings.NewReader(validCertdata), PurposeEmailProtection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range nc {
+		if !c.X509.Equal(testTrustcor) {
+			continue
+		}
+		if len(c.Constraints) != 1 || c.Constraints[0].Kind() != CKA_NSS_EMAIL_DISTRUST_AFTER ||
+			!time.Time(c.Constraints[0].(EmailDistrustAfter)).Equal(*c.EmailDistrustAfter) {
+			t.Errorf("email constraints = %v, want an EmailDistrustAfter", c.Constraints)
+		}
+	}
+
+	if _, err := ParsePurpose(strings.NewReader(data), Purpose(42)); err == nil {
+		t.Error("ParsePurpose accepted an unknown purpose")
+	}
+}
+
 func TestParseCertData(t *testing.T) {
 	trustcorDistrust, err := time.Parse("060102150405Z0700", "221130000000Z")
 	if err != nil {
@@ -102,8 +197,17 @@ func TestParseCertData(t *testing.T) {
 			name: "valid certs",
 			data: validCertdata,
 			output: []*Certificate{
-				&Certificate{X509: testComodo},
-				&Certificate{X509: testTrustcor, Constraints: []Constraint{DistrustAfter(trustcorDistrust)}},
+				&Certificate{X509: testComodo, ServerAuth: true, EmailProtection: true, Label: "Comodo AAA Services root", Line: 11},
+				&Certificate{
+					X509:                testTrustcor,
+					Constraints:         []Constraint{DistrustAfter(trustcorDistrust)},
+					ServerAuth:          true,
+					EmailProtection:     true,
+					ServerDistrustAfter: &trustcorDistrust,
+					EmailDistrustAfter:  &trustcorDistrust,
+					Label:               "TrustCor RootCert CA-2",
+					Line:                163,
+				},
 			},
 		},
 		{
@@ -178,6 +282,93 @@ func TestParseCertData(t *testing.T) {
 	}
 }
 
+const licenseHeader = `# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+CVS_ID "@(#) $RCSfile: certdata.txt,v $ $Revision: 1.87 $ $Date: 2012/12/29 16:32:45 $"
+
+`
+
+func TestParseFile(t *testing.T) {
+	f, err := ParseFile(strings.NewReader(licenseHeader+validCertdata), PurposeServerAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != "1.87" {
+		t.Errorf("Version = %q, want 1.87", f.Version)
+	}
+	if len(f.Certificates) != 2 {
+		t.Fatalf("ParseFile returned %d certs, want 2", len(f.Certificates))
+	}
+	for _, c := range f.Certificates {
+		wantLine := 16
+		if c.X509.Equal(testTrustcor) {
+			wantLine = 168
+		}
+		if c.Line != wantLine {
+			t.Errorf("%s: Line = %d, want %d", c.Label, c.Line, wantLine)
+		}
+	}
+
+	if _, err := ParseFile(strings.NewReader(validCertdata), PurposeServerAuth); err == nil {
+		t.Error("ParseFile accepted a file without license notice")
+	}
+	// The lax parser doesn't check the license.
+	if _, err := ParsePurpose(strings.NewReader(validCertdata), PurposeServerAuth); err != nil {
+		t.Errorf("ParsePurpose: %v", err)
+	}
+
+	for name, corrupt := range map[string][2]string{
+		"SHA-256 fingerprint": {"# Fingerprint (SHA-256): D7:A7", "# Fingerprint (SHA-256): D7:A8"},
+		"MD5 hash":            {`\111\171\004\260`, `\111\171\004\261`},
+	} {
+		data := strings.Replace(validCertdata, corrupt[0], corrupt[1], 1)
+		if data == validCertdata {
+			t.Fatalf("%s: test data not found", name)
+		}
+		if _, err := ParseFile(strings.NewReader(licenseHeader+data), PurposeEmailProtection); err == nil || !strings.Contains(err.Error(), "line 16") {
+			t.Errorf("%s: got error %v, want a mismatch at line 16", name, err)
+		}
+	}
+}
+
+func TestParseFileExcluded(t *testing.T) {
+	trustcor := fmt.Sprintf("%x", sha1.Sum(testTrustcor.Raw))
+	manualExclusions[trustcor] = true
+	defer delete(manualExclusions, trustcor)
+
+	for _, purpose := range []Purpose{PurposeServerAuth, PurposeEmailProtection} {
+		f, err := ParseFile(strings.NewReader(licenseHeader+validCertdata), purpose)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Certificates) != 1 || !f.Certificates[0].X509.Equal(testComodo) {
+			t.Errorf("purpose %d: ParseFile returned %d certs, want only the Comodo root", purpose, len(f.Certificates))
+		}
+		if len(f.Excluded) != 1 || !f.Excluded[0].X509.Equal(testTrustcor) {
+			t.Errorf("purpose %d: ParseFile excluded %d certs, want only the Trustcor root", purpose, len(f.Excluded))
+		}
+	}
+}
+
+func TestParseBuiltinsVersion(t *testing.T) {
+	const nssckbi = `/* This Source Code Form is subject to the terms of the Mozilla Public */
+#ifndef NSSCKBI_H
+#define NSSCKBI_H
+#define NSS_BUILTINS_LIBRARY_VERSION_MAJOR 2
+#define NSS_BUILTINS_LIBRARY_VERSION_MINOR 68
+#define NSS_BUILTINS_LIBRARY_VERSION "2.68"
+#endif /* NSSCKBI_H */
+`
+	v, err := ParseBuiltinsVersion(strings.NewReader(nssckbi))
+	if err != nil || v != "2.68" {
+		t.Errorf("got version %q, %v; want 2.68", v, err)
+	}
+	if _, err := ParseBuiltinsVersion(strings.NewReader(validCertdata)); err == nil {
+		t.Error("ParseBuiltinsVersion succeeded without a version")
+	}
+}
+
 const validCertdata = `#
 # Certificate "Comodo AAA Services root"
 #